@@ -24,6 +24,7 @@ import (
 	"strconv"
 
 	"github.com/google/exposure-notifications-verification-server/internal/routes"
+	"github.com/google/exposure-notifications-verification-server/pkg/auditsink"
 	"github.com/google/exposure-notifications-verification-server/pkg/buildinfo"
 	"github.com/google/exposure-notifications-verification-server/pkg/cache"
 	"github.com/google/exposure-notifications-verification-server/pkg/config"
@@ -94,6 +95,19 @@ func realMain(ctx context.Context) error {
 	}
 	defer db.Close()
 
+	// Setup audit sinks
+	if cfg.AuditSinks.Enabled() {
+		sinks, err := auditsink.SinksFor(ctx, &cfg.AuditSinks)
+		if err != nil {
+			return fmt.Errorf("failed to create audit sinks: %w", err)
+		}
+		dispatcher := auditsink.NewDispatcher(&cfg.AuditSinks, db, sinks)
+		defer dispatcher.Close()
+
+		db.OnAuditEntryCreated(dispatcher.Notify)
+		go dispatcher.Run(ctx)
+	}
+
 	// Setup rate limiter
 	limiterStore, err := ratelimit.RateLimiterFor(ctx, &cfg.RateLimit)
 	if err != nil {
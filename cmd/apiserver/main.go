@@ -27,10 +27,10 @@ import (
 	"github.com/google/exposure-notifications-verification-server/pkg/buildinfo"
 	"github.com/google/exposure-notifications-verification-server/pkg/cache"
 	"github.com/google/exposure-notifications-verification-server/pkg/config"
+	"github.com/google/exposure-notifications-verification-server/pkg/keyutils"
 	"github.com/google/exposure-notifications-verification-server/pkg/ratelimit"
 	"github.com/gorilla/handlers"
 
-	"github.com/google/exposure-notifications-server/pkg/keys"
 	"github.com/google/exposure-notifications-server/pkg/logging"
 	"github.com/google/exposure-notifications-server/pkg/observability"
 	"github.com/google/exposure-notifications-server/pkg/server"
@@ -95,6 +95,12 @@ func realMain(ctx context.Context) error {
 	}
 	defer db.Close()
 
+	// Import any token signing keys from the environment. This is a no-op once
+	// token signing keys are managed in the database.
+	if err := db.ImportTokenSigningKeys(cfg.TokenSigning.TokenSigningKeys, cfg.TokenSigning.TokenSigningKeyIDs); err != nil {
+		return fmt.Errorf("failed to import token signing keys: %w", err)
+	}
+
 	// Setup rate limiter
 	limiterStore, err := ratelimit.RateLimiterFor(ctx, &cfg.RateLimit)
 	if err != nil {
@@ -103,17 +109,13 @@ func realMain(ctx context.Context) error {
 	defer limiterStore.Close(ctx)
 
 	// Setup signers
-	tokenSigner, err := keys.KeyManagerFor(ctx, &cfg.TokenSigning.Keys)
-	if err != nil {
-		return fmt.Errorf("failed to create token key manager: %w", err)
-	}
-	certificateSigner, err := keys.KeyManagerFor(ctx, &cfg.CertificateSigning.Keys)
+	certificateSigner, err := keyutils.KeyManagerFor(ctx, &cfg.CertificateSigning.Keys)
 	if err != nil {
 		return fmt.Errorf("failed to create certificate key manager: %w", err)
 	}
 
 	// Setup routes
-	mux, closer, err := routes.APIServer(ctx, cfg, db, cacher, limiterStore, tokenSigner, certificateSigner)
+	mux, closer, err := routes.APIServer(ctx, cfg, db, cacher, limiterStore, certificateSigner)
 	defer closer()
 	if err != nil {
 		return fmt.Errorf("failed to setup routes: %w", err)
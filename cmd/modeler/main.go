@@ -13,7 +13,8 @@
 // limitations under the License.
 
 // This server builds or re-builds the statistical models for predicting the
-// future number of codes a realm with generate for abuse prevention.
+// future number of codes a realm with generate for abuse prevention. It also
+// sends scheduled statistics reports.
 package main
 
 import (
@@ -28,8 +29,10 @@ import (
 	"github.com/google/exposure-notifications-verification-server/pkg/config"
 	"github.com/google/exposure-notifications-verification-server/pkg/controller/middleware"
 	"github.com/google/exposure-notifications-verification-server/pkg/controller/modeler"
+	"github.com/google/exposure-notifications-verification-server/pkg/controller/statsreport"
 	"github.com/google/exposure-notifications-verification-server/pkg/ratelimit"
 	"github.com/google/exposure-notifications-verification-server/pkg/render"
+	"github.com/google/exposure-notifications-verification-server/pkg/storage"
 
 	"github.com/google/exposure-notifications-server/pkg/logging"
 	"github.com/google/exposure-notifications-server/pkg/observability"
@@ -127,6 +130,15 @@ func realMain(ctx context.Context) error {
 	modelerController := modeler.New(ctx, cfg, db, limiterStore, h)
 	r.Handle("/", modelerController.HandleModel()).Methods("POST")
 
+	// Scheduled statistics reports
+	blobstore, err := storage.BlobstoreFor(ctx, &cfg.Storage)
+	if err != nil {
+		return fmt.Errorf("failed to create blobstore: %w", err)
+	}
+
+	statsReportController := statsreport.New(ctx, cfg, db, blobstore, h)
+	r.Handle("/stats-reports", statsReportController.HandleSend()).Methods("POST")
+
 	srv, err := server.New(cfg.Port)
 	if err != nil {
 		return fmt.Errorf("failed to create server: %w", err)
@@ -23,13 +23,14 @@ import (
 
 	"github.com/google/exposure-notifications-verification-server/internal/auth"
 	"github.com/google/exposure-notifications-verification-server/internal/routes"
+	"github.com/google/exposure-notifications-verification-server/pkg/auditsink"
 	"github.com/google/exposure-notifications-verification-server/pkg/buildinfo"
 	"github.com/google/exposure-notifications-verification-server/pkg/cache"
 	"github.com/google/exposure-notifications-verification-server/pkg/config"
+	"github.com/google/exposure-notifications-verification-server/pkg/keyutils"
 	"github.com/google/exposure-notifications-verification-server/pkg/ratelimit"
 	"github.com/gorilla/handlers"
 
-	"github.com/google/exposure-notifications-server/pkg/keys"
 	"github.com/google/exposure-notifications-server/pkg/logging"
 	"github.com/google/exposure-notifications-server/pkg/observability"
 	"github.com/google/exposure-notifications-server/pkg/server"
@@ -94,8 +95,21 @@ func realMain(ctx context.Context) error {
 	}
 	defer db.Close()
 
+	// Setup audit sinks
+	if cfg.AuditSinks.Enabled() {
+		sinks, err := auditsink.SinksFor(ctx, &cfg.AuditSinks)
+		if err != nil {
+			return fmt.Errorf("failed to create audit sinks: %w", err)
+		}
+		dispatcher := auditsink.NewDispatcher(&cfg.AuditSinks, db, sinks)
+		defer dispatcher.Close()
+
+		db.OnAuditEntryCreated(dispatcher.Notify)
+		go dispatcher.Run(ctx)
+	}
+
 	// Setup signers
-	certificateSigner, err := keys.KeyManagerFor(ctx, &cfg.CertificateSigning.Keys)
+	certificateSigner, err := keyutils.KeyManagerFor(ctx, &cfg.CertificateSigning.Keys)
 	if err != nil {
 		return fmt.Errorf("failed to create certificate key manager: %w", err)
 	}
@@ -108,9 +122,18 @@ func realMain(ctx context.Context) error {
 	defer limiterStore.Close(ctx)
 
 	// Setup auth provider
-	authProvider, err := auth.NewFirebase(ctx, cfg.FirebaseConfig())
-	if err != nil {
-		return fmt.Errorf("failed to create firebase auth provider: %w", err)
+	var authProvider auth.Provider
+	switch cfg.AuthProvider {
+	case config.AuthProviderOIDC:
+		authProvider, err = auth.NewOIDC(ctx, cfg.OIDC.AuthConfigs())
+		if err != nil {
+			return fmt.Errorf("failed to create oidc auth provider: %w", err)
+		}
+	default:
+		authProvider, err = auth.NewFirebase(ctx, cfg.FirebaseConfig())
+		if err != nil {
+			return fmt.Errorf("failed to create firebase auth provider: %w", err)
+		}
 	}
 
 	// Setup routes
@@ -88,6 +88,46 @@ type Provider interface {
 	MFAEnabled(context.Context, *sessions.Session) (bool, error)
 }
 
+// RedirectProvider is a Provider that signs users in by redirecting them to an
+// upstream identity provider and back, such as an OpenID Connect issuer.
+type RedirectProvider interface {
+	Provider
+
+	// IdentityProviders returns the configured upstream identity providers, in
+	// the order they should be offered to users.
+	IdentityProviders() []*IdentityProvider
+
+	// AuthCodeURL starts a sign in with the named identity provider. It stores
+	// the state of the sign in on the session and returns the URL to which the
+	// user should be redirected. The loginHint is optional.
+	AuthCodeURL(ctx context.Context, session *sessions.Session, name, loginHint string) (string, error)
+
+	// Exchange completes the sign in started by AuthCodeURL with the state and
+	// authorization code from the callback. The returned session info is passed
+	// to StoreSession.
+	Exchange(ctx context.Context, session *sessions.Session, state, code string) (*SessionInfo, error)
+
+	// SessionIdentityProvider returns the name of the identity provider through
+	// which the user signed in. It returns an error if the session does not
+	// exist.
+	SessionIdentityProvider(context.Context, *sessions.Session) (string, error)
+
+	// SessionSubject returns the subject of the user at the identity provider
+	// through which they signed in. Users are identified by the identity
+	// provider and subject, not by their email address.
+	SessionSubject(context.Context, *sessions.Session) (string, error)
+}
+
+// IdentityProvider describes an upstream identity provider.
+type IdentityProvider struct {
+	// Name is the unique name of the identity provider. Realms are bound to
+	// identity providers by name.
+	Name string
+
+	// DisplayName is the name shown to users.
+	DisplayName string
+}
+
 // SessionInfo is a generic struct used to store session information. Not all
 // providers use all fields.
 type SessionInfo struct {
@@ -0,0 +1,900 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/exposure-notifications-verification-server/internal/project"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/gorilla/sessions"
+	"github.com/rakutentech/jwk-go/jwk"
+	"golang.org/x/oauth2"
+)
+
+const (
+	sessionKeyOIDCCookie = sessionKey("oidcCookie")
+	sessionKeyOIDCFlow   = sessionKey("oidcFlow")
+
+	// oidcFlowTTL is the maximum time between starting a sign in and the
+	// callback from the identity provider.
+	oidcFlowTTL = 10 * time.Minute
+
+	// oidcMetadataTTL is how long discovered provider metadata is cached.
+	oidcMetadataTTL = 1 * time.Hour
+
+	// oidcKeysMinRefresh is the minimum time between fetches of the signing
+	// keys, which are re-fetched when a token is signed by an unknown key.
+	oidcKeysMinRefresh = 1 * time.Minute
+
+	// oidcLeeway is the allowed clock skew when validating token times.
+	oidcLeeway = 1 * time.Minute
+
+	// oidcMaxResponseSize is the maximum size of a discovery or keys response.
+	oidcMaxResponseSize = 1 << 20
+)
+
+var (
+	ErrUnknownIdentityProvider = fmt.Errorf("unknown identity provider")
+
+	// ErrEmailNotVerified is the error returned when the identity provider does
+	// not assert that the user's email address is verified.
+	ErrEmailNotVerified = fmt.Errorf("email address is not verified by the identity provider")
+
+	errOIDCPasswords    = fmt.Errorf("passwords are managed by the identity provider")
+	errOIDCVerification = fmt.Errorf("email addresses are verified by the identity provider")
+
+	oidcNameRegexp = regexp.MustCompile(`\A[a-z0-9][a-z0-9-]*\z`)
+)
+
+// OIDCConfig is the configuration for an OpenID Connect identity provider.
+type OIDCConfig struct {
+	// Name is the unique name of the identity provider. It must contain only
+	// lowercase letters, numbers, and dashes.
+	Name string
+
+	// DisplayName is the name shown to users. It defaults to the name.
+	DisplayName string
+
+	// Issuer is the issuer URL. The provider configuration is discovered from
+	// the issuer's /.well-known/openid-configuration.
+	Issuer string
+
+	// ClientID and ClientSecret are the client credentials. The secret is
+	// optional for public clients, since all sign ins use PKCE.
+	ClientID     string
+	ClientSecret string
+
+	// RedirectURL is the URL of the callback handler registered with the
+	// identity provider.
+	RedirectURL string
+
+	// Scopes are the requested scopes. The "openid" scope is always requested.
+	Scopes []string
+
+	// EmailClaim is the ID token claim with the user's email address. It
+	// defaults to "email".
+	EmailClaim string
+
+	// AssumeEmailVerified treats email addresses as verified if the ID token
+	// does not have an "email_verified" claim. Some identity providers only
+	// issue email addresses they manage and omit the claim.
+	AssumeEmailVerified bool
+
+	// MFAAMRValues are the authentication method references ("amr") and
+	// MFAACRValues are the authentication context class references ("acr")
+	// which indicate the user signed in with multiple factors. Either matching
+	// is sufficient. MFAAMRValues defaults to "mfa".
+	MFAAMRValues []string
+	MFAACRValues []string
+
+	// HTTPClient is the client used to talk to the identity provider. It
+	// defaults to a client with a short timeout.
+	HTTPClient *http.Client
+}
+
+type oidcAuth struct {
+	providers map[string]*oidcProvider
+	ordered   []*IdentityProvider
+	loginURL  string
+}
+
+// NewOIDC creates a new auth provider which signs users in with one or more
+// OpenID Connect identity providers. The identity providers are not contacted
+// until the first sign in.
+func NewOIDC(ctx context.Context, configs []*OIDCConfig) (RedirectProvider, error) {
+	if len(configs) == 0 {
+		return nil, fmt.Errorf("at least one identity provider is required")
+	}
+
+	a := &oidcAuth{
+		providers: make(map[string]*oidcProvider, len(configs)),
+		ordered:   make([]*IdentityProvider, 0, len(configs)),
+	}
+
+	for _, c := range configs {
+		p, err := newOIDCProvider(c)
+		if err != nil {
+			return nil, err
+		}
+
+		if _, ok := a.providers[c.Name]; ok {
+			return nil, fmt.Errorf("identity provider %q is configured more than once", c.Name)
+		}
+		a.providers[c.Name] = p
+		a.ordered = append(a.ordered, &IdentityProvider{
+			Name:        p.config.Name,
+			DisplayName: p.config.DisplayName,
+		})
+
+		// The login page is the root of the server that receives the callbacks.
+		if a.loginURL == "" {
+			u, err := url.Parse(c.RedirectURL)
+			if err != nil {
+				return nil, fmt.Errorf("invalid redirect URL for identity provider %q: %w", c.Name, err)
+			}
+			a.loginURL = (&url.URL{Scheme: u.Scheme, Host: u.Host, Path: "/"}).String()
+		}
+	}
+
+	return a, nil
+}
+
+// IdentityProviders returns the configured identity providers.
+func (a *oidcAuth) IdentityProviders() []*IdentityProvider {
+	return a.ordered
+}
+
+// AuthCodeURL starts an authorization code flow with PKCE with the named
+// identity provider.
+func (a *oidcAuth) AuthCodeURL(ctx context.Context, session *sessions.Session, name, loginHint string) (string, error) {
+	p, ok := a.providers[name]
+	if !ok {
+		return "", fmt.Errorf("%w: %q", ErrUnknownIdentityProvider, name)
+	}
+
+	md, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	state, err := oidcRandom()
+	if err != nil {
+		return "", err
+	}
+	nonce, err := oidcRandom()
+	if err != nil {
+		return "", err
+	}
+	verifier, err := oidcRandom()
+	if err != nil {
+		return "", err
+	}
+
+	flow, err := json.Marshal(&oidcFlowData{
+		Provider:  name,
+		State:     state,
+		Nonce:     nonce,
+		Verifier:  verifier,
+		ExpiresAt: time.Now().Add(oidcFlowTTL).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+	if err := sessionSet(session, sessionKeyOIDCFlow, string(flow)); err != nil {
+		return "", err
+	}
+
+	challenge := sha256.Sum256([]byte(verifier))
+	opts := []oauth2.AuthCodeOption{
+		oauth2.SetAuthURLParam("nonce", nonce),
+		oauth2.SetAuthURLParam("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:])),
+		oauth2.SetAuthURLParam("code_challenge_method", "S256"),
+	}
+	if loginHint != "" {
+		opts = append(opts, oauth2.SetAuthURLParam("login_hint", loginHint))
+	}
+	return p.oauth2Config(md).AuthCodeURL(state, opts...), nil
+}
+
+// Exchange validates the state, exchanges the code for tokens, and verifies
+// the ID token. The sign in state is removed from the session, so each sign in
+// can only be completed once.
+func (a *oidcAuth) Exchange(ctx context.Context, session *sessions.Session, state, code string) (*SessionInfo, error) {
+	raw, err := sessionGet(session, sessionKeyOIDCFlow)
+	sessionClear(session, sessionKeyOIDCFlow)
+	if err != nil {
+		return nil, fmt.Errorf("no sign in is in progress: %w", err)
+	}
+
+	s, ok := raw.(string)
+	if !ok {
+		return nil, fmt.Errorf("no sign in is in progress: %w", ErrSessionMissing)
+	}
+
+	var flow oidcFlowData
+	if err := json.Unmarshal([]byte(s), &flow); err != nil {
+		return nil, fmt.Errorf("failed to decode sign in: %w", err)
+	}
+
+	if time.Now().After(time.Unix(flow.ExpiresAt, 0)) {
+		return nil, fmt.Errorf("sign in has expired")
+	}
+	if subtle.ConstantTimeCompare([]byte(flow.State), []byte(state)) != 1 {
+		return nil, fmt.Errorf("sign in state does not match")
+	}
+	if code == "" {
+		return nil, fmt.Errorf("missing authorization code")
+	}
+
+	p, ok := a.providers[flow.Provider]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownIdentityProvider, flow.Provider)
+	}
+
+	md, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, p.client)
+	token, err := p.oauth2Config(md).Exchange(ctx, code,
+		oauth2.SetAuthURLParam("code_verifier", flow.Verifier))
+	if err != nil {
+		return nil, fmt.Errorf("failed to exchange authorization code: %w", err)
+	}
+
+	idToken, ok := token.Extra("id_token").(string)
+	if !ok || idToken == "" {
+		return nil, fmt.Errorf("token response is missing id_token")
+	}
+
+	// Verify now, so an invalid token is reported as a failed sign in rather
+	// than a failure to store the session.
+	if _, err := p.verify(ctx, idToken, flow.Nonce); err != nil {
+		return nil, err
+	}
+
+	return &SessionInfo{
+		Data: map[string]interface{}{
+			"provider": flow.Provider,
+			"id_token": idToken,
+			"nonce":    flow.Nonce,
+		},
+	}, nil
+}
+
+// CheckRevoked checks if the session has expired, or if the identity provider
+// through which the user signed in is no longer configured. Identity providers
+// do not publish revocations, so sessions which are revoked upstream remain
+// valid until they expire.
+func (a *oidcAuth) CheckRevoked(ctx context.Context, session *sessions.Session) error {
+	data, err := a.loadCookie(ctx, session)
+	if err != nil {
+		return err
+	}
+
+	p, ok := a.providers[data.Provider]
+	if !ok {
+		a.ClearSession(ctx, session)
+		return fmt.Errorf("%w: %q", ErrUnknownIdentityProvider, data.Provider)
+	}
+	if data.Issuer != p.config.Issuer {
+		a.ClearSession(ctx, session)
+		return fmt.Errorf("identity provider issuer has changed")
+	}
+
+	if time.Now().After(time.Unix(data.ExpiresAt, 0)) {
+		a.ClearSession(ctx, session)
+		return fmt.Errorf("session is expired")
+	}
+	return nil
+}
+
+// StoreSession verifies the ID token returned by Exchange and stores the
+// user's identity in the session.
+func (a *oidcAuth) StoreSession(ctx context.Context, session *sessions.Session, i *SessionInfo) error {
+	if i == nil || i.Data == nil {
+		a.ClearSession(ctx, session)
+		return ErrSessionInfoMissing
+	}
+
+	name, ok := i.Data["provider"].(string)
+	if !ok {
+		a.ClearSession(ctx, session)
+		return fmt.Errorf("missing provider: %w", ErrSessionInfoMissing)
+	}
+
+	idToken, ok := i.Data["id_token"].(string)
+	if !ok {
+		a.ClearSession(ctx, session)
+		return fmt.Errorf("missing id_token: %w", ErrSessionInfoMissing)
+	}
+
+	// The nonce binds the token to a sign in started by this server, so a token
+	// issued to another session cannot be replayed.
+	nonce, ok := i.Data["nonce"].(string)
+	if !ok || nonce == "" {
+		a.ClearSession(ctx, session)
+		return fmt.Errorf("missing nonce: %w", ErrSessionInfoMissing)
+	}
+
+	p, ok := a.providers[name]
+	if !ok {
+		a.ClearSession(ctx, session)
+		return fmt.Errorf("%w: %q", ErrUnknownIdentityProvider, name)
+	}
+
+	claims, err := p.verify(ctx, idToken, nonce)
+	if err != nil {
+		a.ClearSession(ctx, session)
+		return err
+	}
+
+	data, err := p.cookieData(claims)
+	if err != nil {
+		a.ClearSession(ctx, session)
+		return err
+	}
+
+	// The session lasts for the TTL rather than the lifetime of the ID token,
+	// which is usually short.
+	if i.TTL > 0 {
+		data.ExpiresAt = time.Now().Add(i.TTL).Unix()
+	}
+
+	cookie, err := json.Marshal(data)
+	if err != nil {
+		a.ClearSession(ctx, session)
+		return err
+	}
+
+	if err := sessionSet(session, sessionKeyOIDCCookie, string(cookie)); err != nil {
+		a.ClearSession(ctx, session)
+		return err
+	}
+
+	return nil
+}
+
+// ClearSession removes any session information for this auth, including a
+// sign in in progress.
+func (a *oidcAuth) ClearSession(ctx context.Context, session *sessions.Session) {
+	sessionClear(session, sessionKeyOIDCCookie)
+	sessionClear(session, sessionKeyOIDCFlow)
+}
+
+// RevokeSession clears the session. Sessions at the identity provider are
+// managed by the identity provider.
+func (a *oidcAuth) RevokeSession(ctx context.Context, session *sessions.Session) error {
+	a.ClearSession(ctx, session)
+	return nil
+}
+
+// CreateUser does not create the user, since users are managed by the
+// identity provider. If requested, it sends an invitation with a link to the
+// login page.
+func (a *oidcAuth) CreateUser(ctx context.Context, name, email, pass string, sendInvite bool, emailer InviteUserEmailFunc) (bool, error) {
+	if !sendInvite || emailer == nil {
+		return true, nil
+	}
+
+	if err := emailer(ctx, a.loginURL); err != nil {
+		return true, fmt.Errorf("failed to send new user invitation email: %w", err)
+	}
+	return true, nil
+}
+
+// EmailAddress extracts the users email from the session.
+func (a *oidcAuth) EmailAddress(ctx context.Context, session *sessions.Session) (string, error) {
+	data, err := a.loadCookie(ctx, session)
+	if err != nil {
+		return "", err
+	}
+	return data.Email, nil
+}
+
+// EmailVerified returns true if the identity provider asserted that the email
+// address is verified.
+func (a *oidcAuth) EmailVerified(ctx context.Context, session *sessions.Session) (bool, error) {
+	data, err := a.loadCookie(ctx, session)
+	if err != nil {
+		return false, err
+	}
+	return data.EmailVerified, nil
+}
+
+// MFAEnabled returns true if the user signed in with multiple factors, as
+// indicated by the "amr" or "acr" claims of the ID token.
+func (a *oidcAuth) MFAEnabled(ctx context.Context, session *sessions.Session) (bool, error) {
+	data, err := a.loadCookie(ctx, session)
+	if err != nil {
+		return false, err
+	}
+	return data.MFA, nil
+}
+
+// SessionIdentityProvider returns the name of the identity provider through
+// which the user signed in.
+func (a *oidcAuth) SessionIdentityProvider(ctx context.Context, session *sessions.Session) (string, error) {
+	data, err := a.loadCookie(ctx, session)
+	if err != nil {
+		return "", err
+	}
+	return data.Provider, nil
+}
+
+// SessionSubject returns the subject of the user at the identity provider
+// through which they signed in.
+func (a *oidcAuth) SessionSubject(ctx context.Context, session *sessions.Session) (string, error) {
+	data, err := a.loadCookie(ctx, session)
+	if err != nil {
+		return "", err
+	}
+	return data.Subject, nil
+}
+
+// ChangePassword is not supported.
+func (a *oidcAuth) ChangePassword(ctx context.Context, newPassword string, data interface{}) error {
+	return errOIDCPasswords
+}
+
+// SendResetPasswordEmail is not supported.
+func (a *oidcAuth) SendResetPasswordEmail(ctx context.Context, email string, emailer ResetPasswordEmailFunc) error {
+	return errOIDCPasswords
+}
+
+// VerifyPasswordResetCode is not supported.
+func (a *oidcAuth) VerifyPasswordResetCode(ctx context.Context, code string) (string, error) {
+	return "", errOIDCPasswords
+}
+
+// SendEmailVerificationEmail is not supported.
+func (a *oidcAuth) SendEmailVerificationEmail(ctx context.Context, email string, data interface{}, emailer EmailVerificationEmailFunc) error {
+	return errOIDCVerification
+}
+
+// loadCookie loads and parses the OIDC cookie from the session.
+func (a *oidcAuth) loadCookie(ctx context.Context, session *sessions.Session) (*oidcCookieData, error) {
+	raw, err := sessionGet(session, sessionKeyOIDCCookie)
+	if err != nil {
+		a.ClearSession(ctx, session)
+		return nil, err
+	}
+
+	cookie, ok := raw.(string)
+	if !ok || cookie == "" {
+		a.ClearSession(ctx, session)
+		return nil, ErrSessionMissing
+	}
+
+	var data oidcCookieData
+	if err := json.Unmarshal([]byte(cookie), &data); err != nil {
+		a.ClearSession(ctx, session)
+		return nil, err
+	}
+	return &data, nil
+}
+
+// oidcFlowData is the state of a sign in between AuthCodeURL and Exchange.
+type oidcFlowData struct {
+	Provider  string `json:"provider"`
+	State     string `json:"state"`
+	Nonce     string `json:"nonce"`
+	Verifier  string `json:"verifier"`
+	ExpiresAt int64  `json:"expires_at"`
+}
+
+// oidcCookieData is the identity stored in the session after sign in.
+type oidcCookieData struct {
+	Provider      string `json:"provider"`
+	Issuer        string `json:"iss"`
+	Subject       string `json:"sub"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	MFA           bool   `json:"mfa"`
+	ExpiresAt     int64  `json:"expires_at"`
+}
+
+// oidcMetadata is the subset of the provider metadata that is used. See
+// https://openid.net/specs/openid-connect-discovery-1_0.html.
+type oidcMetadata struct {
+	Issuer                        string   `json:"issuer"`
+	AuthorizationEndpoint         string   `json:"authorization_endpoint"`
+	TokenEndpoint                 string   `json:"token_endpoint"`
+	JWKSURI                       string   `json:"jwks_uri"`
+	CodeChallengeMethodsSupported []string `json:"code_challenge_methods_supported"`
+}
+
+// oidcProvider is a single identity provider. Metadata and keys are discovered
+// lazily and cached.
+type oidcProvider struct {
+	config *OIDCConfig
+	client *http.Client
+
+	lock         sync.Mutex
+	metadata     *oidcMetadata
+	metadataTime time.Time
+	keys         map[string]interface{}
+	keysTime     time.Time
+}
+
+func newOIDCProvider(c *OIDCConfig) (*oidcProvider, error) {
+	if c == nil {
+		return nil, fmt.Errorf("identity provider config is nil")
+	}
+
+	if !oidcNameRegexp.MatchString(c.Name) {
+		return nil, fmt.Errorf("identity provider name %q must contain only lowercase letters, numbers, and dashes", c.Name)
+	}
+	if c.Name == "callback" {
+		return nil, fmt.Errorf("identity provider name %q is reserved", c.Name)
+	}
+	if c.Issuer == "" {
+		return nil, fmt.Errorf("identity provider %q is missing an issuer", c.Name)
+	}
+	if c.ClientID == "" {
+		return nil, fmt.Errorf("identity provider %q is missing a client ID", c.Name)
+	}
+	if c.RedirectURL == "" {
+		return nil, fmt.Errorf("identity provider %q is missing a redirect URL", c.Name)
+	}
+
+	// Copy the config so defaults do not modify the caller's value.
+	config := *c
+	if config.DisplayName == "" {
+		config.DisplayName = config.Name
+	}
+	if config.EmailClaim == "" {
+		config.EmailClaim = "email"
+	}
+	if len(config.MFAAMRValues) == 0 {
+		config.MFAAMRValues = []string{"mfa"}
+	}
+
+	scopes := []string{"openid"}
+	for _, s := range config.Scopes {
+		if s != "openid" {
+			scopes = append(scopes, s)
+		}
+	}
+	config.Scopes = scopes
+
+	client := config.HTTPClient
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	return &oidcProvider{
+		config: &config,
+		client: client,
+	}, nil
+}
+
+func (p *oidcProvider) oauth2Config(md *oidcMetadata) *oauth2.Config {
+	return &oauth2.Config{
+		ClientID:     p.config.ClientID,
+		ClientSecret: p.config.ClientSecret,
+		RedirectURL:  p.config.RedirectURL,
+		Scopes:       p.config.Scopes,
+		Endpoint: oauth2.Endpoint{
+			AuthURL:  md.AuthorizationEndpoint,
+			TokenURL: md.TokenEndpoint,
+		},
+	}
+}
+
+// discover returns the provider metadata, fetching it from the issuer if it
+// is not cached.
+func (p *oidcProvider) discover(ctx context.Context) (*oidcMetadata, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.metadata != nil && time.Since(p.metadataTime) < oidcMetadataTTL {
+		return p.metadata, nil
+	}
+
+	u := strings.TrimSuffix(p.config.Issuer, "/") + "/.well-known/openid-configuration"
+	var md oidcMetadata
+	if err := p.getJSON(ctx, u, &md); err != nil {
+		return nil, fmt.Errorf("failed to discover identity provider %q: %w", p.config.Name, err)
+	}
+
+	if md.Issuer != p.config.Issuer {
+		return nil, fmt.Errorf("identity provider %q issuer %q does not match configured issuer %q",
+			p.config.Name, md.Issuer, p.config.Issuer)
+	}
+	if md.AuthorizationEndpoint == "" || md.TokenEndpoint == "" || md.JWKSURI == "" {
+		return nil, fmt.Errorf("identity provider %q metadata is missing endpoints", p.config.Name)
+	}
+
+	// Providers which list their PKCE methods must support S256. Providers
+	// which do not list methods are assumed to support it.
+	if methods := md.CodeChallengeMethodsSupported; len(methods) > 0 {
+		supported := false
+		for _, m := range methods {
+			if m == "S256" {
+				supported = true
+				break
+			}
+		}
+		if !supported {
+			return nil, fmt.Errorf("identity provider %q does not support PKCE with S256", p.config.Name)
+		}
+	}
+
+	p.metadata = &md
+	p.metadataTime = time.Now()
+	return p.metadata, nil
+}
+
+// key returns the public key with the given ID. If the key is not known, the
+// keys are re-fetched, at most once per oidcKeysMinRefresh. If the ID is empty
+// and the provider has exactly one key, that key is returned.
+func (p *oidcProvider) key(ctx context.Context, md *oidcMetadata, kid string) (interface{}, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	lookup := func() interface{} {
+		if kid == "" && len(p.keys) == 1 {
+			for _, k := range p.keys {
+				return k
+			}
+		}
+		return p.keys[kid]
+	}
+
+	if k := lookup(); k != nil {
+		return k, nil
+	}
+
+	if !p.keysTime.IsZero() && time.Since(p.keysTime) < oidcKeysMinRefresh {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+
+	var set struct {
+		Keys []json.RawMessage `json:"keys"`
+	}
+	if err := p.getJSON(ctx, md.JWKSURI, &set); err != nil {
+		return nil, fmt.Errorf("failed to fetch signing keys: %w", err)
+	}
+
+	// Skip keys which cannot be parsed or are not for signing, instead of
+	// failing, since providers may publish key types which are not supported.
+	keys := make(map[string]interface{}, len(set.Keys))
+	for _, raw := range set.Keys {
+		spec, err := jwk.ParseBytes(raw)
+		if err != nil {
+			continue
+		}
+		if spec.Use != "" && spec.Use != "sig" {
+			continue
+		}
+		keys[spec.KeyID] = spec.Key
+	}
+	p.keys = keys
+	p.keysTime = time.Now()
+
+	if k := lookup(); k != nil {
+		return k, nil
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+// verify verifies the ID token's signature and claims, including the nonce,
+// and returns the claims.
+func (p *oidcProvider) verify(ctx context.Context, idToken, nonce string) (jwt.MapClaims, error) {
+	md, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Times are validated below with leeway for clock skew.
+	parser := &jwt.Parser{SkipClaimsValidation: true}
+	claims := jwt.MapClaims{}
+	if _, err := parser.ParseWithClaims(idToken, claims, func(t *jwt.Token) (interface{}, error) {
+		switch t.Method.(type) {
+		case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS, *jwt.SigningMethodECDSA:
+		default:
+			return nil, fmt.Errorf("unsupported signing method %q", t.Method.Alg())
+		}
+
+		kid, _ := t.Header["kid"].(string)
+		return p.key(ctx, md, kid)
+	}); err != nil {
+		return nil, fmt.Errorf("invalid id_token: %w", err)
+	}
+
+	now := time.Now()
+	if exp, ok := oidcTime(claims["exp"]); !ok || now.After(exp.Add(oidcLeeway)) {
+		return nil, fmt.Errorf("invalid id_token: token is expired")
+	}
+	if iat, ok := oidcTime(claims["iat"]); ok && now.Add(oidcLeeway).Before(iat) {
+		return nil, fmt.Errorf("invalid id_token: token is issued in the future")
+	}
+	if nbf, ok := oidcTime(claims["nbf"]); ok && now.Add(oidcLeeway).Before(nbf) {
+		return nil, fmt.Errorf("invalid id_token: token is not yet valid")
+	}
+
+	if iss, _ := claims["iss"].(string); iss != md.Issuer {
+		return nil, fmt.Errorf("invalid id_token: issuer %q does not match %q", iss, md.Issuer)
+	}
+
+	audiences := oidcStrings(claims["aud"])
+	if !oidcContains(audiences, p.config.ClientID) {
+		return nil, fmt.Errorf("invalid id_token: audience does not include client ID")
+	}
+	if azp, ok := claims["azp"].(string); ok && azp != p.config.ClientID {
+		return nil, fmt.Errorf("invalid id_token: authorized party %q is not the client", azp)
+	}
+	if len(audiences) > 1 {
+		if _, ok := claims["azp"]; !ok {
+			return nil, fmt.Errorf("invalid id_token: missing authorized party")
+		}
+	}
+
+	if sub, _ := claims["sub"].(string); sub == "" {
+		return nil, fmt.Errorf("invalid id_token: missing subject")
+	}
+
+	got, _ := claims["nonce"].(string)
+	if subtle.ConstantTimeCompare([]byte(got), []byte(nonce)) != 1 {
+		return nil, fmt.Errorf("invalid id_token: nonce does not match")
+	}
+
+	return claims, nil
+}
+
+// cookieData builds the session identity from verified ID token claims.
+func (p *oidcProvider) cookieData(claims jwt.MapClaims) (*oidcCookieData, error) {
+	email, _ := claims[p.config.EmailClaim].(string)
+	if email == "" {
+		return nil, fmt.Errorf("id_token is missing %q claim", p.config.EmailClaim)
+	}
+
+	// Some providers encode email_verified as a string.
+	emailVerified := p.config.AssumeEmailVerified
+	switch t := claims["email_verified"].(type) {
+	case bool:
+		emailVerified = t
+	case string:
+		emailVerified = t == "true"
+	}
+
+	// Users are bound to local accounts by email address on their first sign
+	// in, so an unverified email address could claim any account.
+	if !emailVerified {
+		return nil, ErrEmailNotVerified
+	}
+
+	mfa := false
+	for _, amr := range oidcStrings(claims["amr"]) {
+		if oidcContains(p.config.MFAAMRValues, amr) {
+			mfa = true
+			break
+		}
+	}
+	if acr, ok := claims["acr"].(string); ok && oidcContains(p.config.MFAACRValues, acr) {
+		mfa = true
+	}
+
+	exp, _ := oidcTime(claims["exp"])
+
+	iss, _ := claims["iss"].(string)
+	sub, _ := claims["sub"].(string)
+	return &oidcCookieData{
+		Provider:      p.config.Name,
+		Issuer:        iss,
+		Subject:       sub,
+		Email:         email,
+		EmailVerified: emailVerified,
+		MFA:           mfa,
+		ExpiresAt:     exp.Unix(),
+	}, nil
+}
+
+// getJSON fetches and decodes the JSON document at the URL.
+func (p *oidcProvider) getJSON(ctx context.Context, u string, i interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	b, err := ioutil.ReadAll(io.LimitReader(resp.Body, oidcMaxResponseSize))
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected response from %s: %d", u, resp.StatusCode)
+	}
+
+	if err := json.Unmarshal(b, i); err != nil {
+		return fmt.Errorf("failed to decode response from %s: %w", u, err)
+	}
+	return nil
+}
+
+// oidcRandom returns a random value suitable for the state, nonce, and PKCE
+// verifier.
+func oidcRandom() (string, error) {
+	b, err := project.RandomBytes(32)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// oidcTime parses a NumericDate claim.
+func oidcTime(v interface{}) (time.Time, bool) {
+	switch t := v.(type) {
+	case float64:
+		return time.Unix(int64(t), 0), true
+	case json.Number:
+		i, err := t.Int64()
+		if err != nil {
+			return time.Time{}, false
+		}
+		return time.Unix(i, 0), true
+	}
+	return time.Time{}, false
+}
+
+// oidcStrings parses a claim which is a string or a list of strings.
+func oidcStrings(v interface{}) []string {
+	switch t := v.(type) {
+	case string:
+		return []string{t}
+	case []interface{}:
+		result := make([]string, 0, len(t))
+		for _, s := range t {
+			if s, ok := s.(string); ok {
+				result = append(result, s)
+			}
+		}
+		return result
+	}
+	return nil
+}
+
+func oidcContains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,563 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/google/exposure-notifications-verification-server/internal/auth/oidctest"
+	"github.com/gorilla/sessions"
+)
+
+func testOIDC(tb testing.TB, issuer *oidctest.Issuer, modify func(c *OIDCConfig)) RedirectProvider {
+	tb.Helper()
+
+	config := &OIDCConfig{
+		Name:         "test",
+		Issuer:       issuer.URL,
+		ClientID:     issuer.ClientID,
+		ClientSecret: issuer.ClientSecret,
+		RedirectURL:  "https://verification.example.com/login/oidc/callback",
+		Scopes:       []string{"email"},
+		MFAACRValues: []string{"urn:example:mfa"},
+	}
+	if modify != nil {
+		modify(config)
+	}
+
+	provider, err := NewOIDC(context.Background(), []*OIDCConfig{config})
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return provider
+}
+
+// testOIDCSignIn starts a sign in, follows the issuer's redirect, and returns
+// the state and code from the callback.
+func testOIDCSignIn(tb testing.TB, provider RedirectProvider, session *sessions.Session) (string, string) {
+	tb.Helper()
+
+	ctx := context.Background()
+	u, err := provider.AuthCodeURL(ctx, session, "test", "user@example.com")
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	authURL, err := url.Parse(u)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	if got, want := authURL.Query().Get("code_challenge_method"), "S256"; got != want {
+		tb.Errorf("expected code_challenge_method %q to be %q", got, want)
+	}
+	if got, want := authURL.Query().Get("login_hint"), "user@example.com"; got != want {
+		tb.Errorf("expected login_hint %q to be %q", got, want)
+	}
+	if got := authURL.Query().Get("scope"); !strings.HasPrefix(got, "openid") {
+		tb.Errorf("expected scope %q to start with openid", got)
+	}
+
+	client := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	resp, err := client.Get(u)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if got, want := resp.StatusCode, http.StatusFound; got != want {
+		tb.Fatalf("expected status %d to be %d", got, want)
+	}
+
+	callback, err := resp.Location()
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return callback.Query().Get("state"), callback.Query().Get("code")
+}
+
+func TestOIDC_SignIn(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	cases := []struct {
+		name   string
+		claims map[string]interface{}
+		modify func(c *OIDCConfig)
+		email  string
+		mfa    bool
+	}{
+		{
+			name: "default",
+			claims: map[string]interface{}{
+				"sub":            "user",
+				"email":          "user@example.com",
+				"email_verified": true,
+				"amr":            []string{"pwd"},
+			},
+			email: "user@example.com",
+		},
+		{
+			name: "amr_mfa",
+			claims: map[string]interface{}{
+				"sub":            "user",
+				"email":          "user@example.com",
+				"email_verified": "true",
+				"amr":            []string{"pwd", "mfa"},
+			},
+			email: "user@example.com",
+			mfa:   true,
+		},
+		{
+			name: "acr_mfa",
+			claims: map[string]interface{}{
+				"sub":            "user",
+				"email":          "user@example.com",
+				"email_verified": true,
+				"acr":            "urn:example:mfa",
+			},
+			email: "user@example.com",
+			mfa:   true,
+		},
+		{
+			name: "custom_amr",
+			claims: map[string]interface{}{
+				"sub":            "user",
+				"email":          "user@example.com",
+				"email_verified": true,
+				"amr":            []string{"pwd", "otp"},
+			},
+			modify: func(c *OIDCConfig) {
+				c.MFAAMRValues = []string{"otp", "hwk"}
+			},
+			email: "user@example.com",
+			mfa:   true,
+		},
+		{
+			name: "assume_email_verified",
+			claims: map[string]interface{}{
+				"sub":                "user",
+				"preferred_username": "upn@example.com",
+			},
+			modify: func(c *OIDCConfig) {
+				c.EmailClaim = "preferred_username"
+				c.AssumeEmailVerified = true
+			},
+			email: "upn@example.com",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			issuer := oidctest.NewIssuer(t)
+			issuer.SetClaims(tc.claims)
+			provider := testOIDC(t, issuer, tc.modify)
+
+			session := &sessions.Session{}
+			state, code := testOIDCSignIn(t, provider, session)
+
+			info, err := provider.Exchange(ctx, session, state, code)
+			if err != nil {
+				t.Fatal(err)
+			}
+			info.TTL = time.Hour
+
+			if err := provider.StoreSession(ctx, session, info); err != nil {
+				t.Fatal(err)
+			}
+			if err := provider.CheckRevoked(ctx, session); err != nil {
+				t.Fatal(err)
+			}
+
+			email, err := provider.EmailAddress(ctx, session)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, want := email, tc.email; got != want {
+				t.Errorf("expected email %q to be %q", got, want)
+			}
+
+			verified, err := provider.EmailVerified(ctx, session)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !verified {
+				t.Errorf("expected email to be verified")
+			}
+
+			mfa, err := provider.MFAEnabled(ctx, session)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, want := mfa, tc.mfa; got != want {
+				t.Errorf("expected mfa %t to be %t", got, want)
+			}
+
+			name, err := provider.SessionIdentityProvider(ctx, session)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, want := name, "test"; got != want {
+				t.Errorf("expected identity provider %q to be %q", got, want)
+			}
+
+			subject, err := provider.SessionSubject(ctx, session)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, want := subject, "user"; got != want {
+				t.Errorf("expected subject %q to be %q", got, want)
+			}
+
+			// The sign in cannot be completed twice.
+			if _, err := provider.Exchange(ctx, session, state, code); err == nil {
+				t.Errorf("expected error completing sign in twice")
+			}
+
+			provider.ClearSession(ctx, session)
+			if err := provider.CheckRevoked(ctx, session); !errors.Is(err, ErrSessionMissing) {
+				t.Errorf("expected %v to be %v", err, ErrSessionMissing)
+			}
+		})
+	}
+}
+
+// TestOIDC_EmailNotVerified ensures a user cannot sign in with an email
+// address the identity provider reports as unverified, since the email address
+// is used to bind the user to a local account.
+func TestOIDC_EmailNotVerified(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	issuer := oidctest.NewIssuer(t)
+	issuer.SetClaims(map[string]interface{}{
+		"sub":            "attacker",
+		"email":          "admin@example.com",
+		"email_verified": false,
+	})
+	provider := testOIDC(t, issuer, func(c *OIDCConfig) {
+		c.AssumeEmailVerified = true
+	})
+
+	session := &sessions.Session{}
+	state, code := testOIDCSignIn(t, provider, session)
+
+	info, err := provider.Exchange(ctx, session, state, code)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := provider.StoreSession(ctx, session, info); !errors.Is(err, ErrEmailNotVerified) {
+		t.Fatalf("expected %v to be %v", err, ErrEmailNotVerified)
+	}
+	if _, err := provider.EmailAddress(ctx, session); !errors.Is(err, ErrSessionMissing) {
+		t.Errorf("expected %v to be %v", err, ErrSessionMissing)
+	}
+}
+
+func TestOIDC_Exchange(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	t.Run("state_mismatch", func(t *testing.T) {
+		t.Parallel()
+
+		issuer := oidctest.NewIssuer(t)
+		provider := testOIDC(t, issuer, nil)
+
+		session := &sessions.Session{}
+		_, code := testOIDCSignIn(t, provider, session)
+
+		if _, err := provider.Exchange(ctx, session, "nope", code); err == nil {
+			t.Errorf("expected error")
+		}
+	})
+
+	t.Run("no_sign_in", func(t *testing.T) {
+		t.Parallel()
+
+		issuer := oidctest.NewIssuer(t)
+		provider := testOIDC(t, issuer, nil)
+
+		if _, err := provider.Exchange(ctx, &sessions.Session{}, "state", "code"); err == nil {
+			t.Errorf("expected error")
+		}
+	})
+
+	t.Run("other_session", func(t *testing.T) {
+		t.Parallel()
+
+		issuer := oidctest.NewIssuer(t)
+		provider := testOIDC(t, issuer, nil)
+
+		// The code was issued for a sign in with a different PKCE verifier.
+		_, code := testOIDCSignIn(t, provider, &sessions.Session{})
+
+		session := &sessions.Session{}
+		otherState, _ := testOIDCSignIn(t, provider, session)
+		if _, err := provider.Exchange(ctx, session, otherState, code); err == nil {
+			t.Errorf("expected error")
+		}
+	})
+
+	t.Run("wrong_client_secret", func(t *testing.T) {
+		t.Parallel()
+
+		issuer := oidctest.NewIssuer(t)
+		provider := testOIDC(t, issuer, func(c *OIDCConfig) {
+			c.ClientSecret = "nope"
+		})
+
+		session := &sessions.Session{}
+		state, code := testOIDCSignIn(t, provider, session)
+		if _, err := provider.Exchange(ctx, session, state, code); err == nil {
+			t.Errorf("expected error")
+		}
+	})
+
+	t.Run("unknown_provider", func(t *testing.T) {
+		t.Parallel()
+
+		issuer := oidctest.NewIssuer(t)
+		provider := testOIDC(t, issuer, nil)
+
+		_, err := provider.AuthCodeURL(ctx, &sessions.Session{}, "nope", "")
+		if !errors.Is(err, ErrUnknownIdentityProvider) {
+			t.Errorf("expected %v to be %v", err, ErrUnknownIdentityProvider)
+		}
+	})
+
+	t.Run("wrong_issuer", func(t *testing.T) {
+		t.Parallel()
+
+		issuer := oidctest.NewIssuer(t)
+		provider := testOIDC(t, issuer, func(c *OIDCConfig) {
+			c.Issuer = c.Issuer + "/other"
+		})
+
+		if _, err := provider.AuthCodeURL(ctx, &sessions.Session{}, "test", ""); err == nil {
+			t.Errorf("expected error")
+		}
+	})
+}
+
+func TestOIDC_StoreSession(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	issuer := oidctest.NewIssuer(t)
+	provider := testOIDC(t, issuer, nil)
+
+	now := time.Now()
+	validClaims := func() jwt.MapClaims {
+		return jwt.MapClaims{
+			"iss":            issuer.URL,
+			"aud":            issuer.ClientID,
+			"sub":            "user",
+			"email":          "user@example.com",
+			"email_verified": true,
+			"iat":            now.Unix(),
+			"exp":            now.Add(time.Hour).Unix(),
+			"nonce":          "nonce",
+		}
+	}
+
+	cases := []struct {
+		name   string
+		modify func(c jwt.MapClaims)
+		err    bool
+	}{
+		{"valid", func(c jwt.MapClaims) {}, false},
+		{"multiple_audiences", func(c jwt.MapClaims) {
+			c["aud"] = []string{issuer.ClientID, "other"}
+			c["azp"] = issuer.ClientID
+		}, false},
+		{"wrong_issuer", func(c jwt.MapClaims) { c["iss"] = "https://example.com" }, true},
+		{"wrong_audience", func(c jwt.MapClaims) { c["aud"] = "other" }, true},
+		{"wrong_azp", func(c jwt.MapClaims) { c["azp"] = "other" }, true},
+		{"missing_azp", func(c jwt.MapClaims) { c["aud"] = []string{issuer.ClientID, "other"} }, true},
+		{"wrong_nonce", func(c jwt.MapClaims) { c["nonce"] = "other" }, true},
+		{"missing_nonce", func(c jwt.MapClaims) { delete(c, "nonce") }, true},
+		{"expired", func(c jwt.MapClaims) { c["exp"] = now.Add(-time.Hour).Unix() }, true},
+		{"future", func(c jwt.MapClaims) { c["iat"] = now.Add(time.Hour).Unix() }, true},
+		{"missing_subject", func(c jwt.MapClaims) { delete(c, "sub") }, true},
+		{"missing_email", func(c jwt.MapClaims) { delete(c, "email") }, true},
+		{"email_not_verified", func(c jwt.MapClaims) { c["email_verified"] = false }, true},
+		{"email_not_verified_string", func(c jwt.MapClaims) { c["email_verified"] = "false" }, true},
+		{"missing_email_verified", func(c jwt.MapClaims) { delete(c, "email_verified") }, true},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			claims := validClaims()
+			tc.modify(claims)
+
+			idToken, err := issuer.SignIDToken(claims)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			session := &sessions.Session{}
+			err = provider.StoreSession(ctx, session, &SessionInfo{
+				Data: map[string]interface{}{
+					"provider": "test",
+					"id_token": idToken,
+					"nonce":    "nonce",
+				},
+				TTL: time.Hour,
+			})
+			if got, want := err != nil, tc.err; got != want {
+				t.Fatalf("expected error %t to be %t: %v", got, want, err)
+			}
+		})
+	}
+
+	t.Run("tampered", func(t *testing.T) {
+		t.Parallel()
+
+		idToken, err := issuer.SignIDToken(validClaims())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Sign the same claims with another issuer's key.
+		other := oidctest.NewIssuer(t)
+		otherToken, err := other.SignIDToken(validClaims())
+		if err != nil {
+			t.Fatal(err)
+		}
+		parts := strings.Split(idToken, ".")
+		otherParts := strings.Split(otherToken, ".")
+		tampered := strings.Join([]string{parts[0], parts[1], otherParts[2]}, ".")
+
+		err = provider.StoreSession(ctx, &sessions.Session{}, &SessionInfo{
+			Data: map[string]interface{}{
+				"provider": "test",
+				"id_token": tampered,
+				"nonce":    "nonce",
+			},
+		})
+		if err == nil {
+			t.Errorf("expected error")
+		}
+	})
+
+	t.Run("expired_session", func(t *testing.T) {
+		t.Parallel()
+
+		// Without a TTL, the session lasts as long as the ID token, which expired
+		// within the allowed clock skew.
+		claims := validClaims()
+		claims["exp"] = now.Add(-30 * time.Second).Unix()
+		idToken, err := issuer.SignIDToken(claims)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		session := &sessions.Session{}
+		if err := provider.StoreSession(ctx, session, &SessionInfo{
+			Data: map[string]interface{}{
+				"provider": "test",
+				"id_token": idToken,
+				"nonce":    "nonce",
+			},
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := provider.CheckRevoked(ctx, session); err == nil {
+			t.Errorf("expected session to be expired")
+		}
+	})
+}
+
+func TestNewOIDC(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	valid := func() *OIDCConfig {
+		return &OIDCConfig{
+			Name:        "test",
+			Issuer:      "https://issuer.example.com",
+			ClientID:    "client",
+			RedirectURL: "https://verification.example.com/login/oidc/callback",
+		}
+	}
+
+	cases := []struct {
+		name    string
+		configs func() []*OIDCConfig
+		err     bool
+	}{
+		{"valid", func() []*OIDCConfig { return []*OIDCConfig{valid()} }, false},
+		{"none", func() []*OIDCConfig { return nil }, true},
+		{"bad_name", func() []*OIDCConfig {
+			c := valid()
+			c.Name = "Not Valid"
+			return []*OIDCConfig{c}
+		}, true},
+		{"reserved_name", func() []*OIDCConfig {
+			c := valid()
+			c.Name = "callback"
+			return []*OIDCConfig{c}
+		}, true},
+		{"missing_issuer", func() []*OIDCConfig {
+			c := valid()
+			c.Issuer = ""
+			return []*OIDCConfig{c}
+		}, true},
+		{"missing_client_id", func() []*OIDCConfig {
+			c := valid()
+			c.ClientID = ""
+			return []*OIDCConfig{c}
+		}, true},
+		{"duplicate", func() []*OIDCConfig { return []*OIDCConfig{valid(), valid()} }, true},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := NewOIDC(ctx, tc.configs())
+			if got, want := err != nil, tc.err; got != want {
+				t.Errorf("expected error %t to be %t: %v", got, want, err)
+			}
+		})
+	}
+}
@@ -23,6 +23,8 @@ import (
 	"github.com/google/exposure-notifications-verification-server/pkg/cache"
 	"github.com/google/exposure-notifications-verification-server/pkg/config"
 	"github.com/google/exposure-notifications-verification-server/pkg/controller"
+	"github.com/google/exposure-notifications-verification-server/pkg/controller/auditapi"
+	"github.com/google/exposure-notifications-verification-server/pkg/controller/certlog"
 	"github.com/google/exposure-notifications-verification-server/pkg/controller/codes"
 	"github.com/google/exposure-notifications-verification-server/pkg/controller/issueapi"
 	"github.com/google/exposure-notifications-verification-server/pkg/controller/middleware"
@@ -90,6 +92,9 @@ func AdminAPI(
 	requireStatsAPIKey := middleware.RequireAPIKey(cacher, db, h, []database.APIKeyType{
 		database.APIKeyTypeStats,
 	})
+	requireAuditAPIKey := middleware.RequireAPIKey(cacher, db, h, []database.APIKeyType{
+		database.APIKeyTypeAudit,
+	})
 	processFirewall := middleware.ProcessFirewall(h, "adminapi")
 
 	// Health route
@@ -108,6 +113,11 @@ func AdminAPI(
 		codesController := codes.NewAPI(ctx, cfg, db, h)
 		sub.Handle("/checkcodestatus", codesController.HandleCheckCodeStatus()).Methods("POST")
 		sub.Handle("/expirecode", codesController.HandleExpireAPI()).Methods("POST")
+
+		certlogController := certlog.New(ctx, db, h)
+		sub.Handle("/certificate-log/proof", certlogController.HandleProof()).Methods("POST")
+		sub.Handle("/certificate-log/sth", certlogController.HandleTreeHead()).Methods("GET")
+		sub.Handle("/certificate-log/entries", certlogController.HandleEntries()).Methods("GET")
 	}
 
 	// Stats routes
@@ -116,13 +126,43 @@ func AdminAPI(
 		sub.Use(requireStatsAPIKey)
 		sub.Use(processFirewall)
 
-		statsController := stats.New(ctx, cacher, db, h)
+		statsController := stats.New(ctx, cacher, db, limiterStore, cfg.RateLimit.HMACKey, h)
 		sub.Handle("/realm.csv", statsController.HandleRealmStats(stats.StatsTypeCSV)).Methods("GET")
 		sub.Handle("/realm.json", statsController.HandleRealmStats(stats.StatsTypeJSON)).Methods("GET")
 		sub.Handle("/realm-user.csv", statsController.HandleRealmUserStats(stats.StatsTypeCSV)).Methods("GET")
 		sub.Handle("/realm-user.json", statsController.HandleRealmUserStats(stats.StatsTypeJSON)).Methods("GET")
 		sub.Handle("/realm-external-issuer.csv", statsController.HandleRealmExternalIssuerStats(stats.StatsTypeCSV)).Methods("GET")
 		sub.Handle("/realm-external-issuer.json", statsController.HandleRealmExternalIssuerStats(stats.StatsTypeJSON)).Methods("GET")
+		sub.Handle("/realm-sites.csv", statsController.HandleRealmSiteStats(stats.StatsTypeCSV)).Methods("GET")
+		sub.Handle("/realm-sites.json", statsController.HandleRealmSiteStats(stats.StatsTypeJSON)).Methods("GET")
+		sub.Handle("/site/{site_id:[0-9]+}.csv", statsController.HandleSiteStats(stats.StatsTypeCSV)).Methods("GET")
+		sub.Handle("/site/{site_id:[0-9]+}.json", statsController.HandleSiteStats(stats.StatsTypeJSON)).Methods("GET")
+		sub.Handle("/realm-rollup.csv", statsController.HandleRealmRollupStats(stats.StatsTypeCSV)).Methods("GET")
+		sub.Handle("/realm-rollup.json", statsController.HandleRealmRollupStats(stats.StatsTypeJSON)).Methods("GET")
+		sub.Handle("/realm/{realm_id:[0-9]+}.csv", statsController.HandleChildRealmStats(stats.StatsTypeCSV)).Methods("GET")
+		sub.Handle("/realm/{realm_id:[0-9]+}.json", statsController.HandleChildRealmStats(stats.StatsTypeJSON)).Methods("GET")
+	}
+
+	// Audit routes
+	{
+		sub := r.PathPrefix("/api/audit").Subrouter()
+		sub.Use(requireAuditAPIKey)
+		sub.Use(processFirewall)
+
+		auditapiController := auditapi.New(ctx, db, h)
+		sub.Handle("/events.csv", auditapiController.HandleExport(database.AuditExportFormatCSV)).Methods("GET")
+		sub.Handle("/events.ndjson", auditapiController.HandleExport(database.AuditExportFormatNDJSON)).Methods("GET")
+	}
+
+	// Metrics routes
+	{
+		sub := r.PathPrefix("/metrics").Subrouter()
+		sub.Use(middleware.APIKeyFromBearer())
+		sub.Use(requireStatsAPIKey)
+		sub.Use(processFirewall)
+
+		statsController := stats.New(ctx, cacher, db, limiterStore, cfg.RateLimit.HMACKey, h)
+		sub.Handle("", statsController.HandleMetrics()).Methods("GET")
 	}
 
 	// Wrap the main router in the mutating middleware method. This cannot be
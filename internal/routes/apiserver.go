@@ -44,7 +44,6 @@ func APIServer(
 	db *database.Database,
 	cacher cache.Cacher,
 	limiterStore limiter.Store,
-	tokenSigner keys.KeyManager,
 	certificateSigner keys.KeyManager,
 ) (http.Handler, func(), error) {
 	closer := func() {}
@@ -93,6 +92,13 @@ func APIServer(
 	})
 	processFirewall := middleware.ProcessFirewall(h, "apiserver")
 
+	// Certificates can be verified by key servers and auditors, which use admin
+	// API keys, as well as by devices.
+	requireVerifierAPIKey := middleware.RequireAPIKey(cacher, db, h, []database.APIKeyType{
+		database.APIKeyTypeDevice,
+		database.APIKeyTypeAdmin,
+	})
+
 	// Health route
 	r.Handle("/health", controller.HandleHealthz(ctx, &cfg.Database, h)).Methods("GET")
 
@@ -123,13 +129,30 @@ func APIServer(
 		sub.Use(rateLimit)
 
 		// POST /api/verify
-		verifyapiController, err := verifyapi.New(ctx, cfg, db, h, tokenSigner)
+		verifyapiController, err := verifyapi.New(ctx, cfg, db, cacher, h)
 		if err != nil {
 			return nil, closer, fmt.Errorf("failed to create verify api controller: %w", err)
 		}
 		sub.Handle("", verifyapiController.HandleVerify()).Methods("POST")
 	}
 
+	certapiController, err := certapi.New(ctx, cfg, db, cacher, certificateSigner, h)
+	if err != nil {
+		return nil, closer, fmt.Errorf("failed to create certapi controller: %w", err)
+	}
+
+	// This must be registered before /api/certificate, which would otherwise
+	// match by prefix.
+	{
+		sub := r.PathPrefix("/api/certificate/verify").Subrouter()
+		sub.Use(requireVerifierAPIKey)
+		sub.Use(processFirewall)
+		sub.Use(rateLimit)
+
+		// POST /api/certificate/verify
+		sub.Handle("", certapiController.HandleVerifyCertificate()).Methods("POST")
+	}
+
 	{
 		sub := r.PathPrefix("/api/certificate").Subrouter()
 		sub.Use(requireAPIKey)
@@ -138,10 +161,6 @@ func APIServer(
 		sub.Use(rateLimit)
 
 		// POST /api/certificate
-		certapiController, err := certapi.New(ctx, cfg, db, cacher, certificateSigner, h)
-		if err != nil {
-			return nil, closer, fmt.Errorf("failed to create certapi controller: %w", err)
-		}
 		sub.Handle("", certapiController.HandleCertificate()).Methods("POST")
 	}
 
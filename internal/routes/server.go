@@ -35,6 +35,7 @@ import (
 	"github.com/google/exposure-notifications-verification-server/pkg/controller/mobileapps"
 	"github.com/google/exposure-notifications-verification-server/pkg/controller/realmadmin"
 	"github.com/google/exposure-notifications-verification-server/pkg/controller/realmkeys"
+	"github.com/google/exposure-notifications-verification-server/pkg/controller/sites"
 	"github.com/google/exposure-notifications-verification-server/pkg/controller/stats"
 	"github.com/google/exposure-notifications-verification-server/pkg/controller/user"
 	"github.com/google/exposure-notifications-verification-server/pkg/database"
@@ -66,6 +67,11 @@ func Server(
 	sessions.Options.MaxAge = int(cfg.SessionDuration.Seconds())
 	sessions.Options.Secure = !cfg.DevMode
 	sessions.Options.SameSite = http.SameSiteStrictMode
+	if cfg.AuthProvider == config.AuthProviderOIDC {
+		// Identity providers redirect back to the server from another site, and
+		// the callback needs the session to complete signing in.
+		sessions.Options.SameSite = http.SameSiteLaxMode
+	}
 	sessions.Options.HttpOnly = true
 
 	// Create the router
@@ -137,6 +143,7 @@ func Server(
 	requireMembership := middleware.RequireMembership(db, h)
 	requireSystemAdmin := middleware.RequireSystemAdmin(h)
 	requireMFA := middleware.RequireMFA(authProvider, h)
+	requireIdentityProvider := middleware.RequireIdentityProvider(authProvider, h)
 	processFirewall := middleware.ProcessFirewall(h, "server")
 	rateLimit := httplimiter.Handle
 
@@ -173,6 +180,8 @@ func Server(
 			sub.Handle("/login/manage-account", loginController.HandleReceiveVerifyEmail()).
 				Queries("oobCode", "{oobCode:.+}", "mode", "{mode:(?:verifyEmail|recoverEmail)}").Methods("GET")
 			sub.Handle("/session", loginController.HandleCreateSession()).Methods("POST")
+			sub.Handle("/login/oidc/callback", loginController.HandleOIDCCallback()).Methods("GET")
+			sub.Handle("/login/oidc/{provider:[a-z0-9][a-z0-9-]*}", loginController.HandleOIDCLogin()).Methods("GET")
 			sub.Handle("/signout", loginController.HandleSignOut()).Methods("GET")
 
 			// Realm selection & account settings
@@ -201,6 +210,7 @@ func Server(
 		sub.Use(loadCurrentMembership)
 		sub.Use(requireMembership)
 		sub.Use(processFirewall)
+		sub.Use(requireIdentityProvider)
 		sub.Use(requireVerified)
 		sub.Use(requireMFA)
 		sub.Use(rateLimit)
@@ -224,6 +234,7 @@ func Server(
 		sub.Use(loadCurrentMembership)
 		sub.Use(requireMembership)
 		sub.Use(processFirewall)
+		sub.Use(requireIdentityProvider)
 		sub.Use(requireVerified)
 		sub.Use(requireMFA)
 		sub.Use(rateLimit)
@@ -232,6 +243,22 @@ func Server(
 		mobileappsRoutes(sub, mobileappsController)
 	}
 
+	// sites
+	{
+		sub := r.PathPrefix("/realm/sites").Subrouter()
+		sub.Use(requireAuth)
+		sub.Use(loadCurrentMembership)
+		sub.Use(requireMembership)
+		sub.Use(processFirewall)
+		sub.Use(requireIdentityProvider)
+		sub.Use(requireVerified)
+		sub.Use(requireMFA)
+		sub.Use(rateLimit)
+
+		sitesController := sites.New(db, h)
+		sitesRoutes(sub, sitesController)
+	}
+
 	// apikeys
 	{
 		sub := r.PathPrefix("/realm/apikeys").Subrouter()
@@ -239,6 +266,7 @@ func Server(
 		sub.Use(loadCurrentMembership)
 		sub.Use(requireMembership)
 		sub.Use(processFirewall)
+		sub.Use(requireIdentityProvider)
 		sub.Use(requireVerified)
 		sub.Use(requireMFA)
 		sub.Use(rateLimit)
@@ -254,6 +282,7 @@ func Server(
 		sub.Use(loadCurrentMembership)
 		sub.Use(requireMembership)
 		sub.Use(processFirewall)
+		sub.Use(requireIdentityProvider)
 		sub.Use(requireVerified)
 		sub.Use(requireMFA)
 		sub.Use(rateLimit)
@@ -269,14 +298,24 @@ func Server(
 		sub.Use(loadCurrentMembership)
 		sub.Use(requireMembership)
 		sub.Use(processFirewall)
+		sub.Use(requireIdentityProvider)
 		sub.Use(requireVerified)
 		sub.Use(requireMFA)
 		sub.Use(rateLimit)
 
-		statsController := stats.New(ctx, cacher, db, h)
+		statsController := stats.New(ctx, cacher, db, limiterStore, cfg.RateLimit.HMACKey, h)
 		statsRoutes(sub, statsController)
 	}
 
+	// public stats
+	{
+		sub := r.PathPrefix("/public/stats").Subrouter()
+		sub.Use(rateLimit)
+
+		statsController := stats.NewPublic(ctx, cacher, db, cfg.PublicStatsHMACKey, h)
+		publicStatsRoutes(sub, statsController)
+	}
+
 	// realms
 	{
 		sub := r.PathPrefix("/realm").Subrouter()
@@ -284,6 +323,7 @@ func Server(
 		sub.Use(loadCurrentMembership)
 		sub.Use(requireMembership)
 		sub.Use(processFirewall)
+		sub.Use(requireIdentityProvider)
 		sub.Use(requireVerified)
 		sub.Use(requireMFA)
 		sub.Use(rateLimit)
@@ -351,6 +391,18 @@ func mobileappsRoutes(r *mux.Router, c *mobileapps.Controller) {
 	r.Handle("/{id:[0-9]+}/enable", c.HandleEnable()).Methods("PATCH")
 }
 
+// sitesRoutes are the site routes.
+func sitesRoutes(r *mux.Router, c *sites.Controller) {
+	r.Handle("", c.HandleIndex()).Methods("GET")
+	r.Handle("", c.HandleCreate()).Methods("POST")
+	r.Handle("/new", c.HandleCreate()).Methods("GET")
+	r.Handle("/{id:[0-9]+}/edit", c.HandleUpdate()).Methods("GET")
+	r.Handle("/{id:[0-9]+}", c.HandleShow()).Methods("GET")
+	r.Handle("/{id:[0-9]+}", c.HandleUpdate()).Methods("PATCH")
+	r.Handle("/{id:[0-9]+}/disable", c.HandleDisable()).Methods("PATCH")
+	r.Handle("/{id:[0-9]+}/enable", c.HandleEnable()).Methods("PATCH")
+}
+
 // apikeyRoutes are the API key routes.
 func apikeyRoutes(r *mux.Router, c *apikey.Controller) {
 	r.Handle("", c.HandleIndex()).Methods("GET")
@@ -400,6 +452,20 @@ func statsRoutes(r *mux.Router, c *stats.Controller) {
 	r.Handle("/realm-user.json", c.HandleRealmUserStats(stats.StatsTypeJSON)).Methods("GET")
 	r.Handle("/realm-external-issuer.csv", c.HandleRealmExternalIssuerStats(stats.StatsTypeCSV)).Methods("GET")
 	r.Handle("/realm-external-issuer.json", c.HandleRealmExternalIssuerStats(stats.StatsTypeJSON)).Methods("GET")
+	r.Handle("/realm-sites.csv", c.HandleRealmSiteStats(stats.StatsTypeCSV)).Methods("GET")
+	r.Handle("/realm-sites.json", c.HandleRealmSiteStats(stats.StatsTypeJSON)).Methods("GET")
+	r.Handle("/site/{site_id:[0-9]+}.csv", c.HandleSiteStats(stats.StatsTypeCSV)).Methods("GET")
+	r.Handle("/site/{site_id:[0-9]+}.json", c.HandleSiteStats(stats.StatsTypeJSON)).Methods("GET")
+	r.Handle("/realm-rollup.csv", c.HandleRealmRollupStats(stats.StatsTypeCSV)).Methods("GET")
+	r.Handle("/realm-rollup.json", c.HandleRealmRollupStats(stats.StatsTypeJSON)).Methods("GET")
+	r.Handle("/realm/{realm_id:[0-9]+}.csv", c.HandleChildRealmStats(stats.StatsTypeCSV)).Methods("GET")
+	r.Handle("/realm/{realm_id:[0-9]+}.json", c.HandleChildRealmStats(stats.StatsTypeJSON)).Methods("GET")
+}
+
+// publicStatsRoutes are the unauthenticated public stats routes.
+func publicStatsRoutes(r *mux.Router, c *stats.Controller) {
+	r.Handle("/realm/{realm_id:[0-9]+}.csv", c.HandlePublicRealmStats(stats.StatsTypeCSV)).Methods("GET")
+	r.Handle("/realm/{realm_id:[0-9]+}.json", c.HandlePublicRealmStats(stats.StatsTypeJSON)).Methods("GET")
 }
 
 // realmadminRoutes are the realm admin routes.
@@ -407,12 +473,22 @@ func realmadminRoutes(r *mux.Router, c *realmadmin.Controller) {
 	r.Handle("/settings", c.HandleSettings()).Methods("GET", "POST")
 	r.Handle("/settings/enable-express", c.HandleEnableExpress()).Methods("POST")
 	r.Handle("/settings/disable-express", c.HandleDisableExpress()).Methods("POST")
+	r.Handle("/settings/history", c.HandleSettingsHistory()).Methods("GET")
+	r.Handle("/settings/history/{id:[0-9]+}/revert", c.HandleSettingsRevert()).Methods("POST")
 	r.Handle("/stats", c.HandleStats()).Methods("GET")
 	r.Handle("/events", c.HandleEvents()).Methods("GET")
+	r.Handle("/events.csv", c.HandleEventsExport(database.AuditExportFormatCSV)).Methods("GET")
+	r.Handle("/events.ndjson", c.HandleEventsExport(database.AuditExportFormatNDJSON)).Methods("GET")
+	r.Handle("/access", c.HandleAccessEvents()).Methods("GET")
+	r.Handle("/retention", c.HandleRetention()).Methods("GET")
+	r.Handle("/children", c.HandleChildren()).Methods("GET")
+	r.Handle("/children/{id:[0-9]+}/events", c.HandleChildEvents()).Methods("GET")
+	r.Handle("/children/{id:[0-9]+}/users", c.HandleChildUsers()).Methods("GET")
 }
 
 // jwksRoutes are the JWK routes, rooted at /jwks.
 func jwksRoutes(r *mux.Router, c *jwks.Controller) {
+	r.Handle("/tokens", c.HandleTokenIndex()).Methods("GET")
 	r.Handle("/{realm_id:[0-9]+}", c.HandleIndex()).Methods("GET")
 }
 
@@ -429,6 +505,12 @@ func systemAdminRoutes(r *mux.Router, c *admin.Controller) {
 	r.Handle("/realms/{realm_id:[0-9]+}/add/{user_id:[0-9]+}", c.HandleRealmsAdd()).Methods("PATCH")
 	r.Handle("/realms/{realm_id:[0-9]+}/remove/{user_id:[0-9]+}", c.HandleRealmsRemove()).Methods("PATCH")
 	r.Handle("/realms/{id:[0-9]+}", c.HandleRealmsUpdate()).Methods("PATCH")
+	r.Handle("/realms/{id:[0-9]+}", c.HandleRealmsPurge()).Methods("DELETE")
+	r.Handle("/realms/{id:[0-9]+}/state", c.HandleRealmsState()).Methods("PATCH")
+	r.Handle("/realms/{id:[0-9]+}/template", c.HandleRealmTemplatesCreate()).Methods("POST")
+
+	r.Handle("/realm-templates", c.HandleRealmTemplatesIndex()).Methods("GET")
+	r.Handle("/realm-templates/{id:[0-9]+}", c.HandleRealmTemplatesDelete()).Methods("DELETE")
 
 	r.Handle("/users", c.HandleUsersIndex()).Methods("GET")
 	r.Handle("/users/{id:[0-9]+}", c.HandleUserShow()).Methods("GET")
@@ -441,6 +523,8 @@ func systemAdminRoutes(r *mux.Router, c *admin.Controller) {
 	r.Handle("/sms", c.HandleSMSUpdate()).Methods("GET", "POST")
 	r.Handle("/email", c.HandleEmailUpdate()).Methods("GET", "POST")
 	r.Handle("/events", c.HandleEventsShow()).Methods("GET")
+	r.Handle("/events.csv", c.HandleEventsExport(database.AuditExportFormatCSV)).Methods("GET")
+	r.Handle("/events.ndjson", c.HandleEventsExport(database.AuditExportFormatNDJSON)).Methods("GET")
 
 	r.Handle("/caches", c.HandleCachesIndex()).Methods("GET")
 	r.Handle("/caches/clear/{id}", c.HandleCachesClear()).Methods("POST")
@@ -91,6 +91,41 @@ func TestRoutes_mobileappsRoutes(t *testing.T) {
 	}
 }
 
+func TestRoutes_sitesRoutes(t *testing.T) {
+	t.Parallel()
+
+	m := mux.NewRouter()
+	sitesRoutes(m, nil)
+
+	cases := []struct {
+		req  *http.Request
+		vars map[string]string
+	}{
+		{
+			req: httptest.NewRequest("GET", "/new", nil),
+		},
+		{
+			req: httptest.NewRequest("GET", "/12345/edit", nil),
+		},
+		{
+			req: httptest.NewRequest("GET", "/12345", nil),
+		},
+		{
+			req: httptest.NewRequest("PATCH", "/12345", nil),
+		},
+		{
+			req: httptest.NewRequest("PATCH", "/12345/disable", nil),
+		},
+		{
+			req: httptest.NewRequest("PATCH", "/12345/enable", nil),
+		},
+	}
+
+	for _, tc := range cases {
+		testRoute(t, m, tc.req, tc.vars)
+	}
+}
+
 func TestRoutes_apikeyRoutes(t *testing.T) {
 	t.Parallel()
 
@@ -243,6 +278,59 @@ func TestRoutes_statsRoutes(t *testing.T) {
 		{
 			req: httptest.NewRequest("GET", "/realm-external-issuer.json", nil),
 		},
+		{
+			req: httptest.NewRequest("GET", "/realm-sites.csv", nil),
+		},
+		{
+			req: httptest.NewRequest("GET", "/realm-sites.json", nil),
+		},
+		{
+			req:  httptest.NewRequest("GET", "/site/12345.csv", nil),
+			vars: map[string]string{"site_id": "12345"},
+		},
+		{
+			req:  httptest.NewRequest("GET", "/site/12345.json", nil),
+			vars: map[string]string{"site_id": "12345"},
+		},
+		{
+			req: httptest.NewRequest("GET", "/realm-rollup.csv", nil),
+		},
+		{
+			req: httptest.NewRequest("GET", "/realm-rollup.json", nil),
+		},
+		{
+			req:  httptest.NewRequest("GET", "/realm/12345.csv", nil),
+			vars: map[string]string{"realm_id": "12345"},
+		},
+		{
+			req:  httptest.NewRequest("GET", "/realm/12345.json", nil),
+			vars: map[string]string{"realm_id": "12345"},
+		},
+	}
+
+	for _, tc := range cases {
+		testRoute(t, m, tc.req, tc.vars)
+	}
+}
+
+func TestRoutes_publicStatsRoutes(t *testing.T) {
+	t.Parallel()
+
+	m := mux.NewRouter()
+	publicStatsRoutes(m, nil)
+
+	cases := []struct {
+		req  *http.Request
+		vars map[string]string
+	}{
+		{
+			req:  httptest.NewRequest("GET", "/realm/12345.csv", nil),
+			vars: map[string]string{"realm_id": "12345"},
+		},
+		{
+			req:  httptest.NewRequest("GET", "/realm/12345.json", nil),
+			vars: map[string]string{"realm_id": "12345"},
+		},
 	}
 
 	for _, tc := range cases {
@@ -278,6 +366,23 @@ func TestRoutes_realmadminRoutes(t *testing.T) {
 		{
 			req: httptest.NewRequest("GET", "/events", nil),
 		},
+		{
+			req: httptest.NewRequest("GET", "/events.csv", nil),
+		},
+		{
+			req: httptest.NewRequest("GET", "/events.ndjson", nil),
+		},
+		{
+			req: httptest.NewRequest("GET", "/children", nil),
+		},
+		{
+			req:  httptest.NewRequest("GET", "/children/12345/events", nil),
+			vars: map[string]string{"id": "12345"},
+		},
+		{
+			req:  httptest.NewRequest("GET", "/children/12345/users", nil),
+			vars: map[string]string{"id": "12345"},
+		},
 	}
 
 	for _, tc := range cases {
@@ -295,6 +400,9 @@ func TestRoutes_jwksRoutes(t *testing.T) {
 		req  *http.Request
 		vars map[string]string
 	}{
+		{
+			req: httptest.NewRequest("GET", "/tokens", nil),
+		},
 		{
 			req:  httptest.NewRequest("GET", "/12345", nil),
 			vars: map[string]string{"realm_id": "12345"},
@@ -377,6 +485,12 @@ func TestRoutes_systemAdminRoutes(t *testing.T) {
 		{
 			req: httptest.NewRequest("GET", "/events", nil),
 		},
+		{
+			req: httptest.NewRequest("GET", "/events.csv", nil),
+		},
+		{
+			req: httptest.NewRequest("GET", "/events.ndjson", nil),
+		},
 		{
 			req: httptest.NewRequest("GET", "/caches", nil),
 		},
@@ -69,6 +69,9 @@ const (
 	ErrMaintenanceMode = "maintenance_mode"
 	// ErrQuotaExceeded indicates the realm has exceeded its daily allotment of codes.
 	ErrQuotaExceeded = "quota_exceeded"
+	// ErrInvalidSite indicates the site in the request does not exist in the
+	// realm or is disabled.
+	ErrInvalidSite = "invalid_site"
 
 	// Certificate API responses
 
@@ -78,6 +81,27 @@ const (
 	ErrTokenExpired = "token_expired"
 	// ErrHMACInvalid indicates that the HMAC that is being signed is invalid (wrong length)
 	ErrHMACInvalid = "hmac_invalid"
+
+	// Certificate verification API responses
+
+	// ErrCertificateInvalid indicates the certificate could not be parsed, was
+	// not signed by a known key, or has an invalid signature or claims.
+	ErrCertificateInvalid = "certificate_invalid"
+	// ErrCertificateExpired indicates the certificate has a valid signature, but
+	// is expired.
+	ErrCertificateExpired = "certificate_expired"
+	// ErrCertificateHMACMismatch indicates the certificate is valid, but was not
+	// issued for the expected HMAC.
+	ErrCertificateHMACMismatch = "certificate_hmac_mismatch"
+
+	// Certificate transparency log API responses
+
+	// ErrCertificateLogEntryNotFound indicates no certificate with the given HMAC
+	// was logged for the realm.
+	ErrCertificateLogEntryNotFound = "certificate_log_entry_not_found"
+	// ErrCertificateLogEntryPending indicates the certificate was logged, but is
+	// not yet included in a signed tree head. Clients should retry later.
+	ErrCertificateLogEntryPending = "certificate_log_entry_pending"
 )
 
 // ErrorReturn defines the common error type.
@@ -209,6 +233,10 @@ type IssueCodeRequest struct {
 	// system does not sanitize or encrypt these external IDs, it is the caller's
 	// responsibility to do so.
 	ExternalIssuerID string `json:"externalIssuerID"`
+
+	// SiteID is the optional ID of the site at which the code is issued. If
+	// omitted, the issuing API key's or user's default site is used, if any.
+	SiteID uint `json:"siteID"`
 }
 
 // IssueCodeResponse defines the response type for IssueCodeRequest.
@@ -367,3 +395,93 @@ type VerificationCertificateResponse struct {
 	Error       string `json:"error,omitempty"`
 	ErrorCode   string `json:"errorCode,omitempty"`
 }
+
+// VerifyCertificateRequest is used to check a verification certificate issued
+// by this server, for example by a key server or auditor. If ExposureKeyHMAC
+// is provided, the certificate must have been issued for that HMAC.
+//
+// Requires API key in a HTTP header, X-API-Key: APIKEY
+type VerifyCertificateRequest struct {
+	Padding Padding `json:"padding"`
+
+	Certificate     string `json:"certificate"`
+	ExposureKeyHMAC string `json:"ekeyhmac,omitempty"`
+}
+
+// VerifyCertificateResponse is the result of verifying a certificate. If the
+// certificate is invalid, Valid is false and Error and ErrorCode explain why.
+// The certificate details are returned whenever the signature is valid, even if
+// the certificate is expired or does not match the expected HMAC.
+//
+// RealmID and RealmName are omitted for certificates signed with the system
+// signing key, since those are shared by many realms.
+type VerifyCertificateResponse struct {
+	Padding Padding `json:"padding"`
+
+	Valid                bool   `json:"valid"`
+	RealmID              uint   `json:"realmID,omitempty"`
+	RealmName            string `json:"realmName,omitempty"`
+	KeyID                string `json:"kid,omitempty"`
+	Algorithm            string `json:"alg,omitempty"`
+	ReportType           string `json:"reportType,omitempty"`
+	SymptomOnsetInterval uint32 `json:"symptomOnsetInterval,omitempty"`
+	IssuedAt             int64  `json:"iat,omitempty"`
+	ExpiresAt            int64  `json:"exp,omitempty"`
+	Error                string `json:"error,omitempty"`
+	ErrorCode            string `json:"errorCode,omitempty"`
+}
+
+// CertificateLogTreeHead is a signed commitment to the contents of the
+// certificate transparency log. Signature is a compact JWS, signed by
+// PublicKey, whose claims are the tree size, root hash, and timestamp.
+type CertificateLogTreeHead struct {
+	TreeSize  int64  `json:"treeSize"`
+	RootHash  string `json:"rootHash"`
+	Timestamp int64  `json:"timestamp"`
+	KeyID     string `json:"kid"`
+	Algorithm string `json:"alg"`
+	PublicKey string `json:"publicKey"`
+	Signature string `json:"signature"`
+}
+
+// CertificateLogEntry is a sequenced entry in the certificate transparency
+// log. LeafHash is the base64 encoded RFC 6962 leaf hash stored in the tree,
+// and LeafData is the JSON document it is the hash of. LeafData is omitted for
+// entries which belong to another realm.
+type CertificateLogEntry struct {
+	LeafIndex int64  `json:"leafIndex"`
+	LeafHash  string `json:"leafHash"`
+	LeafData  string `json:"leafData,omitempty"`
+}
+
+// CertificateLogProofRequest requests an inclusion proof for the most recent
+// certificate issued by the realm for the given HMAC.
+// API is served at /api/certificate-log/proof
+type CertificateLogProofRequest struct {
+	Padding Padding `json:"padding"`
+
+	ExposureKeyHMAC string `json:"ekeyhmac"`
+}
+
+// CertificateLogProofResponse is the inclusion proof of a certificate in the
+// tree described by TreeHead. AuditPath is the list of base64 encoded node
+// hashes from the leaf to the root.
+type CertificateLogProofResponse struct {
+	Padding Padding `json:"padding"`
+
+	Entry     *CertificateLogEntry    `json:"entry,omitempty"`
+	AuditPath []string                `json:"auditPath,omitempty"`
+	TreeHead  *CertificateLogTreeHead `json:"treeHead,omitempty"`
+	Error     string                  `json:"error,omitempty"`
+	ErrorCode string                  `json:"errorCode,omitempty"`
+}
+
+// CertificateLogEntriesResponse is a page of the certificate transparency log
+// for export to auditors, along with the latest signed tree head.
+// API is served at /api/certificate-log/entries
+type CertificateLogEntriesResponse struct {
+	Entries   []*CertificateLogEntry  `json:"entries"`
+	TreeHead  *CertificateLogTreeHead `json:"treeHead,omitempty"`
+	Error     string                  `json:"error,omitempty"`
+	ErrorCode string                  `json:"errorCode,omitempty"`
+}
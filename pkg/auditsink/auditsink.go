@@ -0,0 +1,131 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package auditsink delivers audit entries to external systems, such as a
+// security information and event management (SIEM) system.
+//
+// Entries are read from the database after they are committed, so entries in
+// transactions which roll back are never delivered. Delivery progress is
+// recorded per sink, so each entry is delivered at least once, even across
+// restarts and failures. Receivers should deduplicate on the realm_id and
+// chain_sequence of each entry.
+package auditsink
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+)
+
+// Config represents the configuration for audit sinks. Each sink is enabled by
+// setting its destination.
+type Config struct {
+	// SyslogAddress is the host:port of a syslog receiver. Entries are sent as
+	// RFC 5424 messages over SyslogNetwork, which is "udp", "tcp", or "tls".
+	SyslogAddress string `env:"AUDIT_SINK_SYSLOG_ADDRESS"`
+	SyslogNetwork string `env:"AUDIT_SINK_SYSLOG_NETWORK, default=tls"`
+	SyslogAppName string `env:"AUDIT_SINK_SYSLOG_APP_NAME, default=verification-server"`
+
+	// WebhookURL receives batches of entries as newline-delimited JSON. If
+	// WebhookSecret is set, each request is signed with it.
+	WebhookURL    string `env:"AUDIT_SINK_WEBHOOK_URL"`
+	WebhookSecret string `env:"AUDIT_SINK_WEBHOOK_SECRET" json:"-"`
+
+	// FilePath is a file to which entries are appended as newline-delimited
+	// JSON.
+	FilePath string `env:"AUDIT_SINK_FILE_PATH"`
+
+	// BatchSize is the maximum number of entries sent to a sink at a time.
+	BatchSize uint `env:"AUDIT_SINK_BATCH_SIZE, default=100"`
+
+	// FlushDelay is the time to wait after an entry is created before entries
+	// are delivered, which batches entries created together. PollInterval is
+	// the time between deliveries when no entries are created by this process,
+	// which delivers entries created by other processes and retries failures.
+	FlushDelay   time.Duration `env:"AUDIT_SINK_FLUSH_DELAY, default=1s"`
+	PollInterval time.Duration `env:"AUDIT_SINK_POLL_INTERVAL, default=1m"`
+
+	// SendTimeout is the maximum time to send a single batch.
+	SendTimeout time.Duration `env:"AUDIT_SINK_SEND_TIMEOUT, default=30s"`
+}
+
+// Enabled returns true if any sink is configured.
+func (c *Config) Enabled() bool {
+	return c.SyslogAddress != "" || c.WebhookURL != "" || c.FilePath != ""
+}
+
+// Sink is an external destination for audit entries.
+type Sink interface {
+	// Name is the unique name of the sink, under which its delivery progress is
+	// recorded.
+	Name() string
+
+	// Send delivers the entries. If it returns an error, the entries are sent
+	// again later, so it must be safe to send an entry more than once.
+	Send(ctx context.Context, entries []*database.AuditEntry) error
+
+	// Close releases any resources held by the sink.
+	Close() error
+}
+
+// Validate returns an error if the delivery settings are invalid.
+func (c *Config) Validate() error {
+	if c.BatchSize == 0 {
+		return fmt.Errorf("AUDIT_SINK_BATCH_SIZE must be positive")
+	}
+	if c.PollInterval <= 0 {
+		return fmt.Errorf("AUDIT_SINK_POLL_INTERVAL must be positive")
+	}
+	if c.SendTimeout <= 0 {
+		return fmt.Errorf("AUDIT_SINK_SEND_TIMEOUT must be positive")
+	}
+	return nil
+}
+
+// SinksFor returns the sinks which are enabled in the config.
+func SinksFor(ctx context.Context, c *Config) ([]Sink, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+
+	var sinks []Sink
+
+	if c.SyslogAddress != "" {
+		s, err := NewSyslog(c.SyslogNetwork, c.SyslogAddress, c.SyslogAppName)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create syslog sink: %w", err)
+		}
+		sinks = append(sinks, s)
+	}
+
+	if c.WebhookURL != "" {
+		s, err := NewWebhook(c.WebhookURL, c.WebhookSecret)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create webhook sink: %w", err)
+		}
+		sinks = append(sinks, s)
+	}
+
+	if c.FilePath != "" {
+		s, err := NewFile(c.FilePath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create file sink: %w", err)
+		}
+		sinks = append(sinks, s)
+	}
+
+	return sinks, nil
+}
@@ -0,0 +1,48 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auditsink
+
+import (
+	"time"
+
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+)
+
+func testEntries() []*database.AuditEntry {
+	return []*database.AuditEntry{
+		{
+			ID:            1,
+			RealmID:       1,
+			ActorID:       "users:1",
+			ActorDisplay:  "Alex (alex@example.com)",
+			Action:        "updated realm",
+			TargetID:      "realms:1",
+			TargetDisplay: "Example",
+			ChainSequence: 1,
+			CreatedAt:     time.Date(2020, 11, 2, 8, 30, 0, 123000, time.UTC),
+		},
+		{
+			ID:            2,
+			RealmID:       1,
+			ActorID:       "users:1",
+			ActorDisplay:  "Alex (alex@example.com)",
+			Action:        "created API key",
+			TargetID:      "authorized_apps:1",
+			TargetDisplay: "Key",
+			ChainSequence: 2,
+			CreatedAt:     time.Date(2020, 11, 2, 8, 31, 0, 0, time.UTC),
+		},
+	}
+}
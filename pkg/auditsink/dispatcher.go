@@ -0,0 +1,118 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auditsink
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/exposure-notifications-server/pkg/logging"
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+	"github.com/hashicorp/go-multierror"
+)
+
+// Dispatcher delivers audit entries from the database to sinks.
+type Dispatcher struct {
+	config *Config
+	db     *database.Database
+	sinks  []Sink
+
+	notifyCh chan struct{}
+}
+
+// NewDispatcher creates a dispatcher for the sinks. Call Notify when entries
+// are created to deliver them promptly.
+func NewDispatcher(config *Config, db *database.Database, sinks []Sink) *Dispatcher {
+	return &Dispatcher{
+		config:   config,
+		db:       db,
+		sinks:    sinks,
+		notifyCh: make(chan struct{}, 1),
+	}
+}
+
+// Notify signals that an audit entry was created. It never blocks.
+func (d *Dispatcher) Notify() {
+	select {
+	case d.notifyCh <- struct{}{}:
+	default:
+	}
+}
+
+// Run delivers entries after each notification and every poll interval until
+// the context is done. Failed deliveries are logged and retried on the next
+// run.
+func (d *Dispatcher) Run(ctx context.Context) {
+	logger := logging.FromContext(ctx).Named("auditsink.Dispatcher")
+
+	ticker := time.NewTicker(d.config.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-d.notifyCh:
+			// Wait for the entry's transaction to commit, and for other entries to
+			// be created, so they are delivered together.
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(d.config.FlushDelay):
+			}
+		}
+
+		if err := d.Flush(ctx); err != nil {
+			logger.Errorw("failed to deliver audit entries", "error", err)
+		}
+	}
+}
+
+// Flush delivers all undelivered entries to every sink. A failure to deliver
+// to one sink does not prevent delivery to the others.
+func (d *Dispatcher) Flush(ctx context.Context) error {
+	logger := logging.FromContext(ctx).Named("auditsink.Flush")
+
+	var merr *multierror.Error
+	for _, sink := range d.sinks {
+		sink := sink
+
+		n, err := d.db.DeliverAuditEntries(sink.Name(), int(d.config.BatchSize), func(entries []*database.AuditEntry) error {
+			ctx, cancel := context.WithTimeout(ctx, d.config.SendTimeout)
+			defer cancel()
+			return sink.Send(ctx, entries)
+		})
+		if n > 0 {
+			logger.Debugw("delivered audit entries", "sink", sink.Name(), "count", n)
+		}
+		if err != nil {
+			merr = multierror.Append(merr, err)
+		}
+	}
+	return merr.ErrorOrNil()
+}
+
+// Close closes all sinks.
+func (d *Dispatcher) Close() error {
+	var merr *multierror.Error
+	for _, sink := range d.sinks {
+		if err := sink.Close(); err != nil {
+			merr = multierror.Append(merr, fmt.Errorf("failed to close %s: %w", sink.Name(), err))
+		}
+	}
+	return merr.ErrorOrNil()
+}
@@ -0,0 +1,78 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auditsink
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+)
+
+var _ Sink = (*File)(nil)
+
+// File appends audit entries to a file as newline-delimited JSON. Each batch
+// is synced to disk before it is acknowledged.
+type File struct {
+	lock sync.Mutex
+	f    *os.File
+}
+
+// NewFile creates a new file sink, creating the file if it does not exist.
+func NewFile(path string) (*File, error) {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	return &File{f: f}, nil
+}
+
+// Name is the name of the sink.
+func (s *File) Name() string {
+	return "file"
+}
+
+// Send appends the entries to the file.
+func (s *File) Send(ctx context.Context, entries []*database.AuditEntry) error {
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	for _, e := range entries {
+		if err := enc.Encode(e.Record()); err != nil {
+			return fmt.Errorf("failed to encode entry %d: %w", e.ID, err)
+		}
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if _, err := s.f.Write(b.Bytes()); err != nil {
+		return fmt.Errorf("failed to write entries: %w", err)
+	}
+	if err := s.f.Sync(); err != nil {
+		return fmt.Errorf("failed to sync entries: %w", err)
+	}
+	return nil
+}
+
+// Close closes the file.
+func (s *File) Close() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.f.Close()
+}
@@ -0,0 +1,211 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auditsink
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+)
+
+const (
+	// syslogPriority is the RFC 5424 PRI of audit messages: the "log audit"
+	// facility (13) and the notice severity (5).
+	syslogPriority = 13*8 + 5
+
+	// syslogMsgID identifies audit messages.
+	syslogMsgID = "audit"
+
+	// syslogBOM marks the message as UTF-8.
+	syslogBOM = "\xef\xbb\xbf"
+
+	// syslogMaxAppName is the maximum length of the APP-NAME field.
+	syslogMaxAppName = 48
+)
+
+var _ Sink = (*Syslog)(nil)
+
+// Syslog sends audit entries as RFC 5424 messages. The message of each is the
+// entry's JSON representation. Messages over TCP and TLS are framed with octet
+// counting as described in RFC 6587.
+type Syslog struct {
+	network  string
+	address  string
+	hostname string
+	appName  string
+
+	dial func(ctx context.Context) (net.Conn, error)
+
+	lock sync.Mutex
+	conn net.Conn
+}
+
+// NewSyslog creates a new syslog sink. The network is "udp", "tcp", or "tls".
+// The connection is opened on the first send.
+func NewSyslog(network, address, appName string) (*Syslog, error) {
+	if appName == "" || len(appName) > syslogMaxAppName || !isPrintASCII(appName) {
+		return nil, fmt.Errorf("app name must be 1-%d printable ASCII characters", syslogMaxAppName)
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" || !isPrintASCII(hostname) {
+		hostname = "-"
+	}
+
+	var dialer net.Dialer
+	s := &Syslog{
+		network:  network,
+		address:  address,
+		hostname: hostname,
+		appName:  appName,
+	}
+
+	switch network {
+	case "udp", "tcp":
+		s.dial = func(ctx context.Context) (net.Conn, error) {
+			return dialer.DialContext(ctx, network, address)
+		}
+	case "tls":
+		host, _, err := net.SplitHostPort(address)
+		if err != nil {
+			return nil, fmt.Errorf("invalid address %q: %w", address, err)
+		}
+		s.dial = func(ctx context.Context) (net.Conn, error) {
+			conn, err := dialer.DialContext(ctx, "tcp", address)
+			if err != nil {
+				return nil, err
+			}
+			tlsConn := tls.Client(conn, &tls.Config{
+				ServerName: host,
+				MinVersion: tls.VersionTLS12,
+			})
+			if deadline, ok := ctx.Deadline(); ok {
+				_ = tlsConn.SetDeadline(deadline)
+			}
+			if err := tlsConn.Handshake(); err != nil {
+				conn.Close()
+				return nil, err
+			}
+			return tlsConn, nil
+		}
+	default:
+		return nil, fmt.Errorf("unknown network %q, must be udp, tcp, or tls", network)
+	}
+
+	return s, nil
+}
+
+// Name is the name of the sink.
+func (s *Syslog) Name() string {
+	return "syslog"
+}
+
+// Send sends each entry as a syslog message. If any message fails, the
+// connection is closed and reopened on the next send.
+func (s *Syslog) Send(ctx context.Context, entries []*database.AuditEntry) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.conn == nil {
+		conn, err := s.dial(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to connect to %s: %w", s.address, err)
+		}
+		s.conn = conn
+	}
+
+	// A zero deadline, if the context has none, clears any previous deadline.
+	deadline, _ := ctx.Deadline()
+	if err := s.conn.SetWriteDeadline(deadline); err != nil {
+		return s.reset(fmt.Errorf("failed to set deadline: %w", err))
+	}
+
+	for _, e := range entries {
+		msg, err := s.message(e)
+		if err != nil {
+			return err
+		}
+
+		// Datagrams contain exactly one message, streams are octet counted.
+		if s.network != "udp" {
+			msg = append([]byte(strconv.Itoa(len(msg))+" "), msg...)
+		}
+
+		if _, err := s.conn.Write(msg); err != nil {
+			return s.reset(fmt.Errorf("failed to send entry %d: %w", e.ID, err))
+		}
+	}
+	return nil
+}
+
+// message formats the entry as an RFC 5424 message.
+func (s *Syslog) message(e *database.AuditEntry) ([]byte, error) {
+	record, err := json.Marshal(e.Record())
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode entry %d: %w", e.ID, err)
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "<%d>1 %s %s %s - %s - %s",
+		syslogPriority,
+		e.CreatedAt.UTC().Format("2006-01-02T15:04:05.000000Z07:00"),
+		s.hostname,
+		s.appName,
+		syslogMsgID,
+		syslogBOM)
+	b.Write(record)
+	return b.Bytes(), nil
+}
+
+// reset closes the connection so the next send reconnects, and returns err.
+func (s *Syslog) reset(err error) error {
+	if s.conn != nil {
+		s.conn.Close()
+		s.conn = nil
+	}
+	return err
+}
+
+// Close closes the connection.
+func (s *Syslog) Close() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
+
+// isPrintASCII returns true if s contains only the printable ASCII characters
+// allowed in RFC 5424 header fields.
+func isPrintASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < 33 || s[i] > 126 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,133 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auditsink
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewSyslog(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name    string
+		network string
+		address string
+		appName string
+		err     bool
+	}{
+		{"udp", "udp", "localhost:514", "app", false},
+		{"tcp", "tcp", "localhost:514", "app", false},
+		{"tls", "tls", "localhost:6514", "app", false},
+		{"unknown_network", "http", "localhost:514", "app", true},
+		{"tls_no_port", "tls", "localhost", "app", true},
+		{"empty_app_name", "tcp", "localhost:514", "", true},
+		{"app_name_space", "tcp", "localhost:514", "my app", true},
+		{"app_name_long", "tcp", "localhost:514", strings.Repeat("a", 49), true},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := NewSyslog(tc.network, tc.address, tc.appName)
+			if got, want := err != nil, tc.err; got != want {
+				t.Errorf("expected error to be %t, got %v", want, err)
+			}
+		})
+	}
+}
+
+func TestSyslog_Send(t *testing.T) {
+	t.Parallel()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	msgCh := make(chan string, 10)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		// Read octet-counted frames.
+		r := bufio.NewReader(conn)
+		for {
+			size, err := r.ReadString(' ')
+			if err != nil {
+				return
+			}
+			n, err := strconv.Atoi(strings.TrimSpace(size))
+			if err != nil {
+				return
+			}
+			b := make([]byte, n)
+			if _, err := io.ReadFull(r, b); err != nil {
+				return
+			}
+			msgCh <- string(b)
+		}
+	}()
+
+	s, err := NewSyslog("tcp", ln.Addr().String(), "verification-server")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.hostname = "host"
+	defer s.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := s.Send(ctx, testEntries()); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"<109>1 2020-11-02T08:30:00.000123Z host verification-server - audit - \xef\xbb\xbf" +
+			`{"id":1,"created_at":"2020-11-02T08:30:00.000123Z","realm_id":1,"actor_id":"users:1",` +
+			`"actor_display":"Alex (alex@example.com)","action":"updated realm","target_id":"realms:1",` +
+			`"target_display":"Example","chain_sequence":1}`,
+		"<109>1 2020-11-02T08:31:00.000000Z host verification-server - audit - \xef\xbb\xbf" +
+			`{"id":2,"created_at":"2020-11-02T08:31:00Z","realm_id":1,"actor_id":"users:1",` +
+			`"actor_display":"Alex (alex@example.com)","action":"created API key","target_id":"authorized_apps:1",` +
+			`"target_display":"Key","chain_sequence":2}`,
+	}
+
+	for i, want := range expected {
+		select {
+		case got := <-msgCh:
+			if got != want {
+				t.Errorf("message %d: expected\n%q\nto be\n%q", i, got, want)
+			}
+		case <-ctx.Done():
+			t.Fatalf("timed out waiting for message %d", i)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auditsink
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+)
+
+// WebhookSignatureHeader is the header which contains the hex encoded
+// HMAC-SHA256 of the request body, keyed with the webhook secret.
+const WebhookSignatureHeader = "X-Audit-Signature"
+
+var _ Sink = (*Webhook)(nil)
+
+// Webhook posts batches of audit entries to a URL as newline-delimited JSON.
+// Any response other than 2xx is a failure, and the batch is sent again later.
+type Webhook struct {
+	url    string
+	secret []byte
+	client *http.Client
+}
+
+// NewWebhook creates a new webhook sink. If secret is not empty, requests are
+// signed with it.
+func NewWebhook(u, secret string) (*Webhook, error) {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return nil, fmt.Errorf("invalid webhook URL: %w", err)
+	}
+	if parsed.Scheme != "https" && parsed.Scheme != "http" {
+		return nil, fmt.Errorf("webhook URL must be http or https")
+	}
+
+	return &Webhook{
+		url:    u,
+		secret: []byte(secret),
+		client: &http.Client{},
+	}, nil
+}
+
+// Name is the name of the sink.
+func (w *Webhook) Name() string {
+	return "webhook"
+}
+
+// Send posts the entries in a single request.
+func (w *Webhook) Send(ctx context.Context, entries []*database.AuditEntry) error {
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	for _, e := range entries {
+		if err := enc.Encode(e.Record()); err != nil {
+			return fmt.Errorf("failed to encode entry %d: %w", e.ID, err)
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(b.Bytes()))
+	if err != nil {
+		return fmt.Errorf("failed to build request: %w", err)
+	}
+	req.Header.Set("Content-Type", database.AuditExportFormatNDJSON.ContentType())
+	if len(w.secret) > 0 {
+		req.Header.Set(WebhookSignatureHeader, WebhookSignature(w.secret, b.Bytes()))
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to post entries: %w", err)
+	}
+	defer resp.Body.Close()
+
+	// Drain the body so the connection can be reused.
+	body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 4096))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook returned %d: %s", resp.StatusCode, body)
+	}
+	return nil
+}
+
+// Close releases idle connections.
+func (w *Webhook) Close() error {
+	w.client.CloseIdleConnections()
+	return nil
+}
+
+// WebhookSignature returns the signature of the body with the secret, in the
+// form of the signature header.
+func WebhookSignature(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
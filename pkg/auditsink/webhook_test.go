@@ -0,0 +1,137 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auditsink
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNewWebhook(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name string
+		url  string
+		err  bool
+	}{
+		{"https", "https://siem.example.com/audit", false},
+		{"http", "http://localhost:8080/audit", false},
+		{"scheme", "ftp://siem.example.com/audit", true},
+		{"invalid", "://", true},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := NewWebhook(tc.url, "")
+			if got, want := err != nil, tc.err; got != want {
+				t.Errorf("expected error to be %t, got %v", want, err)
+			}
+		})
+	}
+}
+
+func TestWebhook_Send(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	t.Run("signed", func(t *testing.T) {
+		t.Parallel()
+
+		var body, signature, contentType string
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			b, err := ioutil.ReadAll(r.Body)
+			if err != nil {
+				t.Error(err)
+			}
+			body = string(b)
+			signature = r.Header.Get(WebhookSignatureHeader)
+			contentType = r.Header.Get("Content-Type")
+			w.WriteHeader(http.StatusNoContent)
+		}))
+		defer srv.Close()
+
+		w, err := NewWebhook(srv.URL, "secret")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer w.Close()
+
+		if err := w.Send(ctx, testEntries()); err != nil {
+			t.Fatal(err)
+		}
+
+		if got, want := strings.Count(body, "\n"), 2; got != want {
+			t.Errorf("expected %d lines, got %d: %q", want, got, body)
+		}
+		if got, want := contentType, "application/x-ndjson"; got != want {
+			t.Errorf("expected content type %q to be %q", got, want)
+		}
+		if got, want := signature, WebhookSignature([]byte("secret"), []byte(body)); got != want {
+			t.Errorf("expected signature %q to be %q", got, want)
+		}
+	})
+
+	t.Run("unsigned", func(t *testing.T) {
+		t.Parallel()
+
+		var signature string
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			signature = r.Header.Get(WebhookSignatureHeader)
+		}))
+		defer srv.Close()
+
+		w, err := NewWebhook(srv.URL, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer w.Close()
+
+		if err := w.Send(ctx, testEntries()); err != nil {
+			t.Fatal(err)
+		}
+		if signature != "" {
+			t.Errorf("expected no signature, got %q", signature)
+		}
+	})
+
+	t.Run("error_status", func(t *testing.T) {
+		t.Parallel()
+
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		}))
+		defer srv.Close()
+
+		w, err := NewWebhook(srv.URL, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer w.Close()
+
+		if err := w.Send(ctx, testEntries()); err == nil {
+			t.Errorf("expected error")
+		}
+	})
+}
@@ -19,6 +19,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/google/exposure-notifications-verification-server/pkg/auditsink"
 	"github.com/google/exposure-notifications-verification-server/pkg/cache"
 	"github.com/google/exposure-notifications-verification-server/pkg/database"
 	"github.com/google/exposure-notifications-verification-server/pkg/ratelimit"
@@ -35,6 +36,7 @@ type AdminAPIServerConfig struct {
 	Database      database.Config
 	Observability observability.Config
 	Cache         cache.Config
+	AuditSinks    auditsink.Config
 
 	// DevMode produces additional debugging information. Do not enable in
 	// production environments.
@@ -0,0 +1,64 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/exposure-notifications-server/pkg/keys"
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+	"github.com/google/exposure-notifications-verification-server/pkg/keyutils"
+)
+
+// AuditChainConfig represents the settings for signing audit log checkpoints
+// and truncation markers.
+type AuditChainConfig struct {
+	// Keys determines the key manager configuration for signing checkpoints.
+	Keys keys.Config `env:",prefix=AUDIT_CHAIN_"`
+
+	// SigningKey is the key version used to sign checkpoints. If empty,
+	// checkpoints are not created and truncation markers are not signed.
+	SigningKey   string `env:"AUDIT_CHAIN_SIGNING_KEY"`
+	SigningKeyID string `env:"AUDIT_CHAIN_SIGNING_KEY_ID, default=v1"`
+}
+
+// Enabled returns true if checkpoint signing is configured.
+func (c *AuditChainConfig) Enabled() bool {
+	return c.SigningKey != ""
+}
+
+// Signer returns the checkpoint signer from the key manager. It returns nil if
+// signing is not configured.
+func (c *AuditChainConfig) Signer(ctx context.Context) (*database.AuditChainSigner, error) {
+	if !c.Enabled() {
+		return nil, nil
+	}
+
+	kms, err := keyutils.KeyManagerFor(ctx, &c.Keys)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get audit chain key manager: %w", err)
+	}
+
+	signer, err := kms.NewSigner(ctx, c.SigningKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get audit chain signer: %w", err)
+	}
+
+	return &database.AuditChainSigner{
+		Signer: signer,
+		KeyID:  c.SigningKeyID,
+	}, nil
+}
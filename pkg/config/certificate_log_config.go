@@ -0,0 +1,39 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"github.com/google/exposure-notifications-server/pkg/keys"
+)
+
+// CertificateLogConfig represents the settings for sequencing and signing the
+// certificate transparency log.
+type CertificateLogConfig struct {
+	// Keys determines the key manager configuration for signing tree heads.
+	Keys keys.Config `env:",prefix=CERTIFICATE_LOG_"`
+
+	// SigningKey is the key version used to sign tree heads. If empty, the log
+	// is not sequenced.
+	SigningKey   string `env:"CERTIFICATE_LOG_SIGNING_KEY"`
+	SigningKeyID string `env:"CERTIFICATE_LOG_SIGNING_KEY_ID, default=v1"`
+
+	// BatchSize is the maximum number of entries to sequence per run.
+	BatchSize uint `env:"CERTIFICATE_LOG_BATCH_SIZE, default=10000"`
+}
+
+// Enabled returns true if tree head signing is configured.
+func (c *CertificateLogConfig) Enabled() bool {
+	return c.SigningKey != ""
+}
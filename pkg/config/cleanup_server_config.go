@@ -19,6 +19,7 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/google/exposure-notifications-verification-server/pkg/auditsink"
 	"github.com/google/exposure-notifications-verification-server/pkg/database"
 
 	"github.com/google/exposure-notifications-server/pkg/observability"
@@ -30,6 +31,9 @@ import (
 type CleanupConfig struct {
 	Database      database.Config
 	Observability observability.Config
+	Retention     RetentionConfig
+	AuditChain    AuditChainConfig
+	AuditSinks    auditsink.Config
 
 	// DevMode produces additional debugging information. Do not enable in
 	// production environments.
@@ -40,18 +44,26 @@ type CleanupConfig struct {
 	RateLimit uint64 `env:"RATE_LIMIT,default=60"`
 
 	// Cleanup config
-	AuditEntryMaxAge    time.Duration `env:"AUDIT_ENTRY_MAX_AGE, default=720h"`
 	AuthorizedAppMaxAge time.Duration `env:"AUTHORIZED_APP_MAX_AGE, default=336h"`
 	CleanupPeriod       time.Duration `env:"CLEANUP_PERIOD, default=15m"`
 	MobileAppMaxAge     time.Duration `env:"MOBILE_APP_MAX_AGE, default=168h"`
 	UserPurgeMaxAge     time.Duration `env:"USER_PURGE_MAX_AGE, default=720h"`
 	// VerificationCodeMaxAge is the period in which the full code should be available.
 	// After this time it will be recycled. The code will be zeroed out, but its status persist.
-	VerificationCodeMaxAge time.Duration `env:"VERIFICATION_CODE_MAX_AGE, default=48h"`
-	// VerificationCodeStatusMaxAge is the time after which, even the status of the code will be deleted
-	// and the entry will be purged. This value should be greater than VerificationCodeMaxAge
-	VerificationCodeStatusMaxAge time.Duration `env:"VERIFICATION_CODE_STATUS_MAX_AGE, default=336h"`
-	VerificationTokenMaxAge      time.Duration `env:"VERIFICATION_TOKEN_MAX_AGE, default=24h"`
+	VerificationCodeMaxAge  time.Duration `env:"VERIFICATION_CODE_MAX_AGE, default=48h"`
+	VerificationTokenMaxAge time.Duration `env:"VERIFICATION_TOKEN_MAX_AGE, default=24h"`
+
+	// PurgeBatchSize is the maximum number of rows deleted by a single
+	// statement, and PurgeBatchSleep is the time to wait between statements.
+	// Smaller batches hold locks for less time and give replicas time to catch
+	// up, at the cost of a longer run.
+	PurgeBatchSize  uint          `env:"PURGE_BATCH_SIZE, default=1000"`
+	PurgeBatchSleep time.Duration `env:"PURGE_BATCH_SLEEP, default=100ms"`
+
+	// DryRun reports the number of rows each step would purge without
+	// modifying any data. A single run can also be made a dry run with the
+	// "dry_run" query parameter.
+	DryRun bool `env:"DRY_RUN"`
 }
 
 // NewCleanupConfig returns the environment config for the cleanup server.
@@ -72,9 +84,8 @@ func (c *CleanupConfig) Validate() error {
 		{c.VerificationCodeMaxAge, "VERIFICATION_TOKEN_DURATION"},
 		{c.CleanupPeriod, "CLEANUP_PERIOD"},
 		{c.VerificationCodeMaxAge, "VERIFICATION_CODE_MAX_AGE"},
-		{c.VerificationCodeStatusMaxAge, "VERIFICATION_CODE_STATUS_MAX_AGE"},
 		{c.VerificationTokenMaxAge, "VERIFICATION_TOKEN_MAX_AGE"},
-		{c.AuditEntryMaxAge, "AUDIT_ENTRY_MAX_AGE"},
+		{c.PurgeBatchSleep, "PURGE_BATCH_SLEEP"},
 	}
 
 	for _, f := range fields {
@@ -83,14 +94,22 @@ func (c *CleanupConfig) Validate() error {
 		}
 	}
 
-	// Audit entries need to persist for at least 7 days. The default is 30d ays.
-	if c.AuditEntryMaxAge < 7*24*time.Hour {
-		return fmt.Errorf("AUDIT_ENTRY_MAX_AGE must be at least 7 days")
+	if c.PurgeBatchSize == 0 {
+		return fmt.Errorf("PURGE_BATCH_SIZE must be positive")
 	}
 
-	if c.VerificationCodeStatusMaxAge < c.VerificationCodeMaxAge {
+	if err := c.Retention.Validate(); err != nil {
+		return err
+	}
+
+	if c.Retention.VerificationCodeStatusMaxAge < c.VerificationCodeMaxAge {
 		return fmt.Errorf("the code status %q is expected to live longer than the life of the code %q",
-			c.VerificationCodeStatusMaxAge.String(), c.VerificationCodeMaxAge.String())
+			c.Retention.VerificationCodeStatusMaxAge.String(), c.VerificationCodeMaxAge.String())
+	}
+
+	if c.Retention.MinRealmVerificationCodeStatusMaxAge < c.VerificationCodeMaxAge {
+		return fmt.Errorf("the minimum realm code status %q is expected to live longer than the life of the code %q",
+			c.Retention.MinRealmVerificationCodeStatusMaxAge.String(), c.VerificationCodeMaxAge.String())
 	}
 
 	return nil
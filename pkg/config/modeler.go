@@ -16,10 +16,13 @@ package config
 
 import (
 	"context"
+	"fmt"
+	"time"
 
 	"github.com/google/exposure-notifications-verification-server/pkg/cache"
 	"github.com/google/exposure-notifications-verification-server/pkg/database"
 	"github.com/google/exposure-notifications-verification-server/pkg/ratelimit"
+	"github.com/google/exposure-notifications-verification-server/pkg/storage"
 
 	"github.com/google/exposure-notifications-server/pkg/observability"
 
@@ -33,6 +36,10 @@ type Modeler struct {
 	Observability observability.Config
 	RateLimit     ratelimit.Config
 
+	// Storage is where scheduled statistics reports are exported, for realms
+	// which enable it.
+	Storage storage.Config
+
 	// DevMode produces additional debugging information. Do not enable in
 	// production environments.
 	DevMode bool `env:"DEV_MODE"`
@@ -43,6 +50,11 @@ type Modeler struct {
 	// modeler.
 	MinValue uint `env:"MODELER_MIN_VALUE, default=10"`
 	MaxValue uint `env:"MODELER_MAX_VALUE, default=20000"`
+
+	// StatsReportMinTTL is the minimum amount of time that must elapse between
+	// statistics report runs. This prevents concurrent invocations from sending
+	// the same reports.
+	StatsReportMinTTL time.Duration `env:"STATS_REPORT_MIN_TTL, default=5m"`
 }
 
 // NewModeler returns the config for the modeler server.
@@ -55,6 +67,13 @@ func NewModeler(ctx context.Context) (*Modeler, error) {
 }
 
 func (c *Modeler) Validate() error {
+	if err := checkPositiveDuration(c.StatsReportMinTTL, "STATS_REPORT_MIN_TTL"); err != nil {
+		return err
+	}
+
+	if typ := c.Storage.Type; typ != "" && typ != storage.BlobstoreTypeNoop && c.Storage.Bucket == "" {
+		return fmt.Errorf("BLOBSTORE_BUCKET is required for the %s blobstore", c.Storage.Type)
+	}
 	return nil
 }
 
@@ -0,0 +1,94 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/google/exposure-notifications-verification-server/internal/auth"
+	"github.com/sethvargo/go-envconfig"
+)
+
+// OIDCConfig is the configuration for signing in with OpenID Connect identity
+// providers. It is used when the auth provider is "oidc".
+type OIDCConfig struct {
+	// Names are the names of the identity providers, in the order they are shown
+	// on the login page. Each identity provider is configured with variables
+	// prefixed by OIDC_<NAME>_, where the name is uppercased and dashes are
+	// replaced by underscores.
+	Names []string `env:"OIDC_PROVIDERS"`
+
+	// Providers are the processed identity provider configurations.
+	Providers []*OIDCProviderConfig
+}
+
+// OIDCProviderConfig is the configuration for a single identity provider.
+type OIDCProviderConfig struct {
+	Name string
+
+	DisplayName  string `env:"DISPLAY_NAME"`
+	Issuer       string `env:"ISSUER,required"`
+	ClientID     string `env:"CLIENT_ID,required"`
+	ClientSecret string `env:"CLIENT_SECRET"`
+	RedirectURL  string `env:"REDIRECT_URL,required"`
+
+	Scopes              []string `env:"SCOPES,default=openid,email,profile"`
+	EmailClaim          string   `env:"EMAIL_CLAIM,default=email"`
+	AssumeEmailVerified bool     `env:"ASSUME_EMAIL_VERIFIED"`
+
+	// MFAAMRValues and MFAACRValues are the "amr" and "acr" claim values which
+	// indicate the user signed in with multiple factors.
+	MFAAMRValues []string `env:"MFA_AMR_VALUES,default=mfa"`
+	MFAACRValues []string `env:"MFA_ACR_VALUES"`
+}
+
+// process processes the configuration of each named identity provider.
+func (c *OIDCConfig) process(ctx context.Context, l envconfig.Lookuper) error {
+	c.Providers = make([]*OIDCProviderConfig, 0, len(c.Names))
+	for _, name := range c.Names {
+		name = strings.TrimSpace(name)
+		prefix := "OIDC_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_"
+
+		provider := &OIDCProviderConfig{Name: name}
+		if err := ProcessWith(ctx, provider, envconfig.PrefixLookuper(prefix, l)); err != nil {
+			return fmt.Errorf("failed to process identity provider %q: %w", name, err)
+		}
+		c.Providers = append(c.Providers, provider)
+	}
+	return nil
+}
+
+// AuthConfigs returns the configurations for the auth provider.
+func (c *OIDCConfig) AuthConfigs() []*auth.OIDCConfig {
+	configs := make([]*auth.OIDCConfig, 0, len(c.Providers))
+	for _, p := range c.Providers {
+		configs = append(configs, &auth.OIDCConfig{
+			Name:                p.Name,
+			DisplayName:         p.DisplayName,
+			Issuer:              p.Issuer,
+			ClientID:            p.ClientID,
+			ClientSecret:        p.ClientSecret,
+			RedirectURL:         p.RedirectURL,
+			Scopes:              p.Scopes,
+			EmailClaim:          p.EmailClaim,
+			AssumeEmailVerified: p.AssumeEmailVerified,
+			MFAAMRValues:        p.MFAAMRValues,
+			MFAACRValues:        p.MFAACRValues,
+		})
+	}
+	return configs
+}
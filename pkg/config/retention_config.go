@@ -0,0 +1,146 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+)
+
+// RetentionConfig is the system data retention policy. Realms may override the
+// retention of their verification codes, audit entries, and access entries
+// within the configured minimums and maximums. It is shared by the cleanup job, which
+// enforces the policy, and the server, which displays it.
+type RetentionConfig struct {
+	// AuditEntryMaxAge is the default time after which audit entries are deleted.
+	AuditEntryMaxAge time.Duration `env:"AUDIT_ENTRY_MAX_AGE, default=720h"`
+
+	// AccessEntryMaxAge is the default time after which access entries are
+	// deleted.
+	AccessEntryMaxAge time.Duration `env:"ACCESS_ENTRY_MAX_AGE, default=720h"`
+
+	// VerificationCodeStatusMaxAge is the default time after which, even the
+	// status of the code will be deleted and the entry will be purged. This value
+	// should be greater than VerificationCodeMaxAge.
+	VerificationCodeStatusMaxAge time.Duration `env:"VERIFICATION_CODE_STATUS_MAX_AGE, default=336h"`
+
+	// MinRealmAuditEntryMaxAge and MaxRealmAuditEntryMaxAge bound the audit entry
+	// retention a realm may choose.
+	MinRealmAuditEntryMaxAge time.Duration `env:"MIN_REALM_AUDIT_ENTRY_MAX_AGE, default=168h"`
+	MaxRealmAuditEntryMaxAge time.Duration `env:"MAX_REALM_AUDIT_ENTRY_MAX_AGE, default=17520h"`
+
+	// MinRealmAccessEntryMaxAge and MaxRealmAccessEntryMaxAge bound the access
+	// entry retention a realm may choose.
+	MinRealmAccessEntryMaxAge time.Duration `env:"MIN_REALM_ACCESS_ENTRY_MAX_AGE, default=24h"`
+	MaxRealmAccessEntryMaxAge time.Duration `env:"MAX_REALM_ACCESS_ENTRY_MAX_AGE, default=17520h"`
+
+	// MinRealmVerificationCodeStatusMaxAge and
+	// MaxRealmVerificationCodeStatusMaxAge bound the verification code status
+	// retention a realm may choose.
+	MinRealmVerificationCodeStatusMaxAge time.Duration `env:"MIN_REALM_VERIFICATION_CODE_STATUS_MAX_AGE, default=48h"`
+	MaxRealmVerificationCodeStatusMaxAge time.Duration `env:"MAX_REALM_VERIFICATION_CODE_STATUS_MAX_AGE, default=2160h"`
+}
+
+func (c *RetentionConfig) Validate() error {
+	fields := []struct {
+		Var  time.Duration
+		Name string
+	}{
+		{c.AuditEntryMaxAge, "AUDIT_ENTRY_MAX_AGE"},
+		{c.AccessEntryMaxAge, "ACCESS_ENTRY_MAX_AGE"},
+		{c.VerificationCodeStatusMaxAge, "VERIFICATION_CODE_STATUS_MAX_AGE"},
+		{c.MinRealmAuditEntryMaxAge, "MIN_REALM_AUDIT_ENTRY_MAX_AGE"},
+		{c.MaxRealmAuditEntryMaxAge, "MAX_REALM_AUDIT_ENTRY_MAX_AGE"},
+		{c.MinRealmAccessEntryMaxAge, "MIN_REALM_ACCESS_ENTRY_MAX_AGE"},
+		{c.MaxRealmAccessEntryMaxAge, "MAX_REALM_ACCESS_ENTRY_MAX_AGE"},
+		{c.MinRealmVerificationCodeStatusMaxAge, "MIN_REALM_VERIFICATION_CODE_STATUS_MAX_AGE"},
+		{c.MaxRealmVerificationCodeStatusMaxAge, "MAX_REALM_VERIFICATION_CODE_STATUS_MAX_AGE"},
+	}
+
+	for _, f := range fields {
+		if err := checkPositiveDuration(f.Var, f.Name); err != nil {
+			return err
+		}
+	}
+
+	// Audit entries need to persist for at least 7 days. The default is 30 days.
+	if c.AuditEntryMaxAge < 7*24*time.Hour {
+		return fmt.Errorf("AUDIT_ENTRY_MAX_AGE must be at least 7 days")
+	}
+	if c.MinRealmAuditEntryMaxAge < 7*24*time.Hour {
+		return fmt.Errorf("MIN_REALM_AUDIT_ENTRY_MAX_AGE must be at least 7 days")
+	}
+
+	if c.MinRealmAuditEntryMaxAge > c.MaxRealmAuditEntryMaxAge {
+		return fmt.Errorf("MIN_REALM_AUDIT_ENTRY_MAX_AGE must be less than MAX_REALM_AUDIT_ENTRY_MAX_AGE")
+	}
+	if c.MinRealmAccessEntryMaxAge > c.MaxRealmAccessEntryMaxAge {
+		return fmt.Errorf("MIN_REALM_ACCESS_ENTRY_MAX_AGE must be less than MAX_REALM_ACCESS_ENTRY_MAX_AGE")
+	}
+	if c.MinRealmVerificationCodeStatusMaxAge > c.MaxRealmVerificationCodeStatusMaxAge {
+		return fmt.Errorf("MIN_REALM_VERIFICATION_CODE_STATUS_MAX_AGE must be less than MAX_REALM_VERIFICATION_CODE_STATUS_MAX_AGE")
+	}
+
+	return nil
+}
+
+// AuditEntryMaxAgeFor returns the audit entry retention for the realm. Realms
+// without an override use the system default, and overrides are clamped to the
+// system bounds.
+func (c *RetentionConfig) AuditEntryMaxAgeFor(r *database.Realm) time.Duration {
+	if r == nil || r.AuditEntryRetentionDays == 0 {
+		return c.AuditEntryMaxAge
+	}
+	return clampDuration(daysToDuration(r.AuditEntryRetentionDays),
+		c.MinRealmAuditEntryMaxAge, c.MaxRealmAuditEntryMaxAge)
+}
+
+// AccessEntryMaxAgeFor returns the access entry retention for the realm. Realms
+// without an override use the system default, and overrides are clamped to the
+// system bounds.
+func (c *RetentionConfig) AccessEntryMaxAgeFor(r *database.Realm) time.Duration {
+	if r == nil || r.AccessEntryRetentionDays == 0 {
+		return c.AccessEntryMaxAge
+	}
+	return clampDuration(daysToDuration(r.AccessEntryRetentionDays),
+		c.MinRealmAccessEntryMaxAge, c.MaxRealmAccessEntryMaxAge)
+}
+
+// VerificationCodeStatusMaxAgeFor returns the verification code status
+// retention for the realm. Realms without an override use the system default,
+// and overrides are clamped to the system bounds.
+func (c *RetentionConfig) VerificationCodeStatusMaxAgeFor(r *database.Realm) time.Duration {
+	if r == nil || r.VerificationCodeRetentionDays == 0 {
+		return c.VerificationCodeStatusMaxAge
+	}
+	return clampDuration(daysToDuration(r.VerificationCodeRetentionDays),
+		c.MinRealmVerificationCodeStatusMaxAge, c.MaxRealmVerificationCodeStatusMaxAge)
+}
+
+func daysToDuration(days uint) time.Duration {
+	return time.Duration(days) * 24 * time.Hour
+}
+
+func clampDuration(d, min, max time.Duration) time.Duration {
+	if d < min {
+		return min
+	}
+	if d > max {
+		return max
+	}
+	return d
+}
@@ -0,0 +1,95 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+
+	"github.com/google/exposure-notifications-server/pkg/observability"
+
+	"github.com/sethvargo/go-envconfig"
+)
+
+// RotationConfig represents the environment based configuration for the
+// rotation server.
+type RotationConfig struct {
+	Database       database.Config
+	Observability  observability.Config
+	CertificateLog CertificateLogConfig
+	AuditChain     AuditChainConfig
+
+	// DevMode produces additional debugging information. Do not enable in
+	// production environments.
+	DevMode bool `env:"DEV_MODE"`
+
+	Port string `env:"PORT, default=8080"`
+
+	// AssetsPath is the path to the email templates used for rotation
+	// notifications.
+	AssetsPath string `env:"ASSETS_PATH, default=./cmd/rotation/assets"`
+
+	// MinTTL is the minimum amount of time that must elapse between rotation
+	// runs. This prevents concurrent invocations from rotating the same keys.
+	MinTTL time.Duration `env:"MIN_TTL, default=5m"`
+
+	// TokenSigningKeyMaxAge is the amount of time a verification token signing
+	// key is active before it is replaced by a new key version.
+	TokenSigningKeyMaxAge time.Duration `env:"TOKEN_SIGNING_KEY_MAX_AGE, default=720h"`
+
+	// TokenSigningKeyRetention is the amount of time a retired verification token
+	// signing key is kept before it is destroyed. This must be longer than the
+	// verification token duration, or outstanding tokens will fail to verify.
+	TokenSigningKeyRetention time.Duration `env:"TOKEN_SIGNING_KEY_RETENTION, default=48h"`
+}
+
+// NewRotationConfig returns the environment config for the rotation server.
+// Only needs to be called once per instance, but may be called multiple times.
+func NewRotationConfig(ctx context.Context) (*RotationConfig, error) {
+	var config RotationConfig
+	if err := ProcessWith(ctx, &config, envconfig.OsLookuper()); err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+func (c *RotationConfig) Validate() error {
+	fields := []struct {
+		Var  time.Duration
+		Name string
+	}{
+		{c.MinTTL, "MIN_TTL"},
+		{c.TokenSigningKeyMaxAge, "TOKEN_SIGNING_KEY_MAX_AGE"},
+		{c.TokenSigningKeyRetention, "TOKEN_SIGNING_KEY_RETENTION"},
+	}
+
+	for _, f := range fields {
+		if err := checkPositiveDuration(f.Var, f.Name); err != nil {
+			return err
+		}
+	}
+
+	if c.CertificateLog.Enabled() && c.CertificateLog.BatchSize == 0 {
+		return fmt.Errorf("CERTIFICATE_LOG_BATCH_SIZE must be greater than zero")
+	}
+	return nil
+}
+
+func (c *RotationConfig) ObservabilityExporterConfig() *observability.Config {
+	return &c.Observability
+}
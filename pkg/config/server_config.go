@@ -16,9 +16,11 @@ package config
 
 import (
 	"context"
+	"fmt"
 	"strings"
 	"time"
 
+	"github.com/google/exposure-notifications-verification-server/pkg/auditsink"
 	"github.com/google/exposure-notifications-verification-server/pkg/cache"
 	"github.com/google/exposure-notifications-verification-server/pkg/database"
 	"github.com/google/exposure-notifications-verification-server/pkg/ratelimit"
@@ -31,6 +33,11 @@ import (
 
 var _ IssueAPIConfig = (*ServerConfig)(nil)
 
+const (
+	AuthProviderFirebase = "firebase"
+	AuthProviderOIDC     = "oidc"
+)
+
 // PasswordRequirementsConfig represents the password complexity requirements for the server.
 type PasswordRequirementsConfig struct {
 	Length    int `env:"MIN_PWD_LENGTH,default=8"`
@@ -51,9 +58,15 @@ type ServerConfig struct {
 	Database      database.Config
 	Observability observability.Config
 	Cache         cache.Config
+	AuditSinks    auditsink.Config
 
 	Port string `env:"PORT,default=8080"`
 
+	// AuthProvider is the provider used to sign users in, either "firebase" or
+	// "oidc". OIDC configures the identity providers for "oidc".
+	AuthProvider string `env:"AUTH_PROVIDER,default=firebase"`
+	OIDC         OIDCConfig
+
 	// Login Config
 	SessionDuration    time.Duration `env:"SESSION_DURATION, default=20h"`
 	SessionIdleTimeout time.Duration `env:"SESSION_IDLE_TIMEOUT, default=20m"`
@@ -99,6 +112,16 @@ type ServerConfig struct {
 
 	// Rate limiting configuration
 	RateLimit ratelimit.Config
+
+	// PublicStatsHMACKey is the key used to derive the noise added to public
+	// realm statistics. It must be kept secret, since it would allow the noise
+	// to be removed. Public statistics are unavailable if it is not set. It
+	// should be at least 64 bytes and base64 encoded.
+	PublicStatsHMACKey envconfig.Base64Bytes `env:"PUBLIC_STATS_HMAC_KEY"`
+
+	// Retention is the data retention policy, used to bound and display realm
+	// retention settings.
+	Retention RetentionConfig
 }
 
 // NewServerConfig initializes and validates a ServerConfig struct.
@@ -107,6 +130,15 @@ func NewServerConfig(ctx context.Context) (*ServerConfig, error) {
 	if err := ProcessWith(ctx, &config, envconfig.OsLookuper()); err != nil {
 		return nil, err
 	}
+
+	if config.AuthProvider == AuthProviderOIDC {
+		if err := config.OIDC.process(ctx, envconfig.OsLookuper()); err != nil {
+			return nil, err
+		}
+		if len(config.OIDC.Providers) == 0 {
+			return nil, fmt.Errorf("OIDC_PROVIDERS is required when AUTH_PROVIDER is %q", AuthProviderOIDC)
+		}
+	}
 	// For the, when inserting into the javascript, gets escaped and becomes unusable.
 	config.Firebase.DatabaseURL = strings.ReplaceAll(config.Firebase.DatabaseURL, "https://", "")
 	return &config, nil
@@ -128,6 +160,20 @@ func (c *ServerConfig) Validate() error {
 		}
 	}
 
+	if err := c.Retention.Validate(); err != nil {
+		return err
+	}
+
+	switch c.AuthProvider {
+	case AuthProviderFirebase:
+		if err := c.Firebase.Validate(); err != nil {
+			return err
+		}
+	case AuthProviderOIDC:
+	default:
+		return fmt.Errorf("AUTH_PROVIDER must be %q or %q, got %q", AuthProviderFirebase, AuthProviderOIDC, c.AuthProvider)
+	}
+
 	c.ENExpressRedirectDomain = strings.ToLower(c.ENExpressRedirectDomain)
 
 	return nil
@@ -161,21 +207,45 @@ func (c *ServerConfig) IsMaintenanceMode() bool {
 	return c.MaintenanceMode
 }
 
-// FirebaseConfig represents configuration specific to firebase auth.
+// FirebaseConfig represents configuration specific to firebase auth. It is
+// only required when the auth provider is "firebase".
 type FirebaseConfig struct {
-	APIKey          string `env:"FIREBASE_API_KEY,required"`
-	AuthDomain      string `env:"FIREBASE_AUTH_DOMAIN,required"`
-	DatabaseURL     string `env:"FIREBASE_DATABASE_URL,required"`
-	ProjectID       string `env:"FIREBASE_PROJECT_ID,required"`
-	StorageBucket   string `env:"FIREBASE_STORAGE_BUCKET,required"`
-	MessageSenderID string `env:"FIREBASE_MESSAGE_SENDER_ID,required"`
-	AppID           string `env:"FIREBASE_APP_ID,required"`
-	MeasurementID   string `env:"FIREBASE_MEASUREMENT_ID,required"`
+	APIKey          string `env:"FIREBASE_API_KEY"`
+	AuthDomain      string `env:"FIREBASE_AUTH_DOMAIN"`
+	DatabaseURL     string `env:"FIREBASE_DATABASE_URL"`
+	ProjectID       string `env:"FIREBASE_PROJECT_ID"`
+	StorageBucket   string `env:"FIREBASE_STORAGE_BUCKET"`
+	MessageSenderID string `env:"FIREBASE_MESSAGE_SENDER_ID"`
+	AppID           string `env:"FIREBASE_APP_ID"`
+	MeasurementID   string `env:"FIREBASE_MEASUREMENT_ID"`
 
 	TermsOfServiceURL string `env:"FIREBASE_TERMS_OF_SERVICE_URL"`
 	PrivacyPolicyURL  string `env:"FIREBASE_PRIVACY_POLICY_URL"`
 }
 
+// Validate checks that all required values are set.
+func (c *FirebaseConfig) Validate() error {
+	required := []struct {
+		val  string
+		name string
+	}{
+		{c.APIKey, "FIREBASE_API_KEY"},
+		{c.AuthDomain, "FIREBASE_AUTH_DOMAIN"},
+		{c.DatabaseURL, "FIREBASE_DATABASE_URL"},
+		{c.ProjectID, "FIREBASE_PROJECT_ID"},
+		{c.StorageBucket, "FIREBASE_STORAGE_BUCKET"},
+		{c.MessageSenderID, "FIREBASE_MESSAGE_SENDER_ID"},
+		{c.AppID, "FIREBASE_APP_ID"},
+		{c.MeasurementID, "FIREBASE_MEASUREMENT_ID"},
+	}
+	for _, r := range required {
+		if r.val == "" {
+			return fmt.Errorf("%s is required", r.name)
+		}
+	}
+	return nil
+}
+
 // FirebaseConfig returns the firebase SDK config based on the local env config.
 func (c *ServerConfig) FirebaseConfig() *firebase.Config {
 	return &firebase.Config{
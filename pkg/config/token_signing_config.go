@@ -16,42 +16,35 @@ package config
 
 import (
 	"fmt"
-
-	"github.com/google/exposure-notifications-server/pkg/keys"
+	"time"
 )
 
-// TokenSigningConfig represents the settings for system-wide certificate
-// signing. These should be used if you are managing certifiate keys externally.
+// TokenSigningConfig represents the settings for system-wide verification
+// token signing. Token signing keys are managed in the database, and are
+// created, used, and published with the database key manager.
 type TokenSigningConfig struct {
-	// Keys determines the key manager configuration for this token signing
-	// configuration.
-	Keys keys.Config `env:",prefix=TOKEN_"`
-
-	TokenSigningKeys   []string `env:"TOKEN_SIGNING_KEY, required"`
+	// TokenSigningKeys and TokenSigningKeyIDs are externally-managed token
+	// signing key versions and their 'kid' values. They are imported into the
+	// database on startup if no token signing keys exist yet, and are otherwise
+	// ignored. The key versions must be accessible with the database key
+	// manager.
+	TokenSigningKeys   []string `env:"TOKEN_SIGNING_KEY"`
 	TokenSigningKeyIDs []string `env:"TOKEN_SIGNING_KEY_ID, default=v1"`
 	TokenIssuer        string   `env:"TOKEN_ISSUER, default=diagnosis-verification-example"`
-}
-
-func (t *TokenSigningConfig) ActiveKey() string {
-	// Validation prevents this slice from being empty.
-	return t.TokenSigningKeys[0]
-}
 
-func (t *TokenSigningConfig) ActiveKeyID() string {
-	// Validation prevents this slice from being empty.
-	return t.TokenSigningKeyIDs[0]
+	// TokenSigningKeyCacheDuration is the amount of time to cache token signing
+	// key lookups. Newly activated keys may take up to this long to be used for
+	// signing.
+	TokenSigningKeyCacheDuration time.Duration `env:"TOKEN_SIGNING_KEY_CACHE_DURATION, default=5m"`
 }
 
 func (t *TokenSigningConfig) Validate() error {
-	if len(t.TokenSigningKeys) == 0 {
-		return fmt.Errorf("TOKEN_SIGNING_KEY must have at least one entry")
-	}
-	if len(t.TokenSigningKeyIDs) == 0 {
-		return fmt.Errorf("TOKEN_SIGNING_KEY_ID must have at least one entry")
+	if len(t.TokenSigningKeys) > 0 && len(t.TokenSigningKeys) != len(t.TokenSigningKeyIDs) {
+		return fmt.Errorf("TOKEN_SIGNING_KEY and TOKEN_SIGNING_KEY_ID must be lists of the same length")
 	}
 
-	if len(t.TokenSigningKeys) != len(t.TokenSigningKeyIDs) {
-		return fmt.Errorf("TOKEN_SIGNING_KEY and TOKEN_SIGNING_KEY_ID must be lists of the same length")
+	if err := checkPositiveDuration(t.TokenSigningKeyCacheDuration, "TOKEN_SIGNING_KEY_CACHE_DURATION"); err != nil {
+		return err
 	}
 	return nil
 }
@@ -0,0 +1,98 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controller
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+)
+
+// maxAccessUserAgentLength is the maximum length of the user agent recorded on
+// access entries. Longer values are truncated.
+const maxAccessUserAgentLength = 512
+
+// AuditAccess records that the current user or API key read the target, if
+// the realm's access audit level includes the action. The request's method,
+// path, remote IP, user agent, and request ID are recorded with the entry.
+//
+// Callers should not return the data if this returns an error, so that reads
+// are never unaudited.
+func AuditAccess(r *http.Request, db *database.Database, realm *database.Realm, action *database.AccessAction, target database.Auditable) error {
+	if !realm.ShouldAuditAccess(action) {
+		return nil
+	}
+
+	actor := accessActor(r)
+	if actor == nil {
+		return fmt.Errorf("no actor to audit %s", action.Name)
+	}
+
+	entry := database.BuildAccessEntry(actor, action, target, realm.ID)
+	entry.Method = r.Method
+	entry.Path = r.URL.Path
+	entry.RemoteIP = accessRemoteIP(r)
+	entry.UserAgent = r.UserAgent()
+	if len(entry.UserAgent) > maxAccessUserAgentLength {
+		entry.UserAgent = entry.UserAgent[:maxAccessUserAgentLength]
+	}
+	entry.RequestID = RequestIDFromContext(r.Context())
+
+	if err := db.SaveAccessEntry(entry); err != nil {
+		return fmt.Errorf("failed to save access entry: %w", err)
+	}
+	return nil
+}
+
+// accessActor returns the API key or user making the request, or nil if there
+// is neither.
+func accessActor(r *http.Request) database.Auditable {
+	ctx := r.Context()
+
+	if app := AuthorizedAppFromContext(ctx); app != nil {
+		return app
+	}
+	if membership := MembershipFromContext(ctx); membership != nil && membership.User != nil {
+		return membership.User
+	}
+	if user := UserFromContext(ctx); user != nil {
+		return user
+	}
+	return nil
+}
+
+// accessRemoteIP returns the client's IP. The load balancer sets
+// x-forwarded-for, and the first entry is the real client IP. The header is
+// client controlled, so it is only used if it is a valid IP. Otherwise the IP
+// of the remote address is used, or an empty string if it has none.
+func accessRemoteIP(r *http.Request) string {
+	if xff := r.Header.Get("x-forwarded-for"); xff != "" {
+		if ip := net.ParseIP(strings.TrimSpace(strings.Split(xff, ",")[0])); ip != nil {
+			return ip.String()
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		return ip.String()
+	}
+	return ""
+}
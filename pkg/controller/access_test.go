@@ -0,0 +1,83 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controller
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+)
+
+func TestAuditAccess(t *testing.T) {
+	t.Parallel()
+
+	t.Run("level_off", func(t *testing.T) {
+		t.Parallel()
+
+		r := httptest.NewRequest("GET", "/realm/users/export.csv", nil)
+		realm := &database.Realm{AccessAuditLevel: database.AccessAuditOff}
+
+		// The database is not used when the action is not audited.
+		if err := AuditAccess(r, nil, realm, database.AccessExportedUsers, realm); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("no_actor", func(t *testing.T) {
+		t.Parallel()
+
+		r := httptest.NewRequest("GET", "/realm/users/export.csv", nil)
+		realm := &database.Realm{AccessAuditLevel: database.AccessAuditAll}
+
+		if err := AuditAccess(r, nil, realm, database.AccessExportedUsers, realm); err == nil {
+			t.Errorf("expected error")
+		}
+	})
+}
+
+func TestAccessRemoteIP(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name string
+		xff  string
+		want string
+	}{
+		{"remote_addr", "", "192.0.2.1"},
+		{"forwarded", "203.0.113.7, 10.0.0.1", "203.0.113.7"},
+		{"forwarded_ipv6", "2001:db8::1", "2001:db8::1"},
+		{"forwarded_invalid", "not-an-ip", "192.0.2.1"},
+		{"forwarded_too_long", strings.Repeat("1", 100), "192.0.2.1"},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			r := httptest.NewRequest("GET", "/", nil)
+			if tc.xff != "" {
+				r.Header.Set("x-forwarded-for", tc.xff)
+			}
+
+			if got, want := accessRemoteIP(r), tc.want; got != want {
+				t.Errorf("expected %q to be %q", got, want)
+			}
+		})
+	}
+}
@@ -27,12 +27,6 @@ import (
 )
 
 const (
-	// QueryFromSearch is the query key for a starting time.
-	QueryFromSearch = "from"
-
-	// QueryToSearch is the query key for an ending time.
-	QueryToSearch = "to"
-
 	// QueryRealmIDSearch is the query key to filter by realmID.
 	QueryRealmIDSearch = "realm_id"
 
@@ -51,38 +45,17 @@ func (c *Controller) HandleEventsShow() http.Handler {
 			controller.BadRequest(w, r, c.h)
 			return
 		}
-		from := r.FormValue(QueryFromSearch)
-		to := r.FormValue(QueryToSearch)
-		scopes := []database.Scope{}
-		scopes = append(scopes, database.WithAuditTime(from, to))
-		realmID := project.TrimSpace(r.FormValue(QueryRealmIDSearch))
-
-		includeTest, _ := strconv.ParseBool(r.FormValue(QueryIncludeTest))
-		if !includeTest {
-			scopes = append(scopes, database.WithoutAuditTest())
-		}
 
-		// Add realm filter if applicable
-		var realm *database.Realm
-		switch realmID {
-		case "":
-			// All events
-		case "0":
-			realm = &database.Realm{
-				Model: gorm.Model{ID: 0},
-				Name:  "System",
-			}
-		default:
-			realm, err = c.db.FindRealm(realmID)
-			if err != nil {
-				controller.InternalError(w, r, c.h, err)
-				return
-			}
+		filter, err := controller.AuditFilterFromRequest(r)
+		if err != nil {
+			controller.BadRequest(w, r, c.h)
+			return
 		}
 
-		// If a specific realm was provided, filter by that realm.
-		if realm != nil {
-			scopes = append(scopes, database.WithAuditRealmID(realm.ID))
+		scopes, realm, err := c.eventScopes(r, filter)
+		if err != nil {
+			controller.InternalError(w, r, c.h, err)
+			return
 		}
 
 		// List the events
@@ -92,17 +65,85 @@ func (c *Controller) HandleEventsShow() http.Handler {
 			return
 		}
 
-		c.renderEvents(ctx, w, events, paginator, from, to, realm)
+		actions, err := c.db.ListAuditActions()
+		if err != nil {
+			controller.InternalError(w, r, c.h, err)
+			return
+		}
+
+		c.renderEvents(ctx, w, r, events, paginator, actions, realm)
+	})
+}
+
+// HandleEventsExport exports the events which match the filters in the request
+// as a file download.
+func (c *Controller) HandleEventsExport(format database.AuditExportFormat) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		filter, err := controller.AuditFilterFromRequest(r)
+		if err != nil {
+			controller.BadRequest(w, r, c.h)
+			return
+		}
+
+		scopes, _, err := c.eventScopes(r, filter)
+		if err != nil {
+			controller.InternalError(w, r, c.h, err)
+			return
+		}
+
+		controller.ExportAudits(w, r, c.h, c.db, format, "system-events", scopes...)
 	})
 }
 
-func (c *Controller) renderEvents(ctx context.Context, w http.ResponseWriter,
-	events []*database.AuditEntry, paginator *pagination.Paginator, from, to string, realm *database.Realm) {
+// eventScopes builds the scopes for the filter and the realm and test filters
+// in the request. The returned realm is nil if the events are not filtered by realm, or the
+// placeholder "System" realm with ID 0 for system events.
+func (c *Controller) eventScopes(r *http.Request, filter *database.AuditFilter) ([]database.Scope, *database.Realm, error) {
+	scopes := filter.Scopes()
+
+	includeTest, _ := strconv.ParseBool(r.FormValue(QueryIncludeTest))
+	if !includeTest {
+		scopes = append(scopes, database.WithoutAuditTest())
+	}
+
+	// Add realm filter if applicable
+	var realm *database.Realm
+	var err error
+	switch realmID := project.TrimSpace(r.FormValue(QueryRealmIDSearch)); realmID {
+	case "":
+		// All events
+	case "0":
+		realm = &database.Realm{
+			Model: gorm.Model{ID: 0},
+			Name:  "System",
+		}
+	default:
+		realm, err = c.db.FindRealm(realmID)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// If a specific realm was provided, filter by that realm.
+	if realm != nil {
+		scopes = append(scopes, database.WithAuditRealmID(realm.ID))
+	}
+	return scopes, realm, nil
+}
+
+func (c *Controller) renderEvents(ctx context.Context, w http.ResponseWriter, r *http.Request,
+	events []*database.AuditEntry, paginator *pagination.Paginator, actions []string, realm *database.Realm) {
 	m := controller.TemplateMapFromContext(ctx)
 	m["events"] = events
 	m["paginator"] = paginator
-	m[QueryFromSearch] = from
-	m[QueryToSearch] = to
+	m["actions"] = actions
+	for _, k := range []string{
+		controller.QueryAuditActor, controller.QueryAuditAction, controller.QueryAuditTarget,
+		controller.QueryAuditSearch, controller.QueryAuditFrom, controller.QueryAuditTo,
+		QueryIncludeTest,
+	} {
+		m[k] = r.FormValue(k)
+	}
 	m["realm"] = realm
 	c.h.RenderHTML(w, "admin/events/index", m)
 }
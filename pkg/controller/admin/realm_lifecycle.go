@@ -0,0 +1,143 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package admin
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/google/exposure-notifications-server/pkg/logging"
+	"github.com/google/exposure-notifications-verification-server/pkg/controller"
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+	"github.com/gorilla/mux"
+)
+
+// HandleRealmsState moves a realm through its lifecycle: active, disabled, and
+// archived.
+func (c *Controller) HandleRealmsState() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		vars := mux.Vars(r)
+
+		session := controller.SessionFromContext(ctx)
+		if session == nil {
+			controller.MissingSession(w, r, c.h)
+			return
+		}
+		flash := controller.Flash(session)
+
+		currentUser := controller.UserFromContext(ctx)
+		if currentUser == nil {
+			controller.MissingUser(w, r, c.h)
+			return
+		}
+
+		realm, err := c.db.FindRealm(vars["id"])
+		if err != nil {
+			if database.IsNotFound(err) {
+				controller.NotFound(w, r, c.h)
+				return
+			}
+
+			controller.InternalError(w, r, c.h, err)
+			return
+		}
+
+		state, err := database.ParseRealmState(r.FormValue("state"))
+		if err != nil {
+			flash.Error("Failed to update realm: %v", err)
+			controller.Back(w, r, c.h)
+			return
+		}
+
+		if err := realm.TransitionTo(state); err != nil {
+			flash.Error("Failed to update realm: %v", err)
+			controller.Back(w, r, c.h)
+			return
+		}
+
+		if err := c.db.SaveRealm(realm, currentUser); err != nil {
+			flash.Error("Failed to update realm: %v", err)
+			controller.Back(w, r, c.h)
+			return
+		}
+
+		flash.Alert("Realm %q is now %s", realm.Name, state.Display())
+		http.Redirect(w, r, fmt.Sprintf("/admin/realms/%d/edit", realm.ID), http.StatusSeeOther)
+	})
+}
+
+// HandleRealmsPurge permanently deletes an archived realm and all of its data.
+// The name of the realm must be provided as confirmation.
+func (c *Controller) HandleRealmsPurge() http.Handler {
+	type FormData struct {
+		Confirm string `form:"confirm"`
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		vars := mux.Vars(r)
+
+		logger := logging.FromContext(ctx).Named("admin.HandleRealmsPurge")
+
+		session := controller.SessionFromContext(ctx)
+		if session == nil {
+			controller.MissingSession(w, r, c.h)
+			return
+		}
+		flash := controller.Flash(session)
+
+		currentUser := controller.UserFromContext(ctx)
+		if currentUser == nil {
+			controller.MissingUser(w, r, c.h)
+			return
+		}
+
+		realm, err := c.db.FindRealm(vars["id"])
+		if err != nil {
+			if database.IsNotFound(err) {
+				controller.NotFound(w, r, c.h)
+				return
+			}
+
+			controller.InternalError(w, r, c.h, err)
+			return
+		}
+
+		var form FormData
+		if err := controller.BindForm(w, r, &form); err != nil {
+			flash.Error("Failed to process form: %v", err)
+			controller.Back(w, r, c.h)
+			return
+		}
+
+		if form.Confirm != realm.Name {
+			flash.Error("Realm name does not match, type %q to confirm", realm.Name)
+			controller.Back(w, r, c.h)
+			return
+		}
+
+		counts, err := c.db.PurgeRealm(ctx, realm, currentUser)
+		if err != nil {
+			flash.Error("Failed to purge realm: %v", err)
+			controller.Back(w, r, c.h)
+			return
+		}
+		logger.Infow("purged realm", "realm_id", realm.ID, "counts", counts)
+
+		flash.Alert("Permanently deleted realm %q", realm.Name)
+		http.Redirect(w, r, "/admin/realms", http.StatusSeeOther)
+	})
+}
@@ -0,0 +1,152 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package admin
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/google/exposure-notifications-verification-server/pkg/controller"
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+	"github.com/google/exposure-notifications-verification-server/pkg/pagination"
+	"github.com/gorilla/mux"
+)
+
+// HandleRealmTemplatesIndex lists the realm templates.
+func (c *Controller) HandleRealmTemplatesIndex() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		pageParams, err := pagination.FromRequest(r)
+		if err != nil {
+			controller.BadRequest(w, r, c.h)
+			return
+		}
+
+		templates, paginator, err := c.db.ListRealmTemplates(pageParams)
+		if err != nil {
+			controller.InternalError(w, r, c.h, err)
+			return
+		}
+
+		m := controller.TemplateMapFromContext(ctx)
+		m.Title("Realm templates - System Admin")
+		m["templates"] = templates
+		m["paginator"] = paginator
+		c.h.RenderHTML(w, "admin/realmtemplates/index", m)
+	})
+}
+
+// HandleRealmTemplatesCreate saves the current settings of a realm as a new
+// template.
+func (c *Controller) HandleRealmTemplatesCreate() http.Handler {
+	type FormData struct {
+		Name        string `form:"name"`
+		Description string `form:"description"`
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		vars := mux.Vars(r)
+
+		session := controller.SessionFromContext(ctx)
+		if session == nil {
+			controller.MissingSession(w, r, c.h)
+			return
+		}
+		flash := controller.Flash(session)
+
+		currentUser := controller.UserFromContext(ctx)
+		if currentUser == nil {
+			controller.MissingUser(w, r, c.h)
+			return
+		}
+
+		realm, err := c.db.FindRealm(vars["id"])
+		if err != nil {
+			if database.IsNotFound(err) {
+				controller.NotFound(w, r, c.h)
+				return
+			}
+
+			controller.InternalError(w, r, c.h, err)
+			return
+		}
+
+		var form FormData
+		if err := controller.BindForm(w, r, &form); err != nil {
+			flash.Error("Failed to process form: %v", err)
+			controller.Back(w, r, c.h)
+			return
+		}
+
+		template := database.NewRealmTemplateFromRealm(form.Name, realm)
+		template.Description = form.Description
+		if err := c.db.SaveRealmTemplate(template, currentUser); err != nil {
+			if msgs := template.ErrorMessages(); len(msgs) > 0 {
+				flash.Error("Failed to create realm template: %s", strings.Join(msgs, ", "))
+			} else {
+				flash.Error("Failed to create realm template: %v", err)
+			}
+			controller.Back(w, r, c.h)
+			return
+		}
+
+		flash.Alert("Created realm template %q from %q", template.Name, realm.Name)
+		http.Redirect(w, r, "/admin/realm-templates", http.StatusSeeOther)
+	})
+}
+
+// HandleRealmTemplatesDelete deletes a realm template. Realms which were
+// created from the template are not affected.
+func (c *Controller) HandleRealmTemplatesDelete() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		vars := mux.Vars(r)
+
+		session := controller.SessionFromContext(ctx)
+		if session == nil {
+			controller.MissingSession(w, r, c.h)
+			return
+		}
+		flash := controller.Flash(session)
+
+		currentUser := controller.UserFromContext(ctx)
+		if currentUser == nil {
+			controller.MissingUser(w, r, c.h)
+			return
+		}
+
+		template, err := c.db.FindRealmTemplate(vars["id"])
+		if err != nil {
+			if database.IsNotFound(err) {
+				controller.NotFound(w, r, c.h)
+				return
+			}
+
+			controller.InternalError(w, r, c.h, err)
+			return
+		}
+
+		if err := c.db.DeleteRealmTemplate(template, currentUser); err != nil {
+			flash.Error("Failed to delete realm template: %v", err)
+			controller.Back(w, r, c.h)
+			return
+		}
+
+		flash.Alert("Deleted realm template %q", template.Name)
+		http.Redirect(w, r, "/admin/realm-templates", http.StatusSeeOther)
+	})
+}
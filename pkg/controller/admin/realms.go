@@ -19,8 +19,10 @@ import (
 	"fmt"
 	"net/http"
 
+	"github.com/google/exposure-notifications-verification-server/internal/auth"
 	"github.com/google/exposure-notifications-verification-server/pkg/controller"
 	"github.com/google/exposure-notifications-verification-server/pkg/database"
+	"github.com/google/exposure-notifications-verification-server/pkg/keyutils"
 	"github.com/google/exposure-notifications-verification-server/pkg/pagination"
 	"github.com/google/exposure-notifications-verification-server/pkg/rbac"
 	"github.com/gorilla/mux"
@@ -75,6 +77,11 @@ func (c *Controller) HandleRealmsCreate() http.Handler {
 		CertificateAudience     string `form:"certificateAudience"`
 		CanUseSystemSMSConfig   bool   `form:"can_use_system_sms_config"`
 		CanUseSystemEmailConfig bool   `form:"can_use_system_email_config"`
+
+		// TemplateID and CloneRealmID optionally specify the settings from which
+		// to create the realm. Values in the form take precedence.
+		TemplateID   uint `form:"templateID"`
+		CloneRealmID uint `form:"cloneRealmID"`
 	}
 
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -105,11 +112,47 @@ func (c *Controller) HandleRealmsCreate() http.Handler {
 			return
 		}
 
+		templates, _, err := c.db.ListRealmTemplates(nil)
+		if err != nil {
+			controller.InternalError(w, r, c.h, err)
+			return
+		}
+
 		// Requested form, stop processing.
 		if r.Method == http.MethodGet {
-			var realm database.Realm
-			realm.UseRealmCertificateKey = true
-			c.renderNewRealm(ctx, w, &realm, smsConfig, emailConfig)
+			realm := &database.Realm{UseRealmCertificateKey: true}
+
+			var templateID uint
+			if v := r.FormValue("template"); v != "" {
+				template, err := c.db.FindRealmTemplate(v)
+				if err != nil {
+					if database.IsNotFound(err) {
+						controller.NotFound(w, r, c.h)
+						return
+					}
+
+					controller.InternalError(w, r, c.h, err)
+					return
+				}
+				templateID = template.ID
+			}
+
+			var cloneRealm *database.Realm
+			if v := r.FormValue("clone"); v != "" {
+				cloneRealm, err = c.db.FindRealm(v)
+				if err != nil {
+					if database.IsNotFound(err) {
+						controller.NotFound(w, r, c.h)
+						return
+					}
+
+					controller.InternalError(w, r, c.h, err)
+					return
+				}
+				realm = cloneRealm.Clone("")
+			}
+
+			c.renderNewRealm(ctx, w, realm, smsConfig, emailConfig, templates, templateID, cloneRealm)
 			return
 		}
 
@@ -118,35 +161,65 @@ func (c *Controller) HandleRealmsCreate() http.Handler {
 			var realm database.Realm
 			realm.UseRealmCertificateKey = true
 			flash.Error("Failed to process form: %v", err)
-			c.renderNewRealm(ctx, w, &realm, smsConfig, emailConfig)
+			c.renderNewRealm(ctx, w, &realm, smsConfig, emailConfig, templates, 0, nil)
 			return
 		}
 
 		realm := database.NewRealmWithDefaults(form.Name)
+
+		var cloneRealm *database.Realm
+		var template *database.RealmTemplate
+		switch {
+		case form.CloneRealmID != 0:
+			cloneRealm, err = c.db.FindRealm(form.CloneRealmID)
+			if err != nil {
+				controller.InternalError(w, r, c.h, err)
+				return
+			}
+			realm = cloneRealm.Clone(form.Name)
+		case form.TemplateID != 0:
+			template, err = c.db.FindRealmTemplate(form.TemplateID)
+			if err != nil {
+				controller.InternalError(w, r, c.h, err)
+				return
+			}
+			template.ApplyTo(realm)
+		}
+
 		realm.RegionCode = form.RegionCode
 		realm.UseRealmCertificateKey = form.UseRealmCertificateKey
 		realm.CertificateIssuer = form.CertificateIssuer
 		realm.CertificateAudience = form.CertificateAudience
 		realm.CanUseSystemSMSConfig = form.CanUseSystemSMSConfig
+		realm.UseSystemSMSConfig = realm.UseSystemSMSConfig && realm.CanUseSystemSMSConfig
 		realm.CanUseSystemEmailConfig = form.CanUseSystemEmailConfig
+		realm.UseSystemEmailConfig = realm.UseSystemEmailConfig && realm.CanUseSystemEmailConfig
 		if err := c.db.SaveRealm(realm, currentUser); err != nil {
 			flash.Error("Failed to create realm: %v", err)
-			c.renderNewRealm(ctx, w, realm, smsConfig, emailConfig)
+			c.renderNewRealm(ctx, w, realm, smsConfig, emailConfig, templates, form.TemplateID, cloneRealm)
 			return
 		}
-		flash.Alert("Created realm %q", realm.Name)
+
+		switch {
+		case cloneRealm != nil:
+			flash.Alert("Created realm %q as a copy of %q", realm.Name, cloneRealm.Name)
+		case template != nil:
+			flash.Alert("Created realm %q from template %q", realm.Name, template.Name)
+		default:
+			flash.Alert("Created realm %q", realm.Name)
+		}
 
 		// Make the current user an admin of the realm they just created.
 		if err := currentUser.AddToRealm(c.db, realm, rbac.LegacyRealmAdmin, currentUser); err != nil {
 			flash.Error("Failed to add you as an admin to the realm: %v", err)
-			c.renderNewRealm(ctx, w, realm, smsConfig, emailConfig)
+			c.renderNewRealm(ctx, w, realm, smsConfig, emailConfig, templates, form.TemplateID, cloneRealm)
 			return
 		}
 		flash.Alert("Added you as an administrator of %q", realm.Name)
 
 		if realm.UseRealmCertificateKey {
 			// If we are using realm specific keys - we need to create the first one.
-			keyID, err := realm.CreateSigningKeyVersion(ctx, c.db)
+			keyID, err := realm.CreateSigningKeyVersion(ctx, c.db, keyutils.AlgorithmES256)
 			if err != nil {
 				flash.Error("Failed to create signing keys for realm. This can be done from the realm's admin screens.")
 				http.Redirect(w, r, "/admin/realms", http.StatusSeeOther)
@@ -160,12 +233,16 @@ func (c *Controller) HandleRealmsCreate() http.Handler {
 }
 
 func (c *Controller) renderNewRealm(ctx context.Context, w http.ResponseWriter,
-	realm *database.Realm, smsConfig *database.SMSConfig, emailConfig *database.EmailConfig) {
+	realm *database.Realm, smsConfig *database.SMSConfig, emailConfig *database.EmailConfig,
+	templates []*database.RealmTemplate, templateID uint, cloneRealm *database.Realm) {
 	m := controller.TemplateMapFromContext(ctx)
 	m.Title("New Realm - System Admin")
 	m["realm"] = realm
 	m["systemSMSConfig"] = smsConfig
 	m["systemEmailConfig"] = emailConfig
+	m["templates"] = templates
+	m["templateID"] = templateID
+	m["cloneRealm"] = cloneRealm
 	m["supportsPerRealmSigning"] = c.db.SupportsPerRealmSigning()
 	c.h.RenderHTML(w, "admin/realms/new", m)
 }
@@ -174,6 +251,13 @@ func (c *Controller) HandleRealmsUpdate() http.Handler {
 	type FormData struct {
 		CanUseSystemSMSConfig   bool `form:"can_use_system_sms_config"`
 		CanUseSystemEmailConfig bool `form:"can_use_system_email_config"`
+
+		IdentityProvider string `form:"identity_provider"`
+
+		ParentRealmID               uint `form:"parent_realm_id"`
+		InheritParentSMSConfig      bool `form:"inherit_parent_sms_config"`
+		InheritParentTestTypes      bool `form:"inherit_parent_test_types"`
+		InheritParentCertificateKey bool `form:"inherit_parent_certificate_key"`
 	}
 
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -232,24 +316,46 @@ func (c *Controller) HandleRealmsUpdate() http.Handler {
 			}
 		}
 
+		parentRealms, childRealms, err := c.realmHierarchy(realm)
+		if err != nil {
+			controller.InternalError(w, r, c.h, err)
+			return
+		}
+
 		// Requested form, stop processing.
 		if r.Method == http.MethodGet {
-			c.renderEditRealm(ctx, w, realm, membership, smsConfig, emailConfig, quotaLimit, quotaRemaining)
+			c.renderEditRealm(ctx, w, realm, membership, smsConfig, emailConfig, quotaLimit, quotaRemaining, parentRealms, childRealms)
 			return
 		}
 
 		var form FormData
 		if err := controller.BindForm(w, r, &form); err != nil {
 			flash.Error("Failed to process form: %v", err)
-			c.renderEditRealm(ctx, w, realm, membership, smsConfig, emailConfig, quotaLimit, quotaRemaining)
+			c.renderEditRealm(ctx, w, realm, membership, smsConfig, emailConfig, quotaLimit, quotaRemaining, parentRealms, childRealms)
 			return
 		}
 
 		realm.CanUseSystemSMSConfig = form.CanUseSystemSMSConfig
 		realm.CanUseSystemEmailConfig = form.CanUseSystemEmailConfig
+
+		// The identity provider is only shown when signing in with OpenID
+		// Connect, so leave any existing binding in place otherwise.
+		if p, ok := c.authProvider.(auth.RedirectProvider); ok {
+			if !hasIdentityProvider(p, form.IdentityProvider) {
+				flash.Error("Failed to update realm: unknown identity provider %q", form.IdentityProvider)
+				c.renderEditRealm(ctx, w, realm, membership, smsConfig, emailConfig, quotaLimit, quotaRemaining, parentRealms, childRealms)
+				return
+			}
+			realm.IdentityProvider = form.IdentityProvider
+		}
+
+		realm.ParentRealmID = form.ParentRealmID
+		realm.InheritParentSMSConfig = form.InheritParentSMSConfig
+		realm.InheritParentTestTypes = form.InheritParentTestTypes
+		realm.InheritParentCertificateKey = form.InheritParentCertificateKey
 		if err := c.db.SaveRealm(realm, currentUser); err != nil {
 			flash.Error("Failed to create realm: %v", err)
-			c.renderEditRealm(ctx, w, realm, membership, smsConfig, emailConfig, quotaLimit, quotaRemaining)
+			c.renderEditRealm(ctx, w, realm, membership, smsConfig, emailConfig, quotaLimit, quotaRemaining, parentRealms, childRealms)
 			return
 		}
 
@@ -260,19 +366,70 @@ func (c *Controller) HandleRealmsUpdate() http.Handler {
 
 func (c *Controller) renderEditRealm(ctx context.Context, w http.ResponseWriter,
 	realm *database.Realm, membership *database.Membership, smsConfig *database.SMSConfig, emailConfig *database.EmailConfig,
-	quotaLimit, quotaRemaining uint64) {
+	quotaLimit, quotaRemaining uint64, parentRealms, childRealms []*database.Realm) {
 	m := controller.TemplateMapFromContext(ctx)
 	m.Title("Realm: %s - System Admin", realm.Name)
 	m["realm"] = realm
+	m["parentRealms"] = parentRealms
+	m["childRealms"] = childRealms
 	m["membership"] = membership
 	m["systemSMSConfig"] = smsConfig
 	m["systemEmailConfig"] = emailConfig
 	m["supportsPerRealmSigning"] = c.db.SupportsPerRealmSigning()
 	m["quotaLimit"] = quotaLimit
 	m["quotaRemaining"] = quotaRemaining
+	if p, ok := c.authProvider.(auth.RedirectProvider); ok {
+		m["identityProviders"] = p.IdentityProviders()
+	}
 	c.h.RenderHTML(w, "admin/realms/edit", m)
 }
 
+// hasIdentityProvider returns true if name is empty or the name of one of the
+// provider's identity providers.
+func hasIdentityProvider(p auth.RedirectProvider, name string) bool {
+	if name == "" {
+		return true
+	}
+	for _, idp := range p.IdentityProviders() {
+		if idp.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// realmHierarchy returns the realms which could be the parent of the given
+// realm, and the realm's direct children.
+func (c *Controller) realmHierarchy(realm *database.Realm) ([]*database.Realm, []*database.Realm, error) {
+	realms, _, err := c.db.ListRealms(&pagination.PageParams{Limit: database.MaxPageSize})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	descendantIDs, err := realm.DescendantRealmIDs(c.db)
+	if err != nil {
+		return nil, nil, err
+	}
+	exclude := make(map[uint]struct{}, len(descendantIDs)+1)
+	exclude[realm.ID] = struct{}{}
+	for _, id := range descendantIDs {
+		exclude[id] = struct{}{}
+	}
+
+	parents := make([]*database.Realm, 0, len(realms))
+	for _, r := range realms {
+		if _, ok := exclude[r.ID]; !ok {
+			parents = append(parents, r)
+		}
+	}
+
+	children, err := realm.ListChildRealms(c.db)
+	if err != nil {
+		return nil, nil, err
+	}
+	return parents, children, nil
+}
+
 func (c *Controller) HandleRealmsAdd() http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		ctx := r.Context()
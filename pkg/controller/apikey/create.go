@@ -47,11 +47,17 @@ func (c *Controller) HandleCreate() http.Handler {
 		currentRealm := membership.Realm
 		currentUser := membership.User
 
+		sites, err := currentRealm.ListActiveSites(c.db)
+		if err != nil {
+			controller.InternalError(w, r, c.h, err)
+			return
+		}
+
 		// Requested form, stop processing.
 		if r.Method == http.MethodGet {
 			var authApp database.AuthorizedApp
 			authApp.APIKeyType = database.APIKeyTypeInvalid
-			c.renderNew(ctx, w, &authApp)
+			c.renderNew(ctx, w, &authApp, sites)
 			return
 		}
 
@@ -59,7 +65,16 @@ func (c *Controller) HandleCreate() http.Handler {
 		if err := bindCreateForm(r, &authApp); err != nil {
 			authApp.AddError("", err.Error())
 			w.WriteHeader(http.StatusUnprocessableEntity)
-			c.renderNew(ctx, w, &authApp)
+			c.renderNew(ctx, w, &authApp, sites)
+			return
+		}
+
+		// Audit keys can export the entire event log, so they can only be
+		// created by members who could export it themselves.
+		if authApp.IsAuditType() && !membership.Can(rbac.AuditExport) {
+			authApp.AddError("type", "requires the AuditExport permission")
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			c.renderNew(ctx, w, &authApp, sites)
 			return
 		}
 
@@ -67,7 +82,7 @@ func (c *Controller) HandleCreate() http.Handler {
 		if err != nil {
 			if database.IsValidationError(err) {
 				w.WriteHeader(http.StatusUnprocessableEntity)
-				c.renderNew(ctx, w, &authApp)
+				c.renderNew(ctx, w, &authApp, sites)
 				return
 			}
 
@@ -86,24 +101,28 @@ func (c *Controller) HandleCreate() http.Handler {
 
 func bindCreateForm(r *http.Request, app *database.AuthorizedApp) error {
 	type FormData struct {
-		Name string              `form:"name"`
-		Type database.APIKeyType `form:"type"`
+		Name          string              `form:"name"`
+		Type          database.APIKeyType `form:"type"`
+		DefaultSiteID uint                `form:"default_site_id"`
 	}
 
 	var form FormData
 	err := controller.BindForm(nil, r, &form)
 	app.Name = form.Name
 	app.APIKeyType = form.Type
+	app.DefaultSiteID = form.DefaultSiteID
 	return err
 }
 
 // renderNew renders the edit page.
-func (c *Controller) renderNew(ctx context.Context, w http.ResponseWriter, authApp *database.AuthorizedApp) {
+func (c *Controller) renderNew(ctx context.Context, w http.ResponseWriter, authApp *database.AuthorizedApp, sites []*database.Site) {
 	m := controller.TemplateMapFromContext(ctx)
 	m.Title("New API key")
 	m["authApp"] = authApp
+	m["sites"] = sites
 	m["typeAdmin"] = database.APIKeyTypeAdmin
 	m["typeDevice"] = database.APIKeyTypeDevice
 	m["typeStats"] = database.APIKeyTypeStats
+	m["typeAudit"] = database.APIKeyTypeAudit
 	c.h.RenderHTML(w, "apikeys/new", m)
 }
@@ -73,6 +73,11 @@ func (c *Controller) HandleShow() http.Handler {
 			return
 		}
 
+		if err := controller.AuditAccess(r, c.db, currentRealm, database.AccessViewedAPIKey, authApp); err != nil {
+			controller.InternalError(w, r, c.h, err)
+			return
+		}
+
 		c.renderShow(ctx, w, authApp)
 	})
 }
@@ -77,9 +77,17 @@ func (c *Controller) HandleStats() http.Handler {
 		case strings.HasSuffix(pth, ".csv"):
 			nowFormatted := time.Now().UTC().Format(project.RFC3339Squish)
 			filename := fmt.Sprintf("%s-apikey-stats.csv", nowFormatted)
+			if err := controller.AuditAccess(r, c.db, currentRealm, database.AccessDownloadedStats, authApp); err != nil {
+				controller.InternalError(w, r, c.h, err)
+				return
+			}
 			c.h.RenderCSV(w, http.StatusOK, filename, stats)
 			return
 		case strings.HasSuffix(pth, ".json"):
+			if err := controller.AuditAccess(r, c.db, currentRealm, database.AccessDownloadedStats, authApp); err != nil {
+				controller.InternalError(w, r, c.h, err)
+				return
+			}
 			c.h.RenderJSON(w, http.StatusOK, stats)
 			return
 		default:
@@ -90,7 +98,7 @@ func (c *Controller) HandleStats() http.Handler {
 }
 
 func (c *Controller) getStats(ctx context.Context, authApp *database.AuthorizedApp, realm *database.Realm) (database.AuthorizedAppStats, error) {
-	now := time.Now().UTC()
+	now := realm.StatsDate(time.Now())
 	past := now.Add(-30 * 24 * time.Hour)
 
 	var stats database.AuthorizedAppStats
@@ -62,23 +62,29 @@ func (c *Controller) HandleUpdate() http.Handler {
 			return
 		}
 
+		sites, err := currentRealm.ListActiveSites(c.db)
+		if err != nil {
+			controller.InternalError(w, r, c.h, err)
+			return
+		}
+
 		// Requested form, stop processing.
 		if r.Method == http.MethodGet {
-			c.renderEdit(ctx, w, authApp)
+			c.renderEdit(ctx, w, authApp, sites)
 			return
 		}
 
 		if err := bindUpdateForm(r, authApp); err != nil {
 			authApp.AddError("", err.Error())
 			w.WriteHeader(http.StatusUnprocessableEntity)
-			c.renderNew(ctx, w, authApp)
+			c.renderNew(ctx, w, authApp, sites)
 			return
 		}
 
 		if err := c.db.SaveAuthorizedApp(authApp, currentUser); err != nil {
 			if database.IsValidationError(err) {
 				w.WriteHeader(http.StatusUnprocessableEntity)
-				c.renderNew(ctx, w, authApp)
+				c.renderNew(ctx, w, authApp, sites)
 				return
 			}
 
@@ -93,19 +99,22 @@ func (c *Controller) HandleUpdate() http.Handler {
 
 func bindUpdateForm(r *http.Request, app *database.AuthorizedApp) error {
 	type FormData struct {
-		Name string `form:"name"`
+		Name          string `form:"name"`
+		DefaultSiteID uint   `form:"default_site_id"`
 	}
 
 	var form FormData
 	err := controller.BindForm(nil, r, &form)
 	app.Name = form.Name
+	app.DefaultSiteID = form.DefaultSiteID
 	return err
 }
 
 // renderEdit renders the edit page.
-func (c *Controller) renderEdit(ctx context.Context, w http.ResponseWriter, authApp *database.AuthorizedApp) {
+func (c *Controller) renderEdit(ctx context.Context, w http.ResponseWriter, authApp *database.AuthorizedApp, sites []*database.Site) {
 	m := controller.TemplateMapFromContext(ctx)
 	m.Title("Edit API key: %s", authApp.Name)
 	m["authApp"] = authApp
+	m["sites"] = sites
 	c.h.RenderHTML(w, "apikeys/edit", m)
 }
@@ -0,0 +1,151 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/exposure-notifications-server/pkg/logging"
+	"github.com/google/exposure-notifications-verification-server/internal/project"
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+	"github.com/google/exposure-notifications-verification-server/pkg/render"
+)
+
+const (
+	// QueryAuditActor is the query key to filter audit entries by actor ID.
+	QueryAuditActor = "actor"
+
+	// QueryAuditAction is the query key to filter audit entries by action.
+	QueryAuditAction = "action"
+
+	// QueryAuditTarget is the query key to filter audit entries by target ID.
+	QueryAuditTarget = "target"
+
+	// QueryAuditSearch is the query key to search audit entries' displays.
+	QueryAuditSearch = "q"
+
+	// QueryAuditFrom is the query key for the earliest audit entry time.
+	QueryAuditFrom = "from"
+
+	// QueryAuditTo is the query key for the latest audit entry time.
+	QueryAuditTo = "to"
+)
+
+// auditTimeFormats are the accepted formats of the from and to query values,
+// most specific first. The first two are produced by datetime-local inputs.
+// Times without a zone are UTC.
+var auditTimeFormats = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	project.RFC3339Date,
+}
+
+// AuditFilterFromRequest builds an audit filter from the request's query
+// values. It returns an error if the from or to times are invalid. A to date
+// without a time includes the entire day.
+func AuditFilterFromRequest(r *http.Request) (*database.AuditFilter, error) {
+	filter := &database.AuditFilter{
+		ActorID:  project.TrimSpace(r.FormValue(QueryAuditActor)),
+		Action:   project.TrimSpace(r.FormValue(QueryAuditAction)),
+		TargetID: project.TrimSpace(r.FormValue(QueryAuditTarget)),
+		Search:   project.TrimSpace(r.FormValue(QueryAuditSearch)),
+	}
+
+	from, _, err := parseAuditTime(r.FormValue(QueryAuditFrom))
+	if err != nil {
+		return nil, fmt.Errorf("invalid from: %w", err)
+	}
+	filter.From = from
+
+	to, dateOnly, err := parseAuditTime(r.FormValue(QueryAuditTo))
+	if err != nil {
+		return nil, fmt.Errorf("invalid to: %w", err)
+	}
+	if dateOnly {
+		to = to.Add(24*time.Hour - time.Nanosecond)
+	}
+	filter.To = to
+
+	return filter, nil
+}
+
+// parseAuditTime parses s in any of the auditTimeFormats. It returns the zero
+// time if s is empty, and whether s was a date without a time.
+func parseAuditTime(s string) (time.Time, bool, error) {
+	s = project.TrimSpace(s)
+	if s == "" {
+		return time.Time{}, false, nil
+	}
+
+	for _, f := range auditTimeFormats {
+		if t, err := time.Parse(f, s); err == nil {
+			return t.UTC(), f == project.RFC3339Date, nil
+		}
+	}
+	return time.Time{}, false, fmt.Errorf("%q is not a valid time", s)
+}
+
+// ExportAudits streams the audit entries which match the scopes to the
+// response as a file download. The filename is prefixed with the current time
+// and suffixed with the format. If the export fails before anything is
+// written, an internal error is rendered. Otherwise the response is truncated
+// and the error is logged, since the status has already been sent.
+func ExportAudits(w http.ResponseWriter, r *http.Request, h render.Renderer, db *database.Database,
+	format database.AuditExportFormat, name string, scopes ...database.Scope) {
+	logger := logging.FromContext(r.Context()).Named("controller.ExportAudits")
+
+	filename := fmt.Sprintf("%s-%s.%s", time.Now().UTC().Format(project.RFC3339Squish), name, format)
+
+	hw := &headerWriter{
+		ResponseWriter: w,
+		header: func() {
+			w.Header().Set("Content-Type", format.ContentType())
+			w.Header().Set("Content-Disposition", fmt.Sprintf("attachment;filename=%s", filename))
+		},
+	}
+
+	if err := db.ExportAudits(hw, format, scopes...); err != nil {
+		if !hw.wrote {
+			InternalError(w, r, h, err)
+			return
+		}
+		logger.Errorw("failed to export audit entries", "error", err)
+	}
+
+	// Nothing matched the scopes, which is only possible for NDJSON, since CSV
+	// always has a header.
+	if !hw.wrote {
+		hw.header()
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// headerWriter sets the response headers immediately before the first write.
+type headerWriter struct {
+	http.ResponseWriter
+	header func()
+	wrote  bool
+}
+
+func (w *headerWriter) Write(b []byte) (int, error) {
+	if !w.wrote {
+		w.header()
+		w.wrote = true
+	}
+	return w.ResponseWriter.Write(b)
+}
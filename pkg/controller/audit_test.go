@@ -0,0 +1,115 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controller
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestAuditFilterFromRequest(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name  string
+		query string
+		from  time.Time
+		to    time.Time
+		err   bool
+	}{
+		{
+			name:  "empty",
+			query: "",
+		},
+		{
+			name:  "datetime_local",
+			query: "from=2020-11-02T08:30&to=2020-11-03T17:45:10",
+			from:  time.Date(2020, 11, 2, 8, 30, 0, 0, time.UTC),
+			to:    time.Date(2020, 11, 3, 17, 45, 10, 0, time.UTC),
+		},
+		{
+			name:  "rfc3339",
+			query: "from=2020-11-02T08:30:00-05:00",
+			from:  time.Date(2020, 11, 2, 13, 30, 0, 0, time.UTC),
+		},
+		{
+			name:  "dates",
+			query: "from=2020-11-02&to=2020-11-03",
+			from:  time.Date(2020, 11, 2, 0, 0, 0, 0, time.UTC),
+			to:    time.Date(2020, 11, 3, 23, 59, 59, 999999999, time.UTC),
+		},
+		{
+			name:  "invalid_from",
+			query: "from=yesterday",
+			err:   true,
+		},
+		{
+			name:  "invalid_to",
+			query: "to=11/03/2020",
+			err:   true,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			r := httptest.NewRequest("GET", "/events?"+tc.query, nil)
+			filter, err := AuditFilterFromRequest(r)
+			if (err != nil) != tc.err {
+				t.Fatalf("expected error %t, got %v", tc.err, err)
+			}
+			if err != nil {
+				return
+			}
+
+			if !filter.From.Equal(tc.from) {
+				t.Errorf("expected from %v to be %v", filter.From, tc.from)
+			}
+			if !filter.To.Equal(tc.to) {
+				t.Errorf("expected to %v to be %v", filter.To, tc.to)
+			}
+		})
+	}
+
+	t.Run("fields", func(t *testing.T) {
+		t.Parallel()
+
+		r := httptest.NewRequest("GET", "/events?actor=+users:1+&action=updated+realm&target=realms:2&q=alex", nil)
+		filter, err := AuditFilterFromRequest(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got, want := filter.ActorID, "users:1"; got != want {
+			t.Errorf("expected actor %q to be %q", got, want)
+		}
+		if got, want := filter.Action, "updated realm"; got != want {
+			t.Errorf("expected action %q to be %q", got, want)
+		}
+		if got, want := filter.TargetID, "realms:2"; got != want {
+			t.Errorf("expected target %q to be %q", got, want)
+		}
+		if got, want := filter.Search, "alex"; got != want {
+			t.Errorf("expected search %q to be %q", got, want)
+		}
+		if got, want := len(filter.Scopes()), 4; got != want {
+			t.Errorf("expected %d scopes to be %d", got, want)
+		}
+	})
+}
@@ -0,0 +1,75 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package auditapi exports a realm's event log to holders of audit API keys.
+package auditapi
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/google/exposure-notifications-verification-server/pkg/api"
+	"github.com/google/exposure-notifications-verification-server/pkg/controller"
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+	"github.com/google/exposure-notifications-verification-server/pkg/render"
+)
+
+// Controller exports audit entries.
+type Controller struct {
+	db *database.Database
+	h  render.Renderer
+}
+
+// New creates a new audit API controller.
+func New(ctx context.Context, db *database.Database, h render.Renderer) *Controller {
+	return &Controller{
+		db: db,
+		h:  h,
+	}
+}
+
+// HandleExport exports the events of the API key's realm which match the
+// filters in the query. The filters are the same as those of the realm event
+// log in the UI.
+func (c *Controller) HandleExport(format database.AuditExportFormat) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		authApp := controller.AuthorizedAppFromContext(ctx)
+		if authApp == nil {
+			controller.MissingAuthorizedApp(w, r, c.h)
+			return
+		}
+
+		filter, err := controller.AuditFilterFromRequest(r)
+		if err != nil {
+			c.h.RenderJSON(w, http.StatusBadRequest, api.Error(err))
+			return
+		}
+
+		realm, err := authApp.Realm(c.db)
+		if err != nil {
+			controller.InternalError(w, r, c.h, err)
+			return
+		}
+
+		if err := controller.AuditAccess(r, c.db, realm, database.AccessExportedAudits, realm); err != nil {
+			controller.InternalError(w, r, c.h, err)
+			return
+		}
+
+		scopes := append(filter.Scopes(), database.WithAuditRealmID(realm.ID))
+		controller.ExportAudits(w, r, c.h, c.db, format, "events", scopes...)
+	})
+}
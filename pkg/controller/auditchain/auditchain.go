@@ -0,0 +1,69 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package auditchain signs periodic checkpoints of the hash-chained audit log.
+package auditchain
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/google/exposure-notifications-server/pkg/logging"
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+	"github.com/google/exposure-notifications-verification-server/pkg/render"
+)
+
+// Controller is a controller for signing audit chain checkpoints.
+type Controller struct {
+	db     *database.Database
+	signer *database.AuditChainSigner
+	h      render.Renderer
+}
+
+// New creates a new audit chain controller.
+func New(ctx context.Context, db *database.Database, signer *database.AuditChainSigner, h render.Renderer) *Controller {
+	return &Controller{
+		db:     db,
+		signer: signer,
+		h:      h,
+	}
+}
+
+// HandleCheckpoint accepts an HTTP trigger and signs a checkpoint for each
+// realm's audit chain which has grown since its last checkpoint.
+func (c *Controller) HandleCheckpoint() http.Handler {
+	type CheckpointResult struct {
+		OK      bool   `json:"ok"`
+		Created int    `json:"created"`
+		Error   string `json:"error,omitempty"`
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		logger := logging.FromContext(ctx).Named("auditchain.HandleCheckpoint")
+
+		created, err := c.db.CreateAuditCheckpoints(c.signer)
+		if err != nil {
+			logger.Errorw("failed to create audit checkpoints", "error", err)
+			c.h.RenderJSON(w, http.StatusInternalServerError, &CheckpointResult{
+				Created: created,
+				Error:   err.Error(),
+			})
+			return
+		}
+
+		logger.Infow("created audit checkpoints", "created", created)
+		c.h.RenderJSON(w, http.StatusOK, &CheckpointResult{OK: true, Created: created})
+	})
+}
@@ -33,11 +33,13 @@ import (
 	"github.com/google/exposure-notifications-server/pkg/logging"
 
 	"github.com/dgrijalva/jwt-go"
+	"github.com/jinzhu/gorm"
 )
 
 type Controller struct {
 	config      *config.APIServerConfig
 	db          *database.Database
+	cacher      vcache.Cacher
 	h           render.Renderer
 	pubKeyCache *keyutils.PublicKeyCache // Cache of public keys for verification token verification.
 	signerCache *cache.Cache             // Cache signers on a per-realm basis.
@@ -59,6 +61,7 @@ func New(ctx context.Context, config *config.APIServerConfig, db *database.Datab
 	return &Controller{
 		config:      config,
 		db:          db,
+		cacher:      cacher,
 		h:           h,
 		pubKeyCache: pubKeyCache,
 		signerCache: signerCache,
@@ -66,10 +69,42 @@ func New(ctx context.Context, config *config.APIServerConfig, db *database.Datab
 	}, nil
 }
 
-// Parses and validates the token against the configured keyID and public key.
-// A map of valid 'kid' values is supported.
+// tokenPublicKey returns the public key for the token signing key with the
+// given kid, from the database key manager which created the key. Both the key
+// lookup and the public key are cached, so newly created keys are discovered
+// without a restart. Unknown kids are cached too, so tokens with made up kids
+// cannot be used to query the database on every request.
+func (c *Controller) tokenPublicKey(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	var key database.TokenSigningKey
+	cacheKey := &vcache.Key{
+		Namespace: "token_signing_keys:by_kid",
+		Key:       kid,
+	}
+	if err := c.cacher.Fetch(ctx, cacheKey, &key, c.config.TokenSigning.TokenSigningKeyCacheDuration, func() (interface{}, error) {
+		key, err := c.db.FindTokenSigningKeyByKID(kid)
+		if err != nil {
+			if database.IsNotFound(err) {
+				// Cache an empty key to record that the kid does not exist.
+				return &database.TokenSigningKey{}, nil
+			}
+			return nil, err
+		}
+		return key, nil
+	}); err != nil {
+		return nil, err
+	}
+	if key.ID == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+
+	return c.pubKeyCache.GetPublicKey(ctx, key.KeyID, c.db.KeyManager())
+}
+
+// Parses and validates the token against the token signing keys in the
+// database, selected by the token's 'kid' header. Retired keys are accepted
+// until they are destroyed.
 // If the token is valid the token id (`tid') and subject (`sub`) claims are returned.
-func (c *Controller) validateToken(ctx context.Context, verToken string, publicKeys map[string]crypto.PublicKey) (string, *database.Subject, error) {
+func (c *Controller) validateToken(ctx context.Context, verToken string) (string, *database.Subject, error) {
 	logger := logging.FromContext(ctx).Named("certapi.validateToken")
 
 	// Parse and validate the verification token.
@@ -81,10 +116,14 @@ func (c *Controller) validateToken(ctx context.Context, verToken string, publicK
 			logger.Infow("invalid verification token", "error", err)
 			return nil, err
 		}
-		publicKey, ok := publicKeys[kid]
-		if !ok {
-			err := fmt.Errorf("no public key exists for kid %q", kid)
-			logger.Infow("invalid verification token", "error", err)
+		publicKey, err := c.tokenPublicKey(ctx, kid)
+		if err != nil {
+			if database.IsNotFound(err) {
+				err = fmt.Errorf("no public key exists for kid %q", kid)
+				logger.Infow("invalid verification token", "error", err)
+				return nil, err
+			}
+			logger.Errorw("failed to get public key", "kid", kid, "error", err)
 			return nil, err
 		}
 		return publicKey, nil
@@ -28,6 +28,8 @@ const metricPrefix = observability.MetricRoot + "/api/certificate"
 
 var (
 	mLatencyMs = stats.Float64(metricPrefix+"/request", "# of certificate issue requests", stats.UnitMilliseconds)
+
+	mVerifyLatencyMs = stats.Float64(metricPrefix+"/verify_request", "# of certificate verify requests", stats.UnitMilliseconds)
 )
 
 func init() {
@@ -46,5 +48,19 @@ func init() {
 			TagKeys:     observability.APITagKeys(),
 			Aggregation: ochttp.DefaultLatencyDistribution,
 		},
+		{
+			Name:        metricPrefix + "/verify_request_count",
+			Measure:     mVerifyLatencyMs,
+			Description: "The count of certificate verify requests",
+			TagKeys:     observability.APITagKeys(),
+			Aggregation: view.Count(),
+		},
+		{
+			Name:        metricPrefix + "/verify_request_latency",
+			Measure:     mVerifyLatencyMs,
+			Description: "The latency distribution of certificate verify requests",
+			TagKeys:     observability.APITagKeys(),
+			Aggregation: ochttp.DefaultLatencyDistribution,
+		},
 	}...)
 }
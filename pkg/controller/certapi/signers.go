@@ -21,14 +21,16 @@ import (
 	"time"
 
 	"github.com/google/exposure-notifications-verification-server/pkg/database"
+	"github.com/google/exposure-notifications-verification-server/pkg/keyutils"
 )
 
 type SignerInfo struct {
-	Signer   crypto.Signer
-	KeyID    string
-	Issuer   string
-	Audience string
-	Duration time.Duration
+	Signer    crypto.Signer
+	Algorithm keyutils.Algorithm
+	KeyID     string
+	Issuer    string
+	Audience  string
+	Duration  time.Duration
 }
 
 func (c *Controller) getSignerForRealm(ctx context.Context, authApp *database.AuthorizedApp) (*SignerInfo, error) {
@@ -40,18 +42,29 @@ func (c *Controller) getSignerForRealm(ctx context.Context, authApp *database.Au
 				return nil, fmt.Errorf("unable to load realm settings: %w", err)
 			}
 
+			// Child realms may sign with their parent realm's keys and settings.
+			realm, err = realm.CertificateRealm(c.db)
+			if err != nil {
+				return nil, fmt.Errorf("unable to load certificate realm settings: %w", err)
+			}
+
 			if !realm.UseRealmCertificateKey {
 				// This realm is using the system key.
 				signer, err := c.kms.NewSigner(ctx, c.config.CertificateSigning.CertificateSigningKey)
 				if err != nil {
 					return nil, fmt.Errorf("unable to get signing key from key manager: realmId: %v: %w", sRealmID, err)
 				}
+				alg, err := keyutils.AlgorithmForPublicKey(signer.Public())
+				if err != nil {
+					return nil, fmt.Errorf("unsupported system signing key: %w", err)
+				}
 				return &SignerInfo{
-					Signer:   signer,
-					KeyID:    c.config.CertificateSigning.CertificateSigningKeyID,
-					Issuer:   c.config.CertificateSigning.CertificateIssuer,
-					Audience: c.config.CertificateSigning.CertificateAudience,
-					Duration: c.config.CertificateSigning.CertificateDuration,
+					Signer:    signer,
+					Algorithm: alg,
+					KeyID:     c.config.CertificateSigning.CertificateSigningKeyID,
+					Issuer:    c.config.CertificateSigning.CertificateIssuer,
+					Audience:  c.config.CertificateSigning.CertificateAudience,
+					Duration:  c.config.CertificateSigning.CertificateDuration,
 				}, nil
 			}
 
@@ -66,12 +79,20 @@ func (c *Controller) getSignerForRealm(ctx context.Context, authApp *database.Au
 			if err != nil {
 				return nil, fmt.Errorf("unable to get signing key from key manager: realmId: %v: %w", sRealmID, err)
 			}
+
+			// Refuse to sign if the key in the key manager does not match the
+			// algorithm that was advertised for this key.
+			alg := signingKey.SigningAlgorithm()
+			if err := alg.ValidatePublicKey(signer.Public()); err != nil {
+				return nil, fmt.Errorf("invalid signing key %s for realm %v: %w", signingKey.GetKID(), sRealmID, err)
+			}
 			return &SignerInfo{
-				Signer:   signer,
-				KeyID:    signingKey.GetKID(),
-				Issuer:   realm.CertificateIssuer,
-				Audience: realm.CertificateAudience,
-				Duration: realm.CertificateDuration.Duration,
+				Signer:    signer,
+				Algorithm: alg,
+				KeyID:     signingKey.GetKID(),
+				Issuer:    realm.CertificateIssuer,
+				Audience:  realm.CertificateAudience,
+				Duration:  realm.CertificateDuration.Duration,
 			}, nil
 		})
 	if err != nil {
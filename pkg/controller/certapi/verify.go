@@ -0,0 +1,252 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package certapi
+
+import (
+	"context"
+	"crypto"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/google/exposure-notifications-server/pkg/base64util"
+	"github.com/google/exposure-notifications-server/pkg/logging"
+	"github.com/google/exposure-notifications-verification-server/pkg/api"
+	vcache "github.com/google/exposure-notifications-verification-server/pkg/cache"
+	"github.com/google/exposure-notifications-verification-server/pkg/controller"
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+	"github.com/google/exposure-notifications-verification-server/pkg/keyutils"
+	"github.com/google/exposure-notifications-verification-server/pkg/observability"
+
+	verifyapi "github.com/google/exposure-notifications-server/pkg/api/v1"
+)
+
+// errUnknownKID is returned when a certificate's kid does not belong to the
+// system key or any realm key.
+var errUnknownKID = errors.New("unknown kid")
+
+// verificationKey is a key that certificates may be verified against.
+type verificationKey struct {
+	publicKey crypto.PublicKey
+	algorithm keyutils.Algorithm
+	issuer    string
+	audience  string
+
+	// realm is nil for the system key.
+	realm *database.Realm
+}
+
+// HandleVerifyCertificate verifies a certificate issued by this server and
+// returns its details. It uses the same keys that HandleCertificate signs with,
+// so key servers and auditors do not need to parse the JWKS themselves.
+func (c *Controller) HandleVerifyCertificate() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		logger := logging.FromContext(ctx).Named("certapi.HandleVerifyCertificate")
+
+		var blame = observability.BlameNone
+		var result = observability.ResultOK()
+
+		defer observability.RecordLatency(ctx, time.Now(), mVerifyLatencyMs, &blame, &result)
+
+		var request api.VerifyCertificateRequest
+		if err := controller.BindJSON(w, r, &request); err != nil {
+			logger.Errorw("failed to parse json request", "error", err)
+			blame = observability.BlameClient
+			result = observability.ResultError("FAILED_TO_PARSE_JSON_REQUEST")
+
+			c.h.RenderJSON(w, http.StatusBadRequest, api.Error(err).WithCode(api.ErrCertificateInvalid))
+			return
+		}
+
+		resp, err := c.verifyCertificate(ctx, request.Certificate, request.ExposureKeyHMAC)
+		if err != nil {
+			logger.Errorw("failed to verify certificate", "error", err)
+			blame = observability.BlameServer
+			result = observability.ResultError("FAILED_TO_VERIFY_CERTIFICATE")
+
+			c.h.RenderJSON(w, http.StatusInternalServerError, api.InternalError())
+			return
+		}
+
+		if !resp.Valid {
+			blame = observability.BlameClient
+			result = observability.ResultError("INVALID_CERTIFICATE")
+		}
+		c.h.RenderJSON(w, http.StatusOK, resp)
+	})
+}
+
+// verifyCertificate verifies the certificate. An invalid certificate is
+// reported in the response. The error is only non-nil if verification could not
+// be performed.
+func (c *Controller) verifyCertificate(ctx context.Context, certificate, expectedHMAC string) (*api.VerifyCertificateResponse, error) {
+	invalid := func(code, format string, args ...interface{}) (*api.VerifyCertificateResponse, error) {
+		return &api.VerifyCertificateResponse{
+			Error:     fmt.Sprintf(format, args...),
+			ErrorCode: code,
+		}, nil
+	}
+
+	// Parse without verifying to find the key.
+	unverified, _, err := new(jwt.Parser).ParseUnverified(certificate, &verifyapi.VerificationClaims{})
+	if err != nil {
+		return invalid(api.ErrCertificateInvalid, "certificate is not a valid JWT")
+	}
+	kid, ok := unverified.Header[verifyapi.KeyIDHeader].(string)
+	if !ok || kid == "" {
+		return invalid(api.ErrCertificateInvalid, "missing 'kid' header in certificate")
+	}
+
+	key, err := c.verificationKey(ctx, kid)
+	if err != nil {
+		if errors.Is(err, errUnknownKID) {
+			return invalid(api.ErrCertificateInvalid, "no public key exists for kid %q", kid)
+		}
+		return nil, err
+	}
+
+	// Only accept the algorithm of the key, never the algorithm the certificate
+	// claims to use.
+	if got, want := unverified.Method.Alg(), string(key.algorithm); got != want {
+		return invalid(api.ErrCertificateInvalid, "certificate algorithm %s does not match key algorithm %s", got, want)
+	}
+
+	var claims verifyapi.VerificationClaims
+	_, err = jwt.ParseWithClaims(certificate, &claims, func(*jwt.Token) (interface{}, error) {
+		return key.publicKey, nil
+	})
+
+	var code, message string
+	if err != nil {
+		// The claims are validated before the signature, so an expired error
+		// with no other errors means the signature is valid.
+		var verr *jwt.ValidationError
+		if !errors.As(err, &verr) || verr.Errors != jwt.ValidationErrorExpired {
+			return invalid(api.ErrCertificateInvalid, "invalid certificate")
+		}
+		code, message = api.ErrCertificateExpired, "certificate is expired"
+	}
+
+	resp := &api.VerifyCertificateResponse{
+		KeyID:                kid,
+		Algorithm:            string(key.algorithm),
+		ReportType:           claims.ReportType,
+		SymptomOnsetInterval: claims.SymptomOnsetInterval,
+		IssuedAt:             claims.IssuedAt,
+		ExpiresAt:            claims.ExpiresAt,
+	}
+	if key.realm != nil {
+		resp.RealmID = key.realm.ID
+		resp.RealmName = key.realm.Name
+	}
+
+	if !claims.VerifyIssuer(key.issuer, true) || !claims.VerifyAudience(key.audience, true) {
+		code, message = api.ErrCertificateInvalid, "certificate has an invalid issuer or audience"
+	}
+
+	if code == "" && expectedHMAC != "" && !hmacEqual(claims.SignedMAC, expectedHMAC) {
+		code, message = api.ErrCertificateHMACMismatch, "certificate was not issued for the provided HMAC"
+	}
+
+	resp.Valid = code == ""
+	resp.Error = message
+	resp.ErrorCode = code
+	return resp, nil
+}
+
+// verificationKey returns the key for the given kid. It returns errUnknownKID
+// if the kid is not the system key or an existing realm key. Unknown kids are
+// cached like known ones, so made-up kids do not each query the database.
+func (c *Controller) verificationKey(ctx context.Context, kid string) (*verificationKey, error) {
+	signing := c.config.CertificateSigning
+
+	if kid == signing.CertificateSigningKeyID {
+		pub, err := c.pubKeyCache.GetPublicKey(ctx, signing.CertificateSigningKey, c.kms)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get system public key: %w", err)
+		}
+		alg, err := keyutils.AlgorithmForPublicKey(pub)
+		if err != nil {
+			return nil, fmt.Errorf("unsupported system signing key: %w", err)
+		}
+		return &verificationKey{
+			publicKey: pub,
+			algorithm: alg,
+			issuer:    signing.CertificateIssuer,
+			audience:  signing.CertificateAudience,
+		}, nil
+	}
+
+	var signingKey database.SigningKey
+	cacheKey := &vcache.Key{
+		Namespace: "signing_keys:by_kid",
+		Key:       kid,
+	}
+	if err := c.cacher.Fetch(ctx, cacheKey, &signingKey, signing.PublicKeyCacheDuration, func() (interface{}, error) {
+		key, err := c.db.FindSigningKeyByKID(kid)
+		if err != nil {
+			if database.IsNotFound(err) {
+				// Cache an empty key to record that the kid does not exist.
+				return &database.SigningKey{}, nil
+			}
+			return nil, err
+		}
+		return key, nil
+	}); err != nil {
+		return nil, fmt.Errorf("failed to find signing key: %w", err)
+	}
+	if signingKey.ID == 0 {
+		return nil, errUnknownKID
+	}
+
+	realm, err := c.db.FindRealm(signingKey.RealmID)
+	if err != nil {
+		if database.IsNotFound(err) {
+			return nil, errUnknownKID
+		}
+		return nil, fmt.Errorf("failed to find realm: %w", err)
+	}
+
+	pub, err := c.pubKeyCache.GetPublicKey(ctx, signingKey.KeyID, c.kms)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get public key: %w", err)
+	}
+
+	return &verificationKey{
+		publicKey: pub,
+		algorithm: signingKey.SigningAlgorithm(),
+		issuer:    realm.CertificateIssuer,
+		audience:  realm.CertificateAudience,
+		realm:     realm,
+	}, nil
+}
+
+// hmacEqual compares two base64-encoded HMACs in constant time.
+func hmacEqual(a, b string) bool {
+	ab, err := base64util.DecodeString(a)
+	if err != nil {
+		return false
+	}
+	bb, err := base64util.DecodeString(b)
+	if err != nil {
+		return false
+	}
+	return subtle.ConstantTimeCompare(ab, bb) == 1
+}
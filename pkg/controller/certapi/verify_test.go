@@ -0,0 +1,251 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package certapi
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/google/exposure-notifications-server/pkg/keys"
+	"github.com/google/exposure-notifications-verification-server/pkg/api"
+	"github.com/google/exposure-notifications-verification-server/pkg/cache"
+	"github.com/google/exposure-notifications-verification-server/pkg/config"
+	"github.com/google/exposure-notifications-verification-server/pkg/jwthelper"
+	"github.com/google/exposure-notifications-verification-server/pkg/keyutils"
+	"github.com/jinzhu/gorm"
+
+	verifyapi "github.com/google/exposure-notifications-server/pkg/api/v1"
+)
+
+func TestVerifyCertificate(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	kms := keys.TestKeyManager(t)
+	skm, ok := kms.(keys.SigningKeyManager)
+	if !ok {
+		t.Fatal("kms cannot manage signing keys")
+	}
+	parent, err := skm.CreateSigningKey(ctx, "system", "certificate-signing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	version, err := skm.CreateKeyVersion(ctx, parent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := kms.NewSigner(ctx, version)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cacher, err := cache.NewInMemory(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubKeyCache, err := keyutils.NewPublicKeyCache(ctx, cacher, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := &Controller{
+		config: &config.APIServerConfig{
+			CertificateSigning: config.CertificateSigningConfig{
+				CertificateSigningKey:   version,
+				CertificateSigningKeyID: "v1",
+				CertificateIssuer:       "iss",
+				CertificateAudience:     "aud",
+			},
+		},
+		cacher:      cacher,
+		pubKeyCache: pubKeyCache,
+		kms:         kms,
+	}
+
+	mac := sha256.Sum256([]byte("teks"))
+	hmac := base64.StdEncoding.EncodeToString(mac[:])
+	otherMAC := sha256.Sum256([]byte("other"))
+	otherHMAC := base64.StdEncoding.EncodeToString(otherMAC[:])
+
+	now := time.Now().UTC()
+	sign := func(tb testing.TB, method jwt.SigningMethod, kid string, fn func(c *verifyapi.VerificationClaims)) string {
+		tb.Helper()
+
+		claims := verifyapi.NewVerificationClaims()
+		claims.ReportType = verifyapi.ReportTypeConfirmed
+		claims.SymptomOnsetInterval = 2650000
+		claims.SignedMAC = hmac
+		claims.Audience = "aud"
+		claims.Issuer = "iss"
+		claims.IssuedAt = now.Unix()
+		claims.ExpiresAt = now.Add(15 * time.Minute).Unix()
+		claims.NotBefore = now.Add(-1 * time.Second).Unix()
+		if fn != nil {
+			fn(claims)
+		}
+
+		token := jwt.NewWithClaims(method, claims)
+		token.Header[verifyapi.KeyIDHeader] = kid
+		s, err := jwthelper.SignJWT(token, signer)
+		if err != nil {
+			tb.Fatal(err)
+		}
+		return s
+	}
+
+	valid := sign(t, jwt.SigningMethodES256, "v1", nil)
+
+	cases := []struct {
+		name  string
+		cert  string
+		hmac  string
+		valid bool
+		code  string
+	}{
+		{
+			name:  "valid",
+			cert:  valid,
+			valid: true,
+		},
+		{
+			name:  "valid_hmac",
+			cert:  valid,
+			hmac:  hmac,
+			valid: true,
+		},
+		{
+			name: "hmac_mismatch",
+			cert: valid,
+			hmac: otherHMAC,
+			code: api.ErrCertificateHMACMismatch,
+		},
+		{
+			name: "not_jwt",
+			cert: "banana",
+			code: api.ErrCertificateInvalid,
+		},
+		{
+			name: "missing_kid",
+			cert: sign(t, jwt.SigningMethodES256, "", nil),
+			code: api.ErrCertificateInvalid,
+		},
+		{
+			name: "tampered",
+			cert: valid[:len(valid)-4] + "AAAA",
+			code: api.ErrCertificateInvalid,
+		},
+		{
+			name: "expired",
+			cert: sign(t, jwt.SigningMethodES256, "v1", func(c *verifyapi.VerificationClaims) {
+				c.IssuedAt = now.Add(-1 * time.Hour).Unix()
+				c.NotBefore = now.Add(-1 * time.Hour).Unix()
+				c.ExpiresAt = now.Add(-30 * time.Minute).Unix()
+			}),
+			code: api.ErrCertificateExpired,
+		},
+		{
+			name: "wrong_audience",
+			cert: sign(t, jwt.SigningMethodES256, "v1", func(c *verifyapi.VerificationClaims) {
+				c.Audience = "nope"
+			}),
+			code: api.ErrCertificateInvalid,
+		},
+		{
+			name: "wrong_algorithm",
+			cert: sign(t, jwt.SigningMethodES384, "v1", nil),
+			code: api.ErrCertificateInvalid,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			resp, err := c.verifyCertificate(ctx, tc.cert, tc.hmac)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, want := resp.Valid, tc.valid; got != want {
+				t.Errorf("expected valid to be %t, got %t (%s)", want, got, resp.Error)
+			}
+			if got, want := resp.ErrorCode, tc.code; got != want {
+				t.Errorf("expected code %q to be %q", got, want)
+			}
+			if tc.valid {
+				if got, want := resp.KeyID, "v1"; got != want {
+					t.Errorf("expected kid %q to be %q", got, want)
+				}
+				if got, want := resp.ReportType, verifyapi.ReportTypeConfirmed; got != want {
+					t.Errorf("expected report type %q to be %q", got, want)
+				}
+				if got, want := resp.SymptomOnsetInterval, uint32(2650000); got != want {
+					t.Errorf("expected symptom onset %d to be %d", got, want)
+				}
+				if got, want := resp.RealmID, uint(0); got != want {
+					t.Errorf("expected realm %d to be %d", got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestVerificationKey_UnknownKID(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	db, _ := testDatabaseInstance.NewDatabase(t, nil)
+
+	var lookups int32
+	db.RawDB().Callback().Query().After("gorm:query").Register("test:count_signing_keys", func(scope *gorm.Scope) {
+		if scope.TableName() == "signing_keys" {
+			atomic.AddInt32(&lookups, 1)
+		}
+	})
+
+	cacher, err := cache.NewInMemory(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := &Controller{
+		config: &config.APIServerConfig{
+			CertificateSigning: config.CertificateSigningConfig{
+				CertificateSigningKeyID: "v1",
+				PublicKeyCacheDuration:  time.Minute,
+			},
+		},
+		db:     db,
+		cacher: cacher,
+	}
+
+	// The second lookup is answered from the cache.
+	for i := 0; i < 2; i++ {
+		if _, err := c.verificationKey(ctx, "r1v999999"); !errors.Is(err, errUnknownKID) {
+			t.Fatalf("expected %v to be %v", err, errUnknownKID)
+		}
+	}
+	if got, want := atomic.LoadInt32(&lookups), int32(1); got != want {
+		t.Errorf("expected %d signing key lookups, got %d", want, got)
+	}
+}
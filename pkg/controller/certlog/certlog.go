@@ -0,0 +1,76 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package certlog serves the certificate transparency log, which records every
+// issued verification certificate in an append-only Merkle tree.
+package certlog
+
+import (
+	"context"
+	"encoding/base64"
+
+	"github.com/google/exposure-notifications-verification-server/pkg/api"
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+	"github.com/google/exposure-notifications-verification-server/pkg/render"
+)
+
+// Controller serves inclusion proofs and exports of the certificate
+// transparency log.
+type Controller struct {
+	db *database.Database
+	h  render.Renderer
+}
+
+// New creates a new certificate log controller.
+func New(ctx context.Context, db *database.Database, h render.Renderer) *Controller {
+	return &Controller{
+		db: db,
+		h:  h,
+	}
+}
+
+// treeHeadResponse converts the signed tree head to its API representation.
+func treeHeadResponse(sth *database.CertificateLogTreeHead) *api.CertificateLogTreeHead {
+	return &api.CertificateLogTreeHead{
+		TreeSize:  sth.TreeSize,
+		RootHash:  base64.StdEncoding.EncodeToString(sth.RootHash),
+		Timestamp: sth.Timestamp.Unix(),
+		KeyID:     sth.KeyID,
+		Algorithm: sth.Algorithm,
+		PublicKey: sth.PublicKey,
+		Signature: sth.Signature,
+	}
+}
+
+// entryResponse converts the log entry to its API representation.
+func entryResponse(entry *database.CertificateLogEntry) (*api.CertificateLogEntry, error) {
+	data, err := entry.LeafData()
+	if err != nil {
+		return nil, err
+	}
+	hash, err := entry.LeafHash()
+	if err != nil {
+		return nil, err
+	}
+
+	var index int64
+	if entry.LeafIndex != nil {
+		index = *entry.LeafIndex
+	}
+	return &api.CertificateLogEntry{
+		LeafIndex: index,
+		LeafHash:  base64.StdEncoding.EncodeToString(hash),
+		LeafData:  string(data),
+	}, nil
+}
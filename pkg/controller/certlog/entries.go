@@ -0,0 +1,139 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package certlog
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/google/exposure-notifications-server/pkg/logging"
+	"github.com/google/exposure-notifications-verification-server/pkg/api"
+	"github.com/google/exposure-notifications-verification-server/pkg/controller"
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+)
+
+const (
+	defaultEntriesLimit = 1000
+	maxEntriesLimit     = 10000
+)
+
+// HandleEntries exports a page of sequenced log entries for auditors. Only
+// entries covered by the latest signed tree head are returned, so auditors can
+// rebuild the tree and compare it to the returned tree head. Pages are selected
+// with the "start" and "limit" query parameters.
+//
+// Every entry includes its leaf hash, but the leaf data is only included for
+// entries in the API key's realm, so realms cannot see each other's
+// certificates.
+func (c *Controller) HandleEntries() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		logger := logging.FromContext(ctx).Named("certlog.HandleEntries")
+
+		authApp := controller.AuthorizedAppFromContext(ctx)
+		if authApp == nil {
+			controller.MissingAuthorizedApp(w, r, c.h)
+			return
+		}
+
+		start, err := parseQueryInt(r, "start", 0)
+		if err != nil || start < 0 {
+			c.h.RenderJSON(w, http.StatusBadRequest, api.Errorf("invalid start"))
+			return
+		}
+		limit, err := parseQueryInt(r, "limit", defaultEntriesLimit)
+		if err != nil || limit < 1 || limit > maxEntriesLimit {
+			c.h.RenderJSON(w, http.StatusBadRequest, api.Errorf("limit must be between 1 and %d", maxEntriesLimit))
+			return
+		}
+
+		sth, err := c.db.LatestCertificateLogTreeHead()
+		if err != nil {
+			if database.IsNotFound(err) {
+				c.h.RenderJSON(w, http.StatusOK, &api.CertificateLogEntriesResponse{
+					Entries: []*api.CertificateLogEntry{},
+				})
+				return
+			}
+			logger.Errorw("failed to find tree head", "error", err)
+			c.h.RenderJSON(w, http.StatusInternalServerError, api.InternalError())
+			return
+		}
+
+		if remaining := sth.TreeSize - start; remaining < limit {
+			limit = remaining
+		}
+
+		resp := &api.CertificateLogEntriesResponse{
+			Entries:  make([]*api.CertificateLogEntry, 0, limit),
+			TreeHead: treeHeadResponse(sth),
+		}
+
+		if limit > 0 {
+			entries, err := c.db.ListCertificateLogEntries(start, uint(limit))
+			if err != nil {
+				logger.Errorw("failed to list log entries", "error", err)
+				c.h.RenderJSON(w, http.StatusInternalServerError, api.InternalError())
+				return
+			}
+
+			for _, entry := range entries {
+				e, err := entryResponse(entry)
+				if err != nil {
+					logger.Errorw("failed to encode log entry", "error", err)
+					c.h.RenderJSON(w, http.StatusInternalServerError, api.InternalError())
+					return
+				}
+				if entry.RealmID != authApp.RealmID {
+					e.LeafData = ""
+				}
+				resp.Entries = append(resp.Entries, e)
+			}
+		}
+
+		c.h.RenderJSON(w, http.StatusOK, resp)
+	})
+}
+
+// HandleTreeHead returns the latest signed tree head.
+func (c *Controller) HandleTreeHead() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		logger := logging.FromContext(ctx).Named("certlog.HandleTreeHead")
+
+		sth, err := c.db.LatestCertificateLogTreeHead()
+		if err != nil {
+			if database.IsNotFound(err) {
+				c.h.RenderJSON(w, http.StatusNotFound, api.Errorf("no signed tree head"))
+				return
+			}
+			logger.Errorw("failed to find tree head", "error", err)
+			c.h.RenderJSON(w, http.StatusInternalServerError, api.InternalError())
+			return
+		}
+
+		c.h.RenderJSON(w, http.StatusOK, treeHeadResponse(sth))
+	})
+}
+
+// parseQueryInt parses the named query parameter, returning def if it is not
+// set.
+func parseQueryInt(r *http.Request, name string, def int64) (int64, error) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return def, nil
+	}
+	return strconv.ParseInt(v, 10, 64)
+}
@@ -0,0 +1,95 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package certlog
+
+import (
+	"encoding/base64"
+	"net/http"
+
+	"github.com/google/exposure-notifications-server/pkg/logging"
+	"github.com/google/exposure-notifications-verification-server/pkg/api"
+	"github.com/google/exposure-notifications-verification-server/pkg/controller"
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+)
+
+// HandleProof returns an inclusion proof for the most recent certificate the
+// realm issued for the given HMAC, against the latest signed tree head.
+func (c *Controller) HandleProof() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		logger := logging.FromContext(ctx).Named("certlog.HandleProof")
+
+		authApp := controller.AuthorizedAppFromContext(ctx)
+		if authApp == nil {
+			controller.MissingAuthorizedApp(w, r, c.h)
+			return
+		}
+
+		var request api.CertificateLogProofRequest
+		if err := controller.BindJSON(w, r, &request); err != nil {
+			c.h.RenderJSON(w, http.StatusBadRequest, api.Error(err))
+			return
+		}
+
+		entry, err := c.db.FindCertificateLogEntry(authApp.RealmID, request.ExposureKeyHMAC)
+		if err != nil {
+			if database.IsNotFound(err) {
+				c.h.RenderJSON(w, http.StatusNotFound,
+					api.Errorf("no certificate logged for hmac").WithCode(api.ErrCertificateLogEntryNotFound))
+				return
+			}
+			logger.Errorw("failed to find log entry", "error", err)
+			c.h.RenderJSON(w, http.StatusInternalServerError, api.InternalError())
+			return
+		}
+
+		sth, err := c.db.LatestCertificateLogTreeHead()
+		if err != nil && !database.IsNotFound(err) {
+			logger.Errorw("failed to find tree head", "error", err)
+			c.h.RenderJSON(w, http.StatusInternalServerError, api.InternalError())
+			return
+		}
+		if sth == nil || entry.LeafIndex == nil || *entry.LeafIndex >= sth.TreeSize {
+			c.h.RenderJSON(w, http.StatusAccepted,
+				api.Errorf("certificate is not yet included in a signed tree head").WithCode(api.ErrCertificateLogEntryPending))
+			return
+		}
+
+		proof, err := c.db.CertificateLogInclusionProof(*entry.LeafIndex, sth.TreeSize)
+		if err != nil {
+			logger.Errorw("failed to build inclusion proof", "error", err)
+			c.h.RenderJSON(w, http.StatusInternalServerError, api.InternalError())
+			return
+		}
+
+		resp, err := entryResponse(entry)
+		if err != nil {
+			logger.Errorw("failed to encode log entry", "error", err)
+			c.h.RenderJSON(w, http.StatusInternalServerError, api.InternalError())
+			return
+		}
+
+		path := make([]string, 0, len(proof))
+		for _, h := range proof {
+			path = append(path, base64.StdEncoding.EncodeToString(h))
+		}
+
+		c.h.RenderJSON(w, http.StatusOK, &api.CertificateLogProofResponse{
+			Entry:     resp,
+			AuditPath: path,
+			TreeHead:  treeHeadResponse(sth),
+		})
+	})
+}
@@ -0,0 +1,160 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package certlog
+
+import (
+	"context"
+	"crypto"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/google/exposure-notifications-server/pkg/keys"
+	"github.com/google/exposure-notifications-server/pkg/logging"
+	"github.com/google/exposure-notifications-verification-server/pkg/config"
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+	"github.com/google/exposure-notifications-verification-server/pkg/jwthelper"
+	"github.com/google/exposure-notifications-verification-server/pkg/keyutils"
+	"github.com/google/exposure-notifications-verification-server/pkg/render"
+)
+
+// TreeHeadClaims are the claims of a signed tree head JWS. RootHash is the
+// base64 encoded RFC 6962 root hash of the first TreeSize entries. The time of
+// the tree head is the 'iat' claim.
+type TreeHeadClaims struct {
+	TreeSize int64  `json:"treeSize"`
+	RootHash string `json:"rootHash"`
+	jwt.StandardClaims
+}
+
+// Sequencer periodically incorporates new entries into the certificate
+// transparency log and signs the new tree head.
+type Sequencer struct {
+	config *config.CertificateLogConfig
+	db     *database.Database
+	kms    keys.KeyManager
+	h      render.Renderer
+}
+
+// NewSequencer creates a new certificate log sequencer.
+func NewSequencer(ctx context.Context, config *config.CertificateLogConfig, db *database.Database, kms keys.KeyManager, h render.Renderer) *Sequencer {
+	return &Sequencer{
+		config: config,
+		db:     db,
+		kms:    kms,
+		h:      h,
+	}
+}
+
+// HandleSequence accepts an HTTP trigger, sequences pending log entries, and
+// signs a new tree head. If the tree did not grow since the latest tree head,
+// no new tree head is signed.
+func (s *Sequencer) HandleSequence() http.Handler {
+	type SequenceResult struct {
+		OK       bool   `json:"ok"`
+		TreeSize int64  `json:"treeSize,omitempty"`
+		Error    string `json:"error,omitempty"`
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		logger := logging.FromContext(ctx).Named("certlog.HandleSequence")
+
+		size, err := s.db.SequenceCertificateLog(s.config.BatchSize)
+		if err != nil {
+			logger.Errorw("failed to sequence certificate log", "error", err)
+			s.h.RenderJSON(w, http.StatusInternalServerError, &SequenceResult{Error: err.Error()})
+			return
+		}
+
+		latest, err := s.db.LatestCertificateLogTreeHead()
+		if err != nil && !database.IsNotFound(err) {
+			logger.Errorw("failed to find latest tree head", "error", err)
+			s.h.RenderJSON(w, http.StatusInternalServerError, &SequenceResult{Error: err.Error()})
+			return
+		}
+		if latest != nil && latest.TreeSize == size {
+			logger.Debugw("certificate log did not grow", "size", size)
+			s.h.RenderJSON(w, http.StatusOK, &SequenceResult{OK: true, TreeSize: size})
+			return
+		}
+
+		root, err := s.db.CertificateLogRootHash(size)
+		if err != nil {
+			logger.Errorw("failed to compute root hash", "error", err)
+			s.h.RenderJSON(w, http.StatusInternalServerError, &SequenceResult{Error: err.Error()})
+			return
+		}
+
+		signer, err := s.kms.NewSigner(ctx, s.config.SigningKey)
+		if err != nil {
+			logger.Errorw("failed to get tree head signer", "error", err)
+			s.h.RenderJSON(w, http.StatusInternalServerError, &SequenceResult{Error: err.Error()})
+			return
+		}
+
+		sth, err := signTreeHead(signer, s.config.SigningKeyID, size, root, time.Now().UTC())
+		if err != nil {
+			logger.Errorw("failed to sign tree head", "error", err)
+			s.h.RenderJSON(w, http.StatusInternalServerError, &SequenceResult{Error: err.Error()})
+			return
+		}
+
+		if err := s.db.SaveCertificateLogTreeHead(sth); err != nil {
+			logger.Errorw("failed to save tree head", "error", err)
+			s.h.RenderJSON(w, http.StatusInternalServerError, &SequenceResult{Error: err.Error()})
+			return
+		}
+
+		logger.Infow("signed certificate log tree head", "size", size)
+		s.h.RenderJSON(w, http.StatusOK, &SequenceResult{OK: true, TreeSize: size})
+	})
+}
+
+// signTreeHead builds and signs the tree head for the given size and root.
+func signTreeHead(signer crypto.Signer, kid string, size int64, root []byte, now time.Time) (*database.CertificateLogTreeHead, error) {
+	publicKey, alg, err := keyutils.EncodePublicKey(signer.Public())
+	if err != nil {
+		return nil, fmt.Errorf("unsupported tree head signing key: %w", err)
+	}
+
+	now = now.Truncate(time.Second)
+	claims := &TreeHeadClaims{
+		TreeSize: size,
+		RootHash: base64.StdEncoding.EncodeToString(root),
+		StandardClaims: jwt.StandardClaims{
+			IssuedAt: now.Unix(),
+		},
+	}
+
+	token := jwt.NewWithClaims(alg.SigningMethod(), claims)
+	token.Header["kid"] = kid
+	signature, err := jwthelper.SignJWT(token, signer)
+	if err != nil {
+		return nil, err
+	}
+
+	return &database.CertificateLogTreeHead{
+		TreeSize:  size,
+		RootHash:  root,
+		Timestamp: now,
+		KeyID:     kid,
+		Algorithm: string(alg),
+		PublicKey: publicKey,
+		Signature: signature,
+	}, nil
+}
@@ -0,0 +1,86 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package certlog
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+func TestSignTreeHead(t *testing.T) {
+	t.Parallel()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	root := bytes.Repeat([]byte{0xab}, 32)
+	now := time.Date(2020, 12, 1, 10, 30, 15, 500, time.UTC)
+
+	sth, err := signTreeHead(key, "v1", 42, root, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := sth.TreeSize, int64(42); got != want {
+		t.Errorf("expected %d to be %d", got, want)
+	}
+	if got, want := sth.Algorithm, "ES256"; got != want {
+		t.Errorf("expected %q to be %q", got, want)
+	}
+	if got, want := sth.Timestamp, now.Truncate(time.Second); !got.Equal(want) {
+		t.Errorf("expected %v to be %v", got, want)
+	}
+
+	// Auditors verify the signature with the published public key.
+	block, _ := pem.Decode([]byte(sth.PublicKey))
+	if block == nil {
+		t.Fatal("failed to decode public key")
+	}
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var claims TreeHeadClaims
+	token, err := jwt.ParseWithClaims(sth.Signature, &claims, func(token *jwt.Token) (interface{}, error) {
+		return pub, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := token.Header["kid"], "v1"; got != want {
+		t.Errorf("expected %v to be %v", got, want)
+	}
+	if got, want := claims.TreeSize, int64(42); got != want {
+		t.Errorf("expected %d to be %d", got, want)
+	}
+	if got, want := claims.RootHash, "q6urq6urq6urq6urq6urq6urq6urq6urq6urq6urq6s="; got != want {
+		t.Errorf("expected %q to be %q", got, want)
+	}
+	if got, want := claims.IssuedAt, now.Unix(); got != want {
+		t.Errorf("expected %d to be %d", got, want)
+	}
+}
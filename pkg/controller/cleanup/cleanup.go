@@ -19,9 +19,12 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/google/exposure-notifications-server/pkg/logging"
+	"github.com/google/exposure-notifications-verification-server/pkg/auditsink"
 	"github.com/google/exposure-notifications-verification-server/pkg/config"
 	"github.com/google/exposure-notifications-verification-server/pkg/database"
 	"github.com/google/exposure-notifications-verification-server/pkg/observability"
@@ -36,14 +39,39 @@ type Controller struct {
 	config *config.CleanupConfig
 	db     *database.Database
 	h      render.Renderer
+
+	// auditSigner signs truncation markers when audit entries are purged. It is
+	// nil if audit chain signing is not configured, in which case chained audit
+	// entries are not purged.
+	auditSigner *database.AuditChainSigner
+
+	// auditDispatcher delivers audit entries to external sinks before they are
+	// purged. It is nil if no sinks are configured.
+	auditDispatcher *auditsink.Dispatcher
 }
 
 // New creates a new cleanup controller.
 func New(ctx context.Context, config *config.CleanupConfig, db *database.Database, h render.Renderer) (*Controller, error) {
+	auditSigner, err := config.AuditChain.Signer(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var auditDispatcher *auditsink.Dispatcher
+	if config.AuditSinks.Enabled() {
+		sinks, err := auditsink.SinksFor(ctx, &config.AuditSinks)
+		if err != nil {
+			return nil, err
+		}
+		auditDispatcher = auditsink.NewDispatcher(&config.AuditSinks, db, sinks)
+	}
+
 	return &Controller{
-		config: config,
-		db:     db,
-		h:      h,
+		config:          config,
+		db:              db,
+		h:               h,
+		auditSigner:     auditSigner,
+		auditDispatcher: auditDispatcher,
 	}, nil
 }
 
@@ -66,10 +94,19 @@ func (c *Controller) shouldCleanup(ctx context.Context) error {
 	return nil
 }
 
+// purgeStep is a single step of a cleanup run.
+type purgeStep struct {
+	// item is the metric tag value and the key of the step's progress.
+	item string
+	fn   func(ctx context.Context, opts *database.PurgeOptions) (*database.PurgeResult, error)
+}
+
 func (c *Controller) HandleCleanup() http.Handler {
 	type CleanupResult struct {
-		OK     bool    `json:"ok"`
-		Errors []error `json:"errors,omitempty"`
+		OK      bool                             `json:"ok"`
+		DryRun  bool                             `json:"dryRun,omitempty"`
+		Results map[string]*database.PurgeResult `json:"results,omitempty"`
+		Errors  []error                          `json:"errors,omitempty"`
 	}
 
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -77,128 +114,249 @@ func (c *Controller) HandleCleanup() http.Handler {
 
 		logger := logging.FromContext(ctx).Named("cleanup.HandleCleanup")
 
-		var result, item tag.Mutator
+		dryRun := c.config.DryRun
+		if v := r.FormValue("dry_run"); v != "" {
+			parsed, err := strconv.ParseBool(v)
+			if err != nil {
+				c.h.RenderJSON(w, http.StatusBadRequest, &CleanupResult{
+					OK:     false,
+					Errors: []error{fmt.Errorf("invalid dry_run %q: %w", v, err)},
+				})
+				return
+			}
+			dryRun = dryRun || parsed
+		}
 
-		if err := c.shouldCleanup(ctx); err != nil {
-			logger.Errorw("failed to run shouldCleanup", "error", err)
-			c.h.RenderJSON(w, http.StatusInternalServerError, &CleanupResult{
-				OK:     false,
-				Errors: []error{err},
-			})
-			return
+		// A dry run does not modify any data, so it does not need to claim the
+		// cleanup or record progress.
+		if !dryRun {
+			if err := c.shouldCleanup(ctx); err != nil {
+				logger.Errorw("failed to run shouldCleanup", "error", err)
+				c.h.RenderJSON(w, http.StatusInternalServerError, &CleanupResult{
+					OK:     false,
+					Errors: []error{err},
+				})
+				return
+			}
+
+			if err := c.db.StartCleanupRun(database.CleanupName); err != nil {
+				logger.Errorw("failed to record cleanup start", "error", err)
+			}
 		}
 
 		// Construct a multi-error. If one of the purges fails, we still want to
 		// attempt the other purges.
 		var merr *multierror.Error
 
+		// Realm-level retention overrides. If these cannot be loaded, skip the
+		// realm-scoped purges rather than apply the defaults to every realm.
+		codeOverrides, auditOverrides, accessOverrides, err := c.retentionOverrides()
+		if err != nil {
+			merr = multierror.Append(merr, fmt.Errorf("failed to load retention overrides: %w", err))
+		}
+
+		var steps []*purgeStep
+
 		// API keys
-		func() {
-			defer observability.RecordLatency(ctx, time.Now(), mLatencyMs, &result, &item)
-			item = tag.Upsert(itemTagKey, "API_KEYS")
-			if count, err := c.db.PurgeAuthorizedApps(c.config.AuthorizedAppMaxAge); err != nil {
-				merr = multierror.Append(merr, fmt.Errorf("failed to purge authorized apps: %w", err))
-				result = observability.ResultError("FAILED")
-			} else {
-				logger.Infow("purged authorized apps", "count", count)
-				result = observability.ResultOK()
-			}
-		}()
+		steps = append(steps, &purgeStep{
+			item: "API_KEYS",
+			fn: func(ctx context.Context, opts *database.PurgeOptions) (*database.PurgeResult, error) {
+				return c.db.PurgeAuthorizedApps(ctx, c.config.AuthorizedAppMaxAge, opts)
+			},
+		})
 
 		// Verification codes - purge codes from database entirely.
 		// Their code/long_code hmac values will have been set to "".
-		func() {
-			defer observability.RecordLatency(ctx, time.Now(), mLatencyMs, &result, &item)
-			item = tag.Upsert(itemTagKey, "VERIFICATION_CODE")
-			if count, err := c.db.PurgeVerificationCodes(c.config.VerificationCodeStatusMaxAge); err != nil {
-				merr = multierror.Append(merr, fmt.Errorf("failed to purge verification codes: %w", err))
-				result = observability.ResultError("FAILED")
-			} else {
-				logger.Infow("purged verification codes", "count", count)
-				result = observability.ResultOK()
-			}
-		}()
+		if codeOverrides != nil {
+			steps = append(steps, &purgeStep{
+				item: "VERIFICATION_CODE",
+				fn: func(ctx context.Context, opts *database.PurgeOptions) (*database.PurgeResult, error) {
+					return c.db.PurgeVerificationCodes(ctx, c.config.Retention.VerificationCodeStatusMaxAge, codeOverrides, opts)
+				},
+			})
+		}
 
 		// Verification codes - recycle codes. Zero out the code/long_code values
 		// so status can be reported, but codes couldn't be recalculated or checked.
-		func() {
-			defer observability.RecordLatency(ctx, time.Now(), mLatencyMs, &result, &item)
-			item = tag.Upsert(itemTagKey, "VERIFICATION_CODE_RECYCLE")
-			if count, err := c.db.RecycleVerificationCodes(c.config.VerificationCodeMaxAge); err != nil {
-				merr = multierror.Append(merr, fmt.Errorf("failed to purge verification codes: %w", err))
-				result = observability.ResultError("FAILED")
-			} else {
-				logger.Infow("recycled verification codes", "count", count)
-				result = observability.ResultOK()
-			}
-		}()
+		steps = append(steps, &purgeStep{
+			item: "VERIFICATION_CODE_RECYCLE",
+			fn: func(ctx context.Context, opts *database.PurgeOptions) (*database.PurgeResult, error) {
+				return c.db.RecycleVerificationCodes(ctx, c.config.VerificationCodeMaxAge, opts)
+			},
+		})
 
 		// Verification tokens
-		func() {
-			defer observability.RecordLatency(ctx, time.Now(), mLatencyMs, &result, &item)
-			item = tag.Upsert(itemTagKey, "VERIFICATION_TOKEN")
-			if count, err := c.db.PurgeTokens(c.config.VerificationTokenMaxAge); err != nil {
-				result = observability.ResultError("FAILED")
-				merr = multierror.Append(merr, fmt.Errorf("failed to purge tokens: %w", err))
-			} else {
-				logger.Infow("purged verification tokens", "count", count)
-				result = observability.ResultOK()
-			}
-		}()
+		steps = append(steps, &purgeStep{
+			item: "VERIFICATION_TOKEN",
+			fn: func(ctx context.Context, opts *database.PurgeOptions) (*database.PurgeResult, error) {
+				return c.db.PurgeTokens(ctx, c.config.VerificationTokenMaxAge, opts)
+			},
+		})
 
 		// Mobile apps
-		func() {
-			defer observability.RecordLatency(ctx, time.Now(), mLatencyMs, &result, &item)
-			item = tag.Upsert(itemTagKey, "MOBILE_APP")
-			if count, err := c.db.PurgeMobileApps(c.config.MobileAppMaxAge); err != nil {
-				merr = multierror.Append(merr, fmt.Errorf("failed to purge mobile apps: %w", err))
-				result = observability.ResultError("FAILED")
-			} else {
-				logger.Infow("purged mobile apps", "count", count)
-				result = observability.ResultOK()
-			}
-		}()
+		steps = append(steps, &purgeStep{
+			item: "MOBILE_APP",
+			fn: func(ctx context.Context, opts *database.PurgeOptions) (*database.PurgeResult, error) {
+				return c.db.PurgeMobileApps(ctx, c.config.MobileAppMaxAge, opts)
+			},
+		})
 
 		// Audit entries
-		func() {
-			defer observability.RecordLatency(ctx, time.Now(), mLatencyMs, &result, &item)
-			item = tag.Upsert(itemTagKey, "AUDIT_ENTRY")
-			if count, err := c.db.PurgeAuditEntries(c.config.AuditEntryMaxAge); err != nil {
-				merr = multierror.Append(merr, fmt.Errorf("failed to purge audit entries: %w", err))
-				result = observability.ResultError("FAILED")
-			} else {
-				logger.Infow("purged audit entries", "count", count)
-				result = observability.ResultOK()
-			}
-		}()
+		if auditOverrides != nil {
+			steps = append(steps, &purgeStep{
+				item: "AUDIT_ENTRY",
+				fn: func(ctx context.Context, opts *database.PurgeOptions) (*database.PurgeResult, error) {
+					// Deliver entries to the sinks first, so they are not purged before
+					// they are delivered.
+					if c.auditDispatcher != nil && !opts.DryRun {
+						if err := c.auditDispatcher.Flush(ctx); err != nil {
+							return nil, fmt.Errorf("failed to deliver audit entries before purging: %w", err)
+						}
+					}
+					return c.db.PurgeAuditEntries(ctx, c.config.Retention.AuditEntryMaxAge, auditOverrides, c.auditSigner, opts)
+				},
+			})
+		}
+
+		// Access entries
+		if accessOverrides != nil {
+			steps = append(steps, &purgeStep{
+				item: "ACCESS_ENTRY",
+				fn: func(ctx context.Context, opts *database.PurgeOptions) (*database.PurgeResult, error) {
+					return c.db.PurgeAccessEntries(ctx, c.config.Retention.AccessEntryMaxAge, accessOverrides, opts)
+				},
+			})
+		}
 
 		// Users
-		func() {
-			defer observability.RecordLatency(ctx, time.Now(), mLatencyMs, &result, &item)
-			item = tag.Upsert(itemTagKey, "USER")
-			if count, err := c.db.PurgeUsers(c.config.UserPurgeMaxAge); err != nil {
-				merr = multierror.Append(merr, fmt.Errorf("failed to purge users: %w", err))
-				result = observability.ResultError("FAILED")
-			} else {
-				logger.Infow("purged user entries", "count", count)
-				result = observability.ResultOK()
+		steps = append(steps, &purgeStep{
+			item: "USER",
+			fn: func(ctx context.Context, opts *database.PurgeOptions) (*database.PurgeResult, error) {
+				return c.db.PurgeUsers(ctx, c.config.UserPurgeMaxAge, opts)
+			},
+		})
+
+		results := make(map[string]*database.PurgeResult, len(steps))
+		for _, step := range steps {
+			result, err := c.runStep(ctx, step, dryRun)
+			if result != nil {
+				results[step.item] = result
+			}
+			if err != nil {
+				merr = multierror.Append(merr, fmt.Errorf("failed to purge %s: %w", strings.ToLower(step.item), err))
 			}
-		}()
+		}
+
+		if !dryRun {
+			if err := c.db.CompleteCleanupRun(database.CleanupName); err != nil {
+				logger.Errorw("failed to record cleanup completion", "error", err)
+			}
+		}
 
 		// If there are any errors, return them
 		if merr != nil {
 			if errs := merr.WrappedErrors(); len(errs) > 0 {
 				logger.Errorw("failed to cleanup", "errors", errs)
 				c.h.RenderJSON(w, http.StatusInternalServerError, &CleanupResult{
-					OK:     false,
-					Errors: errs,
+					OK:      false,
+					DryRun:  dryRun,
+					Results: results,
+					Errors:  errs,
 				})
 				return
 			}
 		}
 
 		c.h.RenderJSON(w, http.StatusOK, &CleanupResult{
-			OK: true,
+			OK:      true,
+			DryRun:  dryRun,
+			Results: results,
 		})
 	})
 }
+
+// runStep runs a single purge step, recording its latency, metrics and
+// progress.
+func (c *Controller) runStep(ctx context.Context, step *purgeStep, dryRun bool) (*database.PurgeResult, error) {
+	logger := logging.FromContext(ctx).Named("cleanup.runStep").With("item", step.item)
+
+	var result, item tag.Mutator
+	defer observability.RecordLatency(ctx, time.Now(), mLatencyMs, &result, &item)
+	item = tag.Upsert(itemTagKey, step.item)
+
+	status := &database.CleanupStepStatus{
+		DryRun:    dryRun,
+		StartedAt: time.Now().UTC(),
+	}
+	saveProgress := func(pr *database.PurgeResult) {
+		if dryRun {
+			return
+		}
+		status.Table = pr.Table
+		status.Count = pr.Count
+		status.Batches = pr.Batches
+		status.Realms = pr.Realms
+		if err := c.db.SaveCleanupProgress(database.CleanupName, step.item, status); err != nil {
+			logger.Errorw("failed to save cleanup progress", "error", err)
+		}
+	}
+
+	opts := &database.PurgeOptions{
+		BatchSize:  c.config.PurgeBatchSize,
+		BatchSleep: c.config.PurgeBatchSleep,
+		DryRun:     dryRun,
+		OnBatch:    saveProgress,
+	}
+
+	pr, err := step.fn(ctx, opts)
+
+	now := time.Now().UTC()
+	status.CompletedAt = &now
+	if err != nil {
+		status.Error = err.Error()
+	}
+	if pr != nil {
+		saveProgress(pr)
+	}
+
+	if err != nil {
+		result = observability.ResultError("FAILED")
+		return pr, err
+	}
+	result = observability.ResultOK()
+
+	if dryRun {
+		logger.Infow("dry run", "table", pr.Table, "count", pr.Count, "realms", pr.Realms)
+		return pr, nil
+	}
+
+	stats.RecordWithTags(ctx, []tag.Mutator{item}, mPurgedRows.M(pr.Count), mPurgeBatches.M(int64(pr.Batches)))
+	logger.Infow("purged", "table", pr.Table, "count", pr.Count, "batches", pr.Batches)
+	return pr, nil
+}
+
+// retentionOverrides builds the verification code, audit entry, and access
+// entry retention overrides for realms which have them, clamped to the system
+// bounds.
+func (c *Controller) retentionOverrides() (database.RetentionOverrides, database.RetentionOverrides, database.RetentionOverrides, error) {
+	realms, err := c.db.RealmsWithRetentionOverrides()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	codes := make(database.RetentionOverrides, len(realms))
+	audits := make(database.RetentionOverrides, len(realms))
+	access := make(database.RetentionOverrides, len(realms))
+	for _, realm := range realms {
+		if realm.VerificationCodeRetentionDays > 0 {
+			codes[realm.ID] = c.config.Retention.VerificationCodeStatusMaxAgeFor(realm)
+		}
+		if realm.AuditEntryRetentionDays > 0 {
+			audits[realm.ID] = c.config.Retention.AuditEntryMaxAgeFor(realm)
+		}
+		if realm.AccessEntryRetentionDays > 0 {
+			access[realm.ID] = c.config.Retention.AccessEntryMaxAgeFor(realm)
+		}
+	}
+	return codes, audits, access, nil
+}
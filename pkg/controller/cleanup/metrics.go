@@ -29,15 +29,21 @@ const metricPrefix = observability.MetricRoot + "/cleanup"
 var (
 	mLatencyMs     = stats.Float64(metricPrefix+"/requests", "The number of cleanup requests.", stats.UnitMilliseconds)
 	mClaimRequests = stats.Int64(metricPrefix+"/claim_requests", "The number of cleanup claim requests.", stats.UnitDimensionless)
+	mPurgedRows    = stats.Int64(metricPrefix+"/purged_rows", "The number of rows purged.", stats.UnitDimensionless)
+	mPurgeBatches  = stats.Int64(metricPrefix+"/purge_batches", "The number of purge batches.", stats.UnitDimensionless)
 )
 
 var (
 	// itemTagKey indicating what type of items is cleaned up in this step.
 	// Potential values:
+	// API_KEYS
 	// VERIFICATION_CODE
+	// VERIFICATION_CODE_RECYCLE
 	// VERIFICATION_TOKEN
 	// MOBILE_APP
 	// AUDIT_ENTRY
+	// ACCESS_ENTRY
+	// USER
 	itemTagKey = tag.MustNewKey("item")
 )
 
@@ -64,6 +70,20 @@ func init() {
 			TagKeys:     append(observability.CommonTagKeys(), observability.ResultTagKey),
 			Aggregation: view.Count(),
 		},
+		{
+			Name:        metricPrefix + "/purged_rows_count",
+			Measure:     mPurgedRows,
+			Description: "The total number of rows purged",
+			TagKeys:     append(observability.CommonTagKeys(), itemTagKey),
+			Aggregation: view.Sum(),
+		},
+		{
+			Name:        metricPrefix + "/purge_batches_count",
+			Measure:     mPurgeBatches,
+			Description: "The total number of purge batches",
+			TagKeys:     append(observability.CommonTagKeys(), itemTagKey),
+			Aggregation: view.Sum(),
+		},
 	}...)
 
 }
@@ -17,12 +17,15 @@ package codes
 import (
 	"net/http"
 
+	"github.com/google/exposure-notifications-server/pkg/logging"
 	"github.com/google/exposure-notifications-verification-server/pkg/api"
 	"github.com/google/exposure-notifications-verification-server/pkg/controller"
 )
 
 func (c *Controller) HandleCheckCodeStatus() http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logger := logging.FromContext(r.Context()).Named("codes.HandleCheckCodeStatus")
+
 		var request api.CheckCodeStatusRequest
 		if err := controller.BindJSON(w, r, &request); err != nil {
 			c.h.RenderJSON(w, http.StatusBadRequest, api.Error(err))
@@ -35,6 +38,13 @@ func (c *Controller) HandleCheckCodeStatus() http.Handler {
 			return
 		}
 
+		if err := c.auditStatusAccess(r, code); err != nil {
+			logger.Errorw("failed to audit code status access", "error", err)
+			c.h.RenderJSON(w, http.StatusInternalServerError,
+				api.Errorf("failed to check otp code status, please try again").WithCode(api.ErrInternal))
+			return
+		}
+
 		c.h.RenderJSON(w, http.StatusOK,
 			&api.CheckCodeStatusResponse{
 				Claimed:                code.Claimed,
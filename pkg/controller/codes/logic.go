@@ -70,6 +70,16 @@ func (c *Controller) CheckCodeStatus(r *http.Request, uuid string) (*database.Ve
 	return code, 0, nil
 }
 
+// auditStatusAccess records that the current user or API key viewed the
+// code's status, if the realm audits it.
+func (c *Controller) auditStatusAccess(r *http.Request, code *database.VerificationCode) error {
+	_, _, realm, err := c.getAuthorizationFromContext(r.Context())
+	if err != nil {
+		return err
+	}
+	return controller.AuditAccess(r, c.db, realm, database.AccessViewedCodeStatus, code)
+}
+
 // getAuthorizationFromContext pulls the authorization from the context. If an
 // API key is provided, it's used to lookup the realm. If a membership exists,
 // it's used to provide the realm.
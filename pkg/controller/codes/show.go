@@ -82,6 +82,11 @@ func (c *Controller) HandleShow() http.Handler {
 			return
 		}
 
+		if err := c.auditStatusAccess(r, code); err != nil {
+			controller.InternalError(w, r, c.h, err)
+			return
+		}
+
 		retCode, err := c.responseCode(ctx, code)
 		if err != nil {
 			controller.InternalError(w, r, c.h, err)
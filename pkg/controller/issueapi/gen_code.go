@@ -17,6 +17,7 @@ package issueapi
 import (
 	"context"
 	"crypto/rand"
+	"errors"
 	"fmt"
 	"math/big"
 	"net/http"
@@ -77,6 +78,17 @@ func (c *Controller) IssueCode(ctx context.Context, vCode *database.Verification
 	}
 
 	if err := c.CommitCode(ctx, vCode, realm, c.config.GetCollisionRetryCount()); err != nil {
+		if errors.Is(err, database.ErrSiteDailyCodeLimitReached) {
+			logger.Warnw("site has reached daily limit",
+				"realm", realm.ID,
+				"site", vCode.IssuingSiteID)
+			return &IssueResult{
+				obsResult:   observability.ResultError("SITE_QUOTA_EXCEEDED"),
+				HTTPCode:    http.StatusTooManyRequests,
+				ErrorReturn: api.Errorf("site %d has reached its daily code limit", vCode.IssuingSiteID).WithCode(api.ErrQuotaExceeded),
+			}
+		}
+
 		logger.Errorw("failed to issue code", "error", err)
 		return &IssueResult{
 			obsResult:   observability.ResultError("FAILED_TO_ISSUE_CODE"),
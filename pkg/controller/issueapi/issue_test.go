@@ -97,3 +97,52 @@ func TestIssueOne(t *testing.T) {
 		})
 	}
 }
+
+func TestIssueMany_SiteDailyCodeLimit(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	testCfg := envstest.NewServerConfig(t, testDatabaseInstance)
+	db := testCfg.Database
+	realm, err := db.FindRealm(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx = controller.WithRealm(ctx, realm)
+
+	site := &database.Site{RealmID: realm.ID, Name: "Batch limited site", DailyCodeLimit: 2}
+	if err := db.SaveSite(site, database.SystemTest); err != nil {
+		t.Fatal(err)
+	}
+
+	c := issueapi.New(testCfg.Config, db, testCfg.RateLimiter, nil)
+	symptomDate := time.Now().UTC().Add(-48 * time.Hour).Format(project.RFC3339Date)
+
+	requests := make([]*api.IssueCodeRequest, 3)
+	for i := range requests {
+		requests[i] = &api.IssueCodeRequest{
+			TestType:    "confirmed",
+			SymptomDate: symptomDate,
+			SiteID:      site.ID,
+		}
+	}
+
+	results := c.IssueMany(ctx, requests)
+	for i, result := range results {
+		want := http.StatusOK
+		if i >= int(site.DailyCodeLimit) {
+			want = http.StatusTooManyRequests
+		}
+		if got := result.HTTPCode; got != want {
+			t.Errorf("request %d: expected status %d, got %d", i, want, got)
+		}
+	}
+
+	issued, err := site.CodesIssuedToday(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := issued, site.DailyCodeLimit; got != want {
+		t.Errorf("expected %d codes issued at the site, got %d", want, got)
+	}
+}
@@ -90,6 +90,11 @@ func (c *Controller) SendSMS(ctx context.Context, request *api.IssueCodeRequest,
 				// fallthrough to the error
 			}
 
+			if err := realm.IncrementSMSFailed(c.db, result.VerCode.CreatedAt); err != nil {
+				logger.Errorw("failed to update sms stats", "error", err)
+				// fallthrough to the error
+			}
+
 			logger.Infow("failed to send sms", "error", ScrubPhoneNumbers(err.Error()))
 			result.obsResult = observability.ResultError("FAILED_TO_SEND_SMS")
 			return err
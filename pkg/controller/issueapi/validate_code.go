@@ -42,11 +42,14 @@ func (c *Controller) BuildVerificationCode(ctx context.Context, request *api.Iss
 		ExpiresAt:         now.Add(realm.CodeDuration.Duration),
 		LongExpiresAt:     now.Add(realm.LongCodeDuration.Duration),
 	}
+	var defaultSiteID uint
 	if membership := controller.MembershipFromContext(ctx); membership != nil {
 		vCode.IssuingUserID = membership.UserID
+		defaultSiteID = membership.DefaultSiteID
 	}
 	if authApp := controller.AuthorizedAppFromContext(ctx); authApp != nil {
 		vCode.IssuingAppID = authApp.ID
+		defaultSiteID = authApp.DefaultSiteID
 	}
 
 	// If this realm requires a date but no date was specified, return an error.
@@ -97,6 +100,11 @@ func (c *Controller) BuildVerificationCode(ctx context.Context, request *api.Iss
 		vCode.LongExpiresAt = vCode.ExpiresAt
 	}
 
+	// Attribute the code to a site and enforce the site's daily limit.
+	if result := c.applySite(ctx, vCode, realm, request.SiteID, defaultSiteID); result != nil {
+		return nil, result
+	}
+
 	// If there is a client-provided UUID, check if a code has already been issued.
 	// this prevents us from consuming quota on conflict.
 	if vCode.UUID = project.TrimSpaceAndNonPrintable(request.UUID); vCode.UUID != "" {
@@ -145,3 +153,63 @@ func (c *Controller) BuildVerificationCode(ctx context.Context, request *api.Iss
 
 	return vCode, nil
 }
+
+// applySite sets the issuing site on the code. An explicitly requested site
+// must exist and be active, but a default site which has since been disabled
+// is ignored so issuance is not blocked. Sites at their daily limit are
+// rejected early here, and the limit is enforced when the code is saved.
+func (c *Controller) applySite(ctx context.Context, vCode *database.VerificationCode, realm *database.Realm, siteID, defaultSiteID uint) *IssueResult {
+	logger := logging.FromContext(ctx).Named("issueapi.applySite")
+
+	id := siteID
+	if id == 0 {
+		id = defaultSiteID
+	}
+	if id == 0 {
+		return nil
+	}
+
+	site, err := realm.FindSite(c.db, id)
+	if err != nil && !database.IsNotFound(err) {
+		logger.Errorw("failed to find site", "error", err)
+		return &IssueResult{
+			obsResult:   observability.ResultError("FAILED_TO_FIND_SITE"),
+			HTTPCode:    http.StatusInternalServerError,
+			ErrorReturn: api.Errorf("failed to find site").WithCode(api.ErrInternal),
+		}
+	}
+	if site == nil || !site.IsActive() {
+		if siteID == 0 {
+			return nil
+		}
+		return &IssueResult{
+			obsResult:   observability.ResultError("INVALID_SITE"),
+			HTTPCode:    http.StatusBadRequest,
+			ErrorReturn: api.Errorf("site %d does not exist or is disabled", siteID).WithCode(api.ErrInvalidSite),
+		}
+	}
+
+	reached, err := site.DailyCodeLimitReached(c.db)
+	if err != nil {
+		logger.Errorw("failed to check site limit", "error", err)
+		return &IssueResult{
+			obsResult:   observability.ResultError("FAILED_TO_CHECK_SITE_LIMIT"),
+			HTTPCode:    http.StatusInternalServerError,
+			ErrorReturn: api.Errorf("failed to check site limit").WithCode(api.ErrInternal),
+		}
+	}
+	if reached {
+		logger.Warnw("site has reached daily limit",
+			"realm", realm.ID,
+			"site", site.ID,
+			"limit", site.DailyCodeLimit)
+		return &IssueResult{
+			obsResult:   observability.ResultError("SITE_QUOTA_EXCEEDED"),
+			HTTPCode:    http.StatusTooManyRequests,
+			ErrorReturn: api.Errorf("site %q has reached its daily limit of %d codes", site.Name, site.DailyCodeLimit).WithCode(api.ErrQuotaExceeded),
+		}
+	}
+
+	vCode.SetIssuingSite(site)
+	return nil
+}
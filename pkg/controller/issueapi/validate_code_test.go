@@ -56,6 +56,34 @@ func TestValidate(t *testing.T) {
 		t.Fatal(err)
 	}
 
+	site := &database.Site{RealmID: realm.ID, Name: "Validate site"}
+	if err := db.SaveSite(site, database.SystemTest); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now().UTC()
+	disabledSite := &database.Site{RealmID: realm.ID, Name: "Validate disabled site"}
+	disabledSite.DeletedAt = &now
+	if err := db.SaveSite(disabledSite, database.SystemTest); err != nil {
+		t.Fatal(err)
+	}
+
+	limitedSite := &database.Site{RealmID: realm.ID, Name: "Validate limited site", DailyCodeLimit: 1}
+	if err := db.SaveSite(limitedSite, database.SystemTest); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.SaveVerificationCode(&database.VerificationCode{
+		RealmID:       realm.ID,
+		Code:          "00000002",
+		LongCode:      "00000002ABC",
+		TestType:      "confirmed",
+		ExpiresAt:     time.Now().Add(time.Hour),
+		LongExpiresAt: time.Now().Add(time.Hour),
+		IssuingSiteID: limitedSite.ID,
+	}, realm); err != nil {
+		t.Fatal(err)
+	}
+
 	authApp := &database.AuthorizedApp{
 		Model: gorm.Model{ID: 123},
 	}
@@ -165,6 +193,45 @@ func TestValidate(t *testing.T) {
 			responseErr:    api.ErrUUIDAlreadyExists,
 			httpStatusCode: http.StatusConflict,
 		},
+		{
+			name: "site",
+			request: api.IssueCodeRequest{
+				TestType:    "confirmed",
+				SymptomDate: symptomDate,
+				SiteID:      site.ID,
+			},
+			httpStatusCode: http.StatusOK,
+		},
+		{
+			name: "unknown site",
+			request: api.IssueCodeRequest{
+				TestType:    "confirmed",
+				SymptomDate: symptomDate,
+				SiteID:      999999,
+			},
+			responseErr:    api.ErrInvalidSite,
+			httpStatusCode: http.StatusBadRequest,
+		},
+		{
+			name: "disabled site",
+			request: api.IssueCodeRequest{
+				TestType:    "confirmed",
+				SymptomDate: symptomDate,
+				SiteID:      disabledSite.ID,
+			},
+			responseErr:    api.ErrInvalidSite,
+			httpStatusCode: http.StatusBadRequest,
+		},
+		{
+			name: "site limit reached",
+			request: api.IssueCodeRequest{
+				TestType:    "confirmed",
+				SymptomDate: symptomDate,
+				SiteID:      limitedSite.ID,
+			},
+			responseErr:    api.ErrQuotaExceeded,
+			httpStatusCode: http.StatusTooManyRequests,
+		},
 	}
 
 	for _, tc := range cases {
@@ -184,6 +251,9 @@ func TestValidate(t *testing.T) {
 				if tc.request.SymptomDate != "" && verCode.SymptomDate == nil {
 					t.Errorf("No symptom date. got %s, want %s", verCode.TestDate, tc.request.TestDate)
 				}
+				if got, want := verCode.IssuingSiteID, tc.request.SiteID; got != want {
+					t.Errorf("incorrect site. got %d, want %d", got, want)
+				}
 				return
 			}
 			resp := result.IssueCodeResponse()
@@ -19,6 +19,7 @@ package jwks
 
 import (
 	"context"
+	"crypto/ed25519"
 	"errors"
 	"net/http"
 	"strconv"
@@ -31,6 +32,7 @@ import (
 	"github.com/google/exposure-notifications-verification-server/pkg/render"
 	"github.com/gorilla/mux"
 	"github.com/rakutentech/jwk-go/jwk"
+	"github.com/rakutentech/jwk-go/okp"
 )
 
 // Error codes
@@ -49,27 +51,7 @@ func (c *Controller) HandleIndex() http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		ctx := r.Context()
 
-		// key is the key in the cacher where the values for this JWK are cached.
-		key := &cache.Key{
-			Namespace: "jwks",
-			Key:       r.URL.String(),
-		}
-
-		// See if there's a cached value. Note we cannot use Fetch here because our
-		// fetch function also depends on the cacher to lookup pubic keys and
-		// results in a deadlock.
-		var encoded []*jwk.JWK
-		if err := c.cacher.Read(ctx, key, &encoded); err == nil {
-			c.h.RenderJSON(w, http.StatusOK, encoded)
-			return
-		} else if err != cache.ErrNotFound {
-			controller.InternalError(w, r, c.h, err)
-			return
-		}
-
-		// If we got this far, it means there was no cached value, so do a full
-		// read.
-		encoded, err := func() ([]*jwk.JWK, error) {
+		c.renderCached(w, r, func() ([]*jwk.JWK, error) {
 			// Grab the URL path components  we need.
 			realmID := mux.Vars(r)["realm_id"]
 
@@ -87,41 +69,111 @@ func (c *Controller) HandleIndex() http.Handler {
 
 			encoded := make([]*jwk.JWK, len(keys))
 			for i, key := range keys {
-				pk, err := c.keyCache.GetPublicKey(ctx, key.KeyID, c.db.KeyManager())
+				encoded[i], err = c.encode(ctx, key.KeyID, key.GetKID())
 				if err != nil {
 					return nil, err
 				}
+			}
+			return encoded, nil
+		})
+	})
+}
+
+// HandleTokenIndex returns an http.Handler that handles GET requests for the
+// verification token signing keys. Retired keys are included until they are
+// destroyed.
+func (c *Controller) HandleTokenIndex() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		c.renderCached(w, r, func() ([]*jwk.JWK, error) {
+			keys, err := c.db.ListTokenSigningKeys()
+			if err != nil {
+				return nil, err
+			}
 
-				// Encode it, and sent it off.
-				spec := jwk.NewSpec(pk)
-				spec.KeyID = key.GetKID()
-				encoded[i], err = spec.ToJWK()
+			encoded := make([]*jwk.JWK, len(keys))
+			for i, key := range keys {
+				encoded[i], err = c.encode(ctx, key.KeyID, key.GetKID())
 				if err != nil {
 					return nil, err
 				}
 			}
 			return encoded, nil
-		}()
-		if err != nil {
-			controller.InternalError(w, r, c.h, err)
-			return
-		}
-
-		// It's possible there were concurrent requests and someone already has the
-		// cache - now that we have the value, we can avoid the deadline and do a
-		// fetch. If there's already a cached value, our value will be discarded.
-		// Otherwise, it will be overwritten and saved in the cache.
-		ttl := 5 * time.Minute
-		if err := c.cacher.Fetch(ctx, key, &encoded, ttl, func() (interface{}, error) {
-			return encoded, nil
-		}); err != nil {
-			controller.InternalError(w, r, c.h, err)
-			return
-		}
+		})
+	})
+}
+
+// renderCached renders the JWKs returned by fetchFn, caching the result by
+// request URL.
+func (c *Controller) renderCached(w http.ResponseWriter, r *http.Request, fetchFn func() ([]*jwk.JWK, error)) {
+	ctx := r.Context()
 
-		// Get the keys.
+	// key is the key in the cacher where the values for this JWK are cached.
+	key := &cache.Key{
+		Namespace: "jwks",
+		Key:       r.URL.String(),
+	}
+
+	// See if there's a cached value. Note we cannot use Fetch here because our
+	// fetch function also depends on the cacher to lookup pubic keys and
+	// results in a deadlock.
+	var encoded []*jwk.JWK
+	if err := c.cacher.Read(ctx, key, &encoded); err == nil {
 		c.h.RenderJSON(w, http.StatusOK, encoded)
-	})
+		return
+	} else if err != cache.ErrNotFound {
+		controller.InternalError(w, r, c.h, err)
+		return
+	}
+
+	// If we got this far, it means there was no cached value, so do a full
+	// read.
+	encoded, err := fetchFn()
+	if err != nil {
+		controller.InternalError(w, r, c.h, err)
+		return
+	}
+
+	// It's possible there were concurrent requests and someone already has the
+	// cache - now that we have the value, we can avoid the deadline and do a
+	// fetch. If there's already a cached value, our value will be discarded.
+	// Otherwise, it will be overwritten and saved in the cache.
+	ttl := 5 * time.Minute
+	if err := c.cacher.Fetch(ctx, key, &encoded, ttl, func() (interface{}, error) {
+		return encoded, nil
+	}); err != nil {
+		controller.InternalError(w, r, c.h, err)
+		return
+	}
+
+	// Get the keys.
+	c.h.RenderJSON(w, http.StatusOK, encoded)
+}
+
+// encode looks up the public key for the given key version and encodes it as
+// a JWK with the given kid.
+func (c *Controller) encode(ctx context.Context, keyID, kid string) (*jwk.JWK, error) {
+	pk, err := c.keyCache.GetPublicKey(ctx, keyID, c.db.KeyManager())
+	if err != nil {
+		return nil, err
+	}
+
+	alg, err := keyutils.AlgorithmForPublicKey(pk)
+	if err != nil {
+		return nil, err
+	}
+
+	// The JWK library represents Ed25519 keys as octet key pairs.
+	if edpk, ok := pk.(ed25519.PublicKey); ok {
+		pk = okp.NewEd25519([]byte(edpk), nil)
+	}
+
+	// Encode it, and sent it off.
+	spec := jwk.NewSpec(pk)
+	spec.KeyID = kid
+	spec.Algorithm = string(alg)
+	return spec.ToJWK()
 }
 
 // getRealm finds realm given ID.
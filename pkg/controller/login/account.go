@@ -18,6 +18,7 @@ package login
 import (
 	"net/http"
 
+	"github.com/google/exposure-notifications-verification-server/internal/auth"
 	"github.com/google/exposure-notifications-verification-server/pkg/controller"
 )
 
@@ -27,6 +28,43 @@ func (c *Controller) HandleAccountSettings() http.Handler {
 
 		m := controller.TemplateMapFromContext(ctx)
 		m.Title("My account")
+
+		if provider, ok := c.authProvider.(auth.RedirectProvider); ok {
+			session := controller.SessionFromContext(ctx)
+			if session == nil {
+				controller.MissingSession(w, r, c.h)
+				return
+			}
+
+			name, err := provider.SessionIdentityProvider(ctx, session)
+			if err != nil {
+				controller.InternalError(w, r, c.h, err)
+				return
+			}
+			for _, idp := range provider.IdentityProviders() {
+				if idp.Name == name {
+					m["identityProvider"] = idp
+				}
+			}
+
+			emailVerified, err := provider.EmailVerified(ctx, session)
+			if err != nil {
+				controller.InternalError(w, r, c.h, err)
+				return
+			}
+			m["emailVerified"] = emailVerified
+
+			mfaEnabled, err := provider.MFAEnabled(ctx, session)
+			if err != nil {
+				controller.InternalError(w, r, c.h, err)
+				return
+			}
+			m["mfaEnabled"] = mfaEnabled
+
+			c.h.RenderHTML(w, "account", m)
+			return
+		}
+
 		m["firebase"] = c.config.Firebase
 		c.h.RenderHTML(w, "account", m)
 	})
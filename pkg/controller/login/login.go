@@ -19,6 +19,7 @@ import (
 	"context"
 	"net/http"
 
+	"github.com/google/exposure-notifications-verification-server/internal/auth"
 	"github.com/google/exposure-notifications-verification-server/pkg/controller"
 )
 
@@ -44,6 +45,13 @@ func (c *Controller) HandleLogin() http.Handler {
 func (c *Controller) renderLogin(ctx context.Context, w http.ResponseWriter) {
 	m := controller.TemplateMapFromContext(ctx)
 	m.Title("Login")
+
+	if provider, ok := c.authProvider.(auth.RedirectProvider); ok {
+		m["identityProviders"] = provider.IdentityProviders()
+		c.h.RenderHTML(w, "login/oidc", m)
+		return
+	}
+
 	m["firebase"] = c.config.Firebase
 	c.h.RenderHTML(w, "login", m)
 }
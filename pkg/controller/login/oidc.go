@@ -0,0 +1,164 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package login
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/google/exposure-notifications-server/pkg/logging"
+	"github.com/google/exposure-notifications-verification-server/internal/auth"
+	"github.com/google/exposure-notifications-verification-server/pkg/controller"
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/sessions"
+)
+
+// HandleOIDCLogin redirects the user to the named identity provider to sign
+// in.
+func (c *Controller) HandleOIDCLogin() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		vars := mux.Vars(r)
+
+		logger := logging.FromContext(ctx).Named("login.HandleOIDCLogin")
+
+		session := controller.SessionFromContext(ctx)
+		if session == nil {
+			controller.MissingSession(w, r, c.h)
+			return
+		}
+		flash := controller.Flash(session)
+
+		provider, ok := c.authProvider.(auth.RedirectProvider)
+		if !ok {
+			controller.NotFound(w, r, c.h)
+			return
+		}
+
+		u, err := provider.AuthCodeURL(ctx, session, vars["provider"], r.FormValue("login_hint"))
+		if err != nil {
+			if errors.Is(err, auth.ErrUnknownIdentityProvider) {
+				controller.NotFound(w, r, c.h)
+				return
+			}
+
+			logger.Errorw("failed to start sign in", "provider", vars["provider"], "error", err)
+			flash.Error("Failed to sign in: the identity provider is unavailable.")
+			http.Redirect(w, r, "/", http.StatusSeeOther)
+			return
+		}
+
+		http.Redirect(w, r, u, http.StatusSeeOther)
+	})
+}
+
+// HandleOIDCCallback completes signing in after the identity provider
+// redirects the user back.
+func (c *Controller) HandleOIDCCallback() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		logger := logging.FromContext(ctx).Named("login.HandleOIDCCallback")
+
+		session := controller.SessionFromContext(ctx)
+		if session == nil {
+			controller.MissingSession(w, r, c.h)
+			return
+		}
+		flash := controller.Flash(session)
+
+		provider, ok := c.authProvider.(auth.RedirectProvider)
+		if !ok {
+			controller.NotFound(w, r, c.h)
+			return
+		}
+
+		// The identity provider reports errors, like the user declining to sign
+		// in, as query parameters. Anyone can craft a callback link, so only log
+		// them.
+		if errCode := r.FormValue("error"); errCode != "" {
+			logger.Warnw("identity provider returned an error",
+				"error", errCode,
+				"error_description", r.FormValue("error_description"))
+			flash.Error("Failed to sign in. The identity provider did not complete the sign in.")
+			http.Redirect(w, r, "/", http.StatusSeeOther)
+			return
+		}
+
+		info, err := provider.Exchange(ctx, session, r.FormValue("state"), r.FormValue("code"))
+		if err != nil {
+			logger.Warnw("failed to exchange authorization code", "error", err)
+			flash.Error("Failed to sign in. Please try again.")
+			http.Redirect(w, r, "/", http.StatusSeeOther)
+			return
+		}
+
+		info.TTL = c.config.SessionDuration
+		if err := provider.StoreSession(ctx, session, info); err != nil {
+			logger.Warnw("failed to create session", "error", err)
+			if errors.Is(err, auth.ErrEmailNotVerified) {
+				flash.Error("Failed to sign in. Your identity provider has not verified your email address.")
+			} else {
+				flash.Error("Failed to sign in. Please try again.")
+			}
+			http.Redirect(w, r, "/", http.StatusSeeOther)
+			return
+		}
+
+		// Bind the user to their identity, so later requests identify them by
+		// their subject instead of their email address.
+		if err := c.bindIdentity(ctx, provider, session); err != nil {
+			provider.ClearSession(ctx, session)
+
+			switch {
+			case database.IsNotFound(err):
+				flash.Error("Failed to sign in. There is no account for your email address.")
+			case errors.Is(err, database.ErrIdentityMismatch):
+				logger.Warnw("user is bound to another identity", "error", err)
+				flash.Error("Failed to sign in. Your account is linked to a different identity.")
+			default:
+				controller.InternalError(w, r, c.h, err)
+				return
+			}
+			http.Redirect(w, r, "/", http.StatusSeeOther)
+			return
+		}
+
+		http.Redirect(w, r, "/login/select-realm", http.StatusSeeOther)
+	})
+}
+
+// bindIdentity binds the signed in user to their subject at the identity
+// provider.
+func (c *Controller) bindIdentity(ctx context.Context, provider auth.RedirectProvider, session *sessions.Session) error {
+	name, err := provider.SessionIdentityProvider(ctx, session)
+	if err != nil {
+		return err
+	}
+	subject, err := provider.SessionSubject(ctx, session)
+	if err != nil {
+		return err
+	}
+	email, err := provider.EmailAddress(ctx, session)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.db.BindUserIdentity(name, subject, email)
+	return err
+}
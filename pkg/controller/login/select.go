@@ -42,7 +42,15 @@ func (c *Controller) HandleSelectRealm() http.Handler {
 			controller.MissingUser(w, r, c.h)
 			return
 		}
-		memberships := controller.MembershipsFromContext(ctx)
+
+		// Disabled and archived realms do not accept logins.
+		allMemberships := controller.MembershipsFromContext(ctx)
+		memberships := make([]*database.Membership, 0, len(allMemberships))
+		for _, m := range allMemberships {
+			if m.Realm != nil && m.Realm.IsActive() {
+				memberships = append(memberships, m)
+			}
+		}
 
 		switch len(memberships) {
 		case 0:
@@ -105,6 +113,12 @@ func (c *Controller) HandleSelectRealm() http.Handler {
 			return
 		}
 
+		if !membership.Realm.IsActive() {
+			flash.Error("Invalid realm selection.")
+			c.renderSelect(ctx, w, memberships)
+			return
+		}
+
 		controller.StoreSessionRealm(session, membership.Realm)
 		http.Redirect(w, r, "/codes/issue", http.StatusSeeOther)
 	})
@@ -18,6 +18,7 @@ import (
 	"net/http"
 
 	"github.com/google/exposure-notifications-server/pkg/logging"
+	"github.com/google/exposure-notifications-verification-server/internal/auth"
 	"github.com/google/exposure-notifications-verification-server/pkg/controller"
 	"github.com/google/exposure-notifications-verification-server/pkg/database"
 )
@@ -70,6 +71,12 @@ func (c *Controller) HandleSignOut() http.Handler {
 		session.Values = make(map[interface{}]interface{})
 		flash.Clone(session.Values)
 
+		// Identity providers do not need a client-side sign out.
+		if _, ok := c.authProvider.(auth.RedirectProvider); ok {
+			http.Redirect(w, r, "/", http.StatusSeeOther)
+			return
+		}
+
 		m := controller.TemplateMapFromContext(ctx)
 		m.Title("Logging out...")
 		m["firebase"] = c.config.Firebase
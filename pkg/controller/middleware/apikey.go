@@ -106,6 +106,13 @@ func RequireAPIKey(cacher cache.Cacher, db *database.Database, h render.Renderer
 				return
 			}
 
+			// Disabled and archived realms do not accept API requests.
+			if !realm.IsActive() {
+				logger.Debugw("realm is not active", "id", realm.ID, "state", realm.State.Display())
+				controller.Unauthorized(w, r, h)
+				return
+			}
+
 			// Save the authorized app on the context.
 			ctx = controller.WithAuthorizedApp(ctx, &authApp)
 			ctx = controller.WithRealm(ctx, &realm)
@@ -115,3 +122,23 @@ func RequireAPIKey(cacher cache.Cacher, db *database.Database, h render.Renderer
 		})
 	}
 }
+
+// APIKeyFromBearer copies a bearer token from the Authorization header into the
+// X-API-Key header when the latter is not set. This supports clients, such as
+// Prometheus scrapers, that can only send bearer tokens. It must be installed
+// before RequireAPIKey.
+func APIKeyFromBearer() mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get(APIKeyHeader) == "" {
+				auth := strings.TrimSpace(r.Header.Get("Authorization"))
+				if len(auth) > 7 && strings.EqualFold(auth[:7], "bearer ") {
+					r = r.Clone(r.Context())
+					r.Header.Set(APIKeyHeader, strings.TrimSpace(auth[7:]))
+				}
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
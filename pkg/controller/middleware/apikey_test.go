@@ -159,3 +159,68 @@ func TestRequireAPIKey(t *testing.T) {
 		})
 	}
 }
+
+func TestAPIKeyFromBearer(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name          string
+		apiKey        string
+		authorization string
+		exp           string
+	}{
+		{
+			name: "none",
+			exp:  "",
+		},
+		{
+			name:          "bearer",
+			authorization: "Bearer abc123",
+			exp:           "abc123",
+		},
+		{
+			name:          "bearer_lowercase",
+			authorization: "bearer abc123",
+			exp:           "abc123",
+		},
+		{
+			name:          "basic",
+			authorization: "Basic abc123",
+			exp:           "",
+		},
+		{
+			name:          "existing_api_key",
+			apiKey:        "def456",
+			authorization: "Bearer abc123",
+			exp:           "def456",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			r := httptest.NewRequest("GET", "/", nil)
+			if tc.apiKey != "" {
+				r.Header.Set(middleware.APIKeyHeader, tc.apiKey)
+			}
+			if tc.authorization != "" {
+				r.Header.Set("Authorization", tc.authorization)
+			}
+
+			var got string
+			handler := middleware.APIKeyFromBearer()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = r.Header.Get(middleware.APIKeyHeader)
+			}))
+
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			if got != tc.exp {
+				t.Errorf("expected %q to be %q", got, tc.exp)
+			}
+		})
+	}
+}
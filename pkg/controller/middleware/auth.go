@@ -16,7 +16,11 @@
 package middleware
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/google/exposure-notifications-server/pkg/logging"
@@ -27,6 +31,7 @@ import (
 	"github.com/google/exposure-notifications-verification-server/pkg/render"
 
 	"github.com/gorilla/mux"
+	"github.com/gorilla/sessions"
 )
 
 // RequireAuth requires a user to be logged in. It also fetches and stores
@@ -61,29 +66,26 @@ func RequireAuth(cacher cache.Cacher, authProvider auth.Provider, db *database.D
 				}
 			}
 
-			// Get the email from the auth provider.
-			email, err := authProvider.EmailAddress(ctx, session)
-			if err != nil {
-				authProvider.ClearSession(ctx, session)
-
-				logger.Debugw("failed to get email from session", "error", err)
-				flash.Error("An error occurred trying to verify your credentials.")
-				controller.RedirectToLogout(w, r, h)
-				return
-			}
-
 			// Load the user by using the cache to alleviate pressure on the database
 			// layer.
 			var user database.User
-			userCacheKey := &cache.Key{
-				Namespace: "users:by_email",
-				Key:       email,
+			var userCacheKey *cache.Key
+			var err error
+			if provider, ok := authProvider.(auth.RedirectProvider); ok {
+				userCacheKey, err = loadIdentityUser(ctx, cacher, provider, db, session, &user, cacheTTL)
+			} else {
+				userCacheKey, err = loadEmailUser(ctx, cacher, authProvider, db, session, &user, cacheTTL)
 			}
-			if err := cacher.Fetch(ctx, userCacheKey, &user, cacheTTL, func() (interface{}, error) {
-				return db.FindUserByEmail(email)
-			}); err != nil {
+			if err != nil {
 				authProvider.ClearSession(ctx, session)
 
+				if errors.Is(err, errNoSessionUser) {
+					logger.Debugw("failed to get user from session", "error", err)
+					flash.Error("An error occurred trying to verify your credentials.")
+					controller.RedirectToLogout(w, r, h)
+					return
+				}
+
 				if database.IsNotFound(err) {
 					controller.Unauthorized(w, r, h)
 					return
@@ -137,6 +139,68 @@ func RequireAuth(cacher cache.Cacher, authProvider auth.Provider, db *database.D
 	}
 }
 
+// errNoSessionUser is returned when the session does not identify a user.
+var errNoSessionUser = errors.New("session does not identify a user")
+
+// loadEmailUser loads the user identified by the email address in the session.
+func loadEmailUser(ctx context.Context, cacher cache.Cacher, authProvider auth.Provider, db *database.Database,
+	session *sessions.Session, user *database.User, ttl time.Duration) (*cache.Key, error) {
+	email, err := authProvider.EmailAddress(ctx, session)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", errNoSessionUser, err)
+	}
+
+	key := &cache.Key{
+		Namespace: "users:by_email",
+		Key:       email,
+	}
+	if err := cacher.Fetch(ctx, key, user, ttl, func() (interface{}, error) {
+		return db.FindUserByEmail(email)
+	}); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// loadIdentityUser loads the user bound to the identity provider and subject in
+// the session. Users are bound when they sign in, so the email address in the
+// session is not used.
+func loadIdentityUser(ctx context.Context, cacher cache.Cacher, provider auth.RedirectProvider, db *database.Database,
+	session *sessions.Session, user *database.User, ttl time.Duration) (*cache.Key, error) {
+	name, err := provider.SessionIdentityProvider(ctx, session)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", errNoSessionUser, err)
+	}
+	subject, err := provider.SessionSubject(ctx, session)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", errNoSessionUser, err)
+	}
+
+	// Bindings only change when the user is deleted, in which case the cached
+	// user ID no longer resolves to a user.
+	var userID uint
+	identityCacheKey := &cache.Key{
+		Namespace: "user_identities:by_subject",
+		Key:       name + ":" + subject,
+	}
+	if err := cacher.Fetch(ctx, identityCacheKey, &userID, ttl, func() (interface{}, error) {
+		return db.FindUserIDByIdentity(name, subject)
+	}); err != nil {
+		return nil, err
+	}
+
+	key := &cache.Key{
+		Namespace: "users:by_id",
+		Key:       strconv.FormatUint(uint64(userID), 10),
+	}
+	if err := cacher.Fetch(ctx, key, user, ttl, func() (interface{}, error) {
+		return db.FindUser(userID)
+	}); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
 // RequireSystemAdmin requires the current user is a global administrator. It must
 // come after RequireAuth so that a user is set on the context.
 func RequireSystemAdmin(h render.Renderer) mux.MiddlewareFunc {
@@ -63,6 +63,20 @@ func RequireVerified(authProvider auth.Provider, db *database.Database, h render
 				}
 
 				if !verified {
+					// Users who sign in through an identity provider verify their email
+					// address there, so they cannot be prompted to verify it here.
+					if _, ok := authProvider.(auth.RedirectProvider); ok {
+						if currentRealm.EmailVerifiedMode == database.MFARequired {
+							controller.Flash(session).Error("This realm requires a verified email address. " +
+								"Verify your email address with your identity provider and sign in again.")
+							controller.RedirectToLogout(w, r, h)
+							return
+						}
+						controller.StoreSessionEmailVerificationPrompted(session, true)
+						next.ServeHTTP(w, r)
+						return
+					}
+
 					http.Redirect(w, r, "/login/manage-account?mode=verifyEmail", http.StatusSeeOther)
 					return
 				}
@@ -0,0 +1,87 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/google/exposure-notifications-server/pkg/logging"
+	"github.com/google/exposure-notifications-verification-server/internal/auth"
+	"github.com/google/exposure-notifications-verification-server/pkg/controller"
+	"github.com/google/exposure-notifications-verification-server/pkg/render"
+
+	"github.com/gorilla/mux"
+)
+
+// RequireIdentityProvider requires that the user signed in through the
+// identity provider the current realm is bound to, if any. Users who signed in
+// through a different identity provider are asked to sign in again.
+//
+// MUST first run RequireMembership to populate the membership.
+func RequireIdentityProvider(authProvider auth.Provider, h render.Renderer) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+
+			logger := logging.FromContext(ctx).Named("middleware.RequireIdentityProvider")
+
+			session := controller.SessionFromContext(ctx)
+			if session == nil {
+				controller.MissingSession(w, r, h)
+				return
+			}
+
+			membership := controller.MembershipFromContext(ctx)
+			if membership == nil {
+				controller.MissingMembership(w, r, h)
+				return
+			}
+
+			want := membership.Realm.IdentityProvider
+			if want == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			// Fail closed if the realm is bound to an identity provider, but the
+			// server is not signing in through identity providers.
+			provider, ok := authProvider.(auth.RedirectProvider)
+			if !ok {
+				logger.Warnw("realm requires an identity provider, but the auth provider does not support them",
+					"realm", membership.Realm.ID,
+					"identity_provider", want)
+				controller.Unauthorized(w, r, h)
+				return
+			}
+
+			got, err := provider.SessionIdentityProvider(ctx, session)
+			if err != nil {
+				controller.InternalError(w, r, h, err)
+				return
+			}
+
+			if got != want {
+				controller.Flash(session).Error("%s requires signing in through a different identity provider.",
+					membership.Realm.Name)
+				http.Redirect(w, r, fmt.Sprintf("/login/oidc/%s", url.PathEscape(want)), http.StatusSeeOther)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
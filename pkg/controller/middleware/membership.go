@@ -73,9 +73,9 @@ func LoadCurrentMembership(cacher cache.Cacher, db *database.Database, h render.
 					break
 				}
 			}
-			if membership == nil {
+			if membership == nil || (membership.Realm != nil && !membership.Realm.IsActive()) {
 				// There was a realm in the session, but it does not match a membership
-				// of the user. Clear and move along.
+				// of the user or the realm is no longer active. Clear and move along.
 				controller.ClearSessionRealm(session)
 				next.ServeHTTP(w, r)
 				return
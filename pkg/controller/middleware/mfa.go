@@ -55,8 +55,18 @@ func RequireMFA(authProvider auth.Provider, h render.Renderer) mux.MiddlewareFun
 
 			prompted := controller.MFAPromptedFromSession(session)
 			if !mfaEnabled {
-				if mode := currentRealm.EffectiveMFAMode(currentUser); mode == database.MFARequired ||
-					mode == database.MFAOptionalPrompt && !prompted {
+				mode := currentRealm.EffectiveMFAMode(currentUser)
+
+				// Users who sign in through an identity provider enroll second
+				// factors there, so they cannot be prompted to enroll here.
+				if _, ok := authProvider.(auth.RedirectProvider); ok {
+					if mode == database.MFARequired {
+						controller.Flash(session).Error("This realm requires multi-factor authentication. " +
+							"Sign in again using a second factor with your identity provider.")
+						controller.RedirectToLogout(w, r, h)
+						return
+					}
+				} else if mode == database.MFARequired || mode == database.MFAOptionalPrompt && !prompted {
 					controller.RedirectToMFA(w, r, h)
 					return
 				}
@@ -120,8 +120,9 @@ func (c *Controller) rebuildModel(ctx context.Context, id uint64) error {
 		return nil
 	}
 
-	// Exclude the most recent record. Depending on timezones, the "day" might not
-	// be over at 00:00 UTC, and we don't want to generate a partial model.
+	// The current day in the realm's timezone is already excluded, so every
+	// record is a complete day. Drop the oldest record so the model is built
+	// from the most recent 20 days.
 	stats = stats[:len(stats)-1]
 
 	// Reverse the list - it came in reversed because we sorted by date DESC, but
@@ -0,0 +1,83 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package realmadmin
+
+import (
+	"net/http"
+
+	"github.com/google/exposure-notifications-verification-server/internal/project"
+	"github.com/google/exposure-notifications-verification-server/pkg/controller"
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+	"github.com/google/exposure-notifications-verification-server/pkg/pagination"
+	"github.com/google/exposure-notifications-verification-server/pkg/rbac"
+)
+
+// HandleAccessEvents renders the realm's access log, which records reads of
+// sensitive data. It can be filtered by actor and action.
+func (c *Controller) HandleAccessEvents() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		session := controller.SessionFromContext(ctx)
+		if session == nil {
+			controller.MissingSession(w, r, c.h)
+			return
+		}
+
+		membership := controller.MembershipFromContext(ctx)
+		if membership == nil {
+			controller.MissingMembership(w, r, c.h)
+			return
+		}
+		if !membership.Can(rbac.AuditRead) {
+			controller.Unauthorized(w, r, c.h)
+			return
+		}
+		currentRealm := membership.Realm
+
+		pageParams, err := pagination.FromRequest(r)
+		if err != nil {
+			controller.BadRequest(w, r, c.h)
+			return
+		}
+
+		actor := project.TrimSpace(r.FormValue(controller.QueryAuditActor))
+		action := project.TrimSpace(r.FormValue(controller.QueryAuditAction))
+
+		var scopes []database.Scope
+		if actor != "" {
+			scopes = append(scopes, database.WithAccessActorID(actor))
+		}
+		if action != "" {
+			scopes = append(scopes, database.WithAccessAction(action))
+		}
+
+		entries, paginator, err := currentRealm.ListAccessEntries(c.db, pageParams, scopes...)
+		if err != nil {
+			controller.InternalError(w, r, c.h, err)
+			return
+		}
+
+		m := controller.TemplateMapFromContext(ctx)
+		m.Title("Access log")
+		m["realm"] = currentRealm
+		m["entries"] = entries
+		m["paginator"] = paginator
+		m["actions"] = database.AccessActions
+		m["actor"] = actor
+		m["action"] = action
+		c.h.RenderHTML(w, "realmadmin/access", m)
+	})
+}
@@ -0,0 +1,195 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package realmadmin
+
+import (
+	"net/http"
+
+	"github.com/google/exposure-notifications-verification-server/pkg/controller"
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+	"github.com/google/exposure-notifications-verification-server/pkg/pagination"
+	"github.com/google/exposure-notifications-verification-server/pkg/rbac"
+	"github.com/gorilla/mux"
+)
+
+// ChildRealm is a realm below the current realm, with its 30-day totals.
+type ChildRealm struct {
+	*database.Realm
+	CodesIssued  uint
+	CodesClaimed uint
+}
+
+// HandleChildren lists the realms below the current realm in the hierarchy.
+func (c *Controller) HandleChildren() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		session := controller.SessionFromContext(ctx)
+		if session == nil {
+			controller.MissingSession(w, r, c.h)
+			return
+		}
+
+		membership := controller.MembershipFromContext(ctx)
+		if membership == nil {
+			controller.MissingMembership(w, r, c.h)
+			return
+		}
+		if !membership.Can(rbac.StatsRead) {
+			controller.Unauthorized(w, r, c.h)
+			return
+		}
+		currentRealm := membership.Realm
+
+		realms, err := currentRealm.ListDescendantRealms(c.db)
+		if err != nil {
+			controller.InternalError(w, r, c.h, err)
+			return
+		}
+
+		totals, err := c.db.RealmStatsTotals(realms)
+		if err != nil {
+			controller.InternalError(w, r, c.h, err)
+			return
+		}
+
+		children := make([]*ChildRealm, 0, len(realms))
+		for _, realm := range realms {
+			child := &ChildRealm{Realm: realm}
+			if total, ok := totals[realm.ID]; ok {
+				child.CodesIssued = total.CodesIssued
+				child.CodesClaimed = total.CodesClaimed
+			}
+			children = append(children, child)
+		}
+
+		m := controller.TemplateMapFromContext(ctx)
+		m.Title("Child realms")
+		m["realm"] = currentRealm
+		m["children"] = children
+		c.h.RenderHTML(w, "realmadmin/children", m)
+	})
+}
+
+// HandleChildEvents shows the event log of a realm below the current realm.
+func (c *Controller) HandleChildEvents() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		childRealm, ok := c.findChildRealm(w, r, rbac.AuditRead)
+		if !ok {
+			return
+		}
+
+		filter, err := controller.AuditFilterFromRequest(r)
+		if err != nil {
+			controller.BadRequest(w, r, c.h)
+			return
+		}
+
+		pageParams, err := pagination.FromRequest(r)
+		if err != nil {
+			controller.BadRequest(w, r, c.h)
+			return
+		}
+
+		events, paginator, err := childRealm.ListAudits(c.db, pageParams, filter.Scopes()...)
+		if err != nil {
+			controller.InternalError(w, r, c.h, err)
+			return
+		}
+
+		actions, err := c.db.ListAuditActions(database.WithAuditRealmID(childRealm.ID))
+		if err != nil {
+			controller.InternalError(w, r, c.h, err)
+			return
+		}
+
+		m := controller.TemplateMapFromContext(ctx)
+		m.Title("Events: %s", childRealm.Name)
+		m["childRealm"] = childRealm
+		c.renderEvents(w, r, m, events, paginator, actions)
+	})
+}
+
+// HandleChildUsers lists the users of a realm below the current realm.
+func (c *Controller) HandleChildUsers() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		childRealm, ok := c.findChildRealm(w, r, rbac.UserRead)
+		if !ok {
+			return
+		}
+
+		pageParams, err := pagination.FromRequest(r)
+		if err != nil {
+			controller.BadRequest(w, r, c.h)
+			return
+		}
+
+		q := r.FormValue("q")
+		memberships, paginator, err := childRealm.ListMemberships(c.db, pageParams, database.WithUserSearch(q))
+		if err != nil {
+			controller.InternalError(w, r, c.h, err)
+			return
+		}
+
+		m := controller.TemplateMapFromContext(ctx)
+		m.Title("Users: %s", childRealm.Name)
+		m["childRealm"] = childRealm
+		m["memberships"] = memberships
+		m["paginator"] = paginator
+		m["query"] = q
+		c.h.RenderHTML(w, "realmadmin/child_users", m)
+	})
+}
+
+// findChildRealm loads the realm in the request path, checking that it is
+// below the current realm and that the current membership has the given
+// permission. If it returns false, a response has already been rendered.
+func (c *Controller) findChildRealm(w http.ResponseWriter, r *http.Request, perm rbac.Permission) (*database.Realm, bool) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+
+	session := controller.SessionFromContext(ctx)
+	if session == nil {
+		controller.MissingSession(w, r, c.h)
+		return nil, false
+	}
+
+	membership := controller.MembershipFromContext(ctx)
+	if membership == nil {
+		controller.MissingMembership(w, r, c.h)
+		return nil, false
+	}
+	if !membership.Can(perm) {
+		controller.Unauthorized(w, r, c.h)
+		return nil, false
+	}
+	currentRealm := membership.Realm
+
+	childRealm, err := currentRealm.FindDescendantRealm(c.db, vars["id"])
+	if err != nil {
+		if database.IsNotFound(err) {
+			controller.NotFound(w, r, c.h)
+			return nil, false
+		}
+
+		controller.InternalError(w, r, c.h, err)
+		return nil, false
+	}
+	return childRealm, true
+}
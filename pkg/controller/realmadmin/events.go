@@ -15,7 +15,6 @@
 package realmadmin
 
 import (
-	"context"
 	"net/http"
 
 	"github.com/google/exposure-notifications-verification-server/pkg/controller"
@@ -24,14 +23,6 @@ import (
 	"github.com/google/exposure-notifications-verification-server/pkg/rbac"
 )
 
-const (
-	// QueryFromSearch is the query key for a starting time.
-	QueryFromSearch = "from"
-
-	// QueryToSearch is the query key for an ending time.
-	QueryToSearch = "to"
-)
-
 func (c *Controller) HandleEvents() http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		ctx := r.Context()
@@ -53,10 +44,11 @@ func (c *Controller) HandleEvents() http.Handler {
 		}
 		currentRealm := membership.Realm
 
-		var scopes []database.Scope
-		from := r.FormValue(QueryFromSearch)
-		to := r.FormValue(QueryToSearch)
-		scopes = append(scopes, database.WithAuditTime(from, to))
+		filter, err := controller.AuditFilterFromRequest(r)
+		if err != nil {
+			controller.BadRequest(w, r, c.h)
+			return
+		}
 
 		pageParams, err := pagination.FromRequest(r)
 		if err != nil {
@@ -64,24 +56,76 @@ func (c *Controller) HandleEvents() http.Handler {
 			return
 		}
 
-		events, paginator, err := currentRealm.ListAudits(c.db, pageParams, scopes...)
+		events, paginator, err := currentRealm.ListAudits(c.db, pageParams, filter.Scopes()...)
+		if err != nil {
+			controller.InternalError(w, r, c.h, err)
+			return
+		}
+
+		actions, err := c.db.ListAuditActions(database.WithAuditRealmID(currentRealm.ID))
 		if err != nil {
 			controller.InternalError(w, r, c.h, err)
 			return
 		}
 
-		c.renderEvents(ctx, w, currentRealm, events, paginator, from, to)
+		m := controller.TemplateMapFromContext(ctx)
+		m.Title("Events")
+		m["user"] = currentRealm
+		c.renderEvents(w, r, m, events, paginator, actions)
+	})
+}
+
+// HandleEventsExport exports the realm's events which match the filters in the
+// request as a file download.
+func (c *Controller) HandleEventsExport(format database.AuditExportFormat) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		session := controller.SessionFromContext(ctx)
+		if session == nil {
+			controller.MissingSession(w, r, c.h)
+			return
+		}
+
+		membership := controller.MembershipFromContext(ctx)
+		if membership == nil {
+			controller.MissingMembership(w, r, c.h)
+			return
+		}
+		if !membership.Can(rbac.AuditExport) {
+			controller.Unauthorized(w, r, c.h)
+			return
+		}
+		currentRealm := membership.Realm
+
+		filter, err := controller.AuditFilterFromRequest(r)
+		if err != nil {
+			controller.BadRequest(w, r, c.h)
+			return
+		}
+
+		if err := controller.AuditAccess(r, c.db, currentRealm, database.AccessExportedAudits, currentRealm); err != nil {
+			controller.InternalError(w, r, c.h, err)
+			return
+		}
+
+		scopes := append(filter.Scopes(), database.WithAuditRealmID(currentRealm.ID))
+		controller.ExportAudits(w, r, c.h, c.db, format, "events", scopes...)
 	})
 }
 
-func (c *Controller) renderEvents(ctx context.Context, w http.ResponseWriter,
-	realm *database.Realm, events []*database.AuditEntry, paginator *pagination.Paginator, from, to string) {
-	m := controller.TemplateMapFromContext(ctx)
-	m.Title("Events")
-	m["user"] = realm
+// renderEvents renders the event list for the realm or child realm in the
+// template map, echoing the filters from the request.
+func (c *Controller) renderEvents(w http.ResponseWriter, r *http.Request, m controller.TemplateMap,
+	events []*database.AuditEntry, paginator *pagination.Paginator, actions []string) {
 	m["events"] = events
 	m["paginator"] = paginator
-	m[QueryFromSearch] = from
-	m[QueryToSearch] = to
+	m["actions"] = actions
+	for _, k := range []string{
+		controller.QueryAuditActor, controller.QueryAuditAction, controller.QueryAuditTarget,
+		controller.QueryAuditSearch, controller.QueryAuditFrom, controller.QueryAuditTo,
+	} {
+		m[k] = r.FormValue(k)
+	}
 	c.h.RenderHTML(w, "realmadmin/events", m)
 }
@@ -0,0 +1,135 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package realmadmin
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/google/exposure-notifications-verification-server/pkg/controller"
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+	"github.com/google/exposure-notifications-verification-server/pkg/pagination"
+	"github.com/google/exposure-notifications-verification-server/pkg/rbac"
+	"github.com/gorilla/mux"
+)
+
+// HandleSettingsHistory renders the versions of the realm's settings, which
+// are the audited settings changes with structured changes. Since the history
+// is built from the audit log, it requires permission to read both settings
+// and audit events.
+func (c *Controller) HandleSettingsHistory() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		session := controller.SessionFromContext(ctx)
+		if session == nil {
+			controller.MissingSession(w, r, c.h)
+			return
+		}
+
+		membership := controller.MembershipFromContext(ctx)
+		if membership == nil {
+			controller.MissingMembership(w, r, c.h)
+			return
+		}
+		if !membership.Can(rbac.SettingsRead) || !membership.Can(rbac.AuditRead) {
+			controller.Unauthorized(w, r, c.h)
+			return
+		}
+		currentRealm := membership.Realm
+
+		pageParams, err := pagination.FromRequest(r)
+		if err != nil {
+			controller.BadRequest(w, r, c.h)
+			return
+		}
+
+		versions, paginator, err := currentRealm.ListSettingsHistory(c.db, pageParams)
+		if err != nil {
+			controller.InternalError(w, r, c.h, err)
+			return
+		}
+
+		m := controller.TemplateMapFromContext(ctx)
+		m.Title("Settings history")
+		m["realm"] = currentRealm
+		m["versions"] = versions
+		m["paginator"] = paginator
+		m["revertable"] = database.IsRevertableRealmField
+		c.h.RenderHTML(w, "realmadmin/history", m)
+	})
+}
+
+// HandleSettingsRevert reverts the realm's settings to the version recorded by
+// the audit entry in the URL.
+func (c *Controller) HandleSettingsRevert() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		vars := mux.Vars(r)
+
+		session := controller.SessionFromContext(ctx)
+		if session == nil {
+			controller.MissingSession(w, r, c.h)
+			return
+		}
+		flash := controller.Flash(session)
+
+		membership := controller.MembershipFromContext(ctx)
+		if membership == nil {
+			controller.MissingMembership(w, r, c.h)
+			return
+		}
+		if !membership.Can(rbac.SettingsWrite) || !membership.Can(rbac.AuditRead) {
+			controller.Unauthorized(w, r, c.h)
+			return
+		}
+		currentRealm := membership.Realm
+		currentUser := membership.User
+
+		id, err := strconv.ParseUint(vars["id"], 10, 64)
+		if err != nil {
+			controller.BadRequest(w, r, c.h)
+			return
+		}
+
+		result, err := c.db.RevertRealmSettings(currentRealm, uint(id), currentUser, c.validateRetention)
+		if err != nil {
+			if database.IsNotFound(err) {
+				controller.NotFound(w, r, c.h)
+				return
+			}
+
+			if database.IsValidationError(err) {
+				flash.Error("Failed to revert settings: %s", strings.Join(currentRealm.ErrorMessages(), ", "))
+				http.Redirect(w, r, "/realm/settings/history", http.StatusSeeOther)
+				return
+			}
+
+			controller.InternalError(w, r, c.h, err)
+			return
+		}
+
+		if len(result.Reverted) == 0 {
+			flash.Alert("Settings are already at that version")
+		} else {
+			flash.Alert("Successfully reverted %s", strings.Join(result.Reverted, ", "))
+		}
+		if len(result.Skipped) > 0 {
+			flash.Warning("These settings cannot be reverted and were not changed: %s", strings.Join(result.Skipped, ", "))
+		}
+		http.Redirect(w, r, "/realm/settings/history", http.StatusSeeOther)
+	})
+}
@@ -0,0 +1,178 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package realmadmin
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/exposure-notifications-verification-server/pkg/controller"
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+	"github.com/google/exposure-notifications-verification-server/pkg/rbac"
+)
+
+// RetentionPolicy is the effective retention of a type of record in a realm.
+type RetentionPolicy struct {
+	Name string
+
+	// OverrideDays is the realm's setting, or zero to use the system default.
+	OverrideDays uint
+
+	// DefaultDays, MinDays, and MaxDays are the system default and bounds.
+	DefaultDays uint
+	MinDays     uint
+	MaxDays     uint
+
+	// MaxAge is the effective retention after applying bounds.
+	MaxAge time.Duration
+
+	// Purgeable is the number of records which will be deleted on the next
+	// cleanup run.
+	Purgeable int64
+}
+
+// Days is the effective retention in days.
+func (p *RetentionPolicy) Days() uint {
+	return durationDays(p.MaxAge)
+}
+
+// Clamped returns true if the realm's override is outside of the system bounds.
+func (p *RetentionPolicy) Clamped() bool {
+	return p.OverrideDays > 0 && p.OverrideDays != p.Days()
+}
+
+// retentionPolicies returns the verification code, audit entry, and access
+// entry retention for the realm, without purgeable counts.
+func (c *Controller) retentionPolicies(realm *database.Realm) (*RetentionPolicy, *RetentionPolicy, *RetentionPolicy) {
+	cfg := &c.config.Retention
+
+	codes := &RetentionPolicy{
+		Name:         "Verification codes",
+		OverrideDays: realm.VerificationCodeRetentionDays,
+		DefaultDays:  durationDays(cfg.VerificationCodeStatusMaxAge),
+		MinDays:      durationDays(cfg.MinRealmVerificationCodeStatusMaxAge),
+		MaxDays:      durationDays(cfg.MaxRealmVerificationCodeStatusMaxAge),
+		MaxAge:       cfg.VerificationCodeStatusMaxAgeFor(realm),
+	}
+
+	audits := &RetentionPolicy{
+		Name:         "Audit entries",
+		OverrideDays: realm.AuditEntryRetentionDays,
+		DefaultDays:  durationDays(cfg.AuditEntryMaxAge),
+		MinDays:      durationDays(cfg.MinRealmAuditEntryMaxAge),
+		MaxDays:      durationDays(cfg.MaxRealmAuditEntryMaxAge),
+		MaxAge:       cfg.AuditEntryMaxAgeFor(realm),
+	}
+
+	access := &RetentionPolicy{
+		Name:         "Access entries",
+		OverrideDays: realm.AccessEntryRetentionDays,
+		DefaultDays:  durationDays(cfg.AccessEntryMaxAge),
+		MinDays:      durationDays(cfg.MinRealmAccessEntryMaxAge),
+		MaxDays:      durationDays(cfg.MaxRealmAccessEntryMaxAge),
+		MaxAge:       cfg.AccessEntryMaxAgeFor(realm),
+	}
+
+	return codes, audits, access
+}
+
+// validateRetention adds errors to the realm if its retention overrides are
+// outside of the system bounds.
+func (c *Controller) validateRetention(realm *database.Realm) {
+	codes, audits, access := c.retentionPolicies(realm)
+
+	if d := realm.VerificationCodeRetentionDays; d > 0 && (d < codes.MinDays || d > codes.MaxDays) {
+		realm.AddError("verificationCodeRetentionDays",
+			fmt.Sprintf("must be between %d and %d days", codes.MinDays, codes.MaxDays))
+	}
+
+	if d := realm.AuditEntryRetentionDays; d > 0 && (d < audits.MinDays || d > audits.MaxDays) {
+		realm.AddError("auditEntryRetentionDays",
+			fmt.Sprintf("must be between %d and %d days", audits.MinDays, audits.MaxDays))
+	}
+
+	if d := realm.AccessEntryRetentionDays; d > 0 && (d < access.MinDays || d > access.MaxDays) {
+		realm.AddError("accessEntryRetentionDays",
+			fmt.Sprintf("must be between %d and %d days", access.MinDays, access.MaxDays))
+	}
+}
+
+// HandleRetention renders the realm's effective data retention and the number
+// of records which will be deleted on the next cleanup run.
+func (c *Controller) HandleRetention() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		session := controller.SessionFromContext(ctx)
+		if session == nil {
+			controller.MissingSession(w, r, c.h)
+			return
+		}
+
+		membership := controller.MembershipFromContext(ctx)
+		if membership == nil {
+			controller.MissingMembership(w, r, c.h)
+			return
+		}
+		if !membership.Can(rbac.SettingsRead) {
+			controller.Unauthorized(w, r, c.h)
+			return
+		}
+		currentRealm := membership.Realm
+
+		codes, audits, access := c.retentionPolicies(currentRealm)
+
+		var err error
+		codes.Purgeable, err = currentRealm.CountPurgeableVerificationCodes(c.db, codes.MaxAge)
+		if err != nil {
+			controller.InternalError(w, r, c.h, err)
+			return
+		}
+
+		audits.Purgeable, err = currentRealm.CountPurgeableAuditEntries(c.db, audits.MaxAge)
+		if err != nil {
+			controller.InternalError(w, r, c.h, err)
+			return
+		}
+
+		access.Purgeable, err = currentRealm.CountPurgeableAccessEntries(c.db, access.MaxAge)
+		if err != nil {
+			controller.InternalError(w, r, c.h, err)
+			return
+		}
+
+		var nextCleanup time.Time
+		status, err := c.db.FindCleanupStatus(database.CleanupName)
+		if err != nil && !database.IsNotFound(err) {
+			controller.InternalError(w, r, c.h, err)
+			return
+		}
+		if status != nil {
+			nextCleanup = status.NotBefore
+		}
+
+		m := controller.TemplateMapFromContext(ctx)
+		m.Title("Data retention")
+		m["realm"] = currentRealm
+		m["policies"] = []*RetentionPolicy{codes, audits, access}
+		m["nextCleanup"] = nextCleanup
+		c.h.RenderHTML(w, "realmadmin/retention", m)
+	})
+}
+
+func durationDays(d time.Duration) uint {
+	return uint(d / (24 * time.Hour))
+}
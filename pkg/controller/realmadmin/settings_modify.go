@@ -54,11 +54,15 @@ func init() {
 }
 
 type formData struct {
-	General                 bool   `form:"general"`
-	Name                    string `form:"name"`
-	RegionCode              string `form:"region_code"`
-	WelcomeMessage          string `form:"welcome_message"`
-	DailyActiveUsersEnabled bool   `form:"daily_active_users_enabled"`
+	General                 bool    `form:"general"`
+	Name                    string  `form:"name"`
+	RegionCode              string  `form:"region_code"`
+	WelcomeMessage          string  `form:"welcome_message"`
+	Timezone                string  `form:"timezone"`
+	DailyActiveUsersEnabled bool    `form:"daily_active_users_enabled"`
+	PublicStatsEnabled      bool    `form:"public_stats_enabled"`
+	PublicStatsMinCount     uint    `form:"public_stats_min_count"`
+	PublicStatsEpsilon      float64 `form:"public_stats_epsilon"`
 
 	Codes                     bool               `form:"codes"`
 	AllowedTestTypes          database.TestType  `form:"allowed_test_types"`
@@ -93,6 +97,7 @@ type formData struct {
 	EmailVerifiedMode           int16  `form:"email_verified_mode"`
 	PasswordRotationPeriodDays  uint   `form:"password_rotation_period_days"`
 	PasswordRotationWarningDays uint   `form:"password_rotation_warning_days"`
+	AccessAuditLevel            int16  `form:"access_audit_level"`
 	AllowedCIDRsAdminAPI        string `form:"allowed_cidrs_adminapi"`
 	AllowedCIDRsAPIServer       string `form:"allowed_cidrs_apiserver"`
 	AllowedCIDRsServer          string `form:"allowed_cidrs_server"`
@@ -101,6 +106,19 @@ type formData struct {
 	AbusePreventionEnabled     bool    `form:"abuse_prevention_enabled"`
 	AbusePreventionLimitFactor float32 `form:"abuse_prevention_limit_factor"`
 	AbusePreventionBurst       uint64  `form:"abuse_prevention_burst"`
+
+	Retention                     bool `form:"retention"`
+	VerificationCodeRetentionDays uint `form:"verification_code_retention_days"`
+	AuditEntryRetentionDays       uint `form:"audit_entry_retention_days"`
+	AccessEntryRetentionDays      uint `form:"access_entry_retention_days"`
+
+	Reports                      bool   `form:"reports"`
+	WeeklyReportEnabled          bool   `form:"weekly_report_enabled"`
+	WeeklyReportRecipients       string `form:"weekly_report_recipients"`
+	WeeklyReportExportToStorage  bool   `form:"weekly_report_export_to_storage"`
+	MonthlyReportEnabled         bool   `form:"monthly_report_enabled"`
+	MonthlyReportRecipients      string `form:"monthly_report_recipients"`
+	MonthlyReportExportToStorage bool   `form:"monthly_report_export_to_storage"`
 }
 
 func (c *Controller) HandleSettings() http.Handler {
@@ -142,7 +160,7 @@ func (c *Controller) HandleSettings() http.Handler {
 		}
 
 		if r.Method == http.MethodGet {
-			c.renderSettings(ctx, w, r, currentRealm, nil, nil, quotaLimit, quotaRemaining)
+			c.renderSettings(ctx, w, r, currentRealm, nil, nil, nil, quotaLimit, quotaRemaining)
 			return
 		}
 
@@ -157,7 +175,7 @@ func (c *Controller) HandleSettings() http.Handler {
 		if err := controller.BindForm(w, r, &form); err != nil {
 			currentRealm.AddError("", err.Error())
 			w.WriteHeader(http.StatusUnprocessableEntity)
-			c.renderSettings(ctx, w, r, currentRealm, nil, nil, quotaLimit, quotaRemaining)
+			c.renderSettings(ctx, w, r, currentRealm, nil, nil, nil, quotaLimit, quotaRemaining)
 			return
 		}
 
@@ -166,7 +184,11 @@ func (c *Controller) HandleSettings() http.Handler {
 			currentRealm.Name = form.Name
 			currentRealm.RegionCode = form.RegionCode
 			currentRealm.WelcomeMessage = form.WelcomeMessage
+			currentRealm.Timezone = form.Timezone
 			currentRealm.DailyActiveUsersEnabled = form.DailyActiveUsersEnabled
+			currentRealm.PublicStatsEnabled = form.PublicStatsEnabled
+			currentRealm.PublicStatsMinCount = form.PublicStatsMinCount
+			currentRealm.PublicStatsEpsilon = form.PublicStatsEpsilon
 		}
 
 		// Codes
@@ -207,12 +229,13 @@ func (c *Controller) HandleSettings() http.Handler {
 			currentRealm.MFARequiredGracePeriod = database.FromDuration(time.Duration(form.MFARequiredGracePeriod) * 24 * time.Hour)
 			currentRealm.PasswordRotationPeriodDays = form.PasswordRotationPeriodDays
 			currentRealm.PasswordRotationWarningDays = form.PasswordRotationWarningDays
+			currentRealm.AccessAuditLevel = database.AccessAuditLevel(form.AccessAuditLevel)
 
 			allowedCIDRsAdminADPI, err := database.ToCIDRList(form.AllowedCIDRsAdminAPI)
 			if err != nil {
 				currentRealm.AddError("allowedCIDRsAdminAPI", err.Error())
 				w.WriteHeader(http.StatusUnprocessableEntity)
-				c.renderSettings(ctx, w, r, currentRealm, nil, nil, quotaLimit, quotaRemaining)
+				c.renderSettings(ctx, w, r, currentRealm, nil, nil, nil, quotaLimit, quotaRemaining)
 				return
 			}
 			currentRealm.AllowedCIDRsAdminAPI = allowedCIDRsAdminADPI
@@ -221,7 +244,7 @@ func (c *Controller) HandleSettings() http.Handler {
 			if err != nil {
 				currentRealm.AddError("allowedCIDRsAPIServer", err.Error())
 				w.WriteHeader(http.StatusUnprocessableEntity)
-				c.renderSettings(ctx, w, r, currentRealm, nil, nil, quotaLimit, quotaRemaining)
+				c.renderSettings(ctx, w, r, currentRealm, nil, nil, nil, quotaLimit, quotaRemaining)
 				return
 			}
 			currentRealm.AllowedCIDRsAPIServer = allowedCIDRsAPIServer
@@ -230,7 +253,7 @@ func (c *Controller) HandleSettings() http.Handler {
 			if err != nil {
 				currentRealm.AddError("allowedCIDRsServer", err.Error())
 				w.WriteHeader(http.StatusUnprocessableEntity)
-				c.renderSettings(ctx, w, r, currentRealm, nil, nil, quotaLimit, quotaRemaining)
+				c.renderSettings(ctx, w, r, currentRealm, nil, nil, nil, quotaLimit, quotaRemaining)
 				return
 			}
 			currentRealm.AllowedCIDRsServer = allowedCIDRsServer
@@ -245,6 +268,20 @@ func (c *Controller) HandleSettings() http.Handler {
 			currentRealm.AbusePreventionLimitFactor = form.AbusePreventionLimitFactor
 		}
 
+		// Retention
+		if form.Retention {
+			currentRealm.VerificationCodeRetentionDays = form.VerificationCodeRetentionDays
+			currentRealm.AuditEntryRetentionDays = form.AuditEntryRetentionDays
+			currentRealm.AccessEntryRetentionDays = form.AccessEntryRetentionDays
+
+			c.validateRetention(currentRealm)
+			if len(currentRealm.Errors()) > 0 {
+				w.WriteHeader(http.StatusUnprocessableEntity)
+				c.renderSettings(ctx, w, r, currentRealm, nil, nil, nil, quotaLimit, quotaRemaining)
+				return
+			}
+		}
+
 		// If abuse prevention was just enabled, create the initial bucket so
 		// enforcement works. We do this before actually saving the configuration on
 		// the realm to avoid a race where someone is issuing a code where abuse
@@ -272,7 +309,7 @@ func (c *Controller) HandleSettings() http.Handler {
 		if err := c.db.SaveRealm(currentRealm, currentUser); err != nil {
 			if database.IsValidationError(err) {
 				w.WriteHeader(http.StatusUnprocessableEntity)
-				c.renderSettings(ctx, w, r, currentRealm, nil, nil, quotaLimit, quotaRemaining)
+				c.renderSettings(ctx, w, r, currentRealm, nil, nil, nil, quotaLimit, quotaRemaining)
 				return
 			}
 
@@ -313,7 +350,7 @@ func (c *Controller) HandleSettings() http.Handler {
 				if err := c.db.SaveSMSConfig(smsConfig); err != nil {
 					if database.IsValidationError(err) {
 						w.WriteHeader(http.StatusUnprocessableEntity)
-						c.renderSettings(ctx, w, r, currentRealm, smsConfig, nil, quotaLimit, quotaRemaining)
+						c.renderSettings(ctx, w, r, currentRealm, smsConfig, nil, nil, quotaLimit, quotaRemaining)
 						return
 					}
 
@@ -358,7 +395,53 @@ func (c *Controller) HandleSettings() http.Handler {
 				if err := c.db.SaveEmailConfig(emailConfig); err != nil {
 					if database.IsValidationError(err) {
 						w.WriteHeader(http.StatusUnprocessableEntity)
-						c.renderSettings(ctx, w, r, currentRealm, nil, emailConfig, quotaLimit, quotaRemaining)
+						c.renderSettings(ctx, w, r, currentRealm, nil, emailConfig, nil, quotaLimit, quotaRemaining)
+						return
+					}
+
+					controller.InternalError(w, r, c.h, err)
+					return
+				}
+			}
+		}
+
+		// Reports
+		if form.Reports {
+			schedules, err := currentRealm.ListStatsReportSchedules(c.db)
+			if err != nil {
+				controller.InternalError(w, r, c.h, err)
+				return
+			}
+
+			weekly := schedules[database.StatsReportWeekly]
+			weekly.Enabled = form.WeeklyReportEnabled
+			weekly.Recipients = database.ParseStatsReportRecipients(form.WeeklyReportRecipients)
+			weekly.ExportToStorage = form.WeeklyReportExportToStorage
+
+			monthly := schedules[database.StatsReportMonthly]
+			monthly.Enabled = form.MonthlyReportEnabled
+			monthly.Recipients = database.ParseStatsReportRecipients(form.MonthlyReportRecipients)
+			monthly.ExportToStorage = form.MonthlyReportExportToStorage
+
+			// Validate both schedules before saving either, so the form is saved or
+			// rejected as a whole.
+			var invalid bool
+			for _, f := range database.StatsReportFrequencies {
+				if err := schedules[f].BeforeSave(nil); err != nil {
+					invalid = true
+				}
+			}
+			if invalid {
+				w.WriteHeader(http.StatusUnprocessableEntity)
+				c.renderSettings(ctx, w, r, currentRealm, nil, nil, schedules, quotaLimit, quotaRemaining)
+				return
+			}
+
+			for _, f := range database.StatsReportFrequencies {
+				if err := c.db.SaveStatsReportSchedule(schedules[f], currentUser); err != nil {
+					if database.IsValidationError(err) {
+						w.WriteHeader(http.StatusUnprocessableEntity)
+						c.renderSettings(ctx, w, r, currentRealm, nil, nil, schedules, quotaLimit, quotaRemaining)
 						return
 					}
 
@@ -32,7 +32,8 @@ type TemplateData struct {
 
 func (c *Controller) renderSettings(
 	ctx context.Context, w http.ResponseWriter, r *http.Request, realm *database.Realm,
-	smsConfig *database.SMSConfig, emailConfig *database.EmailConfig, quotaLimit, quotaRemaining uint64) {
+	smsConfig *database.SMSConfig, emailConfig *database.EmailConfig,
+	reportSchedules map[database.StatsReportFrequency]*database.StatsReportSchedule, quotaLimit, quotaRemaining uint64) {
 	if smsConfig == nil {
 		var err error
 		smsConfig, err = realm.SMSConfig(c.db)
@@ -57,6 +58,15 @@ func (c *Controller) renderSettings(
 		}
 	}
 
+	if reportSchedules == nil {
+		var err error
+		reportSchedules, err = realm.ListStatsReportSchedules(c.db)
+		if err != nil {
+			controller.InternalError(w, r, c.h, err)
+			return
+		}
+	}
+
 	// Look up the sms from numbers.
 	smsFromNumbers, err := c.db.SMSFromNumbers()
 	if err != nil {
@@ -124,6 +134,9 @@ func (c *Controller) renderSettings(
 	m["smsFromNumbers"] = smsFromNumbers
 	m["smsTemplates"] = templates
 	m["emailConfig"] = emailConfig
+	m["reportSchedules"] = reportSchedules
+	m["reportFrequencies"] = database.StatsReportFrequencies
+	m["maxReportRecipients"] = database.MaxStatsReportRecipients
 	m["countries"] = database.Countries
 	m["testTypes"] = map[string]database.TestType{
 		"confirmed": database.TestTypeConfirmed,
@@ -134,6 +147,7 @@ func (c *Controller) renderSettings(
 	m["mfaGracePeriod"] = mfaGracePeriod
 	m["passwordRotateDays"] = passwordRotationPeriodDays
 	m["passwordWarnDays"] = passwordRotationWarningDays
+	m["accessAuditLevels"] = database.AccessAuditLevels
 	// Valid settings for code parameters.
 	m["shortCodeLengths"] = shortCodeLengths
 	m["shortCodeMinutes"] = shortCodeMinutes
@@ -146,5 +160,10 @@ func (c *Controller) renderSettings(
 	m["quotaLimit"] = quotaLimit
 	m["quotaRemaining"] = quotaRemaining
 
+	codeRetention, auditRetention, accessRetention := c.retentionPolicies(realm)
+	m["codeRetention"] = codeRetention
+	m["auditRetention"] = auditRetention
+	m["accessRetention"] = accessRetention
+
 	c.h.RenderHTML(w, "realmadmin/edit", m)
 }
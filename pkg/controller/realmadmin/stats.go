@@ -16,7 +16,9 @@ package realmadmin
 
 import (
 	"net/http"
+	"net/url"
 
+	"github.com/google/exposure-notifications-verification-server/internal/project"
 	"github.com/google/exposure-notifications-verification-server/pkg/controller"
 	"github.com/google/exposure-notifications-verification-server/pkg/rbac"
 )
@@ -41,8 +43,37 @@ func (c *Controller) HandleStats() http.Handler {
 			return
 		}
 
+		// Pass the requested range through to the stats endpoints, which are
+		// responsible for validating it.
+		q := r.URL.Query()
+		params := url.Values{}
+		for _, k := range []string{"start", "end", "granularity"} {
+			if v := q.Get(k); v != "" {
+				params.Set(k, v)
+			}
+		}
+
+		statsQuery := ""
+		if len(params) > 0 {
+			statsQuery = "?" + params.Encode()
+		}
+
+		sr := membership.Realm.DefaultStatsRange()
+		statsStart := sr.Start.Format(project.RFC3339Date)
+		if v := params.Get("start"); v != "" {
+			statsStart = v
+		}
+		statsEnd := sr.Stop.Format(project.RFC3339Date)
+		if v := params.Get("end"); v != "" {
+			statsEnd = v
+		}
+
 		m := controller.TemplateMapFromContext(ctx)
 		m.Title("Realm stats")
+		m["statsQuery"] = statsQuery
+		m["statsStart"] = statsStart
+		m["statsEnd"] = statsEnd
+		m["statsGranularity"] = params.Get("granularity")
 		c.h.RenderHTML(w, "realmadmin/stats", m)
 	})
 }
@@ -18,10 +18,15 @@ import (
 	"net/http"
 
 	"github.com/google/exposure-notifications-verification-server/pkg/controller"
+	"github.com/google/exposure-notifications-verification-server/pkg/keyutils"
 	"github.com/google/exposure-notifications-verification-server/pkg/rbac"
 )
 
 func (c *Controller) HandleCreateKey() http.Handler {
+	type FormData struct {
+		Algorithm string `form:"algorithm"`
+	}
+
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		ctx := r.Context()
 
@@ -43,7 +48,21 @@ func (c *Controller) HandleCreateKey() http.Handler {
 		}
 		currentRealm := membership.Realm
 
-		kid, err := currentRealm.CreateSigningKeyVersion(ctx, c.db)
+		var form FormData
+		if err := controller.BindForm(w, r, &form); err != nil {
+			flash.Error("Failed to process form: %v", err)
+			c.renderShow(ctx, w, r, currentRealm)
+			return
+		}
+
+		alg, err := keyutils.ParseAlgorithm(form.Algorithm)
+		if err != nil {
+			flash.Error("Unable to create a new signing key: %v", err)
+			c.renderShow(ctx, w, r, currentRealm)
+			return
+		}
+
+		kid, err := currentRealm.CreateSigningKeyVersion(ctx, c.db, alg)
 		if err != nil {
 			flash.Error("Unable to create a new signing key: %v", err)
 			c.renderShow(ctx, w, r, currentRealm)
@@ -33,6 +33,17 @@ func (c *Controller) renderShow(ctx context.Context, w http.ResponseWriter, r *h
 	m.Title("Realm keys")
 	m["realm"] = realm
 
+	if realm.InheritParentCertificateKey {
+		certificateRealm, err := realm.CertificateRealm(c.db)
+		if err != nil {
+			controller.InternalError(w, r, c.h, err)
+			return
+		}
+		if certificateRealm.ID != realm.ID {
+			m["certificateRealm"] = certificateRealm
+		}
+	}
+
 	m["supportsPerRealmSigning"] = c.db.SupportsPerRealmSigning()
 	if c.db.SupportsPerRealmSigning() {
 		keys, err := realm.ListSigningKeys(c.db)
@@ -45,6 +56,7 @@ func (c *Controller) renderShow(ctx context.Context, w http.ResponseWriter, r *h
 
 		maximumKeyVersions := c.db.MaxCertificateSigningKeyVersions()
 		m["maximumKeyVersions"] = maximumKeyVersions
+		m["signingAlgorithms"] = keyutils.Algorithms
 
 		publicKeys := make(map[string]string)
 		// Go through and load / parse all of the public keys for the realm.
@@ -57,7 +69,7 @@ func (c *Controller) renderShow(ctx context.Context, w http.ResponseWriter, r *h
 			if err != nil {
 				publicKeys[k.GetKID()] = fmt.Errorf("error loading public key: %v", err).Error()
 			} else {
-				pem, err := keyutils.EncodePublicKey(pk)
+				pem, _, err := keyutils.EncodePublicKey(pk)
 				if err != nil {
 					publicKeys[k.GetKID()] = fmt.Errorf("error decoding public key: %v", err).Error()
 				} else {
@@ -86,12 +98,13 @@ func (c *Controller) renderShow(ctx context.Context, w http.ResponseWriter, r *h
 			m["systemCertPublicKey"] = ""
 			m["systemCertPublicKeyError"] = fmt.Sprintf("Failed to load public key: %v", err)
 		} else {
-			pem, err := keyutils.EncodePublicKey(publicKey)
+			pem, alg, err := keyutils.EncodePublicKey(publicKey)
 			if err != nil {
 				m["systemCertPublicKey"] = ""
 				m["systemCertPublicKeyError"] = fmt.Sprintf("Failed to encode public key: %v", err)
 			} else {
 				m["systemCertPublicKey"] = pem
+				m["systemCertAlgorithm"] = alg
 			}
 		}
 	}
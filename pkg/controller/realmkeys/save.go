@@ -26,6 +26,9 @@ func (c *Controller) HandleSave() http.Handler {
 		Issuer         string `form:"certificateIssuer"`
 		Audience       string `form:"certificateAudience"`
 		DurationString string `form:"certificateDuration"`
+
+		RotationPeriodDays   uint `form:"certificateKeyRotationPeriodDays"`
+		RotationOverlapHours uint `form:"certificateKeyRotationOverlapHours"`
 	}
 
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -64,6 +67,12 @@ func (c *Controller) HandleSave() http.Handler {
 		// AsString delgates the duration parsing and validation to the model.
 		currentRealm.CertificateDuration.AsString = form.DurationString
 
+		// Automatic rotation is only available to realm-specific keys.
+		if currentRealm.UseRealmCertificateKey {
+			currentRealm.CertificateKeyRotationPeriodDays = form.RotationPeriodDays
+			currentRealm.CertificateKeyRotationOverlapHours = form.RotationOverlapHours
+		}
+
 		if err := c.db.SaveRealm(currentRealm, currentUser); err != nil {
 			flash.Error("Failed to update realm: %v", err)
 			c.renderShow(ctx, w, r, currentRealm)
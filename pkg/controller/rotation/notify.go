@@ -0,0 +1,93 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rotation
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+	"github.com/google/exposure-notifications-verification-server/pkg/pagination"
+	"github.com/google/exposure-notifications-verification-server/pkg/rbac"
+	"github.com/hashicorp/go-multierror"
+)
+
+// event is a single completed action against a realm's signing keys.
+type event struct {
+	action string
+	key    *database.SigningKey
+}
+
+// audit records the event in the realm's audit log.
+func (c *Controller) audit(realm *database.Realm, e *event) error {
+	audit := database.BuildAuditEntry(database.System, e.action, e.key, realm.ID)
+	if err := c.db.SaveAuditEntry(audit); err != nil {
+		return fmt.Errorf("failed to save audit entry: %w", err)
+	}
+	return nil
+}
+
+// notify emails the realm's settings administrators a summary of the events.
+// If the realm has no email configuration, it does nothing.
+func (c *Controller) notify(ctx context.Context, realm *database.Realm, events []*event) error {
+	emailer, err := realm.EmailProvider(c.db)
+	if err != nil {
+		if database.IsNotFound(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to create email provider: %w", err)
+	}
+
+	memberships, _, err := realm.ListMemberships(c.db, &pagination.PageParams{Limit: database.MaxPageSize},
+		database.WithPermissions(rbac.SettingsWrite))
+	if err != nil {
+		return fmt.Errorf("failed to list memberships: %w", err)
+	}
+
+	type keyEvent struct {
+		Action string
+		KID    string
+	}
+
+	keyEvents := make([]*keyEvent, 0, len(events))
+	for _, e := range events {
+		keyEvents = append(keyEvents, &keyEvent{
+			Action: e.action,
+			KID:    e.key.GetKID(),
+		})
+	}
+
+	var merr *multierror.Error
+	for _, m := range memberships {
+		message, err := c.h.RenderEmail("email/signingkeyrotation", map[string]interface{}{
+			"ToEmail":   m.User.Email,
+			"FromEmail": emailer.From(),
+			"RealmName": realm.Name,
+			"RealmID":   realm.ID,
+			"Events":    keyEvents,
+			"Overlap":   realm.CertificateKeyRotationOverlap(),
+			"RotatedAt": time.Now().UTC().Format(time.RFC1123),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to render rotation template: %w", err)
+		}
+
+		if err := emailer.SendEmail(ctx, m.User.Email, message); err != nil {
+			merr = multierror.Append(merr, fmt.Errorf("failed to send email to %s: %w", m.User.Email, err))
+		}
+	}
+	return merr.ErrorOrNil()
+}
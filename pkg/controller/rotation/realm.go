@@ -0,0 +1,199 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rotation
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/exposure-notifications-server/pkg/logging"
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+	"github.com/google/exposure-notifications-verification-server/pkg/keyutils"
+	"github.com/hashicorp/go-multierror"
+)
+
+// plan is the set of actions to take against a single realm's keys.
+type plan struct {
+	// Create indicates a new key version should be created and published.
+	Create bool
+
+	// Activate is the pending key which should become active, if any.
+	Activate *database.SigningKey
+
+	// Destroy is the list of superseded keys which are no longer needed to
+	// verify outstanding certificates.
+	Destroy []*database.SigningKey
+}
+
+// planRotation determines which actions to take for the realm given its keys,
+// which must be sorted newest first. It does not modify any state.
+//
+// The active key is rotated every rotation period. The next key is created and
+// published in the JWKS for the overlap period before it becomes active, and
+// superseded keys are destroyed once every certificate they signed has expired.
+func planRotation(realm *database.Realm, keys []*database.SigningKey, now time.Time) *plan {
+	var p plan
+
+	var active *database.SigningKey
+	for _, k := range keys {
+		if k.Active {
+			active = k
+			break
+		}
+	}
+
+	// There's nothing to rotate from. The realm must be upgraded manually first.
+	if active == nil {
+		return &p
+	}
+
+	// The pending key is the newest key which was created after the active key
+	// and has never been active.
+	var pending *database.SigningKey
+	for _, k := range keys {
+		if !k.Active && k.ActivatedAt == nil && k.CreatedAt.After(active.CreatedAt) {
+			pending = k
+			break
+		}
+	}
+
+	rotateAt := active.ActiveSince().Add(realm.CertificateKeyRotationPeriod())
+	overlap := realm.CertificateKeyRotationOverlap()
+
+	switch {
+	case pending == nil && !now.Before(rotateAt.Add(-overlap)):
+		p.Create = true
+	case pending != nil && !now.Before(rotateAt) && !now.Before(pending.CreatedAt.Add(overlap)):
+		p.Activate = pending
+	}
+
+	for _, k := range keys {
+		if k.Active || !k.CreatedAt.Before(active.CreatedAt) {
+			continue
+		}
+
+		// Keys superseded before tracking began were superseded no later than
+		// when the current key became active.
+		inactiveSince := active.ActiveSince()
+		if k.DeactivatedAt != nil {
+			inactiveSince = *k.DeactivatedAt
+		}
+
+		if !now.Before(inactiveSince.Add(realm.CertificateDuration.Duration)) {
+			p.Destroy = append(p.Destroy, k)
+		}
+	}
+
+	return &p
+}
+
+// rotateRealm rotates the keys for a single realm. Superseded keys are
+// destroyed first so that creating a new version does not exceed the maximum
+// number of key versions.
+func (c *Controller) rotateRealm(ctx context.Context, id uint64) error {
+	logger := logging.FromContext(ctx).Named("rotation.rotateRealm").With("realm_id", id)
+
+	realm, err := c.db.FindRealm(id)
+	if err != nil {
+		return fmt.Errorf("failed to find realm: %w", err)
+	}
+
+	keys, err := realm.ListSigningKeys(c.db)
+	if err != nil {
+		return fmt.Errorf("failed to list signing keys: %w", err)
+	}
+
+	p := planRotation(realm, keys, time.Now().UTC())
+
+	var merr *multierror.Error
+	var events []*event
+
+	for _, k := range p.Destroy {
+		if err := realm.DestroySigningKeyVersion(ctx, c.db, k.ID); err != nil {
+			merr = multierror.Append(merr, fmt.Errorf("failed to destroy %s: %w", k.GetKID(), err))
+			continue
+		}
+		logger.Infow("destroyed signing key", "kid", k.GetKID())
+		events = append(events, &event{action: "destroyed signing key", key: k})
+	}
+
+	if k := p.Activate; k != nil {
+		kid, err := realm.SetActiveSigningKey(c.db, k.ID)
+		if err != nil {
+			merr = multierror.Append(merr, fmt.Errorf("failed to activate %s: %w", k.GetKID(), err))
+		} else {
+			logger.Infow("activated signing key", "kid", kid)
+			events = append(events, &event{action: "activated signing key", key: k})
+		}
+	}
+
+	if p.Create {
+		k, err := c.createSigningKey(ctx, realm, rotationAlgorithm(keys))
+		if err != nil {
+			merr = multierror.Append(merr, err)
+		} else {
+			logger.Infow("created signing key", "kid", k.GetKID())
+			events = append(events, &event{action: "created signing key", key: k})
+		}
+	}
+
+	for _, e := range events {
+		if err := c.audit(realm, e); err != nil {
+			merr = multierror.Append(merr, err)
+		}
+	}
+
+	if len(events) > 0 {
+		if err := c.notify(ctx, realm, events); err != nil {
+			// Notifications are best-effort, the rotation itself succeeded.
+			logger.Errorw("failed to notify realm admins", "error", err)
+		}
+	}
+
+	return merr.ErrorOrNil()
+}
+
+// rotationAlgorithm returns the algorithm to use for a replacement key. Rotation
+// preserves the algorithm of the active key so key servers do not need to
+// support a new algorithm just because the key rotated.
+func rotationAlgorithm(keys []*database.SigningKey) keyutils.Algorithm {
+	for _, k := range keys {
+		if k.Active {
+			return k.SigningAlgorithm()
+		}
+	}
+	return keyutils.AlgorithmES256
+}
+
+// createSigningKey creates a new signing key version for the realm with the
+// given algorithm and returns the new key.
+func (c *Controller) createSigningKey(ctx context.Context, realm *database.Realm, alg keyutils.Algorithm) (*database.SigningKey, error) {
+	kid, err := realm.CreateSigningKeyVersion(ctx, c.db, alg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create signing key: %w", err)
+	}
+
+	keys, err := realm.ListSigningKeys(c.db)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list signing keys: %w", err)
+	}
+	for _, k := range keys {
+		if k.GetKID() == kid {
+			return k, nil
+		}
+	}
+	return nil, fmt.Errorf("created signing key %s, but failed to find it", kid)
+}
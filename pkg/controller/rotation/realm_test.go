@@ -0,0 +1,174 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rotation
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+	"github.com/google/exposure-notifications-verification-server/pkg/keyutils"
+	"github.com/jinzhu/gorm"
+)
+
+func TestPlanRotation(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2020, 12, 1, 12, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+
+	realm := database.NewRealmWithDefaults("rotation")
+	realm.UseRealmCertificateKey = true
+	realm.CertificateKeyRotationPeriodDays = 30
+	realm.CertificateKeyRotationOverlapHours = 24
+
+	key := func(id uint, created time.Time, active bool, activated, deactivated *time.Time) *database.SigningKey {
+		return &database.SigningKey{
+			Model:         gorm.Model{ID: id, CreatedAt: created},
+			RealmID:       realm.ID,
+			Active:        active,
+			ActivatedAt:   activated,
+			DeactivatedAt: deactivated,
+		}
+	}
+	ptr := func(t time.Time) *time.Time { return &t }
+
+	cases := []struct {
+		name     string
+		keys     []*database.SigningKey
+		create   bool
+		activate uint
+		destroy  []uint
+	}{
+		{
+			name: "no_keys",
+		},
+		{
+			name: "not_due",
+			keys: []*database.SigningKey{
+				key(1, now.Add(-10*day), true, ptr(now.Add(-10*day)), nil),
+			},
+		},
+		{
+			name: "publish_next",
+			keys: []*database.SigningKey{
+				key(1, now.Add(-29*day-time.Hour), true, ptr(now.Add(-29*day-time.Hour)), nil),
+			},
+			create: true,
+		},
+		{
+			name: "activation_falls_back_to_created",
+			keys: []*database.SigningKey{
+				key(1, now.Add(-40*day), true, nil, nil),
+			},
+			create: true,
+		},
+		{
+			name: "pending_not_due",
+			keys: []*database.SigningKey{
+				key(2, now.Add(-12*time.Hour), false, nil, nil),
+				key(1, now.Add(-29*day-time.Hour), true, ptr(now.Add(-29*day-time.Hour)), nil),
+			},
+		},
+		{
+			name: "pending_overlap_not_elapsed",
+			keys: []*database.SigningKey{
+				key(2, now.Add(-12*time.Hour), false, nil, nil),
+				key(1, now.Add(-31*day), true, ptr(now.Add(-31*day)), nil),
+			},
+		},
+		{
+			name: "activate_pending",
+			keys: []*database.SigningKey{
+				key(2, now.Add(-25*time.Hour), false, nil, nil),
+				key(1, now.Add(-31*day), true, ptr(now.Add(-31*day)), nil),
+			},
+			activate: 2,
+		},
+		{
+			name: "destroy_after_certificate_duration",
+			keys: []*database.SigningKey{
+				key(3, now.Add(-2*day), true, ptr(now.Add(-time.Hour)), nil),
+				key(2, now.Add(-32*day), false, ptr(now.Add(-31*day)), ptr(now.Add(-time.Hour))),
+				key(1, now.Add(-62*day), false, ptr(now.Add(-61*day)), ptr(now.Add(-31*day))),
+			},
+			destroy: []uint{1, 2},
+		},
+		{
+			name: "keep_within_certificate_duration",
+			keys: []*database.SigningKey{
+				key(2, now.Add(-2*day), true, ptr(now.Add(-5*time.Minute)), nil),
+				key(1, now.Add(-32*day), false, ptr(now.Add(-31*day)), ptr(now.Add(-5*time.Minute))),
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			p := planRotation(realm, tc.keys, now)
+
+			if got, want := p.Create, tc.create; got != want {
+				t.Errorf("expected create to be %t, got %t", want, got)
+			}
+
+			var activate uint
+			if p.Activate != nil {
+				activate = p.Activate.ID
+			}
+			if got, want := activate, tc.activate; got != want {
+				t.Errorf("expected activate to be %d, got %d", want, got)
+			}
+
+			destroy := make([]uint, 0, len(p.Destroy))
+			for _, k := range p.Destroy {
+				destroy = append(destroy, k.ID)
+			}
+			if got, want := len(destroy), len(tc.destroy); got != want {
+				t.Fatalf("expected %d keys to be destroyed, got %d (%v)", want, got, destroy)
+			}
+			for _, id := range tc.destroy {
+				found := false
+				for _, d := range destroy {
+					if d == id {
+						found = true
+					}
+				}
+				if !found {
+					t.Errorf("expected %d to be destroyed in %v", id, destroy)
+				}
+			}
+		})
+	}
+}
+
+func TestRotationAlgorithm(t *testing.T) {
+	t.Parallel()
+
+	if got, want := rotationAlgorithm(nil), keyutils.AlgorithmES256; got != want {
+		t.Errorf("expected %q to be %q", got, want)
+	}
+
+	keys := []*database.SigningKey{
+		{Algorithm: "ES256"},
+		{Algorithm: "ES384", Active: true},
+	}
+	if got, want := rotationAlgorithm(keys), keyutils.AlgorithmES384; got != want {
+		t.Errorf("expected %q to be %q", got, want)
+	}
+}
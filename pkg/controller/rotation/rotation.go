@@ -0,0 +1,134 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package rotation implements periodic rotation of verification token signing
+// keys and realm certificate signing keys.
+package rotation
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/exposure-notifications-server/pkg/logging"
+	"github.com/google/exposure-notifications-verification-server/pkg/config"
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+	"github.com/google/exposure-notifications-verification-server/pkg/render"
+	"github.com/hashicorp/go-multierror"
+)
+
+// lockName is the name of the lock in the cleanup_statuses table which
+// prevents concurrent rotation runs.
+const lockName = "realm_key_rotation"
+
+// Controller is a controller for the rotation service.
+type Controller struct {
+	config *config.RotationConfig
+	db     *database.Database
+	h      render.Renderer
+}
+
+// New creates a new rotation controller.
+func New(ctx context.Context, config *config.RotationConfig, db *database.Database, h render.Renderer) *Controller {
+	return &Controller{
+		config: config,
+		db:     db,
+		h:      h,
+	}
+}
+
+// HandleRotate accepts an HTTP trigger and rotates the verification token
+// signing keys and the certificate signing keys of all realms which have
+// automatic rotation enabled.
+func (c *Controller) HandleRotate() http.Handler {
+	type RotateResult struct {
+		OK     bool    `json:"ok"`
+		Errors []error `json:"errors,omitempty"`
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		logger := logging.FromContext(ctx).Named("rotation.HandleRotate")
+
+		if err := c.claimLock(); err != nil {
+			logger.Errorw("failed to claim rotation lock", "error", err)
+			c.h.RenderJSON(w, http.StatusInternalServerError, &RotateResult{
+				OK:     false,
+				Errors: []error{err},
+			})
+			return
+		}
+
+		var merr *multierror.Error
+		if err := c.rotateTokenSigningKeys(ctx); err != nil {
+			merr = multierror.Append(merr, fmt.Errorf("failed to rotate token signing keys: %w", err))
+		}
+		if err := c.rotateRealms(ctx); err != nil {
+			merr = multierror.Append(merr, err)
+		}
+
+		if err := merr.ErrorOrNil(); err != nil {
+			logger.Errorw("failed to rotate keys", "error", err)
+			c.h.RenderJSON(w, http.StatusInternalServerError, &RotateResult{
+				OK:     false,
+				Errors: merr.WrappedErrors(),
+			})
+			return
+		}
+
+		c.h.RenderJSON(w, http.StatusOK, &RotateResult{
+			OK: true,
+		})
+	})
+}
+
+// claimLock attempts to claim the rotation lock for the configured minimum TTL.
+func (c *Controller) claimLock() error {
+	cStat, err := c.db.CreateCleanup(lockName)
+	if err != nil {
+		return fmt.Errorf("failed to create lock: %w", err)
+	}
+
+	if cStat.NotBefore.After(time.Now().UTC()) {
+		return fmt.Errorf("skipping rotation, no rotation before %v", cStat.NotBefore)
+	}
+
+	if _, err := c.db.ClaimCleanup(cStat, c.config.MinTTL); err != nil {
+		return fmt.Errorf("failed to claim lock: %w", err)
+	}
+	return nil
+}
+
+// rotateRealms iterates over all realms with automatic rotation enabled and
+// rotates their keys as necessary.
+func (c *Controller) rotateRealms(ctx context.Context) error {
+	logger := logging.FromContext(ctx).Named("rotation.rotateRealms")
+
+	ids, err := c.db.CertificateKeyRotationEnabledRealmIDs()
+	if err != nil {
+		return fmt.Errorf("failed to fetch ids: %w", err)
+	}
+	logger.Debugw("rotating realm keys", "count", len(ids))
+
+	var merr *multierror.Error
+	for _, id := range ids {
+		if err := c.rotateRealm(ctx, id); err != nil {
+			merr = multierror.Append(merr, fmt.Errorf("failed to rotate realm %d: %w", id, err))
+		}
+	}
+
+	return merr.ErrorOrNil()
+}
@@ -0,0 +1,109 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rotation
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/exposure-notifications-server/pkg/logging"
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+	"github.com/hashicorp/go-multierror"
+)
+
+// tokenPlan is the set of actions to take on the verification token signing
+// keys.
+type tokenPlan struct {
+	// Create indicates a new key version should be created and activated.
+	Create bool
+
+	// Destroy is the list of retired keys which are no longer needed to verify
+	// outstanding tokens.
+	Destroy []*database.TokenSigningKey
+}
+
+// planTokenRotation determines the rotation actions for the given token
+// signing keys at the given time. Unlike realm certificate signing keys, token
+// signing keys are activated immediately: the verifier discovers new keys
+// through the database, so there is no need to pre-publish them.
+func planTokenRotation(keys []*database.TokenSigningKey, now time.Time, maxAge, retention time.Duration) *tokenPlan {
+	var p tokenPlan
+
+	var active *database.TokenSigningKey
+	for _, k := range keys {
+		if k.Active {
+			active = k
+			break
+		}
+	}
+
+	if active == nil || !now.Before(active.ActiveSince().Add(maxAge)) {
+		p.Create = true
+	}
+
+	for _, k := range keys {
+		if k.Active || k.DeactivatedAt == nil {
+			continue
+		}
+		if !now.Before(k.DeactivatedAt.Add(retention)) {
+			p.Destroy = append(p.Destroy, k)
+		}
+	}
+
+	return &p
+}
+
+// rotateTokenSigningKeys rotates the system verification token signing keys.
+// It does nothing if no keyring is configured for token signing keys.
+func (c *Controller) rotateTokenSigningKeys(ctx context.Context) error {
+	logger := logging.FromContext(ctx).Named("rotation.rotateTokenSigningKeys")
+
+	if c.config.Database.TokenSigningKeyRing == "" {
+		logger.Debugw("skipping token signing key rotation, no keyring configured")
+		return nil
+	}
+
+	keys, err := c.db.ListTokenSigningKeys()
+	if err != nil {
+		return fmt.Errorf("failed to list token signing keys: %w", err)
+	}
+
+	p := planTokenRotation(keys, time.Now().UTC(), c.config.TokenSigningKeyMaxAge, c.config.TokenSigningKeyRetention)
+
+	var merr *multierror.Error
+	for _, k := range p.Destroy {
+		if err := c.db.DestroyTokenSigningKeyVersion(ctx, k.ID, database.System); err != nil {
+			merr = multierror.Append(merr, fmt.Errorf("failed to destroy %s: %w", k.GetKID(), err))
+			continue
+		}
+		logger.Infow("destroyed token signing key", "kid", k.GetKID())
+	}
+
+	if p.Create {
+		key, err := c.db.CreateTokenSigningKeyVersion(ctx, database.System)
+		if err != nil {
+			return multierror.Append(merr, err)
+		}
+		if !key.Active {
+			if _, err := c.db.ActivateTokenSigningKey(key.ID, database.System); err != nil {
+				return multierror.Append(merr, fmt.Errorf("failed to activate %s: %w", key.GetKID(), err))
+			}
+		}
+		logger.Infow("rotated token signing key", "kid", key.GetKID())
+	}
+
+	return merr.ErrorOrNil()
+}
@@ -0,0 +1,145 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rotation
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+	"github.com/jinzhu/gorm"
+)
+
+func TestPlanTokenRotation(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2020, 12, 1, 12, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+	maxAge := 30 * day
+	retention := 2 * day
+
+	key := func(id uint, active bool, activated, deactivated *time.Time) *database.TokenSigningKey {
+		return &database.TokenSigningKey{
+			Model:         gorm.Model{ID: id, CreatedAt: now.Add(-100 * day)},
+			Active:        active,
+			ActivatedAt:   activated,
+			DeactivatedAt: deactivated,
+		}
+	}
+	ptr := func(t time.Time) *time.Time { return &t }
+
+	cases := []struct {
+		name    string
+		keys    []*database.TokenSigningKey
+		create  bool
+		destroy []uint
+	}{
+		{
+			name:   "no_keys",
+			create: true,
+		},
+		{
+			name: "no_active_key",
+			keys: []*database.TokenSigningKey{
+				key(1, false, ptr(now.Add(-40*day)), ptr(now.Add(-time.Hour))),
+			},
+			create: true,
+		},
+		{
+			name: "not_due",
+			keys: []*database.TokenSigningKey{
+				key(1, true, ptr(now.Add(-10*day)), nil),
+			},
+		},
+		{
+			name: "due",
+			keys: []*database.TokenSigningKey{
+				key(1, true, ptr(now.Add(-30*day)), nil),
+			},
+			create: true,
+		},
+		{
+			name: "imported_without_activation",
+			keys: []*database.TokenSigningKey{
+				key(1, true, nil, nil),
+			},
+			create: true,
+		},
+		{
+			name: "destroy_retired",
+			keys: []*database.TokenSigningKey{
+				key(3, true, ptr(now.Add(-time.Hour)), nil),
+				key(2, false, ptr(now.Add(-31*day)), ptr(now.Add(-time.Hour))),
+				key(1, false, ptr(now.Add(-61*day)), ptr(now.Add(-31*day))),
+			},
+			destroy: []uint{1},
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			p := planTokenRotation(tc.keys, now, maxAge, retention)
+
+			if got, want := p.Create, tc.create; got != want {
+				t.Errorf("expected create to be %t, got %t", want, got)
+			}
+
+			if got, want := len(p.Destroy), len(tc.destroy); got != want {
+				t.Fatalf("expected %d keys to be destroyed, got %d", want, got)
+			}
+			for i, k := range p.Destroy {
+				if got, want := k.ID, tc.destroy[i]; got != want {
+					t.Errorf("expected %d to be destroyed, got %d", want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestPlanTokenRotation_ImportedKeys(t *testing.T) {
+	t.Parallel()
+
+	db, _ := testDatabaseInstance.NewDatabase(t, nil)
+
+	if err := db.ImportTokenSigningKeys([]string{"key1", "key2"}, []string{"v1", "v2"}); err != nil {
+		t.Fatal(err)
+	}
+	keys, err := db.ListTokenSigningKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	maxAge := 30 * 24 * time.Hour
+	retention := 2 * 24 * time.Hour
+
+	// The imported inactive key is kept for the retention period.
+	p := planTokenRotation(keys, time.Now().UTC(), maxAge, retention)
+	if got := len(p.Destroy); got != 0 {
+		t.Errorf("expected no keys to be destroyed yet, got %d", got)
+	}
+
+	// After the retention period, it is destroyed.
+	p = planTokenRotation(keys, time.Now().UTC().Add(retention+time.Minute), maxAge, retention)
+	if got, want := len(p.Destroy), 1; got != want {
+		t.Fatalf("expected %d keys to be destroyed, got %d", want, got)
+	}
+	if got, want := p.Destroy[0].GetKID(), "v2"; got != want {
+		t.Errorf("expected %q to be destroyed, got %q", want, got)
+	}
+}
@@ -0,0 +1,102 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sites
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/google/exposure-notifications-verification-server/pkg/controller"
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+	"github.com/google/exposure-notifications-verification-server/pkg/rbac"
+)
+
+func (c *Controller) HandleCreate() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		session := controller.SessionFromContext(ctx)
+		if session == nil {
+			controller.MissingSession(w, r, c.h)
+			return
+		}
+		flash := controller.Flash(session)
+
+		membership := controller.MembershipFromContext(ctx)
+		if membership == nil {
+			controller.MissingMembership(w, r, c.h)
+			return
+		}
+		if !membership.Can(rbac.SettingsWrite) {
+			controller.Unauthorized(w, r, c.h)
+			return
+		}
+		currentRealm := membership.Realm
+		currentUser := membership.User
+
+		// Requested form, stop processing.
+		var site database.Site
+		if r.Method == http.MethodGet {
+			c.renderNew(ctx, w, &site)
+			return
+		}
+
+		if err := bindForm(r, &site); err != nil {
+			site.AddError("", err.Error())
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			c.renderNew(ctx, w, &site)
+			return
+		}
+
+		site.RealmID = currentRealm.ID
+		if err := c.db.SaveSite(&site, currentUser); err != nil {
+			if database.IsValidationError(err) {
+				w.WriteHeader(http.StatusUnprocessableEntity)
+				c.renderNew(ctx, w, &site)
+				return
+			}
+
+			controller.InternalError(w, r, c.h, err)
+			return
+		}
+
+		flash.Alert("Successfully created site %q", site.Name)
+		http.Redirect(w, r, fmt.Sprintf("/realm/sites/%d", site.ID), http.StatusSeeOther)
+	})
+}
+
+// bindForm binds the site form, which is the same for create and update.
+func bindForm(r *http.Request, site *database.Site) error {
+	type FormData struct {
+		Name           string `form:"name"`
+		Description    string `form:"description"`
+		DailyCodeLimit uint   `form:"daily_code_limit"`
+	}
+
+	var form FormData
+	err := controller.BindForm(nil, r, &form)
+	site.Name = form.Name
+	site.Description = form.Description
+	site.DailyCodeLimit = form.DailyCodeLimit
+	return err
+}
+
+func (c *Controller) renderNew(ctx context.Context, w http.ResponseWriter, site *database.Site) {
+	m := controller.TemplateMapFromContext(ctx)
+	m.Title("New site")
+	m["site"] = site
+	c.h.RenderHTML(w, "sites/new", m)
+}
@@ -0,0 +1,95 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sites
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/google/exposure-notifications-verification-server/pkg/controller"
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+	"github.com/google/exposure-notifications-verification-server/pkg/rbac"
+	"github.com/gorilla/mux"
+)
+
+// HandleDisable disables the site. Disabled sites cannot be named in issue
+// requests, but their codes and statistics are kept.
+func (c *Controller) HandleDisable() http.Handler {
+	return c.handleSetEnabled(false)
+}
+
+// HandleEnable re-enables a disabled site.
+func (c *Controller) HandleEnable() http.Handler {
+	return c.handleSetEnabled(true)
+}
+
+func (c *Controller) handleSetEnabled(enabled bool) http.Handler {
+	action := "disable"
+	if enabled {
+		action = "enable"
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		vars := mux.Vars(r)
+
+		session := controller.SessionFromContext(ctx)
+		if session == nil {
+			controller.MissingSession(w, r, c.h)
+			return
+		}
+		flash := controller.Flash(session)
+
+		membership := controller.MembershipFromContext(ctx)
+		if membership == nil {
+			controller.MissingMembership(w, r, c.h)
+			return
+		}
+		if !membership.Can(rbac.SettingsWrite) {
+			controller.Unauthorized(w, r, c.h)
+			return
+		}
+
+		currentRealm := membership.Realm
+		currentUser := membership.User
+
+		site, err := currentRealm.FindSite(c.db, vars["id"])
+		if err != nil {
+			if database.IsNotFound(err) {
+				controller.Unauthorized(w, r, c.h)
+				return
+			}
+
+			controller.InternalError(w, r, c.h, err)
+			return
+		}
+
+		if enabled {
+			site.DeletedAt = nil
+		} else {
+			now := time.Now().UTC()
+			site.DeletedAt = &now
+		}
+
+		if err := c.db.SaveSite(site, currentUser); err != nil {
+			flash.Error("Failed to %s site: %v", action, err)
+			http.Redirect(w, r, "/realm/sites", http.StatusSeeOther)
+			return
+		}
+
+		flash.Alert("Successfully %sd site %q", action, site.Name)
+		http.Redirect(w, r, "/realm/sites", http.StatusSeeOther)
+	})
+}
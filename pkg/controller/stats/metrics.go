@@ -0,0 +1,185 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stats
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/exposure-notifications-server/pkg/logging"
+	"github.com/google/exposure-notifications-verification-server/pkg/cache"
+	"github.com/google/exposure-notifications-verification-server/pkg/controller"
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+)
+
+const (
+	// metricsContentType is the content type of the Prometheus text exposition
+	// format.
+	metricsContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+	// metricsPrefix is prepended to the name of every exported metric.
+	metricsPrefix = "en_verification_realm_"
+
+	// metricsCacheTTL is how long the statistics behind the metrics are cached.
+	// Scrapers usually poll more frequently than this.
+	metricsCacheTTL = 1 * time.Minute
+)
+
+// metricFamily is a named gauge with one sample per realm.
+type metricFamily struct {
+	name    string
+	help    string
+	samples []*metricSample
+}
+
+// metricSample is a single value of a metric for a realm.
+type metricSample struct {
+	realm *database.Realm
+	value float64
+}
+
+// HandleMetrics renders the current day's statistics for the current realm and
+// every realm below it in the hierarchy as gauges in the Prometheus text
+// exposition format. The values reset at midnight in each realm's timezone.
+func (c *Controller) HandleMetrics() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		logger := logging.FromContext(ctx).Named("stats.HandleMetrics")
+
+		currentRealm, ok := authorizeFromContext(ctx)
+		if !ok {
+			controller.Unauthorized(w, r, c.h)
+			return
+		}
+
+		descendants, err := currentRealm.ListDescendantRealms(c.db)
+		if err != nil {
+			controller.InternalError(w, r, c.h, err)
+			return
+		}
+		realms := append([]*database.Realm{currentRealm}, descendants...)
+
+		var current map[uint]*database.RealmStat
+		cacheKey := &cache.Key{
+			Namespace: "stats:metrics",
+			Key:       strconv.FormatUint(uint64(currentRealm.ID), 10),
+		}
+		if err := c.cacher.Fetch(ctx, cacheKey, &current, metricsCacheTTL, func() (interface{}, error) {
+			return c.db.CurrentRealmStats(realms)
+		}); err != nil {
+			controller.InternalError(w, r, c.h, err)
+			return
+		}
+
+		codesIssued := &metricFamily{name: "codes_issued", help: "Codes issued today."}
+		codesClaimed := &metricFamily{name: "codes_claimed", help: "Codes issued today that have been claimed."}
+		tokensClaimed := &metricFamily{name: "tokens_claimed", help: "Verification tokens issued today that have been exchanged for a certificate."}
+		smsFailed := &metricFamily{name: "sms_failed", help: "Codes issued today whose SMS failed to send."}
+		dailyActiveUsers := &metricFamily{name: "daily_active_users", help: "Daily active users today."}
+		claimMeanAge := &metricFamily{name: "code_claim_mean_age_seconds", help: "Mean time between issuing and claiming codes issued today."}
+		quotaLimit := &metricFamily{name: "quota_limit", help: "Daily code issuance quota, for realms with abuse prevention enabled."}
+		quotaRemaining := &metricFamily{name: "quota_remaining", help: "Remaining daily code issuance quota, for realms with abuse prevention enabled."}
+
+		for _, realm := range realms {
+			stat, ok := current[realm.ID]
+			if !ok {
+				stat = &database.RealmStat{RealmID: realm.ID}
+			}
+
+			codesIssued.add(realm, float64(stat.CodesIssued))
+			codesClaimed.add(realm, float64(stat.CodesClaimed))
+			tokensClaimed.add(realm, float64(stat.TokensClaimed))
+			smsFailed.add(realm, float64(stat.SMSFailed))
+			dailyActiveUsers.add(realm, float64(stat.DailyActiveUsers))
+			claimMeanAge.add(realm, stat.CodeClaimMeanAge().Seconds())
+
+			if !realm.AbusePreventionEnabled || c.limiter == nil {
+				continue
+			}
+
+			limit, remaining, err := c.realmQuota(ctx, realm)
+			if err != nil {
+				// Quota is best-effort, since the limiter is not the source of truth
+				// for any of the other metrics.
+				logger.Errorw("failed to get realm quota", "realm", realm.ID, "error", err)
+				continue
+			}
+			quotaLimit.add(realm, float64(limit))
+			quotaRemaining.add(realm, float64(remaining))
+		}
+
+		families := []*metricFamily{
+			codesIssued, codesClaimed, tokensClaimed, smsFailed,
+			dailyActiveUsers, claimMeanAge, quotaLimit, quotaRemaining,
+		}
+
+		var b bytes.Buffer
+		for _, f := range families {
+			f.write(&b)
+		}
+
+		w.Header().Set("Content-Type", metricsContentType)
+		w.WriteHeader(http.StatusOK)
+		if _, err := b.WriteTo(w); err != nil {
+			logger.Errorw("failed to write metrics to response", "error", err)
+		}
+	})
+}
+
+// realmQuota returns the quota limit and remaining quota for the realm.
+func (c *Controller) realmQuota(ctx context.Context, realm *database.Realm) (uint64, uint64, error) {
+	key, err := realm.QuotaKey(c.hmacKey)
+	if err != nil {
+		return 0, 0, err
+	}
+	return c.limiter.Get(ctx, key)
+}
+
+// add appends a sample for the realm.
+func (f *metricFamily) add(realm *database.Realm, value float64) {
+	f.samples = append(f.samples, &metricSample{realm: realm, value: value})
+}
+
+// write writes the family in the Prometheus text exposition format. Families
+// without samples are omitted.
+func (f *metricFamily) write(w io.Writer) {
+	if len(f.samples) == 0 {
+		return
+	}
+
+	name := metricsPrefix + f.name
+	fmt.Fprintf(w, "# HELP %s %s\n", name, f.help)
+	fmt.Fprintf(w, "# TYPE %s gauge\n", name)
+	for _, s := range f.samples {
+		fmt.Fprintf(w, "%s{realm_id=\"%d\",realm_name=\"%s\"} %s\n", name,
+			s.realm.ID, escapeLabelValue(s.realm.Name), strconv.FormatFloat(s.value, 'g', -1, 64))
+	}
+}
+
+// labelValueEscaper escapes label values as required by the text exposition
+// format.
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// escapeLabelValue escapes the label value.
+func escapeLabelValue(s string) string {
+	return labelValueEscaper.Replace(s)
+}
@@ -0,0 +1,86 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stats
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/google/exposure-notifications-verification-server/pkg/controller"
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+	"github.com/gorilla/mux"
+)
+
+// HandlePublicRealmStats renders the published statistics for a realm. It does
+// not require authentication, so it only serves realms that have enabled public
+// statistics, and the counts are transformed with the realm's publishing
+// settings. Only complete periods that have ended are published.
+func (c *Controller) HandlePublicRealmStats(typ StatsType) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		vars := mux.Vars(r)
+
+		realm, err := c.db.FindRealm(vars["realm_id"])
+		if err != nil {
+			if database.IsNotFound(err) {
+				controller.NotFound(w, r, c.h)
+				return
+			}
+
+			controller.InternalError(w, r, c.h, err)
+			return
+		}
+
+		// Without a key, the noise could not be kept secret.
+		if !realm.PublicStatsEnabled || !realm.IsActive() || len(c.publicStatsKey) == 0 {
+			controller.NotFound(w, r, c.h)
+			return
+		}
+
+		sr, err := statsRangeFromRequest(r, realm)
+		if err != nil {
+			c.renderBadRequest(w, typ, err)
+			return
+		}
+
+		// Only publish complete periods that have ended. The current day's
+		// counts change with every code issued, which would reveal individual
+		// codes, and periods which do not align to the granularity could be
+		// compared to remove the noise.
+		yesterday := realm.StatsDate(time.Now()).Add(-24 * time.Hour)
+		sr, err = sr.CompletePeriods(yesterday)
+		if err != nil {
+			c.renderBadRequest(w, typ, err)
+			return
+		}
+
+		stats, err := realm.StatsInRangeCached(ctx, c.db, c.cacher, sr)
+		if err != nil {
+			controller.InternalError(w, r, c.h, err)
+			return
+		}
+
+		published := stats.Publish(realm, sr.Granularity, c.publicStatsKey)
+
+		switch typ {
+		case StatsTypeCSV:
+			c.h.RenderCSV(w, http.StatusOK, csvFilename("public-realm-stats"), published)
+		case StatsTypeJSON:
+			c.h.RenderJSON(w, http.StatusOK, published)
+		default:
+			controller.NotFound(w, r, c.h)
+		}
+	})
+}
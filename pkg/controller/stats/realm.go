@@ -19,9 +19,12 @@ import (
 	"net/http"
 
 	"github.com/google/exposure-notifications-verification-server/pkg/controller"
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+	"github.com/gorilla/mux"
 )
 
-// HandleRealmStats renders statistics for the current realm.
+// HandleRealmStats renders statistics for the current realm. The range and
+// granularity can be set with the start, end, and granularity query parameters.
 func (c *Controller) HandleRealmStats(typ StatsType) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		ctx := r.Context()
@@ -32,7 +35,13 @@ func (c *Controller) HandleRealmStats(typ StatsType) http.Handler {
 			return
 		}
 
-		stats, err := currentRealm.StatsCached(ctx, c.db, c.cacher)
+		sr, err := statsRangeFromRequest(r, currentRealm)
+		if err != nil {
+			c.renderBadRequest(w, typ, err)
+			return
+		}
+
+		stats, err := currentRealm.StatsInRangeCached(ctx, c.db, c.cacher, sr)
 		if err != nil {
 			controller.InternalError(w, r, c.h, err)
 			return
@@ -40,10 +49,10 @@ func (c *Controller) HandleRealmStats(typ StatsType) http.Handler {
 
 		switch typ {
 		case StatsTypeCSV:
-			c.h.RenderCSV(w, http.StatusOK, csvFilename("realm-stats"), stats)
+			c.renderCSV(w, r, currentRealm, currentRealm, "realm-stats", stats)
 			return
 		case StatsTypeJSON:
-			c.h.RenderJSON(w, http.StatusOK, stats)
+			c.renderJSON(w, r, currentRealm, currentRealm, stats)
 			return
 		default:
 			controller.NotFound(w, r, c.h)
@@ -51,3 +60,76 @@ func (c *Controller) HandleRealmStats(typ StatsType) http.Handler {
 		}
 	})
 }
+
+// HandleRealmRollupStats renders statistics for the current realm and every
+// realm below it in the hierarchy, summed by date.
+func (c *Controller) HandleRealmRollupStats(typ StatsType) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		currentRealm, ok := authorizeFromContext(ctx)
+		if !ok {
+			controller.Unauthorized(w, r, c.h)
+			return
+		}
+
+		stats, err := currentRealm.RollupStatsCached(ctx, c.db, c.cacher)
+		if err != nil {
+			controller.InternalError(w, r, c.h, err)
+			return
+		}
+
+		c.renderRealmStats(w, r, typ, currentRealm, currentRealm, "realm-rollup-stats", stats)
+	})
+}
+
+// HandleChildRealmStats renders statistics for a realm below the current realm
+// in the hierarchy.
+func (c *Controller) HandleChildRealmStats(typ StatsType) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		vars := mux.Vars(r)
+
+		currentRealm, ok := authorizeFromContext(ctx)
+		if !ok {
+			controller.Unauthorized(w, r, c.h)
+			return
+		}
+
+		childRealm, err := currentRealm.FindDescendantRealm(c.db, vars["realm_id"])
+		if err != nil {
+			if database.IsNotFound(err) {
+				controller.NotFound(w, r, c.h)
+				return
+			}
+
+			controller.InternalError(w, r, c.h, err)
+			return
+		}
+
+		sr, err := statsRangeFromRequest(r, childRealm)
+		if err != nil {
+			c.renderBadRequest(w, typ, err)
+			return
+		}
+
+		stats, err := childRealm.StatsInRangeCached(ctx, c.db, c.cacher, sr)
+		if err != nil {
+			controller.InternalError(w, r, c.h, err)
+			return
+		}
+
+		c.renderRealmStats(w, r, typ, currentRealm, childRealm, "realm-stats", stats)
+	})
+}
+
+func (c *Controller) renderRealmStats(w http.ResponseWriter, r *http.Request, typ StatsType, realm, target *database.Realm, name string, stats database.RealmStats) {
+	switch typ {
+	case StatsTypeCSV:
+		c.renderCSV(w, r, realm, target, name, stats)
+	case StatsTypeJSON:
+		c.renderJSON(w, r, realm, target, stats)
+	default:
+		controller.NotFound(w, r, c.h)
+	}
+}
@@ -0,0 +1,88 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stats
+
+import (
+	"net/http"
+
+	"github.com/google/exposure-notifications-verification-server/pkg/controller"
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+	"github.com/gorilla/mux"
+)
+
+// HandleRealmSiteStats renders per-site statistics for the current realm.
+func (c *Controller) HandleRealmSiteStats(typ StatsType) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		currentRealm, ok := authorizeFromContext(ctx)
+		if !ok {
+			controller.Unauthorized(w, r, c.h)
+			return
+		}
+
+		stats, err := currentRealm.SiteStatsCached(ctx, c.db, c.cacher)
+		if err != nil {
+			controller.InternalError(w, r, c.h, err)
+			return
+		}
+
+		c.renderSiteStats(w, r, typ, currentRealm, currentRealm, "site-stats", stats)
+	})
+}
+
+// HandleSiteStats renders statistics for a single site in the current realm.
+func (c *Controller) HandleSiteStats(typ StatsType) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		vars := mux.Vars(r)
+
+		currentRealm, ok := authorizeFromContext(ctx)
+		if !ok {
+			controller.Unauthorized(w, r, c.h)
+			return
+		}
+
+		site, err := currentRealm.FindSite(c.db, vars["site_id"])
+		if err != nil {
+			if database.IsNotFound(err) {
+				controller.NotFound(w, r, c.h)
+				return
+			}
+
+			controller.InternalError(w, r, c.h, err)
+			return
+		}
+
+		stats, err := site.StatsCached(ctx, c.db, c.cacher)
+		if err != nil {
+			controller.InternalError(w, r, c.h, err)
+			return
+		}
+
+		c.renderSiteStats(w, r, typ, currentRealm, site, "site-stats", stats)
+	})
+}
+
+func (c *Controller) renderSiteStats(w http.ResponseWriter, r *http.Request, typ StatsType, realm *database.Realm, target database.Auditable, name string, stats database.SiteStats) {
+	switch typ {
+	case StatsTypeCSV:
+		c.renderCSV(w, r, realm, target, name, stats)
+	case StatsTypeJSON:
+		c.renderJSON(w, r, realm, target, stats)
+	default:
+		controller.NotFound(w, r, c.h)
+	}
+}
@@ -21,7 +21,9 @@ import (
 	"github.com/google/exposure-notifications-verification-server/pkg/controller"
 )
 
-// HandleRealmUserStats renders statistics for the current realm.
+// HandleRealmUserStats renders per-user statistics for the current realm. The
+// range and granularity can be set with the start, end, and granularity query
+// parameters.
 func (c *Controller) HandleRealmUserStats(typ StatsType) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		ctx := r.Context()
@@ -32,7 +34,13 @@ func (c *Controller) HandleRealmUserStats(typ StatsType) http.Handler {
 			return
 		}
 
-		stats, err := currentRealm.UserStatsCached(ctx, c.db, c.cacher)
+		sr, err := statsRangeFromRequest(r, currentRealm)
+		if err != nil {
+			c.renderBadRequest(w, typ, err)
+			return
+		}
+
+		stats, err := currentRealm.UserStatsInRangeCached(ctx, c.db, c.cacher, sr)
 		if err != nil {
 			controller.InternalError(w, r, c.h, err)
 			return
@@ -40,10 +48,10 @@ func (c *Controller) HandleRealmUserStats(typ StatsType) http.Handler {
 
 		switch typ {
 		case StatsTypeCSV:
-			c.h.RenderCSV(w, http.StatusOK, csvFilename("user-stats"), stats)
+			c.renderCSV(w, r, currentRealm, currentRealm, "user-stats", stats)
 			return
 		case StatsTypeJSON:
-			c.h.RenderJSON(w, http.StatusOK, stats)
+			c.renderJSON(w, r, currentRealm, currentRealm, stats)
 			return
 		default:
 			controller.NotFound(w, r, c.h)
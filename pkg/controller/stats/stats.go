@@ -18,14 +18,18 @@ package stats
 import (
 	"context"
 	"fmt"
+	"net/http"
 	"time"
 
+	"github.com/google/exposure-notifications-verification-server/internal/icsv"
 	"github.com/google/exposure-notifications-verification-server/internal/project"
+	"github.com/google/exposure-notifications-verification-server/pkg/api"
 	"github.com/google/exposure-notifications-verification-server/pkg/cache"
 	"github.com/google/exposure-notifications-verification-server/pkg/controller"
 	"github.com/google/exposure-notifications-verification-server/pkg/database"
 	"github.com/google/exposure-notifications-verification-server/pkg/rbac"
 	"github.com/google/exposure-notifications-verification-server/pkg/render"
+	"github.com/sethvargo/go-limiter"
 )
 
 // StatsType represents a type of stat.
@@ -39,17 +43,37 @@ const (
 
 // Controller is a stats controller.
 type Controller struct {
-	cacher cache.Cacher
-	db     *database.Database
-	h      render.Renderer
+	cacher  cache.Cacher
+	db      *database.Database
+	h       render.Renderer
+	limiter limiter.Store
+	hmacKey []byte
+
+	// publicStatsKey is the key for the noise added to public statistics.
+	publicStatsKey []byte
+}
+
+// New creates a new stats controller. The limiter and HMAC key are used to
+// report realm quota usage.
+func New(ctx context.Context, cacher cache.Cacher, db *database.Database, limiter limiter.Store, hmacKey []byte, h render.Renderer) *Controller {
+	return &Controller{
+		cacher:  cacher,
+		db:      db,
+		h:       h,
+		limiter: limiter,
+		hmacKey: hmacKey,
+	}
 }
 
-// New creates a new stats controller.
-func New(ctx context.Context, cacher cache.Cacher, db *database.Database, h render.Renderer) *Controller {
+// NewPublic creates a new stats controller for public statistics. The key is
+// used to derive the noise added to the statistics, and must not be used for
+// anything else.
+func NewPublic(ctx context.Context, cacher cache.Cacher, db *database.Database, publicStatsKey []byte, h render.Renderer) *Controller {
 	return &Controller{
-		cacher: cacher,
-		db:     db,
-		h:      h,
+		cacher:         cacher,
+		db:             db,
+		h:              h,
+		publicStatsKey: publicStatsKey,
 	}
 }
 
@@ -69,8 +93,66 @@ func authorizeFromContext(ctx context.Context) (*database.Realm, bool) {
 	return nil, false
 }
 
+// renderCSV records the download of the target's statistics, if the realm
+// audits it, and renders the statistics as a CSV file.
+func (c *Controller) renderCSV(w http.ResponseWriter, r *http.Request, realm *database.Realm, target database.Auditable, name string, stats icsv.Marshaler) {
+	if err := controller.AuditAccess(r, c.db, realm, database.AccessDownloadedStats, target); err != nil {
+		controller.InternalError(w, r, c.h, err)
+		return
+	}
+	c.h.RenderCSV(w, http.StatusOK, csvFilename(name), stats)
+}
+
+// renderJSON records the download of the target's statistics, if the realm
+// audits it, and renders the statistics as JSON.
+func (c *Controller) renderJSON(w http.ResponseWriter, r *http.Request, realm *database.Realm, target database.Auditable, stats interface{}) {
+	if err := controller.AuditAccess(r, c.db, realm, database.AccessDownloadedStats, target); err != nil {
+		controller.InternalError(w, r, c.h, err)
+		return
+	}
+	c.h.RenderJSON(w, http.StatusOK, stats)
+}
+
 // csvFilename returns the formatted filename for now.
 func csvFilename(name string) string {
 	nowFormatted := time.Now().Format(project.RFC3339Squish)
 	return fmt.Sprintf("%s-%s.csv", nowFormatted, name)
 }
+
+// statsRangeFromRequest builds the statistics range from the optional "start",
+// "end", and "granularity" query parameters. Dates are in YYYY-MM-DD format. A
+// missing end defaults to today in the realm's timezone, and a missing start
+// defaults to database.DefaultStatsDays before the end.
+func statsRangeFromRequest(r *http.Request, realm *database.Realm) (*database.StatsRange, error) {
+	q := r.URL.Query()
+
+	stop := realm.StatsDate(time.Now())
+	if v := q.Get("end"); v != "" {
+		t, err := time.Parse(project.RFC3339Date, v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid end date %q, expected YYYY-MM-DD", v)
+		}
+		stop = t
+	}
+
+	start := stop.Add(database.DefaultStatsDays * -24 * time.Hour)
+	if v := q.Get("start"); v != "" {
+		t, err := time.Parse(project.RFC3339Date, v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid start date %q, expected YYYY-MM-DD", v)
+		}
+		start = t
+	}
+
+	return database.NewStatsRange(start, stop, database.StatsGranularity(q.Get("granularity")))
+}
+
+// renderBadRequest renders an invalid stats request in the requested format.
+func (c *Controller) renderBadRequest(w http.ResponseWriter, typ StatsType, err error) {
+	switch typ {
+	case StatsTypeJSON:
+		c.h.RenderJSON(w, http.StatusBadRequest, api.Error(err))
+	default:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	}
+}
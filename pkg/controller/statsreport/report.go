@@ -0,0 +1,183 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package statsreport
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"mime"
+	"strings"
+	"time"
+
+	"github.com/google/exposure-notifications-verification-server/internal/icsv"
+	"github.com/google/exposure-notifications-verification-server/internal/project"
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+)
+
+const csvContentType = "text/csv"
+
+// report is a realm's statistics for a single period.
+type report struct {
+	realmID   uint
+	realmName string
+	frequency database.StatsReportFrequency
+	start     time.Time
+	stop      time.Time
+	files     []*reportFile
+}
+
+// reportFile is a CSV file in a report.
+type reportFile struct {
+	name     string
+	contents []byte
+}
+
+// buildReport generates the realm, user, and external issuer statistics for
+// the period, by day. Statistics without any rows are omitted.
+func buildReport(db *database.Database, realm *database.Realm, frequency database.StatsReportFrequency, start, stop time.Time) (*report, error) {
+	sr, err := database.NewStatsRange(start, stop, database.StatsGranularityDay)
+	if err != nil {
+		return nil, err
+	}
+
+	realmStats, err := realm.StatsInRange(db, sr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get realm stats: %w", err)
+	}
+
+	userStats, err := realm.UserStatsInRange(db, sr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user stats: %w", err)
+	}
+
+	externalIssuerStats, err := realm.ExternalIssuerStatsInRange(db, sr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get external issuer stats: %w", err)
+	}
+
+	r := &report{
+		realmID:   realm.ID,
+		realmName: realm.Name,
+		frequency: frequency,
+		start:     start,
+		stop:      stop,
+	}
+
+	if err := r.add("realm-stats.csv", realmStats); err != nil {
+		return nil, err
+	}
+	if err := r.add("realm-user-stats.csv", userStats); err != nil {
+		return nil, err
+	}
+	if err := r.add("external-issuer-stats.csv", externalIssuerStats); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// add marshals the statistics and adds them to the report, unless they are
+// empty.
+func (r *report) add(name string, m icsv.Marshaler) error {
+	b, err := m.MarshalCSV()
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s: %w", name, err)
+	}
+	if len(b) == 0 {
+		return nil
+	}
+
+	r.files = append(r.files, &reportFile{name: name, contents: b})
+	return nil
+}
+
+// objectPrefix is the path under which the report's files are exported.
+func (r *report) objectPrefix() string {
+	return fmt.Sprintf("realm-%d/%s/%s_%s", r.realmID, r.frequency,
+		r.start.Format(project.RFC3339Date), r.stop.Format(project.RFC3339Date))
+}
+
+// subject is the email subject of the report.
+func (r *report) subject() string {
+	return fmt.Sprintf("%s statistics for %s: %s to %s", strings.Title(string(r.frequency)), r.realmName,
+		r.start.Format(project.RFC3339Date), r.stop.Format(project.RFC3339Date))
+}
+
+// message builds the report email as a multipart MIME message with each of the
+// report's files attached.
+func (r *report) message(from, to string) ([]byte, error) {
+	boundary, err := randomBoundary()
+	if err != nil {
+		return nil, err
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", r.subject()))
+	fmt.Fprintf(&b, "To: %s\r\n", project.TrimSpace(to))
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&b, "Content-Type: multipart/mixed; boundary=%q\r\n", boundary)
+	fmt.Fprintf(&b, "\r\n")
+
+	fmt.Fprintf(&b, "--%s\r\n", boundary)
+	fmt.Fprintf(&b, "Content-Type: text/plain; charset=\"utf-8\"\r\n")
+	fmt.Fprintf(&b, "\r\n")
+	fmt.Fprintf(&b, "Hello,\r\n\r\n")
+	fmt.Fprintf(&b, "Attached are the %s statistics for %s from %s to %s, by day in the\r\n",
+		r.frequency, r.realmName, r.start.Format(project.RFC3339Date), r.stop.Format(project.RFC3339Date))
+	fmt.Fprintf(&b, "realm's timezone.\r\n")
+	if len(r.files) == 0 {
+		fmt.Fprintf(&b, "\r\nThere were no statistics for this period.\r\n")
+	}
+	fmt.Fprintf(&b, "\r\nTo change these reports, visit the realm's settings.\r\n")
+
+	for _, f := range r.files {
+		fmt.Fprintf(&b, "\r\n--%s\r\n", boundary)
+		fmt.Fprintf(&b, "Content-Type: %s; charset=\"utf-8\"\r\n", csvContentType)
+		fmt.Fprintf(&b, "Content-Transfer-Encoding: base64\r\n")
+		fmt.Fprintf(&b, "Content-Disposition: attachment; filename=%q\r\n", f.name)
+		fmt.Fprintf(&b, "\r\n")
+		writeBase64Lines(&b, f.contents)
+	}
+
+	fmt.Fprintf(&b, "\r\n--%s--\r\n", boundary)
+	return b.Bytes(), nil
+}
+
+// writeBase64Lines writes the base64 encoding of b in lines of at most 76
+// characters, as required by RFC 2045.
+func writeBase64Lines(w *bytes.Buffer, b []byte) {
+	const lineLength = 76
+
+	encoded := base64.StdEncoding.EncodeToString(b)
+	for len(encoded) > lineLength {
+		w.WriteString(encoded[:lineLength])
+		w.WriteString("\r\n")
+		encoded = encoded[lineLength:]
+	}
+	w.WriteString(encoded)
+	w.WriteString("\r\n")
+}
+
+// randomBoundary returns a random MIME multipart boundary.
+func randomBoundary() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate boundary: %w", err)
+	}
+	return "report-" + hex.EncodeToString(b), nil
+}
@@ -0,0 +1,115 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package statsreport
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+)
+
+func TestReport_Message(t *testing.T) {
+	t.Parallel()
+
+	contents := []byte(strings.Repeat("date,codes_issued\n2020-11-02,10\n", 10))
+
+	r := &report{
+		realmID:   7,
+		realmName: "Example",
+		frequency: database.StatsReportWeekly,
+		start:     time.Date(2020, 11, 2, 0, 0, 0, 0, time.UTC),
+		stop:      time.Date(2020, 11, 8, 0, 0, 0, 0, time.UTC),
+		files: []*reportFile{
+			{name: "realm-stats.csv", contents: contents},
+		},
+	}
+
+	if got, want := r.objectPrefix(), "realm-7/weekly/2020-11-02_2020-11-08"; got != want {
+		t.Errorf("expected object prefix %q to be %q", got, want)
+	}
+
+	b, err := r.message("from@example.com", "to@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err := mail.ReadMessage(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := subject, "Weekly statistics for Example: 2020-11-02 to 2020-11-08"; got != want {
+		t.Errorf("expected subject %q to be %q", got, want)
+	}
+	if got, want := msg.Header.Get("To"), "to@example.com"; got != want {
+		t.Errorf("expected to %q to be %q", got, want)
+	}
+
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := mediaType, "multipart/mixed"; got != want {
+		t.Fatalf("expected media type %q to be %q", got, want)
+	}
+
+	mr := multipart.NewReader(msg.Body, params["boundary"])
+
+	body, err := mr.NextPart()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := body.Header.Get("Content-Type"), "text/plain"; !strings.HasPrefix(got, want) {
+		t.Errorf("expected body content type %q to start with %q", got, want)
+	}
+
+	attachment, err := mr.NextPart()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := attachment.FileName(), "realm-stats.csv"; got != want {
+		t.Errorf("expected filename %q to be %q", got, want)
+	}
+
+	encoded, err := ioutil.ReadAll(attachment)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range strings.Split(strings.TrimSpace(string(encoded)), "\r\n") {
+		if len(line) > 76 {
+			t.Errorf("expected base64 lines to be at most 76 characters, got %d", len(line))
+		}
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(strings.ReplaceAll(string(encoded), "\r\n", ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decoded, contents) {
+		t.Errorf("expected attachment %q to be %q", decoded, contents)
+	}
+}
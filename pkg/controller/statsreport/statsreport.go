@@ -0,0 +1,263 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package statsreport implements scheduled statistics reports, which email a
+// realm's statistics CSVs to its recipients and optionally export them to blob
+// storage.
+package statsreport
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/exposure-notifications-server/pkg/logging"
+	"github.com/google/exposure-notifications-verification-server/pkg/config"
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+	"github.com/google/exposure-notifications-verification-server/pkg/render"
+	"github.com/google/exposure-notifications-verification-server/pkg/storage"
+	"github.com/hashicorp/go-multierror"
+)
+
+// lockName is the name of the lock in the cleanup_statuses table which
+// prevents concurrent report runs.
+const lockName = "stats_reports"
+
+// Controller is a controller for sending statistics reports.
+type Controller struct {
+	config    *config.Modeler
+	db        *database.Database
+	blobstore storage.Blobstore
+	h         render.Renderer
+}
+
+// New creates a new statistics report controller.
+func New(ctx context.Context, config *config.Modeler, db *database.Database, blobstore storage.Blobstore, h render.Renderer) *Controller {
+	return &Controller{
+		config:    config,
+		db:        db,
+		blobstore: blobstore,
+		h:         h,
+	}
+}
+
+// HandleSend accepts an HTTP trigger and sends every enabled report whose most
+// recent period has not been reported. Periods are computed in each realm's
+// timezone. It is safe to invoke more often than the shortest period.
+func (c *Controller) HandleSend() http.Handler {
+	type SendResult struct {
+		OK     bool    `json:"ok"`
+		Sent   int     `json:"sent"`
+		Errors []error `json:"errors,omitempty"`
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		logger := logging.FromContext(ctx).Named("statsreport.HandleSend")
+
+		if err := c.claimLock(); err != nil {
+			logger.Errorw("failed to claim stats report lock", "error", err)
+			c.h.RenderJSON(w, http.StatusInternalServerError, &SendResult{
+				OK:     false,
+				Errors: []error{err},
+			})
+			return
+		}
+
+		sent, err := c.sendReports(ctx)
+		if err != nil {
+			logger.Errorw("failed to send stats reports", "error", err)
+
+			var errs []error
+			if merr, ok := err.(*multierror.Error); ok {
+				errs = merr.WrappedErrors()
+			} else {
+				errs = []error{err}
+			}
+
+			c.h.RenderJSON(w, http.StatusInternalServerError, &SendResult{
+				OK:     false,
+				Sent:   sent,
+				Errors: errs,
+			})
+			return
+		}
+
+		c.h.RenderJSON(w, http.StatusOK, &SendResult{
+			OK:   true,
+			Sent: sent,
+		})
+	})
+}
+
+// claimLock attempts to claim the report lock for the configured minimum TTL.
+func (c *Controller) claimLock() error {
+	cStat, err := c.db.CreateCleanup(lockName)
+	if err != nil {
+		return fmt.Errorf("failed to create lock: %w", err)
+	}
+
+	if cStat.NotBefore.After(time.Now().UTC()) {
+		return fmt.Errorf("skipping stats reports, no run before %v", cStat.NotBefore)
+	}
+
+	if _, err := c.db.ClaimCleanup(cStat, c.config.StatsReportMinTTL); err != nil {
+		return fmt.Errorf("failed to claim lock: %w", err)
+	}
+	return nil
+}
+
+// sendReports sends all due reports and returns the number sent. A failure for
+// one schedule does not prevent the others from being sent.
+func (c *Controller) sendReports(ctx context.Context) (int, error) {
+	logger := logging.FromContext(ctx).Named("statsreport.sendReports")
+
+	schedules, err := c.db.ListEnabledStatsReportSchedules()
+	if err != nil {
+		return 0, fmt.Errorf("failed to list stats report schedules: %w", err)
+	}
+
+	var sent int
+	var merr *multierror.Error
+	realms := make(map[uint]*database.Realm)
+	for _, s := range schedules {
+		realm, ok := realms[s.RealmID]
+		if !ok {
+			realm, err = c.db.FindRealm(s.RealmID)
+			if err != nil {
+				merr = multierror.Append(merr, fmt.Errorf("failed to find realm %d: %w", s.RealmID, err))
+				continue
+			}
+			realms[s.RealmID] = realm
+		}
+
+		if !realm.IsActive() {
+			continue
+		}
+
+		today := realm.StatsDate(time.Now())
+		due, err := s.IsDue(today)
+		if err != nil {
+			merr = multierror.Append(merr, fmt.Errorf("realm %d: %w", realm.ID, err))
+			continue
+		}
+		if !due {
+			continue
+		}
+
+		start, stop, err := s.Frequency.Period(today)
+		if err != nil {
+			merr = multierror.Append(merr, fmt.Errorf("realm %d: %w", realm.ID, err))
+			continue
+		}
+
+		delivered, err := c.sendReport(ctx, realm, s, start, stop)
+		if err != nil {
+			merr = multierror.Append(merr, fmt.Errorf("failed to send %s report for realm %d: %w", s.Frequency, realm.ID, err))
+		}
+		if !delivered {
+			continue
+		}
+
+		if err := c.db.MarkStatsReportSent(s, start); err != nil {
+			merr = multierror.Append(merr, fmt.Errorf("realm %d: %w", realm.ID, err))
+			continue
+		}
+
+		logger.Infow("sent stats report",
+			"realm", realm.ID,
+			"frequency", s.Frequency,
+			"start", start,
+			"stop", stop)
+		sent++
+	}
+
+	return sent, merr.ErrorOrNil()
+}
+
+// sendReport builds the report for the period and delivers it to the
+// schedule's recipients and, if enabled, to blob storage. It returns true if
+// the report was delivered to at least one destination, in which case the
+// period is not retried, so that a single failing recipient does not cause the
+// others to receive the report on every run.
+func (c *Controller) sendReport(ctx context.Context, realm *database.Realm, s *database.StatsReportSchedule, start, stop time.Time) (bool, error) {
+	report, err := buildReport(c.db, realm, s.Frequency, start, stop)
+	if err != nil {
+		return false, err
+	}
+
+	var delivered bool
+	var merr *multierror.Error
+
+	if s.ExportToStorage {
+		if err := c.export(ctx, report); err != nil {
+			merr = multierror.Append(merr, err)
+		} else {
+			delivered = true
+		}
+	}
+
+	if len(s.Recipients) > 0 {
+		sent, err := c.email(ctx, realm, report, s.Recipients)
+		if err != nil {
+			merr = multierror.Append(merr, err)
+		}
+		if sent > 0 {
+			delivered = true
+		}
+	}
+
+	return delivered, merr.ErrorOrNil()
+}
+
+// export writes each of the report's files to blob storage.
+func (c *Controller) export(ctx context.Context, report *report) error {
+	for _, f := range report.files {
+		name := report.objectPrefix() + "/" + f.name
+		if err := c.blobstore.CreateObject(ctx, c.config.Storage.Bucket, name, f.contents, csvContentType); err != nil {
+			return fmt.Errorf("failed to export %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// email sends the report to each of the recipients using the realm's email
+// provider. It returns the number of recipients to which it was sent.
+func (c *Controller) email(ctx context.Context, realm *database.Realm, report *report, recipients []string) (int, error) {
+	emailer, err := realm.EmailProvider(c.db)
+	if err != nil {
+		if database.IsNotFound(err) {
+			return 0, fmt.Errorf("realm has no email configuration")
+		}
+		return 0, fmt.Errorf("failed to create email provider: %w", err)
+	}
+
+	var sent int
+	var merr *multierror.Error
+	for _, to := range recipients {
+		message, err := report.message(emailer.From(), to)
+		if err != nil {
+			return sent, fmt.Errorf("failed to build email: %w", err)
+		}
+
+		if err := emailer.SendEmail(ctx, to, message); err != nil {
+			merr = multierror.Append(merr, fmt.Errorf("failed to send email to %s: %w", to, err))
+			continue
+		}
+		sent++
+	}
+	return sent, merr.ErrorOrNil()
+}
@@ -20,6 +20,7 @@ import (
 
 	"github.com/google/exposure-notifications-server/pkg/logging"
 	"github.com/google/exposure-notifications-verification-server/pkg/controller"
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
 	"github.com/google/exposure-notifications-verification-server/pkg/pagination"
 	"github.com/google/exposure-notifications-verification-server/pkg/rbac"
 )
@@ -51,6 +52,11 @@ func (c *Controller) HandleExport() http.Handler {
 			return
 		}
 
+		if err := controller.AuditAccess(r, c.db, currentRealm, database.AccessExportedUsers, currentRealm); err != nil {
+			controller.InternalError(w, r, c.h, err)
+			return
+		}
+
 		w.Header().Add("Content-Disposition", "")
 		w.Header().Add("Content-Type", "text/CSV")
 
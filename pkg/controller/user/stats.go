@@ -78,9 +78,17 @@ func (c *Controller) HandleUserStats() http.Handler {
 		case strings.HasSuffix(pth, ".csv"):
 			nowFormatted := time.Now().UTC().Format(project.RFC3339Squish)
 			filename := fmt.Sprintf("%s-user-stats.csv", nowFormatted)
+			if err := controller.AuditAccess(r, c.db, currentRealm, database.AccessDownloadedStats, user); err != nil {
+				controller.InternalError(w, r, c.h, err)
+				return
+			}
 			c.h.RenderCSV(w, http.StatusOK, filename, stats)
 			return
 		case strings.HasSuffix(pth, ".json"):
+			if err := controller.AuditAccess(r, c.db, currentRealm, database.AccessDownloadedStats, user); err != nil {
+				controller.InternalError(w, r, c.h, err)
+				return
+			}
 			c.h.RenderJSON(w, http.StatusOK, stats)
 			return
 		default:
@@ -91,7 +99,7 @@ func (c *Controller) HandleUserStats() http.Handler {
 }
 
 func (c *Controller) getStats(ctx context.Context, user *database.User, realm *database.Realm) (database.UserStats, error) {
-	now := time.Now().UTC()
+	now := realm.StatsDate(time.Now())
 	past := now.Add(-30 * 24 * time.Hour)
 
 	var stats database.UserStats
@@ -27,9 +27,10 @@ import (
 
 func (c *Controller) HandleUpdate() http.Handler {
 	type FormData struct {
-		Name        string            `form:"name"`
-		Admin       bool              `form:"admin"`
-		Permissions []rbac.Permission `form:"permissions"`
+		Name          string            `form:"name"`
+		Admin         bool              `form:"admin"`
+		Permissions   []rbac.Permission `form:"permissions"`
+		DefaultSiteID uint              `form:"default_site_id"`
 	}
 
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -67,16 +68,22 @@ func (c *Controller) HandleUpdate() http.Handler {
 			return
 		}
 
+		sites, err := currentRealm.ListActiveSites(c.db)
+		if err != nil {
+			controller.InternalError(w, r, c.h, err)
+			return
+		}
+
 		// Requested form, stop processing.
 		if r.Method == http.MethodGet {
-			c.renderEdit(ctx, w, user, userMembership)
+			c.renderEdit(ctx, w, user, userMembership, sites)
 			return
 		}
 
 		var form FormData
 		if err := controller.BindForm(w, r, &form); err != nil {
 			flash.Error("failed to process form: %v", err)
-			c.renderEdit(ctx, w, user, userMembership)
+			c.renderEdit(ctx, w, user, userMembership, sites)
 			return
 		}
 
@@ -84,21 +91,32 @@ func (c *Controller) HandleUpdate() http.Handler {
 		user.Name = form.Name
 		if err := c.db.SaveUser(user, currentUser); err != nil {
 			flash.Error("Failed to update user: %v", err)
-			c.renderEdit(ctx, w, user, userMembership)
+			c.renderEdit(ctx, w, user, userMembership, sites)
 			return
 		}
 
+		// Update the default site before permissions, since saving the membership
+		// writes all of its fields.
+		if userMembership.DefaultSiteID != form.DefaultSiteID {
+			userMembership.DefaultSiteID = form.DefaultSiteID
+			if err := c.db.SaveMembership(userMembership, currentUser); err != nil {
+				flash.Error("Failed to update user default site: %v", err)
+				c.renderEdit(ctx, w, user, userMembership, sites)
+				return
+			}
+		}
+
 		// Update membership properties, iff the target user differs
 		if currentUser.ID != user.ID {
 			permission, err := rbac.CompileAndAuthorize(membership.Permissions, form.Permissions)
 			if err != nil {
 				flash.Error("Failed to update user permissions: %s", err)
-				c.renderEdit(ctx, w, user, userMembership)
+				c.renderEdit(ctx, w, user, userMembership, sites)
 				return
 			}
 			if err := user.AddToRealm(c.db, currentRealm, permission, currentUser); err != nil {
 				flash.Error("Failed to update user in realm: %v", err)
-				c.renderEdit(ctx, w, user, membership)
+				c.renderEdit(ctx, w, user, membership, sites)
 				return
 			}
 		}
@@ -108,11 +126,12 @@ func (c *Controller) HandleUpdate() http.Handler {
 	})
 }
 
-func (c *Controller) renderEdit(ctx context.Context, w http.ResponseWriter, user *database.User, membership *database.Membership) {
+func (c *Controller) renderEdit(ctx context.Context, w http.ResponseWriter, user *database.User, membership *database.Membership, sites []*database.Site) {
 	m := controller.TemplateMapFromContext(ctx)
 	m.Title("Edit user: %s", user.Name)
 	m["user"] = user
 	m["userMembership"] = membership
 	m["permissions"] = rbac.NamePermissionMap
+	m["sites"] = sites
 	c.h.RenderHTML(w, "users/edit", m)
 }
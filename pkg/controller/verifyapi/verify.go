@@ -71,8 +71,17 @@ func (c *Controller) HandleVerify() http.Handler {
 			return
 		}
 
-		// Get the signer based on Key configuration.
-		signer, err := c.kms.NewSigner(ctx, c.config.TokenSigning.ActiveKey())
+		// Get the signer for the currently active token signing key.
+		signingKey, err := c.activeTokenSigningKey(ctx)
+		if err != nil {
+			logger.Errorw("failed to get token signing key", "error", err)
+			blame = observability.BlameServer
+			result = observability.ResultError("FAILED_TO_GET_SIGNING_KEY")
+
+			c.h.RenderJSON(w, http.StatusInternalServerError, api.InternalError())
+			return
+		}
+		signer, err := c.db.KeyManager().NewSigner(ctx, signingKey.KeyID)
 		if err != nil {
 			logger.Errorw("failed to get signer", "error", err)
 			blame = observability.BlameServer
@@ -134,7 +143,7 @@ func (c *Controller) HandleVerify() http.Handler {
 			Subject:   subject.String(),
 		}
 		token := jwt.NewWithClaims(jwt.SigningMethodES256, claims)
-		token.Header[verifyapi.KeyIDHeader] = c.config.TokenSigning.ActiveKeyID()
+		token.Header[verifyapi.KeyIDHeader] = signingKey.GetKID()
 		signedJWT, err := jwthelper.SignJWT(token, signer)
 		if err != nil {
 			logger.Errorw("failed to sign token", "error", err)
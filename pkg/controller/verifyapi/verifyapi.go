@@ -16,8 +16,9 @@ package verifyapi
 
 import (
 	"context"
+	"fmt"
 
-	"github.com/google/exposure-notifications-server/pkg/keys"
+	"github.com/google/exposure-notifications-verification-server/pkg/cache"
 	"github.com/google/exposure-notifications-verification-server/pkg/config"
 	"github.com/google/exposure-notifications-verification-server/pkg/database"
 	"github.com/google/exposure-notifications-verification-server/pkg/render"
@@ -27,15 +28,31 @@ import (
 type Controller struct {
 	config *config.APIServerConfig
 	db     *database.Database
+	cacher cache.Cacher
 	h      render.Renderer
-	kms    keys.KeyManager
 }
 
-func New(ctx context.Context, config *config.APIServerConfig, db *database.Database, h render.Renderer, kms keys.KeyManager) (*Controller, error) {
+func New(ctx context.Context, config *config.APIServerConfig, db *database.Database, cacher cache.Cacher, h render.Renderer) (*Controller, error) {
 	return &Controller{
 		config: config,
 		db:     db,
+		cacher: cacher,
 		h:      h,
-		kms:    kms,
 	}, nil
 }
+
+// activeTokenSigningKey returns the token signing key that should be used to
+// sign new tokens. The result is cached to alleviate pressure on the database.
+func (c *Controller) activeTokenSigningKey(ctx context.Context) (*database.TokenSigningKey, error) {
+	var key database.TokenSigningKey
+	cacheKey := &cache.Key{
+		Namespace: "token_signing_keys",
+		Key:       "active",
+	}
+	if err := c.cacher.Fetch(ctx, cacheKey, &key, c.config.TokenSigning.TokenSigningKeyCacheDuration, func() (interface{}, error) {
+		return c.db.ActiveTokenSigningKey()
+	}); err != nil {
+		return nil, fmt.Errorf("failed to lookup active token signing key: %w", err)
+	}
+	return &key, nil
+}
@@ -0,0 +1,258 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/exposure-notifications-verification-server/pkg/pagination"
+	"github.com/jinzhu/gorm"
+)
+
+// AccessAuditLevel is the verbosity of a realm's access auditing.
+type AccessAuditLevel int16
+
+const (
+	// AccessAuditOff records no access events.
+	AccessAuditOff AccessAuditLevel = iota
+	// AccessAuditExports records bulk downloads of data, such as user exports
+	// and statistics CSVs.
+	AccessAuditExports
+	// AccessAuditAll records bulk downloads and views of individual sensitive
+	// records, such as code statuses and API keys.
+	AccessAuditAll
+)
+
+// AccessAuditLevels are the valid access audit levels, in increasing
+// verbosity.
+var AccessAuditLevels = []AccessAuditLevel{AccessAuditOff, AccessAuditExports, AccessAuditAll}
+
+func (l AccessAuditLevel) String() string {
+	switch l {
+	case AccessAuditOff:
+		return "off"
+	case AccessAuditExports:
+		return "exports"
+	case AccessAuditAll:
+		return "all"
+	}
+	return ""
+}
+
+// Display is the human-readable description of the level.
+func (l AccessAuditLevel) Display() string {
+	switch l {
+	case AccessAuditOff:
+		return "Off"
+	case AccessAuditExports:
+		return "Exports and downloads"
+	case AccessAuditAll:
+		return "Exports, downloads, and sensitive views"
+	}
+	return "Unknown"
+}
+
+// AccessAction is a sensitive read which may be recorded as an access event.
+// It is recorded if the realm's access audit level is at least Level.
+type AccessAction struct {
+	Name  string
+	Level AccessAuditLevel
+}
+
+var (
+	AccessViewedCodeStatus = &AccessAction{Name: "viewed code status", Level: AccessAuditAll}
+	AccessViewedAPIKey     = &AccessAction{Name: "viewed API key", Level: AccessAuditAll}
+	AccessExportedUsers    = &AccessAction{Name: "exported users", Level: AccessAuditExports}
+	AccessDownloadedStats  = &AccessAction{Name: "downloaded statistics", Level: AccessAuditExports}
+	AccessExportedAudits   = &AccessAction{Name: "exported audit events", Level: AccessAuditExports}
+)
+
+// AccessActions are all of the actions which may be recorded.
+var AccessActions = []*AccessAction{
+	AccessViewedCodeStatus,
+	AccessViewedAPIKey,
+	AccessExportedUsers,
+	AccessDownloadedStats,
+	AccessExportedAudits,
+}
+
+// ShouldAuditAccess returns true if the realm records access events for the
+// action.
+func (r *Realm) ShouldAuditAccess(action *AccessAction) bool {
+	if r == nil || action == nil || r.AccessAuditLevel == AccessAuditOff {
+		return false
+	}
+	return r.AccessAuditLevel >= action.Level
+}
+
+// AccessEntry records a read of sensitive data. Like AuditEntry, it does not
+// use foreign keys, so it outlives the actor and target, and it should be
+// considered immutable. Access entries are kept apart from audit entries so
+// that high-volume reads do not bloat the audit log or its hash chain, and so
+// they can have a separate retention policy.
+type AccessEntry struct {
+	Errorable
+
+	// ID is the entry's ID.
+	ID uint `gorm:"primary_key;"`
+
+	// RealmID is the ID of the realm in which the access took place.
+	RealmID uint `gorm:"column:realm_id; type:integer; not null;"`
+
+	// ActorID and ActorDisplay identify the user or API key which read the
+	// data, in the same form as audit entries.
+	ActorID      string `gorm:"column:actor_id; type:text; not null;"`
+	ActorDisplay string `gorm:"column:actor_display; type:text; not null;"`
+
+	// Action is the name of the AccessAction.
+	Action string `gorm:"column:action; type:text; not null;"`
+
+	// TargetID and TargetDisplay identify the data which was read.
+	TargetID      string `gorm:"column:target_id; type:text; not null;"`
+	TargetDisplay string `gorm:"column:target_display; type:text; not null;"`
+
+	// Method, Path, RemoteIP, UserAgent, and RequestID describe the request
+	// which read the data.
+	Method    string `gorm:"column:method; type:varchar(16);"`
+	Path      string `gorm:"column:path; type:text;"`
+	RemoteIP  string `gorm:"column:remote_ip; type:varchar(64);"`
+	UserAgent string `gorm:"column:user_agent; type:text;"`
+	RequestID string `gorm:"column:request_id; type:varchar(64);"`
+
+	// CreatedAt is when the entry was created.
+	CreatedAt time.Time
+}
+
+// BuildAccessEntry builds an access entry for the actor reading the target.
+// The caller sets the request metadata.
+func BuildAccessEntry(actor Auditable, action *AccessAction, target Auditable, realmID uint) *AccessEntry {
+	var e AccessEntry
+	e.RealmID = realmID
+	e.ActorID = actor.AuditID()
+	e.ActorDisplay = actor.AuditDisplay()
+	e.Action = action.Name
+	e.TargetID = target.AuditID()
+	e.TargetDisplay = target.AuditDisplay()
+	return &e
+}
+
+// BeforeSave runs validations. If there are errors, the save fails.
+func (e *AccessEntry) BeforeSave(tx *gorm.DB) error {
+	if e.RealmID == 0 {
+		e.AddError("realm_id", "cannot be blank")
+	}
+
+	if e.ActorID == "" {
+		e.AddError("actor_id", "cannot be blank")
+	}
+	if e.ActorDisplay == "" {
+		e.AddError("actor_display", "cannot be blank")
+	}
+
+	if e.Action == "" {
+		e.AddError("action", "cannot be blank")
+	}
+
+	if e.TargetID == "" {
+		e.AddError("target_id", "cannot be blank")
+	}
+	if e.TargetDisplay == "" {
+		e.AddError("target_display", "cannot be blank")
+	}
+
+	return e.ErrorOrNil()
+}
+
+// SaveAccessEntry saves the access entry.
+func (db *Database) SaveAccessEntry(e *AccessEntry) error {
+	return db.db.Save(e).Error
+}
+
+// ListAccessEntries returns the realm's access entries which match the scopes,
+// newest first.
+func (r *Realm) ListAccessEntries(db *Database, p *pagination.PageParams, scopes ...Scope) ([]*AccessEntry, *pagination.Paginator, error) {
+	var entries []*AccessEntry
+
+	query := db.db.
+		Model(&AccessEntry{}).
+		Scopes(scopes...).
+		Where("access_entries.realm_id = ?", r.ID).
+		Order("access_entries.created_at DESC, access_entries.id DESC")
+
+	if p == nil {
+		p = new(pagination.PageParams)
+	}
+
+	paginator, err := Paginate(query, &entries, p.Page, p.Limit)
+	if err != nil {
+		if IsNotFound(err) {
+			return entries, nil, nil
+		}
+		return nil, nil, err
+	}
+
+	return entries, paginator, nil
+}
+
+// CountPurgeableAccessEntries returns the number of the realm's access entries
+// which would be purged with the given maximum age.
+func (r *Realm) CountPurgeableAccessEntries(db *Database, maxAge time.Duration) (int64, error) {
+	createdBefore := time.Now().UTC().Add(-absDuration(maxAge))
+
+	var count int64
+	if err := db.db.
+		Model(&AccessEntry{}).
+		Where("realm_id = ?", r.ID).
+		Where("created_at < ?", createdBefore).
+		Count(&count).
+		Error; err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// PurgeAccessEntries will delete access entries which were created longer than
+// maxAge ago. Realms in overrides use their own maximum age instead.
+func (db *Database) PurgeAccessEntries(ctx context.Context, maxAge time.Duration, overrides RetentionOverrides, opts *PurgeOptions) (*PurgeResult, error) {
+	now := time.Now().UTC()
+	result := &PurgeResult{Table: "access_entries"}
+
+	for _, realmID := range overrides.RealmIDs() {
+		createdBefore := now.Add(-absDuration(overrides[realmID]))
+		if err := db.purge(ctx, &purgeQuery{
+			table:       "access_entries",
+			realmColumn: "realm_id",
+			where:       "realm_id = ? AND created_at < ?",
+			args:        []interface{}{realmID, createdBefore},
+		}, opts, result); err != nil {
+			return result, err
+		}
+	}
+
+	createdBefore := now.Add(-absDuration(maxAge))
+	q := &purgeQuery{
+		table:       "access_entries",
+		realmColumn: "realm_id",
+		where:       "created_at < ?",
+		args:        []interface{}{createdBefore},
+	}
+	if ids := overrides.RealmIDs(); len(ids) > 0 {
+		q.where += " AND realm_id NOT IN (?)"
+		q.args = append(q.args, ids)
+	}
+	err := db.purge(ctx, q, opts, result)
+	return result, err
+}
@@ -0,0 +1,167 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/exposure-notifications-verification-server/pkg/pagination"
+)
+
+func TestAccessEntry_BeforeSave(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		structField string
+		field       string
+	}{
+		{"RealmID", "realm_id"},
+		{"ActorID", "actor_id"},
+		{"ActorDisplay", "actor_display"},
+		{"Action", "action"},
+		{"TargetID", "target_id"},
+		{"TargetDisplay", "target_display"},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.field, func(t *testing.T) {
+			t.Parallel()
+			exerciseValidation(t, &AccessEntry{}, tc.structField, tc.field)
+		})
+	}
+}
+
+func TestRealm_ShouldAuditAccess(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name   string
+		level  AccessAuditLevel
+		action *AccessAction
+		want   bool
+	}{
+		{"off_export", AccessAuditOff, AccessExportedUsers, false},
+		{"off_view", AccessAuditOff, AccessViewedCodeStatus, false},
+		{"exports_export", AccessAuditExports, AccessDownloadedStats, true},
+		{"exports_view", AccessAuditExports, AccessViewedAPIKey, false},
+		{"all_export", AccessAuditAll, AccessExportedAudits, true},
+		{"all_view", AccessAuditAll, AccessViewedCodeStatus, true},
+		{"nil_action", AccessAuditAll, nil, false},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			realm := &Realm{AccessAuditLevel: tc.level}
+			if got, want := realm.ShouldAuditAccess(tc.action), tc.want; got != want {
+				t.Errorf("expected %t to be %t", got, want)
+			}
+		})
+	}
+
+	t.Run("nil_realm", func(t *testing.T) {
+		t.Parallel()
+
+		var realm *Realm
+		if realm.ShouldAuditAccess(AccessExportedUsers) {
+			t.Errorf("expected nil realm to not audit access")
+		}
+	})
+}
+
+func TestDatabase_AccessEntries(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	db, _ := testDatabaseInstance.NewDatabase(t, nil)
+
+	realm := NewRealmWithDefaults("access")
+	if err := db.SaveRealm(realm, SystemTest); err != nil {
+		t.Fatal(err)
+	}
+
+	otherRealm := NewRealmWithDefaults("other")
+	if err := db.SaveRealm(otherRealm, SystemTest); err != nil {
+		t.Fatal(err)
+	}
+
+	user := &User{Email: "access@example.com", Name: "Access"}
+	if err := db.SaveUser(user, SystemTest); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 3; i++ {
+		for _, r := range []*Realm{realm, otherRealm} {
+			entry := BuildAccessEntry(user, AccessExportedUsers, r, r.ID)
+			entry.Method = "GET"
+			entry.Path = "/realm/users/export.csv"
+			if err := db.SaveAccessEntry(entry); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	entries, _, err := realm.ListAccessEntries(db, &pagination.PageParams{Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(entries), 3; got != want {
+		t.Fatalf("expected %d entries, got %d", want, got)
+	}
+	if got, want := entries[0].ActorID, user.AuditID(); got != want {
+		t.Errorf("expected actor %q to be %q", got, want)
+	}
+
+	entries, _, err = realm.ListAccessEntries(db, nil, WithAccessAction(AccessViewedAPIKey.Name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(entries), 0; got != want {
+		t.Errorf("expected %d entries, got %d", want, got)
+	}
+
+	count, err := realm.CountPurgeableAccessEntries(db, 24*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := count, int64(0); got != want {
+		t.Errorf("expected %d purgeable, got %d", want, got)
+	}
+
+	// Purges entries only in the realm with a shorter override.
+	result, err := db.PurgeAccessEntries(ctx, 24*time.Hour, RetentionOverrides{otherRealm.ID: time.Nanosecond}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := result.Count, int64(3); got != want {
+		t.Errorf("expected %d to purge, got %d", want, got)
+	}
+
+	// Purges the remaining entries.
+	result, err = db.PurgeAccessEntries(ctx, time.Nanosecond, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := result.Count, int64(3); got != want {
+		t.Errorf("expected %d to purge, got %d", want, got)
+	}
+}
@@ -0,0 +1,641 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/google/exposure-notifications-verification-server/pkg/jwthelper"
+	"github.com/google/exposure-notifications-verification-server/pkg/keyutils"
+	"github.com/jinzhu/gorm"
+)
+
+// ErrAuditChainSignerRequired is the error returned when an audit checkpoint or
+// truncation marker must be written, but no signing key is configured.
+var ErrAuditChainSignerRequired = errors.New("audit chain signing key is not configured")
+
+const (
+	// AuditCheckpointKindCheckpoint is a periodic signed commitment to the head
+	// of a realm's audit chain.
+	AuditCheckpointKindCheckpoint AuditCheckpointKind = "checkpoint"
+
+	// AuditCheckpointKindTruncation records the last entry removed from the
+	// start of a realm's audit chain by a purge. The next remaining entry links
+	// to its hash.
+	AuditCheckpointKindTruncation AuditCheckpointKind = "truncation"
+
+	// auditVerifyBatchSize is the number of audit entries read from the
+	// database at a time while verifying a chain.
+	auditVerifyBatchSize = 1000
+)
+
+// AuditCheckpointKind is the kind of an audit checkpoint.
+type AuditCheckpointKind string
+
+// AuditChainHead is the most recent entry in a realm's audit chain. New entries
+// lock the head while they are linked, which serializes the chain.
+type AuditChainHead struct {
+	RealmID  uint   `gorm:"primary_key; auto_increment:false"`
+	Sequence int64  `gorm:"not null"`
+	Hash     []byte `gorm:"type:bytea"`
+}
+
+// AuditCheckpoint is a signed commitment to the hash of the entry at a position
+// in a realm's audit chain.
+type AuditCheckpoint struct {
+	ID       uint                `gorm:"primary_key"`
+	RealmID  uint                `gorm:"not null"`
+	Kind     AuditCheckpointKind `gorm:"type:varchar(16); not null"`
+	Sequence int64               `gorm:"not null"`
+	Hash     []byte              `gorm:"type:bytea; not null"`
+
+	// Timestamp is the 'iat' claim of the signature.
+	Timestamp time.Time
+
+	// KeyID is the 'kid' header of the signature, Algorithm is the signing
+	// algorithm, and PublicKey is the PEM-encoded key which verifies it. They
+	// are empty if no signing key was configured when the checkpoint was
+	// recorded.
+	KeyID     string `gorm:"column:kid; type:varchar(64)"`
+	Algorithm string `gorm:"type:varchar(16)"`
+	PublicKey string `gorm:"type:text"`
+
+	// Signature is a compact JWS over the realm, kind, sequence, hash, and
+	// timestamp.
+	Signature string `gorm:"type:text"`
+
+	CreatedAt time.Time
+}
+
+// AuditCheckpointClaims are the claims of a signed audit checkpoint. Hash is the
+// base64 encoded hash of the entry at Sequence. The time of the checkpoint is
+// the 'iat' claim.
+type AuditCheckpointClaims struct {
+	RealmID  uint                `json:"realmID"`
+	Kind     AuditCheckpointKind `json:"kind"`
+	Sequence int64               `json:"sequence"`
+	Hash     string              `json:"hash"`
+	jwt.StandardClaims
+}
+
+// AuditChainSigner signs audit checkpoints with a key manager backed signer.
+type AuditChainSigner struct {
+	Signer crypto.Signer
+	KeyID  string
+}
+
+// sign signs the checkpoint at the given time.
+func (s *AuditChainSigner) sign(c *AuditCheckpoint, now time.Time) error {
+	if s == nil {
+		return ErrAuditChainSignerRequired
+	}
+	c.Timestamp = now.UTC().Truncate(time.Second)
+
+	publicKey, alg, err := keyutils.EncodePublicKey(s.Signer.Public())
+	if err != nil {
+		return fmt.Errorf("unsupported audit chain signing key: %w", err)
+	}
+
+	claims := &AuditCheckpointClaims{
+		RealmID:  c.RealmID,
+		Kind:     c.Kind,
+		Sequence: c.Sequence,
+		Hash:     base64.StdEncoding.EncodeToString(c.Hash),
+		StandardClaims: jwt.StandardClaims{
+			IssuedAt: c.Timestamp.Unix(),
+		},
+	}
+
+	token := jwt.NewWithClaims(alg.SigningMethod(), claims)
+	token.Header["kid"] = s.KeyID
+	signature, err := jwthelper.SignJWT(token, s.Signer)
+	if err != nil {
+		return fmt.Errorf("failed to sign audit checkpoint: %w", err)
+	}
+
+	c.KeyID = s.KeyID
+	c.Algorithm = string(alg)
+	c.PublicKey = publicKey
+	c.Signature = signature
+	return nil
+}
+
+// IsSigned returns true if the checkpoint has a signature.
+func (c *AuditCheckpoint) IsSigned() bool {
+	return c.Signature != ""
+}
+
+// VerifySignature verifies the checkpoint's signature with its public key and
+// that the signed claims match the checkpoint.
+func (c *AuditCheckpoint) VerifySignature() error {
+	publicKey, alg, err := keyutils.DecodePublicKey(c.PublicKey)
+	if err != nil {
+		return err
+	}
+	if got, want := c.Algorithm, string(alg); got != want {
+		return fmt.Errorf("algorithm %s does not match key algorithm %s", got, want)
+	}
+
+	var claims AuditCheckpointClaims
+	token, err := jwt.ParseWithClaims(c.Signature, &claims, func(token *jwt.Token) (interface{}, error) {
+		// Only accept the algorithm of the key, never the algorithm the
+		// signature claims to use.
+		if got, want := token.Method.Alg(), string(alg); got != want {
+			return nil, fmt.Errorf("signature algorithm %s does not match key algorithm %s", got, want)
+		}
+		return publicKey, nil
+	})
+	if err != nil {
+		return fmt.Errorf("invalid signature: %w", err)
+	}
+	if kid, _ := token.Header["kid"].(string); kid != c.KeyID {
+		return fmt.Errorf("signature kid %q does not match %q", kid, c.KeyID)
+	}
+
+	if claims.RealmID != c.RealmID ||
+		claims.Kind != c.Kind ||
+		claims.Sequence != c.Sequence ||
+		claims.Hash != base64.StdEncoding.EncodeToString(c.Hash) ||
+		claims.IssuedAt != c.Timestamp.Unix() {
+		return fmt.Errorf("signed claims do not match checkpoint")
+	}
+	return nil
+}
+
+// auditChainData is the data which is hashed for each entry. Auditors reproduce
+// entry hashes by hashing the previous entry's hash followed by this JSON
+// encoding.
+type auditChainData struct {
+	RealmID       uint   `json:"realmID"`
+	Sequence      int64  `json:"sequence"`
+	ActorID       string `json:"actorID"`
+	ActorDisplay  string `json:"actorDisplay"`
+	Action        string `json:"action"`
+	TargetID      string `json:"targetID"`
+	TargetDisplay string `json:"targetDisplay"`
+	Diff          string `json:"diff"`
+	CreatedAt     int64  `json:"createdAt"`
+
+	// Changes is omitted when empty, so entries created before structured
+	// changes were recorded keep their hashes.
+	Changes AuditChanges `json:"changes,omitempty"`
+}
+
+// ChainHash computes the entry's hash from its contents and PrevHash. It does
+// not modify the entry.
+func (a *AuditEntry) ChainHash() ([]byte, error) {
+	data, err := json.Marshal(&auditChainData{
+		RealmID:       a.RealmID,
+		Sequence:      a.ChainSequence,
+		ActorID:       a.ActorID,
+		ActorDisplay:  a.ActorDisplay,
+		Action:        a.Action,
+		TargetID:      a.TargetID,
+		TargetDisplay: a.TargetDisplay,
+		Diff:          a.Diff,
+		CreatedAt:     a.CreatedAt.UnixNano() / int64(time.Microsecond),
+		Changes:       a.Changes,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode audit entry: %w", err)
+	}
+
+	h := sha256.New()
+	h.Write(a.PrevHash)
+	h.Write(data)
+	return h.Sum(nil), nil
+}
+
+// linkAuditEntry appends the entry to its realm's chain in the transaction. The
+// chain head stays locked until the transaction finishes, so the entry's
+// creation time is assigned after the lock is acquired to keep times in chain
+// order.
+func linkAuditEntry(tx *gorm.DB, a *AuditEntry) error {
+	if err := tx.Exec(
+		`INSERT INTO audit_chain_heads (realm_id, sequence) VALUES (?, 0) ON CONFLICT (realm_id) DO NOTHING`,
+		a.RealmID).Error; err != nil {
+		return fmt.Errorf("failed to create audit chain head: %w", err)
+	}
+
+	var head AuditChainHead
+	if err := tx.
+		Set("gorm:query_option", "FOR UPDATE").
+		Where("realm_id = ?", a.RealmID).
+		First(&head).
+		Error; err != nil {
+		return fmt.Errorf("failed to lock audit chain head: %w", err)
+	}
+
+	// Postgres stores microseconds, so truncate to hash the stored value.
+	if a.CreatedAt.IsZero() {
+		a.CreatedAt = time.Now()
+	}
+	a.CreatedAt = a.CreatedAt.UTC().Truncate(time.Microsecond)
+
+	a.ChainSequence = head.Sequence + 1
+	a.PrevHash = head.Hash
+
+	hash, err := a.ChainHash()
+	if err != nil {
+		return err
+	}
+	a.Hash = hash
+
+	if err := tx.
+		Model(&AuditChainHead{}).
+		Where("realm_id = ?", a.RealmID).
+		UpdateColumns(map[string]interface{}{
+			"sequence": a.ChainSequence,
+			"hash":     a.Hash,
+		}).
+		Error; err != nil {
+		return fmt.Errorf("failed to update audit chain head: %w", err)
+	}
+	return nil
+}
+
+// CreateAuditCheckpoints signs a checkpoint for the head of each realm's audit
+// chain which has grown since its last checkpoint. It returns the number of
+// checkpoints created.
+func (db *Database) CreateAuditCheckpoints(signer *AuditChainSigner) (int, error) {
+	if signer == nil {
+		return 0, ErrAuditChainSignerRequired
+	}
+
+	var heads []*AuditChainHead
+	if err := db.db.
+		Where("sequence > 0").
+		Order("realm_id").
+		Find(&heads).
+		Error; err != nil && !IsNotFound(err) {
+		return 0, fmt.Errorf("failed to list audit chain heads: %w", err)
+	}
+
+	var created int
+	for _, head := range heads {
+		latest, err := db.latestAuditCheckpoint(head.RealmID, AuditCheckpointKindCheckpoint)
+		if err != nil && !IsNotFound(err) {
+			return created, err
+		}
+		if latest != nil && latest.Sequence >= head.Sequence {
+			continue
+		}
+
+		checkpoint := &AuditCheckpoint{
+			RealmID:  head.RealmID,
+			Kind:     AuditCheckpointKindCheckpoint,
+			Sequence: head.Sequence,
+			Hash:     head.Hash,
+		}
+		if err := signer.sign(checkpoint, time.Now()); err != nil {
+			return created, err
+		}
+		if err := db.db.Create(checkpoint).Error; err != nil {
+			return created, fmt.Errorf("failed to save audit checkpoint for realm %d: %w", head.RealmID, err)
+		}
+		created++
+	}
+	return created, nil
+}
+
+// latestAuditCheckpoint returns the realm's checkpoint of the kind with the
+// highest sequence.
+func (db *Database) latestAuditCheckpoint(realmID uint, kind AuditCheckpointKind) (*AuditCheckpoint, error) {
+	var checkpoint AuditCheckpoint
+	if err := db.db.
+		Where("realm_id = ?", realmID).
+		Where("kind = ?", kind).
+		Order("sequence DESC, id DESC").
+		First(&checkpoint).
+		Error; err != nil {
+		return nil, err
+	}
+	return &checkpoint, nil
+}
+
+// truncateAuditChain records a truncation marker for the last entry in the
+// realm's chain created before the given time, unless one already exists, and
+// returns its sequence. Entries up to and including the sequence can then be
+// deleted without breaking verification. It returns 0 if no entries were
+// created before the time, and an error if there are entries to truncate but
+// signer is nil, since an unsigned marker could be forged to hide deletions.
+func (db *Database) truncateAuditChain(realmID uint, createdBefore time.Time, signer *AuditChainSigner, dryRun bool) (int64, error) {
+	var last AuditEntry
+	if err := db.db.
+		Select("chain_sequence, hash").
+		Where("realm_id = ?", realmID).
+		Where("chain_sequence > 0").
+		Where("created_at < ?", createdBefore).
+		Order("chain_sequence DESC").
+		First(&last).
+		Error; err != nil {
+		if IsNotFound(err) {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("failed to find last purged audit entry: %w", err)
+	}
+
+	if signer == nil {
+		return 0, ErrAuditChainSignerRequired
+	}
+
+	if dryRun {
+		return last.ChainSequence, nil
+	}
+
+	latest, err := db.latestAuditCheckpoint(realmID, AuditCheckpointKindTruncation)
+	if err != nil && !IsNotFound(err) {
+		return 0, err
+	}
+	if latest != nil && latest.Sequence >= last.ChainSequence {
+		return last.ChainSequence, nil
+	}
+
+	marker := &AuditCheckpoint{
+		RealmID:  realmID,
+		Kind:     AuditCheckpointKindTruncation,
+		Sequence: last.ChainSequence,
+		Hash:     last.Hash,
+	}
+	if err := signer.sign(marker, time.Now()); err != nil {
+		return 0, err
+	}
+	if err := db.db.Create(marker).Error; err != nil {
+		return 0, fmt.Errorf("failed to save audit truncation marker: %w", err)
+	}
+	return last.ChainSequence, nil
+}
+
+// ListAuditChainRealmIDs returns the IDs of the realms which have an audit
+// chain, including 0 for system events.
+func (db *Database) ListAuditChainRealmIDs() ([]uint, error) {
+	var ids []uint
+	if err := db.db.
+		Model(&AuditChainHead{}).
+		Order("realm_id").
+		Pluck("realm_id", &ids).
+		Error; err != nil && !IsNotFound(err) {
+		return nil, fmt.Errorf("failed to list audit chains: %w", err)
+	}
+	return ids, nil
+}
+
+// AuditChainReport is the result of verifying a realm's audit chain.
+type AuditChainReport struct {
+	RealmID uint `json:"realmID"`
+
+	// FirstSequence and LastSequence are the range of chained entries which
+	// remain, and Entries is the number of them which were verified.
+	FirstSequence int64 `json:"firstSequence"`
+	LastSequence  int64 `json:"lastSequence"`
+	Entries       int64 `json:"entries"`
+
+	// Checkpoints is the number of checkpoints and truncation markers which
+	// were verified.
+	Checkpoints int `json:"checkpoints"`
+
+	// Problems are evidence of missing or modified entries, or of checkpoints
+	// which are unsigned or not signed by a trusted key.
+	Problems []string `json:"problems,omitempty"`
+}
+
+// OK returns true if no problems were found.
+func (r *AuditChainReport) OK() bool {
+	return len(r.Problems) == 0
+}
+
+func (r *AuditChainReport) problem(format string, args ...interface{}) {
+	r.Problems = append(r.Problems, fmt.Sprintf(format, args...))
+}
+
+// VerifyAuditChain verifies the realm's audit chain. Each entry's hash is
+// recomputed and must link to the previous entry, the first remaining entry
+// must link to a truncation marker unless it is the first entry ever, and the
+// chain must end at the chain head and every checkpoint. Every checkpoint must
+// be signed, and the public key recorded on it must be one of trustedKeys.
+//
+// The report lists any problems found. An error is only returned if the
+// verification could not be performed, including when trustedKeys is empty.
+func (db *Database) VerifyAuditChain(realmID uint, trustedKeys []string) (*AuditChainReport, error) {
+	if len(trustedKeys) == 0 {
+		return nil, fmt.Errorf("at least one trusted key is required")
+	}
+
+	report := &AuditChainReport{RealmID: realmID}
+
+	var head AuditChainHead
+	if err := db.db.Where("realm_id = ?", realmID).First(&head).Error; err != nil {
+		if !IsNotFound(err) {
+			return nil, fmt.Errorf("failed to find audit chain head: %w", err)
+		}
+	}
+
+	var checkpoints []*AuditCheckpoint
+	if err := db.db.
+		Where("realm_id = ?", realmID).
+		Order("sequence ASC, id ASC").
+		Find(&checkpoints).
+		Error; err != nil && !IsNotFound(err) {
+		return nil, fmt.Errorf("failed to list audit checkpoints: %w", err)
+	}
+
+	// Verify the checkpoint signatures, and index them by sequence.
+	truncations := make(map[int64]*AuditCheckpoint)
+	var maxTruncation *AuditCheckpoint
+	for _, c := range checkpoints {
+		report.Checkpoints++
+		verifyAuditCheckpoint(report, c, trustedKeys)
+
+		if c.Kind == AuditCheckpointKindTruncation {
+			truncations[c.Sequence] = c
+			if maxTruncation == nil || c.Sequence > maxTruncation.Sequence {
+				maxTruncation = c
+			}
+		}
+	}
+
+	// Walk the chain in order.
+	var prev *AuditEntry
+	hashes := make(map[int64][]byte, len(checkpoints))
+	wanted := make(map[int64]bool, len(checkpoints))
+	for _, c := range checkpoints {
+		wanted[c.Sequence] = true
+	}
+
+	for {
+		var entries []*AuditEntry
+		q := db.db.
+			Where("realm_id = ?", realmID).
+			Where("chain_sequence > 0").
+			Order("chain_sequence ASC").
+			Limit(auditVerifyBatchSize)
+		if prev != nil {
+			q = q.Where("chain_sequence > ?", prev.ChainSequence)
+		}
+		if err := q.Find(&entries).Error; err != nil && !IsNotFound(err) {
+			return nil, fmt.Errorf("failed to list audit entries: %w", err)
+		}
+
+		for _, e := range entries {
+			verifyAuditEntry(report, prev, e, truncations)
+			if wanted[e.ChainSequence] {
+				hashes[e.ChainSequence] = e.Hash
+			}
+			if prev == nil {
+				report.FirstSequence = e.ChainSequence
+			}
+			report.LastSequence = e.ChainSequence
+			report.Entries++
+			prev = e
+		}
+
+		if len(entries) < auditVerifyBatchSize {
+			break
+		}
+	}
+
+	// The chain must end at the head. If every entry was purged, the head must be
+	// the last truncated entry.
+	switch {
+	case prev != nil:
+		if head.Sequence != prev.ChainSequence || !bytes.Equal(head.Hash, prev.Hash) {
+			report.problem("chain ends at entry %d but the head is entry %d: entries were deleted or the head was modified",
+				prev.ChainSequence, head.Sequence)
+		}
+	case head.Sequence > 0:
+		if maxTruncation == nil || maxTruncation.Sequence != head.Sequence || !bytes.Equal(maxTruncation.Hash, head.Hash) {
+			report.problem("no entries remain but the head is entry %d and was not truncated", head.Sequence)
+		}
+	}
+
+	// Checkpoints of remaining entries must match them.
+	for _, c := range checkpoints {
+		if c.Kind != AuditCheckpointKindCheckpoint || c.Sequence < report.FirstSequence || report.Entries == 0 {
+			continue
+		}
+		hash, ok := hashes[c.Sequence]
+		if !ok {
+			report.problem("checkpoint %d: entry %d is missing", c.ID, c.Sequence)
+			continue
+		}
+		if !bytes.Equal(hash, c.Hash) {
+			report.problem("checkpoint %d: hash of entry %d does not match", c.ID, c.Sequence)
+		}
+	}
+
+	// Entries which were inserted without being chained are not covered by the
+	// chain. Legacy entries were created before the first chained entry.
+	var unchained struct {
+		Count int64
+	}
+	if err := db.db.Raw(`
+		SELECT COUNT(*) AS count FROM audit_entries
+		WHERE realm_id = ? AND chain_sequence = 0 AND id > (
+			SELECT MIN(id) FROM audit_entries WHERE realm_id = ? AND chain_sequence > 0
+		)`, realmID, realmID).
+		Scan(&unchained).
+		Error; err != nil {
+		return nil, fmt.Errorf("failed to count unchained audit entries: %w", err)
+	}
+	if unchained.Count > 0 {
+		report.problem("%d entries were inserted without being chained", unchained.Count)
+	}
+
+	return report, nil
+}
+
+// verifyAuditCheckpoint verifies the checkpoint's signature, adding problems to
+// the report. The checkpoint must be signed by one of the trusted keys.
+func verifyAuditCheckpoint(report *AuditChainReport, c *AuditCheckpoint, trustedKeys []string) {
+	if !c.IsSigned() {
+		report.problem("%s %d at entry %d is not signed", c.Kind, c.ID, c.Sequence)
+		return
+	}
+
+	if err := c.VerifySignature(); err != nil {
+		report.problem("%s %d at entry %d: %s", c.Kind, c.ID, c.Sequence, err)
+		return
+	}
+
+	for _, k := range trustedKeys {
+		if publicKeysEqual(k, c.PublicKey) {
+			return
+		}
+	}
+	report.problem("%s %d at entry %d is signed by an untrusted key %q", c.Kind, c.ID, c.Sequence, c.KeyID)
+}
+
+// verifyAuditEntry verifies that e correctly follows prev, adding problems to
+// the report. prev is nil for the first remaining entry.
+func verifyAuditEntry(report *AuditChainReport, prev, e *AuditEntry, truncations map[int64]*AuditCheckpoint) {
+	hash, err := e.ChainHash()
+	if err != nil {
+		report.problem("entry %d: %s", e.ChainSequence, err)
+		return
+	}
+	if !bytes.Equal(hash, e.Hash) {
+		report.problem("entry %d (id %d) was modified", e.ChainSequence, e.ID)
+	}
+
+	var prevHash []byte
+	switch {
+	case prev != nil:
+		if e.ChainSequence != prev.ChainSequence+1 {
+			report.problem("entries %d through %d are missing", prev.ChainSequence+1, e.ChainSequence-1)
+		}
+		prevHash = prev.Hash
+	case e.ChainSequence == 1:
+		// The first entry has no previous hash.
+	default:
+		marker, ok := truncations[e.ChainSequence-1]
+		if !ok {
+			report.problem("entries before %d are missing and were not truncated", e.ChainSequence)
+			return
+		}
+		prevHash = marker.Hash
+	}
+
+	if !bytes.Equal(e.PrevHash, prevHash) {
+		report.problem("entry %d (id %d) does not link to the previous entry", e.ChainSequence, e.ID)
+	}
+}
+
+// publicKeysEqual returns true if the PEM encoded public keys are the same key.
+func publicKeysEqual(a, b string) bool {
+	ak, _, err := keyutils.DecodePublicKey(a)
+	if err != nil {
+		return false
+	}
+	bk, _, err := keyutils.DecodePublicKey(b)
+	if err != nil {
+		return false
+	}
+
+	type equaler interface {
+		Equal(crypto.PublicKey) bool
+	}
+	if e, ok := ak.(equaler); ok {
+		return e.Equal(bk)
+	}
+	return false
+}
@@ -0,0 +1,386 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/exposure-notifications-verification-server/pkg/keyutils"
+)
+
+func TestAuditEntry_ChainHash(t *testing.T) {
+	t.Parallel()
+
+	entry := &AuditEntry{
+		RealmID:       1,
+		ChainSequence: 2,
+		PrevHash:      []byte("previous"),
+		ActorID:       "actor:1",
+		ActorDisplay:  "Actor",
+		Action:        "created",
+		TargetID:      "target:1",
+		TargetDisplay: "Target",
+		Diff:          "+ name",
+		CreatedAt:     time.Date(2020, 10, 1, 12, 0, 0, 123000, time.UTC),
+	}
+
+	hash, err := entry.ChainHash()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The hash is deterministic and does not depend on the ID.
+	copied := *entry
+	copied.ID = 123
+	copiedHash, err := copied.ChainHash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(hash, copiedHash) {
+		t.Errorf("expected hashes to match")
+	}
+
+	// Entries without structured changes hash as they did before changes were
+	// recorded.
+	copied = *entry
+	copied.Changes = AuditChanges{}
+	copiedHash, err = copied.ChainHash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(hash, copiedHash) {
+		t.Errorf("expected hashes to match without changes")
+	}
+
+	cases := []struct {
+		name   string
+		modify func(a *AuditEntry)
+	}{
+		{"realm", func(a *AuditEntry) { a.RealmID = 2 }},
+		{"sequence", func(a *AuditEntry) { a.ChainSequence = 3 }},
+		{"prev_hash", func(a *AuditEntry) { a.PrevHash = []byte("other") }},
+		{"actor", func(a *AuditEntry) { a.ActorDisplay = "Someone" }},
+		{"action", func(a *AuditEntry) { a.Action = "deleted" }},
+		{"target", func(a *AuditEntry) { a.TargetID = "target:2" }},
+		{"diff", func(a *AuditEntry) { a.Diff = "" }},
+		{"changes", func(a *AuditEntry) { a.AddChange("Name", "a", "b") }},
+		{"created_at", func(a *AuditEntry) { a.CreatedAt = a.CreatedAt.Add(time.Microsecond) }},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			modified := *entry
+			tc.modify(&modified)
+
+			got, err := modified.ChainHash()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if bytes.Equal(got, hash) {
+				t.Errorf("expected hash to change")
+			}
+		})
+	}
+}
+
+func TestAuditCheckpoint_VerifySignature(t *testing.T) {
+	t.Parallel()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer := &AuditChainSigner{Signer: key, KeyID: "v1"}
+
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherSigner := &AuditChainSigner{Signer: otherKey, KeyID: "v1"}
+
+	newCheckpoint := func(t testing.TB, s *AuditChainSigner) *AuditCheckpoint {
+		c := &AuditCheckpoint{
+			RealmID:  1,
+			Kind:     AuditCheckpointKindTruncation,
+			Sequence: 10,
+			Hash:     []byte("hash"),
+		}
+		if err := s.sign(c, time.Now()); err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+
+	cases := []struct {
+		name   string
+		modify func(c *AuditCheckpoint)
+		err    bool
+	}{
+		{"valid", func(c *AuditCheckpoint) {}, false},
+		{"realm", func(c *AuditCheckpoint) { c.RealmID = 2 }, true},
+		{"kind", func(c *AuditCheckpoint) { c.Kind = AuditCheckpointKindCheckpoint }, true},
+		{"sequence", func(c *AuditCheckpoint) { c.Sequence = 11 }, true},
+		{"hash", func(c *AuditCheckpoint) { c.Hash = []byte("other") }, true},
+		{"timestamp", func(c *AuditCheckpoint) { c.Timestamp = c.Timestamp.Add(time.Second) }, true},
+		{"kid", func(c *AuditCheckpoint) { c.KeyID = "v2" }, true},
+		{"signature", func(c *AuditCheckpoint) { c.Signature = c.Signature[:len(c.Signature)-4] + "AAAA" }, true},
+		{"public_key", func(c *AuditCheckpoint) { c.PublicKey = newCheckpoint(t, otherSigner).PublicKey }, true},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			c := newCheckpoint(t, signer)
+			tc.modify(c)
+
+			err := c.VerifySignature()
+			if got, want := err != nil, tc.err; got != want {
+				t.Errorf("expected error to be %t, got %v", want, err)
+			}
+		})
+	}
+
+	// Checkpoints cannot be created without a signer.
+	var unsigned *AuditChainSigner
+	c := &AuditCheckpoint{RealmID: 1, Kind: AuditCheckpointKindTruncation}
+	if err := unsigned.sign(c, time.Now()); !errors.Is(err, ErrAuditChainSignerRequired) {
+		t.Errorf("expected %v, got %v", ErrAuditChainSignerRequired, err)
+	}
+}
+
+func TestDatabase_VerifyAuditChain(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer := &AuditChainSigner{Signer: key, KeyID: "v1"}
+	trustedKey, _, err := keyutils.EncodePublicKey(key.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherSigner := &AuditChainSigner{Signer: otherKey, KeyID: "v1"}
+
+	createEntries := func(tb testing.TB, db *Database, realmID uint, n int) {
+		tb.Helper()
+
+		for i := 0; i < n; i++ {
+			if err := db.SaveAuditEntry(&AuditEntry{
+				RealmID:       realmID,
+				ActorID:       "actor:1",
+				ActorDisplay:  "Actor",
+				Action:        "created",
+				TargetID:      "target:1",
+				TargetDisplay: "Target",
+			}); err != nil {
+				tb.Fatal(err)
+			}
+		}
+	}
+
+	verify := func(tb testing.TB, db *Database, realmID uint, ok bool) *AuditChainReport {
+		tb.Helper()
+
+		report, err := db.VerifyAuditChain(realmID, []string{trustedKey})
+		if err != nil {
+			tb.Fatal(err)
+		}
+		if got, want := report.OK(), ok; got != want {
+			tb.Errorf("expected ok to be %t, got %t: %v", want, got, report.Problems)
+		}
+		return report
+	}
+
+	t.Run("valid", func(t *testing.T) {
+		t.Parallel()
+
+		db, _ := testDatabaseInstance.NewDatabase(t, nil)
+		createEntries(t, db, 1, 5)
+
+		created, err := db.CreateAuditCheckpoints(signer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := created, 1; got != want {
+			t.Errorf("expected %d checkpoints, got %d", want, got)
+		}
+
+		// No new entries, so no new checkpoints.
+		created, err = db.CreateAuditCheckpoints(signer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := created, 0; got != want {
+			t.Errorf("expected %d checkpoints, got %d", want, got)
+		}
+
+		report := verify(t, db, 1, true)
+		if got, want := report.Entries, int64(5); got != want {
+			t.Errorf("expected %d entries, got %d", want, got)
+		}
+		if got, want := report.Checkpoints, 1; got != want {
+			t.Errorf("expected %d checkpoints, got %d", want, got)
+		}
+	})
+
+	t.Run("no_trusted_keys", func(t *testing.T) {
+		t.Parallel()
+
+		db, _ := testDatabaseInstance.NewDatabase(t, nil)
+		createEntries(t, db, 1, 5)
+
+		if _, err := db.VerifyAuditChain(1, nil); err == nil {
+			t.Errorf("expected error")
+		}
+	})
+
+	t.Run("untrusted", func(t *testing.T) {
+		t.Parallel()
+
+		db, _ := testDatabaseInstance.NewDatabase(t, nil)
+		createEntries(t, db, 1, 5)
+
+		if _, err := db.CreateAuditCheckpoints(otherSigner); err != nil {
+			t.Fatal(err)
+		}
+		verify(t, db, 1, false)
+	})
+
+	t.Run("unsigned", func(t *testing.T) {
+		t.Parallel()
+
+		db, _ := testDatabaseInstance.NewDatabase(t, nil)
+		createEntries(t, db, 1, 5)
+
+		if _, err := db.CreateAuditCheckpoints(signer); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.db.Exec(`UPDATE audit_checkpoints SET signature = '', public_key = ''`).Error; err != nil {
+			t.Fatal(err)
+		}
+		verify(t, db, 1, false)
+	})
+
+	t.Run("modified", func(t *testing.T) {
+		t.Parallel()
+
+		db, _ := testDatabaseInstance.NewDatabase(t, nil)
+		createEntries(t, db, 1, 5)
+
+		if err := db.db.Exec(`UPDATE audit_entries SET actor_display = 'Someone' WHERE chain_sequence = 3`).Error; err != nil {
+			t.Fatal(err)
+		}
+		verify(t, db, 1, false)
+	})
+
+	t.Run("deleted", func(t *testing.T) {
+		t.Parallel()
+
+		db, _ := testDatabaseInstance.NewDatabase(t, nil)
+		createEntries(t, db, 1, 5)
+
+		if err := db.db.Exec(`DELETE FROM audit_entries WHERE chain_sequence = 3`).Error; err != nil {
+			t.Fatal(err)
+		}
+		verify(t, db, 1, false)
+	})
+
+	t.Run("deleted_last", func(t *testing.T) {
+		t.Parallel()
+
+		db, _ := testDatabaseInstance.NewDatabase(t, nil)
+		createEntries(t, db, 1, 5)
+
+		if err := db.db.Exec(`DELETE FROM audit_entries WHERE chain_sequence = 5`).Error; err != nil {
+			t.Fatal(err)
+		}
+		verify(t, db, 1, false)
+	})
+
+	t.Run("purged_without_signer", func(t *testing.T) {
+		t.Parallel()
+
+		db, _ := testDatabaseInstance.NewDatabase(t, nil)
+		createEntries(t, db, 1, 5)
+
+		if _, err := db.PurgeAuditEntries(ctx, 1*time.Nanosecond, nil, nil, nil); !errors.Is(err, ErrAuditChainSignerRequired) {
+			t.Errorf("expected %v, got %v", ErrAuditChainSignerRequired, err)
+		}
+
+		var count int64
+		if err := db.db.Model(&AuditEntry{}).Count(&count).Error; err != nil {
+			t.Fatal(err)
+		}
+		if got, want := count, int64(5); got != want {
+			t.Errorf("expected %d entries to remain, got %d", want, got)
+		}
+	})
+
+	t.Run("purged", func(t *testing.T) {
+		t.Parallel()
+
+		db, _ := testDatabaseInstance.NewDatabase(t, nil)
+		createEntries(t, db, 1, 5)
+
+		result, err := db.PurgeAuditEntries(ctx, 1*time.Nanosecond, nil, signer, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := result.Count, int64(5); got != want {
+			t.Errorf("expected %d to purge, got %d", want, got)
+		}
+		verify(t, db, 1, true)
+
+		// New entries link to the truncation marker.
+		createEntries(t, db, 1, 2)
+		report := verify(t, db, 1, true)
+		if got, want := report.FirstSequence, int64(6); got != want {
+			t.Errorf("expected first sequence %d, got %d", want, got)
+		}
+	})
+}
+
+// testAuditChainSigner returns a signer for audit checkpoints with a new key.
+func testAuditChainSigner(tb testing.TB) *AuditChainSigner {
+	tb.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return &AuditChainSigner{Signer: key, KeyID: "v1"}
+}
@@ -0,0 +1,112 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+)
+
+var _ sql.Scanner = (*AuditChanges)(nil)
+var _ driver.Valuer = (AuditChanges)(nil)
+
+// AuditChange is the structured change of a single field. Field is the name of
+// the field on the audited model, and Old and New are the JSON encodings of
+// its values, so that the prior state can be reconstructed.
+type AuditChange struct {
+	Field string          `json:"field"`
+	Old   json.RawMessage `json:"old"`
+	New   json.RawMessage `json:"new"`
+}
+
+// OldString and NewString return the JSON values as strings for display.
+func (c *AuditChange) OldString() string { return string(c.Old) }
+func (c *AuditChange) NewString() string { return string(c.New) }
+
+// AuditChanges are the structured changes of an audit entry. They are stored
+// as JSON text rather than JSONB, because JSONB does not preserve the encoded
+// bytes, which are part of the entry's chain hash.
+type AuditChanges []*AuditChange
+
+// Scan reads the changes from their JSON text.
+func (c *AuditChanges) Scan(src interface{}) error {
+	var b []byte
+	switch t := src.(type) {
+	case nil:
+		*c = nil
+		return nil
+	case []byte:
+		b = t
+	case string:
+		b = []byte(t)
+	default:
+		return fmt.Errorf("invalid scan type %T", src)
+	}
+
+	var changes AuditChanges
+	if err := json.Unmarshal(b, &changes); err != nil {
+		return fmt.Errorf("failed to decode audit changes: %w", err)
+	}
+	*c = changes
+	return nil
+}
+
+// Value encodes the changes as JSON text, or NULL if there are none.
+func (c AuditChanges) Value() (driver.Value, error) {
+	if len(c) == 0 {
+		return nil, nil
+	}
+
+	b, err := json.Marshal(c)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode audit changes: %w", err)
+	}
+	return string(b), nil
+}
+
+// Find returns the change of the field, or nil if the field did not change.
+func (c AuditChanges) Find(field string) *AuditChange {
+	for _, change := range c {
+		if change.Field == field {
+			return change
+		}
+	}
+	return nil
+}
+
+// AddChange records the structured change of the field from old to new. It is
+// recorded alongside the human-readable Diff. If either value cannot be
+// encoded, an error is added to the entry and saving it fails.
+func (a *AuditEntry) AddChange(field string, old, new interface{}) {
+	oldJSON, err := json.Marshal(old)
+	if err != nil {
+		a.AddError("changes", fmt.Sprintf("failed to encode old %s: %s", field, err))
+		return
+	}
+
+	newJSON, err := json.Marshal(new)
+	if err != nil {
+		a.AddError("changes", fmt.Sprintf("failed to encode new %s: %s", field, err))
+		return
+	}
+
+	a.Changes = append(a.Changes, &AuditChange{
+		Field: field,
+		Old:   oldJSON,
+		New:   newJSON,
+	})
+}
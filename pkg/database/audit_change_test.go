@@ -0,0 +1,95 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestAuditChanges_ScanValue(t *testing.T) {
+	t.Parallel()
+
+	var a AuditEntry
+	a.AddChange("Name", "old", "new")
+	a.AddChange("CodeLength", uint(6), uint(8))
+	if msgs := a.ErrorMessages(); len(msgs) > 0 {
+		t.Fatalf("unexpected errors: %v", msgs)
+	}
+
+	v, err := a.Changes.Value()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got AuditChanges
+	if err := got.Scan(v); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(a.Changes, got); diff != "" {
+		t.Errorf("mismatch (-want, +got):\n%s", diff)
+	}
+
+	change := got.Find("CodeLength")
+	if change == nil {
+		t.Fatal("expected CodeLength change")
+	}
+	if got, want := change.OldString(), "6"; got != want {
+		t.Errorf("expected %q to be %q", got, want)
+	}
+	if got, want := change.NewString(), "8"; got != want {
+		t.Errorf("expected %q to be %q", got, want)
+	}
+	if change := got.Find("Timezone"); change != nil {
+		t.Errorf("expected no Timezone change, got %#v", change)
+	}
+
+	// No changes are stored as NULL.
+	var empty AuditChanges
+	v, err = empty.Value()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != nil {
+		t.Errorf("expected %#v to be nil", v)
+	}
+	if err := empty.Scan(nil); err != nil {
+		t.Fatal(err)
+	}
+	if empty != nil {
+		t.Errorf("expected %#v to be nil", empty)
+	}
+}
+
+func TestAuditEntry_AddChange(t *testing.T) {
+	t.Parallel()
+
+	var a AuditEntry
+	a.AddChange("Invalid", make(chan int), "new")
+	if len(a.Changes) != 0 {
+		t.Errorf("expected no changes, got %#v", a.Changes)
+	}
+	if errs := a.ErrorsFor("changes"); len(errs) == 0 {
+		t.Errorf("expected errors for changes")
+	}
+
+	a = AuditEntry{}
+	a.AddChange("AllowedCIDRsAdminAPI", []string{"a", "b"}, []string{"a"})
+	if got, want := a.Changes[0].Old, json.RawMessage(`["a","b"]`); string(got) != string(want) {
+		t.Errorf("expected %s to be %s", got, want)
+	}
+}
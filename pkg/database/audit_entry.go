@@ -15,6 +15,8 @@
 package database
 
 import (
+	"context"
+	"fmt"
 	"time"
 
 	"github.com/google/exposure-notifications-verification-server/pkg/pagination"
@@ -60,8 +62,21 @@ type AuditEntry struct {
 	// Diff is the change of structure that occurred, if any.
 	Diff string `gorm:"column:diff; type:text;"`
 
+	// Changes are the structured field-level changes behind Diff, if any.
+	// Entries created before structured changes were recorded have none.
+	Changes AuditChanges `gorm:"column:changes; type:text;"`
+
 	// CreatedAt is when the entry was created.
 	CreatedAt time.Time
+
+	// ChainSequence is the entry's position in its realm's hash chain, starting
+	// at 1. Entries created before chaining have a sequence of 0.
+	ChainSequence int64 `gorm:"column:chain_sequence; type:bigint; not null; default:0;"`
+
+	// PrevHash is the hash of the previous entry in the realm's chain, and Hash
+	// is the hash of this entry's contents and PrevHash. See ChainHash.
+	PrevHash []byte `gorm:"column:prev_hash; type:bytea;"`
+	Hash     []byte `gorm:"column:hash; type:bytea;"`
 }
 
 // BeforeSave runs validations. If there are errors, the save fails.
@@ -87,24 +102,84 @@ func (a *AuditEntry) BeforeSave(tx *gorm.DB) error {
 	return a.ErrorOrNil()
 }
 
+// BeforeCreate links the entry into its realm's hash chain. It runs in the
+// transaction which creates the entry.
+func (a *AuditEntry) BeforeCreate(tx *gorm.DB) error {
+	return linkAuditEntry(tx, a)
+}
+
 // SaveAuditEntry saves the audit entry.
 func (db *Database) SaveAuditEntry(a *AuditEntry) error {
 	return db.db.Save(a).Error
 }
 
 // PurgeAuditEntries will delete audit entries which were created longer than
-// maxAge ago.
-func (db *Database) PurgeAuditEntries(maxAge time.Duration) (int64, error) {
-	if maxAge > 0 {
-		maxAge = -1 * maxAge
+// maxAge ago. Realms in overrides use their own maximum age instead.
+//
+// Chained entries are deleted from the start of each realm's chain, after a
+// truncation marker signed by signer records the last deleted entry, so the
+// remaining chain can still be verified. If signer is nil and there are chained
+// entries to delete, ErrAuditChainSignerRequired is returned.
+func (db *Database) PurgeAuditEntries(ctx context.Context, maxAge time.Duration, overrides RetentionOverrides, signer *AuditChainSigner, opts *PurgeOptions) (*PurgeResult, error) {
+	now := time.Now().UTC()
+	result := &PurgeResult{Table: "audit_entries"}
+	dryRun := opts != nil && opts.DryRun
+
+	realmIDs, err := db.ListAuditChainRealmIDs()
+	if err != nil {
+		return result, err
+	}
+
+	for _, realmID := range realmIDs {
+		createdBefore := now.Add(-absDuration(maxAge))
+		if d, ok := overrides[realmID]; ok {
+			createdBefore = now.Add(-absDuration(d))
+		}
+
+		sequence, err := db.truncateAuditChain(realmID, createdBefore, signer, dryRun)
+		if err != nil {
+			return result, fmt.Errorf("failed to truncate audit chain for realm %d: %w", realmID, err)
+		}
+		if sequence == 0 {
+			continue
+		}
+
+		if err := db.purge(ctx, &purgeQuery{
+			table:       "audit_entries",
+			realmColumn: "realm_id",
+			where:       "realm_id = ? AND chain_sequence > 0 AND chain_sequence <= ?",
+			args:        []interface{}{realmID, sequence},
+		}, opts, result); err != nil {
+			return result, err
+		}
 	}
-	createdBefore := time.Now().UTC().Add(maxAge)
 
-	result := db.db.
-		Unscoped().
-		Where("created_at < ?", createdBefore).
-		Delete(&AuditEntry{})
-	return result.RowsAffected, result.Error
+	// Entries created before chaining are purged by age.
+	for _, realmID := range overrides.RealmIDs() {
+		createdBefore := now.Add(-absDuration(overrides[realmID]))
+		if err := db.purge(ctx, &purgeQuery{
+			table:       "audit_entries",
+			realmColumn: "realm_id",
+			where:       "chain_sequence = 0 AND realm_id = ? AND created_at < ?",
+			args:        []interface{}{realmID, createdBefore},
+		}, opts, result); err != nil {
+			return result, err
+		}
+	}
+
+	createdBefore := now.Add(-absDuration(maxAge))
+	q := &purgeQuery{
+		table:       "audit_entries",
+		realmColumn: "realm_id",
+		where:       "chain_sequence = 0 AND created_at < ?",
+		args:        []interface{}{createdBefore},
+	}
+	if ids := overrides.RealmIDs(); len(ids) > 0 {
+		q.where += " AND realm_id NOT IN (?)"
+		q.args = append(q.args, ids)
+	}
+	err = db.purge(ctx, q, opts, result)
+	return result, err
 }
 
 // ListAudits returns the list audit events which match the given criteria.
@@ -15,6 +15,7 @@
 package database
 
 import (
+	"context"
 	"testing"
 	"time"
 
@@ -48,38 +49,64 @@ func TestAuditEntry_BeforeSave(t *testing.T) {
 func TestDatabase_PurgeAuditEntries(t *testing.T) {
 	t.Parallel()
 
+	ctx := context.Background()
+	signer := testAuditChainSigner(t)
 	db, _ := testDatabaseInstance.NewDatabase(t, nil)
 	for i := 0; i < 5; i++ {
-		if err := db.SaveAuditEntry(&AuditEntry{
-			RealmID:       1,
-			ActorID:       "actor:1",
-			ActorDisplay:  "Actor",
-			Action:        "created",
-			TargetID:      "target:1",
-			TargetDisplay: "Target",
-		}); err != nil {
-			t.Fatal(err)
+		for _, realmID := range []uint{1, 2} {
+			if err := db.SaveAuditEntry(&AuditEntry{
+				RealmID:       realmID,
+				ActorID:       "actor:1",
+				ActorDisplay:  "Actor",
+				Action:        "created",
+				TargetID:      "target:1",
+				TargetDisplay: "Target",
+			}); err != nil {
+				t.Fatal(err)
+			}
 		}
 	}
 
 	// Should not purge entries (too young).
 	{
-		n, err := db.PurgeAuditEntries(24 * time.Hour)
+		result, err := db.PurgeAuditEntries(ctx, 24*time.Hour, nil, signer, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := result.Count, int64(0); got != want {
+			t.Errorf("expected %d to purge, got %d", want, got)
+		}
+	}
+
+	// Purges entries only in the realm with a shorter override.
+	{
+		result, err := db.PurgeAuditEntries(ctx, 24*time.Hour, RetentionOverrides{2: 1 * time.Nanosecond}, signer, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := result.Count, int64(5); got != want {
+			t.Errorf("expected %d to purge, got %d", want, got)
+		}
+	}
+
+	// Purges remaining entries, except in the realm with a longer override.
+	{
+		result, err := db.PurgeAuditEntries(ctx, 1*time.Nanosecond, RetentionOverrides{1: 24 * time.Hour}, signer, nil)
 		if err != nil {
 			t.Fatal(err)
 		}
-		if got, want := n, int64(0); got != want {
+		if got, want := result.Count, int64(0); got != want {
 			t.Errorf("expected %d to purge, got %d", want, got)
 		}
 	}
 
 	// Purges entries.
 	{
-		n, err := db.PurgeAuditEntries(1 * time.Nanosecond)
+		result, err := db.PurgeAuditEntries(ctx, 1*time.Nanosecond, nil, signer, nil)
 		if err != nil {
 			t.Fatal(err)
 		}
-		if got, want := n, int64(5); got != want {
+		if got, want := result.Count, int64(5); got != want {
 			t.Errorf("expected %d to purge, got %d", want, got)
 		}
 	}
@@ -0,0 +1,274 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+const (
+	// AuditExportFormatCSV exports audit entries as CSV with a header row.
+	AuditExportFormatCSV AuditExportFormat = "csv"
+
+	// AuditExportFormatNDJSON exports audit entries as newline-delimited JSON,
+	// one entry per line.
+	AuditExportFormatNDJSON AuditExportFormat = "ndjson"
+
+	// auditExportBatchSize is the number of audit entries read from the
+	// database at a time while exporting.
+	auditExportBatchSize = 1000
+)
+
+// AuditExportFormat is a file format for exported audit entries.
+type AuditExportFormat string
+
+// ContentType returns the HTTP content type of the format.
+func (f AuditExportFormat) ContentType() string {
+	switch f {
+	case AuditExportFormatCSV:
+		return "text/csv"
+	case AuditExportFormatNDJSON:
+		return "application/x-ndjson"
+	default:
+		return "application/octet-stream"
+	}
+}
+
+// AuditFilter restricts the audit entries which are listed or exported. Zero
+// fields do not restrict the entries.
+type AuditFilter struct {
+	// ActorID, Action, and TargetID match exactly.
+	ActorID  string
+	Action   string
+	TargetID string
+
+	// Search matches any part of the actor display, action, or target display,
+	// case-insensitive.
+	Search string
+
+	// From and To are the inclusive bounds of the entries' creation time.
+	From time.Time
+	To   time.Time
+}
+
+// Scopes returns the scopes which apply the filter.
+func (f *AuditFilter) Scopes() []Scope {
+	if f == nil {
+		return nil
+	}
+
+	var scopes []Scope
+	if f.ActorID != "" {
+		scopes = append(scopes, WithAuditActorID(f.ActorID))
+	}
+	if f.Action != "" {
+		scopes = append(scopes, WithAuditAction(f.Action))
+	}
+	if f.TargetID != "" {
+		scopes = append(scopes, WithAuditTargetID(f.TargetID))
+	}
+	if f.Search != "" {
+		scopes = append(scopes, WithAuditSearch(f.Search))
+	}
+	if !f.From.IsZero() || !f.To.IsZero() {
+		scopes = append(scopes, WithAuditCreatedBetween(f.From, f.To))
+	}
+	return scopes
+}
+
+// ListAuditActions returns the distinct actions of the audit entries which
+// match the scopes, sorted alphabetically.
+func (db *Database) ListAuditActions(scopes ...Scope) ([]string, error) {
+	var actions []string
+	if err := db.db.
+		Model(&AuditEntry{}).
+		Scopes(scopes...).
+		Order("action").
+		Pluck("DISTINCT action", &actions).
+		Error; err != nil {
+		if IsNotFound(err) {
+			return actions, nil
+		}
+		return nil, err
+	}
+	return actions, nil
+}
+
+// ExportAudits writes every audit entry which matches the scopes to w in the
+// given format, newest first. Entries are read in batches, so exports of any
+// size use constant memory. If an error is returned, w may contain a partial
+// export.
+func (db *Database) ExportAudits(w io.Writer, format AuditExportFormat, scopes ...Scope) error {
+	aw, err := newAuditWriter(w, format)
+	if err != nil {
+		return err
+	}
+
+	var lastID uint
+	for {
+		var entries []*AuditEntry
+		if err := db.db.
+			Model(&AuditEntry{}).
+			Scopes(scopes...).
+			Scopes(func(tx *gorm.DB) *gorm.DB {
+				if lastID > 0 {
+					return tx.Where("audit_entries.id < ?", lastID)
+				}
+				return tx
+			}).
+			Order("audit_entries.id DESC").
+			Limit(auditExportBatchSize).
+			Find(&entries).
+			Error; err != nil && !IsNotFound(err) {
+			return fmt.Errorf("failed to list audit entries: %w", err)
+		}
+
+		if err := aw.write(entries); err != nil {
+			return err
+		}
+
+		if len(entries) < auditExportBatchSize {
+			return nil
+		}
+		lastID = entries[len(entries)-1].ID
+	}
+}
+
+// auditWriter writes audit entries in an export format.
+type auditWriter struct {
+	csv  *csv.Writer
+	json *json.Encoder
+}
+
+// newAuditWriter creates a writer for the format. CSV exports start with a
+// header row.
+func newAuditWriter(w io.Writer, format AuditExportFormat) (*auditWriter, error) {
+	switch format {
+	case AuditExportFormatCSV:
+		cw := csv.NewWriter(w)
+		if err := cw.Write(auditCSVHeader); err != nil {
+			return nil, fmt.Errorf("failed to write CSV header: %w", err)
+		}
+		return &auditWriter{csv: cw}, nil
+	case AuditExportFormatNDJSON:
+		return &auditWriter{json: json.NewEncoder(w)}, nil
+	default:
+		return nil, fmt.Errorf("unknown audit export format %q", format)
+	}
+}
+
+// write writes and flushes the entries.
+func (w *auditWriter) write(entries []*AuditEntry) error {
+	for _, e := range entries {
+		var err error
+		if w.csv != nil {
+			err = w.csv.Write(e.csvRecord())
+		} else {
+			err = w.json.Encode(e.Record())
+		}
+		if err != nil {
+			return fmt.Errorf("failed to write audit entry %d: %w", e.ID, err)
+		}
+	}
+
+	if w.csv != nil {
+		w.csv.Flush()
+		if err := w.csv.Error(); err != nil {
+			return fmt.Errorf("failed to write audit entries: %w", err)
+		}
+	}
+	return nil
+}
+
+// auditCSVHeader is the header row of CSV audit exports.
+var auditCSVHeader = []string{
+	"id", "created_at", "realm_id", "actor_id", "actor_display",
+	"action", "target_id", "target_display", "diff", "chain_sequence", "hash",
+	"changes",
+}
+
+// csvRecord returns the entry as a CSV row matching auditCSVHeader.
+func (a *AuditEntry) csvRecord() []string {
+	return []string{
+		strconv.FormatUint(uint64(a.ID), 10),
+		a.CreatedAt.UTC().Format(time.RFC3339),
+		strconv.FormatUint(uint64(a.RealmID), 10),
+		a.ActorID,
+		a.ActorDisplay,
+		a.Action,
+		a.TargetID,
+		a.TargetDisplay,
+		a.Diff,
+		strconv.FormatInt(a.ChainSequence, 10),
+		hex.EncodeToString(a.Hash),
+		a.changesJSON(),
+	}
+}
+
+// changesJSON returns the entry's structured changes as JSON, or the empty
+// string if there are none.
+func (a *AuditEntry) changesJSON() string {
+	if len(a.Changes) == 0 {
+		return ""
+	}
+	b, err := json.Marshal(a.Changes)
+	if err != nil {
+		return ""
+	}
+	return string(b)
+}
+
+// AuditRecord is the JSON representation of an audit entry which is exported
+// and delivered to external audit sinks.
+type AuditRecord struct {
+	ID            uint         `json:"id"`
+	CreatedAt     time.Time    `json:"created_at"`
+	RealmID       uint         `json:"realm_id"`
+	ActorID       string       `json:"actor_id"`
+	ActorDisplay  string       `json:"actor_display"`
+	Action        string       `json:"action"`
+	TargetID      string       `json:"target_id"`
+	TargetDisplay string       `json:"target_display"`
+	Diff          string       `json:"diff,omitempty"`
+	Changes       AuditChanges `json:"changes,omitempty"`
+	ChainSequence int64        `json:"chain_sequence,omitempty"`
+	Hash          string       `json:"hash,omitempty"`
+}
+
+// Record returns the entry's exported JSON representation.
+func (a *AuditEntry) Record() *AuditRecord {
+	return &AuditRecord{
+		ID:            a.ID,
+		CreatedAt:     a.CreatedAt.UTC(),
+		RealmID:       a.RealmID,
+		ActorID:       a.ActorID,
+		ActorDisplay:  a.ActorDisplay,
+		Action:        a.Action,
+		TargetID:      a.TargetID,
+		TargetDisplay: a.TargetDisplay,
+		Diff:          a.Diff,
+		Changes:       a.Changes,
+		ChainSequence: a.ChainSequence,
+		Hash:          hex.EncodeToString(a.Hash),
+	}
+}
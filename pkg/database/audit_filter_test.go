@@ -0,0 +1,145 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestAuditWriter(t *testing.T) {
+	t.Parallel()
+
+	entries := []*AuditEntry{
+		{
+			ID:            2,
+			RealmID:       1,
+			ActorID:       "users:1",
+			ActorDisplay:  "Alex (alex@example.com)",
+			Action:        "updated realm",
+			TargetID:      "realms:1",
+			TargetDisplay: "Example, Inc",
+			Diff:          "-a\n+b\n",
+			Changes: AuditChanges{
+				{Field: "Name", Old: []byte(`"a"`), New: []byte(`"b"`)},
+			},
+			ChainSequence: 7,
+			Hash:          []byte{0xab, 0xcd},
+			CreatedAt:     time.Date(2020, 11, 2, 8, 30, 0, 0, time.UTC),
+		},
+	}
+
+	cases := []struct {
+		name   string
+		format AuditExportFormat
+		exp    string
+	}{
+		{
+			name:   "csv",
+			format: AuditExportFormatCSV,
+			exp: "id,created_at,realm_id,actor_id,actor_display,action,target_id,target_display,diff,chain_sequence,hash,changes\n" +
+				"2,2020-11-02T08:30:00Z,1,users:1,Alex (alex@example.com),updated realm,realms:1,\"Example, Inc\",\"-a\n+b\n\",7,abcd,\"[{\"\"field\"\":\"\"Name\"\",\"\"old\"\":\"\"a\"\",\"\"new\"\":\"\"b\"\"}]\"\n",
+		},
+		{
+			name:   "ndjson",
+			format: AuditExportFormatNDJSON,
+			exp: `{"id":2,"created_at":"2020-11-02T08:30:00Z","realm_id":1,"actor_id":"users:1",` +
+				`"actor_display":"Alex (alex@example.com)","action":"updated realm","target_id":"realms:1",` +
+				`"target_display":"Example, Inc","diff":"-a\n+b\n",` +
+				`"changes":[{"field":"Name","old":"a","new":"b"}],"chain_sequence":7,"hash":"abcd"}` + "\n",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			var b bytes.Buffer
+			w, err := newAuditWriter(&b, tc.format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := w.write(entries); err != nil {
+				t.Fatal(err)
+			}
+
+			if got, want := b.String(), tc.exp; got != want {
+				t.Errorf("expected\n%s\nto be\n%s", got, want)
+			}
+		})
+	}
+
+	t.Run("unknown", func(t *testing.T) {
+		t.Parallel()
+
+		if _, err := newAuditWriter(&bytes.Buffer{}, AuditExportFormat("xml")); err == nil {
+			t.Errorf("expected error")
+		}
+	})
+}
+
+func TestDatabase_ExportAudits(t *testing.T) {
+	t.Parallel()
+
+	db, _ := testDatabaseInstance.NewDatabase(t, nil)
+
+	for i := 0; i < 3; i++ {
+		entry := &AuditEntry{
+			RealmID:       1,
+			ActorID:       "users:1",
+			ActorDisplay:  "Alex",
+			Action:        "updated realm",
+			TargetID:      "realms:1",
+			TargetDisplay: "Example",
+		}
+		if i == 2 {
+			entry.ActorID = "users:2"
+			entry.ActorDisplay = "Sam"
+		}
+		if err := db.SaveAuditEntry(entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var b bytes.Buffer
+	if err := db.ExportAudits(&b, AuditExportFormatNDJSON, WithAuditRealmID(1), WithAuditSearch("ALEX")); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := bytes.Count(b.Bytes(), []byte("\n")), 2; got != want {
+		t.Errorf("expected %d entries to be %d: %s", got, want, b.String())
+	}
+
+	// Wildcards in the search term are matched literally.
+	for _, q := range []string{"%", "Al_x"} {
+		b.Reset()
+		if err := db.ExportAudits(&b, AuditExportFormatNDJSON, WithAuditRealmID(1), WithAuditSearch(q)); err != nil {
+			t.Fatal(err)
+		}
+		if got := b.Len(); got != 0 {
+			t.Errorf("expected no entries for %q: %s", q, b.String())
+		}
+	}
+
+	actions, err := db.ListAuditActions(WithAuditActorID("users:2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(actions), 1; got != want {
+		t.Errorf("expected %d actions to be %d", got, want)
+	}
+}
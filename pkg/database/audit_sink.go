@@ -0,0 +1,144 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// AuditSinkCursor is the sequence of the last audit entry in a realm's chain
+// which was delivered to an external audit sink.
+type AuditSinkCursor struct {
+	Sink      string `gorm:"primary_key; type:varchar(64)"`
+	RealmID   uint   `gorm:"primary_key; auto_increment:false"`
+	Sequence  int64  `gorm:"not null"`
+	UpdatedAt time.Time
+}
+
+// OnAuditEntryCreated registers f to be invoked after every audit entry is
+// created through this database, including audit entries created by the other
+// Save functions. The entry's transaction may not have committed when f is
+// invoked, so f should only signal other work and must not block.
+func (db *Database) OnAuditEntryCreated(f func()) {
+	db.auditHooksLock.Lock()
+	defer db.auditHooksLock.Unlock()
+	db.auditHooks = append(db.auditHooks, f)
+}
+
+// runAuditHooks invokes the registered audit entry hooks.
+func (db *Database) runAuditHooks() {
+	db.auditHooksLock.RLock()
+	defer db.auditHooksLock.RUnlock()
+	for _, f := range db.auditHooks {
+		f()
+	}
+}
+
+// DeliverAuditEntries passes the chained audit entries which have not yet been
+// delivered to the named sink to deliver, in chain order, at most batchSize at
+// a time. Progress is only recorded after deliver returns successfully, so
+// entries are delivered at least once. Each realm's progress is locked while
+// its entries are delivered, so concurrent callers do not deliver the same
+// entries; realms locked by another caller are skipped. It returns the number
+// of entries delivered.
+//
+// Entries created before audit chaining was introduced are not delivered.
+func (db *Database) DeliverAuditEntries(sink string, batchSize int, deliver func([]*AuditEntry) error) (int, error) {
+	if batchSize <= 0 {
+		return 0, fmt.Errorf("batch size must be positive")
+	}
+
+	realmIDs, err := db.ListAuditChainRealmIDs()
+	if err != nil {
+		return 0, err
+	}
+
+	var delivered int
+	for _, realmID := range realmIDs {
+		for {
+			n, err := db.deliverAuditBatch(sink, realmID, batchSize, deliver)
+			delivered += n
+			if err != nil {
+				return delivered, fmt.Errorf("failed to deliver audit entries for realm %d to %s: %w", realmID, sink, err)
+			}
+			if n < batchSize {
+				break
+			}
+		}
+	}
+	return delivered, nil
+}
+
+// deliverAuditBatch delivers the next batch of the realm's entries to the sink
+// and advances its cursor. It returns the number of entries delivered.
+func (db *Database) deliverAuditBatch(sink string, realmID uint, batchSize int, deliver func([]*AuditEntry) error) (int, error) {
+	var delivered int
+	err := db.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec(
+			`INSERT INTO audit_sink_cursors (sink, realm_id, sequence, updated_at) VALUES (?, ?, 0, NOW()) ON CONFLICT (sink, realm_id) DO NOTHING`,
+			sink, realmID).Error; err != nil {
+			return fmt.Errorf("failed to create cursor: %w", err)
+		}
+
+		var cursor AuditSinkCursor
+		if err := tx.
+			Set("gorm:query_option", "FOR UPDATE SKIP LOCKED").
+			Where("sink = ? AND realm_id = ?", sink, realmID).
+			First(&cursor).
+			Error; err != nil {
+			// Another caller is delivering this realm's entries.
+			if IsNotFound(err) {
+				return nil
+			}
+			return fmt.Errorf("failed to lock cursor: %w", err)
+		}
+
+		var entries []*AuditEntry
+		if err := tx.
+			Where("realm_id = ?", realmID).
+			Where("chain_sequence > ?", cursor.Sequence).
+			Order("chain_sequence ASC").
+			Limit(batchSize).
+			Find(&entries).
+			Error; err != nil && !IsNotFound(err) {
+			return fmt.Errorf("failed to list audit entries: %w", err)
+		}
+		if len(entries) == 0 {
+			return nil
+		}
+
+		if err := deliver(entries); err != nil {
+			return err
+		}
+
+		if err := tx.
+			Model(&AuditSinkCursor{}).
+			Where("sink = ? AND realm_id = ?", sink, realmID).
+			UpdateColumns(map[string]interface{}{
+				"sequence":   entries[len(entries)-1].ChainSequence,
+				"updated_at": time.Now().UTC(),
+			}).
+			Error; err != nil {
+			return fmt.Errorf("failed to update cursor: %w", err)
+		}
+
+		delivered = len(entries)
+		return nil
+	})
+	return delivered, err
+}
@@ -0,0 +1,105 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestDatabase_DeliverAuditEntries(t *testing.T) {
+	t.Parallel()
+
+	db, _ := testDatabaseInstance.NewDatabase(t, nil)
+
+	var hooks int
+	db.OnAuditEntryCreated(func() { hooks++ })
+
+	for i := 0; i < 5; i++ {
+		for _, realmID := range []uint{1, 2} {
+			if err := db.SaveAuditEntry(&AuditEntry{
+				RealmID:       realmID,
+				ActorID:       "actor:1",
+				ActorDisplay:  "Actor",
+				Action:        "created",
+				TargetID:      "target:1",
+				TargetDisplay: "Target",
+			}); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	if got, want := hooks, 10; got != want {
+		t.Errorf("expected %d hook calls, got %d", want, got)
+	}
+
+	// Failed deliveries are retried.
+	n, err := db.DeliverAuditEntries("test", 2, func(entries []*AuditEntry) error {
+		return fmt.Errorf("unavailable")
+	})
+	if err == nil {
+		t.Errorf("expected error")
+	}
+	if got, want := n, 0; got != want {
+		t.Errorf("expected %d delivered, got %d", want, got)
+	}
+
+	// Every entry is delivered in chain order, in batches.
+	delivered := make(map[uint][]int64)
+	n, err = db.DeliverAuditEntries("test", 2, func(entries []*AuditEntry) error {
+		if len(entries) > 2 {
+			t.Errorf("expected at most 2 entries, got %d", len(entries))
+		}
+		for _, e := range entries {
+			delivered[e.RealmID] = append(delivered[e.RealmID], e.ChainSequence)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := n, 10; got != want {
+		t.Errorf("expected %d delivered, got %d", want, got)
+	}
+	for _, realmID := range []uint{1, 2} {
+		if got, want := fmt.Sprint(delivered[realmID]), "[1 2 3 4 5]"; got != want {
+			t.Errorf("realm %d: expected %s, got %s", realmID, want, got)
+		}
+	}
+
+	// Nothing is delivered twice.
+	n, err = db.DeliverAuditEntries("test", 2, func(entries []*AuditEntry) error {
+		t.Errorf("expected no entries, got %d", len(entries))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := n, 0; got != want {
+		t.Errorf("expected %d delivered, got %d", want, got)
+	}
+
+	// Other sinks have their own progress.
+	n, err = db.DeliverAuditEntries("other", 100, func(entries []*AuditEntry) error {
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := n, 10; got != want {
+		t.Errorf("expected %d delivered, got %d", want, got)
+	}
+}
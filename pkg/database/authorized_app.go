@@ -15,6 +15,7 @@
 package database
 
 import (
+	"context"
 	"crypto/hmac"
 	"crypto/rand"
 	"crypto/sha512"
@@ -41,6 +42,7 @@ const (
 	APIKeyTypeDevice
 	APIKeyTypeAdmin
 	APIKeyTypeStats
+	APIKeyTypeAudit
 )
 
 func (a APIKeyType) Display() string {
@@ -51,6 +53,8 @@ func (a APIKeyType) Display() string {
 		return "admin"
 	case APIKeyTypeStats:
 		return "stats"
+	case APIKeyTypeAudit:
+		return "audit"
 	default:
 		return "invalid"
 	}
@@ -84,6 +88,10 @@ type AuthorizedApp struct {
 
 	// APIKeyType is the API key type.
 	APIKeyType APIKeyType `gorm:"column:api_key_type; type:integer; not null;"`
+
+	// DefaultSiteID is the site to which codes issued with this API key are
+	// attributed when the request does not name a site. Zero means none.
+	DefaultSiteID uint `gorm:"column:default_site_id; type:integer; not null; default:0;"`
 }
 
 // BeforeSave runs validations. If there are errors, the save fails.
@@ -94,10 +102,19 @@ func (a *AuthorizedApp) BeforeSave(tx *gorm.DB) error {
 		a.AddError("name", "cannot be blank")
 	}
 
-	if !(a.APIKeyType == APIKeyTypeDevice || a.APIKeyType == APIKeyTypeAdmin || a.APIKeyType == APIKeyTypeStats) {
+	if !(a.APIKeyType == APIKeyTypeDevice || a.APIKeyType == APIKeyTypeAdmin || a.APIKeyType == APIKeyTypeStats || a.APIKeyType == APIKeyTypeAudit) {
 		a.AddError("type", "is invalid")
 	}
 
+	if a.DefaultSiteID != 0 {
+		if err := validateSiteID(tx, a.RealmID, a.DefaultSiteID); err != nil {
+			if !IsValidationError(err) {
+				return err
+			}
+			a.AddError("defaultSiteID", "does not exist")
+		}
+	}
+
 	return a.ErrorOrNil()
 }
 
@@ -113,6 +130,10 @@ func (a *AuthorizedApp) IsStatsType() bool {
 	return a.APIKeyType == APIKeyTypeStats
 }
 
+func (a *AuthorizedApp) IsAuditType() bool {
+	return a.APIKeyType == APIKeyTypeAudit
+}
+
 // Realm returns the associated realm for this app. If you only need the ID,
 // call .RealmID instead of a full database lookup.
 func (a *AuthorizedApp) Realm(db *Database) (*Realm, error) {
@@ -261,12 +282,21 @@ func (db *Database) SaveAuthorizedApp(a *AuthorizedApp, actor Auditable) error {
 			if existing.Name != a.Name {
 				audit := BuildAuditEntry(actor, "updated API key name", a, a.RealmID)
 				audit.Diff = stringDiff(existing.Name, a.Name)
+				audit.AddChange("Name", existing.Name, a.Name)
+				audits = append(audits, audit)
+			}
+
+			if existing.DefaultSiteID != a.DefaultSiteID {
+				audit := BuildAuditEntry(actor, "updated API key default site", a, a.RealmID)
+				audit.Diff = uintDiff(existing.DefaultSiteID, a.DefaultSiteID)
+				audit.AddChange("DefaultSiteID", existing.DefaultSiteID, a.DefaultSiteID)
 				audits = append(audits, audit)
 			}
 
 			if existing.DeletedAt != a.DeletedAt {
 				audit := BuildAuditEntry(actor, "updated API key enabled", a, a.RealmID)
 				audit.Diff = boolDiff(existing.DeletedAt == nil, a.DeletedAt == nil)
+				audit.AddChange("DeletedAt", existing.DeletedAt, a.DeletedAt)
 				audits = append(audits, audit)
 			}
 		}
@@ -439,15 +469,15 @@ func (a *AuthorizedApp) AuditDisplay() string {
 
 // PurgeAuthorizedApps will delete authorized apps that have been deleted for
 // more than the specified time.
-func (db *Database) PurgeAuthorizedApps(maxAge time.Duration) (int64, error) {
-	if maxAge > 0 {
-		maxAge = -1 * maxAge
-	}
-	deleteBefore := time.Now().UTC().Add(maxAge)
-
-	result := db.db.
-		Unscoped().
-		Where("deleted_at IS NOT NULL AND deleted_at < ?", deleteBefore).
-		Delete(&AuthorizedApp{})
-	return result.RowsAffected, result.Error
+func (db *Database) PurgeAuthorizedApps(ctx context.Context, maxAge time.Duration, opts *PurgeOptions) (*PurgeResult, error) {
+	deleteBefore := time.Now().UTC().Add(-absDuration(maxAge))
+
+	result := &PurgeResult{Table: "authorized_apps"}
+	err := db.purge(ctx, &purgeQuery{
+		table:       "authorized_apps",
+		realmColumn: "realm_id",
+		where:       "deleted_at IS NOT NULL AND deleted_at < ?",
+		args:        []interface{}{deleteBefore},
+	}, opts, result)
+	return result, err
 }
@@ -15,6 +15,7 @@
 package database
 
 import (
+	"context"
 	"encoding/base64"
 	"fmt"
 	"strings"
@@ -284,6 +285,7 @@ func TestDatabase_GenerateVerifyAPIKeySignature(t *testing.T) {
 func TestDatabase_PurgeAuthorizedApps(t *testing.T) {
 	t.Parallel()
 
+	ctx := context.Background()
 	db, _ := testDatabaseInstance.NewDatabase(t, nil)
 
 	now := time.Now().UTC()
@@ -302,22 +304,22 @@ func TestDatabase_PurgeAuthorizedApps(t *testing.T) {
 
 	// Should not purge entries (too young).
 	{
-		n, err := db.PurgeAuthorizedApps(24 * time.Hour)
+		result, err := db.PurgeAuthorizedApps(ctx, 24*time.Hour, nil)
 		if err != nil {
 			t.Fatal(err)
 		}
-		if got, want := n, int64(0); got != want {
+		if got, want := result.Count, int64(0); got != want {
 			t.Errorf("expected %d to purge, got %d", want, got)
 		}
 	}
 
 	// Purges entries.
 	{
-		n, err := db.PurgeAuthorizedApps(1 * time.Nanosecond)
+		result, err := db.PurgeAuthorizedApps(ctx, 1*time.Nanosecond, nil)
 		if err != nil {
 			t.Fatal(err)
 		}
-		if got, want := n, int64(5); got != want {
+		if got, want := result.Count, int64(5); got != want {
 			t.Errorf("expected %d to purge, got %d", want, got)
 		}
 	}
@@ -0,0 +1,272 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/exposure-notifications-verification-server/pkg/merkle"
+	"github.com/jinzhu/gorm"
+)
+
+// CertificateLogEntry is an entry in the append-only transparency log of
+// issued verification certificates. Entries are recorded when the certificate
+// is issued and assigned a position in the Merkle tree later by
+// SequenceCertificateLog.
+type CertificateLogEntry struct {
+	ID uint64 `gorm:"primary_key"`
+
+	RealmID uint `gorm:"not null"`
+
+	// KeyID is the 'kid' header of the certificate.
+	KeyID string `gorm:"column:kid; type:varchar(64); not null"`
+
+	// ExposureKeyHMAC is the HMAC of the exposure keys that was signed into the
+	// certificate, as provided by the client.
+	ExposureKeyHMAC string `gorm:"column:hmac; type:text; not null"`
+
+	// IssuedAt is the 'iat' claim of the certificate.
+	IssuedAt time.Time `gorm:"not null"`
+
+	// LeafIndex is the position of the entry in the Merkle tree. It is nil until
+	// the entry is sequenced.
+	LeafIndex *int64
+
+	CreatedAt time.Time
+}
+
+// certificateLogLeaf is the data which is hashed into the Merkle tree for each
+// entry. Auditors reproduce leaf hashes by hashing this JSON encoding.
+type certificateLogLeaf struct {
+	RealmID         uint   `json:"realmID"`
+	KeyID           string `json:"kid"`
+	ExposureKeyHMAC string `json:"hmac"`
+	IssuedAt        int64  `json:"iat"`
+}
+
+// LeafData returns the canonical leaf data for the entry.
+func (e *CertificateLogEntry) LeafData() ([]byte, error) {
+	return json.Marshal(&certificateLogLeaf{
+		RealmID:         e.RealmID,
+		KeyID:           e.KeyID,
+		ExposureKeyHMAC: e.ExposureKeyHMAC,
+		IssuedAt:        e.IssuedAt.Unix(),
+	})
+}
+
+// LeafHash returns the Merkle leaf hash for the entry.
+func (e *CertificateLogEntry) LeafHash() ([]byte, error) {
+	data, err := e.LeafData()
+	if err != nil {
+		return nil, err
+	}
+	return merkle.LeafHash(data), nil
+}
+
+// CertificateLogNode is the hash of a perfect subtree of the certificate
+// transparency log.
+type CertificateLogNode struct {
+	Level     uint   `gorm:"primary_key; auto_increment:false"`
+	NodeIndex int64  `gorm:"primary_key; auto_increment:false"`
+	Hash      []byte `gorm:"not null"`
+}
+
+// CertificateLogTreeHead is a signed commitment to the state of the
+// certificate transparency log at a given size.
+type CertificateLogTreeHead struct {
+	ID        uint64 `gorm:"primary_key"`
+	TreeSize  int64  `gorm:"not null"`
+	RootHash  []byte `gorm:"not null"`
+	Timestamp time.Time
+
+	// KeyID is the 'kid' header of the signature, Algorithm is the signing
+	// algorithm, and PublicKey is the PEM-encoded key which verifies it.
+	KeyID     string `gorm:"column:kid; type:varchar(64)"`
+	Algorithm string `gorm:"type:varchar(16)"`
+	PublicKey string `gorm:"type:text"`
+
+	// Signature is a compact JWS over the tree size, root hash, and timestamp.
+	Signature string `gorm:"type:text"`
+
+	CreatedAt time.Time
+}
+
+// certificateLogNodeReader reads Merkle tree nodes from the database. Nodes in
+// pending are returned before reading the database, which allows computing
+// nodes for multiple appended leaves in a single transaction.
+type certificateLogNodeReader struct {
+	db      *gorm.DB
+	pending map[[2]int64][]byte
+}
+
+func (r *certificateLogNodeReader) Node(level uint, index uint64) ([]byte, error) {
+	if h, ok := r.pending[[2]int64{int64(level), int64(index)}]; ok {
+		return h, nil
+	}
+
+	var node CertificateLogNode
+	if err := r.db.
+		Where("level = ?", level).
+		Where("node_index = ?", index).
+		First(&node).
+		Error; err != nil {
+		return nil, fmt.Errorf("failed to read node %d/%d: %w", level, index, err)
+	}
+	return node.Hash, nil
+}
+
+// certificateLogSize returns the number of sequenced entries in the log.
+func certificateLogSize(tx *gorm.DB) (int64, error) {
+	var result struct {
+		Size int64
+	}
+	if err := tx.
+		Model(&CertificateLogEntry{}).
+		Select("COALESCE(MAX(leaf_index) + 1, 0) AS size").
+		Scan(&result).
+		Error; err != nil {
+		return 0, err
+	}
+	return result.Size, nil
+}
+
+// SequenceCertificateLog assigns leaf indexes to up to batchSize unsequenced
+// log entries, in the order they were recorded, and stores the resulting
+// Merkle tree nodes. It returns the new size of the tree.
+func (db *Database) SequenceCertificateLog(batchSize uint) (int64, error) {
+	var size int64
+	err := db.db.Transaction(func(tx *gorm.DB) error {
+		// Prevent concurrent sequencers from assigning the same leaf index.
+		if err := tx.Exec(`LOCK TABLE certificate_log_nodes IN EXCLUSIVE MODE`).Error; err != nil {
+			return fmt.Errorf("failed to lock tree: %w", err)
+		}
+
+		var err error
+		size, err = certificateLogSize(tx)
+		if err != nil {
+			return fmt.Errorf("failed to get tree size: %w", err)
+		}
+
+		var entries []*CertificateLogEntry
+		if err := tx.
+			Where("leaf_index IS NULL").
+			Order("id ASC").
+			Limit(batchSize).
+			Find(&entries).
+			Error; err != nil {
+			return fmt.Errorf("failed to find unsequenced entries: %w", err)
+		}
+
+		reader := &certificateLogNodeReader{db: tx, pending: make(map[[2]int64][]byte)}
+		for _, entry := range entries {
+			leafHash, err := entry.LeafHash()
+			if err != nil {
+				return fmt.Errorf("failed to hash entry %d: %w", entry.ID, err)
+			}
+
+			nodes, err := merkle.AppendNodes(reader, uint64(size), leafHash)
+			if err != nil {
+				return fmt.Errorf("failed to append entry %d: %w", entry.ID, err)
+			}
+
+			for _, n := range nodes {
+				node := &CertificateLogNode{Level: n.Level, NodeIndex: int64(n.Index), Hash: n.Hash}
+				if err := tx.Create(node).Error; err != nil {
+					return fmt.Errorf("failed to save node %d/%d: %w", n.Level, n.Index, err)
+				}
+				reader.pending[[2]int64{int64(n.Level), int64(n.Index)}] = n.Hash
+			}
+
+			if err := tx.
+				Model(entry).
+				UpdateColumn("leaf_index", size).
+				Error; err != nil {
+				return fmt.Errorf("failed to sequence entry %d: %w", entry.ID, err)
+			}
+			size++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return size, nil
+}
+
+// CertificateLogSize returns the number of sequenced entries in the log.
+func (db *Database) CertificateLogSize() (int64, error) {
+	return certificateLogSize(db.db)
+}
+
+// CertificateLogRootHash returns the Merkle root hash of the log at the given
+// size.
+func (db *Database) CertificateLogRootHash(size int64) ([]byte, error) {
+	return merkle.RootHash(&certificateLogNodeReader{db: db.db}, uint64(size))
+}
+
+// CertificateLogInclusionProof returns the Merkle audit path for the entry at
+// index in the log of the given size.
+func (db *Database) CertificateLogInclusionProof(index, size int64) ([][]byte, error) {
+	return merkle.InclusionProof(&certificateLogNodeReader{db: db.db}, uint64(index), uint64(size))
+}
+
+// SaveCertificateLogTreeHead saves a signed tree head.
+func (db *Database) SaveCertificateLogTreeHead(sth *CertificateLogTreeHead) error {
+	return db.db.Save(sth).Error
+}
+
+// LatestCertificateLogTreeHead returns the most recent signed tree head.
+func (db *Database) LatestCertificateLogTreeHead() (*CertificateLogTreeHead, error) {
+	var sth CertificateLogTreeHead
+	if err := db.db.
+		Order("tree_size DESC, id DESC").
+		First(&sth).
+		Error; err != nil {
+		return nil, err
+	}
+	return &sth, nil
+}
+
+// FindCertificateLogEntry finds the most recent log entry in the realm for a
+// certificate with the given exposure key HMAC.
+func (db *Database) FindCertificateLogEntry(realmID uint, hmac string) (*CertificateLogEntry, error) {
+	var entry CertificateLogEntry
+	if err := db.db.
+		Where("realm_id = ?", realmID).
+		Where("hmac = ?", hmac).
+		Order("id DESC").
+		First(&entry).
+		Error; err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+// ListCertificateLogEntries returns up to limit sequenced entries starting at
+// the given leaf index, in leaf order.
+func (db *Database) ListCertificateLogEntries(start int64, limit uint) ([]*CertificateLogEntry, error) {
+	var entries []*CertificateLogEntry
+	if err := db.db.
+		Where("leaf_index >= ?", start).
+		Order("leaf_index ASC").
+		Limit(limit).
+		Find(&entries).
+		Error; err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
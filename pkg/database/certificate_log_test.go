@@ -0,0 +1,135 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/exposure-notifications-verification-server/pkg/merkle"
+)
+
+func TestCertificateLogEntry_LeafData(t *testing.T) {
+	t.Parallel()
+
+	entry := &CertificateLogEntry{
+		RealmID:         7,
+		KeyID:           "r7v3",
+		ExposureKeyHMAC: "aGVsbG8=",
+		IssuedAt:        time.Unix(1606780800, 0),
+	}
+
+	data, err := entry.LeafData()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(data), `{"realmID":7,"kid":"r7v3","hmac":"aGVsbG8=","iat":1606780800}`; got != want {
+		t.Errorf("expected %s to be %s", got, want)
+	}
+}
+
+func TestDatabase_SequenceCertificateLog(t *testing.T) {
+	t.Parallel()
+
+	db, _ := testDatabaseInstance.NewDatabase(t, nil)
+
+	var leaves [][]byte
+	record := func(n int) {
+		for i := 0; i < n; i++ {
+			entry := &CertificateLogEntry{
+				RealmID:         1,
+				KeyID:           "v1",
+				ExposureKeyHMAC: fmt.Sprintf("hmac-%d", len(leaves)),
+				IssuedAt:        time.Now().UTC(),
+			}
+			if err := db.db.Create(entry).Error; err != nil {
+				t.Fatal(err)
+			}
+			hash, err := entry.LeafHash()
+			if err != nil {
+				t.Fatal(err)
+			}
+			leaves = append(leaves, hash)
+		}
+	}
+
+	// Sequence in multiple batches to exercise reading nodes from the database.
+	record(5)
+	size, err := db.SequenceCertificateLog(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := size, int64(3); got != want {
+		t.Fatalf("expected %d to be %d", got, want)
+	}
+
+	record(6)
+	size, err = db.SequenceCertificateLog(100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := size, int64(11); got != want {
+		t.Fatalf("expected %d to be %d", got, want)
+	}
+
+	root, err := db.CertificateLogRootHash(size)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, leaf := range leaves {
+		proof, err := db.CertificateLogInclusionProof(int64(i), size)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := merkle.VerifyInclusion(leaf, uint64(i), uint64(size), proof, root); err != nil {
+			t.Errorf("leaf %d: %v", i, err)
+		}
+	}
+
+	entry, err := db.FindCertificateLogEntry(1, "hmac-4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry.LeafIndex == nil || *entry.LeafIndex != 4 {
+		t.Errorf("expected leaf index 4, got %v", entry.LeafIndex)
+	}
+
+	entries, err := db.ListCertificateLogEntries(9, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(entries), 2; got != want {
+		t.Errorf("expected %d to be %d", got, want)
+	}
+
+	// An empty run does not change the tree.
+	size, err = db.SequenceCertificateLog(100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := size, int64(11); got != want {
+		t.Errorf("expected %d to be %d", got, want)
+	}
+	again, err := db.CertificateLogRootHash(size)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(root, again) {
+		t.Errorf("expected root to be unchanged")
+	}
+}
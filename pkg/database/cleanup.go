@@ -15,7 +15,11 @@
 package database
 
 import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"time"
 
 	"github.com/jinzhu/gorm"
@@ -32,6 +36,60 @@ type CleanupStatus struct {
 	Type       string `gorm:"type:varchar(50);unique_index"`
 	Generation uint
 	NotBefore  time.Time
+
+	// RunStartedAt and RunCompletedAt are the times the most recent run started
+	// and finished. RunCompletedAt is nil while a run is in progress.
+	RunStartedAt   *time.Time
+	RunCompletedAt *time.Time
+
+	// Progress is the progress of each step of the most recent run.
+	Progress CleanupProgress `gorm:"type:jsonb"`
+}
+
+var _ sql.Scanner = (*CleanupProgress)(nil)
+var _ driver.Valuer = (CleanupProgress)(nil)
+
+// CleanupProgress is the progress of each step of a cleanup run, keyed by step
+// name. It is stored as JSON.
+type CleanupProgress map[string]*CleanupStepStatus
+
+// CleanupStepStatus is the progress of a single step of a cleanup run.
+type CleanupStepStatus struct {
+	Table       string         `json:"table"`
+	DryRun      bool           `json:"dryRun,omitempty"`
+	Count       int64          `json:"count"`
+	Batches     uint           `json:"batches"`
+	Realms      map[uint]int64 `json:"realms,omitempty"`
+	StartedAt   time.Time      `json:"startedAt"`
+	CompletedAt *time.Time     `json:"completedAt,omitempty"`
+	Error       string         `json:"error,omitempty"`
+}
+
+// Scan reads the JSON progress from the database.
+func (p *CleanupProgress) Scan(src interface{}) error {
+	*p = nil
+	switch t := src.(type) {
+	case nil:
+		return nil
+	case []byte:
+		return json.Unmarshal(t, p)
+	case string:
+		return json.Unmarshal([]byte(t), p)
+	default:
+		return fmt.Errorf("invalid scan type %T", src)
+	}
+}
+
+// Value converts the progress to JSON for saving to the database.
+func (p CleanupProgress) Value() (driver.Value, error) {
+	if p == nil {
+		return nil, nil
+	}
+	b, err := json.Marshal(p)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
 }
 
 // CreateCleanup is used to create a new 'cleanup' type/row in the database.
@@ -86,3 +144,43 @@ func (db *Database) ClaimCleanup(current *CleanupStatus, lockTime time.Duration)
 	}
 	return &cstat, nil
 }
+
+// StartCleanupRun records the start of a run of the given cleanup type,
+// clearing the progress of the previous run.
+func (db *Database) StartCleanupRun(cType string) error {
+	now := time.Now().UTC()
+	return db.db.
+		Model(&CleanupStatus{}).
+		Where("type = ?", cType).
+		UpdateColumns(map[string]interface{}{
+			"run_started_at":   now,
+			"run_completed_at": nil,
+			"progress":         CleanupProgress{},
+		}).
+		Error
+}
+
+// SaveCleanupProgress records the progress of a single step of the current
+// run of the given cleanup type. Only the given step is modified, so steps may
+// be saved independently.
+func (db *Database) SaveCleanupProgress(cType, step string, status *CleanupStepStatus) error {
+	b, err := json.Marshal(status)
+	if err != nil {
+		return fmt.Errorf("failed to marshal progress: %w", err)
+	}
+
+	sql := `UPDATE cleanup_statuses
+		SET progress = jsonb_set(COALESCE(progress, '{}'::jsonb), ARRAY[$1::text], $2::jsonb)
+		WHERE type = $3`
+	return db.db.Exec(sql, step, string(b), cType).Error
+}
+
+// CompleteCleanupRun records the end of the current run of the given cleanup
+// type.
+func (db *Database) CompleteCleanupRun(cType string) error {
+	return db.db.
+		Model(&CleanupStatus{}).
+		Where("type = ?", cType).
+		UpdateColumn("run_completed_at", time.Now().UTC()).
+		Error
+}
@@ -118,3 +118,57 @@ func TestDatabase_ClaimCleanup(t *testing.T) {
 		}
 	})
 }
+
+func TestDatabase_CleanupProgress(t *testing.T) {
+	t.Parallel()
+
+	db, _ := testDatabaseInstance.NewDatabase(t, nil)
+
+	if _, err := db.CreateCleanup("progress"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.StartCleanupRun("progress"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, step := range []string{"A", "B"} {
+		if err := db.SaveCleanupProgress("progress", step, &CleanupStepStatus{
+			Table:     "things",
+			Count:     5,
+			Batches:   1,
+			StartedAt: time.Now().UTC(),
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cleanup, err := db.FindCleanupStatus("progress")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cleanup.RunStartedAt == nil {
+		t.Errorf("expected run to be started")
+	}
+	if cleanup.RunCompletedAt != nil {
+		t.Errorf("expected run to be in progress, completed at %v", cleanup.RunCompletedAt)
+	}
+	if got, want := len(cleanup.Progress), 2; got != want {
+		t.Fatalf("expected %d steps, got %d", want, got)
+	}
+	if got, want := cleanup.Progress["B"].Count, int64(5); got != want {
+		t.Errorf("expected count %d to be %d", got, want)
+	}
+
+	if err := db.CompleteCleanupRun("progress"); err != nil {
+		t.Fatal(err)
+	}
+
+	cleanup, err = db.FindCleanupStatus("progress")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cleanup.RunCompletedAt == nil {
+		t.Errorf("expected run to be completed")
+	}
+}
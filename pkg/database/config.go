@@ -55,6 +55,10 @@ type Config struct {
 	// created on.
 	CertificateSigningKeyRing string `env:"CERTIFICATE_SIGNING_KEYRING"`
 
+	// The KMS managed KeyRing that verification token signing keys are created
+	// on.
+	TokenSigningKeyRing string `env:"TOKEN_SIGNING_KEYRING"`
+
 	// MaxCertificateSigningKeyVersions is the maximum number of certificate
 	// signing key versions per realm. This is enforced at the database layer, not
 	// the upstream KMS.
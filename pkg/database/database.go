@@ -21,6 +21,7 @@ import (
 	"encoding/base64"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
 	"os"
@@ -28,6 +29,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/exposure-notifications-server/pkg/base64util"
@@ -36,6 +38,7 @@ import (
 	enobservability "github.com/google/exposure-notifications-server/pkg/observability"
 	"github.com/google/exposure-notifications-server/pkg/secrets"
 	"github.com/google/exposure-notifications-verification-server/pkg/cache"
+	"github.com/google/exposure-notifications-verification-server/pkg/keyutils"
 	"github.com/google/exposure-notifications-verification-server/pkg/observability"
 	"github.com/jinzhu/gorm"
 	"github.com/sethvargo/go-retry"
@@ -68,12 +71,23 @@ type Database struct {
 	// per-realm signing keys. This could be nil.
 	signingKeyManager keys.SigningKeyManager
 
+	// signingKeyCreator is an optional interface that's implemented to support
+	// signing algorithms other than ES256. This could be nil.
+	signingKeyCreator keyutils.SigningKeyCreator
+
 	// logger is the internal logger.
 	logger *zap.SugaredLogger
 
 	// secretManager is used to resolve secrets.
 	secretManager secrets.SecretManager
 
+	// auditHooks are invoked after an audit entry is created.
+	auditHooks     []func()
+	auditHooksLock sync.RWMutex
+
+	// realmLocations caches realm timezones for bucketing statistics.
+	realmLocations *realmLocationCache
+
 	statsCloser func()
 }
 
@@ -114,7 +128,7 @@ func (c *Config) Load(ctx context.Context) (*Database, error) {
 	}
 
 	// Create the key manager.
-	keyManager, err := keys.KeyManagerFor(ctx, &c.Keys)
+	keyManager, err := keyutils.KeyManagerFor(ctx, &c.Keys)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create key manager: %w", err)
 	}
@@ -126,12 +140,28 @@ func (c *Config) Load(ctx context.Context) (*Database, error) {
 		logger.Errorf("key manager does not support the SigningKeyManager interface, falling back to single verification signing key")
 	}
 
+	// The upstream key managers only create ES256 keys. Use the key manager if
+	// it knows how to create other key types, or create a Cloud KMS specific
+	// creator.
+	var signingKeyCreator keyutils.SigningKeyCreator
+	if v, ok := keyManager.(keyutils.SigningKeyCreator); ok {
+		signingKeyCreator = v
+	} else if c.Keys.KeyManagerType == keys.KeyManagerTypeGoogleCloudKMS {
+		creator, err := keyutils.NewGoogleCloudKMSSigningKeyCreator(ctx, c.Keys.CreateHSMKeys)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create signing key creator: %w", err)
+		}
+		signingKeyCreator = creator
+	}
+
 	return &Database{
 		config:            c,
 		keyManager:        keyManager,
 		signingKeyManager: signingKeyManager,
+		signingKeyCreator: signingKeyCreator,
 		logger:            logger,
 		secretManager:     secretManager,
+		realmLocations:    &realmLocationCache{},
 	}, nil
 }
 
@@ -229,6 +259,9 @@ func (db *Database) OpenWithCacher(ctx context.Context, cacher cache.Cacher) err
 	// Metrics
 	rawDB.Callback().Create().After("gorm:create").Register("audit_entries:metrics", callbackIncrementMetric(ctx, mAuditEntryCreated, "audit_entries"))
 
+	// Audit sinks
+	rawDB.Callback().Create().After("gorm:create").Register("audit_entries:hooks", callbackRunHooks(db.runAuditHooks, "audit_entries"))
+
 	// Cache clearing
 	if cacher != nil {
 		// Apps
@@ -255,6 +288,16 @@ func (db *Database) OpenWithCacher(ctx context.Context, cacher cache.Cacher) err
 // Close will close the database connection. Should be deferred right after Open.
 func (db *Database) Close() error {
 	db.statsCloser()
+	if c, ok := db.keyManager.(io.Closer); ok {
+		if err := c.Close(); err != nil {
+			db.logger.Errorw("failed to close key manager", "error", err)
+		}
+	}
+	if c, ok := db.signingKeyCreator.(*keyutils.GoogleCloudKMSSigningKeyCreator); ok {
+		if err := c.Close(); err != nil {
+			db.logger.Errorw("failed to close signing key creator", "error", err)
+		}
+	}
 	return db.db.Close()
 }
 
@@ -279,6 +322,39 @@ func (db *Database) SetRawDB(tx *gorm.DB) {
 	db.db = tx
 }
 
+// auditHooksPendingKey is the gorm setting which defers the audit entry hooks
+// until the transaction started by Transaction commits. Its value is an *int32
+// which counts the audit entries created in the transaction.
+const auditHooksPendingKey = "database:audit_hooks_pending"
+
+// Transaction runs fn with a copy of the database whose queries all run in a
+// single transaction, so changes made through several Save functions are
+// committed together. If fn returns an error, every change is rolled back. The
+// audit entry hooks run once the transaction commits. The copy must not be
+// used after fn returns.
+func (db *Database) Transaction(fn func(tx *Database) error) error {
+	var pending int32
+	if err := db.RawDB().Transaction(func(tx *gorm.DB) error {
+		return fn(&Database{
+			db:                tx.Set(auditHooksPendingKey, &pending),
+			config:            db.config,
+			keyManager:        db.keyManager,
+			signingKeyManager: db.signingKeyManager,
+			signingKeyCreator: db.signingKeyCreator,
+			logger:            db.logger,
+			secretManager:     db.secretManager,
+			realmLocations:    db.realmLocations,
+		})
+	}); err != nil {
+		return err
+	}
+
+	if atomic.LoadInt32(&pending) > 0 {
+		db.runAuditHooks()
+	}
+	return nil
+}
+
 // IsNotFound determines if an error is a record not found.
 func IsNotFound(err error) bool {
 	return errors.Is(err, gorm.ErrRecordNotFound) || gorm.IsRecordNotFoundError(err)
@@ -346,6 +422,31 @@ func callbackIncrementMetric(ctx context.Context, m *stats.Int64Measure, table s
 	}
 }
 
+// callbackRunHooks invokes run after a record is successfully created in the
+// table. The record may be in a transaction which has not yet committed, except
+// for records created inside Transaction, where run is invoked after commit.
+func callbackRunHooks(run func(), table string) func(scope *gorm.Scope) {
+	return func(scope *gorm.Scope) {
+		if scope.TableName() != table {
+			return
+		}
+
+		if scope.HasError() {
+			return
+		}
+
+		// Inside Transaction, the hooks run after the transaction commits.
+		if v, ok := scope.Get(auditHooksPendingKey); ok {
+			if pending, ok := v.(*int32); ok {
+				atomic.AddInt32(pending, 1)
+				return
+			}
+		}
+
+		run()
+	}
+}
+
 // callbackPurgeCache purges the cache key for the given record. If multiple
 // columns are provided, their values are combined with a pipe.
 func callbackPurgeCache(ctx context.Context, cacher cache.Cacher, namespace, table string, columns ...string) func(scope *gorm.Scope) {
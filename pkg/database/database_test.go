@@ -15,9 +15,11 @@
 package database
 
 import (
+	"errors"
 	"io/ioutil"
 	"log"
 	"reflect"
+	"sync/atomic"
 	"testing"
 
 	"github.com/jinzhu/gorm"
@@ -31,6 +33,71 @@ func TestMain(m *testing.M) {
 	m.Run()
 }
 
+func TestDatabase_Transaction(t *testing.T) {
+	t.Parallel()
+
+	db, _ := testDatabaseInstance.NewDatabase(t, nil)
+
+	var hooks int32
+	db.OnAuditEntryCreated(func() {
+		atomic.AddInt32(&hooks, 1)
+	})
+
+	// Changes are rolled back if any of them fail.
+	errBoom := errors.New("boom")
+	if err := db.Transaction(func(tx *Database) error {
+		if err := tx.SaveRealm(NewRealmWithDefaults("rolled-back"), SystemTest); err != nil {
+			return err
+		}
+		return errBoom
+	}); !errors.Is(err, errBoom) {
+		t.Fatalf("expected %v to be %v", err, errBoom)
+	}
+	if _, err := db.FindRealmByName("rolled-back"); !IsNotFound(err) {
+		t.Errorf("expected realm to be rolled back, got %v", err)
+	}
+	if got := atomic.LoadInt32(&hooks); got != 0 {
+		t.Errorf("expected no audit hooks for a rolled back transaction, got %d", got)
+	}
+
+	// Changes are committed together.
+	if err := db.Transaction(func(tx *Database) error {
+		realm := NewRealmWithDefaults("committed")
+		if err := tx.SaveRealm(realm, SystemTest); err != nil {
+			return err
+		}
+		_, err := realm.CreateAuthorizedApp(tx, &AuthorizedApp{
+			Name:       "Committed app",
+			APIKeyType: APIKeyTypeAdmin,
+		}, SystemTest)
+		if err != nil {
+			return err
+		}
+
+		// Audit hooks wait for the transaction to commit.
+		if got := atomic.LoadInt32(&hooks); got != 0 {
+			t.Errorf("expected audit hooks to wait for commit, got %d", got)
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := atomic.LoadInt32(&hooks), int32(1); got != want {
+		t.Errorf("expected audit hooks to run %d times after commit, got %d", want, got)
+	}
+	realm, err := db.FindRealmByName("committed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	apps, _, err := realm.ListAuthorizedApps(db, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(apps), 1; got != want {
+		t.Errorf("expected %d authorized apps, got %d", want, got)
+	}
+}
+
 type validateable interface {
 	ErrorsFor(s string) []string
 	BeforeSave(tx *gorm.DB) error
@@ -88,6 +88,21 @@ func (db *Database) SystemEmailConfig() (*EmailConfig, error) {
 	return &emailConfig, nil
 }
 
+// FindRealmEmailConfig returns the email config owned by the realm. Unlike
+// Realm.EmailConfig, it never returns the system email config.
+func (db *Database) FindRealmEmailConfig(realmID uint) (*EmailConfig, error) {
+	var emailConfig EmailConfig
+	if err := db.db.
+		Model(&EmailConfig{}).
+		Where("realm_id = ?", realmID).
+		Where("is_system IS FALSE").
+		First(&emailConfig).
+		Error; err != nil {
+		return nil, err
+	}
+	return &emailConfig, nil
+}
+
 // SaveEmailConfig creates or updates an email configuration record.
 func (db *Database) SaveEmailConfig(s *EmailConfig) error {
 	if s.SMTPAccount == "" && s.SMTPPassword == "" && s.SMTPHost == "" {
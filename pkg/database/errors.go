@@ -25,6 +25,10 @@ var (
 	// used as a SigningKeyManager.
 	ErrNoSigningKeyManager = errors.New("configured key manager cannot be used to manage per-realm keys")
 
+	// ErrRealmArchived is the error returned when attempting to change an
+	// archived realm.
+	ErrRealmArchived = errors.New("realm is archived")
+
 	// ErrValidationFailed is the error returned when validation failed. This
 	// should always be considered user error.
 	ErrValidationFailed = errors.New("validation failed")
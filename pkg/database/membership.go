@@ -37,6 +37,10 @@ type Membership struct {
 	// Note: This label may not exist if it has been deleted or modified on the realm.
 	DefaultSMSTemplateLabel string `gorm:"type:varchar(255);"`
 
+	// DefaultSiteID is the site to which codes issued by this user in this realm
+	// are attributed when the request does not name a site. Zero means none.
+	DefaultSiteID uint `gorm:"column:default_site_id; type:integer; not null; default:0;"`
+
 	Permissions rbac.Permission
 }
 
@@ -67,9 +71,33 @@ func (db *Database) SaveMembership(m *Membership, actor Auditable) error {
 			return fmt.Errorf("failed to save membership: %w", err)
 		}
 
+		// Update skips zero values, so clearing the default site is explicit.
+		if existing.DefaultSiteID != m.DefaultSiteID {
+			if err := validateSiteID(tx, m.RealmID, m.DefaultSiteID); err != nil {
+				if IsValidationError(err) {
+					m.AddError("defaultSiteID", "does not exist")
+				}
+				return err
+			}
+
+			if err := tx.
+				Model(&Membership{}).
+				Where("user_id = ? AND realm_id = ?", m.UserID, m.RealmID).
+				UpdateColumn("default_site_id", m.DefaultSiteID).
+				Error; err != nil {
+				return fmt.Errorf("failed to save membership default site: %w", err)
+			}
+
+			audit := BuildAuditEntry(actor, "updated membership default site", m.User, m.RealmID)
+			audit.Diff = uintDiff(existing.DefaultSiteID, m.DefaultSiteID)
+			audit.AddChange("DefaultSiteID", existing.DefaultSiteID, m.DefaultSiteID)
+			audits = append(audits, audit)
+		}
+
 		if existing.DefaultSMSTemplateLabel != m.DefaultSMSTemplateLabel {
 			audit := BuildAuditEntry(actor, "updated membership default template", m.User, m.RealmID)
 			audit.Diff = stringDiff(existing.DefaultSMSTemplateLabel, m.DefaultSMSTemplateLabel)
+			audit.AddChange("DefaultSMSTemplateLabel", existing.DefaultSMSTemplateLabel, m.DefaultSMSTemplateLabel)
 			audits = append(audits, audit)
 		}
 
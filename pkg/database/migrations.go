@@ -1879,6 +1879,676 @@ func (db *Database) Migrations(ctx context.Context) []*gormigrate.Migration {
 				return nil
 			},
 		},
+		{
+			ID: "00080-AddCertificateKeyRotation",
+			Migrate: func(tx *gorm.DB) error {
+				sqls := []string{
+					`ALTER TABLE realms ADD COLUMN IF NOT EXISTS certificate_key_rotation_period_days SMALLINT NOT NULL DEFAULT 0`,
+					`ALTER TABLE realms ADD COLUMN IF NOT EXISTS certificate_key_rotation_overlap_hours SMALLINT NOT NULL DEFAULT 24`,
+					`ALTER TABLE signing_keys ADD COLUMN IF NOT EXISTS activated_at TIMESTAMP WITH TIME ZONE`,
+					`ALTER TABLE signing_keys ADD COLUMN IF NOT EXISTS deactivated_at TIMESTAMP WITH TIME ZONE`,
+					`UPDATE signing_keys SET activated_at = updated_at WHERE active IS TRUE AND activated_at IS NULL`,
+				}
+
+				for _, sql := range sqls {
+					if err := tx.Exec(sql).Error; err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+			Rollback: func(tx *gorm.DB) error {
+				sqls := []string{
+					`ALTER TABLE realms DROP COLUMN IF EXISTS certificate_key_rotation_period_days`,
+					`ALTER TABLE realms DROP COLUMN IF EXISTS certificate_key_rotation_overlap_hours`,
+					`ALTER TABLE signing_keys DROP COLUMN IF EXISTS activated_at`,
+					`ALTER TABLE signing_keys DROP COLUMN IF EXISTS deactivated_at`,
+				}
+
+				for _, sql := range sqls {
+					if err := tx.Exec(sql).Error; err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		},
+		{
+			ID: "00081-AddTokenSigningKeys",
+			Migrate: func(tx *gorm.DB) error {
+				sqls := []string{
+					`CREATE TABLE IF NOT EXISTS token_signing_keys (
+						id SERIAL PRIMARY KEY NOT NULL,
+						created_at TIMESTAMP WITH TIME ZONE,
+						updated_at TIMESTAMP WITH TIME ZONE,
+						deleted_at TIMESTAMP WITH TIME ZONE,
+						kid VARCHAR(64) NOT NULL,
+						key_id TEXT,
+						active BOOLEAN NOT NULL DEFAULT FALSE,
+						activated_at TIMESTAMP WITH TIME ZONE,
+						deactivated_at TIMESTAMP WITH TIME ZONE
+					)`,
+					`CREATE UNIQUE INDEX IF NOT EXISTS uix_token_signing_keys_kid ON token_signing_keys (kid)`,
+					`CREATE INDEX IF NOT EXISTS idx_token_signing_keys_deleted_at ON token_signing_keys (deleted_at)`,
+				}
+
+				for _, sql := range sqls {
+					if err := tx.Exec(sql).Error; err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+			Rollback: func(tx *gorm.DB) error {
+				sql := `DROP TABLE IF EXISTS token_signing_keys`
+				return tx.Exec(sql).Error
+			},
+		},
+		{
+			ID: "00082-AddSigningKeyAlgorithm",
+			Migrate: func(tx *gorm.DB) error {
+				sql := `ALTER TABLE signing_keys ADD COLUMN IF NOT EXISTS algorithm VARCHAR(16) NOT NULL DEFAULT 'ES256'`
+				return tx.Exec(sql).Error
+			},
+			Rollback: func(tx *gorm.DB) error {
+				sql := `ALTER TABLE signing_keys DROP COLUMN IF EXISTS algorithm`
+				return tx.Exec(sql).Error
+			},
+		},
+		{
+			ID: "00083-AddCertificateTransparencyLog",
+			Migrate: func(tx *gorm.DB) error {
+				sqls := []string{
+					`CREATE TABLE IF NOT EXISTS certificate_log_entries (
+						id BIGSERIAL PRIMARY KEY NOT NULL,
+						realm_id INTEGER NOT NULL,
+						kid VARCHAR(64) NOT NULL,
+						hmac TEXT NOT NULL,
+						issued_at TIMESTAMP WITH TIME ZONE NOT NULL,
+						leaf_index BIGINT,
+						created_at TIMESTAMP WITH TIME ZONE
+					)`,
+					`CREATE UNIQUE INDEX IF NOT EXISTS uix_certificate_log_entries_leaf_index ON certificate_log_entries (leaf_index)`,
+					`CREATE INDEX IF NOT EXISTS idx_certificate_log_entries_unsequenced ON certificate_log_entries (id) WHERE leaf_index IS NULL`,
+					`CREATE INDEX IF NOT EXISTS idx_certificate_log_entries_realm_hmac ON certificate_log_entries (realm_id, hmac)`,
+					`CREATE TABLE IF NOT EXISTS certificate_log_nodes (
+						level INTEGER NOT NULL,
+						node_index BIGINT NOT NULL,
+						hash BYTEA NOT NULL,
+						PRIMARY KEY (level, node_index)
+					)`,
+					`CREATE TABLE IF NOT EXISTS certificate_log_tree_heads (
+						id BIGSERIAL PRIMARY KEY NOT NULL,
+						tree_size BIGINT NOT NULL,
+						root_hash BYTEA NOT NULL,
+						timestamp TIMESTAMP WITH TIME ZONE,
+						kid VARCHAR(64),
+						algorithm VARCHAR(16),
+						public_key TEXT,
+						signature TEXT,
+						created_at TIMESTAMP WITH TIME ZONE
+					)`,
+					`CREATE INDEX IF NOT EXISTS idx_certificate_log_tree_heads_tree_size ON certificate_log_tree_heads (tree_size)`,
+				}
+
+				for _, sql := range sqls {
+					if err := tx.Exec(sql).Error; err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+			Rollback: func(tx *gorm.DB) error {
+				sqls := []string{
+					`DROP TABLE IF EXISTS certificate_log_tree_heads`,
+					`DROP TABLE IF EXISTS certificate_log_nodes`,
+					`DROP TABLE IF EXISTS certificate_log_entries`,
+				}
+
+				for _, sql := range sqls {
+					if err := tx.Exec(sql).Error; err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		},
+		{
+			ID: "00084-AddRealmTemplates",
+			Migrate: func(tx *gorm.DB) error {
+				sqls := []string{
+					`CREATE TABLE IF NOT EXISTS realm_templates (
+						id SERIAL PRIMARY KEY NOT NULL,
+						created_at TIMESTAMP WITH TIME ZONE,
+						updated_at TIMESTAMP WITH TIME ZONE,
+						deleted_at TIMESTAMP WITH TIME ZONE,
+						name CITEXT NOT NULL,
+						description TEXT,
+						code_length SMALLINT NOT NULL,
+						code_duration BIGINT NOT NULL,
+						long_code_length SMALLINT NOT NULL,
+						long_code_duration BIGINT NOT NULL,
+						allowed_test_types SMALLINT NOT NULL,
+						require_date BOOLEAN NOT NULL DEFAULT FALSE,
+						allow_bulk_upload BOOLEAN NOT NULL DEFAULT FALSE,
+						sms_text_template TEXT NOT NULL,
+						alternate_sms_templates HSTORE,
+						sms_country VARCHAR(5),
+						mfa_mode SMALLINT NOT NULL DEFAULT 0,
+						mfa_required_grace_period BIGINT NOT NULL DEFAULT 0,
+						email_verified_mode SMALLINT NOT NULL DEFAULT 0,
+						password_rotation_period_days SMALLINT NOT NULL DEFAULT 0,
+						password_rotation_warning_days SMALLINT NOT NULL DEFAULT 0,
+						abuse_prevention_enabled BOOLEAN NOT NULL DEFAULT FALSE,
+						abuse_prevention_limit_factor NUMERIC(6, 3) NOT NULL DEFAULT 1.0
+					)`,
+					`CREATE UNIQUE INDEX IF NOT EXISTS uix_realm_templates_name ON realm_templates (name) WHERE deleted_at IS NULL`,
+					`CREATE INDEX IF NOT EXISTS idx_realm_templates_deleted_at ON realm_templates (deleted_at)`,
+				}
+
+				for _, sql := range sqls {
+					if err := tx.Exec(sql).Error; err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+			Rollback: func(tx *gorm.DB) error {
+				return tx.Exec(`DROP TABLE IF EXISTS realm_templates`).Error
+			},
+		},
+		{
+			ID: "00085-AddRealmState",
+			Migrate: func(tx *gorm.DB) error {
+				sql := `ALTER TABLE realms ADD COLUMN IF NOT EXISTS state SMALLINT NOT NULL DEFAULT 0`
+				return tx.Exec(sql).Error
+			},
+			Rollback: func(tx *gorm.DB) error {
+				sql := `ALTER TABLE realms DROP COLUMN IF EXISTS state`
+				return tx.Exec(sql).Error
+			},
+		},
+		{
+			ID: "00086-AddRealmRetention",
+			Migrate: func(tx *gorm.DB) error {
+				sqls := []string{
+					`ALTER TABLE realms ADD COLUMN IF NOT EXISTS verification_code_retention_days SMALLINT NOT NULL DEFAULT 0`,
+					`ALTER TABLE realms ADD COLUMN IF NOT EXISTS audit_entry_retention_days SMALLINT NOT NULL DEFAULT 0`,
+				}
+
+				for _, sql := range sqls {
+					if err := tx.Exec(sql).Error; err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+			Rollback: func(tx *gorm.DB) error {
+				sqls := []string{
+					`ALTER TABLE realms DROP COLUMN IF EXISTS verification_code_retention_days`,
+					`ALTER TABLE realms DROP COLUMN IF EXISTS audit_entry_retention_days`,
+				}
+
+				for _, sql := range sqls {
+					if err := tx.Exec(sql).Error; err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		},
+		{
+			ID: "00087-AddCleanupProgress",
+			Migrate: func(tx *gorm.DB) error {
+				sqls := []string{
+					`ALTER TABLE cleanup_statuses ADD COLUMN IF NOT EXISTS run_started_at TIMESTAMP WITH TIME ZONE`,
+					`ALTER TABLE cleanup_statuses ADD COLUMN IF NOT EXISTS run_completed_at TIMESTAMP WITH TIME ZONE`,
+					`ALTER TABLE cleanup_statuses ADD COLUMN IF NOT EXISTS progress JSONB`,
+				}
+
+				for _, sql := range sqls {
+					if err := tx.Exec(sql).Error; err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+			Rollback: func(tx *gorm.DB) error {
+				sqls := []string{
+					`ALTER TABLE cleanup_statuses DROP COLUMN IF EXISTS run_started_at`,
+					`ALTER TABLE cleanup_statuses DROP COLUMN IF EXISTS run_completed_at`,
+					`ALTER TABLE cleanup_statuses DROP COLUMN IF EXISTS progress`,
+				}
+
+				for _, sql := range sqls {
+					if err := tx.Exec(sql).Error; err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		},
+		{
+			ID: "00088-AddRealmHierarchy",
+			Migrate: func(tx *gorm.DB) error {
+				sqls := []string{
+					`ALTER TABLE realms ADD COLUMN IF NOT EXISTS parent_realm_id INTEGER REFERENCES realms(id) ON DELETE SET NULL`,
+					`CREATE INDEX IF NOT EXISTS idx_realms_parent_realm_id ON realms (parent_realm_id)`,
+					`ALTER TABLE realms ADD COLUMN IF NOT EXISTS inherit_parent_sms_config BOOL NOT NULL DEFAULT false`,
+					`ALTER TABLE realms ADD COLUMN IF NOT EXISTS inherit_parent_test_types BOOL NOT NULL DEFAULT false`,
+					`ALTER TABLE realms ADD COLUMN IF NOT EXISTS inherit_parent_certificate_key BOOL NOT NULL DEFAULT false`,
+				}
+
+				for _, sql := range sqls {
+					if err := tx.Exec(sql).Error; err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+			Rollback: func(tx *gorm.DB) error {
+				sqls := []string{
+					`DROP INDEX IF EXISTS idx_realms_parent_realm_id`,
+					`ALTER TABLE realms DROP COLUMN IF EXISTS parent_realm_id`,
+					`ALTER TABLE realms DROP COLUMN IF EXISTS inherit_parent_sms_config`,
+					`ALTER TABLE realms DROP COLUMN IF EXISTS inherit_parent_test_types`,
+					`ALTER TABLE realms DROP COLUMN IF EXISTS inherit_parent_certificate_key`,
+				}
+
+				for _, sql := range sqls {
+					if err := tx.Exec(sql).Error; err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		},
+		{
+			ID: "00089-AddSites",
+			Migrate: func(tx *gorm.DB) error {
+				sqls := []string{
+					`CREATE TABLE IF NOT EXISTS sites (
+						id SERIAL PRIMARY KEY NOT NULL,
+						created_at TIMESTAMP WITH TIME ZONE,
+						updated_at TIMESTAMP WITH TIME ZONE,
+						deleted_at TIMESTAMP WITH TIME ZONE,
+						realm_id INTEGER NOT NULL REFERENCES realms(id) ON DELETE CASCADE,
+						name CITEXT NOT NULL,
+						description TEXT,
+						daily_code_limit INTEGER NOT NULL DEFAULT 0
+					)`,
+					`CREATE UNIQUE INDEX IF NOT EXISTS uix_sites_realm_id_name ON sites (realm_id, name)`,
+					`CREATE INDEX IF NOT EXISTS idx_sites_deleted_at ON sites (deleted_at)`,
+
+					`CREATE TABLE IF NOT EXISTS site_stats (
+						date DATE NOT NULL,
+						realm_id INTEGER NOT NULL,
+						site_id INTEGER NOT NULL,
+						codes_issued INTEGER NOT NULL DEFAULT 0
+					)`,
+					`CREATE UNIQUE INDEX IF NOT EXISTS idx_site_stats_date_site_id ON site_stats (date, site_id)`,
+					`CREATE INDEX IF NOT EXISTS idx_site_stats_realm_id_date ON site_stats (realm_id, date)`,
+
+					`ALTER TABLE verification_codes ADD COLUMN IF NOT EXISTS issuing_site_id INTEGER NOT NULL DEFAULT 0`,
+					`ALTER TABLE memberships ADD COLUMN IF NOT EXISTS default_site_id INTEGER NOT NULL DEFAULT 0`,
+					`ALTER TABLE authorized_apps ADD COLUMN IF NOT EXISTS default_site_id INTEGER NOT NULL DEFAULT 0`,
+				}
+
+				for _, sql := range sqls {
+					if err := tx.Exec(sql).Error; err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+			Rollback: func(tx *gorm.DB) error {
+				sqls := []string{
+					`ALTER TABLE authorized_apps DROP COLUMN IF EXISTS default_site_id`,
+					`ALTER TABLE memberships DROP COLUMN IF EXISTS default_site_id`,
+					`ALTER TABLE verification_codes DROP COLUMN IF EXISTS issuing_site_id`,
+					`DROP TABLE IF EXISTS site_stats`,
+					`DROP TABLE IF EXISTS sites`,
+				}
+
+				for _, sql := range sqls {
+					if err := tx.Exec(sql).Error; err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		},
+		{
+			ID: "00090-AddRealmTimezone",
+			Migrate: func(tx *gorm.DB) error {
+				// Existing statistics were bucketed by UTC day, so existing realms
+				// default to UTC to keep their history consistent.
+				sql := `ALTER TABLE realms ADD COLUMN IF NOT EXISTS timezone VARCHAR(64) NOT NULL DEFAULT 'UTC'`
+				return tx.Exec(sql).Error
+			},
+			Rollback: func(tx *gorm.DB) error {
+				sql := `ALTER TABLE realms DROP COLUMN IF EXISTS timezone`
+				return tx.Exec(sql).Error
+			},
+		},
+		{
+			ID: "00091-AddRealmStatsFunnel",
+			Migrate: func(tx *gorm.DB) error {
+				sqls := []string{
+					`ALTER TABLE realm_stats ADD COLUMN IF NOT EXISTS tokens_claimed INTEGER NOT NULL DEFAULT 0`,
+					`ALTER TABLE realm_stats ADD COLUMN IF NOT EXISTS sms_failed INTEGER NOT NULL DEFAULT 0`,
+					`ALTER TABLE realm_stats ADD COLUMN IF NOT EXISTS code_claim_age_distribution INTEGER[]`,
+					`ALTER TABLE realm_stats ADD COLUMN IF NOT EXISTS code_claim_age_total_seconds BIGINT NOT NULL DEFAULT 0`,
+				}
+
+				for _, sql := range sqls {
+					if err := tx.Exec(sql).Error; err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+			Rollback: func(tx *gorm.DB) error {
+				sqls := []string{
+					`ALTER TABLE realm_stats DROP COLUMN IF EXISTS code_claim_age_total_seconds`,
+					`ALTER TABLE realm_stats DROP COLUMN IF EXISTS code_claim_age_distribution`,
+					`ALTER TABLE realm_stats DROP COLUMN IF EXISTS sms_failed`,
+					`ALTER TABLE realm_stats DROP COLUMN IF EXISTS tokens_claimed`,
+				}
+
+				for _, sql := range sqls {
+					if err := tx.Exec(sql).Error; err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		},
+		{
+			ID: "00092-AddRealmPublicStats",
+			Migrate: func(tx *gorm.DB) error {
+				sqls := []string{
+					`ALTER TABLE realms ADD COLUMN IF NOT EXISTS public_stats_enabled BOOLEAN NOT NULL DEFAULT false`,
+					`ALTER TABLE realms ADD COLUMN IF NOT EXISTS public_stats_min_count INTEGER NOT NULL DEFAULT 10`,
+					`ALTER TABLE realms ADD COLUMN IF NOT EXISTS public_stats_epsilon NUMERIC(6, 3) NOT NULL DEFAULT 0`,
+				}
+
+				for _, sql := range sqls {
+					if err := tx.Exec(sql).Error; err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+			Rollback: func(tx *gorm.DB) error {
+				sqls := []string{
+					`ALTER TABLE realms DROP COLUMN IF EXISTS public_stats_epsilon`,
+					`ALTER TABLE realms DROP COLUMN IF EXISTS public_stats_min_count`,
+					`ALTER TABLE realms DROP COLUMN IF EXISTS public_stats_enabled`,
+				}
+
+				for _, sql := range sqls {
+					if err := tx.Exec(sql).Error; err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		},
+		{
+			ID: "00093-AddStatsReportSchedules",
+			Migrate: func(tx *gorm.DB) error {
+				sqls := []string{
+					`CREATE TABLE IF NOT EXISTS stats_report_schedules (
+						id SERIAL PRIMARY KEY NOT NULL,
+						created_at TIMESTAMP WITH TIME ZONE,
+						updated_at TIMESTAMP WITH TIME ZONE,
+						deleted_at TIMESTAMP WITH TIME ZONE,
+						realm_id INTEGER NOT NULL REFERENCES realms(id) ON DELETE CASCADE,
+						frequency VARCHAR(16) NOT NULL,
+						enabled BOOLEAN NOT NULL DEFAULT false,
+						recipients TEXT[],
+						export_to_storage BOOLEAN NOT NULL DEFAULT false,
+						last_period_start DATE,
+						last_sent_at TIMESTAMP WITH TIME ZONE
+					)`,
+					`CREATE UNIQUE INDEX IF NOT EXISTS uix_stats_report_schedules_realm_id_frequency ON stats_report_schedules (realm_id, frequency)`,
+					`CREATE INDEX IF NOT EXISTS idx_stats_report_schedules_enabled ON stats_report_schedules (enabled)`,
+				}
+
+				for _, sql := range sqls {
+					if err := tx.Exec(sql).Error; err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+			Rollback: func(tx *gorm.DB) error {
+				return tx.Exec(`DROP TABLE IF EXISTS stats_report_schedules`).Error
+			},
+		},
+		{
+			ID: "00094-GrantAuditExportToRealmAdmins",
+			Migrate: func(tx *gorm.DB) error {
+				// Grant the new audit export permission to members which have every
+				// other legacy realm admin permission, since they could previously
+				// read the full event log.
+				previous := int64(rbac.LegacyRealmAdmin &^ rbac.AuditExport)
+				return tx.Exec(
+					`UPDATE memberships SET permissions = permissions | $1 WHERE permissions & $2 = $2`,
+					int64(rbac.AuditExport), previous,
+				).Error
+			},
+			Rollback: func(tx *gorm.DB) error {
+				return tx.Exec(
+					`UPDATE memberships SET permissions = permissions & ~$1::BIGINT`,
+					int64(rbac.AuditExport),
+				).Error
+			},
+		},
+		{
+			ID: "00095-AddAuditChain",
+			Migrate: func(tx *gorm.DB) error {
+				sqls := []string{
+					`ALTER TABLE audit_entries ADD COLUMN IF NOT EXISTS chain_sequence BIGINT NOT NULL DEFAULT 0`,
+					`ALTER TABLE audit_entries ADD COLUMN IF NOT EXISTS prev_hash BYTEA`,
+					`ALTER TABLE audit_entries ADD COLUMN IF NOT EXISTS hash BYTEA`,
+					`CREATE UNIQUE INDEX IF NOT EXISTS uix_audit_entries_realm_id_chain_sequence ON audit_entries (realm_id, chain_sequence) WHERE chain_sequence > 0`,
+					`CREATE TABLE IF NOT EXISTS audit_chain_heads (
+						realm_id INTEGER PRIMARY KEY NOT NULL,
+						sequence BIGINT NOT NULL DEFAULT 0,
+						hash BYTEA
+					)`,
+					`CREATE TABLE IF NOT EXISTS audit_checkpoints (
+						id SERIAL PRIMARY KEY NOT NULL,
+						realm_id INTEGER NOT NULL,
+						kind VARCHAR(16) NOT NULL,
+						sequence BIGINT NOT NULL,
+						hash BYTEA NOT NULL,
+						timestamp TIMESTAMP WITH TIME ZONE,
+						kid VARCHAR(64),
+						algorithm VARCHAR(16),
+						public_key TEXT,
+						signature TEXT,
+						created_at TIMESTAMP WITH TIME ZONE
+					)`,
+					`CREATE INDEX IF NOT EXISTS idx_audit_checkpoints_realm_id_kind_sequence ON audit_checkpoints (realm_id, kind, sequence)`,
+				}
+
+				for _, sql := range sqls {
+					if err := tx.Exec(sql).Error; err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+			Rollback: func(tx *gorm.DB) error {
+				sqls := []string{
+					`DROP TABLE IF EXISTS audit_checkpoints`,
+					`DROP TABLE IF EXISTS audit_chain_heads`,
+					`DROP INDEX IF EXISTS uix_audit_entries_realm_id_chain_sequence`,
+					`ALTER TABLE audit_entries DROP COLUMN IF EXISTS hash`,
+					`ALTER TABLE audit_entries DROP COLUMN IF EXISTS prev_hash`,
+					`ALTER TABLE audit_entries DROP COLUMN IF EXISTS chain_sequence`,
+				}
+
+				for _, sql := range sqls {
+					if err := tx.Exec(sql).Error; err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		},
+		{
+			ID: "00096-AddAuditSinkCursors",
+			Migrate: func(tx *gorm.DB) error {
+				return tx.Exec(`
+					CREATE TABLE IF NOT EXISTS audit_sink_cursors (
+						sink VARCHAR(64) NOT NULL,
+						realm_id INTEGER NOT NULL,
+						sequence BIGINT NOT NULL DEFAULT 0,
+						updated_at TIMESTAMP WITH TIME ZONE,
+						PRIMARY KEY (sink, realm_id)
+					)`).Error
+			},
+			Rollback: func(tx *gorm.DB) error {
+				return tx.Exec(`DROP TABLE IF EXISTS audit_sink_cursors`).Error
+			},
+		},
+		{
+			ID: "00097-AddAccessEntries",
+			Migrate: func(tx *gorm.DB) error {
+				sqls := []string{
+					`ALTER TABLE realms ADD COLUMN IF NOT EXISTS access_audit_level SMALLINT NOT NULL DEFAULT 0`,
+					`ALTER TABLE realms ADD COLUMN IF NOT EXISTS access_entry_retention_days SMALLINT NOT NULL DEFAULT 0`,
+					`CREATE TABLE IF NOT EXISTS access_entries (
+						id BIGSERIAL PRIMARY KEY,
+						realm_id INTEGER NOT NULL,
+						actor_id TEXT NOT NULL,
+						actor_display TEXT NOT NULL,
+						action TEXT NOT NULL,
+						target_id TEXT NOT NULL,
+						target_display TEXT NOT NULL,
+						method VARCHAR(16),
+						path TEXT,
+						remote_ip VARCHAR(64),
+						user_agent TEXT,
+						request_id VARCHAR(64),
+						created_at TIMESTAMP WITH TIME ZONE
+					)`,
+					`CREATE INDEX IF NOT EXISTS idx_access_entries_realm_id_created_at ON access_entries (realm_id, created_at)`,
+					`CREATE INDEX IF NOT EXISTS idx_access_entries_created_at ON access_entries (created_at)`,
+				}
+				for _, sql := range sqls {
+					if err := tx.Exec(sql).Error; err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+			Rollback: func(tx *gorm.DB) error {
+				sqls := []string{
+					`DROP TABLE IF EXISTS access_entries`,
+					`ALTER TABLE realms DROP COLUMN IF EXISTS access_entry_retention_days`,
+					`ALTER TABLE realms DROP COLUMN IF EXISTS access_audit_level`,
+				}
+				for _, sql := range sqls {
+					if err := tx.Exec(sql).Error; err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		},
+		{
+			ID: "00098-AddAuditEntryChanges",
+			Migrate: func(tx *gorm.DB) error {
+				return tx.Exec(`ALTER TABLE audit_entries ADD COLUMN IF NOT EXISTS changes TEXT`).Error
+			},
+			Rollback: func(tx *gorm.DB) error {
+				return tx.Exec(`ALTER TABLE audit_entries DROP COLUMN IF EXISTS changes`).Error
+			},
+		},
+		{
+			ID: "00099-AddRealmIdentityProvider",
+			Migrate: func(tx *gorm.DB) error {
+				return tx.Exec(`ALTER TABLE realms ADD COLUMN IF NOT EXISTS identity_provider VARCHAR(100) NOT NULL DEFAULT ''`).Error
+			},
+			Rollback: func(tx *gorm.DB) error {
+				return tx.Exec(`ALTER TABLE realms DROP COLUMN IF EXISTS identity_provider`).Error
+			},
+		},
+		{
+			ID: "00100-AddUserIdentities",
+			Migrate: func(tx *gorm.DB) error {
+				sqls := []string{
+					`CREATE TABLE IF NOT EXISTS user_identities (
+						id SERIAL PRIMARY KEY,
+						user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+						provider VARCHAR(100) NOT NULL,
+						subject VARCHAR(255) NOT NULL,
+						created_at TIMESTAMP WITH TIME ZONE
+					)`,
+					`CREATE UNIQUE INDEX IF NOT EXISTS uix_user_identities_provider_subject ON user_identities (provider, subject)`,
+					`CREATE UNIQUE INDEX IF NOT EXISTS uix_user_identities_user_id_provider ON user_identities (user_id, provider)`,
+				}
+				for _, sql := range sqls {
+					if err := tx.Exec(sql).Error; err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+			Rollback: func(tx *gorm.DB) error {
+				return tx.Exec(`DROP TABLE IF EXISTS user_identities`).Error
+			},
+		},
+		{
+			ID: "00101-RebucketRealmStatsByTimezone",
+			Migrate: func(tx *gorm.DB) error {
+				// Realms which changed their timezone before stats were recounted on
+				// change have stats bucketed in both timezones. Realms still in UTC
+				// are already consistent.
+				var realms []struct {
+					ID       uint
+					Timezone string
+				}
+				if err := tx.
+					Raw(`SELECT id, timezone FROM realms WHERE timezone <> 'UTC'`).
+					Scan(&realms).
+					Error; err != nil {
+					return err
+				}
+
+				for _, r := range realms {
+					if err := rebucketRealmStats(tx, r.ID, r.Timezone); err != nil {
+						return fmt.Errorf("failed to recount stats for realm %d: %w", r.ID, err)
+					}
+				}
+				return nil
+			},
+			Rollback: func(tx *gorm.DB) error {
+				return nil
+			},
+		},
+		{
+			ID: "00102-DeactivateImportedTokenSigningKeys",
+			Migrate: func(tx *gorm.DB) error {
+				// Imported keys which were not active were never marked as deactivated,
+				// so they were never destroyed.
+				sql := `
+					UPDATE token_signing_keys SET deactivated_at = NOW()
+					WHERE active IS FALSE AND deactivated_at IS NULL AND deleted_at IS NULL
+						AND 'token_signing_keys:' || id IN (
+							SELECT target_id FROM audit_entries WHERE action = 'imported token signing key'
+						)`
+				return tx.Exec(sql).Error
+			},
+			Rollback: func(tx *gorm.DB) error {
+				return nil
+			},
+		},
 	}
 }
 
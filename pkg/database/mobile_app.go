@@ -15,6 +15,7 @@
 package database
 
 import (
+	"context"
 	"fmt"
 	"strings"
 	"time"
@@ -244,30 +245,35 @@ func (db *Database) SaveMobileApp(a *MobileApp, actor Auditable) error {
 			if existing.Name != a.Name {
 				audit := BuildAuditEntry(actor, "updated mobile app name", a, a.RealmID)
 				audit.Diff = stringDiff(existing.Name, a.Name)
+				audit.AddChange("Name", existing.Name, a.Name)
 				audits = append(audits, audit)
 			}
 
 			if existing.OS != a.OS {
 				audit := BuildAuditEntry(actor, "updated mobile app os", a, a.RealmID)
 				audit.Diff = stringDiff(existing.OS.Display(), a.OS.Display())
+				audit.AddChange("OS", existing.OS, a.OS)
 				audits = append(audits, audit)
 			}
 
 			if existing.AppID != a.AppID {
 				audit := BuildAuditEntry(actor, "updated mobile app appID", a, a.RealmID)
 				audit.Diff = stringDiff(existing.AppID, a.AppID)
+				audit.AddChange("AppID", existing.AppID, a.AppID)
 				audits = append(audits, audit)
 			}
 
 			if existing.SHA != a.SHA {
 				audit := BuildAuditEntry(actor, "updated mobile app sha", a, a.RealmID)
 				audit.Diff = stringDiff(existing.SHA, a.SHA)
+				audit.AddChange("SHA", existing.SHA, a.SHA)
 				audits = append(audits, audit)
 			}
 
 			if existing.DeletedAt != a.DeletedAt {
 				audit := BuildAuditEntry(actor, "updated mobile app enabled", a, a.RealmID)
 				audit.Diff = boolDiff(existing.DeletedAt == nil, a.DeletedAt == nil)
+				audit.AddChange("DeletedAt", existing.DeletedAt, a.DeletedAt)
 				audits = append(audits, audit)
 			}
 		}
@@ -293,15 +299,15 @@ func (a *MobileApp) AuditDisplay() string {
 
 // PurgeMobileApps will delete mobile apps that have been deleted for more than
 // the specified time.
-func (db *Database) PurgeMobileApps(maxAge time.Duration) (int64, error) {
-	if maxAge > 0 {
-		maxAge = -1 * maxAge
-	}
-	deleteBefore := time.Now().UTC().Add(maxAge)
-
-	result := db.db.
-		Unscoped().
-		Where("deleted_at IS NOT NULL AND deleted_at < ?", deleteBefore).
-		Delete(&MobileApp{})
-	return result.RowsAffected, result.Error
+func (db *Database) PurgeMobileApps(ctx context.Context, maxAge time.Duration, opts *PurgeOptions) (*PurgeResult, error) {
+	deleteBefore := time.Now().UTC().Add(-absDuration(maxAge))
+
+	result := &PurgeResult{Table: "mobile_apps"}
+	err := db.purge(ctx, &purgeQuery{
+		table:       "mobile_apps",
+		realmColumn: "realm_id",
+		where:       "deleted_at IS NOT NULL AND deleted_at < ?",
+		args:        []interface{}{deleteBefore},
+	}, opts, result)
+	return result, err
 }
@@ -15,6 +15,7 @@
 package database
 
 import (
+	"context"
 	"fmt"
 	"testing"
 	"time"
@@ -227,6 +228,7 @@ func TestDatabase_ListActiveApps(t *testing.T) {
 func TestDatabase_PurgeMobileApps(t *testing.T) {
 	t.Parallel()
 
+	ctx := context.Background()
 	db, _ := testDatabaseInstance.NewDatabase(t, nil)
 
 	now := time.Now().UTC()
@@ -247,22 +249,22 @@ func TestDatabase_PurgeMobileApps(t *testing.T) {
 
 	// Should not purge entries (too young).
 	{
-		n, err := db.PurgeMobileApps(24 * time.Hour)
+		result, err := db.PurgeMobileApps(ctx, 24*time.Hour, nil)
 		if err != nil {
 			t.Fatal(err)
 		}
-		if got, want := n, int64(0); got != want {
+		if got, want := result.Count, int64(0); got != want {
 			t.Errorf("expected %d to purge, got %d", want, got)
 		}
 	}
 
 	// Purges entries.
 	{
-		n, err := db.PurgeMobileApps(1 * time.Nanosecond)
+		result, err := db.PurgeMobileApps(ctx, 1*time.Nanosecond, nil)
 		if err != nil {
 			t.Fatal(err)
 		}
-		if got, want := n, int64(5); got != want {
+		if got, want := result.Count, int64(5); got != want {
 			t.Errorf("expected %d to purge, got %d", want, got)
 		}
 	}
@@ -0,0 +1,185 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// DefaultPurgeBatchSize is the batch size used when no purge options are
+// given.
+const DefaultPurgeBatchSize = 1000
+
+// PurgeOptions controls how rows are purged. Rows are deleted in batches of at
+// most BatchSize, sleeping BatchSleep between batches so that locks are held
+// briefly and replicas have time to catch up.
+type PurgeOptions struct {
+	// BatchSize is the maximum number of rows affected by a single statement.
+	// If zero, DefaultPurgeBatchSize is used.
+	BatchSize uint
+
+	// BatchSleep is the time to wait between batches.
+	BatchSleep time.Duration
+
+	// DryRun counts the rows which would be purged without modifying them.
+	DryRun bool
+
+	// OnBatch, if set, is called with the running result after each batch.
+	OnBatch func(*PurgeResult)
+}
+
+func (o *PurgeOptions) batchSize() uint {
+	if o == nil || o.BatchSize == 0 {
+		return DefaultPurgeBatchSize
+	}
+	return o.BatchSize
+}
+
+// PurgeResult is the outcome of purging a single table.
+type PurgeResult struct {
+	Table  string `json:"table"`
+	DryRun bool   `json:"dryRun,omitempty"`
+
+	// Count is the number of rows purged, or which would be purged in a dry
+	// run.
+	Count int64 `json:"count"`
+
+	// Batches is the number of statements executed.
+	Batches uint `json:"batches"`
+
+	// Realms is the number of rows purged per realm. Rows which do not belong to
+	// a realm are counted under realm 0.
+	Realms map[uint]int64 `json:"realms,omitempty"`
+}
+
+func (r *PurgeResult) add(realmID uint, count int64) {
+	if r.Realms == nil {
+		r.Realms = make(map[uint]int64)
+	}
+	r.Realms[realmID] += count
+	r.Count += count
+}
+
+// purgeQuery describes the rows of a table to purge.
+type purgeQuery struct {
+	table string
+
+	// realmColumn is the column which attributes a row to a realm. If empty,
+	// rows are not attributed to a realm.
+	realmColumn string
+
+	// set, if non-empty, is the assignment list used to update matching rows
+	// instead of deleting them.
+	set string
+
+	where string
+	args  []interface{}
+}
+
+// purge deletes (or updates) the rows matching q in batches, adding the
+// counts to result. Each batch is its own statement, so a failure part way
+// through leaves the earlier batches committed.
+func (db *Database) purge(ctx context.Context, q *purgeQuery, opts *PurgeOptions, result *PurgeResult) error {
+	realmExpr := "0"
+	if q.realmColumn != "" {
+		realmExpr = fmt.Sprintf("COALESCE(%s, 0)", q.realmColumn)
+	}
+
+	if opts != nil && opts.DryRun {
+		result.DryRun = true
+		sql := fmt.Sprintf(`SELECT %s AS realm_id, COUNT(*) FROM %s WHERE %s GROUP BY 1`,
+			realmExpr, q.table, q.where)
+		if _, err := db.scanRealmCounts(sql, q.args, result); err != nil {
+			return fmt.Errorf("failed to count %s: %w", q.table, err)
+		}
+		result.Batches++
+		return nil
+	}
+
+	action := fmt.Sprintf("DELETE FROM %s", q.table)
+	if q.set != "" {
+		action = fmt.Sprintf("UPDATE %s SET %s", q.table, q.set)
+	}
+
+	// Locked rows are skipped so the purge never waits on, or blocks, a request
+	// which is using them. They are picked up by a later run.
+	batchSize := opts.batchSize()
+	sql := fmt.Sprintf(`
+		WITH purged AS (
+			%s
+			WHERE id IN (
+				SELECT id FROM %s
+				WHERE %s
+				LIMIT %d
+				FOR UPDATE SKIP LOCKED
+			)
+			RETURNING %s AS realm_id
+		)
+		SELECT realm_id, COUNT(*) FROM purged GROUP BY realm_id`,
+		action, q.table, q.where, batchSize, realmExpr)
+
+	for {
+		n, err := db.scanRealmCounts(sql, q.args, result)
+		if err != nil {
+			return fmt.Errorf("failed to purge %s: %w", q.table, err)
+		}
+		result.Batches++
+
+		if opts != nil && opts.OnBatch != nil {
+			opts.OnBatch(result)
+		}
+
+		if n < int64(batchSize) {
+			return nil
+		}
+
+		if opts != nil && opts.BatchSleep > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(opts.BatchSleep):
+			}
+		} else if err := ctx.Err(); err != nil {
+			return err
+		}
+	}
+}
+
+// scanRealmCounts runs a query which returns (realm_id, count) rows and adds
+// them to the result. It returns the total count.
+func (db *Database) scanRealmCounts(sql string, args []interface{}, result *PurgeResult) (int64, error) {
+	rows, err := db.db.Raw(sql, args...).Rows()
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	var total int64
+	for rows.Next() {
+		var realmID uint
+		var count int64
+		if err := rows.Scan(&realmID, &count); err != nil {
+			return 0, err
+		}
+		result.add(realmID, count)
+		total += count
+	}
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	return total, nil
+}
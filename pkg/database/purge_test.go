@@ -0,0 +1,99 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestDatabase_Purge(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	signer := testAuditChainSigner(t)
+
+	db, _ := testDatabaseInstance.NewDatabase(t, nil)
+	for i := 0; i < 5; i++ {
+		for _, realmID := range []uint{1, 2} {
+			if err := db.SaveAuditEntry(&AuditEntry{
+				RealmID:       realmID,
+				ActorID:       "actor:1",
+				ActorDisplay:  "Actor",
+				Action:        "created",
+				TargetID:      "target:1",
+				TargetDisplay: "Target",
+			}); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	// Dry run counts, but does not delete.
+	{
+		result, err := db.PurgeAuditEntries(ctx, 1*time.Nanosecond, nil, signer, &PurgeOptions{DryRun: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !result.DryRun {
+			t.Errorf("expected dry run")
+		}
+		if got, want := result.Count, int64(10); got != want {
+			t.Errorf("expected %d to purge, got %d", want, got)
+		}
+		if got, want := result.Realms[1], int64(5); got != want {
+			t.Errorf("expected %d to purge in realm 1, got %d", want, got)
+		}
+		if got, want := result.Realms[2], int64(5); got != want {
+			t.Errorf("expected %d to purge in realm 2, got %d", want, got)
+		}
+
+		var count int64
+		if err := db.db.Model(&AuditEntry{}).Count(&count).Error; err != nil {
+			t.Fatal(err)
+		}
+		if got, want := count, int64(10); got != want {
+			t.Errorf("expected %d entries to remain, got %d", want, got)
+		}
+	}
+
+	// Purges in batches.
+	{
+		var calls uint
+		result, err := db.PurgeAuditEntries(ctx, 1*time.Nanosecond, nil, signer, &PurgeOptions{
+			BatchSize:  3,
+			BatchSleep: time.Millisecond,
+			OnBatch:    func(*PurgeResult) { calls++ },
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := result.Count, int64(10); got != want {
+			t.Errorf("expected %d to purge, got %d", want, got)
+		}
+		// Each realm's chain is purged separately, 5 entries in batches of 3,
+		// followed by a single batch for unchained entries.
+		if got, want := result.Batches, uint(5); got != want {
+			t.Errorf("expected %d batches, got %d", want, got)
+		}
+		if got, want := calls, result.Batches; got != want {
+			t.Errorf("expected %d progress calls, got %d", want, got)
+		}
+		if got, want := result.Realms[2], int64(5); got != want {
+			t.Errorf("expected %d to purge in realm 2, got %d", want, got)
+		}
+	}
+}
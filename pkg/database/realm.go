@@ -22,16 +22,21 @@ import (
 	"net"
 	"os"
 	"reflect"
+	"regexp"
 	"sort"
-	"strconv"
 	"strings"
+	"sync"
 	"time"
 
-	"github.com/google/exposure-notifications-server/pkg/timeutils"
+	// Embed the timezone database, since the release images do not include one.
+	_ "time/tzdata"
+
+	"github.com/google/exposure-notifications-server/pkg/keys"
 	"github.com/google/exposure-notifications-verification-server/internal/project"
 	"github.com/google/exposure-notifications-verification-server/pkg/cache"
 	"github.com/google/exposure-notifications-verification-server/pkg/digest"
 	"github.com/google/exposure-notifications-verification-server/pkg/email"
+	"github.com/google/exposure-notifications-verification-server/pkg/keyutils"
 	"github.com/google/exposure-notifications-verification-server/pkg/pagination"
 	"github.com/google/exposure-notifications-verification-server/pkg/rbac"
 	"github.com/google/exposure-notifications-verification-server/pkg/sms"
@@ -98,6 +103,10 @@ func (r AuthRequirement) String() string {
 var (
 	ErrNoSigningKeyManagement = errors.New("no signing key management")
 	ErrBadDateRange           = errors.New("bad date range")
+
+	// identityProviderRe matches the names of OpenID Connect identity
+	// providers.
+	identityProviderRe = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
 )
 
 const (
@@ -124,6 +133,22 @@ const (
 
 	// MaxPageSize is the maximum allowed page size for a list query.
 	MaxPageSize = 1000
+
+	// DefaultTimezone is the timezone for realms that do not configure one.
+	DefaultTimezone = "UTC"
+
+	// DefaultPublicStatsMinCount is the default threshold below which published
+	// counts are suppressed. MaxPublicStatsMinCount and MaxPublicStatsEpsilon
+	// bound the publishing settings.
+	DefaultPublicStatsMinCount = 10
+	MaxPublicStatsMinCount     = 1000
+	MaxPublicStatsEpsilon      = 10
+
+	// MaxCertificateKeyRotationPeriodDays and
+	// MaxCertificateKeyRotationOverlapHours bound the automatic signing key
+	// rotation settings, which are stored as smallints.
+	MaxCertificateKeyRotationPeriodDays   = 365
+	MaxCertificateKeyRotationOverlapHours = 30 * 24
 )
 
 var _ Auditable = (*Realm)(nil)
@@ -150,6 +175,10 @@ type Realm struct {
 	WelcomeMessage    string  `gorm:"-"`
 	WelcomeMessagePtr *string `gorm:"column:welcome_message; type:text;"`
 
+	// Timezone is the IANA timezone in which the realm operates. Daily
+	// statistics are bucketed by calendar day in this timezone.
+	Timezone string `gorm:"column:timezone; type:varchar(64); not null; default:'UTC';"`
+
 	// AllowBulkUpload allows users to issue codes from a batch file of test results.
 	AllowBulkUpload bool `gorm:"type:boolean; not null; default:false;"`
 
@@ -173,6 +202,11 @@ type Realm struct {
 	// empty and a local SMS config is preferred over the system value.
 	CanUseSystemSMSConfig bool `gorm:"column:can_use_system_sms_config; type:bool; not null; default:false;"`
 
+	// IdentityProvider is configured by system administrators to require that
+	// users of this realm sign in through the named OpenID Connect identity
+	// provider. If empty, any configured provider is accepted.
+	IdentityProvider string `gorm:"column:identity_provider; type:varchar(100); not null; default:'';"`
+
 	// UseSystemSMSConfig is a realm-level configuration that lets a realm opt-out
 	// of sending SMS messages using the system-provided SMS configuration.
 	// Without this, a realm would always fallback to the system-level SMS
@@ -242,6 +276,17 @@ type Realm struct {
 	CertificateAudience    string          `gorm:"type:varchar(150); default: '';"`
 	CertificateDuration    DurationSeconds `gorm:"type:bigint; default: 900;"` // 15m
 
+	// CertificateKeyRotationPeriodDays is the number of days a realm signing key
+	// remains active before it is automatically rotated. A value of 0 disables
+	// automatic rotation.
+	CertificateKeyRotationPeriodDays uint `gorm:"type:smallint; not null; default: 0;"`
+
+	// CertificateKeyRotationOverlapHours is the number of hours the next signing
+	// key is published in the JWKS before it becomes active. This gives key
+	// servers time to discover the new key before certificates are signed with
+	// it.
+	CertificateKeyRotationOverlapHours uint `gorm:"type:smallint; not null; default: 24;"`
+
 	// EN Express
 	EnableENExpress bool `gorm:"type:boolean; default: false;"`
 
@@ -265,6 +310,50 @@ type Realm struct {
 	// active user metrics.
 	DailyActiveUsersEnabled bool `gorm:"type:boolean; not null; default: false;"`
 
+	// PublicStatsEnabled determines if the realm's statistics are published on
+	// the unauthenticated public statistics endpoints. Published counts below
+	// PublicStatsMinCount are suppressed, and if PublicStatsEpsilon is non-zero,
+	// Laplace noise with scale 1/PublicStatsEpsilon is added to each count
+	// before suppression.
+	PublicStatsEnabled  bool    `gorm:"column:public_stats_enabled; type:boolean; not null; default: false;"`
+	PublicStatsMinCount uint    `gorm:"column:public_stats_min_count; type:integer; not null; default: 10;"`
+	PublicStatsEpsilon  float64 `gorm:"column:public_stats_epsilon; type:numeric(6, 3); not null; default: 0;"`
+
+	// VerificationCodeRetentionDays, AuditEntryRetentionDays, and
+	// AccessEntryRetentionDays override the system retention of verification
+	// code statuses, audit entries, and access entries. Zero uses the system
+	// default. The cleanup job clamps overrides to the system minimums and
+	// maximums.
+	VerificationCodeRetentionDays uint `gorm:"type:smallint; not null; default: 0;"`
+	AuditEntryRetentionDays       uint `gorm:"type:smallint; not null; default: 0;"`
+	AccessEntryRetentionDays      uint `gorm:"type:smallint; not null; default: 0;"`
+
+	// AccessAuditLevel determines which reads of sensitive data are recorded as
+	// access entries.
+	AccessAuditLevel AccessAuditLevel `gorm:"column:access_audit_level; type:smallint; not null; default: 0;"`
+
+	// State is the lifecycle state of the realm. Only active realms accept API
+	// requests and logins.
+	State RealmState `gorm:"column:state; type:smallint; not null; default: 0;"`
+
+	// ParentRealmID is the realm above this realm in the hierarchy, if any.
+	// Admins of a parent realm can view the stats, audit logs, and users of the
+	// realms below it. Do not modify ParentRealmIDPtr directly.
+	ParentRealmID    uint  `gorm:"-"`
+	ParentRealmIDPtr *uint `gorm:"column:parent_realm_id; type:integer;"`
+
+	// InheritParentSMSConfig uses the parent realm's SMS configuration when this
+	// realm has none of its own.
+	InheritParentSMSConfig bool `gorm:"column:inherit_parent_sms_config; type:boolean; not null; default:false;"`
+
+	// InheritParentTestTypes keeps the allowed test types in sync with the
+	// parent realm.
+	InheritParentTestTypes bool `gorm:"column:inherit_parent_test_types; type:boolean; not null; default:false;"`
+
+	// InheritParentCertificateKey signs certificates with the parent realm's
+	// signing keys, issuer, audience, and duration.
+	InheritParentCertificateKey bool `gorm:"column:inherit_parent_certificate_key; type:boolean; not null; default:false;"`
+
 	// Relations to items that belong to a realm.
 	Codes  []*VerificationCode `gorm:"PRELOAD:false; SAVE_ASSOCIATIONS:false; ASSOCIATION_AUTOUPDATE:false, ASSOCIATION_SAVE_REFERENCE:false;"`
 	Tokens []*Token            `gorm:"PRELOAD:false; SAVE_ASSOCIATIONS:false; ASSOCIATION_AUTOUPDATE:false, ASSOCIATION_SAVE_REFERENCE:false;"`
@@ -280,8 +369,10 @@ func NewRealmWithDefaults(name string) *Realm {
 		LongCodeLength:      16,
 		LongCodeDuration:    FromDuration(24 * time.Hour),
 		SMSTextTemplate:     DefaultSMSTextTemplate,
+		Timezone:            DefaultTimezone,
 		AllowedTestTypes:    14,
 		CertificateDuration: FromDuration(15 * time.Minute),
+		PublicStatsMinCount: DefaultPublicStatsMinCount,
 		RequireDate:         true, // Having dates is really important to risk scoring, encourage this by default true.
 	}
 }
@@ -292,6 +383,7 @@ func (r *Realm) AfterFind(tx *gorm.DB) error {
 	r.WelcomeMessage = stringValue(r.WelcomeMessagePtr)
 	r.SMSCountry = stringValue(r.SMSCountryPtr)
 	r.SMSFromNumberID = uintValue(r.SMSFromNumberIDPtr)
+	r.ParentRealmID = uintValue(r.ParentRealmIDPtr)
 
 	return nil
 }
@@ -312,6 +404,29 @@ func (r *Realm) BeforeSave(tx *gorm.DB) error {
 	r.WelcomeMessage = project.TrimSpace(r.WelcomeMessage)
 	r.WelcomeMessagePtr = stringPtr(r.WelcomeMessage)
 
+	r.Timezone = project.TrimSpace(r.Timezone)
+	if r.Timezone == "" {
+		r.Timezone = DefaultTimezone
+	}
+	if _, err := time.LoadLocation(r.Timezone); err != nil {
+		r.AddError("timezone", "is not a valid timezone")
+	}
+
+	if r.PublicStatsMinCount > MaxPublicStatsMinCount {
+		r.AddError("publicStatsMinCount", fmt.Sprintf("must be %d or less", MaxPublicStatsMinCount))
+	}
+	if r.PublicStatsEpsilon < 0 || r.PublicStatsEpsilon > MaxPublicStatsEpsilon {
+		r.AddError("publicStatsEpsilon", fmt.Sprintf("must be between 0 and %d", MaxPublicStatsEpsilon))
+	}
+
+	if r.AccessAuditLevel < AccessAuditOff || r.AccessAuditLevel > AccessAuditAll {
+		r.AddError("accessAuditLevel", "is not a valid level")
+	}
+
+	if r.IdentityProvider != "" && !identityProviderRe.MatchString(r.IdentityProvider) {
+		r.AddError("identityProvider", "is not a valid identity provider name")
+	}
+
 	if r.UseSystemSMSConfig && !r.CanUseSystemSMSConfig {
 		r.AddError("useSystemSMSConfig", "is not allowed on this realm")
 	}
@@ -324,6 +439,19 @@ func (r *Realm) BeforeSave(tx *gorm.DB) error {
 
 	r.SMSFromNumberIDPtr = uintPtr(r.SMSFromNumberID)
 
+	r.ParentRealmIDPtr = uintPtr(r.ParentRealmID)
+	if !r.HasParent() {
+		if r.InheritParentSMSConfig {
+			r.AddError("inheritParentSMSConfig", "requires a parent realm")
+		}
+		if r.InheritParentTestTypes {
+			r.AddError("inheritParentTestTypes", "requires a parent realm")
+		}
+		if r.InheritParentCertificateKey {
+			r.AddError("inheritParentCertificateKey", "requires a parent realm")
+		}
+	}
+
 	if r.EnableENExpress {
 		if r.RegionCode == "" {
 			r.AddError("regionCode", "cannot be blank when using EN Express")
@@ -408,6 +536,21 @@ func (r *Realm) BeforeSave(tx *gorm.DB) error {
 		}
 	}
 
+	if r.CertificateKeyRotationPeriodDays > MaxCertificateKeyRotationPeriodDays {
+		r.AddError("certificateKeyRotationPeriodDays", fmt.Sprintf("must be %d or less", MaxCertificateKeyRotationPeriodDays))
+	}
+	if r.CertificateKeyRotationOverlapHours > MaxCertificateKeyRotationOverlapHours {
+		r.AddError("certificateKeyRotationOverlapHours", fmt.Sprintf("must be %d or less", MaxCertificateKeyRotationOverlapHours))
+	}
+	if r.CertificateKeyRotationPeriodDays > 0 {
+		if !r.UseRealmCertificateKey {
+			r.AddError("certificateKeyRotationPeriodDays", "requires realm-specific signing keys")
+		}
+		if r.CertificateKeyRotationOverlapHours >= r.CertificateKeyRotationPeriodDays*24 {
+			r.AddError("certificateKeyRotationOverlapHours", "must be less than the rotation period")
+		}
+	}
+
 	return r.ErrorOrNil()
 }
 
@@ -562,6 +705,13 @@ func (r *Realm) SMSConfig(db *Database) (*SMSConfig, error) {
 
 	var smsConfig SMSConfig
 	if err := q.First(&smsConfig).Error; err != nil {
+		if IsNotFound(err) && r.HasParent() && r.InheritParentSMSConfig {
+			parent, perr := r.Parent(db)
+			if perr != nil {
+				return nil, fmt.Errorf("failed to find parent realm: %w", perr)
+			}
+			return parent.SMSConfig(db)
+		}
 		return nil, err
 	}
 
@@ -593,10 +743,17 @@ func (r *Realm) HasSMSConfig(db *Database) (bool, error) {
 
 	var id []uint64
 	if err := q.Pluck("id", &id).Error; err != nil {
-		if IsNotFound(err) {
-			return false, nil
+		if !IsNotFound(err) {
+			return false, err
 		}
-		return false, err
+	}
+
+	if len(id) == 0 && r.HasParent() && r.InheritParentSMSConfig {
+		parent, err := r.Parent(db)
+		if err != nil {
+			return false, fmt.Errorf("failed to find parent realm: %w", err)
+		}
+		return parent.HasSMSConfig(db)
 	}
 	return len(id) > 0, nil
 }
@@ -673,13 +830,30 @@ func (r *Realm) AbusePreventionEffectiveLimit() uint {
 	return uint(math.Ceil(float64(r.AbusePreventionLimit) * float64(factor)))
 }
 
-// AbusePreventionEnabledRealmIDs returns the list of realm IDs that have abuse
-// prevention enabled.
+// AbusePreventionEnabledRealmIDs returns the list of active realm IDs that have
+// abuse prevention enabled.
 func (db *Database) AbusePreventionEnabledRealmIDs() ([]uint64, error) {
 	var ids []uint64
 	if err := db.db.
 		Model(&Realm{}).
 		Where("abuse_prevention_enabled IS true").
+		Where("state = ?", RealmStateActive).
+		Pluck("id", &ids).
+		Error; err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// CertificateKeyRotationEnabledRealmIDs returns the list of active realm IDs
+// that have automatic certificate signing key rotation enabled.
+func (db *Database) CertificateKeyRotationEnabledRealmIDs() ([]uint64, error) {
+	var ids []uint64
+	if err := db.db.
+		Model(&Realm{}).
+		Where("use_realm_certificate_key IS true").
+		Where("certificate_key_rotation_period_days > 0").
+		Where("state = ?", RealmStateActive).
 		Pluck("id", &ids).
 		Error; err != nil {
 		return nil, err
@@ -728,17 +902,27 @@ func (r *Realm) SetActiveSigningKey(db *Database, id uint) (string, error) {
 			return fmt.Errorf("failed to find newly active key: %w", err)
 		}
 
-		// Mark all other keys as inactive.
+		// Mark all other keys as inactive, recording when the previously active
+		// key was superseded.
+		now := time.Now().UTC()
 		if err := tx.
 			Table("signing_keys").
 			Where("realm_id = ?", r.ID).
 			Where("id != ?", id).
-			Update("active", false).
+			Where("active = ?", true).
+			Updates(map[string]interface{}{
+				"active":         false,
+				"deactivated_at": now,
+			}).
 			Error; err != nil {
 			return fmt.Errorf("failed to mark existing keys as inactive: %w", err)
 		}
 
 		// Mark the active key as active.
+		if !signingKey.Active {
+			signingKey.ActivatedAt = &now
+			signingKey.DeactivatedAt = nil
+		}
 		signingKey.Active = true
 		if err := tx.Save(&signingKey).Error; err != nil {
 			return fmt.Errorf("failed to mark new key as active: %w", err)
@@ -1008,242 +1192,423 @@ func (db *Database) SaveRealm(r *Realm, actor Auditable) error {
 		return fmt.Errorf("auditing actor is nil")
 	}
 
-	return db.db.Transaction(func(tx *gorm.DB) error {
-		var audits []*AuditEntry
+	if err := db.db.Transaction(func(tx *gorm.DB) error {
+		return saveRealm(tx, r, actor)
+	}); err != nil {
+		return err
+	}
+	db.forgetRealmLocation(r.ID)
+	return nil
+}
 
-		var existing Realm
-		if err := tx.
-			Model(&Realm{}).
-			Where("id = ?", r.ID).
-			First(&existing).
-			Error; err != nil && !IsNotFound(err) {
-			return fmt.Errorf("failed to get existing realm: %w", err)
-		}
+// saveRealm saves the realm and audits the changes in the transaction.
+func saveRealm(tx *gorm.DB, r *Realm, actor Auditable) error {
+	var audits []*AuditEntry
+
+	var existing Realm
+	if err := tx.
+		Model(&Realm{}).
+		Where("id = ?", r.ID).
+		First(&existing).
+		Error; err != nil && !IsNotFound(err) {
+		return fmt.Errorf("failed to get existing realm: %w", err)
+	}
+
+	// Archived realms are read-only until they are restored.
+	if existing.IsArchived() && r.IsArchived() {
+		return ErrRealmArchived
+	}
+
+	if err := validateRealmParent(tx, r); err != nil {
+		return err
+	}
+	if err := applyInheritedTestTypes(tx, r); err != nil {
+		return err
+	}
+
+	// Save the realm
+	if err := tx.Save(r).Error; err != nil {
+		return err
+	}
 
-		// Save the realm
-		if err := tx.Save(r).Error; err != nil {
+	// Recount the stats into the days of the new timezone.
+	if existing.ID != 0 && existing.Timezone != r.Timezone {
+		if err := rebucketRealmStats(tx, r.ID, r.Timezone); err != nil {
 			return err
 		}
+	}
 
-		// Brand new realm?
-		if existing.ID == 0 {
-			audit := BuildAuditEntry(actor, "created realm", r, r.ID)
+	// Brand new realm?
+	if existing.ID == 0 {
+		audit := BuildAuditEntry(actor, "created realm", r, r.ID)
+		audits = append(audits, audit)
+	} else {
+		if existing.Name != r.Name {
+			audit := BuildAuditEntry(actor, "updated realm name", r, r.ID)
+			audit.Diff = stringDiff(existing.Name, r.Name)
+			audit.AddChange("Name", existing.Name, r.Name)
 			audits = append(audits, audit)
-		} else {
-			if existing.Name != r.Name {
-				audit := BuildAuditEntry(actor, "updated realm name", r, r.ID)
-				audit.Diff = stringDiff(existing.Name, r.Name)
-				audits = append(audits, audit)
-			}
+		}
 
-			if existing.RegionCode != r.RegionCode {
-				audit := BuildAuditEntry(actor, "updated region code", r, r.ID)
-				audit.Diff = stringDiff(existing.RegionCode, r.RegionCode)
-				audits = append(audits, audit)
-			}
+		if existing.RegionCode != r.RegionCode {
+			audit := BuildAuditEntry(actor, "updated region code", r, r.ID)
+			audit.Diff = stringDiff(existing.RegionCode, r.RegionCode)
+			audit.AddChange("RegionCode", existing.RegionCode, r.RegionCode)
+			audits = append(audits, audit)
+		}
 
-			if existing.WelcomeMessage != r.WelcomeMessage {
-				audit := BuildAuditEntry(actor, "updated welcome message", r, r.ID)
-				audit.Diff = stringDiff(existing.WelcomeMessage, r.WelcomeMessage)
-				audits = append(audits, audit)
-			}
+		if existing.WelcomeMessage != r.WelcomeMessage {
+			audit := BuildAuditEntry(actor, "updated welcome message", r, r.ID)
+			audit.Diff = stringDiff(existing.WelcomeMessage, r.WelcomeMessage)
+			audit.AddChange("WelcomeMessage", existing.WelcomeMessage, r.WelcomeMessage)
+			audits = append(audits, audit)
+		}
 
-			if existing.CodeLength != r.CodeLength {
-				audit := BuildAuditEntry(actor, "updated code length", r, r.ID)
-				audit.Diff = uintDiff(existing.CodeLength, r.CodeLength)
-				audits = append(audits, audit)
-			}
+		if existing.Timezone != r.Timezone {
+			audit := BuildAuditEntry(actor, "updated timezone", r, r.ID)
+			audit.Diff = stringDiff(existing.Timezone, r.Timezone)
+			audit.AddChange("Timezone", existing.Timezone, r.Timezone)
+			audits = append(audits, audit)
+		}
 
-			if existing.CodeDuration != r.CodeDuration {
-				audit := BuildAuditEntry(actor, "updated code duration", r, r.ID)
-				audit.Diff = stringDiff(existing.CodeDuration.AsString, r.CodeDuration.AsString)
-				audits = append(audits, audit)
-			}
+		if existing.CodeLength != r.CodeLength {
+			audit := BuildAuditEntry(actor, "updated code length", r, r.ID)
+			audit.Diff = uintDiff(existing.CodeLength, r.CodeLength)
+			audit.AddChange("CodeLength", existing.CodeLength, r.CodeLength)
+			audits = append(audits, audit)
+		}
 
-			if existing.LongCodeLength != r.LongCodeLength {
-				audit := BuildAuditEntry(actor, "updated long code length", r, r.ID)
-				audit.Diff = uintDiff(existing.LongCodeLength, r.LongCodeLength)
-				audits = append(audits, audit)
-			}
+		if existing.CodeDuration != r.CodeDuration {
+			audit := BuildAuditEntry(actor, "updated code duration", r, r.ID)
+			audit.Diff = stringDiff(existing.CodeDuration.AsString, r.CodeDuration.AsString)
+			audit.AddChange("CodeDuration", existing.CodeDuration, r.CodeDuration)
+			audits = append(audits, audit)
+		}
 
-			if existing.LongCodeDuration != r.LongCodeDuration {
-				audit := BuildAuditEntry(actor, "updated long code duration", r, r.ID)
-				audit.Diff = stringDiff(existing.LongCodeDuration.AsString, r.LongCodeDuration.AsString)
-				audits = append(audits, audit)
-			}
+		if existing.LongCodeLength != r.LongCodeLength {
+			audit := BuildAuditEntry(actor, "updated long code length", r, r.ID)
+			audit.Diff = uintDiff(existing.LongCodeLength, r.LongCodeLength)
+			audit.AddChange("LongCodeLength", existing.LongCodeLength, r.LongCodeLength)
+			audits = append(audits, audit)
+		}
 
-			if existing.SMSTextTemplate != r.SMSTextTemplate {
-				audit := BuildAuditEntry(actor, "updated SMS template", r, r.ID)
-				audit.Diff = stringDiff(existing.SMSTextTemplate, r.SMSTextTemplate)
-				audits = append(audits, audit)
-			}
+		if existing.LongCodeDuration != r.LongCodeDuration {
+			audit := BuildAuditEntry(actor, "updated long code duration", r, r.ID)
+			audit.Diff = stringDiff(existing.LongCodeDuration.AsString, r.LongCodeDuration.AsString)
+			audit.AddChange("LongCodeDuration", existing.LongCodeDuration, r.LongCodeDuration)
+			audits = append(audits, audit)
+		}
 
-			if existing.SMSCountry != r.SMSCountry {
-				audit := BuildAuditEntry(actor, "updated SMS country", r, r.ID)
-				audit.Diff = stringDiff(existing.SMSCountry, r.SMSCountry)
-				audits = append(audits, audit)
-			}
+		if existing.SMSTextTemplate != r.SMSTextTemplate {
+			audit := BuildAuditEntry(actor, "updated SMS template", r, r.ID)
+			audit.Diff = stringDiff(existing.SMSTextTemplate, r.SMSTextTemplate)
+			audit.AddChange("SMSTextTemplate", existing.SMSTextTemplate, r.SMSTextTemplate)
+			audits = append(audits, audit)
+		}
 
-			if existing.CanUseSystemSMSConfig != r.CanUseSystemSMSConfig {
-				audit := BuildAuditEntry(actor, "updated ability to use system SMS config", r, r.ID)
-				audit.Diff = boolDiff(existing.CanUseSystemSMSConfig, r.CanUseSystemSMSConfig)
-				audits = append(audits, audit)
-			}
+		if existing.SMSCountry != r.SMSCountry {
+			audit := BuildAuditEntry(actor, "updated SMS country", r, r.ID)
+			audit.Diff = stringDiff(existing.SMSCountry, r.SMSCountry)
+			audit.AddChange("SMSCountry", existing.SMSCountry, r.SMSCountry)
+			audits = append(audits, audit)
+		}
 
-			if existing.UseSystemSMSConfig != r.UseSystemSMSConfig {
-				audit := BuildAuditEntry(actor, "updated use system SMS config", r, r.ID)
-				audit.Diff = boolDiff(existing.UseSystemSMSConfig, r.UseSystemSMSConfig)
-				audits = append(audits, audit)
-			}
+		if existing.CanUseSystemSMSConfig != r.CanUseSystemSMSConfig {
+			audit := BuildAuditEntry(actor, "updated ability to use system SMS config", r, r.ID)
+			audit.Diff = boolDiff(existing.CanUseSystemSMSConfig, r.CanUseSystemSMSConfig)
+			audit.AddChange("CanUseSystemSMSConfig", existing.CanUseSystemSMSConfig, r.CanUseSystemSMSConfig)
+			audits = append(audits, audit)
+		}
 
-			if existing.EmailInviteTemplate != r.EmailInviteTemplate {
-				audit := BuildAuditEntry(actor, "updated email invite template", r, r.ID)
-				audit.Diff = stringDiff(existing.EmailInviteTemplate, r.EmailInviteTemplate)
-				audits = append(audits, audit)
-			}
+		if existing.IdentityProvider != r.IdentityProvider {
+			audit := BuildAuditEntry(actor, "updated identity provider", r, r.ID)
+			audit.Diff = stringDiff(existing.IdentityProvider, r.IdentityProvider)
+			audit.AddChange("IdentityProvider", existing.IdentityProvider, r.IdentityProvider)
+			audits = append(audits, audit)
+		}
 
-			if existing.EmailPasswordResetTemplate != r.EmailPasswordResetTemplate {
-				audit := BuildAuditEntry(actor, "updated email password reset template", r, r.ID)
-				audit.Diff = stringDiff(existing.EmailPasswordResetTemplate, r.EmailPasswordResetTemplate)
-				audits = append(audits, audit)
-			}
+		if existing.UseSystemSMSConfig != r.UseSystemSMSConfig {
+			audit := BuildAuditEntry(actor, "updated use system SMS config", r, r.ID)
+			audit.Diff = boolDiff(existing.UseSystemSMSConfig, r.UseSystemSMSConfig)
+			audit.AddChange("UseSystemSMSConfig", existing.UseSystemSMSConfig, r.UseSystemSMSConfig)
+			audits = append(audits, audit)
+		}
 
-			if existing.EmailVerifyTemplate != r.EmailVerifyTemplate {
-				audit := BuildAuditEntry(actor, "updated email verify template", r, r.ID)
-				audit.Diff = stringDiff(existing.EmailVerifyTemplate, r.EmailVerifyTemplate)
-				audits = append(audits, audit)
-			}
+		if existing.EmailInviteTemplate != r.EmailInviteTemplate {
+			audit := BuildAuditEntry(actor, "updated email invite template", r, r.ID)
+			audit.Diff = stringDiff(existing.EmailInviteTemplate, r.EmailInviteTemplate)
+			audit.AddChange("EmailInviteTemplate", existing.EmailInviteTemplate, r.EmailInviteTemplate)
+			audits = append(audits, audit)
+		}
 
-			if existing.CanUseSystemEmailConfig != r.CanUseSystemEmailConfig {
-				audit := BuildAuditEntry(actor, "updated ability to use system email config", r, r.ID)
-				audit.Diff = boolDiff(existing.CanUseSystemEmailConfig, r.CanUseSystemEmailConfig)
-				audits = append(audits, audit)
-			}
+		if existing.EmailPasswordResetTemplate != r.EmailPasswordResetTemplate {
+			audit := BuildAuditEntry(actor, "updated email password reset template", r, r.ID)
+			audit.Diff = stringDiff(existing.EmailPasswordResetTemplate, r.EmailPasswordResetTemplate)
+			audit.AddChange("EmailPasswordResetTemplate", existing.EmailPasswordResetTemplate, r.EmailPasswordResetTemplate)
+			audits = append(audits, audit)
+		}
 
-			if existing.UseSystemEmailConfig != r.UseSystemEmailConfig {
-				audit := BuildAuditEntry(actor, "updated use system email config", r, r.ID)
-				audit.Diff = boolDiff(existing.UseSystemEmailConfig, r.UseSystemEmailConfig)
-				audits = append(audits, audit)
-			}
+		if existing.EmailVerifyTemplate != r.EmailVerifyTemplate {
+			audit := BuildAuditEntry(actor, "updated email verify template", r, r.ID)
+			audit.Diff = stringDiff(existing.EmailVerifyTemplate, r.EmailVerifyTemplate)
+			audit.AddChange("EmailVerifyTemplate", existing.EmailVerifyTemplate, r.EmailVerifyTemplate)
+			audits = append(audits, audit)
+		}
 
-			if existing.MFAMode != r.MFAMode {
-				audit := BuildAuditEntry(actor, "updated MFA mode", r, r.ID)
-				audit.Diff = stringDiff(existing.MFAMode.String(), r.MFAMode.String())
-				audits = append(audits, audit)
-			}
+		if existing.CanUseSystemEmailConfig != r.CanUseSystemEmailConfig {
+			audit := BuildAuditEntry(actor, "updated ability to use system email config", r, r.ID)
+			audit.Diff = boolDiff(existing.CanUseSystemEmailConfig, r.CanUseSystemEmailConfig)
+			audit.AddChange("CanUseSystemEmailConfig", existing.CanUseSystemEmailConfig, r.CanUseSystemEmailConfig)
+			audits = append(audits, audit)
+		}
 
-			if existing.MFARequiredGracePeriod != r.MFARequiredGracePeriod {
-				audit := BuildAuditEntry(actor, "updated MFA required grace period", r, r.ID)
-				audit.Diff = stringDiff(existing.MFARequiredGracePeriod.AsString, r.MFARequiredGracePeriod.AsString)
-				audits = append(audits, audit)
-			}
+		if existing.UseSystemEmailConfig != r.UseSystemEmailConfig {
+			audit := BuildAuditEntry(actor, "updated use system email config", r, r.ID)
+			audit.Diff = boolDiff(existing.UseSystemEmailConfig, r.UseSystemEmailConfig)
+			audit.AddChange("UseSystemEmailConfig", existing.UseSystemEmailConfig, r.UseSystemEmailConfig)
+			audits = append(audits, audit)
+		}
 
-			if existing.EmailVerifiedMode != r.EmailVerifiedMode {
-				audit := BuildAuditEntry(actor, "updated email verification mode", r, r.ID)
-				audit.Diff = stringDiff(existing.EmailVerifiedMode.String(), r.EmailVerifiedMode.String())
-				audits = append(audits, audit)
-			}
+		if existing.MFAMode != r.MFAMode {
+			audit := BuildAuditEntry(actor, "updated MFA mode", r, r.ID)
+			audit.Diff = stringDiff(existing.MFAMode.String(), r.MFAMode.String())
+			audit.AddChange("MFAMode", existing.MFAMode, r.MFAMode)
+			audits = append(audits, audit)
+		}
 
-			if existing.PasswordRotationPeriodDays != r.PasswordRotationPeriodDays {
-				audit := BuildAuditEntry(actor, "updated password rotation period", r, r.ID)
-				audit.Diff = uintDiff(existing.PasswordRotationPeriodDays, r.PasswordRotationPeriodDays)
-				audits = append(audits, audit)
-			}
+		if existing.MFARequiredGracePeriod != r.MFARequiredGracePeriod {
+			audit := BuildAuditEntry(actor, "updated MFA required grace period", r, r.ID)
+			audit.Diff = stringDiff(existing.MFARequiredGracePeriod.AsString, r.MFARequiredGracePeriod.AsString)
+			audit.AddChange("MFARequiredGracePeriod", existing.MFARequiredGracePeriod, r.MFARequiredGracePeriod)
+			audits = append(audits, audit)
+		}
 
-			if existing.PasswordRotationWarningDays != r.PasswordRotationWarningDays {
-				audit := BuildAuditEntry(actor, "updated password rotation warning", r, r.ID)
-				audit.Diff = uintDiff(existing.PasswordRotationWarningDays, r.PasswordRotationWarningDays)
-				audits = append(audits, audit)
-			}
+		if existing.EmailVerifiedMode != r.EmailVerifiedMode {
+			audit := BuildAuditEntry(actor, "updated email verification mode", r, r.ID)
+			audit.Diff = stringDiff(existing.EmailVerifiedMode.String(), r.EmailVerifiedMode.String())
+			audit.AddChange("EmailVerifiedMode", existing.EmailVerifiedMode, r.EmailVerifiedMode)
+			audits = append(audits, audit)
+		}
 
-			if old, new := existing.AllowedCIDRsAdminAPI, r.AllowedCIDRsAdminAPI; !reflect.DeepEqual(old, new) {
-				audit := BuildAuditEntry(actor, "updated adminapi allowed cidrs", r, r.ID)
-				audit.Diff = stringSliceDiff(old, new)
-				audits = append(audits, audit)
-			}
+		if existing.PasswordRotationPeriodDays != r.PasswordRotationPeriodDays {
+			audit := BuildAuditEntry(actor, "updated password rotation period", r, r.ID)
+			audit.Diff = uintDiff(existing.PasswordRotationPeriodDays, r.PasswordRotationPeriodDays)
+			audit.AddChange("PasswordRotationPeriodDays", existing.PasswordRotationPeriodDays, r.PasswordRotationPeriodDays)
+			audits = append(audits, audit)
+		}
 
-			if old, new := existing.AllowedCIDRsAPIServer, r.AllowedCIDRsAPIServer; !reflect.DeepEqual(old, new) {
-				audit := BuildAuditEntry(actor, "updated apiserver allowed cidrs", r, r.ID)
-				audit.Diff = stringSliceDiff(old, new)
-				audits = append(audits, audit)
-			}
+		if existing.PasswordRotationWarningDays != r.PasswordRotationWarningDays {
+			audit := BuildAuditEntry(actor, "updated password rotation warning", r, r.ID)
+			audit.Diff = uintDiff(existing.PasswordRotationWarningDays, r.PasswordRotationWarningDays)
+			audit.AddChange("PasswordRotationWarningDays", existing.PasswordRotationWarningDays, r.PasswordRotationWarningDays)
+			audits = append(audits, audit)
+		}
 
-			if old, new := existing.AllowedCIDRsServer, r.AllowedCIDRsServer; !reflect.DeepEqual(old, new) {
-				audit := BuildAuditEntry(actor, "updated server allowed cidrs", r, r.ID)
-				audit.Diff = stringSliceDiff(old, new)
-				audits = append(audits, audit)
-			}
+		if old, new := existing.AllowedCIDRsAdminAPI, r.AllowedCIDRsAdminAPI; !reflect.DeepEqual(old, new) {
+			audit := BuildAuditEntry(actor, "updated adminapi allowed cidrs", r, r.ID)
+			audit.Diff = stringSliceDiff(old, new)
+			audit.AddChange("AllowedCIDRsAdminAPI", existing.AllowedCIDRsAdminAPI, r.AllowedCIDRsAdminAPI)
+			audits = append(audits, audit)
+		}
 
-			if existing.AllowedTestTypes != r.AllowedTestTypes {
-				audit := BuildAuditEntry(actor, "updated allowed test types", r, r.ID)
-				audit.Diff = stringDiff(existing.AllowedTestTypes.Display(), r.AllowedTestTypes.Display())
-				audits = append(audits, audit)
-			}
+		if old, new := existing.AllowedCIDRsAPIServer, r.AllowedCIDRsAPIServer; !reflect.DeepEqual(old, new) {
+			audit := BuildAuditEntry(actor, "updated apiserver allowed cidrs", r, r.ID)
+			audit.Diff = stringSliceDiff(old, new)
+			audit.AddChange("AllowedCIDRsAPIServer", existing.AllowedCIDRsAPIServer, r.AllowedCIDRsAPIServer)
+			audits = append(audits, audit)
+		}
 
-			if existing.RequireDate != r.RequireDate {
-				audit := BuildAuditEntry(actor, "updated require date", r, r.ID)
-				audit.Diff = boolDiff(existing.RequireDate, r.RequireDate)
-				audits = append(audits, audit)
-			}
+		if old, new := existing.AllowedCIDRsServer, r.AllowedCIDRsServer; !reflect.DeepEqual(old, new) {
+			audit := BuildAuditEntry(actor, "updated server allowed cidrs", r, r.ID)
+			audit.Diff = stringSliceDiff(old, new)
+			audit.AddChange("AllowedCIDRsServer", existing.AllowedCIDRsServer, r.AllowedCIDRsServer)
+			audits = append(audits, audit)
+		}
 
-			if existing.UseRealmCertificateKey != r.UseRealmCertificateKey {
-				audit := BuildAuditEntry(actor, "updated use realm certificate key", r, r.ID)
-				audit.Diff = boolDiff(existing.UseRealmCertificateKey, r.UseRealmCertificateKey)
-				audits = append(audits, audit)
-			}
+		if existing.AllowedTestTypes != r.AllowedTestTypes {
+			audit := BuildAuditEntry(actor, "updated allowed test types", r, r.ID)
+			audit.Diff = stringDiff(existing.AllowedTestTypes.Display(), r.AllowedTestTypes.Display())
+			audit.AddChange("AllowedTestTypes", existing.AllowedTestTypes, r.AllowedTestTypes)
+			audits = append(audits, audit)
+		}
 
-			if existing.CertificateIssuer != r.CertificateIssuer {
-				audit := BuildAuditEntry(actor, "updated certificate issuer", r, r.ID)
-				audit.Diff = stringDiff(existing.CertificateIssuer, r.CertificateIssuer)
-				audits = append(audits, audit)
-			}
+		if existing.RequireDate != r.RequireDate {
+			audit := BuildAuditEntry(actor, "updated require date", r, r.ID)
+			audit.Diff = boolDiff(existing.RequireDate, r.RequireDate)
+			audit.AddChange("RequireDate", existing.RequireDate, r.RequireDate)
+			audits = append(audits, audit)
+		}
 
-			if existing.CertificateAudience != r.CertificateAudience {
-				audit := BuildAuditEntry(actor, "updated certificate audience", r, r.ID)
-				audit.Diff = stringDiff(existing.CertificateAudience, r.CertificateAudience)
-				audits = append(audits, audit)
-			}
+		if existing.UseRealmCertificateKey != r.UseRealmCertificateKey {
+			audit := BuildAuditEntry(actor, "updated use realm certificate key", r, r.ID)
+			audit.Diff = boolDiff(existing.UseRealmCertificateKey, r.UseRealmCertificateKey)
+			audit.AddChange("UseRealmCertificateKey", existing.UseRealmCertificateKey, r.UseRealmCertificateKey)
+			audits = append(audits, audit)
+		}
 
-			if existing.CertificateDuration != r.CertificateDuration {
-				audit := BuildAuditEntry(actor, "updated certificate duration", r, r.ID)
-				audit.Diff = stringDiff(existing.CertificateDuration.AsString, r.CertificateDuration.AsString)
-				audits = append(audits, audit)
-			}
+		if existing.CertificateIssuer != r.CertificateIssuer {
+			audit := BuildAuditEntry(actor, "updated certificate issuer", r, r.ID)
+			audit.Diff = stringDiff(existing.CertificateIssuer, r.CertificateIssuer)
+			audit.AddChange("CertificateIssuer", existing.CertificateIssuer, r.CertificateIssuer)
+			audits = append(audits, audit)
+		}
 
-			if existing.EnableENExpress != r.EnableENExpress {
-				audit := BuildAuditEntry(actor, "updated enable ENX", r, r.ID)
-				audit.Diff = boolDiff(existing.EnableENExpress, r.EnableENExpress)
-				audits = append(audits, audit)
-			}
+		if existing.CertificateAudience != r.CertificateAudience {
+			audit := BuildAuditEntry(actor, "updated certificate audience", r, r.ID)
+			audit.Diff = stringDiff(existing.CertificateAudience, r.CertificateAudience)
+			audit.AddChange("CertificateAudience", existing.CertificateAudience, r.CertificateAudience)
+			audits = append(audits, audit)
+		}
 
-			if existing.AbusePreventionEnabled != r.AbusePreventionEnabled {
-				audit := BuildAuditEntry(actor, "updated enable abuse prevention", r, r.ID)
-				audit.Diff = boolDiff(existing.AbusePreventionEnabled, r.AbusePreventionEnabled)
-				audits = append(audits, audit)
-			}
+		if existing.CertificateDuration != r.CertificateDuration {
+			audit := BuildAuditEntry(actor, "updated certificate duration", r, r.ID)
+			audit.Diff = stringDiff(existing.CertificateDuration.AsString, r.CertificateDuration.AsString)
+			audit.AddChange("CertificateDuration", existing.CertificateDuration, r.CertificateDuration)
+			audits = append(audits, audit)
+		}
 
-			if existing.AbusePreventionLimit != r.AbusePreventionLimit {
-				audit := BuildAuditEntry(actor, "updated abuse prevention limit", r, r.ID)
-				audit.Diff = uintDiff(existing.AbusePreventionLimit, r.AbusePreventionLimit)
-				audits = append(audits, audit)
-			}
+		if existing.CertificateKeyRotationPeriodDays != r.CertificateKeyRotationPeriodDays {
+			audit := BuildAuditEntry(actor, "updated certificate key rotation period", r, r.ID)
+			audit.Diff = uintDiff(existing.CertificateKeyRotationPeriodDays, r.CertificateKeyRotationPeriodDays)
+			audit.AddChange("CertificateKeyRotationPeriodDays", existing.CertificateKeyRotationPeriodDays, r.CertificateKeyRotationPeriodDays)
+			audits = append(audits, audit)
+		}
 
-			if existing.AbusePreventionLimitFactor != r.AbusePreventionLimitFactor {
-				audit := BuildAuditEntry(actor, "updated abuse prevention limit factor", r, r.ID)
-				audit.Diff = float32Diff(existing.AbusePreventionLimitFactor, r.AbusePreventionLimitFactor)
-				audits = append(audits, audit)
-			}
+		if existing.CertificateKeyRotationOverlapHours != r.CertificateKeyRotationOverlapHours {
+			audit := BuildAuditEntry(actor, "updated certificate key rotation overlap", r, r.ID)
+			audit.Diff = uintDiff(existing.CertificateKeyRotationOverlapHours, r.CertificateKeyRotationOverlapHours)
+			audit.AddChange("CertificateKeyRotationOverlapHours", existing.CertificateKeyRotationOverlapHours, r.CertificateKeyRotationOverlapHours)
+			audits = append(audits, audit)
 		}
 
-		// Save all audits
-		for _, audit := range audits {
-			if err := tx.Save(audit).Error; err != nil {
-				return fmt.Errorf("failed to save audits: %w", err)
-			}
+		if existing.EnableENExpress != r.EnableENExpress {
+			audit := BuildAuditEntry(actor, "updated enable ENX", r, r.ID)
+			audit.Diff = boolDiff(existing.EnableENExpress, r.EnableENExpress)
+			audit.AddChange("EnableENExpress", existing.EnableENExpress, r.EnableENExpress)
+			audits = append(audits, audit)
 		}
 
-		return nil
-	})
+		if existing.AbusePreventionEnabled != r.AbusePreventionEnabled {
+			audit := BuildAuditEntry(actor, "updated enable abuse prevention", r, r.ID)
+			audit.Diff = boolDiff(existing.AbusePreventionEnabled, r.AbusePreventionEnabled)
+			audit.AddChange("AbusePreventionEnabled", existing.AbusePreventionEnabled, r.AbusePreventionEnabled)
+			audits = append(audits, audit)
+		}
+
+		if existing.AbusePreventionLimit != r.AbusePreventionLimit {
+			audit := BuildAuditEntry(actor, "updated abuse prevention limit", r, r.ID)
+			audit.Diff = uintDiff(existing.AbusePreventionLimit, r.AbusePreventionLimit)
+			audit.AddChange("AbusePreventionLimit", existing.AbusePreventionLimit, r.AbusePreventionLimit)
+			audits = append(audits, audit)
+		}
+
+		if existing.AbusePreventionLimitFactor != r.AbusePreventionLimitFactor {
+			audit := BuildAuditEntry(actor, "updated abuse prevention limit factor", r, r.ID)
+			audit.Diff = float32Diff(existing.AbusePreventionLimitFactor, r.AbusePreventionLimitFactor)
+			audit.AddChange("AbusePreventionLimitFactor", existing.AbusePreventionLimitFactor, r.AbusePreventionLimitFactor)
+			audits = append(audits, audit)
+		}
+
+		if existing.PublicStatsEnabled != r.PublicStatsEnabled {
+			audit := BuildAuditEntry(actor, "updated public stats enabled", r, r.ID)
+			audit.Diff = boolDiff(existing.PublicStatsEnabled, r.PublicStatsEnabled)
+			audit.AddChange("PublicStatsEnabled", existing.PublicStatsEnabled, r.PublicStatsEnabled)
+			audits = append(audits, audit)
+		}
+
+		if existing.PublicStatsMinCount != r.PublicStatsMinCount {
+			audit := BuildAuditEntry(actor, "updated public stats minimum count", r, r.ID)
+			audit.Diff = uintDiff(existing.PublicStatsMinCount, r.PublicStatsMinCount)
+			audit.AddChange("PublicStatsMinCount", existing.PublicStatsMinCount, r.PublicStatsMinCount)
+			audits = append(audits, audit)
+		}
+
+		if existing.PublicStatsEpsilon != r.PublicStatsEpsilon {
+			audit := BuildAuditEntry(actor, "updated public stats epsilon", r, r.ID)
+			audit.Diff = float64Diff(existing.PublicStatsEpsilon, r.PublicStatsEpsilon)
+			audit.AddChange("PublicStatsEpsilon", existing.PublicStatsEpsilon, r.PublicStatsEpsilon)
+			audits = append(audits, audit)
+		}
+
+		if existing.VerificationCodeRetentionDays != r.VerificationCodeRetentionDays {
+			audit := BuildAuditEntry(actor, "updated verification code retention", r, r.ID)
+			audit.Diff = uintDiff(existing.VerificationCodeRetentionDays, r.VerificationCodeRetentionDays)
+			audit.AddChange("VerificationCodeRetentionDays", existing.VerificationCodeRetentionDays, r.VerificationCodeRetentionDays)
+			audits = append(audits, audit)
+		}
+
+		if existing.AuditEntryRetentionDays != r.AuditEntryRetentionDays {
+			audit := BuildAuditEntry(actor, "updated audit entry retention", r, r.ID)
+			audit.Diff = uintDiff(existing.AuditEntryRetentionDays, r.AuditEntryRetentionDays)
+			audit.AddChange("AuditEntryRetentionDays", existing.AuditEntryRetentionDays, r.AuditEntryRetentionDays)
+			audits = append(audits, audit)
+		}
+
+		if existing.AccessEntryRetentionDays != r.AccessEntryRetentionDays {
+			audit := BuildAuditEntry(actor, "updated access entry retention", r, r.ID)
+			audit.Diff = uintDiff(existing.AccessEntryRetentionDays, r.AccessEntryRetentionDays)
+			audit.AddChange("AccessEntryRetentionDays", existing.AccessEntryRetentionDays, r.AccessEntryRetentionDays)
+			audits = append(audits, audit)
+		}
+
+		if existing.AccessAuditLevel != r.AccessAuditLevel {
+			audit := BuildAuditEntry(actor, "updated access audit level", r, r.ID)
+			audit.Diff = stringDiff(existing.AccessAuditLevel.String(), r.AccessAuditLevel.String())
+			audit.AddChange("AccessAuditLevel", existing.AccessAuditLevel, r.AccessAuditLevel)
+			audits = append(audits, audit)
+		}
+
+		if existing.State != r.State {
+			audit := BuildAuditEntry(actor, "updated realm state", r, r.ID)
+			audit.Diff = stringDiff(existing.State.Display(), r.State.Display())
+			audit.AddChange("State", existing.State, r.State)
+			audits = append(audits, audit)
+		}
+
+		if existing.ParentRealmID != r.ParentRealmID {
+			audit := BuildAuditEntry(actor, "updated parent realm", r, r.ID)
+			audit.Diff = uintDiff(existing.ParentRealmID, r.ParentRealmID)
+			audit.AddChange("ParentRealmID", existing.ParentRealmID, r.ParentRealmID)
+			audits = append(audits, audit)
+		}
+
+		if existing.InheritParentSMSConfig != r.InheritParentSMSConfig {
+			audit := BuildAuditEntry(actor, "updated inherit parent SMS config", r, r.ID)
+			audit.Diff = boolDiff(existing.InheritParentSMSConfig, r.InheritParentSMSConfig)
+			audit.AddChange("InheritParentSMSConfig", existing.InheritParentSMSConfig, r.InheritParentSMSConfig)
+			audits = append(audits, audit)
+		}
+
+		if existing.InheritParentTestTypes != r.InheritParentTestTypes {
+			audit := BuildAuditEntry(actor, "updated inherit parent test types", r, r.ID)
+			audit.Diff = boolDiff(existing.InheritParentTestTypes, r.InheritParentTestTypes)
+			audit.AddChange("InheritParentTestTypes", existing.InheritParentTestTypes, r.InheritParentTestTypes)
+			audits = append(audits, audit)
+		}
+
+		if existing.InheritParentCertificateKey != r.InheritParentCertificateKey {
+			audit := BuildAuditEntry(actor, "updated inherit parent certificate key", r, r.ID)
+			audit.Diff = boolDiff(existing.InheritParentCertificateKey, r.InheritParentCertificateKey)
+			audit.AddChange("InheritParentCertificateKey", existing.InheritParentCertificateKey, r.InheritParentCertificateKey)
+			audits = append(audits, audit)
+		}
+	}
+
+	// Children which inherit the allowed test types follow this realm.
+	if existing.AllowedTestTypes != r.AllowedTestTypes {
+		if err := propagateTestTypes(tx, r, actor); err != nil {
+			return err
+		}
+	}
+
+	// Save all audits
+	for _, audit := range audits {
+		if err := tx.Save(audit).Error; err != nil {
+			return fmt.Errorf("failed to save audits: %w", err)
+		}
+	}
+
+	return nil
 }
 
 // CreateAuthorizedApp generates a new API key and assigns it to the specified
@@ -1281,27 +1646,64 @@ func (r *Realm) CanUpgradeToRealmSigningKeys() bool {
 	return r.CertificateIssuer != "" && r.CertificateAudience != ""
 }
 
+// CertificateKeyRotationEnabled returns true if the realm's certificate signing
+// keys are automatically rotated.
+func (r *Realm) CertificateKeyRotationEnabled() bool {
+	return r.UseRealmCertificateKey && r.CertificateKeyRotationPeriodDays > 0
+}
+
+// CertificateKeyRotationPeriod returns the rotation period as a duration.
+func (r *Realm) CertificateKeyRotationPeriod() time.Duration {
+	return time.Duration(r.CertificateKeyRotationPeriodDays) * 24 * time.Hour
+}
+
+// CertificateKeyRotationOverlap returns the rotation overlap as a duration.
+func (r *Realm) CertificateKeyRotationOverlap() time.Duration {
+	return time.Duration(r.CertificateKeyRotationOverlapHours) * time.Hour
+}
+
 func (r *Realm) SigningKeyID() string {
 	return fmt.Sprintf("realm-%d", r.ID)
 }
 
+// SigningKeyIDForAlgorithm returns the name of the key in the key manager for
+// the given algorithm. Key managers do not permit changing the algorithm of an
+// existing key, so each algorithm gets its own key. ES256 keeps the original
+// name for compatibility with existing keys.
+func (r *Realm) SigningKeyIDForAlgorithm(alg keyutils.Algorithm) string {
+	if alg == keyutils.AlgorithmES256 {
+		return r.SigningKeyID()
+	}
+	return fmt.Sprintf("%s-%s", r.SigningKeyID(), strings.ToLower(string(alg)))
+}
+
 // CreateSigningKeyVersion creates a new signing key version on the key manager
 // and saves a reference to the new key version in the database. If creating the
 // key in the key manager fails, the database is not updated. However, if
 // updating the signing key in the database fails, the key is NOT deleted from
 // the key manager.
-func (r *Realm) CreateSigningKeyVersion(ctx context.Context, db *Database) (string, error) {
+//
+// The key is created with the given algorithm. ES256 is supported by all key
+// managers, other algorithms require a key manager that supports them.
+func (r *Realm) CreateSigningKeyVersion(ctx context.Context, db *Database, alg keyutils.Algorithm) (string, error) {
 	manager := db.signingKeyManager
 	if manager == nil {
 		return "", ErrNoSigningKeyManager
 	}
 
+	if alg == "" {
+		alg = keyutils.AlgorithmES256
+	}
+	if _, err := keyutils.ParseAlgorithm(string(alg)); err != nil {
+		return "", err
+	}
+
 	parent := db.config.CertificateSigningKeyRing
 	if parent == "" {
 		return "", fmt.Errorf("missing CERTIFICATE_SIGNING_KEYRING")
 	}
 
-	name := r.SigningKeyID()
+	name := r.SigningKeyIDForAlgorithm(alg)
 	if name == "" {
 		return "", fmt.Errorf("missing key name")
 	}
@@ -1326,7 +1728,16 @@ func (r *Realm) CreateSigningKeyVersion(ctx context.Context, db *Database) (stri
 
 	// Create the parent key - this interface does not return an error if the key
 	// already exists, so this is safe to run each time.
-	keyName, err := manager.CreateSigningKey(ctx, parent, name)
+	var keyName string
+	var err error
+	if alg == keyutils.AlgorithmES256 {
+		keyName, err = manager.CreateSigningKey(ctx, parent, name)
+	} else {
+		if db.signingKeyCreator == nil {
+			return "", fmt.Errorf("key manager does not support %s signing keys", alg)
+		}
+		keyName, err = db.signingKeyCreator.CreateSigningKeyForAlgorithm(ctx, parent, name, alg)
+	}
 	if err != nil {
 		return "", fmt.Errorf("failed to create signing key: %w", err)
 	}
@@ -1337,10 +1748,22 @@ func (r *Realm) CreateSigningKeyVersion(ctx context.Context, db *Database) (stri
 		return "", fmt.Errorf("failed to create signing key version: %w", err)
 	}
 
+	// Verify the key manager actually created a key of the requested type. If
+	// not, destroy the version so it is never advertised.
+	if err := validateSigningKeyVersion(ctx, db.keyManager, version, alg); err != nil {
+		if derr := manager.DestroyKeyVersion(ctx, version); derr != nil {
+			db.logger.Errorw("failed to destroy invalid signing key version",
+				"key_id", version,
+				"error", derr)
+		}
+		return "", fmt.Errorf("invalid signing key version: %w", err)
+	}
+
 	// Drop a log message for debugging.
 	db.logger.Debugw("provisioned new signing key for realm",
 		"realm_id", r.ID,
-		"key_id", version)
+		"key_id", version,
+		"algorithm", alg)
 
 	// Save the reference to the key in the database. This is done in a
 	// transaction to avoid a race where keys are being created simultaneously and
@@ -1364,7 +1787,12 @@ func (r *Realm) CreateSigningKeyVersion(ctx context.Context, db *Database) (stri
 		// Create the new key.
 		signingKey.RealmID = r.ID
 		signingKey.KeyID = version
+		signingKey.Algorithm = string(alg)
 		signingKey.Active = (count == 0)
+		if signingKey.Active {
+			now := time.Now().UTC()
+			signingKey.ActivatedAt = &now
+		}
 
 		// Save the key.
 		if err := tx.Save(&signingKey).Error; err != nil {
@@ -1378,6 +1806,16 @@ func (r *Realm) CreateSigningKeyVersion(ctx context.Context, db *Database) (stri
 	return signingKey.GetKID(), nil
 }
 
+// validateSigningKeyVersion ensures the public key of the given version matches
+// the algorithm.
+func validateSigningKeyVersion(ctx context.Context, manager keys.KeyManager, version string, alg keyutils.Algorithm) error {
+	signer, err := manager.NewSigner(ctx, version)
+	if err != nil {
+		return fmt.Errorf("failed to get signer: %w", err)
+	}
+	return alg.ValidatePublicKey(signer.Public())
+}
+
 // DestroySigningKeyVersion destroys the given key version in both the database
 // and the key manager. ID is the primary key ID from the database. If the id
 // does not exist, it does nothing.
@@ -1430,37 +1868,22 @@ func (r *Realm) DestroySigningKeyVersion(ctx context.Context, db *Database, id i
 // Stats returns the 30-day usage statistics for this realm. If no stats exist,
 // returns an empty array.
 func (r *Realm) Stats(db *Database) (RealmStats, error) {
-	stop := timeutils.Midnight(time.Now().UTC())
-	start := stop.Add(30 * -24 * time.Hour)
-	if start.After(stop) {
-		return nil, ErrBadDateRange
-	}
-
-	sql := `
-		SELECT
-			d.date AS date,
-			$1 AS realm_id,
-			COALESCE(s.codes_issued, 0) AS codes_issued,
-			COALESCE(s.codes_claimed, 0) AS codes_claimed,
-			COALESCE(s.daily_active_users, 0) AS daily_active_users
-		FROM (
-			SELECT date::date FROM generate_series($2, $3, '1 day'::interval) date
-		) d
-		LEFT JOIN realm_stats s ON s.realm_id = $1 AND s.date = d.date
-		ORDER BY date DESC`
-
-	var stats []*RealmStat
-	if err := db.db.Raw(sql, r.ID, start, stop).Scan(&stats).Error; err != nil {
-		if IsNotFound(err) {
-			return stats, nil
-		}
-		return nil, err
-	}
-	return stats, nil
+	return r.StatsInRange(db, r.DefaultStatsRange())
 }
 
 // StatsCached is stats, but cached.
 func (r *Realm) StatsCached(ctx context.Context, db *Database, cacher cache.Cacher) (RealmStats, error) {
+	return r.StatsInRangeCached(ctx, db, cacher, r.DefaultStatsRange())
+}
+
+// StatsInRange returns the usage statistics for this realm in the given range,
+// grouped by the range's granularity.
+func (r *Realm) StatsInRange(db *Database, sr *StatsRange) (RealmStats, error) {
+	return realmStats(db, r.ID, []uint{r.ID}, sr)
+}
+
+// StatsInRangeCached is StatsInRange, but cached.
+func (r *Realm) StatsInRangeCached(ctx context.Context, db *Database, cacher cache.Cacher, sr *StatsRange) (RealmStats, error) {
 	if cacher == nil {
 		return nil, fmt.Errorf("cacher cannot be nil")
 	}
@@ -1468,10 +1891,10 @@ func (r *Realm) StatsCached(ctx context.Context, db *Database, cacher cache.Cach
 	var stats RealmStats
 	cacheKey := &cache.Key{
 		Namespace: "stats:realm",
-		Key:       strconv.FormatUint(uint64(r.ID), 10),
+		Key:       fmt.Sprintf("%d:%s", r.ID, sr.CacheKey()),
 	}
 	if err := cacher.Fetch(ctx, cacheKey, &stats, 30*time.Minute, func() (interface{}, error) {
-		return r.Stats(db)
+		return r.StatsInRange(db, sr)
 	}); err != nil {
 		return nil, err
 	}
@@ -1481,38 +1904,52 @@ func (r *Realm) StatsCached(ctx context.Context, db *Database, cacher cache.Cach
 // ExternalIssuerStats returns the 30-day external issuer stats for this realm.
 // If no stats exist, returns an empty slice.
 func (r *Realm) ExternalIssuerStats(db *Database) (ExternalIssuerStats, error) {
-	stop := timeutils.Midnight(time.Now().UTC())
-	start := stop.Add(30 * -24 * time.Hour)
-	if start.After(stop) {
+	return r.ExternalIssuerStatsInRange(db, r.DefaultStatsRange())
+}
+
+// ExternalIssuerStatsCached is stats, but cached.
+func (r *Realm) ExternalIssuerStatsCached(ctx context.Context, db *Database, cacher cache.Cacher) (ExternalIssuerStats, error) {
+	return r.ExternalIssuerStatsInRangeCached(ctx, db, cacher, r.DefaultStatsRange())
+}
+
+// ExternalIssuerStatsInRange returns the external issuer stats for this realm
+// in the given range, grouped by the range's granularity.
+func (r *Realm) ExternalIssuerStatsInRange(db *Database, sr *StatsRange) (ExternalIssuerStats, error) {
+	if sr.Start.After(sr.Stop) {
 		return nil, ErrBadDateRange
 	}
 
-	// Pull the stats by generating the full date range and full list of external
-	// issuers that generated data in that range, then join on stats. This will
-	// ensure we have a full list (with values of 0 where appropriate) to ensure
-	// continuity in graphs.
+	// Pull the stats by generating the full list of periods and full list of
+	// external issuers that generated data in that range, then join on stats.
+	// This will ensure we have a full list (with values of 0 where appropriate)
+	// to ensure continuity in graphs.
 	sql := `
 		SELECT
 			d.date AS date,
 			$1 AS realm_id,
 			d.issuer_id AS issuer_id,
-			COALESCE(s.codes_issued, 0) AS codes_issued
+			COALESCE(SUM(s.codes_issued), 0) AS codes_issued
 		FROM (
 			SELECT
-				d.date AS date,
+				p.date AS date,
 				i.issuer_id AS issuer_id
-			FROM generate_series($2, $3, '1 day'::interval) d
+			FROM (
+				SELECT DISTINCT date_trunc($4, date)::date AS date
+				FROM generate_series($2, $3, '1 day'::interval) date
+			) p
 			CROSS JOIN (
 				SELECT DISTINCT(issuer_id)
 				FROM external_issuer_stats
 				WHERE realm_id = $1 AND date >= $2 AND date <= $3
 			) AS i
 		) d
-		LEFT JOIN external_issuer_stats s ON s.realm_id = $1 AND s.issuer_id = d.issuer_id AND s.date = d.date
+		LEFT JOIN external_issuer_stats s ON s.realm_id = $1 AND s.issuer_id = d.issuer_id
+			AND s.date >= $2 AND s.date <= $3 AND date_trunc($4, s.date::timestamp)::date = d.date
+		GROUP BY d.date, d.issuer_id
 		ORDER BY date DESC, issuer_id`
 
 	var stats []*ExternalIssuerStat
-	if err := db.db.Raw(sql, r.ID, start, stop).Scan(&stats).Error; err != nil {
+	if err := db.db.Raw(sql, r.ID, sr.Start, sr.Stop, string(sr.Granularity)).Scan(&stats).Error; err != nil {
 		if IsNotFound(err) {
 			return stats, nil
 		}
@@ -1521,8 +1958,8 @@ func (r *Realm) ExternalIssuerStats(db *Database) (ExternalIssuerStats, error) {
 	return stats, nil
 }
 
-// ExternalIssuerStatsCached is stats, but cached.
-func (r *Realm) ExternalIssuerStatsCached(ctx context.Context, db *Database, cacher cache.Cacher) (ExternalIssuerStats, error) {
+// ExternalIssuerStatsInRangeCached is ExternalIssuerStatsInRange, but cached.
+func (r *Realm) ExternalIssuerStatsInRangeCached(ctx context.Context, db *Database, cacher cache.Cacher, sr *StatsRange) (ExternalIssuerStats, error) {
 	if cacher == nil {
 		return nil, fmt.Errorf("cacher cannot be nil")
 	}
@@ -1530,10 +1967,10 @@ func (r *Realm) ExternalIssuerStatsCached(ctx context.Context, db *Database, cac
 	var stats ExternalIssuerStats
 	cacheKey := &cache.Key{
 		Namespace: "stats:realm:per_external_issuer",
-		Key:       strconv.FormatUint(uint64(r.ID), 10),
+		Key:       fmt.Sprintf("%d:%s", r.ID, sr.CacheKey()),
 	}
 	if err := cacher.Fetch(ctx, cacheKey, &stats, 30*time.Minute, func() (interface{}, error) {
-		return r.ExternalIssuerStats(db)
+		return r.ExternalIssuerStatsInRange(db, sr)
 	}); err != nil {
 		return nil, err
 	}
@@ -1542,16 +1979,25 @@ func (r *Realm) ExternalIssuerStatsCached(ctx context.Context, db *Database, cac
 
 // UserStats returns the 30-day stats by user.
 func (r *Realm) UserStats(db *Database) (RealmUserStats, error) {
-	stop := timeutils.Midnight(time.Now().UTC())
-	start := stop.Add(30 * -24 * time.Hour)
-	if start.After(stop) {
+	return r.UserStatsInRange(db, r.DefaultStatsRange())
+}
+
+// UserStatsCached is stats, but cached.
+func (r *Realm) UserStatsCached(ctx context.Context, db *Database, cacher cache.Cacher) (RealmUserStats, error) {
+	return r.UserStatsInRangeCached(ctx, db, cacher, r.DefaultStatsRange())
+}
+
+// UserStatsInRange returns the stats by user in the given range, grouped by
+// the range's granularity.
+func (r *Realm) UserStatsInRange(db *Database, sr *StatsRange) (RealmUserStats, error) {
+	if sr.Start.After(sr.Stop) {
 		return nil, ErrBadDateRange
 	}
 
-	// Pull the stats by generating the full date range and full list of users
-	// that generated data in that range, then join on stats. This will ensure we
-	// have a full list (with values of 0 where appropriate) to ensure continuity
-	// in graphs.
+	// Pull the stats by generating the full list of periods and full list of
+	// users that generated data in that range, then join on stats. This will
+	// ensure we have a full list (with values of 0 where appropriate) to ensure
+	// continuity in graphs.
 	sql := `
 		SELECT
 			d.date AS date,
@@ -1559,24 +2005,29 @@ func (r *Realm) UserStats(db *Database) (RealmUserStats, error) {
 			d.user_id AS user_id,
 			u.name AS name,
 			u.email AS email,
-			COALESCE(s.codes_issued, 0) AS codes_issued
+			COALESCE(SUM(s.codes_issued), 0) AS codes_issued
 		FROM (
 			SELECT
-				d.date AS date,
+				p.date AS date,
 				i.user_id AS user_id
-			FROM generate_series($2, $3, '1 day'::interval) d
+			FROM (
+				SELECT DISTINCT date_trunc($4, date)::date AS date
+				FROM generate_series($2, $3, '1 day'::interval) date
+			) p
 			CROSS JOIN (
 				SELECT DISTINCT(user_id)
 				FROM user_stats
 				WHERE realm_id = $1 AND date >= $2 AND date <= $3
 			) AS i
 		) d
-		LEFT JOIN user_stats s ON s.realm_id = $1 AND s.user_id = d.user_id AND s.date = d.date
+		LEFT JOIN user_stats s ON s.realm_id = $1 AND s.user_id = d.user_id
+			AND s.date >= $2 AND s.date <= $3 AND date_trunc($4, s.date::timestamp)::date = d.date
 		LEFT JOIN users u ON u.id = d.user_id
+		GROUP BY d.date, d.user_id, u.name, u.email
 		ORDER BY date DESC, u.name`
 
 	var stats []*RealmUserStat
-	if err := db.db.Raw(sql, r.ID, start, stop).Scan(&stats).Error; err != nil {
+	if err := db.db.Raw(sql, r.ID, sr.Start, sr.Stop, string(sr.Granularity)).Scan(&stats).Error; err != nil {
 		if IsNotFound(err) {
 			return stats, nil
 		}
@@ -1585,8 +2036,8 @@ func (r *Realm) UserStats(db *Database) (RealmUserStats, error) {
 	return stats, nil
 }
 
-// UserStatsCached is stats, but cached.
-func (r *Realm) UserStatsCached(ctx context.Context, db *Database, cacher cache.Cacher) (RealmUserStats, error) {
+// UserStatsInRangeCached is UserStatsInRange, but cached.
+func (r *Realm) UserStatsInRangeCached(ctx context.Context, db *Database, cacher cache.Cacher, sr *StatsRange) (RealmUserStats, error) {
 	if cacher == nil {
 		return nil, fmt.Errorf("cacher cannot be nil")
 	}
@@ -1594,16 +2045,117 @@ func (r *Realm) UserStatsCached(ctx context.Context, db *Database, cacher cache.
 	var stats RealmUserStats
 	cacheKey := &cache.Key{
 		Namespace: "stats:realm:per_user",
-		Key:       strconv.FormatUint(uint64(r.ID), 10),
+		Key:       fmt.Sprintf("%d:%s", r.ID, sr.CacheKey()),
 	}
 	if err := cacher.Fetch(ctx, cacheKey, &stats, 30*time.Minute, func() (interface{}, error) {
-		return r.UserStats(db)
+		return r.UserStatsInRange(db, sr)
 	}); err != nil {
 		return nil, err
 	}
 	return stats, nil
 }
 
+// Location returns the realm's timezone. If the timezone cannot be loaded, it
+// returns UTC.
+func (r *Realm) Location() *time.Location {
+	loc, err := time.LoadLocation(r.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// StatsDate returns the calendar day on which t falls in the realm's timezone,
+// as midnight UTC. This is the value stored in the date column of the stats
+// tables.
+func (r *Realm) StatsDate(t time.Time) time.Time {
+	return statsDate(t, r.Location())
+}
+
+// statsDate returns the calendar day on which t falls in loc, as midnight UTC.
+// The stats tables use date columns, and Postgres converts timestamps to dates
+// in the session timezone, so the day must be computed before it is sent.
+func statsDate(t time.Time, loc *time.Location) time.Time {
+	t = t.In(loc)
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// realmLocationCacheDuration is how long realm timezones are cached for
+// bucketing statistics.
+const realmLocationCacheDuration = time.Minute
+
+// realmLocationCache caches realm timezones for bucketing statistics. It is
+// shared by copies of the database.
+type realmLocationCache struct {
+	lock      sync.Mutex
+	locations map[uint]*cachedRealmLocation
+}
+
+// cachedRealmLocation is a realm timezone in the realm location cache.
+type cachedRealmLocation struct {
+	loc       *time.Location
+	expiresAt time.Time
+}
+
+// realmLocation returns the timezone of the realm with the given ID, or UTC if
+// the realm does not exist or has an invalid timezone. Timezones are cached
+// briefly, so issuing and claiming codes does not look up the realm each time.
+func (db *Database) realmLocation(realmID uint) *time.Location {
+	c := db.realmLocations
+	if c == nil {
+		return loadRealmLocation(db.db, realmID)
+	}
+
+	now := time.Now()
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if cached, ok := c.locations[realmID]; ok && now.Before(cached.expiresAt) {
+		return cached.loc
+	}
+
+	loc := loadRealmLocation(db.db, realmID)
+	if c.locations == nil {
+		c.locations = make(map[uint]*cachedRealmLocation)
+	}
+	c.locations[realmID] = &cachedRealmLocation{
+		loc:       loc,
+		expiresAt: now.Add(realmLocationCacheDuration),
+	}
+	return loc
+}
+
+// forgetRealmLocation removes the realm's timezone from the cache, so the next
+// lookup sees any change to it.
+func (db *Database) forgetRealmLocation(realmID uint) {
+	c := db.realmLocations
+	if c == nil {
+		return
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	delete(c.locations, realmID)
+}
+
+// loadRealmLocation returns the timezone of the realm with the given ID, or UTC
+// if the realm does not exist or has an invalid timezone.
+func loadRealmLocation(tx *gorm.DB, realmID uint) *time.Location {
+	var realm Realm
+	if err := tx.
+		Unscoped().
+		Model(&Realm{}).
+		Select("timezone").
+		Where("id = ?", realmID).
+		First(&realm).
+		Error; err != nil {
+		return time.UTC
+	}
+	return realm.Location()
+}
+
 // RenderWelcomeMessage message renders the realm's welcome message.
 func (r *Realm) RenderWelcomeMessage() string {
 	msg := project.TrimSpace(r.WelcomeMessage)
@@ -1628,7 +2180,7 @@ func (r *Realm) QuotaKey(hmacKey []byte) (string, error) {
 // IncrementDailyActiveUsers increments the daily active users for the realm by
 // the provided amount.
 func (r *Realm) IncrementDailyActiveUsers(db *Database, now time.Time) error {
-	date := timeutils.Midnight(now)
+	date := r.StatsDate(now)
 
 	sql := `
 		INSERT INTO realm_stats (date, realm_id, daily_active_users)
@@ -1643,6 +2195,24 @@ func (r *Realm) IncrementDailyActiveUsers(db *Database, now time.Time) error {
 	return nil
 }
 
+// IncrementSMSFailed increments the number of codes for which the SMS could
+// not be sent, on the day the code was issued.
+func (r *Realm) IncrementSMSFailed(db *Database, issuedAt time.Time) error {
+	date := r.StatsDate(issuedAt)
+
+	sql := `
+		INSERT INTO realm_stats (date, realm_id, sms_failed)
+			VALUES ($1, $2, 1)
+		ON CONFLICT (date, realm_id) DO UPDATE
+			SET sms_failed = realm_stats.sms_failed + 1
+	`
+
+	if err := db.db.Exec(sql, date, r.ID).Error; err != nil {
+		return fmt.Errorf("failed to increment sms failures for realm %d: %w", r.ID, err)
+	}
+	return nil
+}
+
 // ToCIDRList converts the newline-separated and/or comma-separated CIDR list
 // into an array of strings.
 func ToCIDRList(s string) ([]string, error) {
@@ -0,0 +1,439 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/google/exposure-notifications-verification-server/pkg/cache"
+	"github.com/jinzhu/gorm"
+	"github.com/lib/pq"
+)
+
+// MaxRealmDepth is the maximum number of levels in a realm hierarchy,
+// including the top-level realm.
+const MaxRealmDepth = 4
+
+// HasParent returns true if the realm is the child of another realm.
+func (r *Realm) HasParent() bool {
+	return r.ParentRealmID != 0
+}
+
+// Parent returns the parent realm, or nil if the realm has no parent.
+func (r *Realm) Parent(db *Database) (*Realm, error) {
+	if !r.HasParent() {
+		return nil, nil
+	}
+	return db.FindRealm(r.ParentRealmID)
+}
+
+// ListChildRealms returns the direct children of the realm, ordered by name.
+func (r *Realm) ListChildRealms(db *Database) ([]*Realm, error) {
+	var realms []*Realm
+	if err := db.db.
+		Model(&Realm{}).
+		Where("parent_realm_id = ?", r.ID).
+		Order("LOWER(name)").
+		Find(&realms).
+		Error; err != nil {
+		if IsNotFound(err) {
+			return realms, nil
+		}
+		return nil, err
+	}
+	return realms, nil
+}
+
+// DescendantRealmIDs returns the IDs of every realm below this realm in the
+// hierarchy. It does not include the realm itself.
+func (r *Realm) DescendantRealmIDs(db *Database) ([]uint, error) {
+	return descendantRealmIDs(db.db, r.ID)
+}
+
+// ListDescendantRealms returns every realm below this realm in the hierarchy,
+// ordered by name.
+func (r *Realm) ListDescendantRealms(db *Database) ([]*Realm, error) {
+	ids, err := r.DescendantRealmIDs(db)
+	if err != nil {
+		return nil, err
+	}
+
+	var realms []*Realm
+	if len(ids) == 0 {
+		return realms, nil
+	}
+
+	if err := db.db.
+		Model(&Realm{}).
+		Where("id IN (?)", ids).
+		Order("LOWER(name)").
+		Find(&realms).
+		Error; err != nil {
+		if IsNotFound(err) {
+			return realms, nil
+		}
+		return nil, err
+	}
+	return realms, nil
+}
+
+// FindDescendantRealm finds the realm with the given ID only if it is below
+// this realm in the hierarchy. It returns a not found error otherwise.
+func (r *Realm) FindDescendantRealm(db *Database, id interface{}) (*Realm, error) {
+	ids, err := r.DescendantRealmIDs(db)
+	if err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+
+	var realm Realm
+	if err := db.db.
+		Model(&Realm{}).
+		Where("id = ?", id).
+		Where("id IN (?)", ids).
+		First(&realm).
+		Error; err != nil {
+		return nil, err
+	}
+	return &realm, nil
+}
+
+// CertificateRealm returns the realm whose certificate signing settings and
+// keys this realm uses. This is the realm itself unless it inherits them from
+// its parent.
+func (r *Realm) CertificateRealm(db *Database) (*Realm, error) {
+	return r.inheritedFrom(db, func(realm *Realm) bool {
+		return realm.InheritParentCertificateKey
+	})
+}
+
+// inheritedFrom walks up the hierarchy while inherits returns true and
+// returns the first realm which does not inherit the setting.
+func (r *Realm) inheritedFrom(db *Database, inherits func(*Realm) bool) (*Realm, error) {
+	realm := r
+	for i := 0; i < MaxRealmDepth && realm.HasParent() && inherits(realm); i++ {
+		parent, err := realm.Parent(db)
+		if err != nil {
+			return nil, fmt.Errorf("failed to find parent realm %d: %w", realm.ParentRealmID, err)
+		}
+		realm = parent
+	}
+	return realm, nil
+}
+
+// RollupStats returns the 30-day usage statistics for this realm and every
+// realm below it, summed by date. If no stats exist, returns an empty array.
+func (r *Realm) RollupStats(db *Database) (RealmStats, error) {
+	ids, err := r.DescendantRealmIDs(db)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find child realms: %w", err)
+	}
+	ids = append(ids, r.ID)
+
+	return realmStats(db, r.ID, ids, r.DefaultStatsRange())
+}
+
+// RollupStatsCached is RollupStats, but cached.
+func (r *Realm) RollupStatsCached(ctx context.Context, db *Database, cacher cache.Cacher) (RealmStats, error) {
+	if cacher == nil {
+		return nil, fmt.Errorf("cacher cannot be nil")
+	}
+
+	var stats RealmStats
+	cacheKey := &cache.Key{
+		Namespace: "stats:realm:rollup",
+		Key:       strconv.FormatUint(uint64(r.ID), 10),
+	}
+	if err := cacher.Fetch(ctx, cacheKey, &stats, 30*time.Minute, func() (interface{}, error) {
+		return r.RollupStats(db)
+	}); err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// realmStats returns the stats for the given realms in the range, summed by
+// period and attributed to realmID. Each period is labeled with the date on
+// which it starts, even if that is before the start of the range. Daily active
+// users cannot be summed across days, so they are zero for periods longer than
+// a day.
+func realmStats(db *Database, realmID uint, realmIDs []uint, sr *StatsRange) (RealmStats, error) {
+	if sr.Start.After(sr.Stop) {
+		return nil, ErrBadDateRange
+	}
+
+	ids := make([]int64, 0, len(realmIDs))
+	for _, id := range realmIDs {
+		ids = append(ids, int64(id))
+	}
+
+	sql := `
+		SELECT
+			d.date AS date,
+			$1 AS realm_id,
+			COALESCE(SUM(s.codes_issued), 0) AS codes_issued,
+			COALESCE(SUM(s.codes_claimed), 0) AS codes_claimed,
+			CASE WHEN $5 = 'day' THEN COALESCE(SUM(s.daily_active_users), 0) ELSE 0 END AS daily_active_users,
+			COALESCE(SUM(s.tokens_claimed), 0) AS tokens_claimed,
+			COALESCE(SUM(s.sms_failed), 0) AS sms_failed,
+			COALESCE(SUM(s.code_claim_age_total_seconds), 0) AS code_claim_age_total_seconds,
+			(
+				SELECT array_agg(t.v ORDER BY t.i)
+				FROM (
+					SELECT u.i AS i, SUM(u.v) AS v
+					FROM realm_stats s2, unnest(s2.code_claim_age_distribution) WITH ORDINALITY AS u(v, i)
+					WHERE s2.realm_id = ANY($4) AND s2.date >= $2 AND s2.date <= $3
+						AND date_trunc($5, s2.date::timestamp)::date = d.date
+					GROUP BY u.i
+				) t
+			) AS code_claim_age_distribution
+		FROM (
+			SELECT DISTINCT date_trunc($5, date)::date AS date
+			FROM generate_series($2, $3, '1 day'::interval) date
+		) d
+		LEFT JOIN realm_stats s ON s.realm_id = ANY($4)
+			AND s.date >= $2 AND s.date <= $3 AND date_trunc($5, s.date::timestamp)::date = d.date
+		GROUP BY d.date
+		ORDER BY date DESC`
+
+	var stats []*RealmStat
+	if err := db.db.Raw(sql, realmID, sr.Start, sr.Stop, pq.Array(ids), string(sr.Granularity)).Scan(&stats).Error; err != nil {
+		if IsNotFound(err) {
+			return stats, nil
+		}
+		return nil, err
+	}
+	return stats, nil
+}
+
+// descendantRealmIDs returns the IDs of every realm below the given realm.
+func descendantRealmIDs(tx *gorm.DB, id uint) ([]uint, error) {
+	sql := `
+		WITH RECURSIVE tree AS (
+			SELECT id FROM realms WHERE parent_realm_id = $1 AND deleted_at IS NULL
+			UNION
+			SELECT r.id FROM realms r
+			INNER JOIN tree t ON r.parent_realm_id = t.id
+			WHERE r.deleted_at IS NULL
+		)
+		SELECT id FROM tree ORDER BY id`
+
+	return scanRealmIDs(tx, sql, id)
+}
+
+// ancestorRealmIDs returns the IDs of the given realm and every realm above it,
+// nearest first.
+func ancestorRealmIDs(tx *gorm.DB, id uint) ([]uint, error) {
+	sql := `
+		WITH RECURSIVE tree AS (
+			SELECT id, parent_realm_id, 0 AS depth FROM realms WHERE id = $1
+			UNION
+			SELECT r.id, r.parent_realm_id, t.depth + 1 FROM realms r
+			INNER JOIN tree t ON r.id = t.parent_realm_id
+			WHERE t.depth < $2
+		)
+		SELECT id FROM tree ORDER BY depth`
+
+	return scanRealmIDs(tx, sql, id, MaxRealmDepth+1)
+}
+
+// subtreeHeight returns the number of levels below the given realm.
+func subtreeHeight(tx *gorm.DB, id uint) (int, error) {
+	sql := `
+		WITH RECURSIVE tree AS (
+			SELECT id, 0 AS depth FROM realms WHERE id = $1
+			UNION
+			SELECT r.id, t.depth + 1 FROM realms r
+			INNER JOIN tree t ON r.parent_realm_id = t.id
+			WHERE r.deleted_at IS NULL AND t.depth < $2
+		)
+		SELECT COALESCE(MAX(depth), 0) FROM tree`
+
+	var height int
+	if err := tx.Raw(sql, id, MaxRealmDepth+1).Row().Scan(&height); err != nil {
+		return 0, err
+	}
+	return height, nil
+}
+
+func scanRealmIDs(tx *gorm.DB, sql string, args ...interface{}) ([]uint, error) {
+	rows, err := tx.Raw(sql, args...).Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []uint
+	for rows.Next() {
+		var id uint
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// validateRealmParent checks that the realm's parent exists, does not create a
+// cycle, and does not make the hierarchy too deep. Problems are added to the
+// realm's errors.
+func validateRealmParent(tx *gorm.DB, r *Realm) error {
+	if !r.HasParent() {
+		return nil
+	}
+
+	if r.ID != 0 && r.ParentRealmID == r.ID {
+		r.AddError("parentRealmID", "cannot be this realm")
+		return nil
+	}
+
+	ancestors, err := ancestorRealmIDs(tx, r.ParentRealmID)
+	if err != nil {
+		return fmt.Errorf("failed to find parent realms: %w", err)
+	}
+	if len(ancestors) == 0 {
+		r.AddError("parentRealmID", "does not exist")
+		return nil
+	}
+
+	for _, id := range ancestors {
+		if r.ID != 0 && id == r.ID {
+			r.AddError("parentRealmID", "cannot be a realm below this realm")
+			return nil
+		}
+	}
+
+	var height int
+	if r.ID != 0 {
+		if height, err = subtreeHeight(tx, r.ID); err != nil {
+			return fmt.Errorf("failed to find child realms: %w", err)
+		}
+	}
+	if len(ancestors)+1+height > MaxRealmDepth {
+		r.AddError("parentRealmID", fmt.Sprintf("would make the realm hierarchy more than %d levels deep", MaxRealmDepth))
+	}
+	return nil
+}
+
+// applyInheritedTestTypes copies the allowed test types from the realm's
+// parent if the realm inherits them.
+func applyInheritedTestTypes(tx *gorm.DB, r *Realm) error {
+	if !r.HasParent() || !r.InheritParentTestTypes {
+		return nil
+	}
+
+	var parent Realm
+	if err := tx.
+		Model(&Realm{}).
+		Select("allowed_test_types").
+		Where("id = ?", r.ParentRealmID).
+		First(&parent).
+		Error; err != nil {
+		if IsNotFound(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to find parent realm: %w", err)
+	}
+	r.AllowedTestTypes = parent.AllowedTestTypes
+	return nil
+}
+
+// propagateTestTypes copies the realm's allowed test types to the children
+// which inherit them, and their children in turn.
+func propagateTestTypes(tx *gorm.DB, r *Realm, actor Auditable) error {
+	var children []*Realm
+	if err := tx.
+		Model(&Realm{}).
+		Where("parent_realm_id = ?", r.ID).
+		Where("inherit_parent_test_types IS TRUE").
+		Find(&children).
+		Error; err != nil && !IsNotFound(err) {
+		return fmt.Errorf("failed to find child realms: %w", err)
+	}
+
+	for _, child := range children {
+		if child.AllowedTestTypes != r.AllowedTestTypes {
+			audit := BuildAuditEntry(actor, "updated allowed test types", child, child.ID)
+			audit.Diff = stringDiff(child.AllowedTestTypes.Display(), r.AllowedTestTypes.Display())
+			audit.AddChange("AllowedTestTypes", child.AllowedTestTypes, r.AllowedTestTypes)
+
+			child.AllowedTestTypes = r.AllowedTestTypes
+			if err := tx.Model(child).UpdateColumn("allowed_test_types", child.AllowedTestTypes).Error; err != nil {
+				return fmt.Errorf("failed to update child realm %d: %w", child.ID, err)
+			}
+			if err := tx.Save(audit).Error; err != nil {
+				return fmt.Errorf("failed to save audits: %w", err)
+			}
+		}
+
+		if err := propagateTestTypes(tx, child, actor); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RealmStatsTotals returns the 30-day codes issued and claimed for each of the
+// given realms, keyed by realm ID. Each realm's days are in its own timezone.
+// Realms without stats are omitted.
+func (db *Database) RealmStatsTotals(realms []*Realm) (map[uint]*RealmStat, error) {
+	ranges := make(map[uint]*StatsRange, len(realms))
+	ids := make([]int64, 0, len(realms))
+	for _, realm := range realms {
+		ranges[realm.ID] = realm.DefaultStatsRange()
+		ids = append(ids, int64(realm.ID))
+	}
+
+	// Every timezone is within a day of UTC, so this covers the range for all
+	// realms.
+	stop := statsDate(time.Now(), time.UTC).Add(24 * time.Hour)
+	start := stop.Add((DefaultStatsDays + 2) * -24 * time.Hour)
+
+	var stats []*RealmStat
+	if err := db.db.
+		Model(&RealmStat{}).
+		Select("date, realm_id, codes_issued, codes_claimed").
+		Where("realm_id = ANY(?)", pq.Array(ids)).
+		Where("date >= ? AND date <= ?", start, stop).
+		Find(&stats).
+		Error; err != nil && !IsNotFound(err) {
+		return nil, err
+	}
+
+	totals := make(map[uint]*RealmStat, len(realms))
+	for _, stat := range stats {
+		sr, ok := ranges[stat.RealmID]
+		if !ok || stat.Date.Before(sr.Start) || stat.Date.After(sr.Stop) {
+			continue
+		}
+
+		total, ok := totals[stat.RealmID]
+		if !ok {
+			total = &RealmStat{RealmID: stat.RealmID}
+			totals[stat.RealmID] = total
+		}
+		total.CodesIssued += stat.CodesIssued
+		total.CodesClaimed += stat.CodesClaimed
+	}
+	return totals, nil
+}
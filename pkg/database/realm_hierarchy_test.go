@@ -0,0 +1,284 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/google/exposure-notifications-server/pkg/timeutils"
+)
+
+func TestRealm_Hierarchy(t *testing.T) {
+	t.Parallel()
+
+	db, _ := testDatabaseInstance.NewDatabase(t, nil)
+
+	saveRealm := func(t *testing.T, name string, parent *Realm) *Realm {
+		t.Helper()
+
+		realm := NewRealmWithDefaults(name)
+		if parent != nil {
+			realm.ParentRealmID = parent.ID
+		}
+		if err := db.SaveRealm(realm, SystemTest); err != nil {
+			t.Fatalf("failed to save %s: %v: %v", name, err, realm.ErrorMessages())
+		}
+		return realm
+	}
+
+	state := saveRealm(t, "state", nil)
+	county := saveRealm(t, "county", state)
+	city := saveRealm(t, "city", county)
+	other := saveRealm(t, "other", nil)
+
+	t.Run("children", func(t *testing.T) {
+		t.Parallel()
+
+		children, err := state.ListChildRealms(db)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := len(children), 1; got != want {
+			t.Fatalf("expected %d children, got %d", want, got)
+		}
+		if got, want := children[0].ID, county.ID; got != want {
+			t.Errorf("expected child %d to be %d", got, want)
+		}
+
+		ids, err := state.DescendantRealmIDs(db)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+		if got, want := fmt.Sprint(ids), fmt.Sprint([]uint{county.ID, city.ID}); got != want {
+			t.Errorf("expected descendants %s to be %s", got, want)
+		}
+
+		if _, err := state.FindDescendantRealm(db, city.ID); err != nil {
+			t.Errorf("expected city to be a descendant: %v", err)
+		}
+		if _, err := state.FindDescendantRealm(db, other.ID); !IsNotFound(err) {
+			t.Errorf("expected other not to be a descendant, got %v", err)
+		}
+		if _, err := city.FindDescendantRealm(db, state.ID); !IsNotFound(err) {
+			t.Errorf("expected state not to be a descendant, got %v", err)
+		}
+	})
+
+	t.Run("cycles", func(t *testing.T) {
+		t.Parallel()
+
+		realm, err := db.FindRealm(state.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		realm.ParentRealmID = realm.ID
+		if err := db.SaveRealm(realm, SystemTest); !IsValidationError(err) {
+			t.Errorf("expected validation error, got %v", err)
+		}
+
+		realm, err = db.FindRealm(state.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		realm.ParentRealmID = city.ID
+		if err := db.SaveRealm(realm, SystemTest); !IsValidationError(err) {
+			t.Errorf("expected validation error, got %v", err)
+		}
+		if len(realm.ErrorsFor("parentRealmID")) == 0 {
+			t.Errorf("expected errors for parentRealmID")
+		}
+	})
+
+	t.Run("depth", func(t *testing.T) {
+		t.Parallel()
+
+		town := saveRealm(t, "town", city)
+
+		realm := NewRealmWithDefaults("village")
+		realm.ParentRealmID = town.ID
+		if err := db.SaveRealm(realm, SystemTest); !IsValidationError(err) {
+			t.Errorf("expected validation error, got %v", err)
+		}
+	})
+}
+
+func TestRealm_InheritParentTestTypes(t *testing.T) {
+	t.Parallel()
+
+	db, _ := testDatabaseInstance.NewDatabase(t, nil)
+
+	parent := NewRealmWithDefaults("parent")
+	parent.AllowedTestTypes = TestTypeConfirmed
+	if err := db.SaveRealm(parent, SystemTest); err != nil {
+		t.Fatal(err)
+	}
+
+	child := NewRealmWithDefaults("child")
+	child.ParentRealmID = parent.ID
+	child.InheritParentTestTypes = true
+	child.AllowedTestTypes = TestTypeConfirmed | TestTypeLikely | TestTypeNegative
+	if err := db.SaveRealm(child, SystemTest); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := child.AllowedTestTypes, TestTypeConfirmed; got != want {
+		t.Errorf("expected %s to be %s", got.Display(), want.Display())
+	}
+
+	grandchild := NewRealmWithDefaults("grandchild")
+	grandchild.ParentRealmID = child.ID
+	grandchild.InheritParentTestTypes = true
+	if err := db.SaveRealm(grandchild, SystemTest); err != nil {
+		t.Fatal(err)
+	}
+
+	// Changes to the parent are propagated down the hierarchy.
+	parent.AllowedTestTypes = TestTypeConfirmed | TestTypeLikely
+	if err := db.SaveRealm(parent, SystemTest); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, id := range []uint{child.ID, grandchild.ID} {
+		realm, err := db.FindRealm(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := realm.AllowedTestTypes, parent.AllowedTestTypes; got != want {
+			t.Errorf("expected realm %d test types %s to be %s", id, got.Display(), want.Display())
+		}
+	}
+
+	// Inheritance requires a parent.
+	orphan := NewRealmWithDefaults("orphan")
+	orphan.InheritParentTestTypes = true
+	if err := db.SaveRealm(orphan, SystemTest); !IsValidationError(err) {
+		t.Errorf("expected validation error, got %v", err)
+	}
+}
+
+func TestRealm_RollupStats(t *testing.T) {
+	t.Parallel()
+
+	db, _ := testDatabaseInstance.NewDatabase(t, nil)
+
+	parent := NewRealmWithDefaults("parent")
+	if err := db.SaveRealm(parent, SystemTest); err != nil {
+		t.Fatal(err)
+	}
+
+	child := NewRealmWithDefaults("child")
+	child.ParentRealmID = parent.ID
+	if err := db.SaveRealm(child, SystemTest); err != nil {
+		t.Fatal(err)
+	}
+
+	date := timeutils.Midnight(time.Now().UTC()).Add(-24 * time.Hour)
+	for _, stat := range []*RealmStat{
+		{
+			Date: date, RealmID: parent.ID, CodesIssued: 10, CodesClaimed: 5, TokensClaimed: 4,
+			CodeClaimAgeDistribution: []int32{3, 2, 0, 0, 0, 0, 0, 0, 0, 0, 0},
+		},
+		{
+			Date: date, RealmID: child.ID, CodesIssued: 3, CodesClaimed: 1, TokensClaimed: 1,
+			CodeClaimAgeDistribution: []int32{0, 0, 1, 0, 0, 0, 0, 0, 0, 0, 0},
+		},
+	} {
+		if err := db.RawDB().Create(stat).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stats, err := parent.RollupStats(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var found bool
+	for _, stat := range stats {
+		if !stat.Date.Equal(date) {
+			continue
+		}
+		found = true
+
+		if got, want := stat.RealmID, parent.ID; got != want {
+			t.Errorf("expected realm %d to be %d", got, want)
+		}
+		if got, want := stat.CodesIssued, uint(13); got != want {
+			t.Errorf("expected codes issued %d to be %d", got, want)
+		}
+		if got, want := stat.CodesClaimed, uint(6); got != want {
+			t.Errorf("expected codes claimed %d to be %d", got, want)
+		}
+		if got, want := stat.TokensClaimed, uint(5); got != want {
+			t.Errorf("expected tokens claimed %d to be %d", got, want)
+		}
+		if got, want := fmt.Sprint(stat.CodeClaimAgeDistribution), fmt.Sprint([]int32{3, 2, 1, 0, 0, 0, 0, 0, 0, 0, 0}); got != want {
+			t.Errorf("expected claim age distribution %s to be %s", got, want)
+		}
+	}
+	if !found {
+		t.Errorf("expected stats for %s", date)
+	}
+}
+
+func TestDatabase_RealmStatsTotals(t *testing.T) {
+	t.Parallel()
+
+	db, _ := testDatabaseInstance.NewDatabase(t, nil)
+
+	utc := NewRealmWithDefaults("utc")
+	if err := db.SaveRealm(utc, SystemTest); err != nil {
+		t.Fatal(err)
+	}
+
+	tokyo := NewRealmWithDefaults("tokyo")
+	tokyo.Timezone = "Asia/Tokyo"
+	if err := db.SaveRealm(tokyo, SystemTest); err != nil {
+		t.Fatal(err)
+	}
+
+	// Tokyo's current day may already be tomorrow in UTC.
+	now := time.Now()
+	tooOld := tokyo.StatsDate(now).Add((DefaultStatsDays + 1) * -24 * time.Hour)
+	for _, stat := range []*RealmStat{
+		{Date: utc.StatsDate(now), RealmID: utc.ID, CodesIssued: 5, CodesClaimed: 2},
+		{Date: tokyo.StatsDate(now), RealmID: tokyo.ID, CodesIssued: 7, CodesClaimed: 3},
+		{Date: tooOld, RealmID: tokyo.ID, CodesIssued: 100, CodesClaimed: 100},
+	} {
+		if err := db.RawDB().Create(stat).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	totals, err := db.RealmStatsTotals([]*Realm{utc, tokyo})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := totals[utc.ID].CodesIssued, uint(5); got != want {
+		t.Errorf("expected utc codes issued %d to be %d", got, want)
+	}
+	if got, want := totals[tokyo.ID].CodesIssued, uint(7); got != want {
+		t.Errorf("expected tokyo codes issued %d to be %d", got, want)
+	}
+	if got, want := totals[tokyo.ID].CodesClaimed, uint(3); got != want {
+		t.Errorf("expected tokyo codes claimed %d to be %d", got, want)
+	}
+}
@@ -0,0 +1,225 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/google/exposure-notifications-verification-server/pkg/pagination"
+	"github.com/jinzhu/gorm"
+)
+
+// revertableRealmFields are the realm fields which can be restored from the
+// settings history. Fields which are managed by system admins, which need side
+// effects when they change (e.g. enabling ENX or abuse prevention), or which
+// change the realm's lifecycle or hierarchy are excluded.
+var revertableRealmFields = map[string]struct{}{
+	"Name":                               {},
+	"RegionCode":                         {},
+	"WelcomeMessage":                     {},
+	"Timezone":                           {},
+	"CodeLength":                         {},
+	"CodeDuration":                       {},
+	"LongCodeLength":                     {},
+	"LongCodeDuration":                   {},
+	"SMSTextTemplate":                    {},
+	"SMSCountry":                         {},
+	"UseSystemSMSConfig":                 {},
+	"EmailInviteTemplate":                {},
+	"EmailPasswordResetTemplate":         {},
+	"EmailVerifyTemplate":                {},
+	"UseSystemEmailConfig":               {},
+	"MFAMode":                            {},
+	"MFARequiredGracePeriod":             {},
+	"EmailVerifiedMode":                  {},
+	"PasswordRotationPeriodDays":         {},
+	"PasswordRotationWarningDays":        {},
+	"AllowedCIDRsAdminAPI":               {},
+	"AllowedCIDRsAPIServer":              {},
+	"AllowedCIDRsServer":                 {},
+	"AllowedTestTypes":                   {},
+	"RequireDate":                        {},
+	"CertificateIssuer":                  {},
+	"CertificateAudience":                {},
+	"CertificateDuration":                {},
+	"CertificateKeyRotationPeriodDays":   {},
+	"CertificateKeyRotationOverlapHours": {},
+	"AbusePreventionLimitFactor":         {},
+	"PublicStatsEnabled":                 {},
+	"PublicStatsMinCount":                {},
+	"PublicStatsEpsilon":                 {},
+	"VerificationCodeRetentionDays":      {},
+	"AuditEntryRetentionDays":            {},
+	"AccessEntryRetentionDays":           {},
+	"AccessAuditLevel":                   {},
+}
+
+// enxRealmFields are the revertable realm fields which are managed by EN Express
+// while it is enabled, and so cannot be changed by realm admins.
+var enxRealmFields = map[string]struct{}{
+	"CodeLength":       {},
+	"CodeDuration":     {},
+	"LongCodeLength":   {},
+	"LongCodeDuration": {},
+}
+
+// IsRevertableRealmField returns true if the realm field can be restored from
+// the settings history.
+func IsRevertableRealmField(field string) bool {
+	_, ok := revertableRealmFields[field]
+	return ok
+}
+
+// RealmSettingsRevert is the result of reverting a realm's settings.
+type RealmSettingsRevert struct {
+	// Reverted are the fields which were restored. Skipped are the fields which
+	// changed after the version, but cannot be restored from the history.
+	Reverted []string
+	Skipped  []string
+}
+
+// withAuditChanges returns a scope which restricts audit entries to those with
+// structured changes.
+func withAuditChanges() Scope {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("audit_entries.changes IS NOT NULL")
+	}
+}
+
+// ListSettingsHistory returns the realm's audited settings changes which have
+// structured changes, newest first. Each entry is a version of the realm's
+// settings to which it can be reverted.
+func (r *Realm) ListSettingsHistory(db *Database, p *pagination.PageParams) ([]*AuditEntry, *pagination.Paginator, error) {
+	return r.ListAudits(db, p, WithAuditTargetID(r.AuditID()), withAuditChanges())
+}
+
+// RevertRealmSettings restores the realm's settings to their state immediately
+// after the audit entry with the given ID, by undoing every later structured
+// change to the realm, newest first. Only revertable fields are restored.
+//
+// Code settings are skipped while EN Express is enabled, as they are when the
+// settings are modified. If validate is not nil, it is called with the restored
+// settings to apply validation which depends on the server configuration.
+//
+// The restored settings are saved like any other change in the same
+// transaction as the audit entry for the revert, so they are validated and
+// audited and can themselves be reverted. If validation fails, the errors are
+// on the realm.
+func (db *Database) RevertRealmSettings(r *Realm, entryID uint, actor Auditable, validate func(r *Realm)) (*RealmSettingsRevert, error) {
+	if r == nil {
+		return nil, fmt.Errorf("provided realm is nil")
+	}
+
+	if actor == nil {
+		return nil, fmt.Errorf("auditing actor is nil")
+	}
+
+	var version AuditEntry
+	if err := db.db.
+		Model(&AuditEntry{}).
+		Scopes(WithAuditRealmID(r.ID), WithAuditTargetID(r.AuditID()), withAuditChanges()).
+		Where("audit_entries.id = ?", entryID).
+		First(&version).
+		Error; err != nil {
+		return nil, err
+	}
+
+	var later []*AuditEntry
+	if err := db.db.
+		Model(&AuditEntry{}).
+		Scopes(WithAuditRealmID(r.ID), WithAuditTargetID(r.AuditID()), withAuditChanges()).
+		Where("audit_entries.chain_sequence > ?", version.ChainSequence).
+		Order("audit_entries.chain_sequence DESC").
+		Find(&later).
+		Error; err != nil && !IsNotFound(err) {
+		return nil, fmt.Errorf("failed to list later settings changes: %w", err)
+	}
+
+	reverted := make(map[string]struct{})
+	skipped := make(map[string]struct{})
+
+	rv := reflect.ValueOf(r).Elem()
+	for _, entry := range later {
+		for _, change := range entry.Changes {
+			if !IsRevertableRealmField(change.Field) {
+				skipped[change.Field] = struct{}{}
+				continue
+			}
+			if _, ok := enxRealmFields[change.Field]; ok && r.EnableENExpress {
+				skipped[change.Field] = struct{}{}
+				continue
+			}
+
+			f := rv.FieldByName(change.Field)
+			if !f.IsValid() || !f.CanSet() {
+				skipped[change.Field] = struct{}{}
+				continue
+			}
+
+			// Decode into a new value, so a failed decode leaves the field as-is.
+			v := reflect.New(f.Type())
+			if err := json.Unmarshal(change.Old, v.Interface()); err != nil {
+				return nil, fmt.Errorf("failed to decode %s from audit entry %d: %w", change.Field, entry.ID, err)
+			}
+			f.Set(v.Elem())
+			reverted[change.Field] = struct{}{}
+		}
+	}
+
+	result := &RealmSettingsRevert{
+		Reverted: sortedKeys(reverted),
+		Skipped:  sortedKeys(skipped),
+	}
+	if len(result.Reverted) == 0 {
+		return result, nil
+	}
+
+	if validate != nil {
+		validate(r)
+		if err := r.ErrorOrNil(); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := db.db.Transaction(func(tx *gorm.DB) error {
+		if err := saveRealm(tx, r, actor); err != nil {
+			return err
+		}
+
+		audit := BuildAuditEntry(actor, "reverted realm settings", r, r.ID)
+		audit.Diff = fmt.Sprintf("reverted to version %d\n", version.ID)
+		if err := tx.Save(audit).Error; err != nil {
+			return fmt.Errorf("failed to save audit: %w", err)
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	db.forgetRealmLocation(r.ID)
+
+	return result, nil
+}
+
+func sortedKeys(m map[string]struct{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
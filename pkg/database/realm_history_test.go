@@ -0,0 +1,182 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDatabase_RevertRealmSettings(t *testing.T) {
+	t.Parallel()
+
+	db, _ := testDatabaseInstance.NewDatabase(t, nil)
+
+	realm := NewRealmWithDefaults("history")
+	realm.CodeLength = 8
+	if err := db.SaveRealm(realm, SystemTest); err != nil {
+		t.Fatal(err)
+	}
+
+	// Version 1.
+	realm.CodeLength = 7
+	realm.Timezone = "America/Chicago"
+	if err := db.SaveRealm(realm, SystemTest); err != nil {
+		t.Fatal(err)
+	}
+
+	versions, _, err := realm.ListSettingsHistory(db, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) == 0 {
+		t.Fatal("expected settings history")
+	}
+	version := versions[0]
+	numVersions := len(versions)
+
+	// Later changes, one of which cannot be reverted.
+	realm.CodeLength = 6
+	realm.WelcomeMessage = "hello"
+	realm.AbusePreventionEnabled = true
+	if err := db.SaveRealm(realm, SystemTest); err != nil {
+		t.Fatal(err)
+	}
+	realm.WelcomeMessage = "goodbye"
+	if err := db.SaveRealm(realm, SystemTest); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := db.RevertRealmSettings(realm, version.ID, SystemTest, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{"CodeLength", "WelcomeMessage"}, result.Reverted); diff != "" {
+		t.Errorf("reverted mismatch (-want, +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{"AbusePreventionEnabled"}, result.Skipped); diff != "" {
+		t.Errorf("skipped mismatch (-want, +got):\n%s", diff)
+	}
+
+	got, err := db.FindRealm(realm.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := got.CodeLength, uint(7); got != want {
+		t.Errorf("expected code length %d to be %d", got, want)
+	}
+	if got, want := got.WelcomeMessage, ""; got != want {
+		t.Errorf("expected welcome message %q to be %q", got, want)
+	}
+	if got, want := got.Timezone, "America/Chicago"; got != want {
+		t.Errorf("expected timezone %q to be %q", got, want)
+	}
+	if !got.AbusePreventionEnabled {
+		t.Errorf("expected abuse prevention to remain enabled")
+	}
+
+	// The revert is itself recorded as versions, one per reverted field, after
+	// the 4 later changes.
+	versions, _, err = realm.ListSettingsHistory(db, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(versions), numVersions+4+2; got != want {
+		t.Errorf("expected %d versions to be %d", got, want)
+	}
+
+	// Unknown versions are not found.
+	if _, err := db.RevertRealmSettings(realm, 0, SystemTest, nil); !IsNotFound(err) {
+		t.Errorf("expected not found, got %v", err)
+	}
+
+	// Validation failures do not save the realm.
+	realm.WelcomeMessage = "again"
+	if err := db.SaveRealm(realm, SystemTest); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.RevertRealmSettings(realm, version.ID, SystemTest, func(r *Realm) {
+		r.AddError("welcomeMessage", "is invalid")
+	}); !IsValidationError(err) {
+		t.Errorf("expected validation error, got %v", err)
+	}
+	got, err = db.FindRealm(realm.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := got.WelcomeMessage, "again"; got != want {
+		t.Errorf("expected welcome message %q to be %q", got, want)
+	}
+}
+
+func TestDatabase_RevertRealmSettings_ENExpress(t *testing.T) {
+	t.Parallel()
+
+	db, _ := testDatabaseInstance.NewDatabase(t, nil)
+
+	realm := NewRealmWithDefaults("enx")
+	realm.RegionCode = "US-WA"
+	realm.EnableENExpress = true
+	realm.SMSTextTemplate = "Your Exposure Notifications verification link: [enslink] Expires in [longexpires] hours (click for mobile device only)"
+	realm.AllowedTestTypes = TestTypeConfirmed
+	if err := db.SaveRealm(realm, SystemTest); err != nil {
+		t.Fatal(err)
+	}
+
+	// Version 1.
+	realm.WelcomeMessage = "hello"
+	if err := db.SaveRealm(realm, SystemTest); err != nil {
+		t.Fatal(err)
+	}
+
+	versions, _, err := realm.ListSettingsHistory(db, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) == 0 {
+		t.Fatal("expected settings history")
+	}
+	version := versions[0]
+
+	// Code settings are managed by EN Express, so they cannot be reverted.
+	realm.CodeLength = 7
+	realm.WelcomeMessage = "goodbye"
+	if err := db.SaveRealm(realm, SystemTest); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := db.RevertRealmSettings(realm, version.ID, SystemTest, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{"WelcomeMessage"}, result.Reverted); diff != "" {
+		t.Errorf("reverted mismatch (-want, +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{"CodeLength"}, result.Skipped); diff != "" {
+		t.Errorf("skipped mismatch (-want, +got):\n%s", diff)
+	}
+
+	got, err := db.FindRealm(realm.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := got.CodeLength, uint(7); got != want {
+		t.Errorf("expected code length %d to be %d", got, want)
+	}
+	if got, want := got.WelcomeMessage, "hello"; got != want {
+		t.Errorf("expected welcome message %q to be %q", got, want)
+	}
+}
@@ -0,0 +1,214 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jinzhu/gorm"
+)
+
+// RealmState is the lifecycle state of a realm. Realms move from active to
+// disabled to archived, and archived realms can be purged.
+type RealmState int16
+
+const (
+	// RealmStateActive is the default state.
+	RealmStateActive RealmState = iota
+
+	// RealmStateDisabled blocks all API keys and logins to the realm. Data is
+	// unchanged and the realm can be enabled again.
+	RealmStateDisabled
+
+	// RealmStateArchived blocks all API keys and logins, and the realm's settings
+	// can no longer be changed. Statistics and audit history are kept until the
+	// realm is purged.
+	RealmStateArchived
+)
+
+// Display prints the name of the state.
+func (s RealmState) Display() string {
+	switch s {
+	case RealmStateActive:
+		return "active"
+	case RealmStateDisabled:
+		return "disabled"
+	case RealmStateArchived:
+		return "archived"
+	default:
+		return "unknown"
+	}
+}
+
+// ParseRealmState parses the display name of a state.
+func ParseRealmState(s string) (RealmState, error) {
+	for _, state := range []RealmState{RealmStateActive, RealmStateDisabled, RealmStateArchived} {
+		if state.Display() == s {
+			return state, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown realm state %q", s)
+}
+
+// realmStateTransitions are the allowed lifecycle transitions. Realms must be
+// disabled before they are archived, and archived realms are restored to
+// disabled.
+var realmStateTransitions = map[RealmState][]RealmState{
+	RealmStateActive:   {RealmStateDisabled},
+	RealmStateDisabled: {RealmStateActive, RealmStateArchived},
+	RealmStateArchived: {RealmStateDisabled},
+}
+
+// IsActive returns true if the realm accepts API requests and logins.
+func (r *Realm) IsActive() bool {
+	return r.State == RealmStateActive
+}
+
+// IsArchived returns true if the realm is archived and read-only.
+func (r *Realm) IsArchived() bool {
+	return r.State == RealmStateArchived
+}
+
+// TransitionTo changes the realm's state, returning an error if the transition
+// is not allowed. It does NOT save the realm to the database.
+func (r *Realm) TransitionTo(state RealmState) error {
+	for _, allowed := range realmStateTransitions[r.State] {
+		if allowed == state {
+			r.State = state
+			return nil
+		}
+	}
+	return fmt.Errorf("cannot change realm from %s to %s", r.State.Display(), state.Display())
+}
+
+// realmPurgeTables are the tables deleted when a realm is purged, in order.
+// Certificate transparency log entries are intentionally absent: the log is
+// append-only and its entries contain only HMACs.
+var realmPurgeTables = []struct {
+	table string
+	where string
+}{
+	{"verification_codes", "realm_id = ?"},
+	{"tokens", "realm_id = ?"},
+	{"mobile_apps", "realm_id = ?"},
+	{"authorized_app_stats", "authorized_app_id IN (SELECT id FROM authorized_apps WHERE realm_id = ?)"},
+	{"authorized_apps", "realm_id = ?"},
+	{"memberships", "realm_id = ?"},
+	{"user_stats", "realm_id = ?"},
+	{"realm_stats", "realm_id = ?"},
+	{"external_issuer_stats", "realm_id = ?"},
+	{"site_stats", "realm_id = ?"},
+	{"sites", "realm_id = ?"},
+	{"stats_report_schedules", "realm_id = ?"},
+	{"sms_configs", "realm_id = ? AND is_system IS FALSE"},
+	{"email_configs", "realm_id = ? AND is_system IS FALSE"},
+	{"signing_keys", "realm_id = ?"},
+	{"audit_entries", "realm_id = ?"},
+	{"audit_checkpoints", "realm_id = ?"},
+	{"audit_chain_heads", "realm_id = ?"},
+	{"audit_sink_cursors", "realm_id = ?"},
+	{"access_entries", "realm_id = ?"},
+}
+
+// PurgeRealm permanently deletes an archived realm and everything which belongs
+// to it: codes, tokens, mobile apps, API keys, sites, memberships, statistics,
+// report schedules, SMS and email configs, signing keys, audit entries and their
+// hash chain, and access entries. The realm's signing key versions are
+// destroyed in the key manager once the realm is locked and confirmed to be
+// archived, and before any rows are deleted, so a failure can be retried. A
+// final system-level audit entry records the purge. It returns the number of
+// rows deleted from each table.
+func (db *Database) PurgeRealm(ctx context.Context, r *Realm, actor Auditable) (map[string]int64, error) {
+	if r == nil {
+		return nil, fmt.Errorf("provided realm is nil")
+	}
+
+	if actor == nil {
+		return nil, fmt.Errorf("auditing actor is nil")
+	}
+
+	if !r.IsArchived() {
+		return nil, fmt.Errorf("realm must be archived before it is purged")
+	}
+
+	counts := make(map[string]int64, len(realmPurgeTables)+1)
+	if err := db.db.Transaction(func(tx *gorm.DB) error {
+		// Lock the realm and ensure it was not restored concurrently.
+		var existing Realm
+		if err := tx.
+			Set("gorm:query_option", "FOR UPDATE").
+			Model(&Realm{}).
+			Where("id = ?", r.ID).
+			First(&existing).
+			Error; err != nil {
+			return fmt.Errorf("failed to load realm: %w", err)
+		}
+		if !existing.IsArchived() {
+			return fmt.Errorf("realm must be archived before it is purged")
+		}
+
+		// Destroy key versions before deleting their records. Destroying a
+		// version which does not exist is not an error, so this is safe to
+		// repeat if the purge fails.
+		var signingKeys []*SigningKey
+		if err := tx.
+			Unscoped().
+			Model(&SigningKey{}).
+			Where("realm_id = ?", r.ID).
+			Find(&signingKeys).
+			Error; err != nil && !IsNotFound(err) {
+			return fmt.Errorf("failed to list signing keys: %w", err)
+		}
+		if len(signingKeys) > 0 {
+			manager := db.signingKeyManager
+			if manager == nil {
+				return ErrNoSigningKeyManager
+			}
+
+			for _, key := range signingKeys {
+				if err := manager.DestroyKeyVersion(ctx, key.KeyID); err != nil {
+					return fmt.Errorf("failed to destroy signing key %s: %w", key.GetKID(), err)
+				}
+			}
+		}
+
+		for _, t := range realmPurgeTables {
+			result := tx.Exec(fmt.Sprintf("DELETE FROM %s WHERE %s", t.table, t.where), r.ID)
+			if err := result.Error; err != nil {
+				return fmt.Errorf("failed to delete %s: %w", t.table, err)
+			}
+			counts[t.table] = result.RowsAffected
+		}
+
+		result := tx.Exec("DELETE FROM realms WHERE id = ?", r.ID)
+		if err := result.Error; err != nil {
+			return fmt.Errorf("failed to delete realm: %w", err)
+		}
+		counts["realms"] = result.RowsAffected
+
+		// The realm's own audit entries are gone, so record the purge at the
+		// system level.
+		audit := BuildAuditEntry(actor, "purged realm", r, 0)
+		if err := tx.Save(audit).Error; err != nil {
+			return fmt.Errorf("failed to save audits: %w", err)
+		}
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("failed to purge realm: %w", err)
+	}
+
+	return counts, nil
+}
@@ -0,0 +1,182 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/exposure-notifications-verification-server/internal/project"
+	"github.com/google/exposure-notifications-verification-server/pkg/keyutils"
+)
+
+func TestRealm_TransitionTo(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name string
+		from RealmState
+		to   RealmState
+		err  bool
+	}{
+		{"active_disabled", RealmStateActive, RealmStateDisabled, false},
+		{"active_archived", RealmStateActive, RealmStateArchived, true},
+		{"disabled_active", RealmStateDisabled, RealmStateActive, false},
+		{"disabled_archived", RealmStateDisabled, RealmStateArchived, false},
+		{"archived_disabled", RealmStateArchived, RealmStateDisabled, false},
+		{"archived_active", RealmStateArchived, RealmStateActive, true},
+		{"active_active", RealmStateActive, RealmStateActive, true},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			realm := &Realm{State: tc.from}
+			err := realm.TransitionTo(tc.to)
+			if (err != nil) != tc.err {
+				t.Fatalf("expected error to be %t, got %v", tc.err, err)
+			}
+
+			want := tc.to
+			if tc.err {
+				want = tc.from
+			}
+			if got := realm.State; got != want {
+				t.Errorf("expected %s to be %s", got.Display(), want.Display())
+			}
+		})
+	}
+}
+
+func TestParseRealmState(t *testing.T) {
+	t.Parallel()
+
+	for _, state := range []RealmState{RealmStateActive, RealmStateDisabled, RealmStateArchived} {
+		got, err := ParseRealmState(state.Display())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != state {
+			t.Errorf("expected %s to be %s", got.Display(), state.Display())
+		}
+	}
+
+	if _, err := ParseRealmState("banana"); err == nil {
+		t.Errorf("expected error")
+	}
+}
+
+func TestDatabase_PurgeRealm(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	db, _ := testDatabaseInstance.NewDatabase(t, nil)
+	db.config.CertificateSigningKeyRing = filepath.Join(project.Root(), "local", "test", "realm")
+
+	realm := NewRealmWithDefaults("purge")
+	if err := db.SaveRealm(realm, SystemTest); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := realm.CreateSigningKeyVersion(ctx, db, keyutils.AlgorithmES256); err != nil {
+		t.Fatal(err)
+	}
+	signingKeys, err := realm.ListSigningKeys(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(signingKeys), 1; got != want {
+		t.Fatalf("expected %d signing keys, got %d", want, got)
+	}
+	keyID := signingKeys[0].KeyID
+	manager := db.KeyManager()
+
+	if _, err := realm.CreateAuthorizedApp(db, &AuthorizedApp{
+		Name:       "Purged app",
+		APIKeyType: APIKeyTypeAdmin,
+	}, SystemTest); err != nil {
+		t.Fatal(err)
+	}
+
+	// Active realms cannot be purged.
+	if _, err := db.PurgeRealm(ctx, realm, SystemTest); err == nil {
+		t.Fatal("expected error purging active realm")
+	}
+
+	// A stale copy which is archived in memory cannot purge the realm, and does
+	// not destroy its signing keys.
+	stale := *realm
+	stale.State = RealmStateArchived
+	if _, err := db.PurgeRealm(ctx, &stale, SystemTest); err == nil {
+		t.Fatal("expected error purging realm which is not archived")
+	}
+	if _, err := manager.NewSigner(ctx, keyID); err != nil {
+		t.Errorf("expected signing key to still exist: %v", err)
+	}
+
+	for _, state := range []RealmState{RealmStateDisabled, RealmStateArchived} {
+		if err := realm.TransitionTo(state); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.SaveRealm(realm, SystemTest); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Archived realms are read-only.
+	realm.Name = "renamed"
+	if err := db.SaveRealm(realm, SystemTest); !errors.Is(err, ErrRealmArchived) {
+		t.Errorf("expected %v to be %v", err, ErrRealmArchived)
+	}
+	realm.Name = "purge"
+
+	counts, err := db.PurgeRealm(ctx, realm, SystemTest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := manager.NewSigner(ctx, keyID); err == nil {
+		t.Errorf("expected signing key to be destroyed")
+	}
+	if got, want := counts["authorized_apps"], int64(1); got != want {
+		t.Errorf("expected %d authorized apps to be deleted, got %d", want, got)
+	}
+	if got, want := counts["realms"], int64(1); got != want {
+		t.Errorf("expected %d realms to be deleted, got %d", want, got)
+	}
+
+	if _, err := db.FindRealm(realm.ID); !IsNotFound(err) {
+		t.Errorf("expected realm to be deleted, got %v", err)
+	}
+
+	// The purge is recorded at the system level.
+	audits, _, err := db.ListAudits(nil, WithAuditRealmID(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var found bool
+	for _, audit := range audits {
+		if audit.Action == "purged realm" && audit.TargetID == realm.AuditID() {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("expected system audit entry for purge")
+	}
+}
@@ -19,12 +19,15 @@ import (
 	"encoding/csv"
 	"encoding/json"
 	"fmt"
+	"math"
 	"sort"
 	"strconv"
 	"time"
 
 	"github.com/google/exposure-notifications-verification-server/internal/icsv"
 	"github.com/google/exposure-notifications-verification-server/internal/project"
+	"github.com/jinzhu/gorm"
+	"github.com/lib/pq"
 )
 
 var _ icsv.Marshaler = (RealmStats)(nil)
@@ -32,6 +35,22 @@ var _ icsv.Marshaler = (RealmStats)(nil)
 // RealmStats represents a logical collection of stats of a realm.
 type RealmStats []*RealmStat
 
+// CodeClaimAgeBuckets are the upper bounds of the buckets used to record how
+// long after issuance codes are claimed. Codes claimed after the last bound are
+// counted in an additional, final bucket.
+var CodeClaimAgeBuckets = []time.Duration{
+	1 * time.Minute,
+	5 * time.Minute,
+	15 * time.Minute,
+	30 * time.Minute,
+	1 * time.Hour,
+	2 * time.Hour,
+	3 * time.Hour,
+	6 * time.Hour,
+	12 * time.Hour,
+	24 * time.Hour,
+}
+
 // RealmStat represents statistics related to a user in the database.
 type RealmStat struct {
 	Date             time.Time `gorm:"date; not null;"`
@@ -39,6 +58,72 @@ type RealmStat struct {
 	CodesIssued      uint      `gorm:"codes_issued; default:0;"`
 	CodesClaimed     uint      `gorm:"codes_claimed; default:0;"`
 	DailyActiveUsers uint      `gorm:"daily_active_users; default:0;"`
+
+	// TokensClaimed is the number of verification tokens exchanged for a
+	// certificate, and SMSFailed is the number of codes whose SMS could not be
+	// sent. Together with CodesIssued and CodesClaimed they form the funnel.
+	TokensClaimed uint `gorm:"column:tokens_claimed; default:0;"`
+	SMSFailed     uint `gorm:"column:sms_failed; default:0;"`
+
+	// CodeClaimAgeDistribution is the number of codes claimed in each of the
+	// CodeClaimAgeBuckets, and CodeClaimAgeTotalSeconds is the sum of the time
+	// between issuing and claiming those codes.
+	CodeClaimAgeDistribution pq.Int32Array `gorm:"column:code_claim_age_distribution; type:integer[];"`
+	CodeClaimAgeTotalSeconds uint64        `gorm:"column:code_claim_age_total_seconds; default:0;"`
+}
+
+// codeClaimAgeBucket returns the zero-based index of the bucket for the given
+// age.
+func codeClaimAgeBucket(age time.Duration) int {
+	for i, bound := range CodeClaimAgeBuckets {
+		if age <= bound {
+			return i
+		}
+	}
+	return len(CodeClaimAgeBuckets)
+}
+
+// CodeClaimAgeCount returns the number of codes with a recorded claim age. This
+// can be less than CodesClaimed for days before ages were recorded.
+func (s *RealmStat) CodeClaimAgeCount() uint64 {
+	var total uint64
+	for _, v := range s.CodeClaimAgeDistribution {
+		total += uint64(v)
+	}
+	return total
+}
+
+// CodeClaimMeanAge returns the mean time between issuing and claiming a code.
+// It returns 0 if no claim ages were recorded.
+func (s *RealmStat) CodeClaimMeanAge() time.Duration {
+	count := s.CodeClaimAgeCount()
+	if count == 0 {
+		return 0
+	}
+	return time.Duration(s.CodeClaimAgeTotalSeconds/count) * time.Second
+}
+
+// CodeClaimAgePercentile returns the upper bound of the bucket containing the
+// p-th percentile (0-100) of claim ages. Ages beyond the last bucket are
+// reported as the last bound. It returns 0 if no claim ages were recorded.
+func (s *RealmStat) CodeClaimAgePercentile(p float64) time.Duration {
+	count := s.CodeClaimAgeCount()
+	if count == 0 {
+		return 0
+	}
+
+	target := math.Ceil(float64(count) * p / 100)
+	var seen uint64
+	for i, v := range s.CodeClaimAgeDistribution {
+		seen += uint64(v)
+		if float64(seen) >= target {
+			if i >= len(CodeClaimAgeBuckets) {
+				break
+			}
+			return CodeClaimAgeBuckets[i]
+		}
+	}
+	return CodeClaimAgeBuckets[len(CodeClaimAgeBuckets)-1]
 }
 
 // MarshalCSV returns bytes in CSV format.
@@ -51,7 +136,11 @@ func (s RealmStats) MarshalCSV() ([]byte, error) {
 	var b bytes.Buffer
 	w := csv.NewWriter(&b)
 
-	if err := w.Write([]string{"date", "codes_issued", "codes_claimed", "daily_active_users"}); err != nil {
+	if err := w.Write([]string{
+		"date", "codes_issued", "codes_claimed", "daily_active_users",
+		"tokens_claimed", "sms_failed", "code_claim_mean_age_seconds",
+		"code_claim_age_p50_seconds", "code_claim_age_p90_seconds", "code_claim_age_p99_seconds",
+	}); err != nil {
 		return nil, fmt.Errorf("failed to write CSV header: %w", err)
 	}
 
@@ -61,6 +150,12 @@ func (s RealmStats) MarshalCSV() ([]byte, error) {
 			strconv.FormatUint(uint64(stat.CodesIssued), 10),
 			strconv.FormatUint(uint64(stat.CodesClaimed), 10),
 			strconv.FormatUint(uint64(stat.DailyActiveUsers), 10),
+			strconv.FormatUint(uint64(stat.TokensClaimed), 10),
+			strconv.FormatUint(uint64(stat.SMSFailed), 10),
+			formatSeconds(stat.CodeClaimMeanAge()),
+			formatSeconds(stat.CodeClaimAgePercentile(50)),
+			formatSeconds(stat.CodeClaimAgePercentile(90)),
+			formatSeconds(stat.CodeClaimAgePercentile(99)),
 		}); err != nil {
 			return nil, fmt.Errorf("failed to write CSV entry %d: %w", i, err)
 		}
@@ -88,6 +183,19 @@ type jsonRealmStatStatsData struct {
 	CodesIssued      uint `json:"codes_issued"`
 	CodesClaimed     uint `json:"codes_claimed"`
 	DailyActiveUsers uint `json:"daily_active_users"`
+	TokensClaimed    uint `json:"tokens_claimed"`
+	SMSFailed        uint `json:"sms_failed"`
+
+	CodeClaimAgeDistribution []int32                     `json:"code_claim_age_distribution"`
+	CodeClaimAgeTotalSeconds uint64                      `json:"code_claim_age_total_seconds"`
+	CodeClaimMeanAgeSeconds  uint64                      `json:"code_claim_mean_age_seconds"`
+	CodeClaimAgePercentiles  *jsonCodeClaimAgePercentile `json:"code_claim_age_percentiles"`
+}
+
+type jsonCodeClaimAgePercentile struct {
+	P50 uint64 `json:"p50_seconds"`
+	P90 uint64 `json:"p90_seconds"`
+	P99 uint64 `json:"p99_seconds"`
 }
 
 // MarshalJSON is a custom JSON marshaller.
@@ -105,6 +213,17 @@ func (s RealmStats) MarshalJSON() ([]byte, error) {
 				CodesIssued:      stat.CodesIssued,
 				CodesClaimed:     stat.CodesClaimed,
 				DailyActiveUsers: stat.DailyActiveUsers,
+				TokensClaimed:    stat.TokensClaimed,
+				SMSFailed:        stat.SMSFailed,
+
+				CodeClaimAgeDistribution: stat.CodeClaimAgeDistribution,
+				CodeClaimAgeTotalSeconds: stat.CodeClaimAgeTotalSeconds,
+				CodeClaimMeanAgeSeconds:  uint64(stat.CodeClaimMeanAge().Seconds()),
+				CodeClaimAgePercentiles: &jsonCodeClaimAgePercentile{
+					P50: uint64(stat.CodeClaimAgePercentile(50).Seconds()),
+					P90: uint64(stat.CodeClaimAgePercentile(90).Seconds()),
+					P99: uint64(stat.CodeClaimAgePercentile(99).Seconds()),
+				},
 			},
 		})
 	}
@@ -142,19 +261,31 @@ func (s *RealmStats) UnmarshalJSON(b []byte) error {
 			CodesIssued:      stat.Data.CodesIssued,
 			CodesClaimed:     stat.Data.CodesClaimed,
 			DailyActiveUsers: stat.Data.DailyActiveUsers,
+			TokensClaimed:    stat.Data.TokensClaimed,
+			SMSFailed:        stat.Data.SMSFailed,
+
+			CodeClaimAgeDistribution: stat.Data.CodeClaimAgeDistribution,
+			CodeClaimAgeTotalSeconds: stat.Data.CodeClaimAgeTotalSeconds,
 		})
 	}
 
 	return nil
 }
 
+// formatSeconds formats the duration as a whole number of seconds.
+func formatSeconds(d time.Duration) string {
+	return strconv.FormatInt(int64(d/time.Second), 10)
+}
+
 // HistoricalCodesIssued returns a slice of the historical codes issued for
-// this realm by date descending.
+// this realm by date descending. The current day in the realm's timezone is
+// excluded, since it is not over yet.
 func (r *Realm) HistoricalCodesIssued(db *Database, limit uint64) ([]uint64, error) {
 	var stats []uint64
 	if err := db.db.
 		Model(&RealmStats{}).
 		Where("realm_id = ?", r.ID).
+		Where("date < ?", r.StatsDate(time.Now())).
 		Order("date DESC").
 		Limit(limit).
 		Pluck("codes_issued", &stats).
@@ -163,3 +294,123 @@ func (r *Realm) HistoricalCodesIssued(db *Database, limit uint64) ([]uint64, err
 	}
 	return stats, nil
 }
+
+// CurrentRealmStats returns the statistics for the current day of each of the
+// given realms, keyed by realm ID. Since realms can have different timezones,
+// the current day is determined per realm. Realms without stats for the
+// current day are omitted.
+func (db *Database) CurrentRealmStats(realms []*Realm) (map[uint]*RealmStat, error) {
+	now := time.Now()
+
+	dates := make(map[uint]time.Time, len(realms))
+	ids := make([]int64, 0, len(realms))
+	for _, realm := range realms {
+		dates[realm.ID] = realm.StatsDate(now)
+		ids = append(ids, int64(realm.ID))
+	}
+
+	// Every timezone is within a day of UTC, so this covers the current day for
+	// all realms.
+	since := statsDate(now, time.UTC).Add(-24 * time.Hour)
+
+	var stats []*RealmStat
+	if err := db.db.
+		Model(&RealmStat{}).
+		Where("realm_id = ANY(?)", pq.Array(ids)).
+		Where("date >= ?", since).
+		Find(&stats).
+		Error; err != nil && !IsNotFound(err) {
+		return nil, err
+	}
+
+	current := make(map[uint]*RealmStat, len(realms))
+	for _, stat := range stats {
+		if date, ok := dates[stat.RealmID]; ok && stat.Date.Equal(date) {
+			current[stat.RealmID] = stat
+		}
+	}
+	return current, nil
+}
+
+// rebucketRealmStats recounts the codes issued and claimed in the realm's
+// statistics by day in the given timezone, from the verification codes which
+// have not been purged. It is called when the realm's timezone changes.
+//
+// Days up to and including the day of the oldest remaining code keep their
+// existing counts, since their codes can no longer all be counted. Statistics
+// which are not derived from the codes, such as tokens claimed and daily active
+// users, are left in the days they were recorded.
+func rebucketRealmStats(tx *gorm.DB, realmID uint, timezone string) error {
+	var oldest struct {
+		Date *time.Time
+	}
+	if err := tx.
+		Raw(`SELECT MIN((created_at AT TIME ZONE $1)::date) AS date FROM verification_codes WHERE realm_id = $2`,
+			timezone, realmID).
+		Scan(&oldest).
+		Error; err != nil {
+		return fmt.Errorf("failed to find oldest verification code: %w", err)
+	}
+	if oldest.Date == nil {
+		return nil
+	}
+	start := oldest.Date.AddDate(0, 0, 1)
+
+	resets := []string{
+		`UPDATE realm_stats SET codes_issued = 0, codes_claimed = 0 WHERE realm_id = $1 AND date >= $2`,
+		`UPDATE user_stats SET codes_issued = 0 WHERE realm_id = $1 AND date >= $2`,
+		`UPDATE external_issuer_stats SET codes_issued = 0 WHERE realm_id = $1 AND date >= $2`,
+		`UPDATE site_stats SET codes_issued = 0 WHERE realm_id = $1 AND date >= $2`,
+		`UPDATE authorized_app_stats SET codes_issued = 0
+			WHERE authorized_app_id IN (SELECT id FROM authorized_apps WHERE realm_id = $1) AND date >= $2`,
+	}
+	for _, sql := range resets {
+		if err := tx.Exec(sql, realmID, start).Error; err != nil {
+			return fmt.Errorf("failed to reset stats: %w", err)
+		}
+	}
+
+	counts := []string{
+		`INSERT INTO realm_stats (date, realm_id, codes_issued, codes_claimed)
+			SELECT (created_at AT TIME ZONE $2)::date AS day, realm_id, COUNT(*), COUNT(*) FILTER (WHERE claimed)
+			FROM verification_codes
+			WHERE realm_id = $1 AND (created_at AT TIME ZONE $2)::date >= $3
+			GROUP BY day, realm_id
+		ON CONFLICT (date, realm_id) DO UPDATE
+			SET codes_issued = excluded.codes_issued, codes_claimed = excluded.codes_claimed`,
+		`INSERT INTO user_stats (date, realm_id, user_id, codes_issued)
+			SELECT (created_at AT TIME ZONE $2)::date AS day, realm_id, issuing_user_id, COUNT(*)
+			FROM verification_codes
+			WHERE realm_id = $1 AND (created_at AT TIME ZONE $2)::date >= $3 AND issuing_user_id > 0
+			GROUP BY day, realm_id, issuing_user_id
+		ON CONFLICT (date, realm_id, user_id) DO UPDATE
+			SET codes_issued = excluded.codes_issued`,
+		`INSERT INTO external_issuer_stats (date, realm_id, issuer_id, codes_issued)
+			SELECT (created_at AT TIME ZONE $2)::date AS day, realm_id, issuing_external_id, COUNT(*)
+			FROM verification_codes
+			WHERE realm_id = $1 AND (created_at AT TIME ZONE $2)::date >= $3 AND issuing_external_id <> ''
+			GROUP BY day, realm_id, issuing_external_id
+		ON CONFLICT (date, realm_id, issuer_id) DO UPDATE
+			SET codes_issued = excluded.codes_issued`,
+		`INSERT INTO site_stats (date, realm_id, site_id, codes_issued)
+			SELECT (created_at AT TIME ZONE $2)::date AS day, realm_id, issuing_site_id, COUNT(*)
+			FROM verification_codes
+			WHERE realm_id = $1 AND (created_at AT TIME ZONE $2)::date >= $3 AND issuing_site_id > 0
+			GROUP BY day, realm_id, issuing_site_id
+		ON CONFLICT (date, site_id) DO UPDATE
+			SET codes_issued = excluded.codes_issued`,
+		`INSERT INTO authorized_app_stats (date, authorized_app_id, codes_issued)
+			SELECT (created_at AT TIME ZONE $2)::date AS day, issuing_app_id, COUNT(*)
+			FROM verification_codes
+			WHERE realm_id = $1 AND (created_at AT TIME ZONE $2)::date >= $3 AND issuing_app_id > 0
+			GROUP BY day, issuing_app_id
+		ON CONFLICT (date, authorized_app_id) DO UPDATE
+			SET codes_issued = excluded.codes_issued`,
+	}
+	for _, sql := range counts {
+		if err := tx.Exec(sql, realmID, timezone, start).Error; err != nil {
+			return fmt.Errorf("failed to recount stats: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,232 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/google/exposure-notifications-verification-server/internal/icsv"
+	"github.com/google/exposure-notifications-verification-server/internal/project"
+)
+
+var _ icsv.Marshaler = (PublicRealmStats)(nil)
+
+// PublicRealmStats is a collection of realm statistics prepared for public
+// release.
+type PublicRealmStats []*PublicRealmStat
+
+// PublicRealmStat is a period of realm statistics prepared for public release.
+// Counts are nil when they were suppressed for being below the realm's minimum
+// count, or, for daily active users, when they are not collected.
+type PublicRealmStat struct {
+	Date             time.Time
+	RealmID          uint
+	CodesIssued      *uint
+	CodesClaimed     *uint
+	TokensClaimed    *uint
+	DailyActiveUsers *uint
+}
+
+// Publish transforms the statistics for public release using the realm's
+// settings. If the realm has a non-zero epsilon, Laplace noise is added to each
+// count. Counts below the realm's minimum count, after noise, are suppressed.
+//
+// The noise is derived from key and the period, not the count, so every
+// request for a period returns the same value. Callers must only publish
+// complete periods aligned to the granularity (see StatsRange.CompletePeriods),
+// so there are no overlapping windows whose noise could be differenced or
+// averaged away. Each granularity is noised independently, so publishing all
+// three spends three times epsilon. The key must be kept secret and should not
+// be used for anything else.
+func (s RealmStats) Publish(r *Realm, granularity StatsGranularity, key []byte) PublicRealmStats {
+	p := &publisher{
+		realmID:     r.ID,
+		granularity: granularity,
+		minCount:    r.PublicStatsMinCount,
+		epsilon:     r.PublicStatsEpsilon,
+		key:         key,
+	}
+
+	result := make(PublicRealmStats, 0, len(s))
+	for _, stat := range s {
+		published := &PublicRealmStat{
+			Date:          stat.Date,
+			RealmID:       r.ID,
+			CodesIssued:   p.publish(stat.Date, "codes_issued", stat.CodesIssued),
+			CodesClaimed:  p.publish(stat.Date, "codes_claimed", stat.CodesClaimed),
+			TokensClaimed: p.publish(stat.Date, "tokens_claimed", stat.TokensClaimed),
+		}
+
+		// Noise would turn uncollected daily active users into made-up values,
+		// and daily active users are not counted for longer periods.
+		if r.DailyActiveUsersEnabled && granularity == StatsGranularityDay {
+			published.DailyActiveUsers = p.publish(stat.Date, "daily_active_users", stat.DailyActiveUsers)
+		}
+
+		result = append(result, published)
+	}
+	return result
+}
+
+// publisher applies a realm's publishing settings to individual counts.
+type publisher struct {
+	realmID     uint
+	granularity StatsGranularity
+	minCount    uint
+	epsilon     float64
+	key         []byte
+}
+
+// publish returns the published value of the count, or nil if it is
+// suppressed.
+func (p *publisher) publish(date time.Time, name string, count uint) *uint {
+	v := float64(count)
+	if p.epsilon > 0 {
+		v = math.Max(0, math.Round(v+p.noise(date, name)))
+	}
+
+	published := uint(v)
+	if published < p.minCount {
+		return nil
+	}
+	return &published
+}
+
+// noise returns Laplace noise with scale 1/epsilon. Each patient contributes at
+// most one to each count, so the sensitivity of each count is one.
+func (p *publisher) noise(date time.Time, name string) float64 {
+	mac := hmac.New(sha256.New, p.key)
+	fmt.Fprintf(mac, "public-stats:%d:%s:%s:%s",
+		p.realmID, p.granularity, date.Format(project.RFC3339Date), name)
+	sum := mac.Sum(nil)
+
+	// Map the first 53 bits to a uniform value in (-0.5, 0.5).
+	u := float64(binary.BigEndian.Uint64(sum)>>11)/(1<<53) - 0.5
+	if u == -0.5 {
+		u = 0
+	}
+
+	scale := 1 / p.epsilon
+	if u < 0 {
+		return scale * math.Log(1+2*u)
+	}
+	return -scale * math.Log(1-2*u)
+}
+
+// formatPublicCount formats the published count for CSV, leaving suppressed
+// counts empty.
+func formatPublicCount(v *uint) string {
+	if v == nil {
+		return ""
+	}
+	return strconv.FormatUint(uint64(*v), 10)
+}
+
+// MarshalCSV returns bytes in CSV format. Suppressed counts are empty.
+func (s PublicRealmStats) MarshalCSV() ([]byte, error) {
+	// Do nothing if there's no records
+	if len(s) == 0 {
+		return nil, nil
+	}
+
+	var b bytes.Buffer
+	w := csv.NewWriter(&b)
+
+	if err := w.Write([]string{"date", "codes_issued", "codes_claimed", "tokens_claimed", "daily_active_users"}); err != nil {
+		return nil, fmt.Errorf("failed to write CSV header: %w", err)
+	}
+
+	for i, stat := range s {
+		if err := w.Write([]string{
+			stat.Date.Format(project.RFC3339Date),
+			formatPublicCount(stat.CodesIssued),
+			formatPublicCount(stat.CodesClaimed),
+			formatPublicCount(stat.TokensClaimed),
+			formatPublicCount(stat.DailyActiveUsers),
+		}); err != nil {
+			return nil, fmt.Errorf("failed to write CSV entry %d: %w", i, err)
+		}
+	}
+
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return nil, fmt.Errorf("failed to create CSV: %w", err)
+	}
+
+	return b.Bytes(), nil
+}
+
+type jsonPublicRealmStat struct {
+	RealmID uint                        `json:"realm_id"`
+	Stats   []*jsonPublicRealmStatStats `json:"statistics"`
+}
+
+type jsonPublicRealmStatStats struct {
+	Date time.Time                     `json:"date"`
+	Data *jsonPublicRealmStatStatsData `json:"data"`
+}
+
+type jsonPublicRealmStatStatsData struct {
+	CodesIssued      *uint `json:"codes_issued"`
+	CodesClaimed     *uint `json:"codes_claimed"`
+	TokensClaimed    *uint `json:"tokens_claimed"`
+	DailyActiveUsers *uint `json:"daily_active_users"`
+}
+
+// MarshalJSON is a custom JSON marshaller. Suppressed counts are null.
+func (s PublicRealmStats) MarshalJSON() ([]byte, error) {
+	// Do nothing if there's no records
+	if len(s) == 0 {
+		return json.Marshal(struct{}{})
+	}
+
+	var stats []*jsonPublicRealmStatStats
+	for _, stat := range s {
+		stats = append(stats, &jsonPublicRealmStatStats{
+			Date: stat.Date,
+			Data: &jsonPublicRealmStatStatsData{
+				CodesIssued:      stat.CodesIssued,
+				CodesClaimed:     stat.CodesClaimed,
+				TokensClaimed:    stat.TokensClaimed,
+				DailyActiveUsers: stat.DailyActiveUsers,
+			},
+		})
+	}
+
+	// Sort in descending order.
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].Date.After(stats[j].Date)
+	})
+
+	var result jsonPublicRealmStat
+	result.RealmID = s[0].RealmID
+	result.Stats = stats
+
+	b, err := json.Marshal(result)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal json: %w", err)
+	}
+	return b, nil
+}
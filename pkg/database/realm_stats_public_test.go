@@ -0,0 +1,119 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/jinzhu/gorm"
+)
+
+func TestRealmStats_Publish(t *testing.T) {
+	t.Parallel()
+
+	date := time.Date(2020, 2, 3, 0, 0, 0, 0, time.UTC)
+	key := []byte("super-secret-key")
+
+	stats := RealmStats{
+		{Date: date, RealmID: 1, CodesIssued: 25, CodesClaimed: 4, TokensClaimed: 3, DailyActiveUsers: 120},
+	}
+
+	t.Run("suppression", func(t *testing.T) {
+		t.Parallel()
+
+		realm := &Realm{Model: gorm.Model{ID: 1}, PublicStatsMinCount: 5}
+		published := stats.Publish(realm, StatsGranularityDay, key)
+
+		b, err := published.MarshalCSV()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Daily active users are not collected, so they are never published.
+		want := "date,codes_issued,codes_claimed,tokens_claimed,daily_active_users\n" +
+			"2020-02-03,25,,,\n"
+		if diff := cmp.Diff(want, string(b)); diff != "" {
+			t.Errorf("mismatch (-want, +got):\n%s", diff)
+		}
+
+		j, err := published.MarshalJSON()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		wantJSON := `{"realm_id":1,"statistics":[{"date":"2020-02-03T00:00:00Z","data":{"codes_issued":25,"codes_claimed":null,"tokens_claimed":null,"daily_active_users":null}}]}`
+		if diff := cmp.Diff(wantJSON, string(j)); diff != "" {
+			t.Errorf("mismatch (-want, +got):\n%s", diff)
+		}
+	})
+
+	t.Run("noise", func(t *testing.T) {
+		t.Parallel()
+
+		realm := &Realm{
+			Model:                   gorm.Model{ID: 1},
+			DailyActiveUsersEnabled: true,
+			PublicStatsEpsilon:      0.5,
+		}
+
+		first := stats.Publish(realm, StatsGranularityDay, key)
+		second := stats.Publish(realm, StatsGranularityDay, key)
+		if diff := cmp.Diff(first, second); diff != "" {
+			t.Errorf("expected noise to be deterministic (-first, +second):\n%s", diff)
+		}
+
+		if first[0].DailyActiveUsers == nil {
+			t.Fatalf("expected daily active users to be published")
+		}
+
+		// Daily active users cannot be summed into weeks or months.
+		if weekly := stats.Publish(realm, StatsGranularityWeek, key); weekly[0].DailyActiveUsers != nil {
+			t.Errorf("expected weekly daily active users not to be published")
+		}
+
+		// The noise does not depend on the count, so a change in the count
+		// cannot be used to draw fresh noise.
+		changed := RealmStats{
+			{Date: date, RealmID: 1, CodesIssued: 26, CodesClaimed: 4, TokensClaimed: 3, DailyActiveUsers: 120},
+		}
+		if got, want := int(*changed.Publish(realm, StatsGranularityDay, key)[0].CodesIssued)-int(*first[0].CodesIssued), 1; got != want {
+			t.Errorf("expected published counts to differ by %d, got %d", want, got)
+		}
+
+		other := stats.Publish(realm, StatsGranularityDay, []byte("other-key"))
+		if cmp.Equal(first, other) {
+			t.Errorf("expected noise to depend on the key")
+		}
+	})
+
+	t.Run("noise_distribution", func(t *testing.T) {
+		t.Parallel()
+
+		p := &publisher{realmID: 1, granularity: StatsGranularityDay, epsilon: 1, key: key}
+
+		// The mean absolute value of Laplace noise is its scale.
+		var total float64
+		n := 10000
+		for i := 0; i < n; i++ {
+			total += math.Abs(p.noise(date.AddDate(0, 0, i), "codes_issued"))
+		}
+		if mean := total / float64(n); mean < 0.9 || mean > 1.1 {
+			t.Errorf("expected mean absolute noise %f to be about 1", mean)
+		}
+	})
+}
@@ -15,9 +15,12 @@
 package database
 
 import (
+	"fmt"
 	"testing"
 	"time"
 
+	"github.com/google/exposure-notifications-server/pkg/timeutils"
+	"github.com/google/exposure-notifications-verification-server/internal/project"
 	"github.com/google/go-cmp/cmp"
 )
 
@@ -45,8 +48,8 @@ func TestRealmStats_MarshalCSV(t *testing.T) {
 					DailyActiveUsers: 2,
 				},
 			},
-			exp: `date,codes_issued,codes_claimed,daily_active_users
-2020-02-03,10,9,2
+			exp: `date,codes_issued,codes_claimed,daily_active_users,tokens_claimed,sms_failed,code_claim_mean_age_seconds,code_claim_age_p50_seconds,code_claim_age_p90_seconds,code_claim_age_p99_seconds
+2020-02-03,10,9,2,0,0,0,0,0,0
 `,
 		},
 		{
@@ -72,12 +75,17 @@ func TestRealmStats_MarshalCSV(t *testing.T) {
 					CodesIssued:      15,
 					CodesClaimed:     2,
 					DailyActiveUsers: 18,
+					TokensClaimed:    1,
+					SMSFailed:        3,
+
+					CodeClaimAgeDistribution: []int32{1, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0},
+					CodeClaimAgeTotalSeconds: 3630,
 				},
 			},
-			exp: `date,codes_issued,codes_claimed,daily_active_users
-2020-02-03,10,9,12
-2020-02-04,45,30,24
-2020-02-05,15,2,18
+			exp: `date,codes_issued,codes_claimed,daily_active_users,tokens_claimed,sms_failed,code_claim_mean_age_seconds,code_claim_age_p50_seconds,code_claim_age_p90_seconds,code_claim_age_p99_seconds
+2020-02-03,10,9,12,0,0,0,0,0,0
+2020-02-04,45,30,24,0,0,0,0,0,0
+2020-02-05,15,2,18,1,3,1815,60,3600,3600
 `,
 		},
 	}
@@ -98,3 +106,211 @@ func TestRealmStats_MarshalCSV(t *testing.T) {
 		})
 	}
 }
+
+func TestRealmStats_JSON(t *testing.T) {
+	t.Parallel()
+
+	stats := RealmStats{
+		{
+			Date:             time.Date(2020, 2, 3, 0, 0, 0, 0, time.UTC),
+			RealmID:          1,
+			CodesIssued:      10,
+			CodesClaimed:     9,
+			DailyActiveUsers: 2,
+			TokensClaimed:    8,
+			SMSFailed:        1,
+
+			CodeClaimAgeDistribution: []int32{4, 4, 1, 0, 0, 0, 0, 0, 0, 0, 0},
+			CodeClaimAgeTotalSeconds: 1200,
+		},
+	}
+
+	b, err := stats.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got RealmStats
+	if err := got.UnmarshalJSON(b); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(stats, got); diff != "" {
+		t.Errorf("bad round trip (+got, -want): %s", diff)
+	}
+}
+
+func TestRealmStat_CodeClaimAge(t *testing.T) {
+	t.Parallel()
+
+	if got, want := codeClaimAgeBucket(30*time.Second), 0; got != want {
+		t.Errorf("expected bucket %d to be %d", got, want)
+	}
+	if got, want := codeClaimAgeBucket(5*time.Minute), 1; got != want {
+		t.Errorf("expected bucket %d to be %d", got, want)
+	}
+	if got, want := codeClaimAgeBucket(48*time.Hour), len(CodeClaimAgeBuckets); got != want {
+		t.Errorf("expected bucket %d to be %d", got, want)
+	}
+
+	var empty RealmStat
+	if got := empty.CodeClaimAgePercentile(50); got != 0 {
+		t.Errorf("expected empty percentile to be 0, got %s", got)
+	}
+	if got := empty.CodeClaimMeanAge(); got != 0 {
+		t.Errorf("expected empty mean to be 0, got %s", got)
+	}
+
+	// 10 claims: 5 within a minute, 4 within 15 minutes, and 1 after a day.
+	stat := &RealmStat{
+		CodeClaimAgeDistribution: []int32{5, 0, 4, 0, 0, 0, 0, 0, 0, 0, 1},
+		CodeClaimAgeTotalSeconds: 100000,
+	}
+
+	cases := []struct {
+		p    float64
+		want time.Duration
+	}{
+		{50, time.Minute},
+		{90, 15 * time.Minute},
+		{99, 24 * time.Hour},
+	}
+	for _, tc := range cases {
+		if got := stat.CodeClaimAgePercentile(tc.p); got != tc.want {
+			t.Errorf("expected p%.0f %s to be %s", tc.p, got, tc.want)
+		}
+	}
+
+	if got, want := stat.CodeClaimMeanAge(), 10000*time.Second; got != want {
+		t.Errorf("expected mean %s to be %s", got, want)
+	}
+}
+
+func TestDatabase_CurrentRealmStats(t *testing.T) {
+	t.Parallel()
+
+	db, _ := testDatabaseInstance.NewDatabase(t, nil)
+
+	utc := NewRealmWithDefaults("utc")
+	if err := db.SaveRealm(utc, SystemTest); err != nil {
+		t.Fatal(err)
+	}
+
+	tokyo := NewRealmWithDefaults("tokyo")
+	tokyo.Timezone = "Asia/Tokyo"
+	if err := db.SaveRealm(tokyo, SystemTest); err != nil {
+		t.Fatal(err)
+	}
+
+	empty := NewRealmWithDefaults("empty")
+	if err := db.SaveRealm(empty, SystemTest); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	for _, stat := range []*RealmStat{
+		{Date: utc.StatsDate(now), RealmID: utc.ID, CodesIssued: 5},
+		{Date: utc.StatsDate(now).Add(-24 * time.Hour), RealmID: utc.ID, CodesIssued: 50},
+		{Date: tokyo.StatsDate(now), RealmID: tokyo.ID, CodesIssued: 7},
+	} {
+		if err := db.RawDB().Create(stat).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	current, err := db.CurrentRealmStats([]*Realm{utc, tokyo, empty})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := len(current), 2; got != want {
+		t.Fatalf("expected %d stats, got %d", want, got)
+	}
+	if got, want := current[utc.ID].CodesIssued, uint(5); got != want {
+		t.Errorf("expected utc codes issued %d to be %d", got, want)
+	}
+	if got, want := current[tokyo.ID].CodesIssued, uint(7); got != want {
+		t.Errorf("expected tokyo codes issued %d to be %d", got, want)
+	}
+}
+
+func TestDatabase_SaveRealm_RebucketStats(t *testing.T) {
+	t.Parallel()
+
+	db, _ := testDatabaseInstance.NewDatabase(t, nil)
+
+	realm := NewRealmWithDefaults("rebucket")
+	if err := db.SaveRealm(realm, SystemTest); err != nil {
+		t.Fatal(err)
+	}
+
+	// 23:30 UTC is the next day in Tokyo.
+	today := timeutils.UTCMidnight(time.Now())
+	oldest := today.Add(-5 * 24 * time.Hour)
+	lateNight := today.Add(-3*24*time.Hour + 23*time.Hour + 30*time.Minute)
+
+	for i, createdAt := range []time.Time{oldest, lateNight} {
+		vc := &VerificationCode{
+			RealmID:       realm.ID,
+			Code:          fmt.Sprintf("12345%d", i),
+			LongCode:      fmt.Sprintf("abcdefghijk12345%d", i),
+			TestType:      "confirmed",
+			ExpiresAt:     time.Now().Add(time.Hour),
+			LongExpiresAt: time.Now().Add(2 * time.Hour),
+		}
+		if err := db.SaveVerificationCode(vc, realm); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.RawDB().
+			Exec(`UPDATE verification_codes SET created_at = $1 WHERE id = $2`, createdAt, vc.ID).
+			Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Stats as they were recorded in UTC.
+	if err := db.RawDB().Exec(`DELETE FROM realm_stats WHERE realm_id = $1`, realm.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	for _, stat := range []*RealmStat{
+		{Date: oldest, RealmID: realm.ID, CodesIssued: 3},
+		{Date: today.Add(-3 * 24 * time.Hour), RealmID: realm.ID, CodesIssued: 1, TokensClaimed: 1},
+	} {
+		if err := db.RawDB().Create(stat).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	realm.Timezone = "Asia/Tokyo"
+	if err := db.SaveRealm(realm, SystemTest); err != nil {
+		t.Fatal(err)
+	}
+
+	var stats []*RealmStat
+	if err := db.RawDB().
+		Where("realm_id = ?", realm.ID).
+		Order("date ASC").
+		Find(&stats).
+		Error; err != nil {
+		t.Fatal(err)
+	}
+
+	got := make(map[string]*RealmStat, len(stats))
+	for _, stat := range stats {
+		got[stat.Date.Format(project.RFC3339Date)] = stat
+	}
+
+	// The oldest day is not recounted.
+	if stat := got[oldest.Format(project.RFC3339Date)]; stat == nil || stat.CodesIssued != 3 {
+		t.Errorf("expected oldest day to keep 3 codes issued, got %#v", stat)
+	}
+
+	// The late night code moves to the next day, and tokens claimed stay.
+	moved := today.Add(-3 * 24 * time.Hour)
+	if stat := got[moved.Format(project.RFC3339Date)]; stat == nil || stat.CodesIssued != 0 || stat.TokensClaimed != 1 {
+		t.Errorf("expected %s to have 0 codes issued and 1 token claimed, got %#v", moved, stat)
+	}
+	next := moved.Add(24 * time.Hour)
+	if stat := got[next.Format(project.RFC3339Date)]; stat == nil || stat.CodesIssued != 1 {
+		t.Errorf("expected %s to have 1 code issued, got %#v", next, stat)
+	}
+}
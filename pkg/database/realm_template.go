@@ -0,0 +1,391 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/google/exposure-notifications-verification-server/internal/project"
+	"github.com/google/exposure-notifications-verification-server/pkg/pagination"
+	"github.com/jinzhu/gorm"
+	"github.com/jinzhu/gorm/dialects/postgres"
+)
+
+var _ Auditable = (*RealmTemplate)(nil)
+
+// RealmTemplate is a named set of realm settings which system admins use to
+// create new realms. It covers policy settings only. Secrets, users, keys, and
+// anything else which identifies a specific health authority are never part of
+// a template.
+type RealmTemplate struct {
+	gorm.Model
+	Errorable
+
+	// Name is the unique name of the template.
+	Name string `gorm:"column:name; type:citext;"`
+
+	// Description is an optional description of when to use the template.
+	Description string `gorm:"column:description; type:text;"`
+
+	// Code policy.
+	CodeLength       uint            `gorm:"column:code_length; type:smallint; not null;"`
+	CodeDuration     DurationSeconds `gorm:"column:code_duration; type:bigint; not null;"`
+	LongCodeLength   uint            `gorm:"column:long_code_length; type:smallint; not null;"`
+	LongCodeDuration DurationSeconds `gorm:"column:long_code_duration; type:bigint; not null;"`
+	AllowedTestTypes TestType        `gorm:"column:allowed_test_types; type:smallint; not null;"`
+	RequireDate      bool            `gorm:"column:require_date; type:boolean; not null;"`
+	AllowBulkUpload  bool            `gorm:"column:allow_bulk_upload; type:boolean; not null;"`
+
+	// SMS templates.
+	SMSTextTemplate           string          `gorm:"column:sms_text_template; type:text; not null;"`
+	SMSTextAlternateTemplates postgres.Hstore `gorm:"column:alternate_sms_templates; type:hstore;"`
+	SMSCountry                string          `gorm:"column:sms_country; type:varchar(5);"`
+
+	// Authentication policy.
+	MFAMode                     AuthRequirement `gorm:"column:mfa_mode; type:smallint; not null;"`
+	MFARequiredGracePeriod      DurationSeconds `gorm:"column:mfa_required_grace_period; type:bigint; not null;"`
+	EmailVerifiedMode           AuthRequirement `gorm:"column:email_verified_mode; type:smallint; not null;"`
+	PasswordRotationPeriodDays  uint            `gorm:"column:password_rotation_period_days; type:smallint; not null;"`
+	PasswordRotationWarningDays uint            `gorm:"column:password_rotation_warning_days; type:smallint; not null;"`
+
+	// Abuse prevention.
+	AbusePreventionEnabled     bool    `gorm:"column:abuse_prevention_enabled; type:boolean; not null;"`
+	AbusePreventionLimitFactor float32 `gorm:"column:abuse_prevention_limit_factor; type:numeric(6, 3); not null;"`
+}
+
+// NewRealmTemplateFromRealm builds a template with the given name from the
+// realm's current settings. It does NOT save the template to the database.
+func NewRealmTemplateFromRealm(name string, r *Realm) *RealmTemplate {
+	t := &RealmTemplate{Name: name}
+	t.CopyFrom(r)
+	return t
+}
+
+// CopyFrom replaces the template's settings with the realm's current settings.
+// The name and description are unchanged.
+func (t *RealmTemplate) CopyFrom(r *Realm) {
+	t.CodeLength = r.CodeLength
+	t.CodeDuration = r.CodeDuration
+	t.LongCodeLength = r.LongCodeLength
+	t.LongCodeDuration = r.LongCodeDuration
+	t.AllowedTestTypes = r.AllowedTestTypes
+	t.RequireDate = r.RequireDate
+	t.AllowBulkUpload = r.AllowBulkUpload
+
+	t.SMSTextTemplate = r.SMSTextTemplate
+	t.SMSTextAlternateTemplates = copyHstore(r.SMSTextAlternateTemplates)
+	t.SMSCountry = r.SMSCountry
+
+	t.MFAMode = r.MFAMode
+	t.MFARequiredGracePeriod = r.MFARequiredGracePeriod
+	t.EmailVerifiedMode = r.EmailVerifiedMode
+	t.PasswordRotationPeriodDays = r.PasswordRotationPeriodDays
+	t.PasswordRotationWarningDays = r.PasswordRotationWarningDays
+
+	t.AbusePreventionEnabled = r.AbusePreventionEnabled
+	t.AbusePreventionLimitFactor = r.AbusePreventionLimitFactor
+}
+
+// ApplyTo copies the template's settings onto the realm. It does NOT save the
+// realm to the database.
+func (t *RealmTemplate) ApplyTo(r *Realm) {
+	r.CodeLength = t.CodeLength
+	r.CodeDuration = t.CodeDuration
+	r.LongCodeLength = t.LongCodeLength
+	r.LongCodeDuration = t.LongCodeDuration
+	r.AllowedTestTypes = t.AllowedTestTypes
+	r.RequireDate = t.RequireDate
+	r.AllowBulkUpload = t.AllowBulkUpload
+
+	r.SMSTextTemplate = t.SMSTextTemplate
+	r.SMSTextAlternateTemplates = copyHstore(t.SMSTextAlternateTemplates)
+	r.SMSCountry = t.SMSCountry
+
+	r.MFAMode = t.MFAMode
+	r.MFARequiredGracePeriod = t.MFARequiredGracePeriod
+	r.EmailVerifiedMode = t.EmailVerifiedMode
+	r.PasswordRotationPeriodDays = t.PasswordRotationPeriodDays
+	r.PasswordRotationWarningDays = t.PasswordRotationWarningDays
+
+	r.AbusePreventionEnabled = t.AbusePreventionEnabled
+	r.AbusePreventionLimitFactor = t.AbusePreventionLimitFactor
+}
+
+// Settings returns a human-readable line for each setting in the template,
+// sorted by name. It is used for display and for audit diffs.
+func (t *RealmTemplate) Settings() []string {
+	settings := []string{
+		fmt.Sprintf("code length: %d", t.CodeLength),
+		fmt.Sprintf("code duration: %s", t.CodeDuration.Duration),
+		fmt.Sprintf("long code length: %d", t.LongCodeLength),
+		fmt.Sprintf("long code duration: %s", t.LongCodeDuration.Duration),
+		fmt.Sprintf("allowed test types: %s", t.AllowedTestTypes.Display()),
+		fmt.Sprintf("require date: %t", t.RequireDate),
+		fmt.Sprintf("allow bulk upload: %t", t.AllowBulkUpload),
+		fmt.Sprintf("SMS template: %s", t.SMSTextTemplate),
+		fmt.Sprintf("SMS country: %s", t.SMSCountry),
+		fmt.Sprintf("MFA mode: %s", t.MFAMode),
+		fmt.Sprintf("MFA required grace period: %s", t.MFARequiredGracePeriod.Duration),
+		fmt.Sprintf("email verification mode: %s", t.EmailVerifiedMode),
+		fmt.Sprintf("password rotation period: %d days", t.PasswordRotationPeriodDays),
+		fmt.Sprintf("password rotation warning: %d days", t.PasswordRotationWarningDays),
+		fmt.Sprintf("abuse prevention enabled: %t", t.AbusePreventionEnabled),
+		fmt.Sprintf("abuse prevention limit factor: %.3f", t.AbusePreventionLimitFactor),
+	}
+	for label, tmpl := range t.SMSTextAlternateTemplates {
+		settings = append(settings, fmt.Sprintf("SMS template %s: %s", label, stringValue(tmpl)))
+	}
+	sort.Strings(settings)
+	return settings
+}
+
+func (t *RealmTemplate) BeforeSave(tx *gorm.DB) error {
+	t.Name = project.TrimSpace(t.Name)
+	if t.Name == "" {
+		t.AddError("name", "cannot be blank")
+	}
+
+	t.Description = project.TrimSpace(t.Description)
+
+	// Templates are always copied from a saved realm, but validate the
+	// settings which would otherwise fail when a realm is created.
+	if t.CodeLength < 6 {
+		t.AddError("codeLength", "must be at least 6")
+	}
+	if t.LongCodeLength < 12 {
+		t.AddError("longCodeLength", "must be at least 12")
+	}
+	if t.SMSTextTemplate == "" {
+		t.AddError("smsTextTemplate", "cannot be blank")
+	}
+
+	return t.ErrorOrNil()
+}
+
+// Clone returns a new realm with the given name and a copy of this realm's
+// settings. Secrets, users, mobile apps, API keys, and signing keys are not
+// copied, nor are the settings which identify a specific health authority
+// (region code and certificate issuer). It does NOT save the realm to the
+// database.
+func (r *Realm) Clone(name string) *Realm {
+	c := NewRealmWithDefaults(name)
+
+	c.WelcomeMessage = r.WelcomeMessage
+	c.Timezone = r.Timezone
+	c.AllowBulkUpload = r.AllowBulkUpload
+
+	c.CodeLength = r.CodeLength
+	c.CodeDuration = r.CodeDuration
+	c.LongCodeLength = r.LongCodeLength
+	c.LongCodeDuration = r.LongCodeDuration
+
+	c.SMSTextTemplate = r.SMSTextTemplate
+	c.SMSTextAlternateTemplates = copyHstore(r.SMSTextAlternateTemplates)
+	c.SMSCountry = r.SMSCountry
+	c.CanUseSystemSMSConfig = r.CanUseSystemSMSConfig
+	c.UseSystemSMSConfig = r.UseSystemSMSConfig
+	c.SMSFromNumberID = r.SMSFromNumberID
+
+	c.EmailInviteTemplate = r.EmailInviteTemplate
+	c.EmailPasswordResetTemplate = r.EmailPasswordResetTemplate
+	c.EmailVerifyTemplate = r.EmailVerifyTemplate
+	c.CanUseSystemEmailConfig = r.CanUseSystemEmailConfig
+	c.UseSystemEmailConfig = r.UseSystemEmailConfig
+
+	c.MFAMode = r.MFAMode
+	c.MFARequiredGracePeriod = r.MFARequiredGracePeriod
+	c.EmailVerifiedMode = r.EmailVerifiedMode
+	c.PasswordRotationPeriodDays = r.PasswordRotationPeriodDays
+	c.PasswordRotationWarningDays = r.PasswordRotationWarningDays
+	c.AllowedCIDRsAdminAPI = append(c.AllowedCIDRsAdminAPI, r.AllowedCIDRsAdminAPI...)
+	c.AllowedCIDRsAPIServer = append(c.AllowedCIDRsAPIServer, r.AllowedCIDRsAPIServer...)
+	c.AllowedCIDRsServer = append(c.AllowedCIDRsServer, r.AllowedCIDRsServer...)
+
+	c.VerificationCodeRetentionDays = r.VerificationCodeRetentionDays
+	c.AuditEntryRetentionDays = r.AuditEntryRetentionDays
+
+	c.AllowedTestTypes = r.AllowedTestTypes
+	c.RequireDate = r.RequireDate
+
+	c.UseRealmCertificateKey = r.UseRealmCertificateKey
+	c.CertificateAudience = r.CertificateAudience
+	c.CertificateDuration = r.CertificateDuration
+	c.CertificateKeyRotationPeriodDays = r.CertificateKeyRotationPeriodDays
+	c.CertificateKeyRotationOverlapHours = r.CertificateKeyRotationOverlapHours
+
+	c.EnableENExpress = r.EnableENExpress
+	c.AbusePreventionEnabled = r.AbusePreventionEnabled
+	c.AbusePreventionLimitFactor = r.AbusePreventionLimitFactor
+	c.DailyActiveUsersEnabled = r.DailyActiveUsersEnabled
+
+	// A clone is a sibling of the realm in the hierarchy.
+	c.ParentRealmID = r.ParentRealmID
+	c.InheritParentSMSConfig = r.InheritParentSMSConfig
+	c.InheritParentTestTypes = r.InheritParentTestTypes
+	c.InheritParentCertificateKey = r.InheritParentCertificateKey
+
+	return c
+}
+
+func copyHstore(h postgres.Hstore) postgres.Hstore {
+	if h == nil {
+		return nil
+	}
+	c := make(postgres.Hstore, len(h))
+	for k, v := range h {
+		if v != nil {
+			v := *v
+			c[k] = &v
+			continue
+		}
+		c[k] = nil
+	}
+	return c
+}
+
+// ListRealmTemplates lists all realm templates, ordered by name.
+func (db *Database) ListRealmTemplates(p *pagination.PageParams, scopes ...Scope) ([]*RealmTemplate, *pagination.Paginator, error) {
+	var templates []*RealmTemplate
+	query := db.db.
+		Model(&RealmTemplate{}).
+		Scopes(scopes...).
+		Order("LOWER(name)")
+
+	if p == nil {
+		p = new(pagination.PageParams)
+	}
+
+	paginator, err := Paginate(query, &templates, p.Page, p.Limit)
+	if err != nil {
+		if IsNotFound(err) {
+			return templates, nil, nil
+		}
+		return nil, nil, err
+	}
+
+	return templates, paginator, nil
+}
+
+// FindRealmTemplate finds the realm template by the given id.
+func (db *Database) FindRealmTemplate(id interface{}) (*RealmTemplate, error) {
+	var template RealmTemplate
+	if err := db.db.
+		Model(&RealmTemplate{}).
+		Where("id = ?", id).
+		First(&template).
+		Error; err != nil {
+		return nil, err
+	}
+	return &template, nil
+}
+
+// SaveRealmTemplate saves the realm template.
+func (db *Database) SaveRealmTemplate(t *RealmTemplate, actor Auditable) error {
+	if t == nil {
+		return fmt.Errorf("provided realm template is nil")
+	}
+
+	if actor == nil {
+		return fmt.Errorf("auditing actor is nil")
+	}
+
+	return db.db.Transaction(func(tx *gorm.DB) error {
+		var audits []*AuditEntry
+
+		var existing RealmTemplate
+		if err := tx.
+			Model(&RealmTemplate{}).
+			Where("id = ?", t.ID).
+			First(&existing).
+			Error; err != nil && !IsNotFound(err) {
+			return fmt.Errorf("failed to get existing realm template: %w", err)
+		}
+
+		// Save the template
+		if err := tx.Save(t).Error; err != nil {
+			return err
+		}
+
+		// Brand new template?
+		if existing.ID == 0 {
+			audit := BuildAuditEntry(actor, "created realm template", t, 0)
+			audits = append(audits, audit)
+		} else {
+			if existing.Name != t.Name {
+				audit := BuildAuditEntry(actor, "updated realm template name", t, 0)
+				audit.Diff = stringDiff(existing.Name, t.Name)
+				audit.AddChange("Name", existing.Name, t.Name)
+				audits = append(audits, audit)
+			}
+
+			if existing.Description != t.Description {
+				audit := BuildAuditEntry(actor, "updated realm template description", t, 0)
+				audit.Diff = stringDiff(existing.Description, t.Description)
+				audit.AddChange("Description", existing.Description, t.Description)
+				audits = append(audits, audit)
+			}
+
+			if old, new := existing.Settings(), t.Settings(); !reflect.DeepEqual(old, new) {
+				audit := BuildAuditEntry(actor, "updated realm template settings", t, 0)
+				audit.Diff = stringSliceDiff(old, new)
+				audit.AddChange("Settings", old, new)
+				audits = append(audits, audit)
+			}
+		}
+
+		// Save all audits
+		for _, audit := range audits {
+			if err := tx.Save(audit).Error; err != nil {
+				return fmt.Errorf("failed to save audits: %w", err)
+			}
+		}
+
+		return nil
+	})
+}
+
+// DeleteRealmTemplate deletes the realm template. Realms created from the
+// template are not affected.
+func (db *Database) DeleteRealmTemplate(t *RealmTemplate, actor Auditable) error {
+	if t == nil {
+		return fmt.Errorf("provided realm template is nil")
+	}
+
+	if actor == nil {
+		return fmt.Errorf("auditing actor is nil")
+	}
+
+	return db.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(t).Error; err != nil {
+			return err
+		}
+
+		audit := BuildAuditEntry(actor, "deleted realm template", t, 0)
+		if err := tx.Save(audit).Error; err != nil {
+			return fmt.Errorf("failed to save audits: %w", err)
+		}
+		return nil
+	})
+}
+
+func (t *RealmTemplate) AuditID() string {
+	return fmt.Sprintf("realm_templates:%d", t.ID)
+}
+
+func (t *RealmTemplate) AuditDisplay() string {
+	return t.Name
+}
@@ -0,0 +1,224 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jinzhu/gorm/dialects/postgres"
+)
+
+func TestRealmTemplate_BeforeSave(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		structField string
+		field       string
+	}{
+		{"Name", "name"},
+		{"CodeLength", "codeLength"},
+		{"LongCodeLength", "longCodeLength"},
+		{"SMSTextTemplate", "smsTextTemplate"},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.field, func(t *testing.T) {
+			t.Parallel()
+			exerciseValidation(t, &RealmTemplate{}, tc.structField, tc.field)
+		})
+	}
+}
+
+func TestRealmTemplate_ApplyTo(t *testing.T) {
+	t.Parallel()
+
+	spanish := "Su código es [code]"
+
+	source := NewRealmWithDefaults("source")
+	source.RegionCode = "US-WA"
+	source.CodeLength = 6
+	source.CodeDuration = FromDuration(30 * time.Minute)
+	source.SMSTextTemplate = "Your code is [code]"
+	source.SMSTextAlternateTemplates = postgres.Hstore{"es": &spanish}
+	source.MFAMode = MFARequired
+	source.EmailVerifiedMode = MFAOptional
+	source.AllowedTestTypes = TestTypeConfirmed
+	source.AbusePreventionEnabled = true
+	source.AbusePreventionLimitFactor = 1.5
+
+	tmpl := NewRealmTemplateFromRealm("template", source)
+	if got, want := tmpl.Name, "template"; got != want {
+		t.Errorf("expected name %q to be %q", got, want)
+	}
+
+	// Mutating the source must not change the template.
+	*source.SMSTextAlternateTemplates["es"] = "changed"
+
+	realm := NewRealmWithDefaults("new")
+	tmpl.ApplyTo(realm)
+
+	if got, want := realm.Name, "new"; got != want {
+		t.Errorf("expected name %q to be %q", got, want)
+	}
+	if got, want := realm.RegionCode, ""; got != want {
+		t.Errorf("expected region code %q to be %q", got, want)
+	}
+	if got, want := realm.CodeLength, uint(6); got != want {
+		t.Errorf("expected code length %d to be %d", got, want)
+	}
+	if got, want := realm.CodeDuration, FromDuration(30*time.Minute); got != want {
+		t.Errorf("expected code duration %v to be %v", got, want)
+	}
+	if got, want := realm.SMSTextTemplate, "Your code is [code]"; got != want {
+		t.Errorf("expected sms template %q to be %q", got, want)
+	}
+	if got, want := stringValue(realm.SMSTextAlternateTemplates["es"]), "Su código es [code]"; got != want {
+		t.Errorf("expected alternate template %q to be %q", got, want)
+	}
+	if got, want := realm.MFAMode, MFARequired; got != want {
+		t.Errorf("expected mfa mode %v to be %v", got, want)
+	}
+	if got, want := realm.EmailVerifiedMode, MFAOptional; got != want {
+		t.Errorf("expected email verified mode %v to be %v", got, want)
+	}
+	if got, want := realm.AllowedTestTypes, TestTypeConfirmed; got != want {
+		t.Errorf("expected test types %v to be %v", got, want)
+	}
+	if !realm.AbusePreventionEnabled {
+		t.Errorf("expected abuse prevention to be enabled")
+	}
+	if got, want := realm.AbusePreventionLimitFactor, float32(1.5); got != want {
+		t.Errorf("expected limit factor %v to be %v", got, want)
+	}
+}
+
+func TestRealm_Clone(t *testing.T) {
+	t.Parallel()
+
+	source := NewRealmWithDefaults("source")
+	source.ID = 5
+	source.RegionCode = "US-WA"
+	source.CertificateIssuer = "iss"
+	source.CertificateAudience = "aud"
+	source.UseRealmCertificateKey = true
+	source.AbusePreventionLimit = 500
+	source.CodeLength = 7
+	source.AllowedCIDRsServer = []string{"10.0.0.0/8"}
+
+	clone := source.Clone("clone")
+
+	if got, want := clone.ID, uint(0); got != want {
+		t.Errorf("expected id %d to be %d", got, want)
+	}
+	if got, want := clone.Name, "clone"; got != want {
+		t.Errorf("expected name %q to be %q", got, want)
+	}
+	if got, want := clone.RegionCode, ""; got != want {
+		t.Errorf("expected region code %q to be %q", got, want)
+	}
+	if got, want := clone.CertificateIssuer, ""; got != want {
+		t.Errorf("expected issuer %q to be %q", got, want)
+	}
+	if got, want := clone.CertificateAudience, "aud"; got != want {
+		t.Errorf("expected audience %q to be %q", got, want)
+	}
+	if !clone.UseRealmCertificateKey {
+		t.Errorf("expected realm certificate key to be copied")
+	}
+	if got, want := clone.AbusePreventionLimit, uint(0); got != want {
+		t.Errorf("expected abuse prevention limit %d to be %d", got, want)
+	}
+	if got, want := clone.CodeLength, uint(7); got != want {
+		t.Errorf("expected code length %d to be %d", got, want)
+	}
+
+	// Slices must not be shared.
+	clone.AllowedCIDRsServer[0] = "0.0.0.0/0"
+	if got, want := []string(source.AllowedCIDRsServer), []string{"10.0.0.0/8"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected source cidrs %v to be %v", got, want)
+	}
+}
+
+func TestDatabase_SaveRealmTemplate(t *testing.T) {
+	t.Parallel()
+
+	db, _ := testDatabaseInstance.NewDatabase(t, nil)
+
+	realm := NewRealmWithDefaults("source")
+	realm.CodeLength = 7
+	if err := db.SaveRealm(realm, SystemTest); err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl := NewRealmTemplateFromRealm("template", realm)
+	if err := db.SaveRealmTemplate(tmpl, SystemTest); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := db.FindRealmTemplate(tmpl.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := got.Settings(), tmpl.Settings(); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v to be %v", got, want)
+	}
+
+	realm.CodeLength = 8
+	tmpl.CopyFrom(realm)
+	if err := db.SaveRealmTemplate(tmpl, SystemTest); err != nil {
+		t.Fatal(err)
+	}
+
+	templates, _, err := db.ListRealmTemplates(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(templates), 1; got != want {
+		t.Fatalf("expected %d templates, got %d", want, got)
+	}
+	if got, want := templates[0].CodeLength, uint(8); got != want {
+		t.Errorf("expected code length %d to be %d", got, want)
+	}
+
+	audits, _, err := db.ListAudits(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var actions []string
+	for _, a := range audits {
+		if a.TargetID == tmpl.AuditID() {
+			actions = append(actions, a.Action)
+		}
+	}
+	if got, want := len(actions), 2; got != want {
+		t.Errorf("expected %d template audits, got %v", want, actions)
+	}
+
+	if err := db.DeleteRealmTemplate(tmpl, SystemTest); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.FindRealmTemplate(tmpl.ID); !IsNotFound(err) {
+		t.Errorf("expected not found, got %v", err)
+	}
+
+	// The name can be reused after deletion.
+	if err := db.SaveRealmTemplate(NewRealmTemplateFromRealm("template", realm), SystemTest); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -25,6 +25,7 @@ import (
 
 	"github.com/google/exposure-notifications-server/pkg/timeutils"
 	"github.com/google/exposure-notifications-verification-server/internal/project"
+	"github.com/google/exposure-notifications-verification-server/pkg/keyutils"
 	"github.com/jinzhu/gorm"
 )
 
@@ -368,6 +369,67 @@ func TestRealm_BeforeSave(t *testing.T) {
 			},
 			Error: "certificateAudience cannot be blank",
 		},
+		{
+			Name: "certificate_key_rotation_requires_realm_key",
+			Input: &Realm{
+				UseRealmCertificateKey:           false,
+				CertificateKeyRotationPeriodDays: 30,
+			},
+			Error: "certificateKeyRotationPeriodDays requires realm-specific signing keys",
+		},
+		{
+			Name: "certificate_key_rotation_overlap_too_long",
+			Input: &Realm{
+				UseRealmCertificateKey:             true,
+				CertificateKeyRotationPeriodDays:   1,
+				CertificateKeyRotationOverlapHours: 24,
+			},
+			Error: "certificateKeyRotationOverlapHours must be less than the rotation period",
+		},
+		{
+			Name: "certificate_key_rotation_period_too_large",
+			Input: &Realm{
+				UseRealmCertificateKey:           true,
+				CertificateKeyRotationPeriodDays: MaxCertificateKeyRotationPeriodDays + 1,
+			},
+			Error: "certificateKeyRotationPeriodDays must be 365 or less",
+		},
+		{
+			Name: "certificate_key_rotation_overlap_too_large",
+			Input: &Realm{
+				UseRealmCertificateKey:             true,
+				CertificateKeyRotationOverlapHours: MaxCertificateKeyRotationOverlapHours + 1,
+			},
+			Error: "certificateKeyRotationOverlapHours must be 720 or less",
+		},
+		{
+			Name: "invalid_timezone",
+			Input: &Realm{
+				Timezone: "Mars/Olympus_Mons",
+			},
+			Error: "timezone is not a valid timezone",
+		},
+		{
+			Name: "public_stats_min_count_too_large",
+			Input: &Realm{
+				PublicStatsMinCount: MaxPublicStatsMinCount + 1,
+			},
+			Error: "publicStatsMinCount must be 1000 or less",
+		},
+		{
+			Name: "public_stats_epsilon_negative",
+			Input: &Realm{
+				PublicStatsEpsilon: -1,
+			},
+			Error: "publicStatsEpsilon must be between 0 and 10",
+		},
+		{
+			Name: "invalid_identity_provider",
+			Input: &Realm{
+				IdentityProvider: "Azure AD",
+			},
+			Error: "identityProvider is not a valid identity provider name",
+		},
 	}
 
 	for _, tc := range cases {
@@ -449,6 +511,38 @@ func TestRealm_BuildVerifyEmail(t *testing.T) {
 	}
 }
 
+func TestRealm_StatsDate(t *testing.T) {
+	t.Parallel()
+
+	// 2020-12-01 03:30 UTC is still the evening of November 30 in Los Angeles
+	// and already the afternoon of December 1 in Auckland.
+	now := time.Date(2020, 12, 1, 3, 30, 0, 0, time.UTC)
+
+	cases := []struct {
+		timezone string
+		want     time.Time
+	}{
+		{"", time.Date(2020, 12, 1, 0, 0, 0, 0, time.UTC)},
+		{"UTC", time.Date(2020, 12, 1, 0, 0, 0, 0, time.UTC)},
+		{"America/Los_Angeles", time.Date(2020, 11, 30, 0, 0, 0, 0, time.UTC)},
+		{"Pacific/Auckland", time.Date(2020, 12, 1, 0, 0, 0, 0, time.UTC)},
+		{"not/a/timezone", time.Date(2020, 12, 1, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.timezone, func(t *testing.T) {
+			t.Parallel()
+
+			realm := &Realm{Timezone: tc.timezone}
+			if got, want := realm.StatsDate(now), tc.want; !got.Equal(want) {
+				t.Errorf("expected %s to be %s", got, want)
+			}
+		})
+	}
+}
+
 func TestRealm_UserStats(t *testing.T) {
 	t.Parallel()
 
@@ -577,17 +671,17 @@ func TestRealm_CreateSigningKeyVersion(t *testing.T) {
 	}
 
 	// First creates ok
-	if _, err := realm1.CreateSigningKeyVersion(ctx, db); err != nil {
+	if _, err := realm1.CreateSigningKeyVersion(ctx, db, keyutils.AlgorithmES256); err != nil {
 		t.Fatal(err)
 	}
 
 	// Second creates ok
-	if _, err := realm1.CreateSigningKeyVersion(ctx, db); err != nil {
+	if _, err := realm1.CreateSigningKeyVersion(ctx, db, keyutils.AlgorithmES256); err != nil {
 		t.Fatal(err)
 	}
 
 	// Third fails over quota
-	_, err := realm1.CreateSigningKeyVersion(ctx, db)
+	_, err := realm1.CreateSigningKeyVersion(ctx, db, keyutils.AlgorithmES256)
 	if err == nil {
 		t.Fatal("expected error")
 	}
@@ -608,9 +702,29 @@ func TestRealm_CreateSigningKeyVersion(t *testing.T) {
 	}
 
 	// Third should succeed now
-	if _, err := realm1.CreateSigningKeyVersion(ctx, db); err != nil {
+	if _, err := realm1.CreateSigningKeyVersion(ctx, db, keyutils.AlgorithmES256); err != nil {
 		t.Fatal(err)
 	}
+
+	// Unsupported algorithms are rejected
+	realm2 := NewRealmWithDefaults("realm2")
+	if err := db.SaveRealm(realm2, SystemTest); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := realm2.CreateSigningKeyVersion(ctx, db, keyutils.Algorithm("HS256")); err == nil {
+		t.Fatal("expected error")
+	}
+
+	// New keys record their algorithm
+	list, err = realm1.ListSigningKeys(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range list {
+		if got, want := key.SigningAlgorithm(), keyutils.AlgorithmES256; got != want {
+			t.Errorf("expected %q to be %q", got, want)
+		}
+	}
 }
 
 func TestRealm_SMSConfig(t *testing.T) {
@@ -0,0 +1,95 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"sort"
+	"time"
+)
+
+// RetentionOverrides is a map of realm ID to the maximum age of a type of
+// record in that realm. Realms which are not in the map use the default
+// maximum age.
+type RetentionOverrides map[uint]time.Duration
+
+// RealmIDs returns the sorted list of realm IDs with an override.
+func (o RetentionOverrides) RealmIDs() []uint {
+	ids := make([]uint, 0, len(o))
+	for id := range o {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+// RealmsWithRetentionOverrides returns the realms which override the system
+// retention of verification codes, audit entries, or access entries.
+func (db *Database) RealmsWithRetentionOverrides() ([]*Realm, error) {
+	var realms []*Realm
+	if err := db.db.
+		Model(&Realm{}).
+		Where("verification_code_retention_days > 0 OR audit_entry_retention_days > 0 OR access_entry_retention_days > 0").
+		Order("id").
+		Find(&realms).
+		Error; err != nil {
+		if IsNotFound(err) {
+			return realms, nil
+		}
+		return nil, err
+	}
+	return realms, nil
+}
+
+// CountPurgeableVerificationCodes returns the number of the realm's
+// verification codes which would be purged with the given maximum age.
+func (r *Realm) CountPurgeableVerificationCodes(db *Database, maxAge time.Duration) (int64, error) {
+	deleteBefore := time.Now().UTC().Add(-absDuration(maxAge))
+
+	var count int64
+	if err := db.db.
+		Model(&VerificationCode{}).
+		Unscoped().
+		Where("realm_id = ?", r.ID).
+		Where("expires_at < ? AND long_expires_at < ?", deleteBefore, deleteBefore).
+		Count(&count).
+		Error; err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// CountPurgeableAuditEntries returns the number of the realm's audit entries
+// which would be purged with the given maximum age.
+func (r *Realm) CountPurgeableAuditEntries(db *Database, maxAge time.Duration) (int64, error) {
+	createdBefore := time.Now().UTC().Add(-absDuration(maxAge))
+
+	var count int64
+	if err := db.db.
+		Model(&AuditEntry{}).
+		Where("realm_id = ?", r.ID).
+		Where("created_at < ?", createdBefore).
+		Count(&count).
+		Error; err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+func absDuration(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
@@ -15,7 +15,11 @@
 package database
 
 import (
+	"strings"
+	"time"
+
 	"github.com/google/exposure-notifications-verification-server/internal/project"
+	"github.com/google/exposure-notifications-verification-server/pkg/rbac"
 	"github.com/jinzhu/gorm"
 )
 
@@ -44,22 +48,86 @@ func WithUserSearch(q string) Scope {
 	}
 }
 
-// WithAuditTime returns a scope that adds querying for Audit events by time.
-func WithAuditTime(from, to string) Scope {
+// WithPermissions returns a scope that restricts the query to memberships which
+// have all of the given permissions. It's only applicable to functions that
+// query Membership.
+func WithPermissions(p rbac.Permission) Scope {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("memberships.permissions & ? = ?", int64(p), int64(p))
+	}
+}
+
+// WithAuditCreatedBetween returns a scope that adds querying for Audit events
+// created between from and to, inclusive. A zero time is unbounded.
+func WithAuditCreatedBetween(from, to time.Time) Scope {
 	return func(db *gorm.DB) *gorm.DB {
-		from = project.TrimSpace(from)
-		if from != "" {
+		if !from.IsZero() {
 			db = db.Where("audit_entries.created_at >= ?", from)
 		}
-
-		to = project.TrimSpace(to)
-		if to != "" {
+		if !to.IsZero() {
 			db = db.Where("audit_entries.created_at <= ?", to)
 		}
 		return db
 	}
 }
 
+// WithAuditActorID returns a scope that adds querying for Audit events by the
+// actor's audit ID (e.g. users:1).
+func WithAuditActorID(id string) Scope {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("audit_entries.actor_id = ?", project.TrimSpace(id))
+	}
+}
+
+// WithAuditAction returns a scope that adds querying for Audit events by
+// action.
+func WithAuditAction(action string) Scope {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("audit_entries.action = ?", project.TrimSpace(action))
+	}
+}
+
+// WithAuditTargetID returns a scope that adds querying for Audit events by the
+// target's audit ID (e.g. realms:1).
+func WithAuditTargetID(id string) Scope {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("audit_entries.target_id = ?", project.TrimSpace(id))
+	}
+}
+
+// likeEscaper escapes the LIKE wildcards and escape character.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// WithAuditSearch returns a scope that adds querying for Audit events by actor
+// display, action, and target display, case-insensitive. The search term is
+// matched literally, so % and _ are not wildcards.
+func WithAuditSearch(q string) Scope {
+	return func(db *gorm.DB) *gorm.DB {
+		q = project.TrimSpace(q)
+		if q != "" {
+			q = `%` + likeEscaper.Replace(q) + `%`
+			return db.Where("(audit_entries.actor_display ILIKE ? OR audit_entries.action ILIKE ? OR audit_entries.target_display ILIKE ?)", q, q, q)
+		}
+		return db
+	}
+}
+
+// WithAccessActorID returns a scope that adds querying for access entries by
+// the actor's audit ID (e.g. users:1).
+func WithAccessActorID(id string) Scope {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("access_entries.actor_id = ?", project.TrimSpace(id))
+	}
+}
+
+// WithAccessAction returns a scope that adds querying for access entries by
+// action.
+func WithAccessAction(action string) Scope {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("access_entries.action = ?", project.TrimSpace(action))
+	}
+}
+
 // WithAuditRealmID returns a scope that adds querying for Audit events by
 // realm. The provided ID is expected to be stringable (int, uint, string).
 func WithAuditRealmID(id uint) Scope {
@@ -110,6 +178,19 @@ func WithAuthorizedAppSearch(q string) Scope {
 	}
 }
 
+// WithSiteSearch returns a scope that adds querying for sites by name,
+// case-insensitive. It's only applicable to functions that query Site.
+func WithSiteSearch(q string) Scope {
+	return func(db *gorm.DB) *gorm.DB {
+		q = project.TrimSpace(q)
+		if q != "" {
+			q = `%` + q + `%`
+			return db.Where("sites.name ILIKE ?", q)
+		}
+		return db
+	}
+}
+
 // WithMobileAppSearch returns a scope that adds querying for mobile apps by
 // name, case-insensitive. It's only applicable to functions that query
 // MobileApp.
@@ -16,10 +16,14 @@ package database
 
 import (
 	"fmt"
+	"time"
 
+	"github.com/google/exposure-notifications-verification-server/pkg/keyutils"
 	"github.com/jinzhu/gorm"
 )
 
+var _ Auditable = (*SigningKey)(nil)
+
 // SigningKey represents a reference to a KMS backed signing key
 // version for verification certificate signing.
 type SigningKey struct {
@@ -32,9 +36,80 @@ type SigningKey struct {
 	// Reference to an exact version of a key in the KMS
 	KeyID  string
 	Active bool
+
+	// Algorithm is the JWS signing algorithm of the key. Keys created before
+	// algorithms were tracked are ES256.
+	Algorithm string `gorm:"type:varchar(16); not null; default:'ES256';"`
+
+	// ActivatedAt is the time at which the key most recently became active.
+	// DeactivatedAt is the time at which the key was superseded by another key.
+	// These are used to drive automatic rotation and may be nil for keys which
+	// have never been active or predate tracking.
+	ActivatedAt   *time.Time
+	DeactivatedAt *time.Time
+}
+
+// ActiveSince returns the time at which this key became active. If the
+// activation time was not recorded, it falls back to the creation time.
+func (s *SigningKey) ActiveSince() time.Time {
+	if s.ActivatedAt != nil {
+		return *s.ActivatedAt
+	}
+	return s.CreatedAt
+}
+
+// SigningAlgorithm returns the parsed signing algorithm, defaulting to ES256
+// for unknown values.
+func (s *SigningKey) SigningAlgorithm() keyutils.Algorithm {
+	alg, err := keyutils.ParseAlgorithm(s.Algorithm)
+	if err != nil {
+		return keyutils.AlgorithmES256
+	}
+	return alg
 }
 
 // GetKID returns the 'kid' field value to use in signing JWTs.
 func (s *SigningKey) GetKID() string {
 	return fmt.Sprintf("r%dv%d", s.RealmID, s.ID)
 }
+
+// parseSigningKeyKID parses a 'kid' created by GetKID into the realm ID and
+// signing key ID.
+func parseSigningKeyKID(kid string) (uint, uint, error) {
+	var realmID, id uint
+	if n, err := fmt.Sscanf(kid, "r%dv%d", &realmID, &id); err != nil || n != 2 {
+		return 0, 0, fmt.Errorf("invalid kid %q", kid)
+	}
+	if got, want := kid, fmt.Sprintf("r%dv%d", realmID, id); got != want {
+		return 0, 0, fmt.Errorf("invalid kid %q", kid)
+	}
+	return realmID, id, nil
+}
+
+// FindSigningKeyByKID finds the realm signing key with the given 'kid', as
+// returned by GetKID. Destroyed keys are not returned.
+func (db *Database) FindSigningKeyByKID(kid string) (*SigningKey, error) {
+	realmID, id, err := parseSigningKeyKID(kid)
+	if err != nil {
+		return nil, gorm.ErrRecordNotFound
+	}
+
+	var key SigningKey
+	if err := db.db.
+		Model(&SigningKey{}).
+		Where("realm_id = ?", realmID).
+		Where("id = ?", id).
+		First(&key).
+		Error; err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+func (s *SigningKey) AuditID() string {
+	return fmt.Sprintf("signing_keys:%d", s.ID)
+}
+
+func (s *SigningKey) AuditDisplay() string {
+	return s.GetKID()
+}
@@ -0,0 +1,90 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestParseSigningKeyKID(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name    string
+		kid     string
+		realmID uint
+		id      uint
+		err     bool
+	}{
+		{name: "valid", kid: "r1v12", realmID: 1, id: 12},
+		{name: "empty", kid: "", err: true},
+		{name: "system", kid: "v1", err: true},
+		{name: "trailing", kid: "r1v12x", err: true},
+		{name: "leading_zero", kid: "r01v12", err: true},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			realmID, id, err := parseSigningKeyKID(tc.kid)
+			if (err != nil) != tc.err {
+				t.Fatalf("expected error to be %t, got %v", tc.err, err)
+			}
+			if got, want := realmID, tc.realmID; got != want {
+				t.Errorf("expected %d to be %d", got, want)
+			}
+			if got, want := id, tc.id; got != want {
+				t.Errorf("expected %d to be %d", got, want)
+			}
+		})
+	}
+}
+
+func TestDatabase_FindSigningKeyByKID(t *testing.T) {
+	t.Parallel()
+
+	db, _ := testDatabaseInstance.NewDatabase(t, nil)
+
+	realm := NewRealmWithDefaults("realm")
+	if err := db.SaveRealm(realm, SystemTest); err != nil {
+		t.Fatal(err)
+	}
+
+	key := &SigningKey{RealmID: realm.ID, KeyID: "foo", Active: true}
+	if err := db.db.Save(key).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := db.FindSigningKeyByKID(key.GetKID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ID != key.ID {
+		t.Errorf("expected %d to be %d", got.ID, key.ID)
+	}
+
+	// Right id, wrong realm.
+	if _, err := db.FindSigningKeyByKID(fmt.Sprintf("r%dv%d", realm.ID+1, key.ID)); !IsNotFound(err) {
+		t.Errorf("expected not found, got %v", err)
+	}
+
+	if _, err := db.FindSigningKeyByKID("nope"); !IsNotFound(err) {
+		t.Errorf("expected not found, got %v", err)
+	}
+}
@@ -0,0 +1,408 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/google/exposure-notifications-verification-server/internal/project"
+	"github.com/google/exposure-notifications-verification-server/pkg/cache"
+	"github.com/google/exposure-notifications-verification-server/pkg/pagination"
+	"github.com/jinzhu/gorm"
+)
+
+// ErrSiteDailyCodeLimitReached is the error returned when a code cannot be
+// issued at a site because the site has reached its daily code limit.
+var ErrSiteDailyCodeLimitReached = errors.New("site has reached its daily code limit")
+
+var _ Auditable = (*Site)(nil)
+
+// Site is a testing site or other location within a realm where codes are
+// issued. Codes issued at a site are attributed to it for statistics and
+// counted against its daily limit.
+type Site struct {
+	gorm.Model
+	Errorable
+
+	// RealmID is the id of the realm to which this site belongs.
+	RealmID uint `gorm:"column:realm_id; type:integer; not null;"`
+
+	// Name is the name of the site. It is unique within the realm.
+	Name string `gorm:"column:name; type:citext; not null;"`
+
+	// Description is optional information about the site, such as its address.
+	Description string `gorm:"column:description; type:text;"`
+
+	// DailyCodeLimit is the maximum number of codes that can be issued at this
+	// site per day in the realm's timezone. Zero means no limit.
+	DailyCodeLimit uint `gorm:"column:daily_code_limit; type:integer; not null; default:0;"`
+}
+
+// BeforeSave runs validations. If there are errors, the save fails.
+func (s *Site) BeforeSave(tx *gorm.DB) error {
+	s.Name = project.TrimSpace(s.Name)
+	if s.Name == "" {
+		s.AddError("name", "cannot be blank")
+	}
+	if len(s.Name) > 255 {
+		s.AddError("name", "cannot exceed 255 characters")
+	}
+
+	if s.RealmID == 0 {
+		s.AddError("realm_id", "is required")
+	}
+
+	if s.Name != "" && s.RealmID != 0 {
+		var count int
+		if err := tx.
+			Unscoped().
+			Model(&Site{}).
+			Where("realm_id = ? AND name = ? AND id != ?", s.RealmID, s.Name, s.ID).
+			Count(&count).
+			Error; err != nil {
+			return fmt.Errorf("failed to check site name: %w", err)
+		}
+		if count > 0 {
+			s.AddError("name", "is already in use")
+		}
+	}
+
+	s.Description = project.TrimSpace(s.Description)
+
+	return s.ErrorOrNil()
+}
+
+// IsActive returns true if the site has not been disabled.
+func (s *Site) IsActive() bool {
+	return s.DeletedAt == nil
+}
+
+// HasDailyCodeLimit returns true if the site has a daily code limit.
+func (s *Site) HasDailyCodeLimit() bool {
+	return s.DailyCodeLimit > 0
+}
+
+// CodesIssuedToday returns the number of codes issued at this site since
+// midnight in the realm's timezone.
+func (s *Site) CodesIssuedToday(db *Database) (uint, error) {
+	var stat SiteStat
+	if err := db.db.
+		Model(&SiteStat{}).
+		Where("site_id = ?", s.ID).
+		Where("date = ?", statsDate(time.Now(), db.realmLocation(s.RealmID))).
+		First(&stat).
+		Error; err != nil {
+		if IsNotFound(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	return stat.CodesIssued, nil
+}
+
+// DailyCodeLimitReached returns true if the site has a daily code limit and
+// that many codes have already been issued today. This is only an early check:
+// the limit is enforced when the code is saved, since concurrent requests can
+// all pass this check.
+func (s *Site) DailyCodeLimitReached(db *Database) (bool, error) {
+	if !s.HasDailyCodeLimit() {
+		return false, nil
+	}
+
+	issued, err := s.CodesIssuedToday(db)
+	if err != nil {
+		return false, fmt.Errorf("failed to count codes issued today: %w", err)
+	}
+	return issued >= s.DailyCodeLimit, nil
+}
+
+// Stats returns the 30-day usage statistics for this site. If no stats exist,
+// returns an empty slice.
+func (s *Site) Stats(db *Database) (SiteStats, error) {
+	stop := statsDate(time.Now(), db.realmLocation(s.RealmID))
+	start := stop.Add(30 * -24 * time.Hour)
+	if start.After(stop) {
+		return nil, ErrBadDateRange
+	}
+
+	sql := `
+		SELECT
+			d.date AS date,
+			$1 AS realm_id,
+			$2 AS site_id,
+			$3 AS site_name,
+			COALESCE(s.codes_issued, 0) AS codes_issued
+		FROM (
+			SELECT date::date FROM generate_series($4, $5, '1 day'::interval) date
+		) d
+		LEFT JOIN site_stats s ON s.site_id = $2 AND s.date = d.date
+		ORDER BY date DESC`
+
+	var stats []*SiteStat
+	if err := db.db.Raw(sql, s.RealmID, s.ID, s.Name, start, stop).Scan(&stats).Error; err != nil {
+		if IsNotFound(err) {
+			return stats, nil
+		}
+		return nil, err
+	}
+	return stats, nil
+}
+
+// StatsCached is stats, but cached.
+func (s *Site) StatsCached(ctx context.Context, db *Database, cacher cache.Cacher) (SiteStats, error) {
+	if cacher == nil {
+		return nil, fmt.Errorf("cacher cannot be nil")
+	}
+
+	var stats SiteStats
+	cacheKey := &cache.Key{
+		Namespace: "stats:site",
+		Key:       strconv.FormatUint(uint64(s.ID), 10),
+	}
+	if err := cacher.Fetch(ctx, cacheKey, &stats, 30*time.Minute, func() (interface{}, error) {
+		return s.Stats(db)
+	}); err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// ListSites lists the sites for this realm, including disabled sites.
+func (r *Realm) ListSites(db *Database, p *pagination.PageParams, scopes ...Scope) ([]*Site, *pagination.Paginator, error) {
+	var sites []*Site
+	query := db.db.
+		Unscoped().
+		Model(&Site{}).
+		Scopes(scopes...).
+		Where("realm_id = ?", r.ID).
+		Order("sites.deleted_at DESC, LOWER(sites.name)")
+
+	if p == nil {
+		p = new(pagination.PageParams)
+	}
+
+	paginator, err := Paginate(query, &sites, p.Page, p.Limit)
+	if err != nil {
+		if IsNotFound(err) {
+			return sites, nil, nil
+		}
+		return nil, nil, err
+	}
+
+	return sites, paginator, nil
+}
+
+// ListActiveSites lists all sites for this realm which are not disabled,
+// ordered by name.
+func (r *Realm) ListActiveSites(db *Database) ([]*Site, error) {
+	var sites []*Site
+	if err := db.db.
+		Model(&Site{}).
+		Where("realm_id = ?", r.ID).
+		Order("LOWER(name)").
+		Find(&sites).
+		Error; err != nil {
+		if IsNotFound(err) {
+			return sites, nil
+		}
+		return nil, err
+	}
+	return sites, nil
+}
+
+// FindSite finds the site by the given id associated with the realm. Disabled
+// sites are included.
+func (r *Realm) FindSite(db *Database, id interface{}) (*Site, error) {
+	var site Site
+	if err := db.db.
+		Unscoped().
+		Model(&Site{}).
+		Where("id = ?", id).
+		Where("realm_id = ?", r.ID).
+		First(&site).
+		Error; err != nil {
+		return nil, err
+	}
+	return &site, nil
+}
+
+// SiteStats returns the 30-day stats for every site in this realm which issued
+// codes in that period. If no stats exist, returns an empty slice.
+func (r *Realm) SiteStats(db *Database) (SiteStats, error) {
+	stop := r.StatsDate(time.Now())
+	start := stop.Add(30 * -24 * time.Hour)
+	if start.After(stop) {
+		return nil, ErrBadDateRange
+	}
+
+	// Like external issuer stats, generate the full date range for every site
+	// with data in the range so there are zero values for graphs.
+	sql := `
+		SELECT
+			d.date AS date,
+			$1 AS realm_id,
+			d.site_id AS site_id,
+			d.site_name AS site_name,
+			COALESCE(s.codes_issued, 0) AS codes_issued
+		FROM (
+			SELECT
+				d.date AS date,
+				i.site_id AS site_id,
+				i.site_name AS site_name
+			FROM generate_series($2, $3, '1 day'::interval) d
+			CROSS JOIN (
+				SELECT DISTINCT ss.site_id AS site_id, sites.name AS site_name
+				FROM site_stats ss
+				JOIN sites ON sites.id = ss.site_id
+				WHERE ss.realm_id = $1 AND ss.date >= $2 AND ss.date <= $3
+			) AS i
+		) d
+		LEFT JOIN site_stats s ON s.site_id = d.site_id AND s.date = d.date
+		ORDER BY date DESC, site_name`
+
+	var stats []*SiteStat
+	if err := db.db.Raw(sql, r.ID, start, stop).Scan(&stats).Error; err != nil {
+		if IsNotFound(err) {
+			return stats, nil
+		}
+		return nil, err
+	}
+	return stats, nil
+}
+
+// SiteStatsCached is SiteStats, but cached.
+func (r *Realm) SiteStatsCached(ctx context.Context, db *Database, cacher cache.Cacher) (SiteStats, error) {
+	if cacher == nil {
+		return nil, fmt.Errorf("cacher cannot be nil")
+	}
+
+	var stats SiteStats
+	cacheKey := &cache.Key{
+		Namespace: "stats:realm:per_site",
+		Key:       strconv.FormatUint(uint64(r.ID), 10),
+	}
+	if err := cacher.Fetch(ctx, cacheKey, &stats, 30*time.Minute, func() (interface{}, error) {
+		return r.SiteStats(db)
+	}); err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// validateSiteID returns ErrValidationFailed if the site ID is not zero and is
+// not an active site in the realm.
+func validateSiteID(tx *gorm.DB, realmID, siteID uint) error {
+	if siteID == 0 {
+		return nil
+	}
+
+	var count int
+	if err := tx.
+		Model(&Site{}).
+		Where("id = ? AND realm_id = ?", siteID, realmID).
+		Count(&count).
+		Error; err != nil {
+		return fmt.Errorf("failed to find site: %w", err)
+	}
+	if count == 0 {
+		return ErrValidationFailed
+	}
+	return nil
+}
+
+// SaveSite saves the site.
+func (db *Database) SaveSite(s *Site, actor Auditable) error {
+	if s == nil {
+		return fmt.Errorf("provided site is nil")
+	}
+
+	if actor == nil {
+		return fmt.Errorf("auditing actor is nil")
+	}
+
+	return db.db.Transaction(func(tx *gorm.DB) error {
+		var audits []*AuditEntry
+
+		var existing Site
+		if err := tx.
+			Unscoped().
+			Model(&Site{}).
+			Where("id = ?", s.ID).
+			First(&existing).
+			Error; err != nil && !IsNotFound(err) {
+			return fmt.Errorf("failed to get existing site")
+		}
+
+		// Save the site
+		if err := tx.Unscoped().Save(s).Error; err != nil {
+			return err
+		}
+
+		// Brand new site?
+		if existing.ID == 0 {
+			audit := BuildAuditEntry(actor, "created site", s, s.RealmID)
+			audits = append(audits, audit)
+		} else {
+			if existing.Name != s.Name {
+				audit := BuildAuditEntry(actor, "updated site name", s, s.RealmID)
+				audit.Diff = stringDiff(existing.Name, s.Name)
+				audit.AddChange("Name", existing.Name, s.Name)
+				audits = append(audits, audit)
+			}
+
+			if existing.Description != s.Description {
+				audit := BuildAuditEntry(actor, "updated site description", s, s.RealmID)
+				audit.Diff = stringDiff(existing.Description, s.Description)
+				audit.AddChange("Description", existing.Description, s.Description)
+				audits = append(audits, audit)
+			}
+
+			if existing.DailyCodeLimit != s.DailyCodeLimit {
+				audit := BuildAuditEntry(actor, "updated site daily code limit", s, s.RealmID)
+				audit.Diff = uintDiff(existing.DailyCodeLimit, s.DailyCodeLimit)
+				audit.AddChange("DailyCodeLimit", existing.DailyCodeLimit, s.DailyCodeLimit)
+				audits = append(audits, audit)
+			}
+
+			if existing.DeletedAt != s.DeletedAt {
+				audit := BuildAuditEntry(actor, "updated site enabled", s, s.RealmID)
+				audit.Diff = boolDiff(existing.DeletedAt == nil, s.DeletedAt == nil)
+				audit.AddChange("DeletedAt", existing.DeletedAt, s.DeletedAt)
+				audits = append(audits, audit)
+			}
+		}
+
+		// Save all audits
+		for _, audit := range audits {
+			if err := tx.Save(audit).Error; err != nil {
+				return fmt.Errorf("failed to save audits: %w", err)
+			}
+		}
+
+		return nil
+	})
+}
+
+func (s *Site) AuditID() string {
+	return fmt.Sprintf("sites:%d", s.ID)
+}
+
+func (s *Site) AuditDisplay() string {
+	return s.Name
+}
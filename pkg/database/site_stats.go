@@ -0,0 +1,161 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/google/exposure-notifications-verification-server/internal/icsv"
+	"github.com/google/exposure-notifications-verification-server/internal/project"
+)
+
+var _ icsv.Marshaler = (SiteStats)(nil)
+
+// SiteStats is a collection of site stats.
+type SiteStats []*SiteStat
+
+// SiteStat represents statistics related to a site in the database.
+type SiteStat struct {
+	Date        time.Time `gorm:"column:date; type:date;"`
+	RealmID     uint      `gorm:"column:realm_id; type:int;"`
+	SiteID      uint      `gorm:"column:site_id; type:int;"`
+	SiteName    string    `gorm:"column:site_name; type:citext;"`
+	CodesIssued uint      `gorm:"column:codes_issued; type:int;"`
+}
+
+// MarshalCSV returns bytes in CSV format.
+func (s SiteStats) MarshalCSV() ([]byte, error) {
+	// Do nothing if there's no records
+	if len(s) == 0 {
+		return nil, nil
+	}
+
+	var b bytes.Buffer
+	w := csv.NewWriter(&b)
+
+	if err := w.Write([]string{"date", "realm_id", "site_id", "site_name", "codes_issued"}); err != nil {
+		return nil, fmt.Errorf("failed to write CSV header: %w", err)
+	}
+
+	for i, stat := range s {
+		if err := w.Write([]string{
+			stat.Date.Format(project.RFC3339Date),
+			strconv.FormatUint(uint64(stat.RealmID), 10),
+			strconv.FormatUint(uint64(stat.SiteID), 10),
+			stat.SiteName,
+			strconv.FormatUint(uint64(stat.CodesIssued), 10),
+		}); err != nil {
+			return nil, fmt.Errorf("failed to write CSV entry %d: %w", i, err)
+		}
+	}
+
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return nil, fmt.Errorf("failed to create CSV: %w", err)
+	}
+
+	return b.Bytes(), nil
+}
+
+type jsonSiteStat struct {
+	RealmID uint                 `json:"realm_id"`
+	Stats   []*jsonSiteStatStats `json:"statistics"`
+}
+
+type jsonSiteStatStats struct {
+	Date     time.Time               `json:"date"`
+	SiteData []*jsonSiteStatSiteData `json:"site_data"`
+}
+
+type jsonSiteStatSiteData struct {
+	SiteID      uint   `json:"site_id"`
+	SiteName    string `json:"site_name"`
+	CodesIssued uint   `json:"codes_issued"`
+}
+
+// MarshalJSON is a custom JSON marshaller.
+func (s SiteStats) MarshalJSON() ([]byte, error) {
+	// Do nothing if there's no records
+	if len(s) == 0 {
+		return json.Marshal(struct{}{})
+	}
+
+	m := make(map[time.Time][]*jsonSiteStatSiteData)
+	for _, stat := range s {
+		if m[stat.Date] == nil {
+			m[stat.Date] = make([]*jsonSiteStatSiteData, 0, 8)
+		}
+
+		m[stat.Date] = append(m[stat.Date], &jsonSiteStatSiteData{
+			SiteID:      stat.SiteID,
+			SiteName:    stat.SiteName,
+			CodesIssued: stat.CodesIssued,
+		})
+	}
+
+	stats := make([]*jsonSiteStatStats, 0, len(m))
+	for k, v := range m {
+		stats = append(stats, &jsonSiteStatStats{
+			Date:     k,
+			SiteData: v,
+		})
+	}
+
+	// Sort in descending order.
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].Date.After(stats[j].Date)
+	})
+
+	var result jsonSiteStat
+	result.RealmID = s[0].RealmID
+	result.Stats = stats
+
+	b, err := json.Marshal(result)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal json: %w", err)
+	}
+	return b, nil
+}
+
+func (s *SiteStats) UnmarshalJSON(b []byte) error {
+	if len(b) == 0 {
+		return nil
+	}
+
+	var result jsonSiteStat
+	if err := json.Unmarshal(b, &result); err != nil {
+		return err
+	}
+
+	for _, stat := range result.Stats {
+		for _, r := range stat.SiteData {
+			*s = append(*s, &SiteStat{
+				Date:        stat.Date,
+				RealmID:     result.RealmID,
+				SiteID:      r.SiteID,
+				SiteName:    r.SiteName,
+				CodesIssued: r.CodesIssued,
+			})
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,112 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSiteStats_MarshalCSV(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name  string
+		stats SiteStats
+		exp   string
+	}{
+		{
+			name:  "empty",
+			stats: nil,
+			exp:   "",
+		},
+		{
+			name: "multi",
+			stats: []*SiteStat{
+				{
+					Date:        time.Date(2020, 2, 3, 0, 0, 0, 0, time.UTC),
+					RealmID:     1,
+					SiteID:      2,
+					SiteName:    "Downtown clinic",
+					CodesIssued: 10,
+				},
+				{
+					Date:        time.Date(2020, 2, 4, 0, 0, 0, 0, time.UTC),
+					RealmID:     1,
+					SiteID:      3,
+					SiteName:    "Airport, Terminal 1",
+					CodesIssued: 45,
+				},
+			},
+			exp: `date,realm_id,site_id,site_name,codes_issued
+2020-02-03,1,2,Downtown clinic,10
+2020-02-04,1,3,"Airport, Terminal 1",45
+`,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			b, err := tc.stats.MarshalCSV()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(string(b), tc.exp); diff != "" {
+				t.Errorf("bad csv (+got, -want): %s", diff)
+			}
+		})
+	}
+}
+
+func TestSiteStats_JSON(t *testing.T) {
+	t.Parallel()
+
+	stats := SiteStats{
+		{
+			Date:        time.Date(2020, 2, 4, 0, 0, 0, 0, time.UTC),
+			RealmID:     1,
+			SiteID:      2,
+			SiteName:    "Downtown clinic",
+			CodesIssued: 45,
+		},
+		{
+			Date:        time.Date(2020, 2, 3, 0, 0, 0, 0, time.UTC),
+			RealmID:     1,
+			SiteID:      2,
+			SiteName:    "Downtown clinic",
+			CodesIssued: 10,
+		},
+	}
+
+	b, err := json.Marshal(stats)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got SiteStats
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(stats, got); diff != "" {
+		t.Errorf("mismatch (-want, +got):\n%s", diff)
+	}
+}
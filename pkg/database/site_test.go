@@ -0,0 +1,188 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/exposure-notifications-server/pkg/timeutils"
+)
+
+func TestSite_Save(t *testing.T) {
+	t.Parallel()
+
+	db, _ := testDatabaseInstance.NewDatabase(t, nil)
+
+	realm := NewRealmWithDefaults("site-realm")
+	if err := db.SaveRealm(realm, SystemTest); err != nil {
+		t.Fatal(err)
+	}
+
+	site := &Site{RealmID: realm.ID, Name: "Clinic"}
+	if err := db.SaveSite(site, SystemTest); err != nil {
+		t.Fatalf("failed to save site: %v: %v", err, site.ErrorMessages())
+	}
+
+	// Names are unique within a realm.
+	dup := &Site{RealmID: realm.ID, Name: "clinic"}
+	if err := db.SaveSite(dup, SystemTest); !IsValidationError(err) {
+		t.Errorf("expected validation error, got %v", err)
+	}
+	if len(dup.ErrorsFor("name")) == 0 {
+		t.Errorf("expected errors for name")
+	}
+
+	blank := &Site{RealmID: realm.ID}
+	if err := db.SaveSite(blank, SystemTest); !IsValidationError(err) {
+		t.Errorf("expected validation error, got %v", err)
+	}
+
+	// Names may be reused in other realms.
+	other := NewRealmWithDefaults("other-realm")
+	if err := db.SaveRealm(other, SystemTest); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.SaveSite(&Site{RealmID: other.ID, Name: "Clinic"}, SystemTest); err != nil {
+		t.Errorf("expected site in other realm to save: %v", err)
+	}
+
+	// Sites cannot be found through another realm.
+	if _, err := other.FindSite(db, site.ID); !IsNotFound(err) {
+		t.Errorf("expected not found, got %v", err)
+	}
+
+	sites, err := realm.ListActiveSites(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(sites), 1; got != want {
+		t.Errorf("expected %d sites, got %d", want, got)
+	}
+}
+
+func TestSite_DailyCodeLimit(t *testing.T) {
+	t.Parallel()
+
+	db, _ := testDatabaseInstance.NewDatabase(t, nil)
+
+	realm := NewRealmWithDefaults("site-realm")
+	if err := db.SaveRealm(realm, SystemTest); err != nil {
+		t.Fatal(err)
+	}
+
+	site := &Site{RealmID: realm.ID, Name: "Clinic", DailyCodeLimit: 2}
+	if err := db.SaveSite(site, SystemTest); err != nil {
+		t.Fatal(err)
+	}
+
+	reached, err := site.DailyCodeLimitReached(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reached {
+		t.Errorf("expected limit not to be reached")
+	}
+
+	if err := db.RawDB().Exec(`
+		INSERT INTO site_stats (date, realm_id, site_id, codes_issued)
+		VALUES ($1, $2, $3, 2)`,
+		timeutils.Midnight(time.Now().UTC()), realm.ID, site.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	reached, err = site.DailyCodeLimitReached(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reached {
+		t.Errorf("expected limit to be reached")
+	}
+
+	stats, err := realm.SiteStats(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(stats), 1; got != want {
+		t.Fatalf("expected %d stats, got %d", want, got)
+	}
+	if got, want := stats[0].SiteName, site.Name; got != want {
+		t.Errorf("expected site name %q to be %q", got, want)
+	}
+}
+
+func TestDatabase_SaveVerificationCode_SiteDailyCodeLimit(t *testing.T) {
+	t.Parallel()
+
+	db, _ := testDatabaseInstance.NewDatabase(t, nil)
+
+	realm := NewRealmWithDefaults("site-limit-realm")
+	if err := db.SaveRealm(realm, SystemTest); err != nil {
+		t.Fatal(err)
+	}
+
+	site := &Site{RealmID: realm.ID, Name: "Limited clinic", DailyCodeLimit: 2}
+	if err := db.SaveSite(site, SystemTest); err != nil {
+		t.Fatal(err)
+	}
+
+	// Concurrent codes cannot take the site past its limit.
+	n := 5
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			vc := &VerificationCode{
+				RealmID:       realm.ID,
+				Code:          fmt.Sprintf("5000000%d", i),
+				LongCode:      fmt.Sprintf("5000000%dABC", i),
+				TestType:      "confirmed",
+				ExpiresAt:     time.Now().Add(time.Hour),
+				LongExpiresAt: time.Now().Add(time.Hour),
+			}
+			vc.SetIssuingSite(site)
+			errs[i] = db.SaveVerificationCode(vc, realm)
+		}(i)
+	}
+	wg.Wait()
+
+	var saved int
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			saved++
+		case errors.Is(err, ErrSiteDailyCodeLimitReached):
+		default:
+			t.Errorf("unexpected error: %v", err)
+		}
+	}
+	if got, want := saved, int(site.DailyCodeLimit); got != want {
+		t.Errorf("expected %d codes to be saved, got %d", want, got)
+	}
+
+	issued, err := site.CodesIssuedToday(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := issued, site.DailyCodeLimit; got != want {
+		t.Errorf("expected %d codes issued, got %d", want, got)
+	}
+}
@@ -75,6 +75,21 @@ func (db *Database) SystemSMSConfig() (*SMSConfig, error) {
 	return &smsConfig, nil
 }
 
+// FindRealmSMSConfig returns the SMS config owned by the realm. Unlike
+// Realm.SMSConfig, it never returns the system SMS config.
+func (db *Database) FindRealmSMSConfig(realmID uint) (*SMSConfig, error) {
+	var smsConfig SMSConfig
+	if err := db.db.
+		Model(&SMSConfig{}).
+		Where("realm_id = ?", realmID).
+		Where("is_system IS FALSE").
+		First(&smsConfig).
+		Error; err != nil {
+		return nil, err
+	}
+	return &smsConfig, nil
+}
+
 // SaveSMSConfig creates or updates an SMS configuration record.
 func (db *Database) SaveSMSConfig(s *SMSConfig) error {
 	if s.ProviderType == sms.ProviderTypeTwilio &&
@@ -0,0 +1,164 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/exposure-notifications-verification-server/internal/project"
+)
+
+// StatsGranularity is the period by which statistics are grouped.
+type StatsGranularity string
+
+const (
+	StatsGranularityDay   StatsGranularity = "day"
+	StatsGranularityWeek  StatsGranularity = "week"
+	StatsGranularityMonth StatsGranularity = "month"
+
+	// DefaultStatsDays is the number of days before today included in the
+	// default statistics range.
+	DefaultStatsDays = 30
+)
+
+// maxStatsRange is the longest range that can be requested for each
+// granularity. Longer periods allow longer ranges, since they return fewer
+// rows.
+var maxStatsRange = map[StatsGranularity]time.Duration{
+	StatsGranularityDay:   366 * 24 * time.Hour,
+	StatsGranularityWeek:  3 * 366 * 24 * time.Hour,
+	StatsGranularityMonth: 5 * 366 * 24 * time.Hour,
+}
+
+var (
+	ErrInvalidStatsGranularity = errors.New("granularity must be one of day, week, or month")
+	ErrStatsRangeTooLarge      = errors.New("date range is too large for the granularity")
+)
+
+// StatsRange is the inclusive range of dates and the granularity for a
+// statistics query. Start and Stop are dates, represented as midnight UTC.
+type StatsRange struct {
+	Start       time.Time
+	Stop        time.Time
+	Granularity StatsGranularity
+}
+
+// NewStatsRange creates a new statistics range between the dates on which
+// start and stop fall. An empty granularity is treated as daily.
+func NewStatsRange(start, stop time.Time, granularity StatsGranularity) (*StatsRange, error) {
+	if granularity == "" {
+		granularity = StatsGranularityDay
+	}
+
+	max, ok := maxStatsRange[granularity]
+	if !ok {
+		return nil, ErrInvalidStatsGranularity
+	}
+
+	start = time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, time.UTC)
+	stop = time.Date(stop.Year(), stop.Month(), stop.Day(), 0, 0, 0, 0, time.UTC)
+	if start.After(stop) {
+		return nil, ErrBadDateRange
+	}
+	if stop.Sub(start) > max {
+		return nil, fmt.Errorf("%w: maximum is %d days for %s", ErrStatsRangeTooLarge,
+			int(max.Hours()/24), granularity)
+	}
+
+	return &StatsRange{
+		Start:       start,
+		Stop:        stop,
+		Granularity: granularity,
+	}, nil
+}
+
+// DefaultStatsRange returns the range used when none is requested: the last
+// DefaultStatsDays days through today in the realm's timezone, by day.
+func (r *Realm) DefaultStatsRange() *StatsRange {
+	stop := r.StatsDate(time.Now())
+	return &StatsRange{
+		Start:       stop.Add(DefaultStatsDays * -24 * time.Hour),
+		Stop:        stop,
+		Granularity: StatsGranularityDay,
+	}
+}
+
+// CacheKey returns a string which uniquely identifies the range, for use in
+// cache keys.
+func (s *StatsRange) CacheKey() string {
+	return fmt.Sprintf("%s:%s:%s",
+		s.Start.Format(project.RFC3339Date), s.Stop.Format(project.RFC3339Date), s.Granularity)
+}
+
+// periodStart returns the first day of the period that contains the date,
+// matching date_trunc in the database: weeks start on Monday and months on the
+// first day of the month.
+func (g StatsGranularity) periodStart(t time.Time) time.Time {
+	switch g {
+	case StatsGranularityWeek:
+		offset := (int(t.Weekday()) + 6) % 7
+		return t.AddDate(0, 0, -offset)
+	case StatsGranularityMonth:
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location())
+	default:
+		return t
+	}
+}
+
+// nextPeriod returns the first day of the period after the one that starts on
+// the given date.
+func (g StatsGranularity) nextPeriod(t time.Time) time.Time {
+	switch g {
+	case StatsGranularityWeek:
+		return t.AddDate(0, 0, 7)
+	case StatsGranularityMonth:
+		return t.AddDate(0, 1, 0)
+	default:
+		return t.AddDate(0, 0, 1)
+	}
+}
+
+// CompletePeriods returns the range narrowed to the periods that fall entirely
+// within it and end on or before last. Every request therefore returns the
+// same fixed periods, and no period covers only part of its label. It returns
+// ErrBadDateRange if there are no such periods.
+func (s *StatsRange) CompletePeriods(last time.Time) (*StatsRange, error) {
+	last = time.Date(last.Year(), last.Month(), last.Day(), 0, 0, 0, 0, time.UTC)
+
+	start := s.Granularity.periodStart(s.Start)
+	if start.Before(s.Start) {
+		start = s.Granularity.nextPeriod(start)
+	}
+
+	stop := s.Stop
+	if stop.After(last) {
+		stop = last
+	}
+	if end := s.Granularity.nextPeriod(s.Granularity.periodStart(stop)).AddDate(0, 0, -1); end.After(stop) {
+		stop = s.Granularity.periodStart(stop).AddDate(0, 0, -1)
+	}
+
+	if start.After(stop) {
+		return nil, ErrBadDateRange
+	}
+
+	return &StatsRange{
+		Start:       start,
+		Stop:        stop,
+		Granularity: s.Granularity,
+	}, nil
+}
@@ -0,0 +1,188 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestNewStatsRange(t *testing.T) {
+	t.Parallel()
+
+	day := func(y int, m time.Month, d int) time.Time {
+		return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+	}
+
+	cases := []struct {
+		name        string
+		start       time.Time
+		stop        time.Time
+		granularity StatsGranularity
+		err         error
+		key         string
+	}{
+		{
+			name:  "default_granularity",
+			start: day(2020, 1, 1),
+			stop:  day(2020, 3, 31),
+			key:   "2020-01-01:2020-03-31:day",
+		},
+		{
+			name:        "truncates_time",
+			start:       time.Date(2020, 1, 1, 13, 45, 0, 0, time.UTC),
+			stop:        time.Date(2020, 1, 2, 23, 59, 0, 0, time.UTC),
+			granularity: StatsGranularityWeek,
+			key:         "2020-01-01:2020-01-02:week",
+		},
+		{
+			name:        "invalid_granularity",
+			start:       day(2020, 1, 1),
+			stop:        day(2020, 1, 2),
+			granularity: "hour",
+			err:         ErrInvalidStatsGranularity,
+		},
+		{
+			name:  "reversed",
+			start: day(2020, 1, 2),
+			stop:  day(2020, 1, 1),
+			err:   ErrBadDateRange,
+		},
+		{
+			name:  "too_long_for_day",
+			start: day(2018, 1, 1),
+			stop:  day(2020, 1, 1),
+			err:   ErrStatsRangeTooLarge,
+		},
+		{
+			name:        "long_by_month",
+			start:       day(2018, 1, 1),
+			stop:        day(2020, 1, 1),
+			granularity: StatsGranularityMonth,
+			key:         "2018-01-01:2020-01-01:month",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			sr, err := NewStatsRange(tc.start, tc.stop, tc.granularity)
+			if tc.err != nil {
+				if !errors.Is(err, tc.err) {
+					t.Fatalf("expected %v, got %v", tc.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, want := sr.CacheKey(), tc.key; got != want {
+				t.Errorf("expected %q to be %q", got, want)
+			}
+		})
+	}
+}
+
+func TestStatsRange_CompletePeriods(t *testing.T) {
+	t.Parallel()
+
+	day := func(y int, m time.Month, d int) time.Time {
+		return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+	}
+
+	cases := []struct {
+		name        string
+		start       time.Time
+		stop        time.Time
+		last        time.Time
+		granularity StatsGranularity
+		err         error
+		key         string
+	}{
+		{
+			name:        "day",
+			start:       day(2020, 1, 1),
+			stop:        day(2020, 1, 31),
+			last:        day(2020, 1, 15),
+			granularity: StatsGranularityDay,
+			key:         "2020-01-01:2020-01-15:day",
+		},
+		{
+			// 2020-01-01 is a Wednesday.
+			name:        "week",
+			start:       day(2020, 1, 1),
+			stop:        day(2020, 1, 31),
+			last:        day(2020, 2, 15),
+			granularity: StatsGranularityWeek,
+			key:         "2020-01-06:2020-01-26:week",
+		},
+		{
+			name:        "week_aligned",
+			start:       day(2020, 1, 6),
+			stop:        day(2020, 1, 19),
+			last:        day(2020, 2, 15),
+			granularity: StatsGranularityWeek,
+			key:         "2020-01-06:2020-01-19:week",
+		},
+		{
+			name:        "week_last",
+			start:       day(2020, 1, 6),
+			stop:        day(2020, 1, 31),
+			last:        day(2020, 1, 21),
+			granularity: StatsGranularityWeek,
+			key:         "2020-01-06:2020-01-19:week",
+		},
+		{
+			name:        "month",
+			start:       day(2020, 1, 15),
+			stop:        day(2020, 5, 15),
+			last:        day(2020, 12, 31),
+			granularity: StatsGranularityMonth,
+			key:         "2020-02-01:2020-04-30:month",
+		},
+		{
+			name:        "partial_month",
+			start:       day(2020, 1, 2),
+			stop:        day(2020, 1, 31),
+			last:        day(2020, 12, 31),
+			granularity: StatsGranularityMonth,
+			err:         ErrBadDateRange,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			sr := &StatsRange{Start: tc.start, Stop: tc.stop, Granularity: tc.granularity}
+			got, err := sr.CompletePeriods(tc.last)
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("expected %v to be %v", err, tc.err)
+			}
+			if err != nil {
+				return
+			}
+			if got, want := got.CacheKey(), tc.key; got != want {
+				t.Errorf("expected %q to be %q", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,284 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"fmt"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/google/exposure-notifications-verification-server/internal/project"
+	"github.com/jinzhu/gorm"
+	"github.com/lib/pq"
+)
+
+var _ Auditable = (*StatsReportSchedule)(nil)
+
+// StatsReportFrequency is how often a statistics report is sent.
+type StatsReportFrequency string
+
+const (
+	StatsReportWeekly  StatsReportFrequency = "weekly"
+	StatsReportMonthly StatsReportFrequency = "monthly"
+
+	// MaxStatsReportRecipients is the maximum number of recipients of a
+	// statistics report.
+	MaxStatsReportRecipients = 20
+)
+
+// StatsReportFrequencies are the supported report frequencies, in display
+// order.
+var StatsReportFrequencies = []StatsReportFrequency{StatsReportWeekly, StatsReportMonthly}
+
+// Period returns the first and last dates of the most recently completed
+// period before the given day. Weeks start on Monday. The day must be a date,
+// represented as midnight UTC.
+func (f StatsReportFrequency) Period(day time.Time) (time.Time, time.Time, error) {
+	switch f {
+	case StatsReportWeekly:
+		daysSinceMonday := (int(day.Weekday()) + 6) % 7
+		monday := day.AddDate(0, 0, -daysSinceMonday)
+		return monday.AddDate(0, 0, -7), monday.AddDate(0, 0, -1), nil
+	case StatsReportMonthly:
+		first := time.Date(day.Year(), day.Month(), 1, 0, 0, 0, 0, time.UTC)
+		return first.AddDate(0, -1, 0), first.AddDate(0, 0, -1), nil
+	default:
+		return time.Time{}, time.Time{}, fmt.Errorf("unknown report frequency %q", f)
+	}
+}
+
+// StatsReportSchedule is a realm's schedule for sending its statistics CSVs by
+// email and, optionally, exporting them to blob storage.
+type StatsReportSchedule struct {
+	gorm.Model
+	Errorable
+
+	// RealmID is the realm whose statistics are reported. Each realm has at most
+	// one schedule per frequency.
+	RealmID   uint                 `gorm:"column:realm_id; type:integer; not null;"`
+	Frequency StatsReportFrequency `gorm:"column:frequency; type:varchar(16); not null;"`
+
+	// Enabled determines if reports are sent.
+	Enabled bool `gorm:"column:enabled; type:boolean; not null; default:false;"`
+
+	// Recipients are the email addresses to which reports are sent.
+	Recipients pq.StringArray `gorm:"column:recipients; type:text[];"`
+
+	// ExportToStorage determines if reports are also written to the system's
+	// blob storage.
+	ExportToStorage bool `gorm:"column:export_to_storage; type:boolean; not null; default:false;"`
+
+	// LastPeriodStart is the first date of the most recent period that was
+	// reported, and LastSentAt is when it was reported.
+	LastPeriodStart *time.Time `gorm:"column:last_period_start; type:date;"`
+	LastSentAt      *time.Time `gorm:"column:last_sent_at; type:timestamp with time zone;"`
+}
+
+// BeforeSave runs validations. If there are errors, the save fails.
+func (s *StatsReportSchedule) BeforeSave(tx *gorm.DB) error {
+	if s.RealmID == 0 {
+		s.AddError("realmID", "is required")
+	}
+
+	switch s.Frequency {
+	case StatsReportWeekly, StatsReportMonthly:
+	default:
+		s.AddError("frequency", "must be weekly or monthly")
+	}
+
+	recipients := make([]string, 0, len(s.Recipients))
+	for _, v := range s.Recipients {
+		v = project.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+
+		addr, err := mail.ParseAddress(v)
+		if err != nil {
+			s.AddError("recipients", fmt.Sprintf("%q is not a valid email address", v))
+			continue
+		}
+		recipients = append(recipients, addr.Address)
+	}
+	s.Recipients = recipients
+
+	if len(s.Recipients) > MaxStatsReportRecipients {
+		s.AddError("recipients", fmt.Sprintf("cannot have more than %d recipients", MaxStatsReportRecipients))
+	}
+
+	if s.Enabled && len(s.Recipients) == 0 && !s.ExportToStorage {
+		s.AddError("recipients", "is required unless exporting to storage")
+	}
+
+	return s.ErrorOrNil()
+}
+
+// IsDue returns true if the schedule is enabled and the most recently
+// completed period before the given day has not been reported.
+func (s *StatsReportSchedule) IsDue(day time.Time) (bool, error) {
+	if !s.Enabled {
+		return false, nil
+	}
+
+	start, _, err := s.Frequency.Period(day)
+	if err != nil {
+		return false, err
+	}
+	return s.LastPeriodStart == nil || s.LastPeriodStart.Before(start), nil
+}
+
+// ParseStatsReportRecipients splits a list of email addresses separated by
+// commas, semicolons, or newlines.
+func ParseStatsReportRecipients(s string) []string {
+	return strings.FieldsFunc(s, func(r rune) bool {
+		return r == ',' || r == ';' || r == '\r' || r == '\n'
+	})
+}
+
+// ListStatsReportSchedules returns the realm's statistics report schedules,
+// keyed by frequency. Frequencies without a saved schedule have a new, disabled
+// schedule.
+func (r *Realm) ListStatsReportSchedules(db *Database) (map[StatsReportFrequency]*StatsReportSchedule, error) {
+	var schedules []*StatsReportSchedule
+	if err := db.db.
+		Model(&StatsReportSchedule{}).
+		Where("realm_id = ?", r.ID).
+		Find(&schedules).
+		Error; err != nil && !IsNotFound(err) {
+		return nil, err
+	}
+
+	result := make(map[StatsReportFrequency]*StatsReportSchedule, len(StatsReportFrequencies))
+	for _, f := range StatsReportFrequencies {
+		result[f] = &StatsReportSchedule{RealmID: r.ID, Frequency: f}
+	}
+	for _, s := range schedules {
+		result[s.Frequency] = s
+	}
+	return result, nil
+}
+
+// ListEnabledStatsReportSchedules returns every enabled statistics report
+// schedule.
+func (db *Database) ListEnabledStatsReportSchedules() ([]*StatsReportSchedule, error) {
+	var schedules []*StatsReportSchedule
+	if err := db.db.
+		Model(&StatsReportSchedule{}).
+		Where("enabled = true").
+		Order("realm_id, frequency").
+		Find(&schedules).
+		Error; err != nil {
+		if IsNotFound(err) {
+			return schedules, nil
+		}
+		return nil, err
+	}
+	return schedules, nil
+}
+
+// MarkStatsReportSent records that the period starting on the given date was
+// reported. It only updates the tracking columns, so it does not create audit
+// entries.
+func (db *Database) MarkStatsReportSent(s *StatsReportSchedule, periodStart time.Time) error {
+	now := time.Now().UTC()
+	if err := db.db.
+		Model(&StatsReportSchedule{}).
+		Where("id = ?", s.ID).
+		UpdateColumns(map[string]interface{}{
+			"last_period_start": periodStart,
+			"last_sent_at":      now,
+		}).
+		Error; err != nil {
+		return fmt.Errorf("failed to mark report sent: %w", err)
+	}
+
+	s.LastPeriodStart = &periodStart
+	s.LastSentAt = &now
+	return nil
+}
+
+// SaveStatsReportSchedule saves the schedule.
+func (db *Database) SaveStatsReportSchedule(s *StatsReportSchedule, actor Auditable) error {
+	if s == nil {
+		return fmt.Errorf("provided schedule is nil")
+	}
+
+	if actor == nil {
+		return fmt.Errorf("auditing actor is nil")
+	}
+
+	return db.db.Transaction(func(tx *gorm.DB) error {
+		var audits []*AuditEntry
+
+		var existing StatsReportSchedule
+		if err := tx.
+			Model(&StatsReportSchedule{}).
+			Where("id = ?", s.ID).
+			First(&existing).
+			Error; err != nil && !IsNotFound(err) {
+			return fmt.Errorf("failed to get existing schedule")
+		}
+
+		// Save the schedule
+		if err := tx.Save(s).Error; err != nil {
+			return err
+		}
+
+		// Brand new schedule?
+		if existing.ID == 0 {
+			audit := BuildAuditEntry(actor, "created stats report schedule", s, s.RealmID)
+			audits = append(audits, audit)
+		} else {
+			if existing.Enabled != s.Enabled {
+				audit := BuildAuditEntry(actor, "updated stats report enabled", s, s.RealmID)
+				audit.Diff = boolDiff(existing.Enabled, s.Enabled)
+				audit.AddChange("Enabled", existing.Enabled, s.Enabled)
+				audits = append(audits, audit)
+			}
+
+			if oldRecipients, newRecipients := strings.Join(existing.Recipients, ", "), strings.Join(s.Recipients, ", "); oldRecipients != newRecipients {
+				audit := BuildAuditEntry(actor, "updated stats report recipients", s, s.RealmID)
+				audit.Diff = stringDiff(oldRecipients, newRecipients)
+				audit.AddChange("Recipients", existing.Recipients, s.Recipients)
+				audits = append(audits, audit)
+			}
+
+			if existing.ExportToStorage != s.ExportToStorage {
+				audit := BuildAuditEntry(actor, "updated stats report export to storage", s, s.RealmID)
+				audit.Diff = boolDiff(existing.ExportToStorage, s.ExportToStorage)
+				audit.AddChange("ExportToStorage", existing.ExportToStorage, s.ExportToStorage)
+				audits = append(audits, audit)
+			}
+		}
+
+		// Save all audits
+		for _, audit := range audits {
+			if err := tx.Save(audit).Error; err != nil {
+				return fmt.Errorf("failed to save audits: %w", err)
+			}
+		}
+
+		return nil
+	})
+}
+
+func (s *StatsReportSchedule) AuditID() string {
+	return fmt.Sprintf("stats_report_schedules:%d", s.ID)
+}
+
+func (s *StatsReportSchedule) AuditDisplay() string {
+	return fmt.Sprintf("%s stats report", s.Frequency)
+}
@@ -0,0 +1,209 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStatsReportFrequency_Period(t *testing.T) {
+	t.Parallel()
+
+	date := func(y int, m time.Month, d int) time.Time {
+		return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+	}
+
+	cases := []struct {
+		name      string
+		frequency StatsReportFrequency
+		day       time.Time
+		start     time.Time
+		stop      time.Time
+		err       bool
+	}{
+		{
+			name:      "weekly_monday",
+			frequency: StatsReportWeekly,
+			day:       date(2020, 11, 9),
+			start:     date(2020, 11, 2),
+			stop:      date(2020, 11, 8),
+		},
+		{
+			name:      "weekly_sunday",
+			frequency: StatsReportWeekly,
+			day:       date(2020, 11, 15),
+			start:     date(2020, 11, 2),
+			stop:      date(2020, 11, 8),
+		},
+		{
+			name:      "monthly_first",
+			frequency: StatsReportMonthly,
+			day:       date(2020, 3, 1),
+			start:     date(2020, 2, 1),
+			stop:      date(2020, 2, 29),
+		},
+		{
+			name:      "monthly_january",
+			frequency: StatsReportMonthly,
+			day:       date(2021, 1, 31),
+			start:     date(2020, 12, 1),
+			stop:      date(2020, 12, 31),
+		},
+		{
+			name:      "unknown",
+			frequency: StatsReportFrequency("daily"),
+			day:       date(2020, 11, 9),
+			err:       true,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			start, stop, err := tc.frequency.Period(tc.day)
+			if (err != nil) != tc.err {
+				t.Fatalf("expected error %t, got %v", tc.err, err)
+			}
+			if !start.Equal(tc.start) {
+				t.Errorf("expected start %v to be %v", start, tc.start)
+			}
+			if !stop.Equal(tc.stop) {
+				t.Errorf("expected stop %v to be %v", stop, tc.stop)
+			}
+		})
+	}
+}
+
+func TestStatsReportSchedule_IsDue(t *testing.T) {
+	t.Parallel()
+
+	day := time.Date(2020, 11, 10, 0, 0, 0, 0, time.UTC)
+	lastWeek := time.Date(2020, 11, 2, 0, 0, 0, 0, time.UTC)
+	twoWeeksAgo := time.Date(2020, 10, 26, 0, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		name     string
+		schedule *StatsReportSchedule
+		due      bool
+	}{
+		{
+			name:     "disabled",
+			schedule: &StatsReportSchedule{Frequency: StatsReportWeekly},
+			due:      false,
+		},
+		{
+			name:     "never_sent",
+			schedule: &StatsReportSchedule{Frequency: StatsReportWeekly, Enabled: true},
+			due:      true,
+		},
+		{
+			name:     "sent",
+			schedule: &StatsReportSchedule{Frequency: StatsReportWeekly, Enabled: true, LastPeriodStart: &lastWeek},
+			due:      false,
+		},
+		{
+			name:     "stale",
+			schedule: &StatsReportSchedule{Frequency: StatsReportWeekly, Enabled: true, LastPeriodStart: &twoWeeksAgo},
+			due:      true,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			due, err := tc.schedule.IsDue(day)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if due != tc.due {
+				t.Errorf("expected due to be %t", tc.due)
+			}
+		})
+	}
+}
+
+func TestStatsReportSchedule_BeforeSave(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name     string
+		schedule *StatsReportSchedule
+		field    string
+		err      string
+	}{
+		{
+			name:     "missing_realm",
+			schedule: &StatsReportSchedule{Frequency: StatsReportWeekly},
+			field:    "realmID",
+			err:      "is required",
+		},
+		{
+			name:     "bad_frequency",
+			schedule: &StatsReportSchedule{RealmID: 1, Frequency: "daily"},
+			field:    "frequency",
+			err:      "must be weekly or monthly",
+		},
+		{
+			name:     "bad_recipient",
+			schedule: &StatsReportSchedule{RealmID: 1, Frequency: StatsReportWeekly, Recipients: []string{"nope"}},
+			field:    "recipients",
+			err:      `"nope" is not a valid email address`,
+		},
+		{
+			name:     "enabled_without_destination",
+			schedule: &StatsReportSchedule{RealmID: 1, Frequency: StatsReportWeekly, Enabled: true},
+			field:    "recipients",
+			err:      "is required unless exporting to storage",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			_ = tc.schedule.BeforeSave(nil)
+			if errs := tc.schedule.ErrorsFor(tc.field); len(errs) < 1 || errs[0] != tc.err {
+				t.Errorf("expected %q to have error %q, got %q", tc.field, tc.err, errs)
+			}
+		})
+	}
+
+	t.Run("normalizes_recipients", func(t *testing.T) {
+		t.Parallel()
+
+		s := &StatsReportSchedule{
+			RealmID:    1,
+			Frequency:  StatsReportMonthly,
+			Enabled:    true,
+			Recipients: ParseStatsReportRecipients("Alex <alex@example.com>, ,sam@example.com\n"),
+		}
+		if err := s.BeforeSave(nil); err != nil {
+			t.Fatal(err)
+		}
+		if got, want := []string(s.Recipients), []string{"alex@example.com", "sam@example.com"}; strings.Join(got, ",") != strings.Join(want, ",") {
+			t.Errorf("expected recipients %q to be %q", got, want)
+		}
+	})
+}
@@ -15,6 +15,7 @@
 package database
 
 import (
+	"context"
 	"crypto/rand"
 	"encoding/base64"
 	"errors"
@@ -22,10 +23,10 @@ import (
 	"strings"
 	"time"
 
-	"github.com/google/exposure-notifications-server/pkg/timeutils"
 	"github.com/google/exposure-notifications-verification-server/internal/project"
 	"github.com/google/exposure-notifications-verification-server/pkg/api"
 	"github.com/jinzhu/gorm"
+	"github.com/lib/pq"
 )
 
 const (
@@ -141,6 +142,13 @@ func (t *Token) Subject() *Subject {
 // ClaimToken looks up the token by ID, verifies that it is not expired and that
 // the specified subject matches the parameters that were configured when issued.
 func (db *Database) ClaimToken(realmID uint, tokenID string, subject *Subject) error {
+	return db.ClaimTokenAndLogCertificate(realmID, tokenID, subject, nil)
+}
+
+// ClaimTokenAndLogCertificate claims the token like ClaimToken and, in the same
+// transaction, records the issued certificate in the certificate transparency
+// log. If entry is nil, no log entry is recorded.
+func (db *Database) ClaimTokenAndLogCertificate(realmID uint, tokenID string, subject *Subject, entry *CertificateLogEntry) error {
 	return db.db.Transaction(func(tx *gorm.DB) error {
 		var tok Token
 		if err := tx.
@@ -181,7 +189,30 @@ func (db *Database) ClaimToken(realmID uint, tokenID string, subject *Subject) e
 		}
 
 		tok.Used = true
-		return tx.Save(&tok).Error
+		if err := tx.Save(&tok).Error; err != nil {
+			return err
+		}
+
+		// Tokens are counted on the day they were issued. Codes expire within a
+		// day, so this is at most one day after the code itself was issued.
+		sql := `
+			INSERT INTO realm_stats(date, realm_id, tokens_claimed)
+				VALUES ($1, $2, 1)
+			ON CONFLICT (date, realm_id) DO UPDATE
+				SET tokens_claimed = realm_stats.tokens_claimed + 1
+		`
+		date := statsDate(tok.CreatedAt, db.realmLocation(realmID))
+		if err := tx.Exec(sql, date, realmID).Error; err != nil {
+			return fmt.Errorf("failed to update stats: %w", err)
+		}
+
+		if entry != nil {
+			entry.RealmID = realmID
+			if err := tx.Create(entry).Error; err != nil {
+				return fmt.Errorf("failed to record certificate log entry: %w", err)
+			}
+		}
+		return nil
 	})
 }
 
@@ -241,15 +272,28 @@ func (db *Database) VerifyCodeAndIssueToken(realmID uint, verCode string, accept
 			return fmt.Errorf("failed to claim token: %w", err)
 		}
 
-		// Update statistics
-		now := timeutils.Midnight(vc.CreatedAt)
+		// Update statistics, including how long the code took to be claimed.
+		now := statsDate(vc.CreatedAt, db.realmLocation(vc.RealmID))
+		age := time.Since(vc.CreatedAt)
+		if age < 0 {
+			age = 0
+		}
+		distribution := make(pq.Int32Array, len(CodeClaimAgeBuckets)+1)
+		distribution[codeClaimAgeBucket(age)] = 1
+
 		sql := `
-			INSERT INTO realm_stats(date, realm_id, codes_claimed)
-				VALUES ($1, $2, 1)
+			INSERT INTO realm_stats(date, realm_id, codes_claimed, code_claim_age_distribution, code_claim_age_total_seconds)
+				VALUES ($1, $2, 1, $3, $4)
 			ON CONFLICT (date, realm_id) DO UPDATE
-				SET codes_claimed = realm_stats.codes_claimed + 1
+				SET codes_claimed = realm_stats.codes_claimed + 1,
+					code_claim_age_distribution = (
+						SELECT array_agg(COALESCE(a.v, 0) + COALESCE(b.v, 0) ORDER BY COALESCE(a.i, b.i))
+						FROM unnest(realm_stats.code_claim_age_distribution) WITH ORDINALITY AS a(v, i)
+						FULL OUTER JOIN unnest(excluded.code_claim_age_distribution) WITH ORDINALITY AS b(v, i) ON a.i = b.i
+					),
+					code_claim_age_total_seconds = realm_stats.code_claim_age_total_seconds + excluded.code_claim_age_total_seconds
 		`
-		if err := tx.Exec(sql, now, vc.RealmID).Error; err != nil {
+		if err := tx.Exec(sql, now, vc.RealmID, distribution, int64(age.Seconds())).Error; err != nil {
 			return fmt.Errorf("failed to update stats: %w", err)
 		}
 
@@ -290,12 +334,16 @@ func (db *Database) FindTokenByID(tokenID string) (*Token, error) {
 // PurgeTokens will delete tokens that have expired since at least the
 // provided maxAge ago.
 // This is a hard delete, not a soft delete.
-func (db *Database) PurgeTokens(maxAge time.Duration) (int64, error) {
-	if maxAge > 0 {
-		maxAge = -1 * maxAge
-	}
-	deleteBefore := time.Now().UTC().Add(maxAge)
-	// Delete codes that expired before the delete before time.
-	rtn := db.db.Unscoped().Where("expires_at < ?", deleteBefore).Delete(&Token{})
-	return rtn.RowsAffected, rtn.Error
+func (db *Database) PurgeTokens(ctx context.Context, maxAge time.Duration, opts *PurgeOptions) (*PurgeResult, error) {
+	deleteBefore := time.Now().UTC().Add(-absDuration(maxAge))
+
+	// Delete tokens that expired before the delete before time.
+	result := &PurgeResult{Table: "tokens"}
+	err := db.purge(ctx, &purgeQuery{
+		table:       "tokens",
+		realmColumn: "realm_id",
+		where:       "expires_at < ?",
+		args:        []interface{}{deleteBefore},
+	}, opts, result)
+	return result, err
 }
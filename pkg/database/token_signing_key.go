@@ -0,0 +1,360 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jinzhu/gorm"
+)
+
+const (
+	// tokenSigningKeyName is the name of the parent key in the key manager on
+	// which token signing key versions are created.
+	tokenSigningKeyName = "token-signing"
+)
+
+var _ Auditable = (*TokenSigningKey)(nil)
+
+// TokenSigningKey represents a reference to a KMS backed signing key version
+// for verification token signing. Unlike SigningKey, token signing keys are
+// system-wide and do not belong to a realm.
+type TokenSigningKey struct {
+	gorm.Model
+	Errorable
+
+	// KID is the 'kid' header value on tokens signed by this key. It is unique
+	// across all token signing keys, including destroyed ones.
+	KID string `gorm:"column:kid; type:varchar(64); unique_index; not null;"`
+
+	// Reference to an exact version of a key in the KMS
+	KeyID  string
+	Active bool
+
+	// ActivatedAt is the time at which the key most recently became active.
+	// DeactivatedAt is the time at which the key was superseded by another key.
+	ActivatedAt   *time.Time
+	DeactivatedAt *time.Time
+}
+
+// ActiveSince returns the time at which this key became active. If the
+// activation time was not recorded, it falls back to the creation time.
+func (k *TokenSigningKey) ActiveSince() time.Time {
+	if k.ActivatedAt != nil {
+		return *k.ActivatedAt
+	}
+	return k.CreatedAt
+}
+
+// GetKID returns the 'kid' field value to use in signing JWTs.
+func (k *TokenSigningKey) GetKID() string {
+	return k.KID
+}
+
+func (k *TokenSigningKey) AuditID() string {
+	return fmt.Sprintf("token_signing_keys:%d", k.ID)
+}
+
+func (k *TokenSigningKey) AuditDisplay() string {
+	return k.KID
+}
+
+// ListTokenSigningKeys returns all non-destroyed token signing keys, newest
+// first.
+func (db *Database) ListTokenSigningKeys() ([]*TokenSigningKey, error) {
+	var keys []*TokenSigningKey
+	if err := db.db.
+		Model(&TokenSigningKey{}).
+		Order("created_at DESC").
+		Find(&keys).
+		Error; err != nil {
+		if IsNotFound(err) {
+			return keys, nil
+		}
+		return nil, err
+	}
+	return keys, nil
+}
+
+// ActiveTokenSigningKey returns the token signing key that should be used to
+// sign new verification tokens.
+func (db *Database) ActiveTokenSigningKey() (*TokenSigningKey, error) {
+	var key TokenSigningKey
+	if err := db.db.
+		Model(&TokenSigningKey{}).
+		Where("active = ?", true).
+		First(&key).
+		Error; err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+// FindTokenSigningKeyByKID finds the non-destroyed token signing key with the
+// given kid. Retired keys are returned so that tokens signed before a rotation
+// can still be verified.
+func (db *Database) FindTokenSigningKeyByKID(kid string) (*TokenSigningKey, error) {
+	var key TokenSigningKey
+	if err := db.db.
+		Model(&TokenSigningKey{}).
+		Where("kid = ?", kid).
+		First(&key).
+		Error; err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+// ImportTokenSigningKeys saves references to externally-managed token signing
+// key versions. keyIDs and kids are parallel lists and the first entry is
+// marked as active. The other entries are marked as deactivated at import, so
+// they are destroyed once the retention period has passed. This is used to
+// migrate keys that were previously configured via the environment, so it does
+// nothing if any token signing keys already exist.
+func (db *Database) ImportTokenSigningKeys(keyIDs, kids []string) error {
+	if len(keyIDs) == 0 {
+		return nil
+	}
+	if len(keyIDs) != len(kids) {
+		return fmt.Errorf("key ids and kids must be the same length")
+	}
+
+	return db.db.Transaction(func(tx *gorm.DB) error {
+		// Prevent concurrent imports from multiple instances starting at the same
+		// time. Reads are still permitted.
+		if err := tx.Exec("LOCK TABLE token_signing_keys IN SHARE ROW EXCLUSIVE MODE").Error; err != nil {
+			return fmt.Errorf("failed to lock token signing keys: %w", err)
+		}
+
+		var count int64
+		if err := tx.
+			Unscoped().
+			Model(&TokenSigningKey{}).
+			Count(&count).
+			Error; err != nil {
+			if !IsNotFound(err) {
+				return fmt.Errorf("failed to count existing token signing keys: %w", err)
+			}
+		}
+		if count > 0 {
+			return nil
+		}
+
+		now := time.Now().UTC()
+		for i, keyID := range keyIDs {
+			key := &TokenSigningKey{
+				KID:    strings.TrimSpace(kids[i]),
+				KeyID:  strings.TrimSpace(keyID),
+				Active: i == 0,
+			}
+			if key.Active {
+				key.ActivatedAt = &now
+			} else {
+				key.DeactivatedAt = &now
+			}
+
+			if err := tx.Save(key).Error; err != nil {
+				return fmt.Errorf("failed to save token signing key %q: %w", key.KID, err)
+			}
+
+			audit := BuildAuditEntry(System, "imported token signing key", key, 0)
+			if err := tx.Save(audit).Error; err != nil {
+				return fmt.Errorf("failed to save audits: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+// CreateTokenSigningKeyVersion creates a new token signing key version on the
+// key manager and saves a reference to it in the database. The new key is only
+// marked as active if there are no other token signing keys. If creating the
+// key in the key manager fails, the database is not updated.
+func (db *Database) CreateTokenSigningKeyVersion(ctx context.Context, actor Auditable) (*TokenSigningKey, error) {
+	if actor == nil {
+		return nil, fmt.Errorf("auditing actor is nil")
+	}
+
+	manager := db.signingKeyManager
+	if manager == nil {
+		return nil, ErrNoSigningKeyManager
+	}
+
+	parent := db.config.TokenSigningKeyRing
+	if parent == "" {
+		return nil, fmt.Errorf("missing TOKEN_SIGNING_KEYRING")
+	}
+
+	// Create the parent key - this interface does not return an error if the key
+	// already exists, so this is safe to run each time.
+	keyName, err := manager.CreateSigningKey(ctx, parent, tokenSigningKeyName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create token signing key: %w", err)
+	}
+
+	// Create a new key version. This returns the full version name.
+	version, err := manager.CreateKeyVersion(ctx, keyName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create token signing key version: %w", err)
+	}
+
+	db.logger.Debugw("provisioned new token signing key", "key_id", version)
+
+	var key TokenSigningKey
+	if err := db.db.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.
+			Model(&TokenSigningKey{}).
+			Where("active = ?", true).
+			Count(&count).
+			Error; err != nil {
+			if !IsNotFound(err) {
+				return fmt.Errorf("failed to check for existing keys: %w", err)
+			}
+		}
+
+		key.KID = uuid.New().String()
+		key.KeyID = version
+		key.Active = (count == 0)
+		if key.Active {
+			now := time.Now().UTC()
+			key.ActivatedAt = &now
+		}
+
+		if err := tx.Save(&key).Error; err != nil {
+			return fmt.Errorf("failed to save reference to token signing key: %w", err)
+		}
+
+		audit := BuildAuditEntry(actor, "created token signing key", &key, 0)
+		if err := tx.Save(audit).Error; err != nil {
+			return fmt.Errorf("failed to save audits: %w", err)
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return &key, nil
+}
+
+// ActivateTokenSigningKey marks the token signing key with the given id as
+// active and retires all other keys. Retired keys remain valid for
+// verification until they are destroyed.
+func (db *Database) ActivateTokenSigningKey(id uint, actor Auditable) (*TokenSigningKey, error) {
+	if actor == nil {
+		return nil, fmt.Errorf("auditing actor is nil")
+	}
+
+	var key TokenSigningKey
+	if err := db.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.
+			Set("gorm:query_option", "FOR UPDATE").
+			Model(&TokenSigningKey{}).
+			Where("id = ?", id).
+			First(&key).
+			Error; err != nil {
+			if IsNotFound(err) {
+				return fmt.Errorf("key to activate does not exist")
+			}
+			return fmt.Errorf("failed to find newly active key: %w", err)
+		}
+
+		if key.Active {
+			return nil
+		}
+
+		now := time.Now().UTC()
+		if err := tx.
+			Model(&TokenSigningKey{}).
+			Where("id != ?", id).
+			Where("active = ?", true).
+			Updates(map[string]interface{}{
+				"active":         false,
+				"deactivated_at": now,
+			}).
+			Error; err != nil {
+			return fmt.Errorf("failed to mark existing keys as inactive: %w", err)
+		}
+
+		key.Active = true
+		key.ActivatedAt = &now
+		key.DeactivatedAt = nil
+		if err := tx.Save(&key).Error; err != nil {
+			return fmt.Errorf("failed to mark new key as active: %w", err)
+		}
+
+		audit := BuildAuditEntry(actor, "activated token signing key", &key, 0)
+		if err := tx.Save(audit).Error; err != nil {
+			return fmt.Errorf("failed to save audits: %w", err)
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return &key, nil
+}
+
+// DestroyTokenSigningKeyVersion destroys the given retired key version in both
+// the database and the key manager. Tokens signed with the key can no longer be
+// verified. If the id does not exist, it does nothing.
+func (db *Database) DestroyTokenSigningKeyVersion(ctx context.Context, id uint, actor Auditable) error {
+	if actor == nil {
+		return fmt.Errorf("auditing actor is nil")
+	}
+
+	manager := db.signingKeyManager
+	if manager == nil {
+		return ErrNoSigningKeyManager
+	}
+
+	return db.db.Transaction(func(tx *gorm.DB) error {
+		var key TokenSigningKey
+		if err := tx.
+			Set("gorm:query_option", "FOR UPDATE").
+			Model(&TokenSigningKey{}).
+			Where("id = ?", id).
+			First(&key).
+			Error; err != nil {
+			if IsNotFound(err) {
+				return nil
+			}
+			return fmt.Errorf("failed to load token signing key: %w", err)
+		}
+
+		if key.Active {
+			return fmt.Errorf("cannot destroy active token signing key")
+		}
+
+		if err := manager.DestroyKeyVersion(ctx, key.KeyID); err != nil {
+			return fmt.Errorf("failed to destroy token signing key in key manager: %w", err)
+		}
+
+		if err := tx.Delete(&key).Error; err != nil {
+			return fmt.Errorf("successfully destroyed token signing key in key manager, "+
+				"but failed to delete token signing key from database: %w", err)
+		}
+
+		audit := BuildAuditEntry(actor, "destroyed token signing key", &key, 0)
+		if err := tx.Save(audit).Error; err != nil {
+			return fmt.Errorf("failed to save audits: %w", err)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,95 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/exposure-notifications-verification-server/internal/project"
+)
+
+func TestTokenSigningKey_Lifecycle(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	db, _ := testDatabaseInstance.NewDatabase(t, nil)
+
+	db.config.TokenSigningKeyRing = filepath.Join(project.Root(), "local", "test", "token")
+
+	// Importing keys marks the first as active.
+	if err := db.ImportTokenSigningKeys([]string{"key1", "key2"}, []string{"v1", "v2"}); err != nil {
+		t.Fatal(err)
+	}
+	active, err := db.ActiveTokenSigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := active.GetKID(), "v1"; got != want {
+		t.Errorf("expected %q to be %q", got, want)
+	}
+
+	// The other imported keys are deactivated, so they are eventually destroyed.
+	imported, err := db.FindTokenSigningKeyByKID("v2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if imported.Active || imported.DeactivatedAt == nil {
+		t.Errorf("expected %#v to be deactivated", imported)
+	}
+
+	// Importing again does nothing.
+	if err := db.ImportTokenSigningKeys([]string{"key3"}, []string{"v3"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.FindTokenSigningKeyByKID("v3"); !IsNotFound(err) {
+		t.Errorf("expected not found, got %v", err)
+	}
+
+	// New keys are not automatically active.
+	created, err := db.CreateTokenSigningKeyVersion(ctx, SystemTest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created.Active {
+		t.Errorf("expected new key to be inactive")
+	}
+
+	// Activating retires the previous key.
+	if _, err := db.ActivateTokenSigningKey(created.ID, SystemTest); err != nil {
+		t.Fatal(err)
+	}
+	retired, err := db.FindTokenSigningKeyByKID("v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if retired.Active || retired.DeactivatedAt == nil {
+		t.Errorf("expected %#v to be retired", retired)
+	}
+
+	// The active key cannot be destroyed.
+	if err := db.DestroyTokenSigningKeyVersion(ctx, created.ID, SystemTest); err == nil {
+		t.Errorf("expected error destroying active key")
+	}
+
+	list, err := db.ListTokenSigningKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(list), 3; got != want {
+		t.Errorf("expected %d keys, got %d", want, got)
+	}
+}
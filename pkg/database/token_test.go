@@ -15,6 +15,7 @@
 package database
 
 import (
+	"context"
 	"fmt"
 	"strings"
 	"testing"
@@ -377,6 +378,7 @@ func TestIssueToken(t *testing.T) {
 func TestPurgeTokens(t *testing.T) {
 	t.Parallel()
 
+	ctx := context.Background()
 	db, _ := testDatabaseInstance.NewDatabase(t, nil)
 
 	now := time.Now()
@@ -394,9 +396,9 @@ func TestPurgeTokens(t *testing.T) {
 	// Need to let some time lapse since we can't back date records through normal channels.
 	time.Sleep(2 * time.Second)
 
-	if count, err := db.PurgeTokens(time.Millisecond * 500); err != nil {
+	if result, err := db.PurgeTokens(ctx, time.Millisecond*500, nil); err != nil {
 		t.Fatalf("error doing purge: %v", err)
-	} else if count != 2 {
-		t.Fatalf("purge record count mismatch, want: 2, got: %v", count)
+	} else if result.Count != 2 {
+		t.Fatalf("purge record count mismatch, want: 2, got: %v", result.Count)
 	}
 }
@@ -15,6 +15,7 @@
 package database
 
 import (
+	"context"
 	"fmt"
 	"strings"
 	"time"
@@ -222,6 +223,7 @@ func (u *User) AddToRealm(db *Database, r *Realm, permissions rbac.Permission, a
 		if old, new := existing.Permissions, permissions; old != new {
 			audit := BuildAuditEntry(actor, "updated user permissions", u, r.ID)
 			audit.Diff = stringSliceDiff(rbac.PermissionNames(old), rbac.PermissionNames(new))
+			audit.AddChange("Permissions", rbac.PermissionNames(old), rbac.PermissionNames(new))
 			if err := tx.Save(audit).Error; err != nil {
 				return fmt.Errorf("failed to save audit: %w", err)
 			}
@@ -418,6 +420,11 @@ func (db *Database) DeleteUser(u *User, actor Auditable) error {
 			return fmt.Errorf("failed to save audits: %w", err)
 		}
 
+		// Unbind the user's identities so they can be bound to another user.
+		if err := tx.Where("user_id = ?", u.ID).Delete(&UserIdentity{}).Error; err != nil {
+			return fmt.Errorf("failed to delete identities: %w", err)
+		}
+
 		// Delete the user
 		if err := tx.Delete(u).Error; err != nil {
 			return fmt.Errorf("failed to save user: %w", err)
@@ -429,17 +436,19 @@ func (db *Database) DeleteUser(u *User, actor Auditable) error {
 
 // PurgeUsers will delete users who are not a system admin, not a member of any realms
 // and have not been modified before the expiry time.
-func (db *Database) PurgeUsers(maxAge time.Duration) (int64, error) {
-	if maxAge > 0 {
-		maxAge = -1 * maxAge
-	}
-	deleteBefore := time.Now().UTC().Add(maxAge)
-	// Delete users who were created/updated before the expiry time.
-	rtn := db.db.Unscoped().
-		Where("users.system_admin = false AND users.created_at < ? AND users.updated_at < ?", deleteBefore, deleteBefore).
-		Where("NOT EXISTS(SELECT 1 FROM memberships WHERE memberships.user_id = users.id LIMIT 1)"). // delete where no realm association exists.
-		Delete(&User{})
-	return rtn.RowsAffected, rtn.Error
+func (db *Database) PurgeUsers(ctx context.Context, maxAge time.Duration, opts *PurgeOptions) (*PurgeResult, error) {
+	deleteBefore := time.Now().UTC().Add(-absDuration(maxAge))
+
+	// Delete users who were created/updated before the expiry time and have no
+	// realm association.
+	result := &PurgeResult{Table: "users"}
+	err := db.purge(ctx, &purgeQuery{
+		table: "users",
+		where: "users.system_admin = false AND users.created_at < ? AND users.updated_at < ? " +
+			"AND NOT EXISTS(SELECT 1 FROM memberships WHERE memberships.user_id = users.id LIMIT 1)",
+		args: []interface{}{deleteBefore, deleteBefore},
+	}, opts, result)
+	return result, err
 }
 
 func (db *Database) SaveUser(u *User, actor Auditable) error {
@@ -477,18 +486,21 @@ func (db *Database) SaveUser(u *User, actor Auditable) error {
 			if existing.SystemAdmin != u.SystemAdmin {
 				audit := BuildAuditEntry(actor, "updated user system admin", u, 0)
 				audit.Diff = boolDiff(existing.SystemAdmin, u.SystemAdmin)
+				audit.AddChange("SystemAdmin", existing.SystemAdmin, u.SystemAdmin)
 				audits = append(audits, audit)
 			}
 
 			if existing.Name != u.Name {
 				audit := BuildAuditEntry(actor, "updated user's name", u, 0)
 				audit.Diff = stringDiff(existing.Name, u.Name)
+				audit.AddChange("Name", existing.Name, u.Name)
 				audits = append(audits, audit)
 			}
 
 			if existing.Email != u.Email {
 				audit := BuildAuditEntry(actor, "updated user's email", u, 0)
 				audit.Diff = stringDiff(existing.Email, u.Email)
+				audit.AddChange("Email", existing.Email, u.Email)
 				audits = append(audits, audit)
 			}
 		}
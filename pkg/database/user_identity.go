@@ -0,0 +1,117 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/exposure-notifications-verification-server/internal/project"
+	"github.com/jinzhu/gorm"
+)
+
+// ErrIdentityMismatch is the error returned when a user is already bound to a
+// different subject at the same identity provider.
+var ErrIdentityMismatch = errors.New("user is bound to a different identity at this identity provider")
+
+// UserIdentity binds a user to their subject at an OpenID Connect identity
+// provider. Once bound, the user is identified by the (provider, subject) pair
+// instead of by their email address.
+type UserIdentity struct {
+	ID        uint   `gorm:"primary_key;"`
+	UserID    uint   `gorm:"column:user_id; type:integer; not null;"`
+	Provider  string `gorm:"column:provider; type:varchar(100); not null;"`
+	Subject   string `gorm:"column:subject; type:varchar(255); not null;"`
+	CreatedAt time.Time
+}
+
+// FindUserIDByIdentity returns the ID of the user bound to the subject at the
+// identity provider. It returns an error if the record is not found.
+func (db *Database) FindUserIDByIdentity(provider, subject string) (uint, error) {
+	var identity UserIdentity
+	if err := db.db.
+		Where("provider = ? AND subject = ?", provider, subject).
+		First(&identity).
+		Error; err != nil {
+		return 0, err
+	}
+	return identity.UserID, nil
+}
+
+// BindUserIdentity returns the user bound to the subject at the identity
+// provider. If no user is bound to the subject, the user with the given email
+// address is bound to it, unless that user is already bound to another subject
+// at the same identity provider. The email address must be verified by the
+// identity provider.
+func (db *Database) BindUserIdentity(provider, subject, email string) (*User, error) {
+	if provider == "" || subject == "" {
+		return nil, fmt.Errorf("provider and subject are required")
+	}
+
+	var user User
+	if err := db.db.Transaction(func(tx *gorm.DB) error {
+		var identity UserIdentity
+		err := tx.
+			Set("gorm:query_option", "FOR UPDATE").
+			Where("provider = ? AND subject = ?", provider, subject).
+			First(&identity).
+			Error
+		if err == nil {
+			return tx.Where("id = ?", identity.UserID).First(&user).Error
+		}
+		if !IsNotFound(err) {
+			return fmt.Errorf("failed to find identity: %w", err)
+		}
+
+		if err := tx.
+			Where("email = ?", project.TrimSpace(email)).
+			First(&user).
+			Error; err != nil {
+			return err
+		}
+
+		var count int
+		if err := tx.
+			Model(&UserIdentity{}).
+			Where("user_id = ? AND provider = ?", user.ID, provider).
+			Count(&count).
+			Error; err != nil {
+			return fmt.Errorf("failed to count identities: %w", err)
+		}
+		if count > 0 {
+			return ErrIdentityMismatch
+		}
+
+		identity = UserIdentity{
+			UserID:   user.ID,
+			Provider: provider,
+			Subject:  subject,
+		}
+		if err := tx.Create(&identity).Error; err != nil {
+			return fmt.Errorf("failed to save identity: %w", err)
+		}
+
+		audit := BuildAuditEntry(&user, "bound identity provider", &user, 0)
+		audit.AddChange("IdentityProvider", "", provider)
+		if err := tx.Save(audit).Error; err != nil {
+			return fmt.Errorf("failed to save audits: %w", err)
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
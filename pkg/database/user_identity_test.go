@@ -0,0 +1,84 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestBindUserIdentity(t *testing.T) {
+	t.Parallel()
+
+	db, _ := testDatabaseInstance.NewDatabase(t, nil)
+
+	alice := &User{Email: "alice@example.com", Name: "Alice"}
+	if err := db.SaveUser(alice, SystemTest); err != nil {
+		t.Fatal(err)
+	}
+	bob := &User{Email: "bob@example.com", Name: "Bob"}
+	if err := db.SaveUser(bob, SystemTest); err != nil {
+		t.Fatal(err)
+	}
+
+	// First sign in binds by email.
+	user, err := db.BindUserIdentity("azure", "alice-sub", "alice@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := user.ID, alice.ID; got != want {
+		t.Errorf("expected user %d to be %d", got, want)
+	}
+
+	id, err := db.FindUserIDByIdentity("azure", "alice-sub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := id, alice.ID; got != want {
+		t.Errorf("expected user %d to be %d", got, want)
+	}
+
+	// Later sign ins use the subject, even if the email claim changes.
+	user, err = db.BindUserIdentity("azure", "alice-sub", "bob@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := user.ID, alice.ID; got != want {
+		t.Errorf("expected user %d to be %d", got, want)
+	}
+
+	// Another subject cannot claim a bound user by email.
+	if _, err := db.BindUserIdentity("azure", "mallory-sub", "alice@example.com"); !errors.Is(err, ErrIdentityMismatch) {
+		t.Errorf("expected %v, got %v", ErrIdentityMismatch, err)
+	}
+
+	// The same user can be bound at another identity provider.
+	if _, err := db.BindUserIdentity("okta", "alice-okta", "alice@example.com"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Unknown users are not created.
+	if _, err := db.BindUserIdentity("azure", "carol-sub", "carol@example.com"); !IsNotFound(err) {
+		t.Errorf("expected not found, got %v", err)
+	}
+
+	// Deleting the user removes the binding.
+	if err := db.DeleteUser(alice, SystemTest); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.FindUserIDByIdentity("azure", "alice-sub"); !IsNotFound(err) {
+		t.Errorf("expected not found, got %v", err)
+	}
+}
@@ -15,6 +15,7 @@
 package database
 
 import (
+	"context"
 	"testing"
 	"time"
 
@@ -123,6 +124,7 @@ func TestUser_Lifecycle(t *testing.T) {
 func TestDatabase_PurgeUsers(t *testing.T) {
 	t.Parallel()
 
+	ctx := context.Background()
 	db, _ := testDatabaseInstance.NewDatabase(t, nil)
 
 	realm, err := db.FindRealm(1)
@@ -142,7 +144,7 @@ func TestDatabase_PurgeUsers(t *testing.T) {
 	expectExists(t, db, user.ID)
 
 	// is admin
-	if _, err := db.PurgeUsers(time.Duration(0)); err != nil {
+	if _, err := db.PurgeUsers(ctx, time.Duration(0), nil); err != nil {
 		t.Fatal(err)
 	}
 	expectExists(t, db, user.ID)
@@ -157,7 +159,7 @@ func TestDatabase_PurgeUsers(t *testing.T) {
 	}
 
 	// has a realm
-	if _, err := db.PurgeUsers(time.Duration(0)); err != nil {
+	if _, err := db.PurgeUsers(ctx, time.Duration(0), nil); err != nil {
 		t.Fatal(err)
 	}
 
@@ -167,13 +169,13 @@ func TestDatabase_PurgeUsers(t *testing.T) {
 	}
 
 	// not old enough
-	if _, err := db.PurgeUsers(time.Hour); err != nil {
+	if _, err := db.PurgeUsers(ctx, time.Hour, nil); err != nil {
 		t.Fatal(err)
 	}
 	expectExists(t, db, user.ID)
 
 	// should delete now
-	if _, err := db.PurgeUsers(time.Duration(0)); err != nil {
+	if _, err := db.PurgeUsers(ctx, time.Duration(0), nil); err != nil {
 		t.Fatal(err)
 	}
 
@@ -15,6 +15,7 @@
 package database
 
 import (
+	"context"
 	"crypto/hmac"
 	"crypto/sha512"
 	"encoding/base64"
@@ -23,7 +24,6 @@ import (
 	"strings"
 	"time"
 
-	"github.com/google/exposure-notifications-server/pkg/timeutils"
 	"github.com/google/exposure-notifications-verification-server/internal/project"
 	"github.com/jinzhu/gorm"
 )
@@ -88,6 +88,33 @@ type VerificationCode struct {
 	// API AND the API caller supplied it in the request. This ID has no meaning
 	// in this system. It can be up to 255 characters in length.
 	IssuingExternalID string `gorm:"column:issuing_external_id; type:varchar(255);"`
+
+	// IssuingSiteID is the ID of the site in the database at which this
+	// verification code was issued. It is populated from the request or from
+	// the issuer's default site, and is zero if neither names a site.
+	IssuingSiteID uint `gorm:"column:issuing_site_id; type:integer; not null; default:0;"`
+
+	// siteDailyCodeLimit is the daily code limit of the issuing site, which is
+	// enforced when the code is created. It is set by SetIssuingSite.
+	siteDailyCodeLimit uint
+
+	// siteStatsCounted is true if the code was already counted in the site
+	// statistics while enforcing the site's daily code limit.
+	siteStatsCounted bool
+
+	// statsLocation is the timezone of the realm, in which the code's statistics
+	// are bucketed. It is set from the realm when the code is saved, so the
+	// realm does not need to be looked up again. If it is nil, the realm is
+	// looked up.
+	statsLocation *time.Location
+}
+
+// SetIssuingSite attributes the code to the site. If the site has a daily code
+// limit, saving the code fails with ErrSiteDailyCodeLimitReached once the site
+// has issued that many codes today.
+func (v *VerificationCode) SetIssuingSite(s *Site) {
+	v.IssuingSiteID = s.ID
+	v.siteDailyCodeLimit = s.DailyCodeLimit
 }
 
 // BeforeSave is used by callbacks.
@@ -103,10 +130,15 @@ func (v *VerificationCode) BeforeSave(tx *gorm.DB) error {
 }
 
 // AfterCreate runs after the verification code has been saved, primarily used
-// to update statistics about usage. If the executions fail, an error is logged
-// but the transaction continues. This is called automatically by gorm.
+// to update statistics about usage. Statistics are bucketed by day in the
+// realm's timezone. If the executions fail, an error is logged but the
+// transaction continues. This is called automatically by gorm.
 func (v *VerificationCode) AfterCreate(scope *gorm.Scope) {
-	date := timeutils.Midnight(v.CreatedAt)
+	loc := v.statsLocation
+	if loc == nil {
+		loc = loadRealmLocation(scope.DB(), v.RealmID)
+	}
+	date := statsDate(v.CreatedAt, loc)
 
 	// If the issuer was a user, update the user stats for the day.
 	if v.IssuingUserID != 0 {
@@ -136,6 +168,20 @@ func (v *VerificationCode) AfterCreate(scope *gorm.Scope) {
 		}
 	}
 
+	// If the code was issued at a site, update the site stats for the day.
+	if v.IssuingSiteID != 0 && !v.siteStatsCounted {
+		sql := `
+			INSERT INTO site_stats (date, realm_id, site_id, codes_issued)
+				VALUES ($1, $2, $3, 1)
+			ON CONFLICT (date, site_id) DO UPDATE
+				SET codes_issued = site_stats.codes_issued + 1
+		`
+
+		if err := scope.DB().Exec(sql, date, v.RealmID, v.IssuingSiteID).Error; err != nil {
+			scope.Log(fmt.Sprintf("failed to update stats: %v", err))
+		}
+	}
+
 	// If the issuer was a app, update the app stats for the day.
 	if v.IssuingAppID != 0 {
 		sql := `
@@ -207,6 +253,15 @@ func (db *Database) IsCodeExpired(v *VerificationCode, code string) (bool, CodeT
 	}
 }
 
+func (v *VerificationCode) AuditID() string {
+	return fmt.Sprintf("verification_codes:%d", v.ID)
+}
+
+// AuditDisplay is the code's UUID. The code itself is never displayed.
+func (v *VerificationCode) AuditDisplay() string {
+	return v.UUID
+}
+
 // IsExpired returns true if a verification code has expired.
 func (v *VerificationCode) IsExpired() bool {
 	now := time.Now().UTC()
@@ -320,10 +375,57 @@ func (db *Database) SaveVerificationCode(vc *VerificationCode, realm *Realm) err
 	if err := vc.Validate(realm); err != nil {
 		return err
 	}
-	if vc.Model.ID == 0 {
+	if realm != nil && realm.ID == vc.RealmID {
+		vc.statsLocation = realm.Location()
+	}
+	if vc.Model.ID != 0 {
+		return db.db.Save(vc).Error
+	}
+	if vc.IssuingSiteID == 0 || vc.siteDailyCodeLimit == 0 {
 		return db.db.Create(vc).Error
 	}
-	return db.db.Save(vc).Error
+
+	return db.db.Transaction(func(tx *gorm.DB) error {
+		if err := takeSiteDailyCode(tx, vc); err != nil {
+			return err
+		}
+		if err := tx.Create(vc).Error; err != nil {
+			vc.siteStatsCounted = false
+			return err
+		}
+		return nil
+	})
+}
+
+// takeSiteDailyCode counts the code in its site's statistics for the day, unless
+// the site has already reached its daily code limit. The row is locked by the
+// upsert, so concurrent codes for the same site cannot exceed the limit.
+func takeSiteDailyCode(tx *gorm.DB, vc *VerificationCode) error {
+	if vc.CreatedAt.IsZero() {
+		vc.CreatedAt = time.Now()
+	}
+	loc := vc.statsLocation
+	if loc == nil {
+		loc = loadRealmLocation(tx, vc.RealmID)
+	}
+
+	sql := `
+		INSERT INTO site_stats (date, realm_id, site_id, codes_issued)
+			VALUES ($1, $2, $3, 1)
+		ON CONFLICT (date, site_id) DO UPDATE
+			SET codes_issued = site_stats.codes_issued + 1
+			WHERE site_stats.codes_issued < $4
+	`
+
+	result := tx.Exec(sql, statsDate(vc.CreatedAt, loc), vc.RealmID, vc.IssuingSiteID, vc.siteDailyCodeLimit)
+	if err := result.Error; err != nil {
+		return fmt.Errorf("failed to count site code: %w", err)
+	}
+	if result.RowsAffected == 0 {
+		return ErrSiteDailyCodeLimitReached
+	}
+	vc.siteStatsCounted = true
+	return nil
 }
 
 // DeleteVerificationCode deletes the code if it exists. This is a hard delete.
@@ -341,30 +443,54 @@ func (db *Database) DeleteVerificationCode(code string) error {
 
 // RecycleVerificationCodes sets to null code and long_code values
 // so that status can be retained longer, but the codes are recycled into the pool.
-func (db *Database) RecycleVerificationCodes(maxAge time.Duration) (int64, error) {
-	if maxAge > 0 {
-		maxAge = -1 * maxAge
-	}
-	deleteBefore := time.Now().UTC().Add(maxAge)
+func (db *Database) RecycleVerificationCodes(ctx context.Context, maxAge time.Duration, opts *PurgeOptions) (*PurgeResult, error) {
+	deleteBefore := time.Now().UTC().Add(-absDuration(maxAge))
+
 	// Null out the codes where this can be done.
-	rtn := db.db.Model(&VerificationCode{}).
-		Select("code", "long_code").
-		Where("expires_at < ? AND long_expires_at < ? AND (code != ? OR long_code != ?)", deleteBefore, deleteBefore, "", "").
-		Update(map[string]interface{}{"code": "", "long_code": ""})
-	return rtn.RowsAffected, rtn.Error
+	result := &PurgeResult{Table: "verification_codes"}
+	err := db.purge(ctx, &purgeQuery{
+		table:       "verification_codes",
+		realmColumn: "realm_id",
+		set:         "code = '', long_code = '', updated_at = NOW()",
+		where:       "expires_at < ? AND long_expires_at < ? AND (code != '' OR long_code != '')",
+		args:        []interface{}{deleteBefore, deleteBefore},
+	}, opts, result)
+	return result, err
 }
 
 // PurgeVerificationCodes will delete verifications that have expired since at least the
-// provided maxAge ago.
+// provided maxAge ago. Realms in overrides use their own maximum age instead.
 // This is a hard delete, not a soft delete.
-func (db *Database) PurgeVerificationCodes(maxAge time.Duration) (int64, error) {
-	if maxAge > 0 {
-		maxAge = -1 * maxAge
+func (db *Database) PurgeVerificationCodes(ctx context.Context, maxAge time.Duration, overrides RetentionOverrides, opts *PurgeOptions) (*PurgeResult, error) {
+	now := time.Now().UTC()
+	result := &PurgeResult{Table: "verification_codes"}
+
+	for _, realmID := range overrides.RealmIDs() {
+		deleteBefore := now.Add(-absDuration(overrides[realmID]))
+		if err := db.purge(ctx, &purgeQuery{
+			table:       "verification_codes",
+			realmColumn: "realm_id",
+			where:       "realm_id = ? AND expires_at < ? AND long_expires_at < ?",
+			args:        []interface{}{realmID, deleteBefore, deleteBefore},
+		}, opts, result); err != nil {
+			return result, err
+		}
 	}
-	deleteBefore := time.Now().UTC().Add(maxAge)
+
 	// Delete codes that expired before the delete before time.
-	rtn := db.db.Unscoped().Where("expires_at < ? AND long_expires_at < ?", deleteBefore, deleteBefore).Delete(&VerificationCode{})
-	return rtn.RowsAffected, rtn.Error
+	deleteBefore := now.Add(-absDuration(maxAge))
+	q := &purgeQuery{
+		table:       "verification_codes",
+		realmColumn: "realm_id",
+		where:       "expires_at < ? AND long_expires_at < ?",
+		args:        []interface{}{deleteBefore, deleteBefore},
+	}
+	if ids := overrides.RealmIDs(); len(ids) > 0 {
+		q.where += " AND (realm_id IS NULL OR realm_id NOT IN (?))"
+		q.args = append(q.args, ids)
+	}
+	err := db.purge(ctx, q, opts, result)
+	return result, err
 }
 
 // GenerateVerificationCodeHMAC generates the HMAC of the code using the latest
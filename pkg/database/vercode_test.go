@@ -15,6 +15,7 @@
 package database
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"strings"
@@ -356,6 +357,7 @@ func TestDeleteVerificationCode(t *testing.T) {
 func TestVerificationCodesCleanup(t *testing.T) {
 	t.Parallel()
 
+	ctx := context.Background()
 	db, _ := testDatabaseInstance.NewDatabase(t, nil)
 
 	now := time.Now()
@@ -382,10 +384,10 @@ func TestVerificationCodesCleanup(t *testing.T) {
 	// Need to let some time lapse since we can't back date records through normal channels.
 	time.Sleep(2 * time.Second)
 
-	if count, err := db.RecycleVerificationCodes(time.Millisecond * 500); err != nil {
+	if result, err := db.RecycleVerificationCodes(ctx, time.Millisecond*500, nil); err != nil {
 		t.Fatalf("error doing purge: %v", err)
-	} else if count != 2 {
-		t.Fatalf("purge record count mismatch, want: 2, got: %v", count)
+	} else if result.Count != 2 {
+		t.Fatalf("purge record count mismatch, want: 2, got: %v", result.Count)
 	}
 
 	// Find first two by UUID.
@@ -413,10 +415,10 @@ func TestVerificationCodesCleanup(t *testing.T) {
 	}
 
 	// Run the purge.
-	if count, err := db.PurgeVerificationCodes(time.Millisecond * 500); err != nil {
+	if result, err := db.PurgeVerificationCodes(ctx, time.Millisecond*500, nil, nil); err != nil {
 		t.Fatalf("error doing purge: %v", err)
-	} else if count != 2 {
-		t.Fatalf("purge record count mismatch, want: 2, got: %v", count)
+	} else if result.Count != 2 {
+		t.Fatalf("purge record count mismatch, want: 2, got: %v", result.Count)
 	}
 
 	// Find first two by UUID, expect a not found error
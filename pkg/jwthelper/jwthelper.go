@@ -20,7 +20,8 @@ package jwthelper
 import (
 	"crypto"
 	"crypto/rand"
-	"crypto/sha256"
+	_ "crypto/sha256" // register hash
+	_ "crypto/sha512" // register hash
 	"encoding/asn1"
 	"fmt"
 	"math/big"
@@ -33,17 +34,49 @@ import (
 // Needed for taking a verification token back in and issuing a certificate.
 
 // SignJWT takes a JWT structure, extracts the signing string and signs it with the
-// provided signer. The base64 serialzied JWT is returned.
+// provided signer. The signature format is determined by the token's signing
+// method, which must be ES256, ES384, or EdDSA. The base64 serialzied JWT is
+// returned.
 func SignJWT(token *jwt.Token, signer crypto.Signer) (string, error) {
 	signingString, err := token.SigningString()
 	if err != nil {
 		return "", err
 	}
 
-	digest := sha256.Sum256([]byte(signingString))
-	sig, err := signer.Sign(rand.Reader, digest[:], nil)
+	var sig []byte
+	switch alg := token.Method.Alg(); alg {
+	case jwt.SigningMethodES256.Alg():
+		sig, err = signECDSA(signer, crypto.SHA256, 256, signingString)
+	case jwt.SigningMethodES384.Alg():
+		sig, err = signECDSA(signer, crypto.SHA384, 384, signingString)
+	case SigningMethodEdDSA.Alg():
+		// Ed25519 signs the full message, not a digest.
+		sig, err = signer.Sign(rand.Reader, []byte(signingString), crypto.Hash(0))
+		if err != nil {
+			err = fmt.Errorf("error signing token: %w", err)
+		}
+	default:
+		return "", fmt.Errorf("unsupported signing method %q", alg)
+	}
 	if err != nil {
-		return "", fmt.Errorf("error signing token: %w", err)
+		return "", err
+	}
+
+	return strings.Join([]string{signingString, jwt.EncodeSegment(sig)}, "."), nil
+}
+
+// signECDSA signs the digest of the signing string and converts the ASN1
+// signature to the fixed-width R || S format required by JWS.
+func signECDSA(signer crypto.Signer, hash crypto.Hash, curveBits int, signingString string) ([]byte, error) {
+	h := hash.New()
+	if _, err := h.Write([]byte(signingString)); err != nil {
+		return nil, fmt.Errorf("failed to hash signing string: %w", err)
+	}
+	digest := h.Sum(nil)
+
+	sig, err := signer.Sign(rand.Reader, digest, hash)
+	if err != nil {
+		return nil, fmt.Errorf("error signing token: %w", err)
 	}
 
 	// Unpack the ASN1 signature. ECDSA signers are supposed to return this format
@@ -58,13 +91,12 @@ func SignJWT(token *jwt.Token, signer crypto.Signer) (string, error) {
 	// 1 .  Generate a digital signature of the JWS Signing Input using ECDSA
 	//      P-256 SHA-256 with the desired private key.  The output will be
 	//      the pair (R, S), where R and S are 256-bit unsigned integers.
-	_, err = asn1.Unmarshal(sig, &parsedSig)
-	if err != nil {
-		return "", fmt.Errorf("unable to unmarshal signature: %w", err)
+	if _, err := asn1.Unmarshal(sig, &parsedSig); err != nil {
+		return nil, fmt.Errorf("unable to unmarshal signature: %w", err)
 	}
 
-	keyBytes := 256 / 8
-	if 256%8 > 0 {
+	keyBytes := curveBits / 8
+	if curveBits%8 > 0 {
 		keyBytes++
 	}
 
@@ -83,7 +115,5 @@ func SignJWT(token *jwt.Token, signer crypto.Signer) (string, error) {
 	// 3. Concatenate the two octet sequences in the order R and then S.
 	//	 	(Note that many ECDSA implementations will directly produce this
 	//	 	concatenation as their output.)
-	sig = append(rBytesPadded, sBytesPadded...)
-
-	return strings.Join([]string{signingString, jwt.EncodeSegment(sig)}, "."), nil
+	return append(rBytesPadded, sBytesPadded...), nil
 }
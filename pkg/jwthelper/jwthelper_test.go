@@ -0,0 +1,102 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jwthelper
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"testing"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+func TestSignJWT(t *testing.T) {
+	t.Parallel()
+
+	p256, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p384, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, ed, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name   string
+		method jwt.SigningMethod
+		signer crypto.Signer
+		err    bool
+	}{
+		{
+			name:   "es256",
+			method: jwt.SigningMethodES256,
+			signer: p256,
+		},
+		{
+			name:   "es384",
+			method: jwt.SigningMethodES384,
+			signer: p384,
+		},
+		{
+			name:   "eddsa",
+			method: SigningMethodEdDSA,
+			signer: ed,
+		},
+		{
+			name:   "unsupported",
+			method: jwt.SigningMethodHS256,
+			signer: p256,
+			err:    true,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			token := jwt.NewWithClaims(tc.method, &jwt.StandardClaims{Subject: "test"})
+			signed, err := SignJWT(token, tc.signer)
+			if err != nil {
+				if tc.err {
+					return
+				}
+				t.Fatal(err)
+			}
+			if tc.err {
+				t.Fatal("expected error")
+			}
+
+			parsed, err := jwt.Parse(signed, func(token *jwt.Token) (interface{}, error) {
+				return tc.signer.Public(), nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, want := parsed.Method.Alg(), tc.method.Alg(); got != want {
+				t.Errorf("expected %q to be %q", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,112 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package keyutils
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"fmt"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/google/exposure-notifications-verification-server/pkg/jwthelper"
+)
+
+// Algorithm is a JWS signing algorithm for certificate signing keys.
+type Algorithm string
+
+const (
+	// AlgorithmES256 is ECDSA using P-256 and SHA-256. This is the default.
+	AlgorithmES256 Algorithm = "ES256"
+
+	// AlgorithmES384 is ECDSA using P-384 and SHA-384.
+	AlgorithmES384 Algorithm = "ES384"
+
+	// AlgorithmEdDSA is EdDSA using Ed25519.
+	AlgorithmEdDSA Algorithm = "EdDSA"
+)
+
+// Algorithms is the list of supported signing algorithms, in display order.
+var Algorithms = []Algorithm{AlgorithmES256, AlgorithmES384, AlgorithmEdDSA}
+
+// ParseAlgorithm parses the given string as an Algorithm. The empty string is
+// treated as ES256 for keys created before algorithms were tracked.
+func ParseAlgorithm(s string) (Algorithm, error) {
+	if s == "" {
+		return AlgorithmES256, nil
+	}
+	for _, a := range Algorithms {
+		if string(a) == s {
+			return a, nil
+		}
+	}
+	return "", fmt.Errorf("unsupported signing algorithm %q", s)
+}
+
+// AlgorithmForPublicKey returns the signing algorithm for the given public key.
+func AlgorithmForPublicKey(pub crypto.PublicKey) (Algorithm, error) {
+	switch typ := pub.(type) {
+	case *ecdsa.PublicKey:
+		switch typ.Curve {
+		case elliptic.P256():
+			return AlgorithmES256, nil
+		case elliptic.P384():
+			return AlgorithmES384, nil
+		default:
+			return "", fmt.Errorf("unsupported ecdsa curve %s", typ.Curve.Params().Name)
+		}
+	case ed25519.PublicKey:
+		return AlgorithmEdDSA, nil
+	default:
+		return "", fmt.Errorf("unsupported public key type: %T", typ)
+	}
+}
+
+// ValidatePublicKey returns an error if the given public key cannot be used to
+// verify signatures with this algorithm.
+func (a Algorithm) ValidatePublicKey(pub crypto.PublicKey) error {
+	got, err := AlgorithmForPublicKey(pub)
+	if err != nil {
+		return err
+	}
+	if got != a {
+		return fmt.Errorf("key type mismatch: key is %s, but algorithm is %s", got, a)
+	}
+	return nil
+}
+
+// SigningMethod returns the JWT signing method for this algorithm.
+func (a Algorithm) SigningMethod() jwt.SigningMethod {
+	switch a {
+	case AlgorithmES384:
+		return jwt.SigningMethodES384
+	case AlgorithmEdDSA:
+		return jwthelper.SigningMethodEdDSA
+	default:
+		return jwt.SigningMethodES256
+	}
+}
+
+// SigningKeyCreator is implemented by key managers which can create signing
+// keys for a specific algorithm. The upstream key managers always create P-256
+// keys, so this is required for any other algorithm.
+type SigningKeyCreator interface {
+	// CreateSigningKeyForAlgorithm creates a new signing key in the given parent
+	// whose versions use the given algorithm, returning the id. If the key
+	// already exists, it returns the key's id.
+	CreateSigningKeyForAlgorithm(ctx context.Context, parent, name string, alg Algorithm) (string, error)
+}
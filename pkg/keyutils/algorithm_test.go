@@ -0,0 +1,100 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package keyutils
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"testing"
+)
+
+func TestParseAlgorithm(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name string
+		in   string
+		exp  Algorithm
+		err  bool
+	}{
+		{name: "empty", in: "", exp: AlgorithmES256},
+		{name: "es256", in: "ES256", exp: AlgorithmES256},
+		{name: "es384", in: "ES384", exp: AlgorithmES384},
+		{name: "eddsa", in: "EdDSA", exp: AlgorithmEdDSA},
+		{name: "unsupported", in: "HS256", err: true},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			alg, err := ParseAlgorithm(tc.in)
+			if (err != nil) != tc.err {
+				t.Fatalf("expected error to be %t, got %v", tc.err, err)
+			}
+			if got, want := alg, tc.exp; got != want {
+				t.Errorf("expected %q to be %q", got, want)
+			}
+		})
+	}
+}
+
+func TestAlgorithm_ValidatePublicKey(t *testing.T) {
+	t.Parallel()
+
+	p256, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p384, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edpub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name string
+		alg  Algorithm
+		pub  interface{}
+		err  bool
+	}{
+		{name: "es256", alg: AlgorithmES256, pub: &p256.PublicKey},
+		{name: "es384", alg: AlgorithmES384, pub: &p384.PublicKey},
+		{name: "eddsa", alg: AlgorithmEdDSA, pub: edpub},
+		{name: "es256_mismatch", alg: AlgorithmES256, pub: &p384.PublicKey, err: true},
+		{name: "eddsa_mismatch", alg: AlgorithmEdDSA, pub: &p256.PublicKey, err: true},
+		{name: "unsupported", alg: AlgorithmES256, pub: "nope", err: true},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			err := tc.alg.ValidatePublicKey(tc.pub)
+			if (err != nil) != tc.err {
+				t.Fatalf("expected error to be %t, got %v", tc.err, err)
+			}
+		})
+	}
+}
@@ -16,29 +16,48 @@ package keyutils
 
 import (
 	"crypto"
-	"crypto/ecdsa"
 	"crypto/x509"
 	"encoding/pem"
 	"fmt"
 )
 
-// EncodePublicKey returns the base64 encoded PEM block.
-func EncodePublicKey(publicKey crypto.PublicKey) (string, error) {
-	switch typ := publicKey.(type) {
-	case *ecdsa.PublicKey:
-		ecdsaKey := publicKey.(*ecdsa.PublicKey)
-		derBytes, err := x509.MarshalPKIXPublicKey(ecdsaKey)
-		if err != nil {
-			return "", fmt.Errorf("unable to parse public key: %w", err)
-		}
-
-		block := &pem.Block{
-			Type:  "PUBLIC KEY",
-			Bytes: derBytes,
-		}
-
-		return string(pem.EncodeToMemory(block)), nil
-	default:
-		return "", fmt.Errorf("unsupported public key type: %T", typ)
+// EncodePublicKey returns the base64 encoded PEM block and the signing
+// algorithm the key is used with.
+func EncodePublicKey(publicKey crypto.PublicKey) (string, Algorithm, error) {
+	alg, err := AlgorithmForPublicKey(publicKey)
+	if err != nil {
+		return "", "", err
 	}
+
+	derBytes, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		return "", "", fmt.Errorf("unable to parse public key: %w", err)
+	}
+
+	block := &pem.Block{
+		Type:  "PUBLIC KEY",
+		Bytes: derBytes,
+	}
+
+	return string(pem.EncodeToMemory(block)), alg, nil
+}
+
+// DecodePublicKey parses a PEM block produced by EncodePublicKey and returns
+// the public key and the signing algorithm it is used with.
+func DecodePublicKey(s string) (crypto.PublicKey, Algorithm, error) {
+	block, _ := pem.Decode([]byte(s))
+	if block == nil || block.Type != "PUBLIC KEY" {
+		return nil, "", fmt.Errorf("public key is not a PEM encoded PUBLIC KEY")
+	}
+
+	publicKey, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, "", fmt.Errorf("unable to parse public key: %w", err)
+	}
+
+	alg, err := AlgorithmForPublicKey(publicKey)
+	if err != nil {
+		return nil, "", err
+	}
+	return publicKey, alg, nil
 }
@@ -0,0 +1,91 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package keyutils
+
+import (
+	"context"
+	"fmt"
+
+	kms "cloud.google.com/go/kms/apiv1"
+	kmspb "google.golang.org/genproto/googleapis/cloud/kms/v1"
+	grpccodes "google.golang.org/grpc/codes"
+	grpcstatus "google.golang.org/grpc/status"
+)
+
+var _ SigningKeyCreator = (*GoogleCloudKMSSigningKeyCreator)(nil)
+
+// GoogleCloudKMSSigningKeyCreator creates Cloud KMS signing keys for a specific
+// algorithm. Cloud KMS does not support EdDSA.
+type GoogleCloudKMSSigningKeyCreator struct {
+	client *kms.KeyManagementClient
+	useHSM bool
+}
+
+// NewGoogleCloudKMSSigningKeyCreator creates a new signing key creator using
+// the default credentials.
+func NewGoogleCloudKMSSigningKeyCreator(ctx context.Context, useHSM bool) (*GoogleCloudKMSSigningKeyCreator, error) {
+	client, err := kms.NewKeyManagementClient(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create kms client: %w", err)
+	}
+
+	return &GoogleCloudKMSSigningKeyCreator{
+		client: client,
+		useHSM: useHSM,
+	}, nil
+}
+
+// CreateSigningKeyForAlgorithm implements SigningKeyCreator.
+func (c *GoogleCloudKMSSigningKeyCreator) CreateSigningKeyForAlgorithm(ctx context.Context, parent, name string, alg Algorithm) (string, error) {
+	var algorithm kmspb.CryptoKeyVersion_CryptoKeyVersionAlgorithm
+	switch alg {
+	case AlgorithmES256:
+		algorithm = kmspb.CryptoKeyVersion_EC_SIGN_P256_SHA256
+	case AlgorithmES384:
+		algorithm = kmspb.CryptoKeyVersion_EC_SIGN_P384_SHA384
+	default:
+		return "", fmt.Errorf("signing algorithm %s is not supported by Cloud KMS", alg)
+	}
+
+	protectionLevel := kmspb.ProtectionLevel_SOFTWARE
+	if c.useHSM {
+		protectionLevel = kmspb.ProtectionLevel_HSM
+	}
+
+	result, err := c.client.CreateCryptoKey(ctx, &kmspb.CreateCryptoKeyRequest{
+		Parent:      parent,
+		CryptoKeyId: name,
+		CryptoKey: &kmspb.CryptoKey{
+			Purpose: kmspb.CryptoKey_ASYMMETRIC_SIGN,
+			VersionTemplate: &kmspb.CryptoKeyVersionTemplate{
+				ProtectionLevel: protectionLevel,
+				Algorithm:       algorithm,
+			},
+		},
+	})
+	if err != nil {
+		if grpcstatus.Code(err) == grpccodes.AlreadyExists {
+			// The key already exists, just return it.
+			return fmt.Sprintf("%s/cryptoKeys/%s", parent, name), nil
+		}
+		return "", fmt.Errorf("failed to create signing key: %w", err)
+	}
+	return result.Name, nil
+}
+
+// Close closes the underlying client.
+func (c *GoogleCloudKMSSigningKeyCreator) Close() error {
+	return c.client.Close()
+}
@@ -0,0 +1,55 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package keyutils
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/exposure-notifications-server/pkg/keys"
+	"github.com/sethvargo/go-envconfig"
+)
+
+// KeyManagerTypePKCS11 is a key manager backed by a PKCS#11 module, typically
+// an on-premises HSM. It is configured with PKCS11Config.
+const KeyManagerTypePKCS11 keys.KeyManagerType = "PKCS11"
+
+// PKCS11Config is the configuration for the PKCS#11 key manager. It is read
+// from the environment when the key manager is created, since the upstream key
+// manager configuration cannot be extended.
+type PKCS11Config struct {
+	// ModulePath is the path to the PKCS#11 shared library provided by the HSM
+	// vendor.
+	ModulePath string `env:"PKCS11_MODULE_PATH, required"`
+
+	// TokenLabel is the label of the token that holds the keys.
+	TokenLabel string `env:"PKCS11_TOKEN_LABEL, required"`
+
+	// PIN is the user PIN for the token.
+	PIN string `env:"PKCS11_PIN, required" json:"-"`
+}
+
+// KeyManagerFor returns the appropriate key manager for the given type. It
+// supports all the upstream key managers and the PKCS#11 key manager.
+func KeyManagerFor(ctx context.Context, config *keys.Config) (keys.KeyManager, error) {
+	if config.KeyManagerType == KeyManagerTypePKCS11 {
+		var pkcs11Config PKCS11Config
+		if err := envconfig.Process(ctx, &pkcs11Config); err != nil {
+			return nil, fmt.Errorf("failed to process PKCS#11 config: %w", err)
+		}
+		return newPKCS11KeyManager(ctx, &pkcs11Config)
+	}
+	return keys.KeyManagerFor(ctx, config)
+}
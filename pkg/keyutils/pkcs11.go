@@ -0,0 +1,801 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build cgo
+
+package keyutils
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/asn1"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/exposure-notifications-server/pkg/keys"
+	"github.com/miekg/pkcs11"
+)
+
+// PKCS#11 v3.0 values which are not defined by the pkcs11 package.
+const (
+	ckkECEdwards           = 0x00000040
+	ckmECEdwardsKeyPairGen = 0x00001055
+	ckmEdDSA               = 0x00001057
+)
+
+const (
+	// pkcs11Application is stored on the data objects that represent keys, to
+	// distinguish them from other objects on the token.
+	pkcs11Application = "exposure-notifications-verification-server"
+
+	// pkcs11AlgorithmAES256 is the algorithm of encryption keys.
+	pkcs11AlgorithmAES256 = "AES256"
+
+	// pkcs11GCMNonceSize and pkcs11GCMTagSize are the AES-GCM parameters used for
+	// encryption.
+	pkcs11GCMNonceSize = 12
+	pkcs11GCMTagSize   = 128
+)
+
+var (
+	oidNamedCurveP256 = asn1.ObjectIdentifier{1, 2, 840, 10045, 3, 1, 7}
+	oidNamedCurveP384 = asn1.ObjectIdentifier{1, 3, 132, 0, 34}
+	oidEd25519        = asn1.ObjectIdentifier{1, 3, 101, 112}
+)
+
+// Compile-time checks that PKCS11 implements the key manager interfaces.
+var (
+	_ keys.KeyManager           = (*PKCS11)(nil)
+	_ keys.SigningKeyManager    = (*PKCS11)(nil)
+	_ keys.EncryptionKeyManager = (*PKCS11)(nil)
+	_ SigningKeyCreator         = (*PKCS11)(nil)
+)
+
+// PKCS11 is a key manager backed by a PKCS#11 token.
+//
+// A key is represented by a data object whose label is the key ID and whose
+// value is the key's algorithm. Key versions are key objects whose label is the
+// version ID and whose CKA_ID is the parent key ID. Version IDs are the parent
+// key ID followed by the creation time in nanoseconds, e.g.
+// "system/token-signing/1608000000000000000".
+//
+// Private and secret keys are created as sensitive and non-extractable, so key
+// material never leaves the token.
+type PKCS11 struct {
+	module *pkcs11Module
+
+	// lock serializes access to the session, since PKCS#11 sessions cannot be
+	// used concurrently.
+	lock    sync.Mutex
+	session pkcs11.SessionHandle
+}
+
+// pkcs11Module is a loaded and initialized PKCS#11 library. A library can only
+// be initialized once per process, so it is shared between key managers.
+type pkcs11Module struct {
+	path string
+	ctx  *pkcs11.Ctx
+	refs int
+}
+
+var (
+	pkcs11ModulesLock sync.Mutex
+	pkcs11Modules     = make(map[string]*pkcs11Module)
+)
+
+// NewPKCS11 creates a new PKCS#11 key manager for the token with the configured
+// label.
+func NewPKCS11(ctx context.Context, config *PKCS11Config) (*PKCS11, error) {
+	module, err := openPKCS11Module(config.ModulePath)
+	if err != nil {
+		return nil, err
+	}
+
+	session, err := openPKCS11Session(module.ctx, config.TokenLabel, config.PIN)
+	if err != nil {
+		closePKCS11Module(module)
+		return nil, err
+	}
+
+	return &PKCS11{
+		module:  module,
+		session: session,
+	}, nil
+}
+
+// newPKCS11KeyManager is used by KeyManagerFor. It avoids returning a typed nil
+// on error.
+func newPKCS11KeyManager(ctx context.Context, config *PKCS11Config) (keys.KeyManager, error) {
+	p, err := NewPKCS11(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Close closes the session and, if this was the last user, finalizes the
+// module.
+func (p *PKCS11) Close() error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	err := p.module.ctx.CloseSession(p.session)
+	closePKCS11Module(p.module)
+	if err != nil {
+		return fmt.Errorf("failed to close session: %w", err)
+	}
+	return nil
+}
+
+func openPKCS11Module(path string) (*pkcs11Module, error) {
+	pkcs11ModulesLock.Lock()
+	defer pkcs11ModulesLock.Unlock()
+
+	if m, ok := pkcs11Modules[path]; ok {
+		m.refs++
+		return m, nil
+	}
+
+	ctx := pkcs11.New(path)
+	if ctx == nil {
+		return nil, fmt.Errorf("failed to load PKCS#11 module %q", path)
+	}
+	if err := ctx.Initialize(); err != nil && !isPKCS11Error(err, pkcs11.CKR_CRYPTOKI_ALREADY_INITIALIZED) {
+		ctx.Destroy()
+		return nil, fmt.Errorf("failed to initialize PKCS#11 module: %w", err)
+	}
+
+	m := &pkcs11Module{path: path, ctx: ctx, refs: 1}
+	pkcs11Modules[path] = m
+	return m, nil
+}
+
+func closePKCS11Module(m *pkcs11Module) {
+	pkcs11ModulesLock.Lock()
+	defer pkcs11ModulesLock.Unlock()
+
+	m.refs--
+	if m.refs > 0 {
+		return
+	}
+
+	delete(pkcs11Modules, m.path)
+	_ = m.ctx.Finalize()
+	m.ctx.Destroy()
+}
+
+func openPKCS11Session(ctx *pkcs11.Ctx, label, pin string) (pkcs11.SessionHandle, error) {
+	slots, err := ctx.GetSlotList(true)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list slots: %w", err)
+	}
+
+	for _, slot := range slots {
+		info, err := ctx.GetTokenInfo(slot)
+		if err != nil {
+			return 0, fmt.Errorf("failed to get token info for slot %d: %w", slot, err)
+		}
+		if strings.TrimRight(info.Label, " \x00") != label {
+			continue
+		}
+
+		session, err := ctx.OpenSession(slot, pkcs11.CKF_SERIAL_SESSION|pkcs11.CKF_RW_SESSION)
+		if err != nil {
+			return 0, fmt.Errorf("failed to open session: %w", err)
+		}
+
+		// Login state is shared by all sessions to the token, so another key
+		// manager may have already logged in.
+		if err := ctx.Login(session, pkcs11.CKU_USER, pin); err != nil && !isPKCS11Error(err, pkcs11.CKR_USER_ALREADY_LOGGED_IN) {
+			_ = ctx.CloseSession(session)
+			return 0, fmt.Errorf("failed to login to token: %w", err)
+		}
+		return session, nil
+	}
+
+	return 0, fmt.Errorf("no PKCS#11 token with label %q", label)
+}
+
+// isPKCS11Error returns true if err is the given PKCS#11 return value.
+func isPKCS11Error(err error, rv uint) bool {
+	e, ok := err.(pkcs11.Error)
+	return ok && uint(e) == rv
+}
+
+// NewSigner creates a new signer for the given key version. If keyID is a key
+// instead of a key version, the most recent version is used.
+func (p *PKCS11) NewSigner(ctx context.Context, keyID string) (crypto.Signer, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	version, err := p.resolveVersion(keyID, pkcs11.CKO_PRIVATE_KEY)
+	if err != nil {
+		return nil, err
+	}
+
+	privateKey, err := p.findOne(versionTemplate(pkcs11.CKO_PRIVATE_KEY, version))
+	if err != nil {
+		return nil, fmt.Errorf("failed to find private key %s: %w", version, err)
+	}
+
+	publicKey, err := p.findOne(versionTemplate(pkcs11.CKO_PUBLIC_KEY, version))
+	if err != nil {
+		return nil, fmt.Errorf("failed to find public key %s: %w", version, err)
+	}
+
+	pub, err := p.publicKey(publicKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read public key %s: %w", version, err)
+	}
+
+	return &pkcs11Signer{
+		manager:    p,
+		privateKey: privateKey,
+		public:     pub,
+	}, nil
+}
+
+// Encrypt encrypts the plaintext with AES-GCM using the given key. If keyID is
+// a key instead of a key version, the most recent version is used. The version
+// is stored in the ciphertext so that it can be decrypted after rotation.
+func (p *PKCS11) Encrypt(ctx context.Context, keyID string, plaintext []byte, aad []byte) ([]byte, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	version, err := p.resolveVersion(keyID, pkcs11.CKO_SECRET_KEY)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := p.findOne(versionTemplate(pkcs11.CKO_SECRET_KEY, version))
+	if err != nil {
+		return nil, fmt.Errorf("failed to find encryption key %s: %w", version, err)
+	}
+
+	nonce := make([]byte, pkcs11GCMNonceSize)
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	params := pkcs11.NewGCMParams(nonce, aad, pkcs11GCMTagSize)
+	defer params.Free()
+
+	mech := []*pkcs11.Mechanism{pkcs11.NewMechanism(pkcs11.CKM_AES_GCM, params)}
+	if err := p.module.ctx.EncryptInit(p.session, mech, key); err != nil {
+		return nil, fmt.Errorf("failed to initialize encryption: %w", err)
+	}
+	ciphertext, err := p.module.ctx.Encrypt(p.session, plaintext)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt: %w", err)
+	}
+
+	// Some modules ignore the provided nonce and generate their own.
+	if iv := params.IV(); len(iv) == pkcs11GCMNonceSize {
+		nonce = iv
+	}
+
+	// Format is: [version length (2 bytes)][version][nonce][ciphertext]
+	out := make([]byte, 2, 2+len(version)+len(nonce)+len(ciphertext))
+	binary.BigEndian.PutUint16(out, uint16(len(version)))
+	out = append(out, version...)
+	out = append(out, nonce...)
+	out = append(out, ciphertext...)
+	return out, nil
+}
+
+// Decrypt decrypts ciphertext created by Encrypt. The key version must belong
+// to the given key.
+func (p *PKCS11) Decrypt(ctx context.Context, keyID string, ciphertext []byte, aad []byte) ([]byte, error) {
+	if len(ciphertext) < 2 {
+		return nil, fmt.Errorf("ciphertext is too short")
+	}
+	l := int(binary.BigEndian.Uint16(ciphertext))
+	ciphertext = ciphertext[2:]
+	if len(ciphertext) < l+pkcs11GCMNonceSize {
+		return nil, fmt.Errorf("ciphertext is too short")
+	}
+	version := string(ciphertext[:l])
+	nonce := ciphertext[l : l+pkcs11GCMNonceSize]
+	ciphertext = ciphertext[l+pkcs11GCMNonceSize:]
+
+	if version != keyID && versionParent(version) != keyID {
+		return nil, fmt.Errorf("ciphertext was not encrypted with %s", keyID)
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	key, err := p.findOne(versionTemplate(pkcs11.CKO_SECRET_KEY, version))
+	if err != nil {
+		return nil, fmt.Errorf("failed to find encryption key %s: %w", version, err)
+	}
+
+	params := pkcs11.NewGCMParams(nonce, aad, pkcs11GCMTagSize)
+	defer params.Free()
+
+	mech := []*pkcs11.Mechanism{pkcs11.NewMechanism(pkcs11.CKM_AES_GCM, params)}
+	if err := p.module.ctx.DecryptInit(p.session, mech, key); err != nil {
+		return nil, fmt.Errorf("failed to initialize decryption: %w", err)
+	}
+	plaintext, err := p.module.ctx.Decrypt(p.session, ciphertext)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt: %w", err)
+	}
+	return plaintext, nil
+}
+
+// SigningKeyVersions returns the versions of the given signing key, newest
+// first.
+func (p *PKCS11) SigningKeyVersions(ctx context.Context, parent string) ([]keys.SigningKeyVersion, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if _, err := p.keyAlgorithm(parent); err != nil {
+		return nil, err
+	}
+
+	versions, err := p.versions(parent, pkcs11.CKO_PRIVATE_KEY)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]keys.SigningKeyVersion, 0, len(versions))
+	for _, v := range versions {
+		result = append(result, &pkcs11SigningKeyVersion{
+			manager:   p,
+			keyID:     v,
+			createdAt: versionCreatedAt(v),
+		})
+	}
+	return result, nil
+}
+
+// CreateSigningKey creates a new ES256 signing key. If the key already exists,
+// it returns the key's id.
+func (p *PKCS11) CreateSigningKey(ctx context.Context, parent, name string) (string, error) {
+	return p.createKey(parent, name, string(AlgorithmES256))
+}
+
+// CreateSigningKeyForAlgorithm creates a new signing key for the given
+// algorithm. If the key already exists, it returns the key's id.
+func (p *PKCS11) CreateSigningKeyForAlgorithm(ctx context.Context, parent, name string, alg Algorithm) (string, error) {
+	if _, err := ParseAlgorithm(string(alg)); err != nil {
+		return "", err
+	}
+	return p.createKey(parent, name, string(alg))
+}
+
+// CreateEncryptionKey creates a new AES-256 encryption key. If the key already
+// exists, it returns the key's id.
+func (p *PKCS11) CreateEncryptionKey(ctx context.Context, parent, name string) (string, error) {
+	return p.createKey(parent, name, pkcs11AlgorithmAES256)
+}
+
+// CreateKeyVersion creates a new version of the given key using the key's
+// algorithm.
+func (p *PKCS11) CreateKeyVersion(ctx context.Context, parent string) (string, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	alg, err := p.keyAlgorithm(parent)
+	if err != nil {
+		return "", err
+	}
+
+	version := fmt.Sprintf("%s/%d", parent, time.Now().UTC().UnixNano())
+	common := []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_TOKEN, true),
+		pkcs11.NewAttribute(pkcs11.CKA_LABEL, version),
+		pkcs11.NewAttribute(pkcs11.CKA_ID, []byte(parent)),
+	}
+
+	switch alg {
+	case pkcs11AlgorithmAES256:
+		template := append([]*pkcs11.Attribute{
+			pkcs11.NewAttribute(pkcs11.CKA_CLASS, pkcs11.CKO_SECRET_KEY),
+			pkcs11.NewAttribute(pkcs11.CKA_KEY_TYPE, pkcs11.CKK_AES),
+			pkcs11.NewAttribute(pkcs11.CKA_VALUE_LEN, 32),
+			pkcs11.NewAttribute(pkcs11.CKA_ENCRYPT, true),
+			pkcs11.NewAttribute(pkcs11.CKA_DECRYPT, true),
+			pkcs11.NewAttribute(pkcs11.CKA_PRIVATE, true),
+			pkcs11.NewAttribute(pkcs11.CKA_SENSITIVE, true),
+			pkcs11.NewAttribute(pkcs11.CKA_EXTRACTABLE, false),
+		}, common...)
+
+		mech := []*pkcs11.Mechanism{pkcs11.NewMechanism(pkcs11.CKM_AES_KEY_GEN, nil)}
+		if _, err := p.module.ctx.GenerateKey(p.session, mech, template); err != nil {
+			return "", fmt.Errorf("failed to generate key: %w", err)
+		}
+	default:
+		var mechanism, keyType uint
+		var oid asn1.ObjectIdentifier
+		switch Algorithm(alg) {
+		case AlgorithmES256:
+			mechanism, keyType, oid = pkcs11.CKM_EC_KEY_PAIR_GEN, pkcs11.CKK_EC, oidNamedCurveP256
+		case AlgorithmES384:
+			mechanism, keyType, oid = pkcs11.CKM_EC_KEY_PAIR_GEN, pkcs11.CKK_EC, oidNamedCurveP384
+		case AlgorithmEdDSA:
+			mechanism, keyType, oid = ckmECEdwardsKeyPairGen, ckkECEdwards, oidEd25519
+		default:
+			return "", fmt.Errorf("key %s has unsupported algorithm %q", parent, alg)
+		}
+
+		params, err := asn1.Marshal(oid)
+		if err != nil {
+			return "", fmt.Errorf("failed to encode curve parameters: %w", err)
+		}
+
+		publicTemplate := append([]*pkcs11.Attribute{
+			pkcs11.NewAttribute(pkcs11.CKA_CLASS, pkcs11.CKO_PUBLIC_KEY),
+			pkcs11.NewAttribute(pkcs11.CKA_KEY_TYPE, keyType),
+			pkcs11.NewAttribute(pkcs11.CKA_EC_PARAMS, params),
+			pkcs11.NewAttribute(pkcs11.CKA_VERIFY, true),
+		}, common...)
+		privateTemplate := append([]*pkcs11.Attribute{
+			pkcs11.NewAttribute(pkcs11.CKA_CLASS, pkcs11.CKO_PRIVATE_KEY),
+			pkcs11.NewAttribute(pkcs11.CKA_KEY_TYPE, keyType),
+			pkcs11.NewAttribute(pkcs11.CKA_SIGN, true),
+			pkcs11.NewAttribute(pkcs11.CKA_PRIVATE, true),
+			pkcs11.NewAttribute(pkcs11.CKA_SENSITIVE, true),
+			pkcs11.NewAttribute(pkcs11.CKA_EXTRACTABLE, false),
+		}, common...)
+
+		mech := []*pkcs11.Mechanism{pkcs11.NewMechanism(mechanism, nil)}
+		if _, _, err := p.module.ctx.GenerateKeyPair(p.session, mech, publicTemplate, privateTemplate); err != nil {
+			return "", fmt.Errorf("failed to generate key pair: %w", err)
+		}
+	}
+
+	return version, nil
+}
+
+// DestroyKeyVersion destroys all objects for the given key version. If the
+// version does not exist, it does nothing.
+func (p *PKCS11) DestroyKeyVersion(ctx context.Context, id string) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	objects, err := p.find([]*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_LABEL, id),
+		pkcs11.NewAttribute(pkcs11.CKA_ID, []byte(versionParent(id))),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to find key version %s: %w", id, err)
+	}
+
+	for _, o := range objects {
+		if err := p.module.ctx.DestroyObject(p.session, o); err != nil {
+			return fmt.Errorf("failed to destroy key version %s: %w", id, err)
+		}
+	}
+	return nil
+}
+
+// createKey creates the data object that represents a key.
+func (p *PKCS11) createKey(parent, name, alg string) (string, error) {
+	if name == "" {
+		return "", fmt.Errorf("missing key name")
+	}
+	id := strings.Trim(parent, "/") + "/" + name
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	existing, err := p.find(keyTemplate(id))
+	if err != nil {
+		return "", fmt.Errorf("failed to lookup key %s: %w", id, err)
+	}
+	if len(existing) > 0 {
+		return id, nil
+	}
+
+	template := append(keyTemplate(id),
+		pkcs11.NewAttribute(pkcs11.CKA_VALUE, []byte(alg)),
+		pkcs11.NewAttribute(pkcs11.CKA_PRIVATE, true),
+		pkcs11.NewAttribute(pkcs11.CKA_MODIFIABLE, false),
+	)
+	if _, err := p.module.ctx.CreateObject(p.session, template); err != nil {
+		return "", fmt.Errorf("failed to create key %s: %w", id, err)
+	}
+	return id, nil
+}
+
+// keyAlgorithm returns the algorithm of the given key. It returns an error if
+// the key does not exist. The caller must hold the lock.
+func (p *PKCS11) keyAlgorithm(id string) (string, error) {
+	o, err := p.findOne(keyTemplate(id))
+	if err != nil {
+		return "", fmt.Errorf("failed to find key %s: %w", id, err)
+	}
+
+	attrs, err := p.module.ctx.GetAttributeValue(p.session, o, []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_VALUE, nil),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to read key %s: %w", id, err)
+	}
+	return string(attrs[0].Value), nil
+}
+
+// resolveVersion returns keyID if it is a key version of the given class,
+// otherwise it treats keyID as a key and returns its most recent version. The
+// caller must hold the lock.
+func (p *PKCS11) resolveVersion(keyID string, class uint) (string, error) {
+	objects, err := p.find(versionTemplate(class, keyID))
+	if err != nil {
+		return "", fmt.Errorf("failed to lookup key %s: %w", keyID, err)
+	}
+	if len(objects) > 0 {
+		return keyID, nil
+	}
+
+	versions, err := p.versions(keyID, class)
+	if err != nil {
+		return "", err
+	}
+	if len(versions) == 0 {
+		return "", fmt.Errorf("key %s does not exist or has no versions", keyID)
+	}
+	return versions[0], nil
+}
+
+// versions returns the IDs of the versions of the given key, newest first. The
+// caller must hold the lock.
+func (p *PKCS11) versions(parent string, class uint) ([]string, error) {
+	objects, err := p.find([]*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_CLASS, class),
+		pkcs11.NewAttribute(pkcs11.CKA_ID, []byte(parent)),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list versions of %s: %w", parent, err)
+	}
+
+	versions := make([]string, 0, len(objects))
+	for _, o := range objects {
+		attrs, err := p.module.ctx.GetAttributeValue(p.session, o, []*pkcs11.Attribute{
+			pkcs11.NewAttribute(pkcs11.CKA_LABEL, nil),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to read version label: %w", err)
+		}
+		versions = append(versions, string(attrs[0].Value))
+	}
+
+	sort.Slice(versions, func(i, j int) bool {
+		return versionCreatedAt(versions[i]).After(versionCreatedAt(versions[j]))
+	})
+	return versions, nil
+}
+
+// publicKey reads the public key from the given public key object. The caller
+// must hold the lock.
+func (p *PKCS11) publicKey(o pkcs11.ObjectHandle) (crypto.PublicKey, error) {
+	attrs, err := p.module.ctx.GetAttributeValue(p.session, o, []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_EC_PARAMS, nil),
+		pkcs11.NewAttribute(pkcs11.CKA_EC_POINT, nil),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var oid asn1.ObjectIdentifier
+	if _, err := asn1.Unmarshal(attrs[0].Value, &oid); err != nil {
+		return nil, fmt.Errorf("failed to parse curve parameters: %w", err)
+	}
+
+	// The point should be a DER-encoded octet string, but some modules return
+	// the raw point.
+	point := attrs[1].Value
+	var raw []byte
+	if rest, err := asn1.Unmarshal(point, &raw); err == nil && len(rest) == 0 {
+		point = raw
+	}
+
+	switch {
+	case oid.Equal(oidEd25519):
+		if len(point) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid ed25519 public key length %d", len(point))
+		}
+		return ed25519.PublicKey(point), nil
+	case oid.Equal(oidNamedCurveP256):
+		return unmarshalECDSAPublicKey(elliptic.P256(), point)
+	case oid.Equal(oidNamedCurveP384):
+		return unmarshalECDSAPublicKey(elliptic.P384(), point)
+	default:
+		return nil, fmt.Errorf("unsupported curve %s", oid)
+	}
+}
+
+func unmarshalECDSAPublicKey(curve elliptic.Curve, point []byte) (*ecdsa.PublicKey, error) {
+	x, y := elliptic.Unmarshal(curve, point)
+	if x == nil {
+		return nil, fmt.Errorf("invalid %s public key", curve.Params().Name)
+	}
+	return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+}
+
+// find returns all objects matching the template. The caller must hold the
+// lock.
+func (p *PKCS11) find(template []*pkcs11.Attribute) ([]pkcs11.ObjectHandle, error) {
+	if err := p.module.ctx.FindObjectsInit(p.session, template); err != nil {
+		return nil, err
+	}
+
+	var result []pkcs11.ObjectHandle
+	for {
+		objects, _, err := p.module.ctx.FindObjects(p.session, 100)
+		if err != nil {
+			_ = p.module.ctx.FindObjectsFinal(p.session)
+			return nil, err
+		}
+		result = append(result, objects...)
+		if len(objects) < 100 {
+			break
+		}
+	}
+
+	if err := p.module.ctx.FindObjectsFinal(p.session); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// findOne returns the object matching the template, returning an error if
+// there is not exactly one match. The caller must hold the lock.
+func (p *PKCS11) findOne(template []*pkcs11.Attribute) (pkcs11.ObjectHandle, error) {
+	objects, err := p.find(template)
+	if err != nil {
+		return 0, err
+	}
+	switch len(objects) {
+	case 0:
+		return 0, fmt.Errorf("not found")
+	case 1:
+		return objects[0], nil
+	default:
+		return 0, fmt.Errorf("found %d objects, expected 1", len(objects))
+	}
+}
+
+// keyTemplate is the search template for the data object representing a key.
+func keyTemplate(id string) []*pkcs11.Attribute {
+	return []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_CLASS, pkcs11.CKO_DATA),
+		pkcs11.NewAttribute(pkcs11.CKA_TOKEN, true),
+		pkcs11.NewAttribute(pkcs11.CKA_APPLICATION, pkcs11Application),
+		pkcs11.NewAttribute(pkcs11.CKA_LABEL, id),
+	}
+}
+
+// versionTemplate is the search template for a key version object of the
+// given class.
+func versionTemplate(class uint, version string) []*pkcs11.Attribute {
+	return []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_CLASS, class),
+		pkcs11.NewAttribute(pkcs11.CKA_LABEL, version),
+		pkcs11.NewAttribute(pkcs11.CKA_ID, []byte(versionParent(version))),
+	}
+}
+
+// versionParent returns the key ID of the given version ID.
+func versionParent(version string) string {
+	if i := strings.LastIndex(version, "/"); i >= 0 {
+		return version[:i]
+	}
+	return ""
+}
+
+// versionCreatedAt returns the creation time encoded in the version ID.
+func versionCreatedAt(version string) time.Time {
+	i := strings.LastIndex(version, "/")
+	nanos, err := strconv.ParseInt(version[i+1:], 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+	return time.Unix(0, nanos).UTC()
+}
+
+// pkcs11Signer is a crypto.Signer backed by a private key on the token.
+type pkcs11Signer struct {
+	manager    *PKCS11
+	privateKey pkcs11.ObjectHandle
+	public     crypto.PublicKey
+}
+
+// Public returns the public key.
+func (s *pkcs11Signer) Public() crypto.PublicKey {
+	return s.public
+}
+
+// Sign signs the digest. ECDSA signatures are returned ASN.1 encoded, as with
+// ecdsa.PrivateKey. For Ed25519, digest is the full message and opts must not
+// specify a hash.
+func (s *pkcs11Signer) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	var mechanism uint
+	switch s.public.(type) {
+	case *ecdsa.PublicKey:
+		mechanism = pkcs11.CKM_ECDSA
+	case ed25519.PublicKey:
+		if opts.HashFunc() != crypto.Hash(0) {
+			return nil, fmt.Errorf("ed25519 cannot sign hashed messages")
+		}
+		mechanism = ckmEdDSA
+	default:
+		return nil, fmt.Errorf("unsupported public key type %T", s.public)
+	}
+
+	s.manager.lock.Lock()
+	defer s.manager.lock.Unlock()
+
+	ctx, session := s.manager.module.ctx, s.manager.session
+	if err := ctx.SignInit(session, []*pkcs11.Mechanism{pkcs11.NewMechanism(mechanism, nil)}, s.privateKey); err != nil {
+		return nil, fmt.Errorf("failed to initialize signing: %w", err)
+	}
+	sig, err := ctx.Sign(session, digest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign: %w", err)
+	}
+
+	if mechanism != pkcs11.CKM_ECDSA {
+		return sig, nil
+	}
+
+	// PKCS#11 returns r || s, convert it to the ASN.1 format callers expect.
+	if len(sig)%2 != 0 {
+		return nil, fmt.Errorf("invalid ecdsa signature length %d", len(sig))
+	}
+	n := len(sig) / 2
+	return asn1.Marshal(struct {
+		R, S *big.Int
+	}{
+		R: new(big.Int).SetBytes(sig[:n]),
+		S: new(big.Int).SetBytes(sig[n:]),
+	})
+}
+
+// pkcs11SigningKeyVersion implements keys.SigningKeyVersion.
+type pkcs11SigningKeyVersion struct {
+	manager   *PKCS11
+	keyID     string
+	createdAt time.Time
+}
+
+func (v *pkcs11SigningKeyVersion) KeyID() string {
+	return v.keyID
+}
+
+func (v *pkcs11SigningKeyVersion) CreatedAt() time.Time {
+	return v.createdAt
+}
+
+// DestroyedAt always returns the zero time, destroyed versions are deleted
+// from the token.
+func (v *pkcs11SigningKeyVersion) DestroyedAt() time.Time {
+	return time.Time{}
+}
+
+func (v *pkcs11SigningKeyVersion) Signer(ctx context.Context) (crypto.Signer, error) {
+	return v.manager.NewSigner(ctx, v.keyID)
+}
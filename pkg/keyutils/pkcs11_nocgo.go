@@ -0,0 +1,30 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !cgo
+
+package keyutils
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/exposure-notifications-server/pkg/keys"
+)
+
+// newPKCS11KeyManager always returns an error, since the PKCS#11 key manager
+// requires cgo.
+func newPKCS11KeyManager(ctx context.Context, config *PKCS11Config) (keys.KeyManager, error) {
+	return nil, fmt.Errorf("PKCS#11 key manager requires a build with cgo enabled")
+}
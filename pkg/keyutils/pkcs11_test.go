@@ -0,0 +1,237 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build cgo
+
+package keyutils
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/sethvargo/go-envconfig"
+)
+
+// testPKCS11 returns a PKCS#11 key manager for the token configured in the
+// environment. It skips the test if no module is configured. In CI, this is a
+// SoftHSM token.
+func testPKCS11(tb testing.TB) *PKCS11 {
+	tb.Helper()
+
+	if os.Getenv("PKCS11_MODULE_PATH") == "" {
+		tb.Skip("PKCS11_MODULE_PATH is not set")
+	}
+
+	ctx := context.Background()
+
+	var config PKCS11Config
+	if err := envconfig.Process(ctx, &config); err != nil {
+		tb.Fatal(err)
+	}
+
+	p, err := NewPKCS11(ctx, &config)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() {
+		if err := p.Close(); err != nil {
+			tb.Fatal(err)
+		}
+	})
+	return p
+}
+
+// testPKCS11Parent returns a unique parent so tests do not collide on a shared
+// token.
+func testPKCS11Parent(tb testing.TB) string {
+	tb.Helper()
+	return fmt.Sprintf("test/%d", time.Now().UnixNano())
+}
+
+func TestPKCS11_Signing(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	p := testPKCS11(t)
+	parent := testPKCS11Parent(t)
+
+	cases := []struct {
+		alg  Algorithm
+		hash crypto.Hash
+	}{
+		{alg: AlgorithmES256, hash: crypto.SHA256},
+		{alg: AlgorithmES384, hash: crypto.SHA384},
+		{alg: AlgorithmEdDSA, hash: crypto.Hash(0)},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(string(tc.alg), func(t *testing.T) {
+			keyID, err := p.CreateSigningKeyForAlgorithm(ctx, parent, string(tc.alg), tc.alg)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Creating again returns the same key.
+			again, err := p.CreateSigningKeyForAlgorithm(ctx, parent, string(tc.alg), tc.alg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, want := again, keyID; got != want {
+				t.Errorf("expected %q to be %q", got, want)
+			}
+
+			version, err := p.CreateKeyVersion(ctx, keyID)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			signer, err := p.NewSigner(ctx, version)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := tc.alg.ValidatePublicKey(signer.Public()); err != nil {
+				t.Fatal(err)
+			}
+
+			msg := []byte("hello world")
+			digest := msg
+			switch tc.hash {
+			case crypto.SHA256:
+				sum := sha256.Sum256(msg)
+				digest = sum[:]
+			case crypto.SHA384:
+				sum := sha512.Sum384(msg)
+				digest = sum[:]
+			}
+
+			sig, err := signer.Sign(rand.Reader, digest, tc.hash)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			switch pub := signer.Public().(type) {
+			case *ecdsa.PublicKey:
+				if !ecdsa.VerifyASN1(pub, digest, sig) {
+					t.Errorf("invalid signature")
+				}
+			case ed25519.PublicKey:
+				if !ed25519.Verify(pub, msg, sig) {
+					t.Errorf("invalid signature")
+				}
+			}
+
+			// The key resolves to the newest version.
+			newer, err := p.CreateKeyVersion(ctx, keyID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			versions, err := p.SigningKeyVersions(ctx, keyID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, want := len(versions), 2; got != want {
+				t.Fatalf("expected %d versions, got %d", want, got)
+			}
+			if got, want := versions[0].KeyID(), newer; got != want {
+				t.Errorf("expected %q to be %q", got, want)
+			}
+
+			// Destroying removes the version.
+			if err := p.DestroyKeyVersion(ctx, version); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := p.NewSigner(ctx, version); err == nil {
+				t.Errorf("expected error")
+			}
+			if err := p.DestroyKeyVersion(ctx, version); err != nil {
+				t.Errorf("expected destroying a destroyed version to succeed: %v", err)
+			}
+		})
+	}
+}
+
+func TestPKCS11_Encryption(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	p := testPKCS11(t)
+	parent := testPKCS11Parent(t)
+
+	keyID, err := p.CreateEncryptionKey(ctx, parent, "encryption")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.CreateKeyVersion(ctx, keyID); err != nil {
+		t.Fatal(err)
+	}
+
+	plaintext := []byte("super secret")
+	aad := []byte("aad")
+
+	ciphertext, err := p.Encrypt(ctx, keyID, plaintext, aad)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Rotate, old ciphertext should still decrypt.
+	if _, err := p.CreateKeyVersion(ctx, keyID); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := p.Decrypt(ctx, keyID, ciphertext, aad)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(plaintext) {
+		t.Errorf("expected %q to be %q", got, plaintext)
+	}
+
+	// Wrong AAD fails.
+	if _, err := p.Decrypt(ctx, keyID, ciphertext, []byte("nope")); err == nil {
+		t.Errorf("expected error")
+	}
+
+	// Wrong key fails.
+	if _, err := p.Decrypt(ctx, parent+"/other", ciphertext, aad); err == nil {
+		t.Errorf("expected error")
+	}
+}
+
+func TestPKCS11_VersionID(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2020, 12, 1, 0, 0, 0, 0, time.UTC)
+	version := fmt.Sprintf("system/token-signing/%d", now.UnixNano())
+
+	if got, want := versionParent(version), "system/token-signing"; got != want {
+		t.Errorf("expected %q to be %q", got, want)
+	}
+	if got, want := versionCreatedAt(version), now; !got.Equal(want) {
+		t.Errorf("expected %s to be %s", got, want)
+	}
+	if got := versionCreatedAt("system/token-signing"); !got.IsZero() {
+		t.Errorf("expected zero time, got %s", got)
+	}
+}
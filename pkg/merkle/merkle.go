@@ -0,0 +1,198 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package merkle implements an RFC 6962 Merkle tree over hashes of perfect
+// subtrees, so the tree can be stored incrementally and roots and inclusion
+// proofs can be computed for any tree size without loading all leaves.
+package merkle
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math/bits"
+)
+
+const (
+	leafPrefix = 0x00
+	nodePrefix = 0x01
+)
+
+// ErrInvalidProof is returned when an inclusion proof does not verify.
+var ErrInvalidProof = errors.New("invalid inclusion proof")
+
+// NodeReader reads the hashes of perfect subtrees. The node at level 0 and
+// index i is the hash of leaf i. The node at level l and index i is the root of
+// the perfect subtree containing leaves [i*2^l, (i+1)*2^l).
+type NodeReader interface {
+	Node(level uint, index uint64) ([]byte, error)
+}
+
+// Node is a stored perfect subtree hash.
+type Node struct {
+	Level uint
+	Index uint64
+	Hash  []byte
+}
+
+// LeafHash returns the hash of the leaf data.
+func LeafHash(data []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{leafPrefix})
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+// NodeHash returns the hash of an interior node.
+func NodeHash(left, right []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{nodePrefix})
+	h.Write(left)
+	h.Write(right)
+	return h.Sum(nil)
+}
+
+// EmptyRoot returns the root hash of the empty tree.
+func EmptyRoot() []byte {
+	sum := sha256.Sum256(nil)
+	return sum[:]
+}
+
+// AppendNodes returns the nodes which become complete when the leaf with the
+// given hash is appended at index. This always includes the leaf itself. The
+// reader must return all nodes for leaves before index.
+func AppendNodes(r NodeReader, index uint64, leafHash []byte) ([]*Node, error) {
+	nodes := []*Node{{Level: 0, Index: index, Hash: leafHash}}
+
+	hash := leafHash
+	for level := uint(1); (index+1)%(uint64(1)<<level) == 0; level++ {
+		// The new node is always the right child, read the left sibling.
+		childIndex := (index >> (level - 1)) - 1
+		left, err := r.Node(level-1, childIndex)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read node %d/%d: %w", level-1, childIndex, err)
+		}
+		hash = NodeHash(left, hash)
+		nodes = append(nodes, &Node{Level: level, Index: index >> level, Hash: hash})
+	}
+	return nodes, nil
+}
+
+// RootHash returns the root hash of the tree with the given number of leaves.
+func RootHash(r NodeReader, size uint64) ([]byte, error) {
+	if size == 0 {
+		return EmptyRoot(), nil
+	}
+	return subtreeHash(r, 0, size)
+}
+
+// InclusionProof returns the audit path for the leaf at index in the tree with
+// the given number of leaves.
+func InclusionProof(r NodeReader, index, size uint64) ([][]byte, error) {
+	if index >= size {
+		return nil, fmt.Errorf("index %d is not in tree of size %d", index, size)
+	}
+	return path(r, index, 0, size)
+}
+
+// VerifyInclusion verifies that the leaf with the given hash is at index in the
+// tree with the given size and root.
+func VerifyInclusion(leafHash []byte, index, size uint64, proof [][]byte, root []byte) error {
+	if index >= size {
+		return ErrInvalidProof
+	}
+
+	fn, sn := index, size-1
+	hash := leafHash
+	for _, p := range proof {
+		if sn == 0 {
+			return ErrInvalidProof
+		}
+		if fn&1 == 1 || fn == sn {
+			hash = NodeHash(p, hash)
+			for fn&1 == 0 && fn != 0 {
+				fn >>= 1
+				sn >>= 1
+			}
+		} else {
+			hash = NodeHash(hash, p)
+		}
+		fn >>= 1
+		sn >>= 1
+	}
+
+	if sn != 0 || !bytes.Equal(hash, root) {
+		return ErrInvalidProof
+	}
+	return nil
+}
+
+// subtreeHash returns the hash of leaves [begin, end). begin must be aligned to
+// the largest power of two less than or equal to end-begin, which is always
+// true for the ranges produced by the RFC 6962 recursion.
+func subtreeHash(r NodeReader, begin, end uint64) ([]byte, error) {
+	n := end - begin
+	if n&(n-1) == 0 {
+		level := uint(bits.TrailingZeros64(n))
+		return r.Node(level, begin>>level)
+	}
+
+	k := splitPoint(n)
+	left, err := subtreeHash(r, begin, begin+k)
+	if err != nil {
+		return nil, err
+	}
+	right, err := subtreeHash(r, begin+k, end)
+	if err != nil {
+		return nil, err
+	}
+	return NodeHash(left, right), nil
+}
+
+// path returns the audit path for index within leaves [begin, end).
+func path(r NodeReader, index, begin, end uint64) ([][]byte, error) {
+	n := end - begin
+	if n == 1 {
+		return nil, nil
+	}
+
+	k := splitPoint(n)
+	if index < begin+k {
+		p, err := path(r, index, begin, begin+k)
+		if err != nil {
+			return nil, err
+		}
+		h, err := subtreeHash(r, begin+k, end)
+		if err != nil {
+			return nil, err
+		}
+		return append(p, h), nil
+	}
+
+	p, err := path(r, index, begin+k, end)
+	if err != nil {
+		return nil, err
+	}
+	h, err := subtreeHash(r, begin, begin+k)
+	if err != nil {
+		return nil, err
+	}
+	return append(p, h), nil
+}
+
+// splitPoint returns the largest power of two strictly less than n, for n > 1.
+func splitPoint(n uint64) uint64 {
+	return uint64(1) << (bits.Len64(n-1) - 1)
+}
@@ -0,0 +1,136 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package merkle
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+// memoryTree is an in-memory NodeReader for testing.
+type memoryTree map[[2]uint64][]byte
+
+func (m memoryTree) Node(level uint, index uint64) ([]byte, error) {
+	h, ok := m[[2]uint64{uint64(level), index}]
+	if !ok {
+		return nil, fmt.Errorf("missing node %d/%d", level, index)
+	}
+	return h, nil
+}
+
+func (m memoryTree) append(tb testing.TB, index uint64, data []byte) {
+	tb.Helper()
+
+	nodes, err := AppendNodes(m, index, LeafHash(data))
+	if err != nil {
+		tb.Fatal(err)
+	}
+	for _, n := range nodes {
+		m[[2]uint64{uint64(n.Level), n.Index}] = n.Hash
+	}
+}
+
+// referenceRoot computes the RFC 6962 root directly from the leaves.
+func referenceRoot(leaves [][]byte) []byte {
+	switch n := uint64(len(leaves)); n {
+	case 0:
+		return EmptyRoot()
+	case 1:
+		return LeafHash(leaves[0])
+	default:
+		k := splitPoint(n)
+		return NodeHash(referenceRoot(leaves[:k]), referenceRoot(leaves[k:]))
+	}
+}
+
+func TestTree(t *testing.T) {
+	t.Parallel()
+
+	tree := make(memoryTree)
+	var leaves [][]byte
+
+	root, err := RootHash(tree, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(root, EmptyRoot()) {
+		t.Errorf("expected empty root")
+	}
+
+	for size := uint64(1); size <= 70; size++ {
+		data := []byte(fmt.Sprintf("leaf-%d", size-1))
+		leaves = append(leaves, data)
+		tree.append(t, size-1, data)
+
+		root, err := RootHash(tree, size)
+		if err != nil {
+			t.Fatalf("size %d: %v", size, err)
+		}
+		if want := referenceRoot(leaves); !bytes.Equal(root, want) {
+			t.Fatalf("size %d: expected root %x to be %x", size, root, want)
+		}
+
+		for index := uint64(0); index < size; index++ {
+			proof, err := InclusionProof(tree, index, size)
+			if err != nil {
+				t.Fatalf("size %d index %d: %v", size, index, err)
+			}
+			leafHash := LeafHash(leaves[index])
+			if err := VerifyInclusion(leafHash, index, size, proof, root); err != nil {
+				t.Fatalf("size %d index %d: %v", size, index, err)
+			}
+
+			// The proof must not verify for another leaf.
+			if err := VerifyInclusion(LeafHash([]byte("nope")), index, size, proof, root); err == nil {
+				t.Fatalf("size %d index %d: expected invalid proof", size, index)
+			}
+		}
+	}
+}
+
+func TestVerifyInclusion_Invalid(t *testing.T) {
+	t.Parallel()
+
+	tree := make(memoryTree)
+	for i := uint64(0); i < 7; i++ {
+		tree.append(t, i, []byte{byte(i)})
+	}
+	root, err := RootHash(tree, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	proof, err := InclusionProof(tree, 3, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf := LeafHash([]byte{3})
+
+	if err := VerifyInclusion(leaf, 7, 7, proof, root); err == nil {
+		t.Errorf("expected out of range index to fail")
+	}
+	if err := VerifyInclusion(leaf, 4, 7, proof, root); err == nil {
+		t.Errorf("expected wrong index to fail")
+	}
+	if err := VerifyInclusion(leaf, 3, 7, proof[:len(proof)-1], root); err == nil {
+		t.Errorf("expected short proof to fail")
+	}
+	if err := VerifyInclusion(leaf, 3, 7, append(proof, root), root); err == nil {
+		t.Errorf("expected long proof to fail")
+	}
+	if _, err := InclusionProof(tree, 7, 7); err == nil {
+		t.Errorf("expected out of range proof to fail")
+	}
+}
@@ -39,6 +39,7 @@ var (
 		MobileAppWrite: {"MobileAppWrite", "create, update, and delete mobile apps"},
 		UserRead:       {"UserRead", "view user information"},
 		UserWrite:      {"UserWrite", "create, update, and delete users"},
+		AuditExport:    {"AuditExport", "export event and audit logs"},
 	}
 
 	// NamePermissionMap is the map of permission names to their value.
@@ -165,6 +166,10 @@ const (
 	// Users
 	UserRead
 	UserWrite
+
+	// Audit export. This is out of order with AuditRead because permissions are
+	// stored by value and cannot be renumbered.
+	AuditExport
 )
 
 // --
@@ -180,6 +185,7 @@ var (
 		SettingsWrite:  {SettingsRead},
 		MobileAppWrite: {MobileAppRead},
 		UserWrite:      {UserRead},
+		AuditExport:    {AuditRead},
 	}
 
 	// This is the inverse of the above map, set by the init() func.
@@ -210,7 +216,7 @@ const (
 	LegacyRealmUser Permission = CodeIssue | CodeBulkIssue | CodeRead | CodeExpire
 
 	// LegacyRealmAdmin is a quick reference to the old "realm admin" permissions.
-	LegacyRealmAdmin Permission = AuditRead |
+	LegacyRealmAdmin Permission = AuditRead | AuditExport |
 		APIKeyRead | APIKeyWrite |
 		CodeIssue | CodeBulkIssue | CodeRead | CodeExpire |
 		SettingsRead | SettingsWrite |
@@ -68,6 +68,7 @@ func TestRBAC_Permissions(t *testing.T) {
 		{MobileAppWrite, 4096},
 		{UserRead, 8192},
 		{UserWrite, 16384},
+		{AuditExport, 32768},
 	}
 
 	for _, tc := range cases {
@@ -0,0 +1,589 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package realmsync
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+	"github.com/google/exposure-notifications-verification-server/pkg/email"
+	"github.com/google/exposure-notifications-verification-server/pkg/sms"
+	"github.com/jinzhu/gorm/dialects/postgres"
+)
+
+// Options configure Apply.
+type Options struct {
+	// Prune disables mobile apps and API keys, removes members, and deletes SMS
+	// and email configs which exist on the realm but are not in the document.
+	// Without Prune, these removals are reported but not applied.
+	Prune bool
+}
+
+// Result is the outcome of applying a realm's configuration.
+type Result struct {
+	// Changes are the differences which were applied.
+	Changes []*Change
+
+	// Skipped are removals which were not applied because Prune was not set.
+	Skipped []*Change
+
+	// CreatedAPIKeys maps the names of newly created API keys to their secrets.
+	// This is the only time the secrets are available.
+	CreatedAPIKeys map[string]string
+}
+
+// Plan returns the changes required to apply the desired realm configuration,
+// which must be normalized.
+func Plan(db *database.Database, desired *Realm) ([]*Change, error) {
+	current, _, err := currentRealm(db, desired.Name)
+	if err != nil {
+		return nil, err
+	}
+	return Diff(current, desired)
+}
+
+// currentRealm exports the named realm, returning nil if it does not exist.
+func currentRealm(db *database.Database, name string) (*Realm, *database.Realm, error) {
+	realm, err := db.FindRealmByName(name)
+	if err != nil {
+		if database.IsNotFound(err) {
+			return nil, nil, nil
+		}
+		return nil, nil, fmt.Errorf("failed to find realm: %w", err)
+	}
+
+	current, err := ExportRealm(db, realm)
+	if err != nil {
+		return nil, nil, err
+	}
+	return current, realm, nil
+}
+
+// Apply makes the realm's configuration match desired, which must be
+// normalized. It is idempotent: if there are no changes, nothing is written.
+// All changes are made through the same database methods as the UI and are
+// audited as actor. The changes are made in a single transaction, so if any
+// change fails, none are applied.
+func Apply(db *database.Database, desired *Realm, actor database.Auditable, opts *Options) (*Result, error) {
+	if opts == nil {
+		opts = new(Options)
+	}
+
+	var result *Result
+	if err := db.Transaction(func(tx *database.Database) error {
+		var err error
+		result, err = apply(tx, desired, actor, opts)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// apply makes the changes for Apply.
+func apply(db *database.Database, desired *Realm, actor database.Auditable, opts *Options) (*Result, error) {
+	current, realm, err := currentRealm(db, desired.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	changes, err := Diff(current, desired)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Result{CreatedAPIKeys: make(map[string]string)}
+	if len(changes) == 0 {
+		return result, nil
+	}
+
+	for _, c := range changes {
+		if c.Op == OpRemove && isPrunable(c.Path) && !opts.Prune {
+			result.Skipped = append(result.Skipped, c)
+			continue
+		}
+		result.Changes = append(result.Changes, c)
+	}
+
+	if realm == nil {
+		realm = database.NewRealmWithDefaults(desired.Name)
+	}
+
+	if realm.ID == 0 || hasChanges(result.Changes, isRealmSetting) {
+		if err := toRealm(db, desired, realm); err != nil {
+			return nil, err
+		}
+		if err := db.SaveRealm(realm, actor); err != nil {
+			return nil, fmt.Errorf("failed to save realm: %w: %s", err, strings.Join(realm.ErrorMessages(), ", "))
+		}
+	}
+
+	if hasChanges(result.Changes, prefixed("sms.twilio")) {
+		if err := applyTwilio(db, realm, desired.SMS.Twilio, actor, result.Changes); err != nil {
+			return nil, err
+		}
+	}
+	if hasChanges(result.Changes, prefixed("email.smtp")) {
+		if err := applySMTP(db, realm, desired.Email.SMTP, actor, result.Changes); err != nil {
+			return nil, err
+		}
+	}
+	if hasChanges(result.Changes, prefixed("mobileApps")) {
+		if err := applyMobileApps(db, realm, desired.MobileApps, actor, opts.Prune); err != nil {
+			return nil, err
+		}
+	}
+	if hasChanges(result.Changes, prefixed("apiKeys")) {
+		if err := applyAPIKeys(db, realm, desired.APIKeys, actor, opts.Prune, result.CreatedAPIKeys); err != nil {
+			return nil, err
+		}
+	}
+	if hasChanges(result.Changes, prefixed("members")) {
+		if err := applyMembers(db, realm, desired.Members, actor, opts.Prune); err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+// isPrunable returns true if the path belongs to a resource which is only
+// removed when pruning.
+func isPrunable(path string) bool {
+	for _, p := range []string{"sms.twilio", "email.smtp", "mobileApps", "apiKeys", "members"} {
+		if prefixed(p)(path) {
+			return true
+		}
+	}
+	return false
+}
+
+// isRealmSetting returns true if the path is a setting on the realm itself.
+func isRealmSetting(path string) bool {
+	return !isPrunable(path)
+}
+
+func prefixed(prefix string) func(string) bool {
+	return func(path string) bool {
+		return path == prefix || strings.HasPrefix(path, prefix+".") || strings.HasPrefix(path, prefix+"[")
+	}
+}
+
+func hasChanges(changes []*Change, match func(string) bool) bool {
+	for _, c := range changes {
+		if match(c.Path) {
+			return true
+		}
+	}
+	return false
+}
+
+// auditDiff renders the changes under prefix in the audit log diff format.
+// Secret values are already redacted.
+func auditDiff(changes []*Change, prefix string) string {
+	var w strings.Builder
+	match := prefixed(prefix)
+	for _, c := range changes {
+		if !match(c.Path) {
+			continue
+		}
+		if c.Op != OpAdd {
+			fmt.Fprintf(&w, "-%s: %s\n", c.Path, c.From)
+		}
+		if c.Op != OpRemove {
+			fmt.Fprintf(&w, "+%s: %s\n", c.Path, c.To)
+		}
+	}
+	return w.String()
+}
+
+// toRealm copies the desired settings onto the realm.
+func toRealm(db *database.Database, desired *Realm, realm *database.Realm) error {
+	var err error
+
+	realm.Name = desired.Name
+	realm.RegionCode = desired.RegionCode
+	realm.WelcomeMessage = desired.WelcomeMessage
+	realm.AllowBulkUpload = desired.AllowBulkUpload
+	realm.RequireDate = desired.RequireDate
+	realm.EnableENExpress = desired.EnableENExpress
+	realm.DailyActiveUsersEnabled = desired.DailyActiveUsersEnabled
+	if realm.AllowedTestTypes, err = parseTestTypes(desired.AllowedTestTypes); err != nil {
+		return err
+	}
+
+	realm.CodeLength = desired.Codes.Length
+	if realm.CodeDuration, err = parseDurationSeconds(desired.Codes.Duration); err != nil {
+		return err
+	}
+	realm.LongCodeLength = desired.Codes.LongLength
+	if realm.LongCodeDuration, err = parseDurationSeconds(desired.Codes.LongDuration); err != nil {
+		return err
+	}
+
+	realm.SMSTextTemplate = desired.SMS.TextTemplate
+	realm.SMSTextAlternateTemplates = nil
+	if len(desired.SMS.AlternateTemplates) > 0 {
+		realm.SMSTextAlternateTemplates = make(postgres.Hstore, len(desired.SMS.AlternateTemplates))
+		for k, v := range desired.SMS.AlternateTemplates {
+			v := v
+			realm.SMSTextAlternateTemplates[k] = &v
+		}
+	}
+	realm.SMSCountry = desired.SMS.Country
+	realm.CanUseSystemSMSConfig = desired.SMS.CanUseSystemConfig
+	realm.UseSystemSMSConfig = desired.SMS.UseSystemConfig
+	realm.SMSFromNumberID = 0
+	if label := desired.SMS.FromNumber; label != "" {
+		numbers, err := db.SMSFromNumbers()
+		if err != nil {
+			return fmt.Errorf("failed to list sms from numbers: %w", err)
+		}
+		for _, n := range numbers {
+			if n.Label == label {
+				realm.SMSFromNumberID = n.ID
+			}
+		}
+		if realm.SMSFromNumberID == 0 {
+			return fmt.Errorf("sms.fromNumber: no system sms from number labeled %q", label)
+		}
+	}
+
+	realm.EmailInviteTemplate = desired.Email.InviteTemplate
+	realm.EmailPasswordResetTemplate = desired.Email.PasswordResetTemplate
+	realm.EmailVerifyTemplate = desired.Email.VerifyTemplate
+	realm.CanUseSystemEmailConfig = desired.Email.CanUseSystemConfig
+	realm.UseSystemEmailConfig = desired.Email.UseSystemConfig
+
+	if realm.MFAMode, err = parseAuthRequirement(desired.Security.MFAMode); err != nil {
+		return err
+	}
+	if realm.MFARequiredGracePeriod, err = parseDurationSeconds(desired.Security.MFARequiredGracePeriod); err != nil {
+		return err
+	}
+	if realm.EmailVerifiedMode, err = parseAuthRequirement(desired.Security.EmailVerifiedMode); err != nil {
+		return err
+	}
+	realm.PasswordRotationPeriodDays = desired.Security.PasswordRotationPeriodDays
+	realm.PasswordRotationWarningDays = desired.Security.PasswordRotationWarningDays
+	realm.AllowedCIDRsAdminAPI = desired.Security.AllowedCIDRsAdminAPI
+	realm.AllowedCIDRsAPIServer = desired.Security.AllowedCIDRsAPIServer
+	realm.AllowedCIDRsServer = desired.Security.AllowedCIDRsServer
+
+	realm.UseRealmCertificateKey = desired.Certificates.UseRealmKey
+	realm.CertificateIssuer = desired.Certificates.Issuer
+	realm.CertificateAudience = desired.Certificates.Audience
+	if realm.CertificateDuration, err = parseDurationSeconds(desired.Certificates.Duration); err != nil {
+		return err
+	}
+	realm.CertificateKeyRotationPeriodDays = desired.Certificates.RotationPeriodDays
+	realm.CertificateKeyRotationOverlapHours = desired.Certificates.RotationOverlapHours
+
+	realm.AbusePreventionEnabled = desired.AbusePrevention.Enabled
+	realm.AbusePreventionLimitFactor = desired.AbusePrevention.LimitFactor
+
+	realm.VerificationCodeRetentionDays = desired.Retention.VerificationCodeDays
+	realm.AuditEntryRetentionDays = desired.Retention.AuditEntryDays
+
+	return nil
+}
+
+func parseDurationSeconds(s string) (database.DurationSeconds, error) {
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return database.DurationSeconds{}, fmt.Errorf("invalid duration %q: %w", s, err)
+	}
+	return database.FromDuration(d), nil
+}
+
+// applyTwilio creates, updates, or deletes the realm's Twilio config.
+func applyTwilio(db *database.Database, realm *database.Realm, desired *Twilio, actor database.Auditable, changes []*Change) error {
+	smsConfig, err := db.FindRealmSMSConfig(realm.ID)
+	if err != nil && !database.IsNotFound(err) {
+		return fmt.Errorf("failed to find sms config: %w", err)
+	}
+
+	action := "updated SMS config"
+	switch {
+	case desired == nil && smsConfig == nil:
+		return nil
+	case desired == nil:
+		action = "deleted SMS config"
+		smsConfig.TwilioAccountSid = ""
+		smsConfig.TwilioAuthToken = ""
+		smsConfig.TwilioFromNumber = ""
+	case smsConfig == nil:
+		if desired.authToken == "" {
+			return fmt.Errorf("sms.twilio.authTokenEnv: required to create the sms config")
+		}
+		action = "created SMS config"
+		smsConfig = &database.SMSConfig{
+			RealmID:      realm.ID,
+			ProviderType: sms.ProviderTypeTwilio,
+		}
+		fallthrough
+	default:
+		smsConfig.TwilioAccountSid = desired.AccountSID
+		smsConfig.TwilioFromNumber = desired.FromNumber
+		if desired.authToken != "" {
+			smsConfig.TwilioAuthToken = desired.authToken
+		}
+	}
+
+	if err := db.SaveSMSConfig(smsConfig); err != nil {
+		return fmt.Errorf("failed to save sms config: %w", err)
+	}
+
+	audit := database.BuildAuditEntry(actor, action, realm, realm.ID)
+	audit.Diff = auditDiff(changes, "sms.twilio")
+	if err := db.SaveAuditEntry(audit); err != nil {
+		return fmt.Errorf("failed to save audit: %w", err)
+	}
+	return nil
+}
+
+// applySMTP creates, updates, or deletes the realm's SMTP config.
+func applySMTP(db *database.Database, realm *database.Realm, desired *SMTP, actor database.Auditable, changes []*Change) error {
+	emailConfig, err := db.FindRealmEmailConfig(realm.ID)
+	if err != nil && !database.IsNotFound(err) {
+		return fmt.Errorf("failed to find email config: %w", err)
+	}
+
+	action := "updated email config"
+	switch {
+	case desired == nil && emailConfig == nil:
+		return nil
+	case desired == nil:
+		action = "deleted email config"
+		emailConfig.SMTPAccount = ""
+		emailConfig.SMTPPassword = ""
+		emailConfig.SMTPHost = ""
+	case emailConfig == nil:
+		if desired.password == "" {
+			return fmt.Errorf("email.smtp.passwordEnv: required to create the email config")
+		}
+		action = "created email config"
+		emailConfig = &database.EmailConfig{
+			RealmID:      realm.ID,
+			ProviderType: email.ProviderTypeSMTP,
+		}
+		fallthrough
+	default:
+		emailConfig.SMTPAccount = desired.Account
+		emailConfig.SMTPHost = desired.Host
+		emailConfig.SMTPPort = desired.Port
+		if desired.password != "" {
+			emailConfig.SMTPPassword = desired.password
+		}
+	}
+
+	if err := db.SaveEmailConfig(emailConfig); err != nil {
+		return fmt.Errorf("failed to save email config: %w", err)
+	}
+
+	audit := database.BuildAuditEntry(actor, action, realm, realm.ID)
+	audit.Diff = auditDiff(changes, "email.smtp")
+	if err := db.SaveAuditEntry(audit); err != nil {
+		return fmt.Errorf("failed to save audit: %w", err)
+	}
+	return nil
+}
+
+// applyMobileApps creates, updates, and re-enables mobile apps by name. With
+// prune, apps which are not desired are disabled.
+func applyMobileApps(db *database.Database, realm *database.Realm, desired []*MobileApp, actor database.Auditable, prune bool) error {
+	existing, _, err := realm.ListMobileApps(db, allPages)
+	if err != nil {
+		return fmt.Errorf("failed to list mobile apps: %w", err)
+	}
+	byName := make(map[string]*database.MobileApp, len(existing))
+	for _, app := range existing {
+		// Prefer the active app if there are disabled apps with the same name.
+		if prev, ok := byName[app.Name]; !ok || prev.DeletedAt != nil {
+			byName[app.Name] = app
+		}
+	}
+
+	want := make(map[string]struct{}, len(desired))
+	for _, d := range desired {
+		want[d.Name] = struct{}{}
+
+		os, err := parseOS(d.OS)
+		if err != nil {
+			return fmt.Errorf("mobileApps[%s].os: %w", d.Name, err)
+		}
+
+		app, ok := byName[d.Name]
+		if !ok {
+			app = &database.MobileApp{RealmID: realm.ID, Name: d.Name}
+		}
+		if ok && app.DeletedAt == nil && app.OS == os && app.AppID == d.AppID && app.SHA == d.SHA && app.URL == d.URL {
+			continue
+		}
+
+		app.OS = os
+		app.AppID = d.AppID
+		app.SHA = d.SHA
+		app.URL = d.URL
+		app.DeletedAt = nil
+		if err := db.SaveMobileApp(app, actor); err != nil {
+			return fmt.Errorf("failed to save mobile app %q: %w: %s", d.Name, err, strings.Join(app.ErrorMessages(), ", "))
+		}
+	}
+
+	if !prune {
+		return nil
+	}
+
+	now := time.Now().UTC()
+	for name, app := range byName {
+		if _, ok := want[name]; ok || app.DeletedAt != nil {
+			continue
+		}
+		app.DeletedAt = &now
+		if err := db.SaveMobileApp(app, actor); err != nil {
+			return fmt.Errorf("failed to disable mobile app %q: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// applyAPIKeys creates and re-enables API keys by name. The type of an
+// existing API key cannot be changed. With prune, keys which are not desired
+// are disabled.
+func applyAPIKeys(db *database.Database, realm *database.Realm, desired []*APIKey, actor database.Auditable, prune bool, created map[string]string) error {
+	existing, _, err := realm.ListAuthorizedApps(db, allPages)
+	if err != nil {
+		return fmt.Errorf("failed to list api keys: %w", err)
+	}
+	byName := make(map[string]*database.AuthorizedApp, len(existing))
+	for _, app := range existing {
+		if prev, ok := byName[app.Name]; !ok || prev.DeletedAt != nil {
+			byName[app.Name] = app
+		}
+	}
+
+	want := make(map[string]struct{}, len(desired))
+	for _, d := range desired {
+		want[d.Name] = struct{}{}
+
+		typ, err := parseAPIKeyType(d.Type)
+		if err != nil {
+			return fmt.Errorf("apiKeys[%s].type: %w", d.Name, err)
+		}
+
+		app, ok := byName[d.Name]
+		if !ok {
+			app = &database.AuthorizedApp{Name: d.Name, APIKeyType: typ}
+			key, err := realm.CreateAuthorizedApp(db, app, actor)
+			if err != nil {
+				return fmt.Errorf("failed to create api key %q: %w: %s", d.Name, err, strings.Join(app.ErrorMessages(), ", "))
+			}
+			created[d.Name] = key
+			continue
+		}
+
+		if app.APIKeyType != typ {
+			return fmt.Errorf("apiKeys[%s].type: cannot change the type of an existing api key from %s to %s",
+				d.Name, app.APIKeyType.Display(), typ.Display())
+		}
+		if app.DeletedAt != nil {
+			app.DeletedAt = nil
+			if err := db.SaveAuthorizedApp(app, actor); err != nil {
+				return fmt.Errorf("failed to enable api key %q: %w", d.Name, err)
+			}
+		}
+	}
+
+	if !prune {
+		return nil
+	}
+
+	now := time.Now().UTC()
+	for name, app := range byName {
+		if _, ok := want[name]; ok || app.DeletedAt != nil {
+			continue
+		}
+		app.DeletedAt = &now
+		if err := db.SaveAuthorizedApp(app, actor); err != nil {
+			return fmt.Errorf("failed to disable api key %q: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// applyMembers adds users to the realm and updates their permissions. Users
+// which do not exist are created. With prune, members which are not desired
+// are removed from the realm.
+func applyMembers(db *database.Database, realm *database.Realm, desired []*Member, actor database.Auditable, prune bool) error {
+	existing, _, err := realm.ListMemberships(db, allPages)
+	if err != nil {
+		return fmt.Errorf("failed to list memberships: %w", err)
+	}
+	byEmail := make(map[string]*database.Membership, len(existing))
+	for _, m := range existing {
+		byEmail[strings.ToLower(m.User.Email)] = m
+	}
+
+	want := make(map[string]struct{}, len(desired))
+	for _, d := range desired {
+		want[d.Email] = struct{}{}
+
+		perms, err := parsePermissions(d.Permissions)
+		if err != nil {
+			return fmt.Errorf("members[%s].permissions: %w", d.Email, err)
+		}
+
+		if m, ok := byEmail[d.Email]; ok && m.Permissions == perms {
+			continue
+		}
+
+		user, err := db.FindUserByEmail(d.Email)
+		if err != nil {
+			if !database.IsNotFound(err) {
+				return fmt.Errorf("failed to find user %q: %w", d.Email, err)
+			}
+
+			name := d.Name
+			if name == "" {
+				name = d.Email
+			}
+			user = &database.User{Email: d.Email, Name: name}
+			if err := db.SaveUser(user, actor); err != nil {
+				return fmt.Errorf("failed to create user %q: %w", d.Email, err)
+			}
+		}
+
+		if err := user.AddToRealm(db, realm, perms, actor); err != nil {
+			return fmt.Errorf("failed to add %q to realm: %w", d.Email, err)
+		}
+	}
+
+	if !prune {
+		return nil
+	}
+
+	for email, m := range byEmail {
+		if _, ok := want[email]; ok {
+			continue
+		}
+		if err := m.User.DeleteFromRealm(db, realm, actor); err != nil {
+			return fmt.Errorf("failed to remove %q from realm: %w", email, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,235 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package realmsync
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+	"github.com/google/exposure-notifications-verification-server/pkg/pagination"
+	"github.com/google/exposure-notifications-verification-server/pkg/rbac"
+)
+
+// allPages requests all records from paginated database queries.
+var allPages = &pagination.PageParams{Limit: math.MaxInt32}
+
+// Export returns the configuration of the given realms. If no names are
+// given, all realms are exported.
+func Export(db *database.Database, names ...string) (*File, error) {
+	var realms []*database.Realm
+	if len(names) == 0 {
+		var err error
+		realms, _, err = db.ListRealms(allPages)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list realms: %w", err)
+		}
+	} else {
+		for _, name := range names {
+			realm, err := db.FindRealmByName(name)
+			if err != nil {
+				return nil, fmt.Errorf("failed to find realm %q: %w", name, err)
+			}
+			realms = append(realms, realm)
+		}
+	}
+
+	var f File
+	for _, realm := range realms {
+		r, err := ExportRealm(db, realm)
+		if err != nil {
+			return nil, fmt.Errorf("failed to export realm %q: %w", realm.Name, err)
+		}
+		f.Realms = append(f.Realms, r)
+	}
+	return &f, nil
+}
+
+// ExportRealm returns the configuration of a single realm, including its SMS
+// and email configs, mobile apps, API keys, and memberships.
+func ExportRealm(db *database.Database, realm *database.Realm) (*Realm, error) {
+	r := fromRealm(realm)
+
+	if realm.SMSFromNumberID != 0 {
+		number, err := db.FindSMSFromNumber(realm.SMSFromNumberID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to find sms from number: %w", err)
+		}
+		r.SMS.FromNumber = number.Label
+	}
+
+	smsConfig, err := db.FindRealmSMSConfig(realm.ID)
+	if err != nil && !database.IsNotFound(err) {
+		return nil, fmt.Errorf("failed to find sms config: %w", err)
+	}
+	if smsConfig != nil {
+		r.SMS.Twilio = &Twilio{
+			AccountSID: smsConfig.TwilioAccountSid,
+			FromNumber: smsConfig.TwilioFromNumber,
+			authToken:  smsConfig.TwilioAuthToken,
+		}
+	}
+
+	emailConfig, err := db.FindRealmEmailConfig(realm.ID)
+	if err != nil && !database.IsNotFound(err) {
+		return nil, fmt.Errorf("failed to find email config: %w", err)
+	}
+	if emailConfig != nil {
+		r.Email.SMTP = &SMTP{
+			Account:  emailConfig.SMTPAccount,
+			Host:     emailConfig.SMTPHost,
+			Port:     emailConfig.SMTPPort,
+			password: emailConfig.SMTPPassword,
+		}
+	}
+
+	apps, err := db.ListActiveApps(realm.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list mobile apps: %w", err)
+	}
+	for _, app := range apps {
+		r.MobileApps = append(r.MobileApps, &MobileApp{
+			Name:  app.Name,
+			OS:    osName(app.OS),
+			AppID: app.AppID,
+			SHA:   app.SHA,
+			URL:   app.URL,
+		})
+	}
+	sort.Slice(r.MobileApps, func(i, j int) bool { return r.MobileApps[i].Name < r.MobileApps[j].Name })
+
+	authApps, _, err := realm.ListAuthorizedApps(db, allPages)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list api keys: %w", err)
+	}
+	for _, app := range authApps {
+		if app.DeletedAt != nil {
+			continue
+		}
+		r.APIKeys = append(r.APIKeys, &APIKey{
+			Name: app.Name,
+			Type: app.APIKeyType.Display(),
+		})
+	}
+	sort.Slice(r.APIKeys, func(i, j int) bool { return r.APIKeys[i].Name < r.APIKeys[j].Name })
+
+	memberships, _, err := realm.ListMemberships(db, allPages)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list memberships: %w", err)
+	}
+	for _, m := range memberships {
+		r.Members = append(r.Members, &Member{
+			Email:       m.User.Email,
+			Name:        m.User.Name,
+			Permissions: rbac.PermissionNames(m.Permissions),
+		})
+	}
+	sort.Slice(r.Members, func(i, j int) bool { return r.Members[i].Email < r.Members[j].Email })
+
+	return r, nil
+}
+
+// fromRealm converts the realm's own settings to a spec.
+func fromRealm(realm *database.Realm) *Realm {
+	r := &Realm{
+		Name:                    realm.Name,
+		RegionCode:              realm.RegionCode,
+		WelcomeMessage:          realm.WelcomeMessage,
+		AllowBulkUpload:         realm.AllowBulkUpload,
+		RequireDate:             realm.RequireDate,
+		EnableENExpress:         realm.EnableENExpress,
+		DailyActiveUsersEnabled: realm.DailyActiveUsersEnabled,
+		AllowedTestTypes:        testTypeNames(realm.AllowedTestTypes),
+
+		Codes: Codes{
+			Length:       realm.CodeLength,
+			Duration:     realm.CodeDuration.Duration.String(),
+			LongLength:   realm.LongCodeLength,
+			LongDuration: realm.LongCodeDuration.Duration.String(),
+		},
+		SMS: SMS{
+			TextTemplate:       realm.SMSTextTemplate,
+			Country:            realm.SMSCountry,
+			CanUseSystemConfig: realm.CanUseSystemSMSConfig,
+			UseSystemConfig:    realm.UseSystemSMSConfig,
+		},
+		Email: Email{
+			InviteTemplate:        realm.EmailInviteTemplate,
+			PasswordResetTemplate: realm.EmailPasswordResetTemplate,
+			VerifyTemplate:        realm.EmailVerifyTemplate,
+			CanUseSystemConfig:    realm.CanUseSystemEmailConfig,
+			UseSystemConfig:       realm.UseSystemEmailConfig,
+		},
+		Security: Security{
+			MFAMode:                     realm.MFAMode.String(),
+			MFARequiredGracePeriod:      realm.MFARequiredGracePeriod.Duration.String(),
+			EmailVerifiedMode:           realm.EmailVerifiedMode.String(),
+			PasswordRotationPeriodDays:  realm.PasswordRotationPeriodDays,
+			PasswordRotationWarningDays: realm.PasswordRotationWarningDays,
+			AllowedCIDRsAdminAPI:        realm.AllowedCIDRsAdminAPI,
+			AllowedCIDRsAPIServer:       realm.AllowedCIDRsAPIServer,
+			AllowedCIDRsServer:          realm.AllowedCIDRsServer,
+		},
+		Certificates: Certificates{
+			UseRealmKey:          realm.UseRealmCertificateKey,
+			Issuer:               realm.CertificateIssuer,
+			Audience:             realm.CertificateAudience,
+			Duration:             realm.CertificateDuration.Duration.String(),
+			RotationPeriodDays:   realm.CertificateKeyRotationPeriodDays,
+			RotationOverlapHours: realm.CertificateKeyRotationOverlapHours,
+		},
+		AbusePrevention: AbusePrevention{
+			Enabled:     realm.AbusePreventionEnabled,
+			LimitFactor: realm.AbusePreventionLimitFactor,
+		},
+		Retention: Retention{
+			VerificationCodeDays: realm.VerificationCodeRetentionDays,
+			AuditEntryDays:       realm.AuditEntryRetentionDays,
+		},
+	}
+
+	if len(realm.SMSTextAlternateTemplates) > 0 {
+		r.SMS.AlternateTemplates = make(map[string]string, len(realm.SMSTextAlternateTemplates))
+		for k, v := range realm.SMSTextAlternateTemplates {
+			if v != nil {
+				r.SMS.AlternateTemplates[k] = *v
+			}
+		}
+	}
+	return r
+}
+
+// testTypeNames returns the names of the test types in t.
+func testTypeNames(t database.TestType) []string {
+	names := []string{}
+	if d := t.Display(); d != "" {
+		names = strings.Split(d, ", ")
+	}
+	return names
+}
+
+// osName returns the spec name of the OS type.
+func osName(os database.OSType) string {
+	switch os {
+	case database.OSTypeIOS:
+		return "ios"
+	case database.OSTypeAndroid:
+		return "android"
+	default:
+		return ""
+	}
+}
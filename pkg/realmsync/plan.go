@@ -0,0 +1,399 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package realmsync
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+	"github.com/google/exposure-notifications-verification-server/pkg/rbac"
+)
+
+const redacted = "(redacted)"
+
+// Change operations.
+const (
+	OpAdd    = "+"
+	OpRemove = "-"
+	OpUpdate = "~"
+)
+
+// Change is a single difference between the current and desired configuration
+// of a realm. Path identifies the setting, for example
+// "mobileApps[Example].appID". From and To are JSON encoded.
+type Change struct {
+	Realm string
+	Op    string
+	Path  string
+	From  string
+	To    string
+}
+
+// String renders the change for display.
+func (c *Change) String() string {
+	switch c.Op {
+	case OpAdd:
+		return fmt.Sprintf("%s %s.%s: %s", c.Op, c.Realm, c.Path, c.To)
+	case OpRemove:
+		return fmt.Sprintf("%s %s.%s: %s", c.Op, c.Realm, c.Path, c.From)
+	default:
+		return fmt.Sprintf("%s %s.%s: %s -> %s", c.Op, c.Realm, c.Path, c.From, c.To)
+	}
+}
+
+// Diff returns the changes required to make the current realm configuration
+// match the desired configuration. If current is nil, the realm does not exist
+// and every setting is an addition. Desired must be normalized.
+func Diff(current, desired *Realm) ([]*Change, error) {
+	from := make(map[string]string)
+	if current != nil {
+		if err := flattenSpec(current, from); err != nil {
+			return nil, err
+		}
+	}
+
+	to := make(map[string]string)
+	if err := flattenSpec(desired, to); err != nil {
+		return nil, err
+	}
+
+	var changes []*Change
+	for path, v := range to {
+		old, ok := from[path]
+		switch {
+		case !ok:
+			changes = append(changes, &Change{Realm: desired.Name, Op: OpAdd, Path: path, To: v})
+		case old != v:
+			changes = append(changes, &Change{Realm: desired.Name, Op: OpUpdate, Path: path, From: old, To: v})
+		}
+	}
+	for path, v := range from {
+		if _, ok := to[path]; !ok {
+			changes = append(changes, &Change{Realm: desired.Name, Op: OpRemove, Path: path, From: v})
+		}
+	}
+
+	// Secrets are not part of the document, compare them directly. A secret
+	// which is not provided is left unchanged.
+	if c := secretChange(desired.Name, "sms.twilio.authToken", current.twilioAuthToken(), desired.twilioAuthToken()); c != nil {
+		changes = append(changes, c)
+	}
+	if c := secretChange(desired.Name, "email.smtp.password", current.smtpPassword(), desired.smtpPassword()); c != nil {
+		changes = append(changes, c)
+	}
+
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	return changes, nil
+}
+
+func secretChange(realm, path, current, desired string) *Change {
+	if desired == "" || desired == current {
+		return nil
+	}
+	if current == "" {
+		return &Change{Realm: realm, Op: OpAdd, Path: path, To: redacted}
+	}
+	return &Change{Realm: realm, Op: OpUpdate, Path: path, From: redacted, To: redacted}
+}
+
+func (r *Realm) twilioAuthToken() string {
+	if r == nil || r.SMS.Twilio == nil {
+		return ""
+	}
+	return r.SMS.Twilio.authToken
+}
+
+func (r *Realm) smtpPassword() string {
+	if r == nil || r.Email.SMTP == nil {
+		return ""
+	}
+	return r.Email.SMTP.password
+}
+
+// flattenSpec flattens the JSON representation of the realm into a map of
+// setting paths to JSON encoded values. Lists of objects are keyed by their
+// name or email, so reordering a list is not a change.
+func flattenSpec(r *Realm, out map[string]string) error {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	var v interface{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+
+	// The realm is identified by name, and secret references are not settings.
+	m := v.(map[string]interface{})
+	delete(m, "name")
+	return flatten("", m, out)
+}
+
+func flatten(prefix string, v interface{}, out map[string]string) error {
+	join := func(k string) string {
+		if prefix == "" {
+			return k
+		}
+		return prefix + "." + k
+	}
+
+	switch typ := v.(type) {
+	case map[string]interface{}:
+		for k, child := range typ {
+			if k == "authTokenEnv" || k == "passwordEnv" {
+				continue
+			}
+			if err := flatten(join(k), child, out); err != nil {
+				return err
+			}
+		}
+		return nil
+	case []interface{}:
+		if key, ok := listKey(typ); ok {
+			for _, child := range typ {
+				m := child.(map[string]interface{})
+				id := fmt.Sprintf("%s[%v]", prefix, m[key])
+				rest := make(map[string]interface{}, len(m))
+				for k, v := range m {
+					if k != key {
+						rest[k] = v
+					}
+				}
+				if err := flatten(id, rest, out); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	}
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	out[prefix] = string(b)
+	return nil
+}
+
+// listKey returns the identifying key of a list of objects.
+func listKey(list []interface{}) (string, bool) {
+	if len(list) == 0 {
+		return "", false
+	}
+	for _, key := range []string{"email", "name"} {
+		ok := true
+		for _, item := range list {
+			m, isMap := item.(map[string]interface{})
+			if !isMap {
+				return "", false
+			}
+			if _, has := m[key]; !has {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			return key, true
+		}
+	}
+	return "", false
+}
+
+// Normalize validates the desired configuration and converts it to the same
+// canonical form produced by Export, so that Diff only reports real changes.
+// Secrets referenced by environment variables are resolved.
+func (r *Realm) Normalize() error {
+	r.Name = strings.TrimSpace(r.Name)
+
+	var err error
+	for _, d := range []*string{
+		&r.Codes.Duration, &r.Codes.LongDuration,
+		&r.Security.MFARequiredGracePeriod, &r.Certificates.Duration,
+	} {
+		if *d, err = normalizeDuration(*d); err != nil {
+			return err
+		}
+	}
+
+	if _, err := parseTestTypes(r.AllowedTestTypes); err != nil {
+		return err
+	}
+	r.AllowedTestTypes = normalizeList(r.AllowedTestTypes)
+	sort.Slice(r.AllowedTestTypes, func(i, j int) bool {
+		return testTypeOrder[r.AllowedTestTypes[i]] < testTypeOrder[r.AllowedTestTypes[j]]
+	})
+
+	r.Security.MFAMode = strings.ToLower(r.Security.MFAMode)
+	if _, err := parseAuthRequirement(r.Security.MFAMode); err != nil {
+		return fmt.Errorf("security.mfaMode: %w", err)
+	}
+	r.Security.EmailVerifiedMode = strings.ToLower(r.Security.EmailVerifiedMode)
+	if _, err := parseAuthRequirement(r.Security.EmailVerifiedMode); err != nil {
+		return fmt.Errorf("security.emailVerifiedMode: %w", err)
+	}
+
+	if t := r.SMS.Twilio; t != nil && t.AuthTokenEnv != "" {
+		if t.authToken = os.Getenv(t.AuthTokenEnv); t.authToken == "" {
+			return fmt.Errorf("sms.twilio.authTokenEnv: %s is not set", t.AuthTokenEnv)
+		}
+	}
+	if s := r.Email.SMTP; s != nil && s.PasswordEnv != "" {
+		if s.password = os.Getenv(s.PasswordEnv); s.password == "" {
+			return fmt.Errorf("email.smtp.passwordEnv: %s is not set", s.PasswordEnv)
+		}
+	}
+
+	apps := make(map[string]struct{}, len(r.MobileApps))
+	for _, app := range r.MobileApps {
+		if _, ok := apps[app.Name]; ok {
+			return fmt.Errorf("mobileApps: %q is defined more than once", app.Name)
+		}
+		apps[app.Name] = struct{}{}
+
+		app.OS = strings.ToLower(app.OS)
+		if _, err := parseOS(app.OS); err != nil {
+			return fmt.Errorf("mobileApps[%s].os: %w", app.Name, err)
+		}
+	}
+	sort.Slice(r.MobileApps, func(i, j int) bool { return r.MobileApps[i].Name < r.MobileApps[j].Name })
+
+	keys := make(map[string]struct{}, len(r.APIKeys))
+	for _, key := range r.APIKeys {
+		if _, ok := keys[key.Name]; ok {
+			return fmt.Errorf("apiKeys: %q is defined more than once", key.Name)
+		}
+		keys[key.Name] = struct{}{}
+
+		key.Type = strings.ToLower(key.Type)
+		if _, err := parseAPIKeyType(key.Type); err != nil {
+			return fmt.Errorf("apiKeys[%s].type: %w", key.Name, err)
+		}
+	}
+	sort.Slice(r.APIKeys, func(i, j int) bool { return r.APIKeys[i].Name < r.APIKeys[j].Name })
+
+	members := make(map[string]struct{}, len(r.Members))
+	for _, m := range r.Members {
+		m.Email = strings.ToLower(strings.TrimSpace(m.Email))
+		if _, ok := members[m.Email]; ok {
+			return fmt.Errorf("members: %q is defined more than once", m.Email)
+		}
+		members[m.Email] = struct{}{}
+
+		perms, err := parsePermissions(m.Permissions)
+		if err != nil {
+			return fmt.Errorf("members[%s].permissions: %w", m.Email, err)
+		}
+		m.Permissions = rbac.PermissionNames(perms)
+	}
+	sort.Slice(r.Members, func(i, j int) bool { return r.Members[i].Email < r.Members[j].Email })
+
+	return nil
+}
+
+// normalizeDuration parses and re-formats the duration.
+func normalizeDuration(s string) (string, error) {
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return "", fmt.Errorf("invalid duration %q: %w", s, err)
+	}
+	return d.String(), nil
+}
+
+// normalizeList lowercases and de-duplicates the list.
+func normalizeList(l []string) []string {
+	seen := make(map[string]struct{}, len(l))
+	out := make([]string, 0, len(l))
+	for _, v := range l {
+		v = strings.ToLower(strings.TrimSpace(v))
+		if _, ok := seen[v]; ok {
+			continue
+		}
+		seen[v] = struct{}{}
+		out = append(out, v)
+	}
+	return out
+}
+
+var testTypeOrder = map[string]int{"confirmed": 0, "likely": 1, "negative": 2}
+
+func parseTestTypes(names []string) (database.TestType, error) {
+	var t database.TestType
+	for _, name := range names {
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "confirmed":
+			t |= database.TestTypeConfirmed
+		case "likely":
+			t |= database.TestTypeLikely
+		case "negative":
+			t |= database.TestTypeNegative
+		default:
+			return 0, fmt.Errorf("allowedTestTypes: unknown test type %q", name)
+		}
+	}
+	return t, nil
+}
+
+func parseAuthRequirement(s string) (database.AuthRequirement, error) {
+	for _, v := range []database.AuthRequirement{database.MFAOptionalPrompt, database.MFARequired, database.MFAOptional} {
+		if v.String() == s {
+			return v, nil
+		}
+	}
+	return 0, fmt.Errorf("must be one of prompt, required, or optional")
+}
+
+func parseOS(s string) (database.OSType, error) {
+	switch s {
+	case "ios":
+		return database.OSTypeIOS, nil
+	case "android":
+		return database.OSTypeAndroid, nil
+	default:
+		return database.OSTypeInvalid, fmt.Errorf("must be ios or android")
+	}
+}
+
+func parseAPIKeyType(s string) (database.APIKeyType, error) {
+	for _, v := range []database.APIKeyType{database.APIKeyTypeDevice, database.APIKeyTypeAdmin, database.APIKeyTypeStats, database.APIKeyTypeAudit} {
+		if v.Display() == s {
+			return v, nil
+		}
+	}
+	return database.APIKeyTypeInvalid, fmt.Errorf("must be one of device, admin, stats, or audit")
+}
+
+// parsePermissions compiles the permission names, including any implied
+// permissions.
+func parsePermissions(names []string) (rbac.Permission, error) {
+	var all rbac.Permission
+	for p := range rbac.PermissionMap {
+		all |= p
+	}
+
+	perms := make([]rbac.Permission, 0, len(names))
+	for _, name := range names {
+		p, ok := rbac.NamePermissionMap[strings.TrimSpace(name)]
+		if !ok {
+			return 0, fmt.Errorf("unknown permission %q", name)
+		}
+		perms = append(perms, p)
+	}
+	return rbac.CompileAndAuthorize(all, perms)
+}
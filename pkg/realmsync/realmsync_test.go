@@ -0,0 +1,370 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package realmsync
+
+import (
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+)
+
+var testDatabaseInstance *database.TestInstance
+
+func TestMain(m *testing.M) {
+	testDatabaseInstance = database.MustTestInstance()
+	defer testDatabaseInstance.MustClose()
+	m.Run()
+}
+
+func TestParse(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name   string
+		input  string
+		isJSON bool
+		err    string
+	}{
+		{
+			name:  "yaml",
+			input: "realms:\n- name: State of Wonder\n  regionCode: US-WA\n",
+		},
+		{
+			name:   "json",
+			input:  `{"realms": [{"name": "State of Wonder", "regionCode": "US-WA"}]}`,
+			isJSON: true,
+		},
+		{
+			name:  "unknown_field",
+			input: "realms:\n- name: State of Wonder\n  color: blue\n",
+			err:   "failed to parse yaml",
+		},
+		{
+			name:   "unknown_field_json",
+			input:  `{"realms": [{"name": "State of Wonder", "color": "blue"}]}`,
+			isJSON: true,
+			err:    "failed to parse json",
+		},
+		{
+			name:  "missing_name",
+			input: "realms:\n- regionCode: US-WA\n",
+			err:   "name is required",
+		},
+		{
+			name:  "duplicate",
+			input: "realms:\n- name: a\n- name: a\n",
+			err:   "defined more than once",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			f, err := Parse([]byte(tc.input), tc.isJSON)
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Fatalf("expected error containing %q, got %v", tc.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got, want := len(f.Realms), 1; got != want {
+				t.Fatalf("expected %d realms, got %d", want, got)
+			}
+			r := f.Realms[0]
+			if got, want := r.RegionCode, "US-WA"; got != want {
+				t.Errorf("expected region %q to be %q", got, want)
+			}
+
+			// Unspecified fields take the defaults of a new realm.
+			defaults := fromRealm(database.NewRealmWithDefaults(""))
+			if got, want := r.Codes, defaults.Codes; got != want {
+				t.Errorf("expected codes %#v to be %#v", got, want)
+			}
+			if got, want := r.SMS.TextTemplate, defaults.SMS.TextTemplate; got != want {
+				t.Errorf("expected sms template %q to be %q", got, want)
+			}
+		})
+	}
+}
+
+func TestRealm_Normalize(t *testing.T) {
+	t.Parallel()
+
+	t.Run("canonical", func(t *testing.T) {
+		t.Parallel()
+
+		r := defaultRealm()
+		r.Name = " State of Wonder "
+		r.Codes.Duration = "900s"
+		r.AllowedTestTypes = []string{"Negative", "confirmed", "negative"}
+		r.Security.MFAMode = "Required"
+		r.MobileApps = []*MobileApp{
+			{Name: "b", OS: "IOS", AppID: "com.example.b"},
+			{Name: "a", OS: "android", AppID: "com.example.a"},
+		}
+		r.Members = []*Member{
+			{Email: "Alice@Example.com", Permissions: []string{"CodeBulkIssue"}},
+		}
+
+		if err := r.Normalize(); err != nil {
+			t.Fatal(err)
+		}
+
+		if got, want := r.Name, "State of Wonder"; got != want {
+			t.Errorf("expected name %q to be %q", got, want)
+		}
+		if got, want := r.Codes.Duration, "15m0s"; got != want {
+			t.Errorf("expected duration %q to be %q", got, want)
+		}
+		if got, want := r.AllowedTestTypes, []string{"confirmed", "negative"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("expected test types %q to be %q", got, want)
+		}
+		if got, want := r.Security.MFAMode, "required"; got != want {
+			t.Errorf("expected mfa mode %q to be %q", got, want)
+		}
+		if got, want := r.MobileApps[0].Name, "a"; got != want {
+			t.Errorf("expected first app %q to be %q", got, want)
+		}
+		if got, want := r.MobileApps[1].OS, "ios"; got != want {
+			t.Errorf("expected os %q to be %q", got, want)
+		}
+		if got, want := r.Members[0].Email, "alice@example.com"; got != want {
+			t.Errorf("expected email %q to be %q", got, want)
+		}
+		// CodeBulkIssue implies CodeIssue.
+		if got, want := r.Members[0].Permissions, []string{"CodeBulkIssue", "CodeIssue"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("expected permissions %q to be %q", got, want)
+		}
+	})
+
+	cases := []struct {
+		name   string
+		mutate func(r *Realm)
+		err    string
+	}{
+		{
+			name:   "bad_duration",
+			mutate: func(r *Realm) { r.Codes.Duration = "forever" },
+			err:    "invalid duration",
+		},
+		{
+			name:   "bad_test_type",
+			mutate: func(r *Realm) { r.AllowedTestTypes = []string{"maybe"} },
+			err:    "maybe",
+		},
+		{
+			name:   "bad_os",
+			mutate: func(r *Realm) { r.MobileApps = []*MobileApp{{Name: "a", OS: "symbian"}} },
+			err:    "mobileApps[a].os",
+		},
+		{
+			name:   "bad_api_key_type",
+			mutate: func(r *Realm) { r.APIKeys = []*APIKey{{Name: "a", Type: "root"}} },
+			err:    "apiKeys[a].type",
+		},
+		{
+			name:   "bad_permission",
+			mutate: func(r *Realm) { r.Members = []*Member{{Email: "a@example.com", Permissions: []string{"Everything"}}} },
+			err:    "members[a@example.com].permissions",
+		},
+		{
+			name: "duplicate_member",
+			mutate: func(r *Realm) {
+				r.Members = []*Member{{Email: "a@example.com"}, {Email: "A@example.com"}}
+			},
+			err: "defined more than once",
+		},
+		{
+			name: "missing_secret",
+			mutate: func(r *Realm) {
+				r.SMS.Twilio = &Twilio{AuthTokenEnv: "REALMSYNC_TEST_DOES_NOT_EXIST"}
+			},
+			err: "is not set",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			r := defaultRealm()
+			r.Name = "State of Wonder"
+			tc.mutate(r)
+
+			err := r.Normalize()
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Fatalf("expected error containing %q, got %v", tc.err, err)
+			}
+		})
+	}
+}
+
+func TestDiff(t *testing.T) {
+	t.Parallel()
+
+	newRealm := func() *Realm {
+		r := defaultRealm()
+		r.Name = "State of Wonder"
+		r.MobileApps = []*MobileApp{
+			{Name: "a", OS: "android", AppID: "com.example.a"},
+			{Name: "b", OS: "ios", AppID: "com.example.b"},
+		}
+		r.Members = []*Member{
+			{Email: "alice@example.com", Name: "Alice", Permissions: []string{"CodeIssue", "CodeRead"}},
+		}
+		r.SMS.Twilio = &Twilio{AccountSID: "sid", FromNumber: "+15005550006", authToken: "token"}
+		if err := r.Normalize(); err != nil {
+			t.Fatal(err)
+		}
+		return r
+	}
+
+	t.Run("unchanged", func(t *testing.T) {
+		t.Parallel()
+
+		current, desired := newRealm(), newRealm()
+
+		// Reordering lists and omitting secrets is not a change.
+		desired.MobileApps[0], desired.MobileApps[1] = desired.MobileApps[1], desired.MobileApps[0]
+		desired.SMS.Twilio.authToken = ""
+
+		changes, err := Diff(current, desired)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(changes) != 0 {
+			t.Errorf("expected no changes, got %v", changes)
+		}
+	})
+
+	t.Run("new_realm", func(t *testing.T) {
+		t.Parallel()
+
+		changes, err := Diff(nil, newRealm())
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, c := range changes {
+			if c.Op != OpAdd {
+				t.Errorf("expected only additions, got %v", c)
+			}
+		}
+	})
+
+	t.Run("changes", func(t *testing.T) {
+		t.Parallel()
+
+		current, desired := newRealm(), newRealm()
+		desired.RegionCode = "US-WA"
+		desired.MobileApps = desired.MobileApps[:1]
+		desired.MobileApps[0].AppID = "com.example.c"
+		desired.Members = append(desired.Members, &Member{Email: "bob@example.com", Permissions: []string{"CodeRead"}})
+		desired.SMS.Twilio.authToken = "new-token"
+
+		changes, err := Diff(current, desired)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got := make([]string, 0, len(changes))
+		for _, c := range changes {
+			got = append(got, c.String())
+		}
+		want := []string{
+			`+ State of Wonder.members[bob@example.com].permissions: ["CodeRead"]`,
+			`~ State of Wonder.mobileApps[a].appID: "com.example.a" -> "com.example.c"`,
+			`- State of Wonder.mobileApps[b].appID: "com.example.b"`,
+			`- State of Wonder.mobileApps[b].os: "ios"`,
+			`+ State of Wonder.regionCode: "US-WA"`,
+			`~ State of Wonder.sms.twilio.authToken: (redacted) -> (redacted)`,
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("expected\n%s\n\nto be\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+		}
+	})
+}
+
+func TestIsPrunable(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		path string
+		want bool
+	}{
+		{"mobileApps[a].os", true},
+		{"apiKeys[a].type", true},
+		{"members[a@example.com].permissions", true},
+		{"sms.twilio.accountSID", true},
+		{"email.smtp.host", true},
+		{"sms.textTemplate", false},
+		{"email.smtpOther", false},
+		{"regionCode", false},
+	}
+
+	for _, tc := range cases {
+		if got := isPrunable(tc.path); got != tc.want {
+			t.Errorf("isPrunable(%q): expected %t to be %t", tc.path, got, tc.want)
+		}
+	}
+}
+
+func TestApply(t *testing.T) {
+	t.Parallel()
+
+	db, _ := testDatabaseInstance.NewDatabase(t, nil)
+
+	var hooks int32
+	db.OnAuditEntryCreated(func() {
+		atomic.AddInt32(&hooks, 1)
+	})
+
+	f, err := Parse([]byte("realms:\n- name: State of Wonder\n  apiKeys:\n  - name: Issuer\n    type: admin\n"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	desired := f.Realms[0]
+	if err := desired.Normalize(); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := Apply(db, desired, database.SystemTest, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := result.CreatedAPIKeys["Issuer"]; !ok {
+		t.Errorf("expected api key to be created")
+	}
+
+	// The audit sinks are notified of the audit entries once they commit.
+	if atomic.LoadInt32(&hooks) == 0 {
+		t.Errorf("expected audit hooks to run")
+	}
+
+	if _, err := db.FindRealmByName("State of Wonder"); err != nil {
+		t.Errorf("expected realm to be created: %v", err)
+	}
+}
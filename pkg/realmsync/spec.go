@@ -0,0 +1,275 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package realmsync exports realm configuration to a declarative YAML or JSON
+// document, and diffs and applies such documents to the database. This allows
+// realm configuration to be reviewed and promoted between environments like
+// code.
+package realmsync
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+	"gopkg.in/yaml.v2"
+)
+
+// File is the top-level document of realm configuration.
+type File struct {
+	Realms []*Realm `json:"realms" yaml:"realms"`
+}
+
+// Realm is the declarative configuration of a single realm. Realms are
+// identified by name. Fields which are not specified take the same defaults as
+// realms created in the UI.
+type Realm struct {
+	Name                    string `json:"name" yaml:"name"`
+	RegionCode              string `json:"regionCode,omitempty" yaml:"regionCode,omitempty"`
+	WelcomeMessage          string `json:"welcomeMessage,omitempty" yaml:"welcomeMessage,omitempty"`
+	AllowBulkUpload         bool   `json:"allowBulkUpload" yaml:"allowBulkUpload"`
+	RequireDate             bool   `json:"requireDate" yaml:"requireDate"`
+	EnableENExpress         bool   `json:"enableENExpress" yaml:"enableENExpress"`
+	DailyActiveUsersEnabled bool   `json:"dailyActiveUsersEnabled" yaml:"dailyActiveUsersEnabled"`
+
+	// AllowedTestTypes is a list of "confirmed", "likely", and "negative".
+	AllowedTestTypes []string `json:"allowedTestTypes" yaml:"allowedTestTypes"`
+
+	Codes           Codes           `json:"codes" yaml:"codes"`
+	SMS             SMS             `json:"sms" yaml:"sms"`
+	Email           Email           `json:"email" yaml:"email"`
+	Security        Security        `json:"security" yaml:"security"`
+	Certificates    Certificates    `json:"certificates" yaml:"certificates"`
+	AbusePrevention AbusePrevention `json:"abusePrevention" yaml:"abusePrevention"`
+	Retention       Retention       `json:"retention" yaml:"retention"`
+
+	MobileApps []*MobileApp `json:"mobileApps,omitempty" yaml:"mobileApps,omitempty"`
+	APIKeys    []*APIKey    `json:"apiKeys,omitempty" yaml:"apiKeys,omitempty"`
+	Members    []*Member    `json:"members,omitempty" yaml:"members,omitempty"`
+}
+
+// Codes is the verification code configuration.
+type Codes struct {
+	Length       uint   `json:"length" yaml:"length"`
+	Duration     string `json:"duration" yaml:"duration"`
+	LongLength   uint   `json:"longLength" yaml:"longLength"`
+	LongDuration string `json:"longDuration" yaml:"longDuration"`
+}
+
+// SMS is the SMS configuration.
+type SMS struct {
+	TextTemplate       string            `json:"textTemplate" yaml:"textTemplate"`
+	AlternateTemplates map[string]string `json:"alternateTemplates,omitempty" yaml:"alternateTemplates,omitempty"`
+	Country            string            `json:"country,omitempty" yaml:"country,omitempty"`
+
+	// CanUseSystemConfig and UseSystemConfig control use of the system SMS
+	// config. FromNumber is the label of the system SMS from number.
+	CanUseSystemConfig bool   `json:"canUseSystemConfig" yaml:"canUseSystemConfig"`
+	UseSystemConfig    bool   `json:"useSystemConfig" yaml:"useSystemConfig"`
+	FromNumber         string `json:"fromNumber,omitempty" yaml:"fromNumber,omitempty"`
+
+	// Twilio is the realm's own Twilio configuration, if any.
+	Twilio *Twilio `json:"twilio,omitempty" yaml:"twilio,omitempty"`
+}
+
+// Twilio is a realm-specific Twilio configuration. The auth token is never
+// exported. Instead, AuthTokenEnv names the environment variable which holds
+// the token when applying. If AuthTokenEnv is empty, the current token is kept.
+type Twilio struct {
+	AccountSID   string `json:"accountSID" yaml:"accountSID"`
+	FromNumber   string `json:"fromNumber" yaml:"fromNumber"`
+	AuthTokenEnv string `json:"authTokenEnv,omitempty" yaml:"authTokenEnv,omitempty"`
+
+	authToken string
+}
+
+// Email is the email configuration.
+type Email struct {
+	InviteTemplate        string `json:"inviteTemplate,omitempty" yaml:"inviteTemplate,omitempty"`
+	PasswordResetTemplate string `json:"passwordResetTemplate,omitempty" yaml:"passwordResetTemplate,omitempty"`
+	VerifyTemplate        string `json:"verifyTemplate,omitempty" yaml:"verifyTemplate,omitempty"`
+
+	CanUseSystemConfig bool `json:"canUseSystemConfig" yaml:"canUseSystemConfig"`
+	UseSystemConfig    bool `json:"useSystemConfig" yaml:"useSystemConfig"`
+
+	// SMTP is the realm's own SMTP configuration, if any.
+	SMTP *SMTP `json:"smtp,omitempty" yaml:"smtp,omitempty"`
+}
+
+// SMTP is a realm-specific SMTP configuration. Like Twilio, the password is
+// referenced by environment variable name and never exported.
+type SMTP struct {
+	Account     string `json:"account" yaml:"account"`
+	Host        string `json:"host" yaml:"host"`
+	Port        string `json:"port" yaml:"port"`
+	PasswordEnv string `json:"passwordEnv,omitempty" yaml:"passwordEnv,omitempty"`
+
+	password string
+}
+
+// Security is the authentication and network configuration.
+type Security struct {
+	// MFAMode and EmailVerifiedMode are one of "prompt", "required", or
+	// "optional".
+	MFAMode                     string `json:"mfaMode" yaml:"mfaMode"`
+	MFARequiredGracePeriod      string `json:"mfaRequiredGracePeriod" yaml:"mfaRequiredGracePeriod"`
+	EmailVerifiedMode           string `json:"emailVerifiedMode" yaml:"emailVerifiedMode"`
+	PasswordRotationPeriodDays  uint   `json:"passwordRotationPeriodDays" yaml:"passwordRotationPeriodDays"`
+	PasswordRotationWarningDays uint   `json:"passwordRotationWarningDays" yaml:"passwordRotationWarningDays"`
+
+	AllowedCIDRsAdminAPI  []string `json:"allowedCIDRsAdminAPI,omitempty" yaml:"allowedCIDRsAdminAPI,omitempty"`
+	AllowedCIDRsAPIServer []string `json:"allowedCIDRsAPIServer,omitempty" yaml:"allowedCIDRsAPIServer,omitempty"`
+	AllowedCIDRsServer    []string `json:"allowedCIDRsServer,omitempty" yaml:"allowedCIDRsServer,omitempty"`
+}
+
+// Certificates is the certificate signing configuration.
+type Certificates struct {
+	UseRealmKey          bool   `json:"useRealmKey" yaml:"useRealmKey"`
+	Issuer               string `json:"issuer,omitempty" yaml:"issuer,omitempty"`
+	Audience             string `json:"audience,omitempty" yaml:"audience,omitempty"`
+	Duration             string `json:"duration" yaml:"duration"`
+	RotationPeriodDays   uint   `json:"rotationPeriodDays" yaml:"rotationPeriodDays"`
+	RotationOverlapHours uint   `json:"rotationOverlapHours" yaml:"rotationOverlapHours"`
+}
+
+// AbusePrevention is the abuse prevention configuration.
+type AbusePrevention struct {
+	Enabled     bool    `json:"enabled" yaml:"enabled"`
+	LimitFactor float32 `json:"limitFactor" yaml:"limitFactor"`
+}
+
+// Retention is the data retention configuration. Zero uses the system
+// default.
+type Retention struct {
+	VerificationCodeDays uint `json:"verificationCodeDays" yaml:"verificationCodeDays"`
+	AuditEntryDays       uint `json:"auditEntryDays" yaml:"auditEntryDays"`
+}
+
+// MobileApp is a mobile app, identified by name.
+type MobileApp struct {
+	Name string `json:"name" yaml:"name"`
+
+	// OS is "ios" or "android".
+	OS    string `json:"os" yaml:"os"`
+	AppID string `json:"appID" yaml:"appID"`
+	SHA   string `json:"sha,omitempty" yaml:"sha,omitempty"`
+	URL   string `json:"url,omitempty" yaml:"url,omitempty"`
+}
+
+// APIKey is the metadata of an API key, identified by name. API key secrets
+// are never exported. Keys created by apply are printed once.
+type APIKey struct {
+	Name string `json:"name" yaml:"name"`
+
+	// Type is "device", "admin", or "stats".
+	Type string `json:"type" yaml:"type"`
+}
+
+// Member is a user's membership in the realm, identified by email.
+type Member struct {
+	Email       string   `json:"email" yaml:"email"`
+	Name        string   `json:"name,omitempty" yaml:"name,omitempty"`
+	Permissions []string `json:"permissions" yaml:"permissions"`
+}
+
+// defaultRealm returns the spec of a new realm with default settings.
+func defaultRealm() *Realm {
+	return fromRealm(database.NewRealmWithDefaults(""))
+}
+
+// UnmarshalJSON applies the realm defaults before decoding. Unknown fields are
+// rejected.
+func (r *Realm) UnmarshalJSON(b []byte) error {
+	type plain Realm
+	p := (*plain)(defaultRealm())
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.DisallowUnknownFields()
+	if err := d.Decode(p); err != nil {
+		return err
+	}
+	*r = Realm(*p)
+	return nil
+}
+
+// UnmarshalYAML applies the realm defaults before decoding.
+func (r *Realm) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type plain Realm
+	p := (*plain)(defaultRealm())
+	if err := unmarshal(p); err != nil {
+		return err
+	}
+	*r = Realm(*p)
+	return nil
+}
+
+// isJSON returns true if the path should be read or written as JSON instead
+// of YAML.
+func isJSON(path string) bool {
+	return strings.EqualFold(filepath.Ext(path), ".json")
+}
+
+// Parse parses a realm configuration document. If isJSON is false, the
+// document is parsed as YAML.
+func Parse(b []byte, isJSON bool) (*File, error) {
+	var f File
+	if isJSON {
+		d := json.NewDecoder(bytes.NewReader(b))
+		d.DisallowUnknownFields()
+		if err := d.Decode(&f); err != nil {
+			return nil, fmt.Errorf("failed to parse json: %w", err)
+		}
+	} else {
+		if err := yaml.UnmarshalStrict(b, &f); err != nil {
+			return nil, fmt.Errorf("failed to parse yaml: %w", err)
+		}
+	}
+
+	seen := make(map[string]struct{}, len(f.Realms))
+	for i, r := range f.Realms {
+		if r == nil || strings.TrimSpace(r.Name) == "" {
+			return nil, fmt.Errorf("realm %d: name is required", i)
+		}
+		if _, ok := seen[r.Name]; ok {
+			return nil, fmt.Errorf("realm %q: defined more than once", r.Name)
+		}
+		seen[r.Name] = struct{}{}
+	}
+	return &f, nil
+}
+
+// Load reads the realm configuration document at path. Files ending in .json
+// are parsed as JSON, all others as YAML.
+func Load(path string) (*File, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return Parse(b, isJSON(path))
+}
+
+// Marshal encodes the document as JSON or YAML.
+func (f *File) Marshal(asJSON bool) ([]byte, error) {
+	if asJSON {
+		b, err := json.MarshalIndent(f, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		return append(b, '\n'), nil
+	}
+	return yaml.Marshal(f)
+}
@@ -0,0 +1,96 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var _ Blobstore = (*Filesystem)(nil)
+
+// Filesystem is a blobstore backed by the local filesystem, for installations
+// without cloud storage. The bucket is the base directory, and object names may
+// contain slashes to create subdirectories.
+type Filesystem struct{}
+
+// NewFilesystem creates a new filesystem blobstore.
+func NewFilesystem() Blobstore {
+	return &Filesystem{}
+}
+
+// CreateObject writes the object to a file, creating any missing directories.
+func (f *Filesystem) CreateObject(ctx context.Context, bucket, name string, contents []byte, contentType string) error {
+	pth, err := f.path(bucket, name)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(pth), 0o700); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+	if err := ioutil.WriteFile(pth, contents, 0o600); err != nil {
+		return fmt.Errorf("failed to write object: %w", err)
+	}
+	return nil
+}
+
+// GetObject reads the object from its file.
+func (f *Filesystem) GetObject(ctx context.Context, bucket, name string) ([]byte, error) {
+	pth, err := f.path(bucket, name)
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := ioutil.ReadFile(pth)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to read object: %w", err)
+	}
+	return b, nil
+}
+
+// DeleteObject deletes the object's file.
+func (f *Filesystem) DeleteObject(ctx context.Context, bucket, name string) error {
+	pth, err := f.path(bucket, name)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(pth); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to delete object: %w", err)
+	}
+	return nil
+}
+
+// path returns the path to the object, ensuring it is inside the bucket.
+func (f *Filesystem) path(bucket, name string) (string, error) {
+	if bucket == "" {
+		return "", fmt.Errorf("bucket is required")
+	}
+
+	base := filepath.Clean(bucket)
+	pth := filepath.Join(base, filepath.FromSlash(name))
+	if !strings.HasPrefix(pth, base+string(filepath.Separator)) {
+		return "", fmt.Errorf("invalid object name %q", name)
+	}
+	return pth, nil
+}
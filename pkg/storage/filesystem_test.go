@@ -0,0 +1,68 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestFilesystem(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	bucket, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		os.RemoveAll(bucket)
+	})
+
+	store := NewFilesystem()
+
+	if err := store.CreateObject(ctx, bucket, "realm-1/report.csv", []byte("a,b\n"), "text/csv"); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := store.GetObject(ctx, bucket, "realm-1/report.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(b), "a,b\n"; got != want {
+		t.Errorf("expected %q to be %q", got, want)
+	}
+
+	if err := store.DeleteObject(ctx, bucket, "realm-1/report.csv"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.GetObject(ctx, bucket, "realm-1/report.csv"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected %v, got %v", ErrNotFound, err)
+	}
+
+	// Deleting a missing object is not an error.
+	if err := store.DeleteObject(ctx, bucket, "realm-1/report.csv"); err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+
+	// Objects cannot escape the bucket.
+	if err := store.CreateObject(ctx, bucket, "../escape.csv", nil, "text/csv"); err == nil {
+		t.Errorf("expected error")
+	}
+}
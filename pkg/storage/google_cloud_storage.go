@@ -0,0 +1,103 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"google.golang.org/api/googleapi"
+	gcs "google.golang.org/api/storage/v1"
+)
+
+var _ Blobstore = (*GoogleCloudStorage)(nil)
+
+// GoogleCloudStorage is a blobstore backed by Google Cloud Storage. It
+// authenticates with the default application credentials.
+type GoogleCloudStorage struct {
+	service *gcs.Service
+}
+
+// NewGoogleCloudStorage creates a new Google Cloud Storage blobstore.
+func NewGoogleCloudStorage(ctx context.Context) (Blobstore, error) {
+	service, err := gcs.NewService(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create storage client: %w", err)
+	}
+
+	return &GoogleCloudStorage{
+		service: service,
+	}, nil
+}
+
+// CreateObject uploads the object.
+func (s *GoogleCloudStorage) CreateObject(ctx context.Context, bucket, name string, contents []byte, contentType string) error {
+	obj := &gcs.Object{
+		Name:         name,
+		ContentType:  contentType,
+		CacheControl: "private, no-cache, no-store",
+	}
+
+	if _, err := s.service.Objects.
+		Insert(bucket, obj).
+		Media(bytes.NewReader(contents), googleapi.ContentType(contentType)).
+		Context(ctx).
+		Do(); err != nil {
+		return fmt.Errorf("failed to upload object: %w", err)
+	}
+	return nil
+}
+
+// GetObject downloads the object.
+func (s *GoogleCloudStorage) GetObject(ctx context.Context, bucket, name string) ([]byte, error) {
+	resp, err := s.service.Objects.
+		Get(bucket, name).
+		Context(ctx).
+		Download()
+	if err != nil {
+		if isNotFound(err) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to download object: %w", err)
+	}
+	defer resp.Body.Close()
+
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read object: %w", err)
+	}
+	return b, nil
+}
+
+// DeleteObject deletes the object.
+func (s *GoogleCloudStorage) DeleteObject(ctx context.Context, bucket, name string) error {
+	if err := s.service.Objects.
+		Delete(bucket, name).
+		Context(ctx).
+		Do(); err != nil && !isNotFound(err) {
+		return fmt.Errorf("failed to delete object: %w", err)
+	}
+	return nil
+}
+
+// isNotFound returns true if the error is a 404 from the storage API.
+func isNotFound(err error) bool {
+	var gerr *googleapi.Error
+	return errors.As(err, &gerr) && gerr.Code == http.StatusNotFound
+}
@@ -0,0 +1,44 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"context"
+)
+
+var _ Blobstore = (*Noop)(nil)
+
+// Noop is a blobstore that discards objects.
+type Noop struct{}
+
+// NewNoop creates a new noop blobstore.
+func NewNoop() Blobstore {
+	return &Noop{}
+}
+
+// CreateObject does nothing.
+func (n *Noop) CreateObject(ctx context.Context, bucket, name string, contents []byte, contentType string) error {
+	return nil
+}
+
+// GetObject always returns ErrNotFound.
+func (n *Noop) GetObject(ctx context.Context, bucket, name string) ([]byte, error) {
+	return nil, ErrNotFound
+}
+
+// DeleteObject does nothing.
+func (n *Noop) DeleteObject(ctx context.Context, bucket, name string) error {
+	return nil
+}
@@ -0,0 +1,72 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package storage defines blob storage backends for exported files.
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// BlobstoreType represents a type of blob storage.
+type BlobstoreType string
+
+const (
+	BlobstoreTypeNoop               BlobstoreType = "NOOP"
+	BlobstoreTypeFilesystem         BlobstoreType = "FILESYSTEM"
+	BlobstoreTypeGoogleCloudStorage BlobstoreType = "GOOGLE_CLOUD_STORAGE"
+)
+
+// ErrNotFound is returned when an object does not exist.
+var ErrNotFound = errors.New("storage object not found")
+
+// Config represents the configuration for blob storage.
+type Config struct {
+	Type BlobstoreType `env:"BLOBSTORE_TYPE, default=NOOP"`
+
+	// Bucket is the bucket in which objects are stored. For the filesystem
+	// blobstore, it is the base directory.
+	Bucket string `env:"BLOBSTORE_BUCKET"`
+}
+
+// Blobstore stores and retrieves objects.
+type Blobstore interface {
+	// CreateObject creates or overwrites the object with the given name in the
+	// bucket.
+	CreateObject(ctx context.Context, bucket, name string, contents []byte, contentType string) error
+
+	// GetObject returns the contents of the object. It returns ErrNotFound if
+	// the object does not exist.
+	GetObject(ctx context.Context, bucket, name string) ([]byte, error)
+
+	// DeleteObject deletes the object. It is not an error if the object does
+	// not exist.
+	DeleteObject(ctx context.Context, bucket, name string) error
+}
+
+// BlobstoreFor returns the blobstore for the given config.
+func BlobstoreFor(ctx context.Context, c *Config) (Blobstore, error) {
+	switch typ := c.Type; typ {
+	case BlobstoreTypeNoop, "":
+		return NewNoop(), nil
+	case BlobstoreTypeFilesystem:
+		return NewFilesystem(), nil
+	case BlobstoreTypeGoogleCloudStorage:
+		return NewGoogleCloudStorage(ctx)
+	default:
+		return nil, fmt.Errorf("unknown blobstore type: %v", typ)
+	}
+}
@@ -35,6 +35,7 @@ import (
 	"github.com/google/exposure-notifications-verification-server/pkg/controller/middleware"
 	"github.com/google/exposure-notifications-verification-server/pkg/controller/verifyapi"
 	"github.com/google/exposure-notifications-verification-server/pkg/database"
+	"github.com/google/exposure-notifications-verification-server/pkg/keyutils"
 	"github.com/google/exposure-notifications-verification-server/pkg/ratelimit"
 	"github.com/google/exposure-notifications-verification-server/pkg/render"
 	"github.com/gorilla/mux"
@@ -84,7 +85,7 @@ func NewIntegrationTestConfig(ctx context.Context, tb testing.TB) (*IntegrationT
 		FilesystemRoot: tmpdir,
 	}
 
-	kms, err := keys.KeyManagerFor(ctx, &keyConfig)
+	kms, err := keyutils.KeyManagerFor(ctx, &keyConfig)
 	if err != nil {
 		tb.Fatal(err)
 	}
@@ -105,10 +106,11 @@ func NewIntegrationTestConfig(ctx context.Context, tb testing.TB) (*IntegrationT
 	}
 
 	tsConfig := config.TokenSigningConfig{
-		Keys:               keyConfig,
 		TokenSigningKeys:   []string{keyID},
 		TokenSigningKeyIDs: []string{"v1"},
 		TokenIssuer:        "diagnosis-verification-example",
+
+		TokenSigningKeyCacheDuration: time.Minute,
 	}
 
 	csConfig := config.CertificateSigningConfig{
@@ -325,12 +327,14 @@ func (s *IntegrationSuite) newAPIServer(ctx context.Context, tb testing.TB) *htt
 		}
 	})
 
-	// Setup signers
-	tokenSigner, err := keys.KeyManagerFor(ctx, &s.cfg.APISrvConfig.TokenSigning.Keys)
-	if err != nil {
-		tb.Fatalf("failed to create token key manager: %v", err)
+	// Import the configured token signing keys
+	tokenSigning := s.cfg.APISrvConfig.TokenSigning
+	if err := s.DB.ImportTokenSigningKeys(tokenSigning.TokenSigningKeys, tokenSigning.TokenSigningKeyIDs); err != nil {
+		tb.Fatalf("failed to import token signing keys: %v", err)
 	}
-	certificateSigner, err := keys.KeyManagerFor(ctx, &s.cfg.APISrvConfig.CertificateSigning.Keys)
+
+	// Setup signers
+	certificateSigner, err := keyutils.KeyManagerFor(ctx, &s.cfg.APISrvConfig.CertificateSigning.Keys)
 	if err != nil {
 		tb.Fatalf("failed to create certificate key manager: %v", err)
 	}
@@ -353,7 +357,7 @@ func (s *IntegrationSuite) newAPIServer(ctx context.Context, tb testing.TB) *htt
 
 		verifyChaff := chaff.New()
 		defer verifyChaff.Close()
-		verifyapiController, err := verifyapi.New(ctx, &s.cfg.APISrvConfig, s.DB, h, tokenSigner)
+		verifyapiController, err := verifyapi.New(ctx, &s.cfg.APISrvConfig, s.DB, cacher, h)
 		if err != nil {
 			tb.Fatalf("failed to create verify api controller: %v", err)
 		}
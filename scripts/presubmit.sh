@@ -111,5 +111,26 @@ if [ -n "${OUT}" ]; then
 fi
 
 
+echo "🔐 Set up SoftHSM"
+if [ -n "${CI:-}" ] && ! command -v softhsm2-util &>/dev/null; then
+  apt-get -qq update && apt-get -qq install -y softhsm2 > /dev/null
+fi
+if command -v softhsm2-util &>/dev/null; then
+  export SOFTHSM2_CONF="$(mktemp -d)/softhsm2.conf"
+  mkdir -p "$(dirname "${SOFTHSM2_CONF}")/tokens"
+  echo "directories.tokendir = $(dirname "${SOFTHSM2_CONF}")/tokens" > "${SOFTHSM2_CONF}"
+
+  export PKCS11_MODULE_PATH="${PKCS11_MODULE_PATH:-/usr/lib/softhsm/libsofthsm2.so}"
+  export PKCS11_TOKEN_LABEL="presubmit"
+  export PKCS11_PIN="1234"
+  softhsm2-util --init-token --free \
+    --label "${PKCS11_TOKEN_LABEL}" \
+    --pin "${PKCS11_PIN}" \
+    --so-pin "5678" > /dev/null
+else
+  echo "softhsm2-util not found, PKCS#11 tests will be skipped"
+fi
+
+
 echo "🧪 Test"
 make test-acc
@@ -38,6 +38,38 @@ data "google_kms_crypto_key_version" "certificate-signer-version" {
   crypto_key = google_kms_crypto_key.certificate-signer.self_link
 }
 
+// For signing certificate transparency log tree heads
+resource "google_kms_crypto_key" "certificate-log-signer" {
+  key_ring = google_kms_key_ring.verification.self_link
+  name     = "certificate-log-signer"
+  purpose  = "ASYMMETRIC_SIGN"
+
+  version_template {
+    algorithm        = "EC_SIGN_P256_SHA256"
+    protection_level = "HSM"
+  }
+}
+
+data "google_kms_crypto_key_version" "certificate-log-signer-version" {
+  crypto_key = google_kms_crypto_key.certificate-log-signer.self_link
+}
+
+// For signing audit log checkpoints and truncation markers
+resource "google_kms_crypto_key" "audit-chain-signer" {
+  key_ring = google_kms_key_ring.verification.self_link
+  name     = "audit-chain-signer"
+  purpose  = "ASYMMETRIC_SIGN"
+
+  version_template {
+    algorithm        = "EC_SIGN_P256_SHA256"
+    protection_level = "HSM"
+  }
+}
+
+data "google_kms_crypto_key_version" "audit-chain-signer-version" {
+  crypto_key = google_kms_crypto_key.audit-chain-signer.self_link
+}
+
 // For signing tokens
 resource "google_kms_crypto_key" "token-signer" {
   key_ring = google_kms_key_ring.verification.self_link
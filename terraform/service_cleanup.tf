@@ -61,6 +61,12 @@ resource "google_kms_crypto_key_iam_member" "cleanup-database-encrypter" {
   member        = "serviceAccount:${google_service_account.cleanup.email}"
 }
 
+resource "google_kms_crypto_key_iam_member" "cleanup-audit-chain-signer" {
+  crypto_key_id = google_kms_crypto_key.audit-chain-signer.self_link
+  role          = "roles/cloudkms.signerVerifier"
+  member        = "serviceAccount:${google_service_account.cleanup.email}"
+}
+
 resource "google_secret_manager_secret_iam_member" "cleanup-db-apikey-db-hmac" {
   secret_id = google_secret_manager_secret.db-apikey-db-hmac.id
   role      = "roles/secretmanager.secretAccessor"
@@ -121,6 +127,10 @@ resource "google_cloud_run_service" "cleanup" {
             local.gcp_config,
             local.signing_config,
             local.observability_config,
+            {
+              "AUDIT_CHAIN_KEY_MANAGER" = "GOOGLE_CLOUD_KMS"
+              "AUDIT_CHAIN_SIGNING_KEY" = trimprefix(data.google_kms_crypto_key_version.audit-chain-signer-version.id, "//cloudkms.googleapis.com/v1/")
+            },
 
             // This MUST come last to allow overrides!
             lookup(var.service_environment, "cleanup", {}),
@@ -149,6 +159,7 @@ resource "google_cloud_run_service" "cleanup" {
     google_secret_manager_secret_iam_member.cleanup-db,
     google_project_iam_member.cleanup-observability,
     google_kms_crypto_key_iam_member.cleanup-database-encrypter,
+    google_kms_crypto_key_iam_member.cleanup-audit-chain-signer,
     google_secret_manager_secret_iam_member.cleanup-db-apikey-db-hmac,
     google_secret_manager_secret_iam_member.cleanup-db-apikey-sig-hmac,
     google_secret_manager_secret_iam_member.cleanup-db-verification-code-hmac,
@@ -244,3 +244,30 @@ resource "google_cloud_scheduler_job" "modeler-worker" {
     google_project_service.services["cloudscheduler.googleapis.com"],
   ]
 }
+
+resource "google_cloud_scheduler_job" "stats-report-worker" {
+  name             = "stats-report-worker"
+  region           = var.cloudscheduler_location
+  schedule         = "15 * * * *"
+  time_zone        = "UTC"
+  attempt_deadline = "600s"
+
+  retry_config {
+    retry_count = 1
+  }
+
+  http_target {
+    http_method = "POST"
+    uri         = "${google_cloud_run_service.modeler.status.0.url}/stats-reports"
+    oidc_token {
+      audience              = google_cloud_run_service.modeler.status.0.url
+      service_account_email = google_service_account.modeler-invoker.email
+    }
+  }
+
+  depends_on = [
+    google_app_engine_application.app,
+    google_cloud_run_service_iam_member.modeler-invoker,
+    google_project_service.services["cloudscheduler.googleapis.com"],
+  ]
+}
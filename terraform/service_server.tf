@@ -128,6 +128,12 @@ resource "google_secret_manager_secret_iam_member" "server-ratelimit-hmac-key" {
   member    = "serviceAccount:${google_service_account.server.email}"
 }
 
+resource "google_secret_manager_secret_iam_member" "server-public-stats-hmac-key" {
+  secret_id = google_secret_manager_secret.public-stats-hmac-key.id
+  role      = "roles/secretmanager.secretAccessor"
+  member    = "serviceAccount:${google_service_account.server.email}"
+}
+
 resource "google_cloud_run_service" "server" {
   name     = "server"
   location = var.region
@@ -153,6 +159,7 @@ resource "google_cloud_run_service" "server" {
           for_each = merge(
             { "ASSETS_PATH" = "/assets" },
             { "LOCALES_PATH" = "/locales" },
+            { "PUBLIC_STATS_HMAC_KEY" = "secret://${google_secret_manager_secret_version.public-stats-hmac-key.id}" },
             local.cache_config,
             local.csrf_config,
             local.database_config,
@@ -198,6 +205,7 @@ resource "google_cloud_run_service" "server" {
     google_secret_manager_secret_iam_member.server-db-apikey-sig-hmac,
     google_secret_manager_secret_iam_member.server-db-verification-code-hmac,
     google_secret_manager_secret_iam_member.server-ratelimit-hmac-key,
+    google_secret_manager_secret_iam_member.server-public-stats-hmac-key,
     google_secret_manager_secret_iam_member.server-cookie-encryption-key,
     google_secret_manager_secret_iam_member.server-cookie-hmac-key,
     google_secret_manager_secret_iam_member.server-csrf,
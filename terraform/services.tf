@@ -77,8 +77,8 @@ locals {
     CERTIFICATE_SIGNING_KEY     = trimprefix(data.google_kms_crypto_key_version.certificate-signer-version.id, "//cloudkms.googleapis.com/v1/")
     CERTIFICATE_SIGNING_KEYRING = google_kms_key_ring.verification.self_link
 
-    TOKEN_KEY_MANAGER = "GOOGLE_CLOUD_KMS"
-    TOKEN_SIGNING_KEY = trimprefix(data.google_kms_crypto_key_version.token-signer-version.id, "//cloudkms.googleapis.com/v1/")
+    TOKEN_SIGNING_KEY     = trimprefix(data.google_kms_crypto_key_version.token-signer-version.id, "//cloudkms.googleapis.com/v1/")
+    TOKEN_SIGNING_KEYRING = google_kms_key_ring.verification.self_link
   }
 
   e2e_runner_config = {
@@ -13,7 +13,9 @@
 // limitations under the License.
 
 // Utility for creating keys using the Key Manager. The Key Manager must support
-// creating keys.
+// creating keys. By default, keys are created on the local filesystem. Set
+// KEY_MANAGER=PKCS11 and the PKCS11_* variables to create keys on an HSM
+// instead.
 package main
 
 import (
@@ -27,6 +29,7 @@ import (
 
 	"github.com/google/exposure-notifications-server/pkg/keys"
 	"github.com/google/exposure-notifications-server/pkg/logging"
+	"github.com/google/exposure-notifications-verification-server/pkg/keyutils"
 
 	"github.com/sethvargo/go-signalcontext"
 )
@@ -48,14 +51,14 @@ func main() {
 	}
 }
 
-func realMain(ctx context.Context) error {
-	_, self, _, ok := runtime.Caller(1)
-	if !ok {
-		return fmt.Errorf("failed to get caller")
-	}
+// keyCreator is a key manager that can create signing and encryption keys.
+type keyCreator interface {
+	keys.SigningKeyManager
+	CreateEncryptionKey(ctx context.Context, parent, name string) (string, error)
+}
 
-	localDir := filepath.Join(filepath.Dir(self), "../../local")
-	kms, err := keys.NewFilesystem(ctx, localDir)
+func realMain(ctx context.Context) error {
+	kms, err := keyManager(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to build certificate key manager: %w", err)
 	}
@@ -132,3 +135,28 @@ func realMain(ctx context.Context) error {
 
 	return nil
 }
+
+// keyManager returns the key manager to create keys in.
+func keyManager(ctx context.Context) (keyCreator, error) {
+	if keys.KeyManagerType(os.Getenv("KEY_MANAGER")) == keyutils.KeyManagerTypePKCS11 {
+		km, err := keyutils.KeyManagerFor(ctx, &keys.Config{
+			KeyManagerType: keyutils.KeyManagerTypePKCS11,
+		})
+		if err != nil {
+			return nil, err
+		}
+		typ, ok := km.(keyCreator)
+		if !ok {
+			return nil, fmt.Errorf("key manager does not support creating keys")
+		}
+		return typ, nil
+	}
+
+	_, self, _, ok := runtime.Caller(1)
+	if !ok {
+		return nil, fmt.Errorf("failed to get caller")
+	}
+
+	localDir := filepath.Join(filepath.Dir(self), "../../local")
+	return keys.NewFilesystem(ctx, localDir)
+}
@@ -0,0 +1,216 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package main exports realm configuration to a YAML or JSON document, and
+// diffs and applies such documents to the database.
+//
+//	realm-sync -realm "State of Wonder" -file realms.yaml export
+//	realm-sync -file realms.yaml diff
+//	realm-sync -file realms.yaml -actor admin@example.com apply
+//
+// Secrets are never exported. To set the Twilio auth token or SMTP password,
+// name the environment variable which contains it in authTokenEnv or
+// passwordEnv.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/google/exposure-notifications-verification-server/pkg/config"
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+	"github.com/google/exposure-notifications-verification-server/pkg/realmsync"
+
+	"github.com/google/exposure-notifications-server/pkg/logging"
+
+	_ "github.com/jinzhu/gorm/dialects/postgres"
+	"github.com/sethvargo/go-envconfig"
+	"github.com/sethvargo/go-signalcontext"
+)
+
+var (
+	fileFlag  = flag.String("file", "", "path to the realm configuration, .json or .yaml (export writes to stdout if empty)")
+	realmFlag = flag.String("realm", "", "comma-separated realm names to export (default all)")
+	jsonFlag  = flag.Bool("json", false, "export as JSON when writing to stdout")
+	actorFlag = flag.String("actor", "", "email of the user to record in the audit log (required for apply)")
+	pruneFlag = flag.Bool("prune", false, "remove mobile apps, API keys, members, and SMS/email configs not in the file")
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] export|diff|apply\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	ctx, done := signalcontext.OnInterrupt()
+
+	debug, _ := strconv.ParseBool(os.Getenv("LOG_DEBUG"))
+	logger := logging.NewLogger(debug)
+	ctx = logging.WithLogger(ctx, logger)
+
+	err := realMain(ctx)
+	done()
+
+	if err != nil {
+		logger.Fatal(err)
+	}
+}
+
+func realMain(ctx context.Context) error {
+	if flag.NArg() != 1 {
+		flag.Usage()
+		return fmt.Errorf("expected exactly one command")
+	}
+	cmd := flag.Arg(0)
+
+	var cfg database.Config
+	if err := config.ProcessWith(ctx, &cfg, envconfig.OsLookuper()); err != nil {
+		return fmt.Errorf("failed to process config: %w", err)
+	}
+
+	db, err := cfg.Load(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load database config: %w", err)
+	}
+	if err := db.Open(ctx); err != nil {
+		return fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer db.Close()
+
+	switch cmd {
+	case "export":
+		return export(db)
+	case "diff":
+		return diff(db)
+	case "apply":
+		return apply(db)
+	default:
+		flag.Usage()
+		return fmt.Errorf("unknown command %q", cmd)
+	}
+}
+
+func export(db *database.Database) error {
+	var names []string
+	for _, name := range strings.Split(*realmFlag, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+
+	f, err := realmsync.Export(db, names...)
+	if err != nil {
+		return err
+	}
+
+	asJSON := *jsonFlag
+	if *fileFlag != "" {
+		asJSON = strings.EqualFold(filepath.Ext(*fileFlag), ".json")
+	}
+
+	b, err := f.Marshal(asJSON)
+	if err != nil {
+		return fmt.Errorf("failed to encode realms: %w", err)
+	}
+
+	if *fileFlag == "" {
+		_, err := os.Stdout.Write(b)
+		return err
+	}
+	if err := ioutil.WriteFile(*fileFlag, b, 0o600); err != nil {
+		return fmt.Errorf("failed to write %s: %w", *fileFlag, err)
+	}
+	return nil
+}
+
+// load reads and normalizes the realm configuration from -file.
+func load() (*realmsync.File, error) {
+	if *fileFlag == "" {
+		return nil, fmt.Errorf("-file is required")
+	}
+
+	f, err := realmsync.Load(*fileFlag)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range f.Realms {
+		if err := r.Normalize(); err != nil {
+			return nil, fmt.Errorf("realm %q: %w", r.Name, err)
+		}
+	}
+	return f, nil
+}
+
+func diff(db *database.Database) error {
+	f, err := load()
+	if err != nil {
+		return err
+	}
+
+	total := 0
+	for _, r := range f.Realms {
+		changes, err := realmsync.Plan(db, r)
+		if err != nil {
+			return fmt.Errorf("realm %q: %w", r.Name, err)
+		}
+		for _, c := range changes {
+			fmt.Println(c)
+		}
+		total += len(changes)
+	}
+
+	fmt.Printf("%d change(s)\n", total)
+	return nil
+}
+
+func apply(db *database.Database) error {
+	if *actorFlag == "" {
+		return fmt.Errorf("-actor is required")
+	}
+	actor, err := db.FindUserByEmail(*actorFlag)
+	if err != nil {
+		return fmt.Errorf("failed to find actor %q: %w", *actorFlag, err)
+	}
+
+	f, err := load()
+	if err != nil {
+		return err
+	}
+
+	opts := &realmsync.Options{Prune: *pruneFlag}
+	for _, r := range f.Realms {
+		result, err := realmsync.Apply(db, r, actor, opts)
+		if err != nil {
+			return fmt.Errorf("realm %q: %w", r.Name, err)
+		}
+
+		for _, c := range result.Changes {
+			fmt.Println(c)
+		}
+		for _, c := range result.Skipped {
+			fmt.Printf("%s (skipped, use -prune to remove)\n", c)
+		}
+		for name, key := range result.CreatedAPIKeys {
+			fmt.Printf("%s: created API key %q: %s\n", r.Name, name, key)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,177 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package main verifies the hash-chained audit log, reporting entries which
+// were modified, deleted, or inserted outside of the chain, and checkpoints
+// which are unsigned or not signed by a trusted key.
+//
+//	verify-audit-chain -trusted-keys audit-chain.pem
+//	verify-audit-chain -realm 1,2 -trusted-keys audit-chain.pem,old.pem
+//
+// At least one trusted key is required. Realm 0 is the chain of system events.
+// The command exits non-zero if any chain has problems.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/google/exposure-notifications-verification-server/pkg/config"
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+
+	"github.com/google/exposure-notifications-server/pkg/logging"
+
+	_ "github.com/jinzhu/gorm/dialects/postgres"
+	"github.com/sethvargo/go-envconfig"
+	"github.com/sethvargo/go-signalcontext"
+)
+
+var (
+	realmFlag       = flag.String("realm", "", "comma-separated realm IDs to verify, 0 for system events (default all)")
+	trustedKeysFlag = flag.String("trusted-keys", "", "comma-separated paths to PEM public keys; checkpoints must be signed by one of them (required)")
+	jsonFlag        = flag.Bool("json", false, "print the reports as JSON")
+)
+
+func main() {
+	flag.Parse()
+
+	ctx, done := signalcontext.OnInterrupt()
+
+	debug, _ := strconv.ParseBool(os.Getenv("LOG_DEBUG"))
+	logger := logging.NewLogger(debug)
+	ctx = logging.WithLogger(ctx, logger)
+
+	err := realMain(ctx)
+	done()
+
+	if err != nil {
+		logger.Fatal(err)
+	}
+}
+
+func realMain(ctx context.Context) error {
+	realmIDs, err := parseRealmIDs(*realmFlag)
+	if err != nil {
+		return err
+	}
+
+	trustedKeys, err := readTrustedKeys(*trustedKeysFlag)
+	if err != nil {
+		return err
+	}
+	if len(trustedKeys) == 0 {
+		return fmt.Errorf("-trusted-keys is required")
+	}
+
+	var cfg database.Config
+	if err := config.ProcessWith(ctx, &cfg, envconfig.OsLookuper()); err != nil {
+		return fmt.Errorf("failed to process config: %w", err)
+	}
+
+	db, err := cfg.Load(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load database config: %w", err)
+	}
+	if err := db.Open(ctx); err != nil {
+		return fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer db.Close()
+
+	if len(realmIDs) == 0 {
+		realmIDs, err = db.ListAuditChainRealmIDs()
+		if err != nil {
+			return err
+		}
+	}
+
+	var failed int
+	for _, id := range realmIDs {
+		report, err := db.VerifyAuditChain(id, trustedKeys)
+		if err != nil {
+			return fmt.Errorf("failed to verify realm %d: %w", id, err)
+		}
+		if !report.OK() {
+			failed++
+		}
+
+		if err := printReport(report); err != nil {
+			return err
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d audit chains failed verification", failed, len(realmIDs))
+	}
+	return nil
+}
+
+// parseRealmIDs parses the comma-separated realm IDs.
+func parseRealmIDs(s string) ([]uint, error) {
+	var ids []uint
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v == "" {
+			continue
+		}
+		id, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid realm ID %q: %w", v, err)
+		}
+		ids = append(ids, uint(id))
+	}
+	return ids, nil
+}
+
+// readTrustedKeys reads the PEM public keys at the comma-separated paths.
+func readTrustedKeys(s string) ([]string, error) {
+	var keys []string
+	for _, path := range strings.Split(s, ",") {
+		if path = strings.TrimSpace(path); path == "" {
+			continue
+		}
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read trusted key: %w", err)
+		}
+		keys = append(keys, string(b))
+	}
+	return keys, nil
+}
+
+func printReport(report *database.AuditChainReport) error {
+	if *jsonFlag {
+		b, err := json.Marshal(report)
+		if err != nil {
+			return fmt.Errorf("failed to encode report: %w", err)
+		}
+		fmt.Println(string(b))
+		return nil
+	}
+
+	status := "OK"
+	if !report.OK() {
+		status = "FAILED"
+	}
+	fmt.Printf("realm %d: %s, %d entries (%d-%d), %d checkpoints\n",
+		report.RealmID, status, report.Entries, report.FirstSequence, report.LastSequence, report.Checkpoints)
+	for _, p := range report.Problems {
+		fmt.Printf("  problem: %s\n", p)
+	}
+	return nil
+}